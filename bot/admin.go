@@ -1,11 +1,19 @@
 package bot
 
 import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 	"wfsync/entity"
+	"wfsync/lib/audit"
+	"wfsync/lib/metrics"
 
 	"github.com/google/uuid"
 
@@ -24,7 +32,7 @@ func (t *TgBot) usersCmd(_ *tgbotapi.Bot, ctx *ext.Context) error {
 	}
 	chatId := ctx.EffectiveUser.Id
 	if !t.requireAdmin(chatId) {
-		t.plainResponse(chatId, "Admin access required\\.")
+		t.plainResponse(chatId, tr(t.lang(chatId), msgAdminRequired))
 		return nil
 	}
 
@@ -36,7 +44,7 @@ func (t *TgBot) usersCmd(_ *tgbotapi.Bot, ctx *ext.Context) error {
 	t.mu.RUnlock()
 
 	if len(users) == 0 {
-		t.plainResponse(chatId, "No telegram users found\\.")
+		t.plainResponse(chatId, tr(t.lang(chatId), msgNoUsers))
 		return nil
 	}
 
@@ -75,11 +83,16 @@ func (t *TgBot) usersCmd(_ *tgbotapi.Bot, ctx *ext.Context) error {
 			if len(u.TelegramTopics) > 0 {
 				topics = strings.Join(u.TelegramTopics, ",")
 			}
-			sb.WriteString(fmt.Sprintf("  %s \\| %s \\| tier:%s \\| topics:%s\n",
+			seen := "never"
+			if !u.LastSeen.IsZero() {
+				seen = u.LastSeen.Format(retryJobTimeFormat)
+			}
+			sb.WriteString(fmt.Sprintf("  %s \\| %s \\| tier:%s \\| topics:%s \\| seen:%s\n",
 				Sanitize(userDisplayName(u)),
 				Sanitize(enabled),
 				Sanitize(tier),
 				Sanitize(topics),
+				Sanitize(seen),
 			))
 			if role == entity.RolePending {
 				pendingUsers = append(pendingUsers, u)
@@ -94,9 +107,9 @@ func (t *TgBot) usersCmd(_ *tgbotapi.Bot, ctx *ext.Context) error {
 
 	// Send individual messages with approve/revoke buttons for each pending user
 	for _, u := range pendingUsers {
-		keyboard := buildPendingUserButtons(u.TelegramId)
+		keyboard := buildPendingUserButtons(u.TelegramId, t.lang(chatId))
 		t.sendWithKeyboard(chatId,
-			fmt.Sprintf("Pending: %s", Sanitize(userDisplayName(u))),
+			tr(t.lang(chatId), msgPendingUser, Sanitize(userDisplayName(u))),
 			keyboard,
 		)
 	}
@@ -110,110 +123,126 @@ func (t *TgBot) approve(_ *tgbotapi.Bot, ctx *ext.Context) error {
 	}
 	chatId := ctx.EffectiveUser.Id
 	if !t.requireAdmin(chatId) {
-		t.plainResponse(chatId, "Admin access required\\.")
+		t.plainResponse(chatId, tr(t.lang(chatId), msgAdminRequired))
 		return nil
 	}
 
 	args := strings.Fields(ctx.EffectiveMessage.Text)
 	if len(args) < 2 {
-		t.plainResponse(chatId, "Usage: `/approve <id|@username>`")
+		t.plainResponse(chatId, tr(t.lang(chatId), msgUsage, "/approve <id|@username>"))
 		return nil
 	}
 
 	target := t.resolveUser(args[1])
 	if target == nil {
-		t.plainResponse(chatId, "User not found: "+Sanitize(args[1]))
+		t.plainResponse(chatId, tr(t.lang(chatId), msgUserNotFound, Sanitize(args[1])))
 		return nil
 	}
 
-	err := t.db.SetTelegramRole(target.TelegramId, entity.RoleUser)
+	err := t.setRole(chatId, target.TelegramId, entity.RoleUser)
+	if errors.Is(err, errLastAdmin) {
+		t.plainResponse(chatId, tr(t.lang(chatId), msgLastAdmin))
+		return nil
+	}
 	if err != nil {
 		t.reportError(chatId, "/approve", err)
 		return nil
 	}
 
-	// Set default topic to invoice only for new users
-	_ = t.db.SetTelegramTopics(target.TelegramId, []string{entity.TopicInvoice, entity.TopicError})
+	t.setDefaultTopics(target.TelegramId, entity.RoleUser)
 
-	t.plainResponse(chatId, "User "+Sanitize(userDisplayName(target))+" approved\\.")
-	t.plainResponse(target.TelegramId, "Your registration has been approved\\! Notifications are now enabled\\.")
+	t.plainResponse(chatId, tr(t.lang(chatId), msgUserApproved, Sanitize(userDisplayName(target))))
+	t.plainResponse(target.TelegramId, tr(t.lang(target.TelegramId), msgAccessApproved))
 	t.loadUsers()
 	t.setUserCommands(target.TelegramId, entity.RoleUser)
 	return nil
 }
 
-// revoke sets a user's role to RoleNone, disabling all access and notifications.
+// revoke asks to confirm revoking a user; the confirm button sets the user's role to
+// RoleNone, disabling all access and notifications.
 func (t *TgBot) revoke(_ *tgbotapi.Bot, ctx *ext.Context) error {
 	if t.db == nil {
 		return nil
 	}
 	chatId := ctx.EffectiveUser.Id
 	if !t.requireAdmin(chatId) {
-		t.plainResponse(chatId, "Admin access required\\.")
+		t.plainResponse(chatId, tr(t.lang(chatId), msgAdminRequired))
 		return nil
 	}
 
 	args := strings.Fields(ctx.EffectiveMessage.Text)
 	if len(args) < 2 {
-		t.plainResponse(chatId, "Usage: `/revoke <id|@username>`")
+		t.plainResponse(chatId, tr(t.lang(chatId), msgUsage, "/revoke <id|@username>"))
 		return nil
 	}
 
 	target := t.resolveUser(args[1])
 	if target == nil {
-		t.plainResponse(chatId, "User not found: "+Sanitize(args[1]))
+		t.plainResponse(chatId, tr(t.lang(chatId), msgUserNotFound, Sanitize(args[1])))
 		return nil
 	}
 
-	err := t.db.SetTelegramRole(target.TelegramId, entity.RoleNone)
-	if err != nil {
-		t.reportError(chatId, "/revoke", err)
-		return nil
-	}
+	t.sendWithKeyboard(chatId,
+		tr(t.lang(chatId), msgConfirmRevoke, Sanitize(userDisplayName(target))),
+		buildConfirmKeyboard(confirmRevoke, target.TelegramId, t.lang(chatId)),
+	)
+	return nil
+}
 
-	t.plainResponse(chatId, "User "+Sanitize(userDisplayName(target))+" revoked\\.")
-	t.plainResponse(target.TelegramId, "Your access has been revoked\\.")
+// revokeUser sets the target's role to RoleNone on behalf of chatId and tells the target.
+func (t *TgBot) revokeUser(chatId int64, target *entity.User) error {
+	if err := t.setRole(chatId, target.TelegramId, entity.RoleNone); err != nil {
+		return err
+	}
+	t.plainResponse(target.TelegramId, tr(t.lang(target.TelegramId), msgAccessRevoked))
 	t.loadUsers()
 	t.setUserCommands(target.TelegramId, entity.RoleNone)
 	return nil
 }
 
-// adminCmd promotes an approved user to admin role.
+// adminCmd asks to confirm promoting an approved user; the confirm button makes the
+// user an admin.
 func (t *TgBot) adminCmd(_ *tgbotapi.Bot, ctx *ext.Context) error {
 	if t.db == nil {
 		return nil
 	}
 	chatId := ctx.EffectiveUser.Id
 	if !t.requireAdmin(chatId) {
-		t.plainResponse(chatId, "Admin access required\\.")
+		t.plainResponse(chatId, tr(t.lang(chatId), msgAdminRequired))
 		return nil
 	}
 
 	args := strings.Fields(ctx.EffectiveMessage.Text)
 	if len(args) < 2 {
-		t.plainResponse(chatId, "Usage: `/admin <id|@username>`")
+		t.plainResponse(chatId, tr(t.lang(chatId), msgUsage, "/admin <id|@username>"))
 		return nil
 	}
 
 	target := t.resolveUser(args[1])
 	if target == nil {
-		t.plainResponse(chatId, "User not found: "+Sanitize(args[1]))
+		t.plainResponse(chatId, tr(t.lang(chatId), msgUserNotFound, Sanitize(args[1])))
 		return nil
 	}
 
 	if !target.IsApproved() {
-		t.plainResponse(chatId, "User must be approved first\\.")
+		t.plainResponse(chatId, tr(t.lang(chatId), msgMustBeApproved))
 		return nil
 	}
 
-	err := t.db.SetTelegramRole(target.TelegramId, entity.RoleAdmin)
-	if err != nil {
-		t.reportError(chatId, "/admin", err)
-		return nil
-	}
+	t.sendWithKeyboard(chatId,
+		tr(t.lang(chatId), msgConfirmAdmin, Sanitize(userDisplayName(target))),
+		buildConfirmKeyboard(confirmAdmin, target.TelegramId, t.lang(chatId)),
+	)
+	return nil
+}
 
-	t.plainResponse(chatId, "User "+Sanitize(userDisplayName(target))+" promoted to admin\\.")
-	t.plainResponse(target.TelegramId, "You have been promoted to admin\\!")
+// promoteUser makes the target an admin on behalf of chatId and tells the target.
+func (t *TgBot) promoteUser(chatId int64, target *entity.User) error {
+	if err := t.setRole(chatId, target.TelegramId, entity.RoleAdmin); err != nil {
+		return err
+	}
+	t.setDefaultTopics(target.TelegramId, entity.RoleAdmin)
+	t.plainResponse(target.TelegramId, tr(t.lang(target.TelegramId), msgPromotedToAdmin))
 	t.loadUsers()
 	t.setUserCommands(target.TelegramId, entity.RoleAdmin)
 	return nil
@@ -227,11 +256,11 @@ func (t *TgBot) invite(_ *tgbotapi.Bot, ctx *ext.Context) error {
 	}
 	chatId := ctx.EffectiveUser.Id
 	if !t.requireAdmin(chatId) {
-		t.plainResponse(chatId, "Admin access required\\.")
+		t.plainResponse(chatId, tr(t.lang(chatId), msgAdminRequired))
 		return nil
 	}
 
-	code := uuid.New().String()[:t.config.InviteCodeLength]
+	code := uuid.New().String()[:clampInviteCodeLength(t.config.InviteCodeLength)]
 
 	inviteCode := &entity.InviteCode{
 		Code:      code,
@@ -249,7 +278,7 @@ func (t *TgBot) invite(_ *tgbotapi.Bot, ctx *ext.Context) error {
 
 	botUsername := t.api.Username
 	deepLink := fmt.Sprintf("https://t.me/%s?start=%s", botUsername, code)
-	t.plainResponse(chatId, fmt.Sprintf("Invite code: `%s`\nDeep link: %s", Sanitize(code), Sanitize(deepLink)))
+	t.plainResponse(chatId, tr(t.lang(chatId), msgInviteCode, Sanitize(code), Sanitize(deepLink)))
 	return nil
 }
 
@@ -262,7 +291,7 @@ func (t *TgBot) retries(_ *tgbotapi.Bot, ctx *ext.Context) error {
 	}
 	chatId := ctx.EffectiveUser.Id
 	if !t.requireAdmin(chatId) {
-		t.plainResponse(chatId, "Admin access required\\.")
+		t.plainResponse(chatId, tr(t.lang(chatId), msgAdminRequired))
 		return nil
 	}
 
@@ -272,7 +301,7 @@ func (t *TgBot) retries(_ *tgbotapi.Bot, ctx *ext.Context) error {
 		return nil
 	}
 	if len(jobs) == 0 {
-		t.plainResponse(chatId, "No pending retry jobs\\.")
+		t.plainResponse(chatId, tr(t.lang(chatId), msgNoRetryJobs))
 		return nil
 	}
 
@@ -329,3 +358,263 @@ func escapeCodeBlock(s string) string {
 	s = strings.ReplaceAll(s, "`", "\\`")
 	return s
 }
+
+// metricsCmd reports the in-process operational counters, the number of active and
+// pending users, and the service uptime. Admin only.
+func (t *TgBot) metricsCmd(_ *tgbotapi.Bot, ctx *ext.Context) error {
+	chatId := ctx.EffectiveUser.Id
+	if !t.requireAdmin(chatId) {
+		t.plainResponse(chatId, tr(t.lang(chatId), msgAdminRequired))
+		return nil
+	}
+
+	active, pending := 0, 0
+	t.mu.RLock()
+	for _, u := range t.users {
+		if u.IsPending() {
+			pending++
+		} else if u.TelegramEnabled && u.IsApproved() {
+			active++
+		}
+	}
+	t.mu.RUnlock()
+
+	t.plainResponse(chatId, formatMetrics(metrics.Read(), active, pending, time.Now()))
+	return nil
+}
+
+// reloadCmd refreshes the user cache from the database, picking up manual edits, and
+// reports what was loaded. Admin only.
+func (t *TgBot) reloadCmd(_ *tgbotapi.Bot, ctx *ext.Context) error {
+	if t.db == nil {
+		return nil
+	}
+	chatId := ctx.EffectiveUser.Id
+	if !t.requireAdmin(chatId) {
+		t.plainResponse(chatId, tr(t.lang(chatId), msgAdminRequired))
+		return nil
+	}
+
+	if err := t.loadUsers(); err != nil {
+		t.reportError(chatId, "/reload", err)
+		return nil
+	}
+
+	t.mu.RLock()
+	total, admins := len(t.users), len(t.adminIds)
+	active, pending := 0, 0
+	for _, u := range t.users {
+		if u.IsPending() {
+			pending++
+		} else if u.TelegramEnabled && u.IsApproved() {
+			active++
+		}
+	}
+	t.mu.RUnlock()
+
+	t.plainResponse(chatId, tr(t.lang(chatId), msgUsersReloaded, total, active, pending, admins))
+	return nil
+}
+
+// formatMetrics renders a counter snapshot as a MarkdownV2 message.
+func formatMetrics(s metrics.Snapshot, active, pending int, now time.Time) string {
+	var sb strings.Builder
+	sb.WriteString("*Metrics* \\(since start\\)\n")
+	sb.WriteString(fmt.Sprintf("Orders processed: *%d*\n", s.OrdersProcessed))
+	sb.WriteString(fmt.Sprintf("Invoices created: *%d*\n", s.InvoicesCreated))
+	sb.WriteString(fmt.Sprintf("Failures: *%d*\n", s.Failures))
+	sb.WriteString(fmt.Sprintf("Active users: *%d*\n", active))
+	sb.WriteString(fmt.Sprintf("Pending users: *%d*\n", pending))
+	sb.WriteString(fmt.Sprintf("Uptime: %s", formatUptime(now.Sub(s.Started))))
+	return sb.String()
+}
+
+// formatUptime renders a duration as days, hours and minutes, e.g. "2d 3h 4m".
+func formatUptime(d time.Duration) string {
+	if d < time.Minute {
+		return "0m"
+	}
+	days := int(d / (24 * time.Hour))
+	hours := int(d % (24 * time.Hour) / time.Hour)
+	minutes := int(d % time.Hour / time.Minute)
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%dd %dh %dm", days, hours, minutes)
+	case hours > 0:
+		return fmt.Sprintf("%dh %dm", hours, minutes)
+	default:
+		return fmt.Sprintf("%dm", minutes)
+	}
+}
+
+// featuresCmd lists the runtime state of the subsystem feature flags.
+func (t *TgBot) featuresCmd(_ *tgbotapi.Bot, ctx *ext.Context) error {
+	chatId := ctx.EffectiveUser.Id
+	if !t.requireAdmin(chatId) {
+		t.plainResponse(chatId, tr(t.lang(chatId), msgAdminRequired))
+		return nil
+	}
+	if t.features == nil {
+		t.plainResponse(chatId, tr(t.lang(chatId), msgFeaturesUnconfigured))
+		return nil
+	}
+
+	t.plainResponse(chatId, formatFeatures(t.features.List()))
+	return nil
+}
+
+// featureCmd switches a subsystem on or off: /feature <name> on|off.
+func (t *TgBot) featureCmd(_ *tgbotapi.Bot, ctx *ext.Context) error {
+	chatId := ctx.EffectiveUser.Id
+	if !t.requireAdmin(chatId) {
+		t.plainResponse(chatId, tr(t.lang(chatId), msgAdminRequired))
+		return nil
+	}
+	if t.features == nil {
+		t.plainResponse(chatId, tr(t.lang(chatId), msgFeaturesUnconfigured))
+		return nil
+	}
+
+	args := strings.Fields(ctx.EffectiveMessage.Text)
+	if len(args) < 3 || (args[2] != "on" && args[2] != "off") {
+		t.plainResponse(chatId, tr(t.lang(chatId), msgUsage, "/feature <"+strings.Join(entity.Features, "|")+"> on|off"))
+		return nil
+	}
+	name := strings.ToLower(args[1])
+	enabled := args[2] == "on"
+
+	_, err := t.features.Set(name, enabled, audit.TelegramActor(chatId))
+	if errors.Is(err, entity.ErrUnknownFeature) {
+		t.plainResponse(chatId, tr(t.lang(chatId), msgUnknownFeature, Sanitize(name)))
+		return nil
+	}
+	if err != nil {
+		t.reportError(chatId, "/feature", err)
+		return nil
+	}
+
+	t.plainResponse(chatId, tr(t.lang(chatId), msgFeatureSwitched, Sanitize(name), args[2]))
+	return nil
+}
+
+// formatFeatures renders feature flag states as a MarkdownV2 message.
+func formatFeatures(flags []*entity.FeatureFlag) string {
+	var sb strings.Builder
+	sb.WriteString("*Features*\n")
+	for _, flag := range flags {
+		state := "on"
+		if !flag.Enabled {
+			state = "*off*"
+		}
+		sb.WriteString(fmt.Sprintf("`%s`: %s", flag.Name, state))
+		if flag.UpdatedBy != "" {
+			sb.WriteString(fmt.Sprintf(" \\(%s, %s\\)", Sanitize(flag.UpdatedBy), Sanitize(flag.UpdatedAt.Format(retryJobTimeFormat))))
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// exportFormats lists the formats /export can produce; the first one is the default.
+var exportFormats = []string{"json", "csv"}
+
+// exportedUser is one row of a user export.
+type exportedUser struct {
+	Id       int64    `json:"id"`
+	Username string   `json:"username"`
+	Role     string   `json:"role"`
+	Tier     string   `json:"tier"`
+	Topics   []string `json:"topics"`
+	Enabled  bool     `json:"enabled"`
+}
+
+// exportCmd sends the cached user list as a JSON or CSV document:
+// /export [json|csv]. Admin only.
+func (t *TgBot) exportCmd(_ *tgbotapi.Bot, ctx *ext.Context) error {
+	if t.db == nil {
+		return nil
+	}
+	chatId := ctx.EffectiveUser.Id
+	if !t.requireAdmin(chatId) {
+		t.plainResponse(chatId, tr(t.lang(chatId), msgAdminRequired))
+		return nil
+	}
+
+	format := exportFormats[0]
+	if args := strings.Fields(ctx.EffectiveMessage.Text); len(args) > 1 {
+		format = strings.ToLower(args[1])
+	}
+	if !slices.Contains(exportFormats, format) {
+		t.plainResponse(chatId, tr(t.lang(chatId), msgUsage, "/export [json|csv]"))
+		return nil
+	}
+
+	t.mu.RLock()
+	users := make([]*entity.User, 0, len(t.users))
+	for _, u := range t.users {
+		users = append(users, u)
+	}
+	t.mu.RUnlock()
+
+	data, err := exportUsers(users, format)
+	if err != nil {
+		t.reportError(chatId, "/export", err)
+		return nil
+	}
+	name := fmt.Sprintf("users-%s.%s", t.clock.Now().Format("20060102"), format)
+	_, err = t.api.SendDocument(chatId, tgbotapi.InputFileByReader(name, bytes.NewReader(data)), &tgbotapi.SendDocumentOpts{
+		Caption: fmt.Sprintf("Users: %d", len(users)),
+	})
+	if err != nil {
+		t.reportError(chatId, "/export", fmt.Errorf("send document: %w", err))
+	}
+	return nil
+}
+
+// exportUsers renders users ordered by telegram id as a JSON array or as CSV with a
+// header row; in CSV the topics are joined with ";". No topics means all topics.
+func exportUsers(users []*entity.User, format string) ([]byte, error) {
+	rows := make([]exportedUser, 0, len(users))
+	for _, u := range users {
+		tier := u.SubscriptionTier
+		if tier == "" {
+			tier = entity.TierRealtime
+		}
+		topics := u.TelegramTopics
+		if topics == nil {
+			topics = []string{}
+		}
+		rows = append(rows, exportedUser{
+			Id:       u.TelegramId,
+			Username: u.TelegramUsername,
+			Role:     string(u.TelegramRole),
+			Tier:     string(tier),
+			Topics:   topics,
+			Enabled:  u.TelegramEnabled,
+		})
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].Id < rows[j].Id })
+
+	switch format {
+	case "json":
+		return json.MarshalIndent(rows, "", "  ")
+	case "csv":
+		var buf bytes.Buffer
+		w := csv.NewWriter(&buf)
+		_ = w.Write([]string{"id", "username", "role", "tier", "topics", "enabled"})
+		for _, r := range rows {
+			_ = w.Write([]string{
+				strconv.FormatInt(r.Id, 10),
+				r.Username,
+				r.Role,
+				r.Tier,
+				strings.Join(r.Topics, ";"),
+				strconv.FormatBool(r.Enabled),
+			})
+		}
+		w.Flush()
+		return buf.Bytes(), w.Error()
+	default:
+		return nil, fmt.Errorf("unknown export format: %s", format)
+	}
+}
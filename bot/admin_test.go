@@ -0,0 +1,647 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+	"wfsync/entity"
+	"wfsync/lib/clock"
+	"wfsync/lib/metrics"
+
+	tgbotapi "github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers/filters/message"
+)
+
+// TestFormatUptime checks the day/hour/minute rendering, dropping leading zero units.
+func TestFormatUptime(t *testing.T) {
+	cases := []struct {
+		name string
+		d    time.Duration
+		want string
+	}{
+		{"under a minute", 42 * time.Second, "0m"},
+		{"minutes", 7*time.Minute + 30*time.Second, "7m"},
+		{"hours", 3*time.Hour + 5*time.Minute, "3h 5m"},
+		{"days", 50*time.Hour + 4*time.Minute, "2d 2h 4m"},
+		{"whole days", 48 * time.Hour, "2d 0h 0m"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := formatUptime(tc.d); got != tc.want {
+				t.Errorf("formatUptime(%v) = %q, want %q", tc.d, got, tc.want)
+			}
+		})
+	}
+}
+
+// TestFormatMetrics checks that every counter and the uptime appear in the message and
+// that the text is escaped for MarkdownV2.
+func TestFormatMetrics(t *testing.T) {
+	started := time.Date(2025, 5, 1, 9, 0, 0, 0, time.UTC)
+	s := metrics.Snapshot{OrdersProcessed: 12, InvoicesCreated: 10, Failures: 2, Started: started}
+
+	msg := formatMetrics(s, 4, 1, started.Add(26*time.Hour+15*time.Minute))
+	for _, want := range []string{
+		"\\(since start\\)",
+		"Orders processed: *12*",
+		"Invoices created: *10*",
+		"Failures: *2*",
+		"Active users: *4*",
+		"Pending users: *1*",
+		"Uptime: 1d 2h 15m",
+	} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("metrics message missing %q:\n%s", want, msg)
+		}
+	}
+}
+
+// usersDB keeps telegram users in memory and records the topics set for each of them.
+type usersDB struct {
+	Database
+	users   map[int64]*entity.User
+	topics  map[int64][]string
+	touched []int64
+	loadErr error
+}
+
+func (d *usersDB) GetAllTelegramUsers() ([]*entity.User, error) {
+	if d.loadErr != nil {
+		return nil, d.loadErr
+	}
+	users := make([]*entity.User, 0, len(d.users))
+	for _, u := range d.users {
+		users = append(users, u)
+	}
+	return users, nil
+}
+
+func (d *usersDB) SetTelegramRole(telegramId int64, role entity.TelegramRole) error {
+	d.users[telegramId].TelegramRole = role
+	return nil
+}
+
+func (d *usersDB) SetTelegramTopics(telegramId int64, topics []string) error {
+	d.topics[telegramId] = topics
+	return nil
+}
+
+func (d *usersDB) TouchUser(telegramId int64) error {
+	d.touched = append(d.touched, telegramId)
+	return nil
+}
+
+// TestDefaultTopics checks that approving a user, by command or by the inline button,
+// and promoting one to admin assign the topic defaults configured for the new role.
+// Topics the role may not subscribe to are dropped; an empty list means all topics.
+func TestDefaultTopics(t *testing.T) {
+	cases := []struct {
+		name   string
+		config BotConfig
+		text   string // command text, empty for the approve button
+		want   []string
+	}{
+		{"approve", BotConfig{UserTopics: []string{"invoice", "payment"}}, "/approve 9", []string{"invoice", "payment"}},
+		{"approve button", BotConfig{UserTopics: []string{"invoice", "payment"}}, "", []string{"invoice", "payment"}},
+		{"admin topic dropped for user", BotConfig{UserTopics: []string{"Invoice", "system"}}, "/approve 9", []string{"invoice"}},
+		{"user default empty", BotConfig{}, "/approve 9", nil},
+		{"promote to all", BotConfig{UserTopics: []string{"invoice"}}, "/admin 9", nil},
+		{"promote configured", BotConfig{AdminTopics: []string{"error", "security"}}, "/admin 9", []string{"error", "security"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			targetRole := entity.RolePending
+			if strings.HasPrefix(tc.text, "/admin") {
+				targetRole = entity.RoleUser
+			}
+			db := &usersDB{
+				users: map[int64]*entity.User{
+					7: {TelegramId: 7, TelegramRole: entity.RoleAdmin},
+					9: {TelegramId: 9, TelegramRole: targetRole, TelegramTopics: []string{"payment"}},
+				},
+				topics: map[int64][]string{},
+			}
+			bot := &TgBot{
+				log:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+				api:    &tgbotapi.Bot{Token: "token", BotClient: &fakeBotClient{}},
+				db:     db,
+				config: tc.config,
+			}
+			bot.loadUsers()
+
+			var err error
+			if tc.text == "" {
+				err = bot.onApproveCallback(bot.api, ext.NewContext(bot.api, &tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{
+					Id:   "cq",
+					From: tgbotapi.User{Id: 7},
+					Data: cbApprove + "9",
+				}}, nil))
+			} else {
+				ctx := ext.NewContext(bot.api, &tgbotapi.Update{Message: &tgbotapi.Message{
+					Text: tc.text,
+					From: &tgbotapi.User{Id: 7},
+					Chat: tgbotapi.Chat{Id: 7, Type: "private"},
+				}}, nil)
+				if strings.HasPrefix(tc.text, "/admin") {
+					if err = bot.adminCmd(bot.api, ctx); err == nil {
+						err = pressConfirm(t, bot, 7, 0)
+					}
+				} else {
+					err = bot.approve(bot.api, ctx)
+				}
+			}
+			if err != nil {
+				t.Fatalf("handler: %v", err)
+			}
+
+			got, ok := db.topics[9]
+			if !ok {
+				t.Fatal("topics were not set")
+			}
+			if strings.Join(got, ",") != strings.Join(tc.want, ",") || (got == nil) != (tc.want == nil) {
+				t.Errorf("topics = %#v, want %#v", got, tc.want)
+			}
+		})
+	}
+}
+
+// TestReloadCmd edits the stored users behind the bot's back and checks that /reload
+// picks the edits up and reports the counts, that a failed load is reported rather than
+// answered with the stale counts, and that non-admins are refused.
+func TestReloadCmd(t *testing.T) {
+	cases := []struct {
+		name      string
+		caller    int64
+		loadErr   error
+		wantReply string
+		wantUsers int
+	}{
+		{"admin", 7, nil, "Users reloaded: *4* total, *2* active, *1* pending, *2* admins", 4},
+		{"load fails", 7, errors.New("connection refused"), "Something went wrong", 2},
+		{"user", 9, nil, "Admin access required", 2},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			db := &usersDB{users: map[int64]*entity.User{
+				7: {TelegramId: 7, TelegramRole: entity.RoleAdmin, TelegramEnabled: true},
+				9: {TelegramId: 9, TelegramRole: entity.RoleUser, TelegramEnabled: true},
+			}}
+			client := &fakeBotClient{}
+			bot := &TgBot{
+				log: slog.New(slog.NewTextHandler(io.Discard, nil)),
+				api: &tgbotapi.Bot{Token: "token", BotClient: client},
+				db:  db,
+			}
+			bot.loadUsers()
+
+			// Manual database edits: a new admin, a pending user, user 9 disabled.
+			db.users[10] = &entity.User{TelegramId: 10, TelegramRole: entity.RoleAdmin, TelegramEnabled: true}
+			db.users[11] = &entity.User{TelegramId: 11, TelegramRole: entity.RolePending}
+			db.users[9] = &entity.User{TelegramId: 9, TelegramRole: entity.RoleUser}
+			db.loadErr = tc.loadErr
+
+			ctx := ext.NewContext(bot.api, &tgbotapi.Update{Message: &tgbotapi.Message{
+				Text: "/reload",
+				From: &tgbotapi.User{Id: tc.caller},
+				Chat: tgbotapi.Chat{Id: tc.caller, Type: "private"},
+			}}, nil)
+			if err := bot.reloadCmd(bot.api, ctx); err != nil {
+				t.Fatalf("reloadCmd: %v", err)
+			}
+			// The caller is answered last; a failure also notifies the admins first.
+			if n := len(client.params); n == 0 || !strings.Contains(client.params[n-1]["text"], tc.wantReply) {
+				t.Errorf("replies = %v, want %q", client.params, tc.wantReply)
+			}
+			if got := len(bot.users); got != tc.wantUsers {
+				t.Errorf("cached users = %d, want %d", got, tc.wantUsers)
+			}
+		})
+	}
+}
+
+// TestTouchUser runs a command through the dispatcher and checks that a known user's
+// last-seen time is recorded before the command is answered, that unknown users are
+// left alone, and that /users shows the time.
+func TestTouchUser(t *testing.T) {
+	now := time.Date(2025, 5, 20, 12, 30, 0, 0, time.UTC)
+	cases := []struct {
+		name        string
+		caller      int64
+		wantTouched bool
+	}{
+		{"known user", 7, true},
+		{"unknown user", 42, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			db := &usersDB{users: map[int64]*entity.User{
+				7: {TelegramId: 7, TelegramRole: entity.RoleAdmin, TelegramEnabled: true},
+			}}
+			client := &fakeBotClient{}
+			bot := &TgBot{
+				log:   slog.New(slog.NewTextHandler(io.Discard, nil)),
+				api:   &tgbotapi.Bot{Token: "token", BotClient: client},
+				db:    db,
+				clock: clock.NewMock(now),
+			}
+			bot.loadUsers()
+
+			dispatcher := ext.NewDispatcher(nil)
+			dispatcher.AddHandlerToGroup(handlers.NewMessage(message.Command, bot.touchUser), -1)
+			dispatcher.AddHandler(bot.command("users", bot.usersCmd))
+			err := dispatcher.ProcessUpdate(bot.api, &tgbotapi.Update{Message: &tgbotapi.Message{
+				Text:     "/users",
+				Entities: []tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: 6}},
+				From:     &tgbotapi.User{Id: tc.caller},
+				Chat:     tgbotapi.Chat{Id: tc.caller, Type: "private"},
+			}}, nil)
+			if err != nil {
+				t.Fatalf("ProcessUpdate: %v", err)
+			}
+
+			if touched := len(db.touched) == 1 && db.touched[0] == tc.caller; touched != tc.wantTouched {
+				t.Errorf("touched = %v, want caller touched %v", db.touched, tc.wantTouched)
+			}
+			if !tc.wantTouched {
+				return
+			}
+			if got := bot.findUser(7).LastSeen; !got.Equal(now) {
+				t.Errorf("cached last seen = %v, want %v", got, now)
+			}
+			if len(client.params) == 0 || !strings.Contains(client.params[0]["text"], "seen:20\\-05\\-2025 12:30") {
+				t.Errorf("replies = %v, want the last-seen time in the user list", client.params)
+			}
+		})
+	}
+}
+
+// exportSample is the user list the export tests render.
+var exportSample = []*entity.User{
+	{TelegramId: 9, TelegramUsername: "bob", TelegramRole: entity.RolePending},
+	{TelegramId: 7, TelegramUsername: "alice", TelegramRole: entity.RoleAdmin, TelegramEnabled: true,
+		SubscriptionTier: entity.TierCritical, TelegramTopics: []string{"error", "security"}},
+}
+
+// TestExportUsers checks both export formats: users ordered by id, the default tier
+// filled in and an empty topic list kept as "all topics".
+func TestExportUsers(t *testing.T) {
+	cases := []struct {
+		format string
+		want   string
+	}{
+		{"json", `[
+  {
+    "id": 7,
+    "username": "alice",
+    "role": "admin",
+    "tier": "critical",
+    "topics": [
+      "error",
+      "security"
+    ],
+    "enabled": true
+  },
+  {
+    "id": 9,
+    "username": "bob",
+    "role": "pending",
+    "tier": "realtime",
+    "topics": [],
+    "enabled": false
+  }
+]`},
+		{"csv", "id,username,role,tier,topics,enabled\n" +
+			"7,alice,admin,critical,error;security,true\n" +
+			"9,bob,pending,realtime,,false\n"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.format, func(t *testing.T) {
+			got, err := exportUsers(exportSample, tc.format)
+			if err != nil {
+				t.Fatalf("exportUsers: %v", err)
+			}
+			if string(got) != tc.want {
+				t.Errorf("export =\n%s\nwant\n%s", got, tc.want)
+			}
+		})
+	}
+
+	if _, err := exportUsers(exportSample, "xml"); err == nil {
+		t.Error("unknown format was exported")
+	}
+}
+
+// TestExportCmd checks that /export sends the user list as a dated document, and that
+// non-admins and unknown formats get a reply instead.
+func TestExportCmd(t *testing.T) {
+	cases := []struct {
+		name      string
+		caller    int64
+		text      string
+		format    string // expected document format, empty when no document is sent
+		wantReply string
+	}{
+		{"json by default", 7, "/export", "json", ""},
+		{"csv", 7, "/export CSV", "csv", ""},
+		{"unknown format", 7, "/export xml", "", "Usage"},
+		{"not admin", 9, "/export", "", "Admin access required"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := &fakeBotClient{}
+			bot := &TgBot{
+				log:   slog.New(slog.NewTextHandler(io.Discard, nil)),
+				api:   &tgbotapi.Bot{Token: "token", BotClient: client},
+				db:    &usersDB{users: map[int64]*entity.User{7: exportSample[1], 9: exportSample[0]}},
+				clock: clock.NewMock(time.Date(2025, 5, 20, 12, 0, 0, 0, time.UTC)),
+			}
+			bot.loadUsers()
+
+			ctx := ext.NewContext(bot.api, &tgbotapi.Update{Message: &tgbotapi.Message{
+				Text: tc.text,
+				From: &tgbotapi.User{Id: tc.caller},
+				Chat: tgbotapi.Chat{Id: tc.caller, Type: "private"},
+			}}, nil)
+			if err := bot.exportCmd(bot.api, ctx); err != nil {
+				t.Fatalf("exportCmd: %v", err)
+			}
+			if len(client.methods) != 1 {
+				t.Fatalf("bot calls = %v, want one", client.methods)
+			}
+			if tc.format == "" {
+				if !strings.Contains(client.params[0]["text"], tc.wantReply) {
+					t.Errorf("reply = %q, want %q", client.params[0]["text"], tc.wantReply)
+				}
+				return
+			}
+			if client.methods[0] != "sendDocument" {
+				t.Fatalf("bot calls = %v, want sendDocument", client.methods)
+			}
+			if got, want := client.files[0]["document"].Name, "users-20250520."+tc.format; got != want {
+				t.Errorf("file name = %q, want %q", got, want)
+			}
+			want, _ := exportUsers(exportSample, tc.format)
+			if client.content[0] != string(want) {
+				t.Errorf("uploaded %q, want %q", client.content[0], want)
+			}
+		})
+	}
+}
+
+// TestClampInviteCodeLength checks that invite code lengths stay within a UUID string and
+// above the guessable minimum.
+func TestClampInviteCodeLength(t *testing.T) {
+	cases := []struct {
+		n    int
+		want int
+	}{
+		{0, 8},
+		{-5, 6},
+		{3, 6},
+		{6, 6},
+		{12, 12},
+		{36, 36},
+		{37, 36},
+		{100, 36},
+	}
+	for _, tc := range cases {
+		if got := clampInviteCodeLength(tc.n); got != tc.want {
+			t.Errorf("clampInviteCodeLength(%d) = %d, want %d", tc.n, got, tc.want)
+		}
+	}
+}
+
+// inviteDB records the invite codes created through /invite.
+type inviteDB struct {
+	usersDB
+	codes []string
+}
+
+func (d *inviteDB) CreateInviteCode(code *entity.InviteCode) error {
+	d.codes = append(d.codes, code.Code)
+	return nil
+}
+
+// TestInviteCodeLengthOutOfRange checks that /invite with a configured length outside
+// the allowed range creates a clamped code instead of panicking.
+func TestInviteCodeLengthOutOfRange(t *testing.T) {
+	cases := []struct {
+		length int
+		want   int
+	}{
+		{100, 36},
+		{2, 6},
+		{0, 8},
+	}
+	for _, tc := range cases {
+		db := &inviteDB{usersDB: usersDB{users: map[int64]*entity.User{
+			7: {TelegramId: 7, TelegramRole: entity.RoleAdmin, TelegramEnabled: true},
+		}}}
+		bot := &TgBot{
+			log:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+			api:    &tgbotapi.Bot{Token: "token", BotClient: &fakeBotClient{}},
+			db:     db,
+			config: BotConfig{InviteCodeLength: tc.length},
+		}
+		bot.loadUsers()
+
+		ctx := ext.NewContext(bot.api, &tgbotapi.Update{Message: &tgbotapi.Message{
+			Text: "/invite",
+			From: &tgbotapi.User{Id: 7},
+			Chat: tgbotapi.Chat{Id: 7, Type: "private"},
+		}}, nil)
+		if err := bot.invite(bot.api, ctx); err != nil {
+			t.Fatalf("invite: %v", err)
+		}
+		if len(db.codes) != 1 || len(db.codes[0]) != tc.want {
+			t.Errorf("length %d: codes = %q, want one of %d characters", tc.length, db.codes, tc.want)
+		}
+	}
+}
+
+// TestLastAdminProtection checks that the only admin cannot be revoked or demoted, by
+// command or by the inline button, while an admin with a fellow admin can be.
+func TestLastAdminProtection(t *testing.T) {
+	cases := []struct {
+		name     string
+		admins   []int64
+		text     string // command text, empty for the revoke button
+		target   int64
+		wantRole entity.TelegramRole
+	}{
+		{"revoke only admin", []int64{7}, "/revoke 7", 7, entity.RoleAdmin},
+		{"demote only admin", []int64{7}, "/approve 7", 7, entity.RoleAdmin},
+		{"revoke button on only admin", []int64{7}, "", 7, entity.RoleAdmin},
+		{"revoke one of two admins", []int64{7, 8}, "/revoke 8", 8, entity.RoleNone},
+		{"revoke button on one of two admins", []int64{7, 8}, "", 8, entity.RoleNone},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			db := &usersDB{users: map[int64]*entity.User{}, topics: map[int64][]string{}}
+			for _, id := range tc.admins {
+				db.users[id] = &entity.User{TelegramId: id, TelegramRole: entity.RoleAdmin, TelegramEnabled: true}
+			}
+			client := &fakeBotClient{}
+			bot := &TgBot{
+				log: slog.New(slog.NewTextHandler(io.Discard, nil)),
+				api: &tgbotapi.Bot{Token: "token", BotClient: client},
+				db:  db,
+			}
+			bot.loadUsers()
+
+			var err error
+			if tc.text == "" {
+				err = bot.onRevokeCallback(bot.api, ext.NewContext(bot.api, &tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{
+					Id:   "cq",
+					From: tgbotapi.User{Id: 7},
+					Data: fmt.Sprintf("%s%d", cbRevoke, tc.target),
+				}}, nil))
+			} else {
+				ctx := ext.NewContext(bot.api, &tgbotapi.Update{Message: &tgbotapi.Message{
+					Text: tc.text,
+					From: &tgbotapi.User{Id: 7},
+					Chat: tgbotapi.Chat{Id: 7, Type: "private"},
+				}}, nil)
+				if strings.HasPrefix(tc.text, "/revoke") {
+					if err = bot.revoke(bot.api, ctx); err == nil {
+						err = pressConfirm(t, bot, 7, 0)
+					}
+				} else {
+					err = bot.approve(bot.api, ctx)
+				}
+			}
+			if err != nil {
+				t.Fatalf("handler: %v", err)
+			}
+
+			if got := db.users[tc.target].TelegramRole; got != tc.wantRole {
+				t.Errorf("role = %q, want %q", got, tc.wantRole)
+			}
+			if tc.wantRole != entity.RoleAdmin {
+				return
+			}
+			var refused bool
+			for _, p := range client.params {
+				refused = refused || strings.Contains(p["text"], "Cannot remove the last admin")
+			}
+			if !refused {
+				t.Errorf("replies = %v, want the last admin refusal", client.params)
+			}
+		})
+	}
+}
+
+// TestLastAdminStaleCache checks that the last-admin check reads the database: a fellow
+// admin demoted since the cache was loaded no longer counts.
+func TestLastAdminStaleCache(t *testing.T) {
+	db := &usersDB{users: map[int64]*entity.User{}, topics: map[int64][]string{}}
+	for _, id := range []int64{7, 8} {
+		db.users[id] = &entity.User{TelegramId: id, TelegramRole: entity.RoleAdmin, TelegramEnabled: true}
+	}
+	bot := &TgBot{log: slog.New(slog.NewTextHandler(io.Discard, nil)), db: db}
+	bot.loadUsers()
+	db.users[8].TelegramRole = entity.RoleUser
+
+	if err := bot.setRole(8, 7, entity.RoleNone); !errors.Is(err, errLastAdmin) {
+		t.Errorf("setRole error = %v, want errLastAdmin", err)
+	}
+	if got := db.users[7].TelegramRole; got != entity.RoleAdmin {
+		t.Errorf("role = %q, want admin", got)
+	}
+}
+
+// pressConfirm presses a button of the last keyboard the bot sent, as user from:
+// 0 is Confirm, 1 is Cancel.
+func pressConfirm(t *testing.T, bot *TgBot, from int64, button int) error {
+	t.Helper()
+	client := bot.api.BotClient.(*fakeBotClient)
+	var data []string
+	for i := len(client.params) - 1; i >= 0 && data == nil; i-- {
+		if client.params[i]["reply_markup"] != "" {
+			data = callbackData(t, client.params[i])
+		}
+	}
+	if len(data) <= button {
+		t.Fatalf("no confirm keyboard sent: %v", client.params)
+	}
+	return bot.onConfirmCallback(bot.api, ext.NewContext(bot.api, &tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{
+		Id:      "cq",
+		From:    tgbotapi.User{Id: from},
+		Data:    data[button],
+		Message: tgbotapi.Message{MessageId: 5, Chat: tgbotapi.Chat{Id: from, Type: "private"}},
+	}}, nil))
+}
+
+// TestConfirmAdminActions checks that /revoke and /admin only ask for confirmation, that
+// the confirm button applies the role change and the cancel button leaves it alone, and
+// that only admins can press them.
+func TestConfirmAdminActions(t *testing.T) {
+	cases := []struct {
+		name      string
+		text      string
+		button    int   // 0 confirm, 1 cancel
+		presser   int64 // user pressing the button
+		wantRole  entity.TelegramRole
+		wantReply string // text the question is replaced with, or the answer when refused
+	}{
+		{"revoke confirmed", "/revoke 9", 0, 7, entity.RoleNone, "User 9 revoked"},
+		{"revoke cancelled", "/revoke 9", 1, 7, entity.RoleUser, "Cancelled"},
+		{"promote confirmed", "/admin 9", 0, 7, entity.RoleAdmin, "User 9 promoted to admin"},
+		{"promote cancelled", "/admin 9", 1, 7, entity.RoleUser, "Cancelled"},
+		{"pressed by a user", "/revoke 9", 0, 9, entity.RoleUser, "Admin access required"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			db := &usersDB{
+				users: map[int64]*entity.User{
+					7: {TelegramId: 7, TelegramRole: entity.RoleAdmin, TelegramEnabled: true},
+					9: {TelegramId: 9, TelegramRole: entity.RoleUser, TelegramEnabled: true},
+				},
+				topics: map[int64][]string{},
+			}
+			client := &fakeBotClient{}
+			bot := &TgBot{
+				log: slog.New(slog.NewTextHandler(io.Discard, nil)),
+				api: &tgbotapi.Bot{Token: "token", BotClient: client},
+				db:  db,
+			}
+			bot.loadUsers()
+
+			ctx := ext.NewContext(bot.api, &tgbotapi.Update{Message: &tgbotapi.Message{
+				Text: tc.text,
+				From: &tgbotapi.User{Id: 7},
+				Chat: tgbotapi.Chat{Id: 7, Type: "private"},
+			}}, nil)
+			handler := bot.revoke
+			if strings.HasPrefix(tc.text, "/admin") {
+				handler = bot.adminCmd
+			}
+			if err := handler(bot.api, ctx); err != nil {
+				t.Fatalf("command: %v", err)
+			}
+			if got := db.users[9].TelegramRole; got != entity.RoleUser {
+				t.Fatalf("role changed to %q before confirmation", got)
+			}
+
+			if err := pressConfirm(t, bot, tc.presser, tc.button); err != nil {
+				t.Fatalf("onConfirmCallback: %v", err)
+			}
+			if got := db.users[9].TelegramRole; got != tc.wantRole {
+				t.Errorf("role = %q, want %q", got, tc.wantRole)
+			}
+			var replied bool
+			for _, p := range client.params {
+				replied = replied || strings.Contains(p["text"], tc.wantReply)
+			}
+			if !replied {
+				t.Errorf("bot calls = %v, want %q", client.params, tc.wantReply)
+			}
+		})
+	}
+}
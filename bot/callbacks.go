@@ -1,11 +1,13 @@
 package bot
 
 import (
+	"errors"
 	"fmt"
 	"log/slog"
 	"strconv"
 	"strings"
 	"wfsync/entity"
+	"wfsync/lib/sl"
 
 	tgbotapi "github.com/PaulSonOfLars/gotgbot/v2"
 	"github.com/PaulSonOfLars/gotgbot/v2/ext"
@@ -20,13 +22,30 @@ const (
 	cbLevel       = "lv:" // lv:debug, lv:info, lv:warn, lv:error
 	cbApprove     = "a:"  // a:<telegram_id>
 	cbRevoke      = "r:"  // r:<telegram_id>
+	cbOpen        = "o:"  // o:topics, o:tier, o:level
+	cbAck         = "ak:" // ak:<alert_id>
+	cbConfirm     = "cf:" // cf:revoke:<telegram_id>, cf:admin:<telegram_id>, cf:cancel
+)
+
+// Admin actions confirmed through the confirm/cancel keyboard.
+const (
+	confirmRevoke = "revoke"
+	confirmAdmin  = "admin"
+	confirmCancel = "cancel"
+)
+
+// Settings keyboards opened from the /status buttons.
+const (
+	openTopics = "topics"
+	openTier   = "tier"
+	openLevel  = "level"
 )
 
 // --- Keyboard builders ---
 
 // buildTopicsKeyboard creates an inline keyboard with toggle buttons for each topic.
 // Admins see all topics; regular users see only user topics.
-func buildTopicsKeyboard(user *entity.User) tgbotapi.InlineKeyboardMarkup {
+func buildTopicsKeyboard(user *entity.User, lang string) tgbotapi.InlineKeyboardMarkup {
 	allTopics := entity.TopicsForRole(user.TelegramRole)
 	rows := make([][]tgbotapi.InlineKeyboardButton, 0, len(allTopics)/2+2)
 
@@ -49,15 +68,15 @@ func buildTopicsKeyboard(user *entity.User) tgbotapi.InlineKeyboardMarkup {
 
 	// Subscribe all / Unsubscribe all
 	rows = append(rows, []tgbotapi.InlineKeyboardButton{
-		{Text: "Subscribe all", CallbackData: cbTopicToggle + "all"},
-		{Text: "Unsubscribe all", CallbackData: cbTopicToggle + "none"},
+		{Text: tr(lang, btnSubscribeAll), CallbackData: cbTopicToggle + "all"},
+		{Text: tr(lang, btnUnsubscribeAll), CallbackData: cbTopicToggle + "none"},
 	})
 
 	return tgbotapi.InlineKeyboardMarkup{InlineKeyboard: rows}
 }
 
 // buildTierKeyboard creates an inline keyboard for tier selection.
-func buildTierKeyboard(current entity.SubscriptionTier) tgbotapi.InlineKeyboardMarkup {
+func buildTierKeyboard(current entity.SubscriptionTier, lang string) tgbotapi.InlineKeyboardMarkup {
 	if current == "" {
 		current = entity.TierRealtime
 	}
@@ -65,9 +84,9 @@ func buildTierKeyboard(current entity.SubscriptionTier) tgbotapi.InlineKeyboardM
 		tier  entity.SubscriptionTier
 		label string
 	}{
-		{entity.TierRealtime, "Realtime"},
-		{entity.TierCritical, "Critical only"},
-		{entity.TierDigest, "Digest"},
+		{entity.TierRealtime, tr(lang, btnRealtime)},
+		{entity.TierCritical, tr(lang, btnCritical)},
+		{entity.TierDigest, tr(lang, btnDigest)},
 	}
 
 	var buttons []tgbotapi.InlineKeyboardButton
@@ -116,19 +135,63 @@ func buildLevelKeyboard(currentLevel int) tgbotapi.InlineKeyboardMarkup {
 	}
 }
 
+// buildStatusKeyboard creates the buttons under the /status message that open the
+// settings keyboards. The level button is shown to admins only, matching /level.
+func buildStatusKeyboard(user *entity.User, lang string) tgbotapi.InlineKeyboardMarkup {
+	buttons := []tgbotapi.InlineKeyboardButton{
+		{Text: tr(lang, btnTopics), CallbackData: cbOpen + openTopics},
+		{Text: tr(lang, btnTier), CallbackData: cbOpen + openTier},
+	}
+	if user.IsAdmin() {
+		buttons = append(buttons, tgbotapi.InlineKeyboardButton{Text: tr(lang, btnLevel), CallbackData: cbOpen + openLevel})
+	}
+	return tgbotapi.InlineKeyboardMarkup{
+		InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{buttons},
+	}
+}
+
 // buildPendingUserButtons creates approve/revoke buttons for a pending user.
-func buildPendingUserButtons(telegramId int64) tgbotapi.InlineKeyboardMarkup {
+func buildPendingUserButtons(telegramId int64, lang string) tgbotapi.InlineKeyboardMarkup {
 	idStr := strconv.FormatInt(telegramId, 10)
 	return tgbotapi.InlineKeyboardMarkup{
 		InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{
 			{
-				{Text: "Approve ✓", CallbackData: cbApprove + idStr},
-				{Text: "Revoke ✗", CallbackData: cbRevoke + idStr},
+				{Text: tr(lang, btnApprove), CallbackData: cbApprove + idStr},
+				{Text: tr(lang, btnRevoke), CallbackData: cbRevoke + idStr},
 			},
 		},
 	}
 }
 
+// buildConfirmKeyboard creates the confirm/cancel buttons of an admin action on a user.
+func buildConfirmKeyboard(action string, telegramId int64, lang string) tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.InlineKeyboardMarkup{
+		InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{
+			{
+				{Text: tr(lang, btnConfirm), CallbackData: fmt.Sprintf("%s%s:%d", cbConfirm, action, telegramId)},
+				{Text: tr(lang, btnCancel), CallbackData: cbConfirm + confirmCancel},
+			},
+		},
+	}
+}
+
+// sendSettingsKeyboard sends one of the settings keyboards to the user, with the same
+// prompt as the matching command. Returns false for an unknown keyboard name.
+func (t *TgBot) sendSettingsKeyboard(chatId int64, user *entity.User, name string) bool {
+	lang := t.lang(chatId)
+	switch name {
+	case openTopics:
+		t.sendWithKeyboard(chatId, tr(lang, msgTopicsPrompt), buildTopicsKeyboard(user, lang))
+	case openTier:
+		t.sendWithKeyboard(chatId, tr(lang, msgTierPrompt), buildTierKeyboard(user.SubscriptionTier, lang))
+	case openLevel:
+		t.sendWithKeyboard(chatId, tr(lang, msgLevelPrompt), buildLevelKeyboard(user.LogLevel))
+	default:
+		return false
+	}
+	return true
+}
+
 // --- Callback handlers ---
 // All callback handlers follow the same pattern:
 //  1. Verify authorization (approved/admin)
@@ -143,15 +206,16 @@ func buildPendingUserButtons(telegramId int64) tgbotapi.InlineKeyboardMarkup {
 func (t *TgBot) onTopicCallback(_ *tgbotapi.Bot, ctx *ext.Context) error {
 	cq := ctx.CallbackQuery
 	chatId := cq.From.Id
+	lang := t.lang(chatId)
 
 	if !t.requireApproved(chatId) {
-		_, _ = cq.Answer(t.api, &tgbotapi.AnswerCallbackQueryOpts{Text: "Not authorized", ShowAlert: true})
+		_, _ = cq.Answer(t.api, &tgbotapi.AnswerCallbackQueryOpts{Text: tr(lang, ansNotAuthorized), ShowAlert: true})
 		return nil
 	}
 
 	user := t.findUser(chatId)
 	if user == nil {
-		_, _ = cq.Answer(t.api, &tgbotapi.AnswerCallbackQueryOpts{Text: "User not found", ShowAlert: true})
+		_, _ = cq.Answer(t.api, &tgbotapi.AnswerCallbackQueryOpts{Text: tr(lang, ansUserNotFound), ShowAlert: true})
 		return nil
 	}
 
@@ -163,23 +227,23 @@ func (t *TgBot) onTopicCallback(_ *tgbotapi.Bot, ctx *ext.Context) error {
 		err := t.db.SetTelegramTopics(chatId, nil)
 		if err != nil {
 			t.reportError(chatId, "topic:all", err)
-			_, _ = cq.Answer(t.api, &tgbotapi.AnswerCallbackQueryOpts{Text: "Error occurred"})
+			_, _ = cq.Answer(t.api, &tgbotapi.AnswerCallbackQueryOpts{Text: tr(lang, ansError)})
 			return nil
 		}
-		answerText = "Subscribed to all topics"
+		answerText = tr(lang, ansSubscribedAll)
 
 	case "none":
 		err := t.db.SetTelegramTopics(chatId, []string{"none"})
 		if err != nil {
 			t.reportError(chatId, "topic:none", err)
-			_, _ = cq.Answer(t.api, &tgbotapi.AnswerCallbackQueryOpts{Text: "Error occurred"})
+			_, _ = cq.Answer(t.api, &tgbotapi.AnswerCallbackQueryOpts{Text: tr(lang, ansError)})
 			return nil
 		}
-		answerText = "Unsubscribed from all topics"
+		answerText = tr(lang, ansUnsubscribedAll)
 
 	default:
 		if !entity.IsTopicAllowedForRole(topic, user.TelegramRole) {
-			_, _ = cq.Answer(t.api, &tgbotapi.AnswerCallbackQueryOpts{Text: "Invalid topic"})
+			_, _ = cq.Answer(t.api, &tgbotapi.AnswerCallbackQueryOpts{Text: tr(lang, ansInvalidTopic)})
 			return nil
 		}
 
@@ -202,10 +266,10 @@ func (t *TgBot) onTopicCallback(_ *tgbotapi.Bot, ctx *ext.Context) error {
 			err := t.db.SetTelegramTopics(chatId, filtered)
 			if err != nil {
 				t.reportError(chatId, "topic:unsub", err)
-				_, _ = cq.Answer(t.api, &tgbotapi.AnswerCallbackQueryOpts{Text: "Error occurred"})
+				_, _ = cq.Answer(t.api, &tgbotapi.AnswerCallbackQueryOpts{Text: tr(lang, ansError)})
 				return nil
 			}
-			answerText = "Unsubscribed from " + topic
+			answerText = tr(lang, ansUnsubscribed, topic)
 		} else {
 			// Subscribe
 			currentTopics := user.TelegramTopics
@@ -219,10 +283,10 @@ func (t *TgBot) onTopicCallback(_ *tgbotapi.Bot, ctx *ext.Context) error {
 			err := t.db.SetTelegramTopics(chatId, filtered)
 			if err != nil {
 				t.reportError(chatId, "topic:sub", err)
-				_, _ = cq.Answer(t.api, &tgbotapi.AnswerCallbackQueryOpts{Text: "Error occurred"})
+				_, _ = cq.Answer(t.api, &tgbotapi.AnswerCallbackQueryOpts{Text: tr(lang, ansError)})
 				return nil
 			}
-			answerText = "Subscribed to " + topic
+			answerText = tr(lang, ansSubscribed, topic)
 		}
 	}
 
@@ -231,7 +295,7 @@ func (t *TgBot) onTopicCallback(_ *tgbotapi.Bot, ctx *ext.Context) error {
 	// Refresh the user to rebuild keyboard with updated state
 	updatedUser := t.findUser(chatId)
 	if updatedUser != nil {
-		keyboard := buildTopicsKeyboard(updatedUser)
+		keyboard := buildTopicsKeyboard(updatedUser, lang)
 		if msg := cq.Message; msg != nil {
 			if im, ok := msg.(tgbotapi.Message); ok {
 				_, _, _ = t.api.EditMessageReplyMarkup(&tgbotapi.EditMessageReplyMarkupOpts{
@@ -251,9 +315,10 @@ func (t *TgBot) onTopicCallback(_ *tgbotapi.Bot, ctx *ext.Context) error {
 func (t *TgBot) onTierCallback(_ *tgbotapi.Bot, ctx *ext.Context) error {
 	cq := ctx.CallbackQuery
 	chatId := cq.From.Id
+	lang := t.lang(chatId)
 
 	if !t.requireApproved(chatId) {
-		_, _ = cq.Answer(t.api, &tgbotapi.AnswerCallbackQueryOpts{Text: "Not authorized", ShowAlert: true})
+		_, _ = cq.Answer(t.api, &tgbotapi.AnswerCallbackQueryOpts{Text: tr(lang, ansNotAuthorized), ShowAlert: true})
 		return nil
 	}
 
@@ -267,21 +332,26 @@ func (t *TgBot) onTierCallback(_ *tgbotapi.Bot, ctx *ext.Context) error {
 	case "digest":
 		newTier = entity.TierDigest
 	default:
-		_, _ = cq.Answer(t.api, &tgbotapi.AnswerCallbackQueryOpts{Text: "Invalid tier"})
+		_, _ = cq.Answer(t.api, &tgbotapi.AnswerCallbackQueryOpts{Text: tr(lang, ansInvalidTier)})
 		return nil
 	}
 
 	err := t.db.SetSubscriptionTier(chatId, newTier, "")
 	if err != nil {
 		t.reportError(chatId, "tier:set", err)
-		_, _ = cq.Answer(t.api, &tgbotapi.AnswerCallbackQueryOpts{Text: "Error occurred"})
+		_, _ = cq.Answer(t.api, &tgbotapi.AnswerCallbackQueryOpts{Text: tr(lang, ansError)})
 		return nil
 	}
 
 	t.loadUsers()
 
+	// Entries buffered while on the digest tier would otherwise wait for the next flush
+	if newTier != entity.TierDigest && t.digest != nil {
+		t.digest.FlushUser(chatId)
+	}
+
 	// Update keyboard to reflect new selection
-	keyboard := buildTierKeyboard(newTier)
+	keyboard := buildTierKeyboard(newTier, lang)
 	if msg := cq.Message; msg != nil {
 		if im, ok := msg.(tgbotapi.Message); ok {
 			_, _, _ = t.api.EditMessageReplyMarkup(&tgbotapi.EditMessageReplyMarkupOpts{
@@ -293,7 +363,7 @@ func (t *TgBot) onTierCallback(_ *tgbotapi.Bot, ctx *ext.Context) error {
 	}
 
 	_, _ = cq.Answer(t.api, &tgbotapi.AnswerCallbackQueryOpts{
-		Text: "Tier set to " + tierStr,
+		Text: tr(lang, ansTierSet, tierStr),
 	})
 	return nil
 }
@@ -302,9 +372,10 @@ func (t *TgBot) onTierCallback(_ *tgbotapi.Bot, ctx *ext.Context) error {
 func (t *TgBot) onLevelCallback(_ *tgbotapi.Bot, ctx *ext.Context) error {
 	cq := ctx.CallbackQuery
 	chatId := cq.From.Id
+	lang := t.lang(chatId)
 
 	if !t.requireApproved(chatId) {
-		_, _ = cq.Answer(t.api, &tgbotapi.AnswerCallbackQueryOpts{Text: "Not authorized", ShowAlert: true})
+		_, _ = cq.Answer(t.api, &tgbotapi.AnswerCallbackQueryOpts{Text: tr(lang, ansNotAuthorized), ShowAlert: true})
 		return nil
 	}
 
@@ -320,14 +391,14 @@ func (t *TgBot) onLevelCallback(_ *tgbotapi.Bot, ctx *ext.Context) error {
 	case "error":
 		level = slog.LevelError
 	default:
-		_, _ = cq.Answer(t.api, &tgbotapi.AnswerCallbackQueryOpts{Text: "Invalid level"})
+		_, _ = cq.Answer(t.api, &tgbotapi.AnswerCallbackQueryOpts{Text: tr(lang, ansInvalidLevel)})
 		return nil
 	}
 
 	err := t.db.SetTelegramEnabled(chatId, true, int(level))
 	if err != nil {
 		t.reportError(chatId, "level:set", err)
-		_, _ = cq.Answer(t.api, &tgbotapi.AnswerCallbackQueryOpts{Text: "Error occurred"})
+		_, _ = cq.Answer(t.api, &tgbotapi.AnswerCallbackQueryOpts{Text: tr(lang, ansError)})
 		return nil
 	}
 
@@ -346,7 +417,7 @@ func (t *TgBot) onLevelCallback(_ *tgbotapi.Bot, ctx *ext.Context) error {
 	}
 
 	_, _ = cq.Answer(t.api, &tgbotapi.AnswerCallbackQueryOpts{
-		Text: "Level set to " + levelStr,
+		Text: tr(lang, ansLevelSet, levelStr),
 	})
 	return nil
 }
@@ -356,33 +427,38 @@ func (t *TgBot) onLevelCallback(_ *tgbotapi.Bot, ctx *ext.Context) error {
 func (t *TgBot) onApproveCallback(_ *tgbotapi.Bot, ctx *ext.Context) error {
 	cq := ctx.CallbackQuery
 	chatId := cq.From.Id
+	lang := t.lang(chatId)
 
 	if !t.requireAdmin(chatId) {
-		_, _ = cq.Answer(t.api, &tgbotapi.AnswerCallbackQueryOpts{Text: "Admin access required", ShowAlert: true})
+		_, _ = cq.Answer(t.api, &tgbotapi.AnswerCallbackQueryOpts{Text: tr(lang, ansAdminRequired), ShowAlert: true})
 		return nil
 	}
 
 	idStr := strings.TrimPrefix(cq.Data, cbApprove)
 	targetId, err := strconv.ParseInt(idStr, 10, 64)
 	if err != nil {
-		_, _ = cq.Answer(t.api, &tgbotapi.AnswerCallbackQueryOpts{Text: "Invalid user ID"})
+		_, _ = cq.Answer(t.api, &tgbotapi.AnswerCallbackQueryOpts{Text: tr(lang, ansInvalidUserId)})
 		return nil
 	}
 
 	target := t.findUser(targetId)
 	if target == nil {
-		_, _ = cq.Answer(t.api, &tgbotapi.AnswerCallbackQueryOpts{Text: "User not found"})
+		_, _ = cq.Answer(t.api, &tgbotapi.AnswerCallbackQueryOpts{Text: tr(lang, ansUserNotFound)})
 		return nil
 	}
 
-	err = t.db.SetTelegramRole(target.TelegramId, entity.RoleUser)
+	err = t.setRole(chatId, target.TelegramId, entity.RoleUser)
+	if errors.Is(err, errLastAdmin) {
+		_, _ = cq.Answer(t.api, &tgbotapi.AnswerCallbackQueryOpts{Text: tr(lang, ansLastAdmin), ShowAlert: true})
+		return nil
+	}
 	if err != nil {
 		t.reportError(chatId, "approve:callback", err)
-		_, _ = cq.Answer(t.api, &tgbotapi.AnswerCallbackQueryOpts{Text: "Error occurred"})
+		_, _ = cq.Answer(t.api, &tgbotapi.AnswerCallbackQueryOpts{Text: tr(lang, ansError)})
 		return nil
 	}
 
-	_ = t.db.SetTelegramTopics(target.TelegramId, []string{entity.TopicInvoice})
+	t.setDefaultTopics(target.TelegramId, entity.RoleUser)
 
 	t.loadUsers()
 	t.setUserCommands(target.TelegramId, entity.RoleUser)
@@ -391,7 +467,7 @@ func (t *TgBot) onApproveCallback(_ *tgbotapi.Bot, ctx *ext.Context) error {
 	if msg := cq.Message; msg != nil {
 		if im, ok := msg.(tgbotapi.Message); ok {
 			_, _, _ = t.api.EditMessageText(
-				fmt.Sprintf("%s\n\n✓ Approved by %s", im.Text, Sanitize(userDisplayName(t.findUser(chatId)))),
+				tr(lang, msgApprovedBy, im.Text, Sanitize(userDisplayName(t.findUser(chatId)))),
 				&tgbotapi.EditMessageTextOpts{
 					ChatId:    chatId,
 					MessageId: im.MessageId,
@@ -400,10 +476,10 @@ func (t *TgBot) onApproveCallback(_ *tgbotapi.Bot, ctx *ext.Context) error {
 		}
 	}
 
-	t.plainResponse(target.TelegramId, "Your registration has been approved\\! Notifications are now enabled\\.")
+	t.plainResponse(target.TelegramId, tr(t.lang(target.TelegramId), msgAccessApproved))
 
 	_, _ = cq.Answer(t.api, &tgbotapi.AnswerCallbackQueryOpts{
-		Text: "User approved",
+		Text: tr(lang, ansUserApproved),
 	})
 	return nil
 }
@@ -413,29 +489,34 @@ func (t *TgBot) onApproveCallback(_ *tgbotapi.Bot, ctx *ext.Context) error {
 func (t *TgBot) onRevokeCallback(_ *tgbotapi.Bot, ctx *ext.Context) error {
 	cq := ctx.CallbackQuery
 	chatId := cq.From.Id
+	lang := t.lang(chatId)
 
 	if !t.requireAdmin(chatId) {
-		_, _ = cq.Answer(t.api, &tgbotapi.AnswerCallbackQueryOpts{Text: "Admin access required", ShowAlert: true})
+		_, _ = cq.Answer(t.api, &tgbotapi.AnswerCallbackQueryOpts{Text: tr(lang, ansAdminRequired), ShowAlert: true})
 		return nil
 	}
 
 	idStr := strings.TrimPrefix(cq.Data, cbRevoke)
 	targetId, err := strconv.ParseInt(idStr, 10, 64)
 	if err != nil {
-		_, _ = cq.Answer(t.api, &tgbotapi.AnswerCallbackQueryOpts{Text: "Invalid user ID"})
+		_, _ = cq.Answer(t.api, &tgbotapi.AnswerCallbackQueryOpts{Text: tr(lang, ansInvalidUserId)})
 		return nil
 	}
 
 	target := t.findUser(targetId)
 	if target == nil {
-		_, _ = cq.Answer(t.api, &tgbotapi.AnswerCallbackQueryOpts{Text: "User not found"})
+		_, _ = cq.Answer(t.api, &tgbotapi.AnswerCallbackQueryOpts{Text: tr(lang, ansUserNotFound)})
 		return nil
 	}
 
-	err = t.db.SetTelegramRole(target.TelegramId, entity.RoleNone)
+	err = t.setRole(chatId, target.TelegramId, entity.RoleNone)
+	if errors.Is(err, errLastAdmin) {
+		_, _ = cq.Answer(t.api, &tgbotapi.AnswerCallbackQueryOpts{Text: tr(lang, ansLastAdmin), ShowAlert: true})
+		return nil
+	}
 	if err != nil {
 		t.reportError(chatId, "revoke:callback", err)
-		_, _ = cq.Answer(t.api, &tgbotapi.AnswerCallbackQueryOpts{Text: "Error occurred"})
+		_, _ = cq.Answer(t.api, &tgbotapi.AnswerCallbackQueryOpts{Text: tr(lang, ansError)})
 		return nil
 	}
 
@@ -446,7 +527,7 @@ func (t *TgBot) onRevokeCallback(_ *tgbotapi.Bot, ctx *ext.Context) error {
 	if msg := cq.Message; msg != nil {
 		if im, ok := msg.(tgbotapi.Message); ok {
 			_, _, _ = t.api.EditMessageText(
-				fmt.Sprintf("%s\n\n✗ Revoked by %s", im.Text, Sanitize(userDisplayName(t.findUser(chatId)))),
+				tr(lang, msgRevokedBy, im.Text, Sanitize(userDisplayName(t.findUser(chatId)))),
 				&tgbotapi.EditMessageTextOpts{
 					ChatId:    chatId,
 					MessageId: im.MessageId,
@@ -455,10 +536,147 @@ func (t *TgBot) onRevokeCallback(_ *tgbotapi.Bot, ctx *ext.Context) error {
 		}
 	}
 
-	t.plainResponse(target.TelegramId, "Your access has been revoked\\.")
+	t.plainResponse(target.TelegramId, tr(t.lang(target.TelegramId), msgAccessRevoked))
 
 	_, _ = cq.Answer(t.api, &tgbotapi.AnswerCallbackQueryOpts{
-		Text: "User revoked",
+		Text: tr(lang, ansUserRevoked),
+	})
+	return nil
+}
+
+// onConfirmCallback applies or cancels an admin action confirmed with the keyboard sent
+// by /revoke or /admin, replacing the question with the outcome.
+func (t *TgBot) onConfirmCallback(_ *tgbotapi.Bot, ctx *ext.Context) error {
+	cq := ctx.CallbackQuery
+	chatId := cq.From.Id
+	lang := t.lang(chatId)
+
+	if !t.requireAdmin(chatId) {
+		_, _ = cq.Answer(t.api, &tgbotapi.AnswerCallbackQueryOpts{Text: tr(lang, ansAdminRequired), ShowAlert: true})
+		return nil
+	}
+
+	data := strings.TrimPrefix(cq.Data, cbConfirm)
+	if data == confirmCancel {
+		t.replaceCallbackMessage(cq, tr(lang, msgCancelled))
+		_, _ = cq.Answer(t.api, &tgbotapi.AnswerCallbackQueryOpts{Text: tr(lang, ansCancelled)})
+		return nil
+	}
+
+	action, idStr, _ := strings.Cut(data, ":")
+	targetId, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		_, _ = cq.Answer(t.api, &tgbotapi.AnswerCallbackQueryOpts{Text: tr(lang, ansInvalidUserId)})
+		return nil
+	}
+	target := t.findUser(targetId)
+	if target == nil {
+		_, _ = cq.Answer(t.api, &tgbotapi.AnswerCallbackQueryOpts{Text: tr(lang, ansUserNotFound)})
+		return nil
+	}
+
+	var result string
+	switch action {
+	case confirmRevoke:
+		err = t.revokeUser(chatId, target)
+		result = tr(lang, msgUserRevoked, Sanitize(userDisplayName(target)))
+	case confirmAdmin:
+		if !target.IsApproved() {
+			_, _ = cq.Answer(t.api, &tgbotapi.AnswerCallbackQueryOpts{Text: tr(lang, ansApprovalRequired), ShowAlert: true})
+			return nil
+		}
+		err = t.promoteUser(chatId, target)
+		result = tr(lang, msgUserPromoted, Sanitize(userDisplayName(target)))
+	default:
+		_, _ = cq.Answer(t.api, &tgbotapi.AnswerCallbackQueryOpts{Text: tr(lang, ansInvalidOption)})
+		return nil
+	}
+	if errors.Is(err, errLastAdmin) {
+		t.replaceCallbackMessage(cq, tr(lang, msgLastAdmin))
+		_, _ = cq.Answer(t.api, &tgbotapi.AnswerCallbackQueryOpts{Text: tr(lang, ansLastAdmin), ShowAlert: true})
+		return nil
+	}
+	if err != nil {
+		t.reportError(chatId, "confirm:"+action, err)
+		_, _ = cq.Answer(t.api, &tgbotapi.AnswerCallbackQueryOpts{Text: tr(lang, ansError)})
+		return nil
+	}
+
+	t.replaceCallbackMessage(cq, result)
+	_, _ = cq.Answer(t.api, &tgbotapi.AnswerCallbackQueryOpts{Text: tr(lang, ansDone)})
+	return nil
+}
+
+// replaceCallbackMessage replaces the message carrying the pressed button, and its
+// keyboard, with a MarkdownV2 text.
+func (t *TgBot) replaceCallbackMessage(cq *tgbotapi.CallbackQuery, text string) {
+	msg := cq.Message
+	if msg == nil {
+		return
+	}
+	_, _, err := t.api.EditMessageText(text, &tgbotapi.EditMessageTextOpts{
+		ChatId:    msg.GetChat().Id,
+		MessageId: msg.GetMessageId(),
+		ParseMode: "MarkdownV2",
 	})
+	if err != nil {
+		t.log.With(slog.Int64("id", cq.From.Id)).Warn("editing callback message", sl.Err(err))
+	}
+}
+
+// onOpenCallback handles the /status buttons by sending the requested settings keyboard
+// as a new message, leaving the status message and its buttons in place.
+func (t *TgBot) onOpenCallback(_ *tgbotapi.Bot, ctx *ext.Context) error {
+	cq := ctx.CallbackQuery
+	chatId := cq.From.Id
+	lang := t.lang(chatId)
+
+	if !t.requireApproved(chatId) {
+		_, _ = cq.Answer(t.api, &tgbotapi.AnswerCallbackQueryOpts{Text: tr(lang, ansNotAuthorized), ShowAlert: true})
+		return nil
+	}
+
+	name := strings.TrimPrefix(cq.Data, cbOpen)
+	if name == openLevel && !t.requireAdmin(chatId) {
+		_, _ = cq.Answer(t.api, &tgbotapi.AnswerCallbackQueryOpts{Text: tr(lang, ansAdminRequired), ShowAlert: true})
+		return nil
+	}
+
+	user := t.findUser(chatId)
+	if user == nil {
+		_, _ = cq.Answer(t.api, &tgbotapi.AnswerCallbackQueryOpts{Text: tr(lang, ansUserNotFound), ShowAlert: true})
+		return nil
+	}
+
+	if !t.sendSettingsKeyboard(chatId, user, name) {
+		_, _ = cq.Answer(t.api, &tgbotapi.AnswerCallbackQueryOpts{Text: tr(lang, ansInvalidOption)})
+		return nil
+	}
+	_, _ = cq.Answer(t.api, nil)
+	return nil
+}
+
+// onAckCallback handles the "Ack" button under a critical-tier alert, stopping its
+// escalation and removing the button.
+func (t *TgBot) onAckCallback(_ *tgbotapi.Bot, ctx *ext.Context) error {
+	cq := ctx.CallbackQuery
+	chatId := cq.From.Id
+	lang := t.lang(chatId)
+
+	if t.escalator == nil || !t.escalator.Ack(strings.TrimPrefix(cq.Data, cbAck), chatId) {
+		_, _ = cq.Answer(t.api, &tgbotapi.AnswerCallbackQueryOpts{Text: tr(lang, ansAlertGone)})
+		return nil
+	}
+
+	if msg := cq.Message; msg != nil {
+		if im, ok := msg.(tgbotapi.Message); ok {
+			_, _, _ = t.api.EditMessageReplyMarkup(&tgbotapi.EditMessageReplyMarkupOpts{
+				ChatId:    chatId,
+				MessageId: im.MessageId,
+			})
+		}
+	}
+
+	_, _ = cq.Answer(t.api, &tgbotapi.AnswerCallbackQueryOpts{Text: tr(lang, ansAcknowledged)})
 	return nil
 }
@@ -0,0 +1,212 @@
+package bot
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+	"wfsync/entity"
+	"wfsync/lib/clock"
+
+	tgbotapi "github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+)
+
+// settingsBot returns a bot whose cache holds one user with the given role under id 7.
+func settingsBot(client *fakeBotClient, role entity.TelegramRole) *TgBot {
+	return &TgBot{
+		log: slog.New(slog.NewTextHandler(io.Discard, nil)),
+		api: &tgbotapi.Bot{Token: "token", BotClient: client},
+		db:  &orderDB{},
+		users: map[int64]*entity.User{
+			7: {TelegramId: 7, TelegramRole: role, TelegramEnabled: true},
+		},
+	}
+}
+
+// callbackData decodes the reply_markup of a sent message into its buttons' callback data.
+func callbackData(t *testing.T, params map[string]string) []string {
+	t.Helper()
+	var markup tgbotapi.InlineKeyboardMarkup
+	if err := json.Unmarshal([]byte(params["reply_markup"]), &markup); err != nil {
+		t.Fatalf("decode reply_markup %q: %v", params["reply_markup"], err)
+	}
+	var data []string
+	for _, row := range markup.InlineKeyboard {
+		for _, button := range row {
+			data = append(data, button.CallbackData)
+		}
+	}
+	return data
+}
+
+// TestStatusKeyboard checks that the /status message carries buttons opening the topics
+// and tier keyboards, plus the level keyboard for admins only.
+func TestStatusKeyboard(t *testing.T) {
+	cases := []struct {
+		name string
+		role entity.TelegramRole
+		want []string
+	}{
+		{"user", entity.RoleUser, []string{"o:topics", "o:tier"}},
+		{"admin", entity.RoleAdmin, []string{"o:topics", "o:tier", "o:level"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := &fakeBotClient{}
+			bot := settingsBot(client, tc.role)
+			ctx := ext.NewContext(bot.api, &tgbotapi.Update{Message: &tgbotapi.Message{
+				Text: "/status",
+				From: &tgbotapi.User{Id: 7},
+				Chat: tgbotapi.Chat{Id: 7, Type: "private"},
+			}}, nil)
+
+			if err := bot.status(bot.api, ctx); err != nil {
+				t.Fatalf("status: %v", err)
+			}
+			if len(client.methods) != 1 || client.methods[0] != "sendMessage" {
+				t.Fatalf("bot calls = %v, want one sendMessage", client.methods)
+			}
+			if !strings.Contains(client.params[0]["text"], "*Your Settings*") {
+				t.Errorf("text = %q, want the settings summary", client.params[0]["text"])
+			}
+			if got := callbackData(t, client.params[0]); strings.Join(got, ",") != strings.Join(tc.want, ",") {
+				t.Errorf("buttons = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+// TestOnOpenCallback checks that a /status button sends the matching settings keyboard
+// and that the level keyboard is refused to regular users, in the user's language.
+func TestOnOpenCallback(t *testing.T) {
+	cases := []struct {
+		name        string
+		role        entity.TelegramRole
+		language    string
+		data        string
+		wantButton  string // callback data expected on the sent keyboard, empty when none is sent
+		wantRefusal string
+	}{
+		{"topics", entity.RoleUser, "", "o:topics", "t:all", ""},
+		{"tier", entity.RoleUser, "", "o:tier", "tr:digest", ""},
+		{"level as admin", entity.RoleAdmin, "", "o:level", "lv:error", ""},
+		{"level as user", entity.RoleUser, "", "o:level", "", "Admin access required"},
+		{"unknown", entity.RoleUser, "", "o:other", "", "Invalid option"},
+		{"pending user", entity.RoleNone, "", "o:topics", "", "Not authorized"},
+		{"polish refusal", entity.RoleUser, "pl", "o:level", "", "Wymagane uprawnienia administratora"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := &fakeBotClient{}
+			bot := settingsBot(client, tc.role)
+			bot.users[7].Language = tc.language
+			ctx := ext.NewContext(bot.api, &tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{
+				Id:   "cq",
+				From: tgbotapi.User{Id: 7},
+				Data: tc.data,
+			}}, nil)
+
+			if err := bot.onOpenCallback(bot.api, ctx); err != nil {
+				t.Fatalf("onOpenCallback: %v", err)
+			}
+			last := len(client.methods) - 1
+			if last < 0 || client.methods[last] != "answerCallbackQuery" {
+				t.Fatalf("bot calls = %v, want the callback answered", client.methods)
+			}
+			if tc.wantButton == "" {
+				if last != 0 {
+					t.Errorf("bot calls = %v, want only the answer", client.methods)
+				}
+				if !strings.Contains(client.params[last]["text"], tc.wantRefusal) {
+					t.Errorf("answer = %q, want %q", client.params[last]["text"], tc.wantRefusal)
+				}
+				return
+			}
+			if last != 1 || client.methods[0] != "sendMessage" {
+				t.Fatalf("bot calls = %v, want sendMessage then the answer", client.methods)
+			}
+			if got := callbackData(t, client.params[0]); !strings.Contains(strings.Join(got, ","), tc.wantButton) {
+				t.Errorf("buttons = %v, want %q", got, tc.wantButton)
+			}
+		})
+	}
+}
+
+// tierDB stores the tier set through the tier keyboard.
+type tierDB struct {
+	usersDB
+}
+
+func (d *tierDB) SetSubscriptionTier(telegramId int64, tier entity.SubscriptionTier, _ string) error {
+	d.users[telegramId].SubscriptionTier = tier
+	return nil
+}
+
+// TestTierChangeFlushesDigest switches a digest-tier user to another tier and checks that
+// their buffered entries are sent at once, leaving other users' entries buffered, while
+// staying on the digest tier keeps the buffer.
+func TestTierChangeFlushesDigest(t *testing.T) {
+	cases := []struct {
+		name        string
+		data        string
+		wantFlushed bool
+	}{
+		{"realtime", "tr:realtime", true},
+		{"critical", "tr:critical", true},
+		{"digest", "tr:digest", false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := &fakeBotClient{}
+			bot := &TgBot{
+				log: slog.New(slog.NewTextHandler(io.Discard, nil)),
+				api: &tgbotapi.Bot{Token: "token", BotClient: client},
+				db: &tierDB{usersDB{users: map[int64]*entity.User{
+					7: {TelegramId: 7, TelegramRole: entity.RoleUser, TelegramEnabled: true, SubscriptionTier: entity.TierDigest},
+					8: {TelegramId: 8, TelegramRole: entity.RoleUser, TelegramEnabled: true, SubscriptionTier: entity.TierDigest},
+				}}},
+				clock: clock.Real,
+			}
+			bot.loadUsers()
+			bot.digest = NewDigestBuffer(bot, time.Hour)
+			bot.digest.Add(7, "order paid", entity.TopicPayment, slog.LevelInfo)
+			bot.digest.Add(8, "someone else's", entity.TopicPayment, slog.LevelInfo)
+			ctx := ext.NewContext(bot.api, &tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{
+				Id:   "cq",
+				From: tgbotapi.User{Id: 7},
+				Data: tc.data,
+			}}, nil)
+
+			if err := bot.onTierCallback(bot.api, ctx); err != nil {
+				t.Fatalf("onTierCallback: %v", err)
+			}
+			var digests []string
+			for i, method := range client.methods {
+				if method == "sendMessage" {
+					digests = append(digests, client.params[i]["chat_id"]+": "+client.params[i]["text"])
+				}
+			}
+			if tc.wantFlushed {
+				if len(digests) != 1 || !strings.HasPrefix(digests[0], "7: ") || !strings.Contains(digests[0], "order paid") {
+					t.Errorf("sent = %v, want the user's digest", digests)
+				}
+				if got := len(bot.digest.Pending(7)); got != 0 {
+					t.Errorf("pending = %d, want the buffer flushed", got)
+				}
+			} else {
+				if len(digests) != 0 {
+					t.Errorf("sent = %v, want no digest", digests)
+				}
+				if got := len(bot.digest.Pending(7)); got != 1 {
+					t.Errorf("pending = %d, want the entry kept", got)
+				}
+			}
+			if got := len(bot.digest.Pending(8)); got != 1 {
+				t.Errorf("other user's pending = %d, want 1", got)
+			}
+		})
+	}
+}
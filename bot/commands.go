@@ -3,8 +3,11 @@ package bot
 import (
 	"fmt"
 	"log/slog"
+	"slices"
 	"strings"
+	"time"
 	"wfsync/entity"
+	"wfsync/lib/sl"
 
 	tgbotapi "github.com/PaulSonOfLars/gotgbot/v2"
 	"github.com/PaulSonOfLars/gotgbot/v2/ext"
@@ -13,8 +16,9 @@ import (
 // start handles the /start command. Three cases:
 //  1. Known approved user → re-enable notifications
 //  2. Known pending user → inform about awaiting approval
-//  3. Unknown user → register; auto-approve if valid invite code or approval not required,
-//     otherwise mark as pending and notify admins with approve/revoke buttons.
+//  3. Unknown user → register; configured admin ids become admins, others are auto-approved
+//     with a valid invite code or when approval is not required, otherwise marked as
+//     pending with admins notified through approve/revoke buttons.
 //
 // Invite codes are passed via Telegram deep links: /start CODE
 func (t *TgBot) start(_ *tgbotapi.Bot, ctx *ext.Context) error {
@@ -32,14 +36,14 @@ func (t *TgBot) start(_ *tgbotapi.Bot, ctx *ext.Context) error {
 			return nil
 		}
 		t.sanitizeUserTopicsSingle(user)
-		t.plainResponse(chatId, "Notifications ENABLED")
+		t.plainResponse(chatId, tr(t.lang(chatId), msgNotificationsEnabled))
 		t.loadUsers()
 		return nil
 	}
 
 	// Case 2: Known pending user
 	if user != nil && user.IsPending() {
-		t.plainResponse(chatId, "Your registration is awaiting admin approval\\.")
+		t.plainResponse(chatId, tr(t.lang(chatId), msgAwaitingApproval))
 		return nil
 	}
 
@@ -48,40 +52,52 @@ func (t *TgBot) start(_ *tgbotapi.Bot, ctx *ext.Context) error {
 
 	// Check for invite code in args (/start CODE via deep link)
 	args := strings.Fields(ctx.EffectiveMessage.Text)
-	hasValidCode := false
+	var invite *entity.InviteCode
 	if len(args) > 1 {
-		code := args[1]
-		err := t.db.UseInviteCode(code, chatId)
-		if err == nil {
-			hasValidCode = true
-		}
+		invite, _ = t.db.UseInviteCode(args[1], chatId)
 	}
+	hasValidCode := invite != nil
 
 	err := t.db.RegisterTelegramUser(chatId, username)
 	if err != nil {
 		t.reportError(chatId, "/start register", err)
 		return nil
 	}
+	if hasValidCode {
+		t.attributeInvite(invite, chatId, username)
+	}
+
+	// Replies follow the language of the user's Telegram app when there is a catalog for it
+	lang := supportedLanguage(ctx.EffectiveUser.LanguageCode)
+	if lang != "" {
+		if err = t.db.SetLanguage(chatId, lang); err != nil {
+			t.log.With(slog.Int64("user_id", chatId), sl.Err(err)).Warn("set language")
+		}
+	} else {
+		lang = t.lang(chatId)
+	}
 
-	if hasValidCode || !t.config.RequireApproval {
-		// Auto-approve with valid invite code or when approval not required
-		err = t.db.SetTelegramRole(chatId, entity.RoleUser)
+	role := entity.RoleUser
+	if slices.Contains(t.config.AdminIds, chatId) {
+		role = entity.RoleAdmin
+	}
+	if role == entity.RoleAdmin || hasValidCode || !t.config.RequireApproval {
+		// Auto-approve configured admins, valid invite codes, or when approval not required
+		err = t.setRole(chatId, chatId, role)
 		if err != nil {
 			t.reportError(chatId, "/start approve", err)
 			return nil
 		}
 
-		// Set default topic to invoice only for new users
-		_ = t.db.SetTelegramTopics(chatId, []string{entity.TopicInvoice})
+		t.setDefaultTopics(chatId, role)
 
-		t.plainResponse(chatId, "Welcome\\! You have been approved\\. Notifications are now ENABLED\\.")
-		t.setUserCommands(chatId, entity.RoleUser)
-		t.notifyAdmins(fmt.Sprintf("New user auto\\-approved: @%s \\(%d\\)", Sanitize(username), chatId))
+		t.plainResponse(chatId, tr(lang, msgWelcomeApproved))
+		t.setUserCommands(chatId, role)
+		t.notifyAdmins(fmt.Sprintf("New %s auto\\-approved: @%s \\(%d\\)", role, Sanitize(username), chatId))
 	} else {
-		t.plainResponse(chatId, "Registration received\\. An admin will review your request\\.")
+		t.plainResponse(chatId, tr(lang, msgRegistrationReceived))
 		t.setUserCommands(chatId, entity.RolePending)
 		// Notify admins with approve/revoke buttons
-		keyboard := buildPendingUserButtons(chatId)
 		t.mu.RLock()
 		adminIds := make([]int64, len(t.adminIds))
 		copy(adminIds, t.adminIds)
@@ -89,7 +105,7 @@ func (t *TgBot) start(_ *tgbotapi.Bot, ctx *ext.Context) error {
 		for _, adminId := range adminIds {
 			t.sendWithKeyboard(adminId,
 				fmt.Sprintf("New pending registration: @%s \\(%d\\)", Sanitize(username), chatId),
-				keyboard,
+				buildPendingUserButtons(chatId, t.lang(adminId)),
 			)
 		}
 	}
@@ -98,6 +114,19 @@ func (t *TgBot) start(_ *tgbotapi.Bot, ctx *ext.Context) error {
 	return nil
 }
 
+// attributeInvite records on the new user which admin's invite code they registered
+// with, and tells that admin their invite was used.
+func (t *TgBot) attributeInvite(invite *entity.InviteCode, chatId int64, username string) {
+	if invite.CreatedBy == 0 {
+		return
+	}
+	if err := t.db.SetInvitedBy(chatId, invite.CreatedBy); err != nil {
+		t.log.With(slog.Int64("user_id", chatId), sl.Err(err)).Warn("set invited by")
+	}
+	t.plainResponse(invite.CreatedBy, tr(t.lang(invite.CreatedBy), msgInviteUsed,
+		Sanitize(invite.Code), Sanitize(username), chatId))
+}
+
 // stop disables notifications for the calling user. Requires approved role.
 func (t *TgBot) stop(_ *tgbotapi.Bot, ctx *ext.Context) error {
 	if t.db == nil {
@@ -118,7 +147,7 @@ func (t *TgBot) stop(_ *tgbotapi.Bot, ctx *ext.Context) error {
 		t.reportError(chatId, "/stop", err)
 		return nil
 	}
-	t.plainResponse(chatId, "Notifications DISABLED")
+	t.plainResponse(chatId, tr(t.lang(chatId), msgNotificationsDisabled))
 	t.loadUsers()
 	return nil
 }
@@ -130,7 +159,7 @@ func (t *TgBot) level(_ *tgbotapi.Bot, ctx *ext.Context) error {
 	}
 	chatId := ctx.EffectiveUser.Id
 	if !t.requireAdmin(chatId) {
-		t.plainResponse(chatId, "Admin access required\\.")
+		t.plainResponse(chatId, tr(t.lang(chatId), msgAdminRequired))
 		return nil
 	}
 
@@ -139,8 +168,7 @@ func (t *TgBot) level(_ *tgbotapi.Bot, ctx *ext.Context) error {
 		return nil
 	}
 
-	keyboard := buildLevelKeyboard(user.LogLevel)
-	t.sendWithKeyboard(chatId, "*Log level*\nSelect minimum level:", keyboard)
+	t.sendSettingsKeyboard(chatId, user, openLevel)
 	return nil
 }
 
@@ -151,7 +179,7 @@ func (t *TgBot) topics(_ *tgbotapi.Bot, ctx *ext.Context) error {
 	}
 	chatId := ctx.EffectiveUser.Id
 	if !t.requireApproved(chatId) {
-		t.plainResponse(chatId, "You need to be approved first\\.")
+		t.plainResponse(chatId, tr(t.lang(chatId), msgApprovalRequired))
 		return nil
 	}
 
@@ -160,8 +188,7 @@ func (t *TgBot) topics(_ *tgbotapi.Bot, ctx *ext.Context) error {
 		return nil
 	}
 
-	keyboard := buildTopicsKeyboard(user)
-	t.sendWithKeyboard(chatId, "*Topic subscriptions*\nTap a topic to toggle:", keyboard)
+	t.sendSettingsKeyboard(chatId, user, openTopics)
 	return nil
 }
 
@@ -172,7 +199,7 @@ func (t *TgBot) subscribe(_ *tgbotapi.Bot, ctx *ext.Context) error {
 	}
 	chatId := ctx.EffectiveUser.Id
 	if !t.requireApproved(chatId) {
-		t.plainResponse(chatId, "You need to be approved first\\.")
+		t.plainResponse(chatId, tr(t.lang(chatId), msgApprovalRequired))
 		return nil
 	}
 
@@ -183,7 +210,7 @@ func (t *TgBot) subscribe(_ *tgbotapi.Bot, ctx *ext.Context) error {
 
 	args := strings.Fields(ctx.EffectiveMessage.Text)
 	if len(args) < 2 {
-		t.plainResponse(chatId, "Usage: `/subscribe <topic|all>`\nAvailable topics: "+Sanitize(strings.Join(entity.TopicsForRole(user.TelegramRole), ", ")))
+		t.plainResponse(chatId, tr(t.lang(chatId), msgSubscribeUsage, Sanitize(strings.Join(entity.TopicsForRole(user.TelegramRole), ", "))))
 		return nil
 	}
 
@@ -195,13 +222,13 @@ func (t *TgBot) subscribe(_ *tgbotapi.Bot, ctx *ext.Context) error {
 			t.reportError(chatId, "/subscribe all", err)
 			return nil
 		}
-		t.plainResponse(chatId, "Subscribed to *all* topics\\.")
+		t.plainResponse(chatId, tr(t.lang(chatId), msgSubscribedAll))
 		t.loadUsers()
 		return nil
 	}
 
 	if !entity.IsTopicAllowedForRole(topic, user.TelegramRole) {
-		t.plainResponse(chatId, "Invalid topic: `"+Sanitize(topic)+"`\nAvailable: "+Sanitize(strings.Join(entity.TopicsForRole(user.TelegramRole), ", ")))
+		t.plainResponse(chatId, tr(t.lang(chatId), msgInvalidTopic, Sanitize(topic), Sanitize(strings.Join(entity.TopicsForRole(user.TelegramRole), ", "))))
 		return nil
 	}
 
@@ -221,7 +248,7 @@ func (t *TgBot) subscribe(_ *tgbotapi.Bot, ctx *ext.Context) error {
 		t.reportError(chatId, "/subscribe", err)
 		return nil
 	}
-	t.plainResponse(chatId, "Subscribed to `"+Sanitize(topic)+"`")
+	t.plainResponse(chatId, tr(t.lang(chatId), msgSubscribed, Sanitize(topic)))
 	t.loadUsers()
 	return nil
 }
@@ -233,7 +260,7 @@ func (t *TgBot) unsubscribe(_ *tgbotapi.Bot, ctx *ext.Context) error {
 	}
 	chatId := ctx.EffectiveUser.Id
 	if !t.requireApproved(chatId) {
-		t.plainResponse(chatId, "You need to be approved first\\.")
+		t.plainResponse(chatId, tr(t.lang(chatId), msgApprovalRequired))
 		return nil
 	}
 
@@ -244,7 +271,7 @@ func (t *TgBot) unsubscribe(_ *tgbotapi.Bot, ctx *ext.Context) error {
 
 	args := strings.Fields(ctx.EffectiveMessage.Text)
 	if len(args) < 2 {
-		t.plainResponse(chatId, "Usage: `/unsubscribe <topic|all>`\nAvailable topics: "+Sanitize(strings.Join(entity.TopicsForRole(user.TelegramRole), ", ")))
+		t.plainResponse(chatId, tr(t.lang(chatId), msgUnsubscribeUsage, Sanitize(strings.Join(entity.TopicsForRole(user.TelegramRole), ", "))))
 		return nil
 	}
 
@@ -256,13 +283,13 @@ func (t *TgBot) unsubscribe(_ *tgbotapi.Bot, ctx *ext.Context) error {
 			t.reportError(chatId, "/unsubscribe all", err)
 			return nil
 		}
-		t.plainResponse(chatId, "Unsubscribed from all topics\\.")
+		t.plainResponse(chatId, tr(t.lang(chatId), msgUnsubscribedAll))
 		t.loadUsers()
 		return nil
 	}
 
 	if !entity.IsTopicAllowedForRole(topic, user.TelegramRole) {
-		t.plainResponse(chatId, "Invalid topic: `"+Sanitize(topic)+"`\nAvailable: "+Sanitize(strings.Join(entity.TopicsForRole(user.TelegramRole), ", ")))
+		t.plainResponse(chatId, tr(t.lang(chatId), msgInvalidTopic, Sanitize(topic), Sanitize(strings.Join(entity.TopicsForRole(user.TelegramRole), ", "))))
 		return nil
 	}
 
@@ -287,11 +314,192 @@ func (t *TgBot) unsubscribe(_ *tgbotapi.Bot, ctx *ext.Context) error {
 		t.reportError(chatId, "/unsubscribe", err)
 		return nil
 	}
-	t.plainResponse(chatId, "Unsubscribed from `"+Sanitize(topic)+"`")
+	t.plainResponse(chatId, tr(t.lang(chatId), msgUnsubscribed, Sanitize(topic)))
+	t.loadUsers()
+	return nil
+}
+
+// mute silences a topic for a while without unsubscribing: /mute <topic> <duration>,
+// where duration is like 30m or 4h; /mute <topic> off lifts the mute early.
+func (t *TgBot) mute(_ *tgbotapi.Bot, ctx *ext.Context) error {
+	if t.db == nil {
+		return nil
+	}
+	chatId := ctx.EffectiveUser.Id
+	if !t.requireApproved(chatId) {
+		t.plainResponse(chatId, tr(t.lang(chatId), msgApprovalRequired))
+		return nil
+	}
+
+	user := t.findUser(chatId)
+	if user == nil {
+		return nil
+	}
+
+	args := strings.Fields(ctx.EffectiveMessage.Text)
+	if len(args) < 3 {
+		t.plainResponse(chatId, tr(t.lang(chatId), msgMuteUsage))
+		return nil
+	}
+
+	topic := strings.ToLower(args[1])
+	if !entity.IsTopicAllowedForRole(topic, user.TelegramRole) {
+		t.plainResponse(chatId, tr(t.lang(chatId), msgInvalidTopic, Sanitize(topic), Sanitize(strings.Join(entity.TopicsForRole(user.TelegramRole), ", "))))
+		return nil
+	}
+
+	var until time.Time
+	if !strings.EqualFold(args[2], "off") {
+		d, err := time.ParseDuration(args[2])
+		if err != nil || d <= 0 {
+			t.plainResponse(chatId, tr(t.lang(chatId), msgInvalidDuration, Sanitize(args[2])))
+			return nil
+		}
+		until = t.clock.Now().Add(d)
+	}
+
+	if err := t.db.SetTopicMute(chatId, topic, until); err != nil {
+		t.reportError(chatId, "/mute", err)
+		return nil
+	}
+	if until.IsZero() {
+		t.plainResponse(chatId, tr(t.lang(chatId), msgUnmuted, Sanitize(topic)))
+	} else {
+		t.plainResponse(chatId, tr(t.lang(chatId), msgMuted, Sanitize(topic), Sanitize(until.In(t.userLocation(chatId)).Format(retryJobTimeFormat))))
+	}
 	t.loadUsers()
 	return nil
 }
 
+// digestCmd sets how often the user's digest is sent: /digest <interval>, where interval
+// is like 30m, 1h or 24h; /digest default restores the configured interval. /digest
+// alone previews the buffered entries and /digest now sends them right away.
+func (t *TgBot) digestCmd(_ *tgbotapi.Bot, ctx *ext.Context) error {
+	if t.db == nil {
+		return nil
+	}
+	chatId := ctx.EffectiveUser.Id
+	if !t.requireApproved(chatId) {
+		t.plainResponse(chatId, tr(t.lang(chatId), msgApprovalRequired))
+		return nil
+	}
+
+	args := strings.Fields(ctx.EffectiveMessage.Text)
+	if len(args) < 2 {
+		t.previewDigest(chatId)
+		return nil
+	}
+	if strings.EqualFold(args[1], "now") {
+		if t.digest == nil || t.digest.FlushUser(chatId) == 0 {
+			t.plainResponse(chatId, tr(t.lang(chatId), msgDigestEmpty, Sanitize(formatInterval(t.digestInterval(chatId)))))
+		}
+		return nil
+	}
+
+	minutes := 0
+	if !strings.EqualFold(args[1], "default") {
+		d, err := time.ParseDuration(args[1])
+		if err != nil || d < time.Minute {
+			t.plainResponse(chatId, tr(t.lang(chatId), msgInvalidInterval, Sanitize(args[1])))
+			return nil
+		}
+		minutes = int(d / time.Minute)
+	}
+
+	if err := t.db.SetDigestInterval(chatId, minutes); err != nil {
+		t.reportError(chatId, "/digest", err)
+		return nil
+	}
+	t.loadUsers()
+	t.plainResponse(chatId, tr(t.lang(chatId), msgDigestSet, Sanitize(formatInterval(t.digestInterval(chatId)))))
+	return nil
+}
+
+// previewDigest shows the user the entries buffered for their next digest, without
+// sending the digest.
+func (t *TgBot) previewDigest(chatId int64) {
+	interval := Sanitize(formatInterval(t.digestInterval(chatId)))
+	var entries []DigestEntry
+	if t.digest != nil {
+		entries = t.digest.Pending(chatId)
+	}
+	if len(entries) == 0 {
+		t.plainResponse(chatId, tr(t.lang(chatId), msgDigestEmpty, interval))
+		return
+	}
+	t.plainResponse(chatId, tr(t.lang(chatId), msgDigestPreview, interval)+"\n\n"+formatDigest(entries, t.config.DigestMaxEntries, t.userLocation(chatId)))
+}
+
+// digestInterval returns how often the user's digest is sent: their own interval, or
+// the configured default.
+func (t *TgBot) digestInterval(chatId int64) time.Duration {
+	if user := t.findUser(chatId); user != nil && user.DigestIntervalMin > 0 {
+		return time.Duration(user.DigestIntervalMin) * time.Minute
+	}
+	return time.Duration(t.config.DigestIntervalMin) * time.Minute
+}
+
+// timezoneCmd sets the zone the user's digest and notification times are shown in:
+// /timezone <zone>, an IANA name like Europe/Warsaw; /timezone default restores the
+// server's zone.
+func (t *TgBot) timezoneCmd(_ *tgbotapi.Bot, ctx *ext.Context) error {
+	if t.db == nil {
+		return nil
+	}
+	chatId := ctx.EffectiveUser.Id
+	if !t.requireApproved(chatId) {
+		t.plainResponse(chatId, tr(t.lang(chatId), msgApprovalRequired))
+		return nil
+	}
+
+	args := strings.Fields(ctx.EffectiveMessage.Text)
+	if len(args) < 2 {
+		t.plainResponse(chatId, tr(t.lang(chatId), msgTimezoneUsage))
+		return nil
+	}
+
+	zone := ""
+	if !strings.EqualFold(args[1], "default") {
+		loc, err := time.LoadLocation(args[1])
+		if err != nil || args[1] == "Local" {
+			t.plainResponse(chatId, tr(t.lang(chatId), msgInvalidTimezone, Sanitize(args[1])))
+			return nil
+		}
+		zone = loc.String()
+	}
+
+	if err := t.db.SetTimezone(chatId, zone); err != nil {
+		t.reportError(chatId, "/timezone", err)
+		return nil
+	}
+	t.loadUsers()
+	loc := t.userLocation(chatId)
+	t.plainResponse(chatId, tr(t.lang(chatId), msgTimezoneSet,
+		Sanitize(loc.String()), Sanitize(t.clock.Now().In(loc).Format("15:04"))))
+	return nil
+}
+
+// userLocation returns the zone the user's times are shown in: their own zone, or the
+// zone of the bot's clock, which is the server's.
+func (t *TgBot) userLocation(chatId int64) *time.Location {
+	if user := t.findUser(chatId); user != nil && user.Timezone != "" {
+		if loc, err := time.LoadLocation(user.Timezone); err == nil {
+			return loc
+		}
+	}
+	return t.clock.Now().Location()
+}
+
+// formatInterval renders a whole-minute duration without zero trailing units: 1h, 90m → 1h30m.
+func formatInterval(d time.Duration) string {
+	s := d.String()
+	s = strings.TrimSuffix(s, "0s")
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
+
 // tier shows an inline keyboard to select the notification delivery mode (realtime/critical/digest).
 func (t *TgBot) tier(_ *tgbotapi.Bot, ctx *ext.Context) error {
 	if t.db == nil {
@@ -299,7 +507,7 @@ func (t *TgBot) tier(_ *tgbotapi.Bot, ctx *ext.Context) error {
 	}
 	chatId := ctx.EffectiveUser.Id
 	if !t.requireApproved(chatId) {
-		t.plainResponse(chatId, "You need to be approved first\\.")
+		t.plainResponse(chatId, tr(t.lang(chatId), msgApprovalRequired))
 		return nil
 	}
 
@@ -308,19 +516,19 @@ func (t *TgBot) tier(_ *tgbotapi.Bot, ctx *ext.Context) error {
 		return nil
 	}
 
-	keyboard := buildTierKeyboard(user.SubscriptionTier)
-	t.sendWithKeyboard(chatId, "*Notification tier*\nSelect delivery mode:", keyboard)
+	t.sendSettingsKeyboard(chatId, user, openTier)
 	return nil
 }
 
-// status displays the user's current settings: role, enabled, level, tier, topics.
+// status displays the user's current settings: role, enabled, level, tier, topics,
+// with buttons that open the topics, tier and level keyboards.
 func (t *TgBot) status(_ *tgbotapi.Bot, ctx *ext.Context) error {
 	if t.db == nil {
 		return nil
 	}
 	chatId := ctx.EffectiveUser.Id
 	if !t.requireApproved(chatId) {
-		t.plainResponse(chatId, "You need to be approved first\\.")
+		t.plainResponse(chatId, tr(t.lang(chatId), msgApprovalRequired))
 		return nil
 	}
 
@@ -329,49 +537,39 @@ func (t *TgBot) status(_ *tgbotapi.Bot, ctx *ext.Context) error {
 		return nil
 	}
 
+	lang := t.lang(chatId)
+	t.sendWithKeyboard(chatId, formatStatus(user, lang), buildStatusKeyboard(user, lang))
+	return nil
+}
+
+// formatStatus renders the user's settings as a MarkdownV2 message in the language.
+// Admins also see their role and log level.
+func formatStatus(user *entity.User, lang string) string {
 	tier := string(user.SubscriptionTier)
 	if tier == "" {
 		tier = string(entity.TierRealtime)
 	}
 
-	topics := "all"
+	topics := tr(lang, msgAllTopics)
 	if len(user.TelegramTopics) > 0 {
 		topics = strings.Join(user.TelegramTopics, ", ")
 	}
 
-	enabled := "yes"
+	enabled := tr(lang, msgYes)
 	if !user.TelegramEnabled {
-		enabled = "no"
+		enabled = tr(lang, msgNo)
 	}
 
-	var msg string
 	if user.IsAdmin() {
-		msg = fmt.Sprintf(
-			"*Your Settings*\n"+
-				"Role: `%s`\n"+
-				"Enabled: `%s`\n"+
-				"Log level: `%s`\n"+
-				"Tier: `%s`\n"+
-				"Topics: `%s`",
+		return tr(lang, msgStatusAdmin,
 			Sanitize(string(user.TelegramRole)),
-			enabled,
+			Sanitize(enabled),
 			Sanitize(slog.Level(user.LogLevel).String()),
 			Sanitize(tier),
 			Sanitize(topics),
 		)
-	} else {
-		msg = fmt.Sprintf(
-			"*Your Settings*\n"+
-				"Enabled: `%s`\n"+
-				"Tier: `%s`\n"+
-				"Topics: `%s`",
-			enabled,
-			Sanitize(tier),
-			Sanitize(topics),
-		)
 	}
-	t.plainResponse(chatId, msg)
-	return nil
+	return tr(lang, msgStatus, Sanitize(enabled), Sanitize(tier), Sanitize(topics))
 }
 
 // help lists available commands, filtered by the caller's role.
@@ -380,29 +578,14 @@ func (t *TgBot) help(_ *tgbotapi.Bot, ctx *ext.Context) error {
 	isAdmin := t.requireAdmin(chatId)
 	isApproved := t.requireApproved(chatId)
 
+	lang := t.lang(chatId)
 	var sb strings.Builder
-	sb.WriteString("*Available Commands*\n\n")
-
-	sb.WriteString("`/start` \\- Register or enable notifications\n")
-	sb.WriteString("`/help` \\- Show this help\n")
-
+	sb.WriteString(tr(lang, msgHelp))
 	if isApproved {
-		sb.WriteString("\n*User Commands:*\n")
-		sb.WriteString("`/stop` \\- Disable notifications\n")
-		sb.WriteString("`/topics` \\- Manage topic subscriptions\n")
-		sb.WriteString("`/tier` \\- Set notification tier\n")
-		sb.WriteString("`/status` \\- Show your settings\n")
+		sb.WriteString(tr(lang, msgHelpUser))
 	}
-
 	if isAdmin {
-		sb.WriteString("\n*Admin Commands:*\n")
-		sb.WriteString("`/level` \\- Set log level\n")
-		sb.WriteString("`/users` \\- List all users\n")
-		sb.WriteString("`/approve <id|@user>` \\- Approve a user\n")
-		sb.WriteString("`/revoke <id|@user>` \\- Revoke a user\n")
-		sb.WriteString("`/admin <id|@user>` \\- Promote to admin\n")
-		sb.WriteString("`/invite` \\- Generate invite code\n")
-		sb.WriteString("`/retries` \\- List pending invoice retry jobs\n")
+		sb.WriteString(tr(lang, msgHelpAdmin))
 	}
 
 	t.plainResponse(chatId, sb.String())
@@ -0,0 +1,350 @@
+package bot
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+	"wfsync/entity"
+	"wfsync/lib/clock"
+
+	tgbotapi "github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+)
+
+// muteDB records the mutes set through /mute.
+type muteDB struct {
+	usersDB
+	mutes map[string]time.Time
+}
+
+func (d *muteDB) SetTopicMute(_ int64, topic string, until time.Time) error {
+	d.mutes[topic] = until
+	return nil
+}
+
+// TestMute checks that /mute records the expiry relative to the bot clock, that "off"
+// lifts the mute, and that bad topics and durations are answered without a write.
+func TestMute(t *testing.T) {
+	now := time.Date(2025, 5, 20, 12, 0, 0, 0, time.UTC)
+	cases := []struct {
+		name      string
+		text      string
+		wantUntil time.Time
+		wantSet   bool
+		wantReply string
+	}{
+		{"hours", "/mute payment 4h", now.Add(4 * time.Hour), true, "until 20\\-05\\-2025 16:00"},
+		{"off", "/mute payment off", time.Time{}, true, "Unmuted"},
+		{"admin topic", "/mute system 1h", time.Time{}, false, "Invalid topic"},
+		{"bad duration", "/mute payment soon", time.Time{}, false, "Invalid duration"},
+		{"negative duration", "/mute payment -1h", time.Time{}, false, "Invalid duration"},
+		{"usage", "/mute payment", time.Time{}, false, "Usage"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := &fakeBotClient{}
+			db := &muteDB{
+				usersDB: usersDB{users: map[int64]*entity.User{7: {TelegramId: 7, TelegramRole: entity.RoleUser}}},
+				mutes:   map[string]time.Time{},
+			}
+			bot := &TgBot{
+				log:   slog.New(slog.NewTextHandler(io.Discard, nil)),
+				api:   &tgbotapi.Bot{Token: "token", BotClient: client},
+				db:    db,
+				clock: clock.NewMock(now),
+			}
+			bot.loadUsers()
+			ctx := ext.NewContext(bot.api, &tgbotapi.Update{Message: &tgbotapi.Message{
+				Text: tc.text,
+				From: &tgbotapi.User{Id: 7},
+				Chat: tgbotapi.Chat{Id: 7, Type: "private"},
+			}}, nil)
+
+			if err := bot.mute(bot.api, ctx); err != nil {
+				t.Fatalf("mute: %v", err)
+			}
+			until, set := db.mutes["payment"]
+			if set != tc.wantSet || !until.Equal(tc.wantUntil) {
+				t.Errorf("mute = %v (set %v), want %v (set %v)", until, set, tc.wantUntil, tc.wantSet)
+			}
+			if len(client.params) == 0 || !strings.Contains(client.params[0]["text"], tc.wantReply) {
+				t.Errorf("replies = %v, want %q", client.params, tc.wantReply)
+			}
+		})
+	}
+}
+
+// startDB registers users as pending and accepts the invite code "good", created by
+// admin 1.
+type startDB struct {
+	usersDB
+	invitedBy map[int64]int64
+}
+
+func (d *startDB) RegisterTelegramUser(telegramId int64, username string) error {
+	d.users[telegramId] = &entity.User{TelegramId: telegramId, TelegramUsername: username, TelegramRole: entity.RolePending}
+	return nil
+}
+
+func (d *startDB) UseInviteCode(code string, telegramId int64) (*entity.InviteCode, error) {
+	if code != "good" {
+		return nil, errors.New("invalid invite code")
+	}
+	return &entity.InviteCode{Code: code, CreatedBy: 1, UsedBy: telegramId, MaxUses: 1, UseCount: 1}, nil
+}
+
+func (d *startDB) SetInvitedBy(telegramId, inviterId int64) error {
+	d.invitedBy[telegramId] = inviterId
+	return nil
+}
+
+// TestStartApproval registers a new user under each approval setting: pending when
+// approval is required, approved when it is not or with a valid invite code, and admin
+// when the id is one of the configured admin ids.
+func TestStartApproval(t *testing.T) {
+	cases := []struct {
+		name      string
+		config    BotConfig
+		text      string
+		wantRole  entity.TelegramRole
+		wantReply string
+	}{
+		{"approval required", BotConfig{RequireApproval: true}, "/start", entity.RolePending, "Registration received"},
+		{"invalid invite code", BotConfig{RequireApproval: true}, "/start bad", entity.RolePending, "Registration received"},
+		{"valid invite code", BotConfig{RequireApproval: true}, "/start good", entity.RoleUser, "You have been approved"},
+		{"approval not required", BotConfig{}, "/start", entity.RoleUser, "You have been approved"},
+		{"configured admin", BotConfig{RequireApproval: true, AdminIds: []int64{9}}, "/start", entity.RoleAdmin, "You have been approved"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := &fakeBotClient{}
+			db := &startDB{
+				usersDB: usersDB{
+					users:  map[int64]*entity.User{1: {TelegramId: 1, TelegramRole: entity.RoleAdmin, TelegramEnabled: true}},
+					topics: map[int64][]string{},
+				},
+				invitedBy: map[int64]int64{},
+			}
+			bot := &TgBot{
+				log:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+				api:    &tgbotapi.Bot{Token: "token", BotClient: client},
+				db:     db,
+				config: tc.config,
+			}
+			bot.loadUsers()
+
+			ctx := ext.NewContext(bot.api, &tgbotapi.Update{Message: &tgbotapi.Message{
+				Text: tc.text,
+				From: &tgbotapi.User{Id: 9, Username: "newbie"},
+				Chat: tgbotapi.Chat{Id: 9, Type: "private"},
+			}}, nil)
+			if err := bot.start(bot.api, ctx); err != nil {
+				t.Fatalf("start: %v", err)
+			}
+
+			if got := db.users[9].TelegramRole; got != tc.wantRole {
+				t.Errorf("role = %q, want %q", got, tc.wantRole)
+			}
+			replies := map[string]string{}
+			for i, method := range client.methods {
+				if method == "sendMessage" {
+					replies[client.params[i]["chat_id"]] = client.params[i]["text"]
+				}
+			}
+			if !strings.Contains(replies["9"], tc.wantReply) {
+				t.Errorf("reply = %q, want %q", replies["9"], tc.wantReply)
+			}
+			if tc.wantRole == entity.RolePending && !strings.Contains(replies["1"], "New pending registration") {
+				t.Errorf("admin got %q, want the pending registration", replies["1"])
+			}
+		})
+	}
+}
+
+// TestInviteAttribution registers a user through an invite deep link and checks that the
+// inviting admin is recorded on the user and told that the invite was used; a user
+// registering without a code is attributed to no one.
+func TestInviteAttribution(t *testing.T) {
+	cases := []struct {
+		name        string
+		text        string
+		wantInviter int64
+	}{
+		{"invite link", "/start good", 1},
+		{"no code", "/start", 0},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := &fakeBotClient{}
+			db := &startDB{
+				usersDB: usersDB{
+					users:  map[int64]*entity.User{1: {TelegramId: 1, TelegramRole: entity.RoleAdmin, TelegramEnabled: true}},
+					topics: map[int64][]string{},
+				},
+				invitedBy: map[int64]int64{},
+			}
+			bot := &TgBot{
+				log:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+				api:    &tgbotapi.Bot{Token: "token", BotClient: client},
+				db:     db,
+				config: BotConfig{RequireApproval: true},
+			}
+			bot.loadUsers()
+
+			ctx := ext.NewContext(bot.api, &tgbotapi.Update{Message: &tgbotapi.Message{
+				Text: tc.text,
+				From: &tgbotapi.User{Id: 9, Username: "newbie"},
+				Chat: tgbotapi.Chat{Id: 9, Type: "private"},
+			}}, nil)
+			if err := bot.start(bot.api, ctx); err != nil {
+				t.Fatalf("start: %v", err)
+			}
+
+			if got := db.invitedBy[9]; got != tc.wantInviter {
+				t.Errorf("invited by = %d, want %d", got, tc.wantInviter)
+			}
+			var told bool
+			for i, method := range client.methods {
+				p := client.params[i]
+				if method == "sendMessage" && p["chat_id"] == "1" && strings.Contains(p["text"], "Your invite code `good` was used by @newbie \\(9\\)") {
+					told = true
+				}
+			}
+			if told != (tc.wantInviter != 0) {
+				t.Errorf("inviter told = %v, want %v", told, tc.wantInviter != 0)
+			}
+		})
+	}
+}
+
+// timezoneDB stores the zones set through /timezone on the users.
+type timezoneDB struct {
+	usersDB
+	writes int
+}
+
+func (d *timezoneDB) SetTimezone(telegramId int64, timezone string) error {
+	d.writes++
+	d.users[telegramId].Timezone = timezone
+	return nil
+}
+
+// TestTimezone checks that /timezone stores valid IANA zones and answers with the time
+// there, that "default" clears the zone, and that unknown zones are refused unwritten.
+func TestTimezone(t *testing.T) {
+	now := time.Date(2025, 5, 20, 12, 0, 0, 0, time.UTC)
+	cases := []struct {
+		name      string
+		text      string
+		wantZone  string
+		wantWrite bool
+		wantReply string
+	}{
+		{"valid", "/timezone Europe/Warsaw", "Europe/Warsaw", true, "Timezone set to Europe/Warsaw, your time is 14:00"},
+		{"behind utc", "/timezone America/New_York", "America/New_York", true, "your time is 08:00"},
+		{"default", "/timezone default", "", true, "Timezone set to UTC, your time is 12:00"},
+		{"unknown", "/timezone Mars/Olympus", "Asia/Tokyo", false, "Unknown timezone: `Mars/Olympus`"},
+		{"local", "/timezone Local", "Asia/Tokyo", false, "Unknown timezone"},
+		{"usage", "/timezone", "Asia/Tokyo", false, "Usage"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := &fakeBotClient{}
+			db := &timezoneDB{usersDB: usersDB{users: map[int64]*entity.User{
+				7: {TelegramId: 7, TelegramRole: entity.RoleUser, Timezone: "Asia/Tokyo"},
+			}}}
+			bot := &TgBot{
+				log:   slog.New(slog.NewTextHandler(io.Discard, nil)),
+				api:   &tgbotapi.Bot{Token: "token", BotClient: client},
+				db:    db,
+				clock: clock.NewMock(now),
+			}
+			bot.loadUsers()
+			ctx := ext.NewContext(bot.api, &tgbotapi.Update{Message: &tgbotapi.Message{
+				Text: tc.text,
+				From: &tgbotapi.User{Id: 7},
+				Chat: tgbotapi.Chat{Id: 7, Type: "private"},
+			}}, nil)
+
+			if err := bot.timezoneCmd(bot.api, ctx); err != nil {
+				t.Fatalf("timezoneCmd: %v", err)
+			}
+			if (db.writes > 0) != tc.wantWrite {
+				t.Errorf("writes = %d, want written %v", db.writes, tc.wantWrite)
+			}
+			if got := db.users[7].Timezone; got != tc.wantZone {
+				t.Errorf("zone = %q, want %q", got, tc.wantZone)
+			}
+			if len(client.params) != 1 || !strings.Contains(client.params[0]["text"], tc.wantReply) {
+				t.Errorf("replies = %v, want %q", client.params, tc.wantReply)
+			}
+		})
+	}
+}
+
+// TestDigestPreview runs /digest and /digest now for a user with buffered entries and
+// for one without: the preview lists the caller's entries and keeps them, now sends them.
+func TestDigestPreview(t *testing.T) {
+	cases := []struct {
+		name        string
+		text        string
+		buffered    bool
+		wantReply   string
+		wantPending int
+	}{
+		{"preview", "/digest", true, "Not sent yet, your digest goes out every 1h", 1},
+		{"preview empty", "/digest", false, "Your digest is empty, it is sent every 1h", 0},
+		{"now", "/digest now", true, "*Digest* \\(1 messages\\)", 0},
+		{"now empty", "/digest now", false, "Your digest is empty", 0},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := &fakeBotClient{}
+			bot := &TgBot{
+				log: slog.New(slog.NewTextHandler(io.Discard, nil)),
+				api: &tgbotapi.Bot{Token: "token", BotClient: client},
+				db:  &orderDB{},
+				users: map[int64]*entity.User{
+					7: {TelegramId: 7, TelegramRole: entity.RoleUser, TelegramEnabled: true, SubscriptionTier: entity.TierDigest},
+				},
+				config: BotConfig{DigestIntervalMin: 60},
+				clock:  clock.Real,
+			}
+			bot.digest = NewDigestBuffer(bot, time.Hour)
+			if tc.buffered {
+				bot.digest.Add(7, "order paid", entity.TopicPayment, slog.LevelInfo)
+			}
+			bot.digest.Add(8, "someone else's", entity.TopicPayment, slog.LevelInfo)
+			ctx := ext.NewContext(bot.api, &tgbotapi.Update{Message: &tgbotapi.Message{
+				Text: tc.text,
+				From: &tgbotapi.User{Id: 7},
+				Chat: tgbotapi.Chat{Id: 7, Type: "private"},
+			}}, nil)
+
+			if err := bot.digestCmd(bot.api, ctx); err != nil {
+				t.Fatalf("digestCmd: %v", err)
+			}
+			if len(client.params) != 1 || !strings.Contains(client.params[0]["text"], tc.wantReply) {
+				t.Fatalf("replies = %v, want %q", client.params, tc.wantReply)
+			}
+			if got := client.params[0]["chat_id"]; got != "7" {
+				t.Errorf("chat_id = %q, want 7", got)
+			}
+			if strings.Contains(client.params[0]["text"], "someone else") {
+				t.Errorf("reply %q shows another user's entry", client.params[0]["text"])
+			}
+			if tc.buffered && !strings.Contains(client.params[0]["text"], "order paid") {
+				t.Errorf("reply %q is missing the buffered entry", client.params[0]["text"])
+			}
+			if got := len(bot.digest.Pending(7)); got != tc.wantPending {
+				t.Errorf("pending = %d, want %d", got, tc.wantPending)
+			}
+			if got := len(bot.digest.Pending(8)); got != 1 {
+				t.Errorf("other user's pending = %d, want 1", got)
+			}
+		})
+	}
+}
@@ -3,15 +3,21 @@ package bot
 import (
 	"fmt"
 	"log/slog"
+	"sort"
 	"strings"
 	"sync"
 	"time"
+	"wfsync/lib/clock"
 )
 
 // maxTelegramMessageLen is Telegram's hard limit per message.
 // Messages exceeding this are split at newline boundaries by splitMessage.
 const maxTelegramMessageLen = 4096
 
+// digestTick is how often the ticker looks for digests that are due. Per-user
+// intervals are therefore honoured to within a minute.
+const digestTick = time.Minute
+
 // DigestEntry is a single buffered notification waiting for the next flush.
 type DigestEntry struct {
 	Message   string
@@ -21,24 +27,39 @@ type DigestEntry struct {
 }
 
 // DigestBuffer collects notifications for users on the "digest" tier
-// and flushes them as grouped summaries at a configurable interval.
+// and flushes them as grouped summaries, each user on their own interval.
+// A user's digest is due once their oldest pending entry is an interval old, so
+// every entry waits at most one interval and a user gets at most one digest per interval.
+// perUser returns a user's own interval (bot.digestInterval); 0 selects interval.
+// location returns the zone a user's digest times are shown in (bot.userLocation).
+// maxEntries caps the entries listed in one digest; the rest are only counted.
 // Thread-safe: Add() can be called concurrently from multiple goroutines.
 type DigestBuffer struct {
-	mu       sync.Mutex
-	entries  map[int64][]DigestEntry // telegram_id → pending entries
-	interval time.Duration
-	bot      *TgBot
-	stopCh   chan struct{}
-	done     chan struct{}
+	mu         sync.Mutex
+	entries    map[int64][]DigestEntry // telegram_id → pending entries
+	interval   time.Duration
+	maxEntries int // 0 lists every entry
+	bot        *TgBot
+	clock      clock.Clock
+	perUser    func(chatId int64) time.Duration
+	location   func(chatId int64) *time.Location
+	send       func(chatId int64, text string) // delivers one digest message; bot.plainResponse
+	stopCh     chan struct{}
+	done       chan struct{}
 }
 
 func NewDigestBuffer(bot *TgBot, interval time.Duration) *DigestBuffer {
 	return &DigestBuffer{
-		entries:  make(map[int64][]DigestEntry),
-		interval: interval,
-		bot:      bot,
-		stopCh:   make(chan struct{}),
-		done:     make(chan struct{}),
+		entries:    make(map[int64][]DigestEntry),
+		interval:   interval,
+		maxEntries: bot.config.DigestMaxEntries,
+		bot:        bot,
+		clock:      clock.Real,
+		perUser:    bot.digestInterval,
+		location:   bot.userLocation,
+		send:       bot.plainResponse,
+		stopCh:     make(chan struct{}),
+		done:       make(chan struct{}),
 	}
 }
 
@@ -49,21 +70,21 @@ func (d *DigestBuffer) Add(chatId int64, msg string, topic string, level slog.Le
 		Message:   msg,
 		Topic:     topic,
 		Level:     level,
-		Timestamp: time.Now(),
+		Timestamp: d.clock.Now(),
 	})
 }
 
-// StartTicker launches a background goroutine that flushes accumulated entries
-// at the configured interval. Performs a final flush on Stop().
+// StartTicker launches a background goroutine that flushes the digests that are due
+// every digestTick. Performs a final flush of everything on Stop().
 func (d *DigestBuffer) StartTicker() {
 	go func() {
 		defer close(d.done)
-		ticker := time.NewTicker(d.interval)
+		ticker := time.NewTicker(min(d.interval, digestTick))
 		defer ticker.Stop()
 		for {
 			select {
 			case <-ticker.C:
-				d.Flush()
+				d.FlushDue()
 			case <-d.stopCh:
 				d.Flush() // final flush
 				return
@@ -80,14 +101,73 @@ func (d *DigestBuffer) Flush() {
 	d.entries = make(map[int64][]DigestEntry)
 	d.mu.Unlock()
 
-	for chatId, entries := range snapshot {
-		if len(entries) == 0 {
+	d.deliver(snapshot)
+}
+
+// FlushDue sends the digests of users whose oldest pending entry is at least their
+// interval old, keeping the other users' entries buffered.
+func (d *DigestBuffer) FlushDue() {
+	now := d.clock.Now()
+	due := make(map[int64][]DigestEntry)
+
+	d.mu.Lock()
+	for chatId, entries := range d.entries {
+		if len(entries) == 0 || now.Sub(entries[0].Timestamp) < d.intervalFor(chatId) {
+			continue
+		}
+		due[chatId] = entries
+		delete(d.entries, chatId)
+	}
+	d.mu.Unlock()
+
+	d.deliver(due)
+}
+
+// Pending returns a copy of the user's buffered entries, leaving them buffered.
+func (d *DigestBuffer) Pending(chatId int64) []DigestEntry {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	entries := make([]DigestEntry, len(d.entries[chatId]))
+	copy(entries, d.entries[chatId])
+	return entries
+}
+
+// FlushUser sends the user's digest now, ahead of their interval, and returns the
+// number of entries it held.
+func (d *DigestBuffer) FlushUser(chatId int64) int {
+	d.mu.Lock()
+	entries := d.entries[chatId]
+	delete(d.entries, chatId)
+	d.mu.Unlock()
+
+	d.deliver(map[int64][]DigestEntry{chatId: entries})
+	return len(entries)
+}
+
+// intervalFor returns the user's own digest interval, or the buffer default.
+func (d *DigestBuffer) intervalFor(chatId int64) time.Duration {
+	if d.perUser != nil {
+		if interval := d.perUser(chatId); interval > 0 {
+			return interval
+		}
+	}
+	return d.interval
+}
+
+// deliver formats and sends one digest per user.
+func (d *DigestBuffer) deliver(entries map[int64][]DigestEntry) {
+	for chatId, userEntries := range entries {
+		if len(userEntries) == 0 {
 			continue
 		}
-		digest := formatDigest(entries)
+		var loc *time.Location
+		if d.location != nil {
+			loc = d.location(chatId)
+		}
+		digest := formatDigest(userEntries, d.maxEntries, loc)
 		parts := splitMessage(digest, maxTelegramMessageLen)
 		for _, part := range parts {
-			d.bot.plainResponse(chatId, part)
+			d.send(chatId, part)
 		}
 	}
 }
@@ -97,11 +177,19 @@ func (d *DigestBuffer) Stop() {
 	<-d.done
 }
 
-// formatDigest groups entries by topic and formats them as a MarkdownV2 summary.
-func formatDigest(entries []DigestEntry) string {
+// formatDigest groups entries by topic and formats them as a MarkdownV2 summary, with
+// entry times in loc; a nil loc keeps the times as they were stamped. Only the first
+// limit entries are listed, the others are counted per topic and level; a limit of 0
+// lists them all.
+func formatDigest(entries []DigestEntry, limit int, loc *time.Location) string {
+	listed, suppressed := entries, []DigestEntry(nil)
+	if limit > 0 && len(entries) > limit {
+		listed, suppressed = entries[:limit], entries[limit:]
+	}
+
 	// Group by topic
 	grouped := make(map[string][]DigestEntry)
-	for _, e := range entries {
+	for _, e := range listed {
 		grouped[e.Topic] = append(grouped[e.Topic], e)
 	}
 
@@ -111,11 +199,48 @@ func formatDigest(entries []DigestEntry) string {
 	for topic, topicEntries := range grouped {
 		sb.WriteString(fmt.Sprintf("*%s* \\(%d\\):\n", Sanitize(topic), len(topicEntries)))
 		for _, e := range topicEntries {
-			ts := e.Timestamp.Format("15:04")
-			sb.WriteString(fmt.Sprintf("  `%s` %s %s\n", ts, e.Level.String(), Sanitize(e.Message)))
+			ts := e.Timestamp
+			if loc != nil {
+				ts = ts.In(loc)
+			}
+			sb.WriteString(fmt.Sprintf("  `%s` %s %s\n", ts.Format("15:04"), e.Level.String(), Sanitize(e.Message)))
 		}
 		sb.WriteString("\n")
 	}
 
+	if len(suppressed) > 0 {
+		sb.WriteString(formatSuppressed(suppressed))
+	}
+
+	return sb.String()
+}
+
+// formatSuppressed counts the entries left out of a digest per topic and level:
+// "(+12 more suppressed)" followed by a "payment INFO: 10" line per group.
+func formatSuppressed(entries []DigestEntry) string {
+	type group struct {
+		topic string
+		level slog.Level
+	}
+	counts := make(map[group]int)
+	for _, e := range entries {
+		counts[group{e.Topic, e.Level}]++
+	}
+	groups := make([]group, 0, len(counts))
+	for g := range counts {
+		groups = append(groups, g)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].topic != groups[j].topic {
+			return groups[i].topic < groups[j].topic
+		}
+		return groups[i].level > groups[j].level
+	})
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("_\\(\\+%d more suppressed\\)_\n", len(entries)))
+	for _, g := range groups {
+		sb.WriteString(fmt.Sprintf("  %s %s: %d\n", Sanitize(g.topic), g.level.String(), counts[g]))
+	}
 	return sb.String()
 }
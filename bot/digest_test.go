@@ -0,0 +1,232 @@
+package bot
+
+import (
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+	"wfsync/lib/clock"
+)
+
+// TestDigestFlushUsesClock stamps entries with a mock clock and checks that a flush
+// delivers them once, with the times they were added.
+func TestDigestFlushUsesClock(t *testing.T) {
+	clk := clock.NewMock(time.Date(2025, 5, 1, 9, 30, 0, 0, time.UTC))
+	sent := map[int64][]string{}
+	d := &DigestBuffer{
+		entries: make(map[int64][]DigestEntry),
+		clock:   clk,
+		send:    func(chatId int64, text string) { sent[chatId] = append(sent[chatId], text) },
+	}
+
+	d.Add(1, "first", "errors", slog.LevelError)
+	clk.Advance(15 * time.Minute)
+	d.Add(1, "second", "errors", slog.LevelWarn)
+	d.Add(2, "other chat", "payments", slog.LevelInfo)
+
+	d.Flush()
+	if len(sent[1]) != 1 || len(sent[2]) != 1 {
+		t.Fatalf("sent = %v, want one digest per chat", sent)
+	}
+	for _, want := range []string{"`09:30` ERROR first", "`09:45` WARN second", "\\(2 messages\\)"} {
+		if !strings.Contains(sent[1][0], want) {
+			t.Errorf("digest for chat 1 missing %q:\n%s", want, sent[1][0])
+		}
+	}
+
+	d.Flush()
+	if len(sent[1]) != 1 {
+		t.Errorf("second flush resent entries: %v", sent[1])
+	}
+}
+
+// TestDigestFlushDuePerUser buffers entries for an hourly and a daily user and checks
+// that each digest goes out only once the user's own interval has passed since their
+// oldest entry, while users without an interval follow the buffer default.
+func TestDigestFlushDuePerUser(t *testing.T) {
+	start := time.Date(2025, 5, 1, 9, 0, 0, 0, time.UTC)
+	clk := clock.NewMock(start)
+	sent := map[int64]int{}
+	intervals := map[int64]time.Duration{1: time.Hour, 2: 24 * time.Hour}
+	d := &DigestBuffer{
+		entries:  make(map[int64][]DigestEntry),
+		interval: 2 * time.Hour,
+		clock:    clk,
+		perUser:  func(chatId int64) time.Duration { return intervals[chatId] },
+		send:     func(chatId int64, _ string) { sent[chatId]++ },
+	}
+
+	d.Add(1, "hourly", "payment", slog.LevelInfo)
+	d.Add(2, "daily", "payment", slog.LevelInfo)
+	d.Add(3, "default", "payment", slog.LevelInfo)
+
+	steps := []struct {
+		at   time.Duration
+		want map[int64]int
+	}{
+		{59 * time.Minute, map[int64]int{}},
+		{time.Hour, map[int64]int{1: 1}},
+		{2 * time.Hour, map[int64]int{1: 1, 3: 1}},
+		{23 * time.Hour, map[int64]int{1: 1, 3: 1}},
+		{24 * time.Hour, map[int64]int{1: 1, 2: 1, 3: 1}},
+	}
+	for _, step := range steps {
+		clk.Set(start.Add(step.at))
+		d.FlushDue()
+		for _, chatId := range []int64{1, 2, 3} {
+			if sent[chatId] != step.want[chatId] {
+				t.Errorf("after %v: chat %d got %d digests, want %d", step.at, chatId, sent[chatId], step.want[chatId])
+			}
+		}
+	}
+
+	// A new entry for the hourly user waits its own hour from when it was added.
+	d.Add(1, "later", "payment", slog.LevelInfo)
+	clk.Advance(30 * time.Minute)
+	d.FlushDue()
+	if sent[1] != 1 {
+		t.Errorf("hourly user got a digest after 30 minutes")
+	}
+	clk.Advance(30 * time.Minute)
+	d.FlushDue()
+	if sent[1] != 2 {
+		t.Errorf("hourly user got %d digests, want 2", sent[1])
+	}
+}
+
+// TestFormatInterval checks that trailing zero units are dropped.
+func TestFormatInterval(t *testing.T) {
+	cases := map[time.Duration]string{
+		30 * time.Minute: "30m",
+		time.Hour:        "1h",
+		90 * time.Minute: "1h30m",
+		24 * time.Hour:   "24h",
+	}
+	for d, want := range cases {
+		if got := formatInterval(d); got != want {
+			t.Errorf("formatInterval(%v) = %q, want %q", d, got, want)
+		}
+	}
+}
+
+// TestDigestUserTimezone checks that digest times are shown in each user's zone.
+func TestDigestUserTimezone(t *testing.T) {
+	warsaw, err := time.LoadLocation("Europe/Warsaw")
+	if err != nil {
+		t.Fatalf("load zone: %v", err)
+	}
+	clk := clock.NewMock(time.Date(2025, 1, 15, 9, 30, 0, 0, time.UTC))
+	sent := map[int64]string{}
+	zones := map[int64]*time.Location{1: warsaw, 2: time.UTC}
+	d := &DigestBuffer{
+		entries:  make(map[int64][]DigestEntry),
+		clock:    clk,
+		location: func(chatId int64) *time.Location { return zones[chatId] },
+		send:     func(chatId int64, text string) { sent[chatId] = text },
+	}
+
+	d.Add(1, "order paid", "payment", slog.LevelInfo)
+	d.Add(2, "order paid", "payment", slog.LevelInfo)
+	d.Flush()
+
+	if !strings.Contains(sent[1], "`10:30` INFO order paid") {
+		t.Errorf("Warsaw digest = %q, want the time in CET", sent[1])
+	}
+	if !strings.Contains(sent[2], "`09:30` INFO order paid") {
+		t.Errorf("UTC digest = %q, want the time in UTC", sent[2])
+	}
+}
+
+// TestDigestPendingAndFlushUser checks that a preview returns the caller's entries only
+// and keeps them buffered, and that flushing one user leaves the others' digests alone.
+func TestDigestPendingAndFlushUser(t *testing.T) {
+	sent := map[int64][]string{}
+	d := &DigestBuffer{
+		entries: make(map[int64][]DigestEntry),
+		clock:   clock.NewMock(time.Date(2025, 5, 1, 9, 0, 0, 0, time.UTC)),
+		send:    func(chatId int64, text string) { sent[chatId] = append(sent[chatId], text) },
+	}
+	d.Add(1, "mine", "payment", slog.LevelInfo)
+	d.Add(2, "theirs", "payment", slog.LevelInfo)
+
+	pending := d.Pending(1)
+	if len(pending) != 1 || pending[0].Message != "mine" {
+		t.Fatalf("Pending(1) = %v, want the caller's entry only", pending)
+	}
+	pending[0].Message = "changed"
+	if got := d.Pending(1); len(got) != 1 || got[0].Message != "mine" {
+		t.Errorf("Pending(1) after preview = %v, want the entry still buffered", got)
+	}
+	if len(sent) != 0 {
+		t.Errorf("preview sent %v", sent)
+	}
+
+	if n := d.FlushUser(1); n != 1 {
+		t.Errorf("FlushUser(1) = %d, want 1", n)
+	}
+	if len(sent[1]) != 1 || !strings.Contains(sent[1][0], "mine") || len(sent[2]) != 0 {
+		t.Errorf("sent = %v, want the caller's digest only", sent)
+	}
+	if got := d.Pending(1); len(got) != 0 {
+		t.Errorf("Pending(1) after flush = %v, want none", got)
+	}
+	if got := d.Pending(2); len(got) != 1 {
+		t.Errorf("Pending(2) = %v, want the other user's entry kept", got)
+	}
+	if n := d.FlushUser(1); n != 0 || len(sent[1]) != 1 {
+		t.Errorf("second FlushUser(1) = %d, sent %v, want nothing", n, sent[1])
+	}
+}
+
+// TestDigestOverflow buffers more entries than a digest may list and checks that the
+// oldest ones are listed and the rest are counted per topic and level.
+func TestDigestOverflow(t *testing.T) {
+	clk := clock.NewMock(time.Date(2025, 5, 1, 9, 0, 0, 0, time.UTC))
+	var sent []string
+	d := &DigestBuffer{
+		entries:    make(map[int64][]DigestEntry),
+		maxEntries: 2,
+		clock:      clk,
+		send:       func(_ int64, text string) { sent = append(sent, text) },
+	}
+
+	d.Add(1, "listed one", "payment", slog.LevelInfo)
+	d.Add(1, "listed two", "payment", slog.LevelInfo)
+	d.Add(1, "hidden", "payment", slog.LevelInfo)
+	d.Add(1, "hidden", "payment", slog.LevelInfo)
+	d.Add(1, "hidden", "error", slog.LevelError)
+	d.Add(1, "hidden", "payment", slog.LevelWarn)
+	d.Flush()
+
+	if len(sent) != 1 {
+		t.Fatalf("sent %d messages, want one digest", len(sent))
+	}
+	digest := sent[0]
+	for _, want := range []string{
+		"\\(6 messages\\)",
+		"INFO listed one",
+		"INFO listed two",
+		"_\\(\\+4 more suppressed\\)_\n  error ERROR: 1\n  payment WARN: 1\n  payment INFO: 2\n",
+	} {
+		if !strings.Contains(digest, want) {
+			t.Errorf("digest missing %q:\n%s", want, digest)
+		}
+	}
+	if strings.Contains(digest, "hidden") {
+		t.Errorf("digest lists suppressed entries:\n%s", digest)
+	}
+}
+
+// TestDigestNoLimit checks that a limit of 0, or one not reached, lists every entry.
+func TestDigestNoLimit(t *testing.T) {
+	entries := []DigestEntry{
+		{Message: "one", Topic: "payment", Level: slog.LevelInfo},
+		{Message: "two", Topic: "payment", Level: slog.LevelInfo},
+	}
+	for _, limit := range []int{0, 2, 5} {
+		digest := formatDigest(entries, limit, nil)
+		if !strings.Contains(digest, "one") || !strings.Contains(digest, "two") || strings.Contains(digest, "suppressed") {
+			t.Errorf("limit %d: digest = %q, want both entries listed", limit, digest)
+		}
+	}
+}
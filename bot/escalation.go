@@ -0,0 +1,151 @@
+package bot
+
+import (
+	"strconv"
+	"sync"
+	"time"
+	"wfsync/lib/clock"
+
+	tgbotapi "github.com/PaulSonOfLars/gotgbot/v2"
+)
+
+// pendingAck is a critical-tier alert waiting for the user to press "Ack".
+type pendingAck struct {
+	ChatId  int64
+	Message string
+	SentAt  time.Time
+}
+
+// Escalator tracks the error-level alerts sent to critical-tier users. An alert that
+// is not acknowledged within the window is sent to the user again and reported to all
+// admins, once; acknowledging it stops the escalation.
+// Thread-safe: Track() and Ack() are called from notification and callback goroutines.
+type Escalator struct {
+	mu       sync.Mutex
+	pending  map[string]*pendingAck // ack id → alert
+	lastId   int64
+	window   time.Duration
+	bot      *TgBot
+	clock    clock.Clock
+	escalate func(alert *pendingAck) // bot.escalateAlert
+	stopCh   chan struct{}
+	done     chan struct{}
+}
+
+func NewEscalator(bot *TgBot, window time.Duration) *Escalator {
+	return &Escalator{
+		pending:  make(map[string]*pendingAck),
+		window:   window,
+		bot:      bot,
+		clock:    clock.Real,
+		escalate: bot.escalateAlert,
+		stopCh:   make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Track registers an alert sent to chatId and returns the id its Ack button carries.
+func (e *Escalator) Track(chatId int64, msg string) string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.lastId++
+	id := strconv.FormatInt(e.lastId, 10)
+	e.pending[id] = &pendingAck{ChatId: chatId, Message: msg, SentAt: e.clock.Now()}
+	return id
+}
+
+// Ack marks the alert as acknowledged by chatId. Returns false when the alert is
+// unknown, already acknowledged or escalated, or belongs to another user.
+func (e *Escalator) Ack(id string, chatId int64) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	alert, ok := e.pending[id]
+	if !ok || alert.ChatId != chatId {
+		return false
+	}
+	delete(e.pending, id)
+	return true
+}
+
+// StartTicker launches a background goroutine that escalates overdue alerts every
+// minute, or every window when that is shorter.
+func (e *Escalator) StartTicker() {
+	go func() {
+		defer close(e.done)
+		ticker := time.NewTicker(min(e.window, time.Minute))
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				e.EscalateDue()
+			case <-e.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+// EscalateDue escalates and forgets the alerts sent at least a window ago.
+func (e *Escalator) EscalateDue() {
+	now := e.clock.Now()
+	var due []*pendingAck
+
+	e.mu.Lock()
+	for id, alert := range e.pending {
+		if now.Sub(alert.SentAt) >= e.window {
+			due = append(due, alert)
+			delete(e.pending, id)
+		}
+	}
+	e.mu.Unlock()
+
+	for _, alert := range due {
+		e.escalate(alert)
+	}
+}
+
+func (e *Escalator) Stop() {
+	close(e.stopCh)
+	<-e.done
+}
+
+// buildAckKeyboard creates the "Ack" button under a critical-tier alert.
+func buildAckKeyboard(id, lang string) tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.InlineKeyboardMarkup{
+		InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{
+			{{Text: tr(lang, btnAck), CallbackData: cbAck + id}},
+		},
+	}
+}
+
+// sendCritical sends an error-level alert to a critical-tier user, with an Ack button
+// when escalation is configured.
+func (t *TgBot) sendCritical(chatId int64, msg string) {
+	if t.escalator == nil {
+		t.plainResponse(chatId, msg)
+		return
+	}
+	t.sendWithKeyboard(chatId, msg, buildAckKeyboard(t.escalator.Track(chatId, msg), t.lang(chatId)))
+}
+
+// escalateAlert re-sends an unacknowledged alert to its user and reports it to the
+// other admins.
+func (t *TgBot) escalateAlert(alert *pendingAck) {
+	t.plainResponse(alert.ChatId, tr(t.lang(alert.ChatId), msgAlertUnacknowledged, alert.Message))
+
+	name := strconv.FormatInt(alert.ChatId, 10)
+	if user := t.findUser(alert.ChatId); user != nil {
+		name = userDisplayName(user)
+	}
+	since := alert.SentAt.Format(retryJobTimeFormat)
+
+	t.mu.RLock()
+	adminIds := make([]int64, len(t.adminIds))
+	copy(adminIds, t.adminIds)
+	t.mu.RUnlock()
+	for _, id := range adminIds {
+		if id != alert.ChatId {
+			t.plainResponse(id, tr(t.lang(id), msgAlertReport, Sanitize(name), Sanitize(since), alert.Message))
+		}
+	}
+}
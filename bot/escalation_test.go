@@ -0,0 +1,121 @@
+package bot
+
+import (
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+	"wfsync/entity"
+	"wfsync/lib/clock"
+
+	tgbotapi "github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+)
+
+// TestCriticalAlertEscalation sends an error to a critical-tier user and checks that the
+// alert carries an Ack button; acknowledging it in time stops the escalation, while an
+// alert left unacknowledged past the window is re-sent to the user and reported to the
+// admin, once.
+func TestCriticalAlertEscalation(t *testing.T) {
+	start := time.Date(2025, 5, 1, 9, 0, 0, 0, time.UTC)
+	cases := []struct {
+		name         string
+		ackAfter     time.Duration // 0 leaves the alert unacknowledged
+		wantEscalate bool
+	}{
+		{"ack before timeout", 10 * time.Minute, false},
+		{"timeout", 0, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			clk := clock.NewMock(start)
+			client := &fakeBotClient{}
+			bot := &TgBot{
+				log: slog.New(slog.NewTextHandler(io.Discard, nil)),
+				api: &tgbotapi.Bot{Token: "token", BotClient: client},
+				users: map[int64]*entity.User{
+					7: {TelegramId: 7, TelegramRole: entity.RoleUser, TelegramEnabled: true, SubscriptionTier: entity.TierCritical},
+					8: {TelegramId: 8, TelegramRole: entity.RoleAdmin, TelegramEnabled: true, TelegramTopics: []string{"none"}},
+				},
+				adminIds: []int64{8},
+				clock:    clk,
+			}
+			bot.escalator = NewEscalator(bot, 15*time.Minute)
+			bot.escalator.clock = clk
+
+			bot.SendMessageWithTopic("invoice failed", slog.LevelError, entity.TopicError)
+			if len(client.methods) != 1 {
+				t.Fatalf("bot calls = %v, want the alert", client.methods)
+			}
+			if got := callbackData(t, client.params[0]); len(got) != 1 || got[0] != "ak:1" {
+				t.Fatalf("alert buttons = %v, want ak:1", got)
+			}
+
+			if tc.ackAfter > 0 {
+				clk.Advance(tc.ackAfter)
+				ctx := ext.NewContext(bot.api, &tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{
+					Id:   "cq",
+					From: tgbotapi.User{Id: 7},
+					Data: "ak:1",
+				}}, nil)
+				if err := bot.onAckCallback(bot.api, ctx); err != nil {
+					t.Fatalf("onAckCallback: %v", err)
+				}
+				if last := client.params[len(client.params)-1]; last["text"] != "Acknowledged" {
+					t.Errorf("answer = %q, want Acknowledged", last["text"])
+				}
+			}
+			client.methods, client.params = nil, nil
+
+			clk.Set(start.Add(15 * time.Minute))
+			bot.escalator.EscalateDue()
+			if !tc.wantEscalate {
+				if len(client.methods) != 0 {
+					t.Errorf("bot calls = %v, want no escalation", client.methods)
+				}
+				return
+			}
+
+			sent := map[string]string{}
+			for _, p := range client.params {
+				sent[p["chat_id"]] = p["text"]
+			}
+			if !strings.Contains(sent["7"], "Unacknowledged alert") || !strings.Contains(sent["7"], "invoice failed") {
+				t.Errorf("user got %q, want the alert again", sent["7"])
+			}
+			if !strings.Contains(sent["8"], "not acknowledged") || !strings.Contains(sent["8"], "invoice failed") {
+				t.Errorf("admin got %q, want the escalation", sent["8"])
+			}
+
+			client.methods = nil
+			bot.escalator.EscalateDue()
+			if len(client.methods) != 0 {
+				t.Errorf("alert escalated twice: %v", client.methods)
+			}
+			if bot.escalator.Ack("1", 7) {
+				t.Error("escalated alert was still acknowledgeable")
+			}
+		})
+	}
+}
+
+// TestEscalatorAck checks that only the user an alert was sent to can acknowledge it,
+// and only once.
+func TestEscalatorAck(t *testing.T) {
+	e := &Escalator{pending: make(map[string]*pendingAck), clock: clock.NewMock(time.Now())}
+	id := e.Track(7, "alert")
+
+	if e.Ack(id, 8) {
+		t.Error("another user acknowledged the alert")
+	}
+	if !e.Ack(id, 7) {
+		t.Error("the user could not acknowledge the alert")
+	}
+	if e.Ack(id, 7) {
+		t.Error("the alert was acknowledged twice")
+	}
+	if e.Ack("999", 7) {
+		t.Error("an unknown alert was acknowledged")
+	}
+}
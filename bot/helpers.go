@@ -1,11 +1,13 @@
 package bot
 
 import (
+	"errors"
 	"fmt"
 	"log/slog"
 	"strconv"
 	"strings"
 	"wfsync/entity"
+	"wfsync/lib/audit"
 	"wfsync/lib/sl"
 
 	tgbotapi "github.com/PaulSonOfLars/gotgbot/v2"
@@ -15,37 +17,86 @@ import (
 const tgMaxMessageLen = 4096
 
 func (t *TgBot) plainResponse(chatId int64, text string) {
+	t.sendToThread(chatId, 0, text)
+}
+
+// sendToThread sends a MarkdownV2 message into a forum thread of a group chat; thread 0
+// is the chat itself. Returns the sent message when the text went out as a single
+// message, nil when it failed or was split.
+func (t *TgBot) sendToThread(chatId, threadId int64, text string) *tgbotapi.Message {
 	if text == "" {
 		t.log.With("id", chatId).Debug("empty message")
-		return
+		return nil
 	}
 
-	for _, part := range splitMessage(text, tgMaxMessageLen) {
-		_, err := t.api.SendMessage(chatId, part, &tgbotapi.SendMessageOpts{
-			ParseMode: "MarkdownV2",
+	parts := splitMessage(text, tgMaxMessageLen)
+	var sent *tgbotapi.Message
+	for _, part := range parts {
+		msg, err := t.api.SendMessage(chatId, part, &tgbotapi.SendMessageOpts{
+			MessageThreadId: threadId,
+			ParseMode:       "MarkdownV2",
 		})
 		if err != nil {
 			t.log.With(slog.Int64("id", chatId)).Warn("sending message", sl.Err(err))
 			// Fallback: try without markdown, still respecting the limit
-			_, err = t.api.SendMessage(chatId, part, &tgbotapi.SendMessageOpts{})
+			msg, err = t.api.SendMessage(chatId, stripMarkdown(part), &tgbotapi.SendMessageOpts{MessageThreadId: threadId})
 			if err != nil {
 				t.log.With(slog.Int64("id", chatId)).Error("sending safe message", sl.Err(err))
 			}
 		}
+		sent = msg
+	}
+	if len(parts) != 1 {
+		return nil
 	}
+	return sent
 }
 
+// Sanitize escapes the MarkdownV2 reserved characters of input. A reserved character
+// already preceded by a backslash is left as it is, so sanitizing escaped text again
+// does not change it; a backslash before any other character is escaped.
 func Sanitize(input string) string {
 	reservedChars := "\\_{}#+-.!|()[]=*"
-	sanitized := ""
-	for _, char := range input {
+	runes := []rune(input)
+	var sb strings.Builder
+	sb.Grow(len(input))
+	for i := 0; i < len(runes); i++ {
+		char := runes[i]
+		if char == '\\' && i+1 < len(runes) && strings.ContainsRune(reservedChars, runes[i+1]) {
+			sb.WriteRune(char)
+			sb.WriteRune(runes[i+1])
+			i++
+			continue
+		}
 		if strings.ContainsRune(reservedChars, char) {
-			sanitized += "\\" + string(char)
-		} else {
-			sanitized += string(char)
+			sb.WriteRune('\\')
+		}
+		sb.WriteRune(char)
+	}
+	return sb.String()
+}
+
+// markdownMarkers are the MarkdownV2 formatting characters dropped by stripMarkdown.
+const markdownMarkers = "*_~`|"
+
+// stripMarkdown turns a MarkdownV2 message into the plain text a user would have read:
+// formatting markers are dropped and escaped characters lose their backslash.
+func stripMarkdown(text string) string {
+	runes := []rune(text)
+	var sb strings.Builder
+	sb.Grow(len(text))
+	for i := 0; i < len(runes); i++ {
+		char := runes[i]
+		switch {
+		case char == '\\' && i+1 < len(runes):
+			i++
+			sb.WriteRune(runes[i])
+		case strings.ContainsRune(markdownMarkers, char):
+		default:
+			sb.WriteRune(char)
 		}
 	}
-	return sanitized
+	return sb.String()
 }
 
 func (t *TgBot) requireAdmin(chatId int64) bool {
@@ -150,7 +201,7 @@ func (t *TgBot) sendWithKeyboard(chatId int64, text string, keyboard tgbotapi.In
 	if err != nil {
 		t.log.With(slog.Int64("id", chatId)).Warn("sending message with keyboard", sl.Err(err))
 		// Fallback: try without markdown
-		_, err = t.api.SendMessage(chatId, text, &tgbotapi.SendMessageOpts{
+		_, err = t.api.SendMessage(chatId, stripMarkdown(text), &tgbotapi.SendMessageOpts{
 			ReplyMarkup: keyboard,
 		})
 		if err != nil {
@@ -243,5 +294,78 @@ func (t *TgBot) reportError(chatId int64, command string, err error) {
 		"Command `%s` failed\nUser: `%d`\nError: `%s`",
 		Sanitize(command), chatId, Sanitize(err.Error()),
 	))
-	t.plainResponse(chatId, "Something went wrong\\. Please try again later\\.")
+	t.plainResponse(chatId, tr(t.lang(chatId), msgSomethingWrong))
+}
+
+// errLastAdmin refuses a role change that would leave the bot without an admin.
+var errLastAdmin = errors.New("cannot remove the last admin")
+
+// setRole changes a user's role on behalf of actorId and records the change in the
+// audit log with the role the user had before. Taking the role away from the only
+// admin fails with errLastAdmin; the check reads the database, not the user cache,
+// and role changes are serialized so two demotions cannot both pass it.
+func (t *TgBot) setRole(actorId, targetId int64, role entity.TelegramRole) error {
+	t.roleMu.Lock()
+	defer t.roleMu.Unlock()
+
+	before, admins, err := t.roleState(targetId)
+	if err != nil {
+		return err
+	}
+	if before == entity.RoleAdmin && role != entity.RoleAdmin && admins <= 1 {
+		return errLastAdmin
+	}
+	if err = t.db.SetTelegramRole(targetId, role); err != nil {
+		return err
+	}
+	t.auditLog.Record(audit.TelegramActor(actorId), entity.AuditRoleChange, audit.TelegramActor(targetId),
+		map[string]interface{}{"role": before}, map[string]interface{}{"role": role})
+	return nil
+}
+
+// roleState reads the stored role of a user and the number of admins from the database.
+func (t *TgBot) roleState(telegramId int64) (entity.TelegramRole, int, error) {
+	users, err := t.db.GetAllTelegramUsers()
+	if err != nil {
+		return entity.RoleNone, 0, fmt.Errorf("read users: %w", err)
+	}
+	var role entity.TelegramRole
+	admins := 0
+	for _, user := range users {
+		if user.TelegramId == telegramId {
+			role = user.TelegramRole
+		}
+		if user.IsAdmin() {
+			admins++
+		}
+	}
+	return role, admins, nil
+}
+
+// defaultTopics returns the configured topic subscriptions for a newly approved or
+// promoted user of the given role, dropping topics the role may not subscribe to.
+// Returns nil, meaning all topics of the role, when none are configured.
+func (t *TgBot) defaultTopics(role entity.TelegramRole) []string {
+	configured := t.config.UserTopics
+	if role == entity.RoleAdmin {
+		configured = t.config.AdminTopics
+	}
+	var topics []string
+	for _, topic := range configured {
+		topic = strings.ToLower(strings.TrimSpace(topic))
+		if entity.IsTopicAllowedForRole(topic, role) {
+			topics = append(topics, topic)
+		}
+	}
+	return topics
+}
+
+// setDefaultTopics replaces the user's topic subscriptions with the defaults of the role.
+func (t *TgBot) setDefaultTopics(telegramId int64, role entity.TelegramRole) {
+	if err := t.db.SetTelegramTopics(telegramId, t.defaultTopics(role)); err != nil {
+		t.log.With(
+			slog.Int64("user_id", telegramId),
+			sl.Err(err),
+		).Warn("set default topics")
+	}
 }
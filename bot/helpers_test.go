@@ -0,0 +1,113 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+
+	tgbotapi "github.com/PaulSonOfLars/gotgbot/v2"
+)
+
+// TestSanitize checks the escaping of MarkdownV2 punctuation and literal backslashes, and
+// that sanitizing already escaped text leaves it unchanged.
+func TestSanitize(t *testing.T) {
+	cases := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"plain", "hello world", "hello world"},
+		{"punctuation", "order #12 (paid): 10.50-1=9.50!", "order \\#12 \\(paid\\): 10\\.50\\-1\\=9\\.50\\!"},
+		{"markdown", "*bold* _it_ [link] {x} a|b +1", "\\*bold\\* \\_it\\_ \\[link\\] \\{x\\} a\\|b \\+1"},
+		{"already escaped", "done\\. \\(1\\)", "done\\. \\(1\\)"},
+		{"escaped backslash", "C:\\\\dir", "C:\\\\dir"},
+		{"lone backslash", "C:\\dir", "C:\\\\dir"},
+		{"trailing backslash", "path\\", "path\\\\"},
+		{"mixed", "a\\.b.c", "a\\.b\\.c"},
+		{"unicode", "Zamówienie 7.", "Zamówienie 7\\."},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := Sanitize(tc.input)
+			if got != tc.want {
+				t.Errorf("Sanitize(%q) = %q, want %q", tc.input, got, tc.want)
+			}
+			if again := Sanitize(got); again != got {
+				t.Errorf("Sanitize(%q) = %q, not idempotent", got, again)
+			}
+		})
+	}
+}
+
+// markdownRejectingClient fails every MarkdownV2 message the way Telegram does when the
+// entities do not parse, and accepts everything else.
+type markdownRejectingClient struct {
+	fakeBotClient
+}
+
+func (c *markdownRejectingClient) RequestWithContext(ctx context.Context, token string, method string, params map[string]string, data map[string]tgbotapi.FileReader, opts *tgbotapi.RequestOpts) (json.RawMessage, error) {
+	raw, err := c.fakeBotClient.RequestWithContext(ctx, token, method, params, data, opts)
+	if params["parse_mode"] == "MarkdownV2" {
+		return nil, errors.New("Bad Request: can't parse entities: character '.' is reserved")
+	}
+	return raw, err
+}
+
+// TestPlainTextFallback checks that a message Telegram refuses to parse as MarkdownV2 is
+// sent again as clean plain text: no formatting markers, no escapes, no error text.
+func TestPlainTextFallback(t *testing.T) {
+	const text = "*Order* 12\\.5 \\(`paid`\\) by _bob_ ~old~ ||spoiler|| C:\\\\dir."
+	const want = "Order 12.5 (paid) by bob old spoiler C:\\dir."
+
+	cases := []struct {
+		name string
+		send func(bot *TgBot)
+	}{
+		{"plain response", func(bot *TgBot) { bot.plainResponse(7, text) }},
+		{"with keyboard", func(bot *TgBot) { bot.sendWithKeyboard(7, text, buildAckKeyboard("1", defaultLanguage)) }},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := &markdownRejectingClient{}
+			bot := &TgBot{
+				log: slog.New(slog.NewTextHandler(io.Discard, nil)),
+				api: &tgbotapi.Bot{Token: "token", BotClient: client},
+			}
+
+			tc.send(bot)
+			if len(client.params) != 2 {
+				t.Fatalf("bot calls = %v, want the message and its fallback", client.methods)
+			}
+			fallback := client.params[1]
+			if fallback["parse_mode"] != "" {
+				t.Errorf("fallback parse_mode = %q, want none", fallback["parse_mode"])
+			}
+			if fallback["text"] != want {
+				t.Errorf("fallback text = %q, want %q", fallback["text"], want)
+			}
+		})
+	}
+}
+
+// TestStripMarkdown checks marker removal and unescaping on their own.
+func TestStripMarkdown(t *testing.T) {
+	cases := []struct {
+		input string
+		want  string
+	}{
+		{"plain", "plain"},
+		{"*Users* \\(2 total\\)", "Users (2 total)"},
+		{"`/export [json\\|csv]` \\- Export", "/export [json|csv] - Export"},
+		{"a\\\\b", "a\\b"},
+		{"trailing\\", "trailing\\"},
+		{Sanitize("C:\\tmp *x*"), "C:\\tmp *x*"},
+	}
+	for _, tc := range cases {
+		if got := stripMarkdown(tc.input); got != tc.want {
+			t.Errorf("stripMarkdown(%q) = %q, want %q", tc.input, got, tc.want)
+		}
+	}
+}
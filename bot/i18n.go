@@ -0,0 +1,410 @@
+package bot
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Keys of the replies to user commands found in the message catalogs.
+const (
+	msgAdminRequired         = "admin_required"
+	msgApprovalRequired      = "approval_required"
+	msgNotificationsEnabled  = "notifications_enabled"
+	msgNotificationsDisabled = "notifications_disabled"
+	msgAwaitingApproval      = "awaiting_approval"
+	msgWelcomeApproved       = "welcome_approved"
+	msgRegistrationReceived  = "registration_received"
+	msgSubscribeUsage        = "subscribe_usage"
+	msgUnsubscribeUsage      = "unsubscribe_usage"
+	msgInvalidTopic          = "invalid_topic"
+	msgSubscribedAll         = "subscribed_all"
+	msgSubscribed            = "subscribed"
+	msgUnsubscribedAll       = "unsubscribed_all"
+	msgUnsubscribed          = "unsubscribed"
+	msgMuteUsage             = "mute_usage"
+	msgInvalidDuration       = "invalid_duration"
+	msgUnmuted               = "unmuted"
+	msgMuted                 = "muted"
+	msgDigestEmpty           = "digest_empty"
+	msgDigestPreview         = "digest_preview"
+	msgInvalidInterval       = "invalid_interval"
+	msgDigestSet             = "digest_set"
+	msgTimezoneUsage         = "timezone_usage"
+	msgInvalidTimezone       = "invalid_timezone"
+	msgTimezoneSet           = "timezone_set"
+	msgSomethingWrong        = "something_wrong"
+	msgStatus                = "status"
+	msgStatusAdmin           = "status_admin"
+	msgYes                   = "yes"
+	msgNo                    = "no"
+	msgAllTopics             = "all_topics"
+	msgHelp                  = "help"
+	msgHelpUser              = "help_user"
+	msgHelpAdmin             = "help_admin"
+	msgTopicsPrompt          = "topics_prompt"
+	msgTierPrompt            = "tier_prompt"
+	msgLevelPrompt           = "level_prompt"
+	msgAccessApproved        = "access_approved"
+	msgAccessRevoked         = "access_revoked"
+	msgApprovedBy            = "approved_by"
+	msgRevokedBy             = "revoked_by"
+	msgCancelled             = "cancelled"
+	msgUserRevoked           = "user_revoked"
+	msgUserPromoted          = "user_promoted"
+	msgNoUsers               = "no_users"
+	msgUsage                 = "usage"
+	msgUserNotFound          = "user_not_found"
+	msgUserApproved          = "user_approved"
+	msgPendingUser           = "pending_user"
+	msgConfirmRevoke         = "confirm_revoke"
+	msgConfirmAdmin          = "confirm_admin"
+	msgMustBeApproved        = "must_be_approved"
+	msgPromotedToAdmin       = "promoted_to_admin"
+	msgLastAdmin             = "last_admin"
+	msgInviteCode            = "invite_code"
+	msgInviteUsed            = "invite_used"
+	msgNoRetryJobs           = "no_retry_jobs"
+	msgUsersReloaded         = "users_reloaded"
+	msgFeaturesUnconfigured  = "features_unconfigured"
+	msgUnknownFeature        = "unknown_feature"
+	msgFeatureSwitched       = "feature_switched"
+	msgOrderNotFound         = "order_not_found"
+	msgOrderNoInvoice        = "order_no_invoice"
+	msgAlertUnacknowledged   = "alert_unacknowledged"
+	msgAlertReport           = "alert_report"
+)
+
+// Keys of the inline keyboard labels and callback query answers, which are plain text.
+const (
+	btnSubscribeAll     = "btn_subscribe_all"
+	btnUnsubscribeAll   = "btn_unsubscribe_all"
+	btnRealtime         = "btn_realtime"
+	btnCritical         = "btn_critical"
+	btnDigest           = "btn_digest"
+	btnTopics           = "btn_topics"
+	btnTier             = "btn_tier"
+	btnLevel            = "btn_level"
+	btnApprove          = "btn_approve"
+	btnRevoke           = "btn_revoke"
+	btnConfirm          = "btn_confirm"
+	btnCancel           = "btn_cancel"
+	btnAck              = "btn_ack"
+	ansNotAuthorized    = "ans_not_authorized"
+	ansAdminRequired    = "ans_admin_required"
+	ansUserNotFound     = "ans_user_not_found"
+	ansInvalidUserId    = "ans_invalid_user_id"
+	ansInvalidTopic     = "ans_invalid_topic"
+	ansInvalidTier      = "ans_invalid_tier"
+	ansInvalidLevel     = "ans_invalid_level"
+	ansInvalidOption    = "ans_invalid_option"
+	ansError            = "ans_error"
+	ansSubscribedAll    = "ans_subscribed_all"
+	ansUnsubscribedAll  = "ans_unsubscribed_all"
+	ansSubscribed       = "ans_subscribed"
+	ansUnsubscribed     = "ans_unsubscribed"
+	ansTierSet          = "ans_tier_set"
+	ansLevelSet         = "ans_level_set"
+	ansLastAdmin        = "ans_last_admin"
+	ansApprovalRequired = "ans_approval_required"
+	ansUserApproved     = "ans_user_approved"
+	ansUserRevoked      = "ans_user_revoked"
+	ansCancelled        = "ans_cancelled"
+	ansDone             = "ans_done"
+	ansAlertGone        = "ans_alert_gone"
+	ansAcknowledged     = "ans_acknowledged"
+)
+
+// messageCatalogs holds the replies to user commands per language. Texts are MarkdownV2
+// with fmt verbs, except the plain text button labels and callback answers; the
+// arguments filled in must already be sanitized.
+var messageCatalogs = map[string]map[string]string{
+	"en": {
+		msgAdminRequired:         "Admin access required\\.",
+		msgApprovalRequired:      "You need to be approved first\\.",
+		msgNotificationsEnabled:  "Notifications ENABLED",
+		msgNotificationsDisabled: "Notifications DISABLED",
+		msgAwaitingApproval:      "Your registration is awaiting admin approval\\.",
+		msgWelcomeApproved:       "Welcome\\! You have been approved\\. Notifications are now ENABLED\\.",
+		msgRegistrationReceived:  "Registration received\\. An admin will review your request\\.",
+		msgSubscribeUsage:        "Usage: `/subscribe <topic|all>`\nAvailable topics: %s",
+		msgUnsubscribeUsage:      "Usage: `/unsubscribe <topic|all>`\nAvailable topics: %s",
+		msgInvalidTopic:          "Invalid topic: `%s`\nAvailable: %s",
+		msgSubscribedAll:         "Subscribed to *all* topics\\.",
+		msgSubscribed:            "Subscribed to `%s`",
+		msgUnsubscribedAll:       "Unsubscribed from all topics\\.",
+		msgUnsubscribed:          "Unsubscribed from `%s`",
+		msgMuteUsage:             "Usage: `/mute <topic> <duration|off>`, e\\.g\\. `/mute payment 4h`",
+		msgInvalidDuration:       "Invalid duration: `%s`, use e\\.g\\. `30m` or `4h`",
+		msgUnmuted:               "Unmuted `%s`",
+		msgMuted:                 "Muted `%s` until %s",
+		msgDigestEmpty:           "Your digest is empty, it is sent every %s\\.\nUse `/digest <interval|default>` to change how often, e\\.g\\. `/digest 1h`",
+		msgDigestPreview:         "Not sent yet, your digest goes out every %s\\. Use `/digest now` to send it now\\.",
+		msgInvalidInterval:       "Invalid interval: `%s`, use at least `1m`, e\\.g\\. `1h`",
+		msgDigestSet:             "Digest interval set to %s",
+		msgTimezoneUsage:         "Usage: `/timezone <zone|default>`, e\\.g\\. `/timezone Europe/Warsaw`",
+		msgInvalidTimezone:       "Unknown timezone: `%s`, use a name like `Europe/Warsaw`",
+		msgTimezoneSet:           "Timezone set to %s, your time is %s",
+		msgSomethingWrong:        "Something went wrong\\. Please try again later\\.",
+		msgStatus:                "*Your Settings*\nEnabled: `%s`\nTier: `%s`\nTopics: `%s`",
+		msgStatusAdmin:           "*Your Settings*\nRole: `%s`\nEnabled: `%s`\nLog level: `%s`\nTier: `%s`\nTopics: `%s`",
+		msgYes:                   "yes",
+		msgNo:                    "no",
+		msgAllTopics:             "all",
+		msgHelp: "*Available Commands*\n\n" +
+			"`/start` \\- Register or enable notifications\n" +
+			"`/help` \\- Show this help\n",
+		msgHelpUser: "\n*User Commands:*\n" +
+			"`/stop` \\- Disable notifications\n" +
+			"`/topics` \\- Manage topic subscriptions\n" +
+			"`/tier` \\- Set notification tier\n" +
+			"`/digest [now|<interval>|default]` \\- Preview or send your digest, or set its interval\n" +
+			"`/mute <topic> <duration|off>` \\- Mute a topic for a while\n" +
+			"`/timezone <zone|default>` \\- Set your timezone\n" +
+			"`/status` \\- Show your settings\n",
+		msgHelpAdmin: "\n*Admin Commands:*\n" +
+			"`/level` \\- Set log level\n" +
+			"`/users` \\- List all users\n" +
+			"`/approve <id|@user>` \\- Approve a user\n" +
+			"`/revoke <id|@user>` \\- Revoke a user\n" +
+			"`/admin <id|@user>` \\- Promote to admin\n" +
+			"`/invite` \\- Generate invite code\n" +
+			"`/retries` \\- List pending invoice retry jobs\n" +
+			"`/metrics` \\- Show operational counters\n" +
+			"`/reload` \\- Reload users from the database\n" +
+			"`/export [json|csv]` \\- Export the user list as a document\n" +
+			"`/features` \\- Show subsystem feature flags\n" +
+			"`/feature <name> on|off` \\- Switch a subsystem on or off\n" +
+			"`/order <order_id>` \\- Show an order's payment and invoice\n" +
+			"`/invoice <order_id>` \\- Send an order's invoice PDF\n",
+		msgTopicsPrompt:         "*Topic subscriptions*\nTap a topic to toggle:",
+		msgTierPrompt:           "*Notification tier*\nSelect delivery mode:",
+		msgLevelPrompt:          "*Log level*\nSelect minimum level:",
+		msgAccessApproved:       "Your registration has been approved\\! Notifications are now enabled\\.",
+		msgAccessRevoked:        "Your access has been revoked\\.",
+		msgApprovedBy:           "%s\n\n✓ Approved by %s",
+		msgRevokedBy:            "%s\n\n✗ Revoked by %s",
+		msgCancelled:            "Cancelled\\.",
+		msgUserRevoked:          "User %s revoked\\.",
+		msgUserPromoted:         "User %s promoted to admin\\.",
+		msgNoUsers:              "No telegram users found\\.",
+		msgUsage:                "Usage: `%s`",
+		msgUserNotFound:         "User not found: %s",
+		msgUserApproved:         "User %s approved\\.",
+		msgPendingUser:          "Pending: %s",
+		msgConfirmRevoke:        "Revoke access of %s?",
+		msgConfirmAdmin:         "Promote %s to admin?",
+		msgMustBeApproved:       "User must be approved first\\.",
+		msgPromotedToAdmin:      "You have been promoted to admin\\!",
+		msgLastAdmin:            "Cannot remove the last admin\\. Promote another admin first\\.",
+		msgInviteCode:           "Invite code: `%s`\nDeep link: %s",
+		msgInviteUsed:           "Your invite code `%s` was used by @%s \\(%d\\)",
+		msgNoRetryJobs:          "No pending retry jobs\\.",
+		msgUsersReloaded:        "Users reloaded: *%d* total, *%d* active, *%d* pending, *%d* admins",
+		msgFeaturesUnconfigured: "Feature flags are not configured\\.",
+		msgUnknownFeature:       "Unknown feature: %s",
+		msgFeatureSwitched:      "Feature *%s* switched %s\\.",
+		msgOrderNotFound:        "Order not found: %s",
+		msgOrderNoInvoice:       "Order %s has no invoice\\.",
+		msgAlertUnacknowledged:  "*Unacknowledged alert*\n%s",
+		msgAlertReport:          "*Alert not acknowledged* by %s since %s:\n%s",
+		btnSubscribeAll:         "Subscribe all",
+		btnUnsubscribeAll:       "Unsubscribe all",
+		btnRealtime:             "Realtime",
+		btnCritical:             "Critical only",
+		btnDigest:               "Digest",
+		btnTopics:               "Topics",
+		btnTier:                 "Tier",
+		btnLevel:                "Level",
+		btnApprove:              "Approve ✓",
+		btnRevoke:               "Revoke ✗",
+		btnConfirm:              "Confirm ✓",
+		btnCancel:               "Cancel ✗",
+		btnAck:                  "Ack ✓",
+		ansNotAuthorized:        "Not authorized",
+		ansAdminRequired:        "Admin access required",
+		ansUserNotFound:         "User not found",
+		ansInvalidUserId:        "Invalid user ID",
+		ansInvalidTopic:         "Invalid topic",
+		ansInvalidTier:          "Invalid tier",
+		ansInvalidLevel:         "Invalid level",
+		ansInvalidOption:        "Invalid option",
+		ansError:                "Error occurred",
+		ansSubscribedAll:        "Subscribed to all topics",
+		ansUnsubscribedAll:      "Unsubscribed from all topics",
+		ansSubscribed:           "Subscribed to %s",
+		ansUnsubscribed:         "Unsubscribed from %s",
+		ansTierSet:              "Tier set to %s",
+		ansLevelSet:             "Level set to %s",
+		ansLastAdmin:            "Cannot remove the last admin",
+		ansApprovalRequired:     "User must be approved first",
+		ansUserApproved:         "User approved",
+		ansUserRevoked:          "User revoked",
+		ansCancelled:            "Cancelled",
+		ansDone:                 "Done",
+		ansAlertGone:            "Alert already escalated or acknowledged",
+		ansAcknowledged:         "Acknowledged",
+	},
+	"pl": {
+		msgAdminRequired:         "Wymagane uprawnienia administratora\\.",
+		msgApprovalRequired:      "Twoje konto musi najpierw zostać zatwierdzone\\.",
+		msgNotificationsEnabled:  "Powiadomienia WŁĄCZONE",
+		msgNotificationsDisabled: "Powiadomienia WYŁĄCZONE",
+		msgAwaitingApproval:      "Twoja rejestracja czeka na zatwierdzenie przez administratora\\.",
+		msgWelcomeApproved:       "Witaj\\! Twoje konto zostało zatwierdzone\\. Powiadomienia są WŁĄCZONE\\.",
+		msgRegistrationReceived:  "Rejestracja przyjęta\\. Administrator rozpatrzy Twoją prośbę\\.",
+		msgSubscribeUsage:        "Użycie: `/subscribe <temat|all>`\nDostępne tematy: %s",
+		msgUnsubscribeUsage:      "Użycie: `/unsubscribe <temat|all>`\nDostępne tematy: %s",
+		msgInvalidTopic:          "Nieznany temat: `%s`\nDostępne: %s",
+		msgSubscribedAll:         "Subskrybujesz *wszystkie* tematy\\.",
+		msgSubscribed:            "Subskrybujesz `%s`",
+		msgUnsubscribedAll:       "Anulowano subskrypcję wszystkich tematów\\.",
+		msgUnsubscribed:          "Anulowano subskrypcję `%s`",
+		msgMuteUsage:             "Użycie: `/mute <temat> <czas|off>`, np\\. `/mute payment 4h`",
+		msgInvalidDuration:       "Nieprawidłowy czas: `%s`, użyj np\\. `30m` lub `4h`",
+		msgUnmuted:               "Wyciszenie `%s` wyłączone",
+		msgMuted:                 "Wyciszono `%s` do %s",
+		msgDigestEmpty:           "Twoje podsumowanie jest puste, wysyłamy je co %s\\.\nUżyj `/digest <interwał|default>`, aby zmienić częstotliwość, np\\. `/digest 1h`",
+		msgDigestPreview:         "Jeszcze niewysłane, podsumowanie wychodzi co %s\\. Użyj `/digest now`, aby wysłać je teraz\\.",
+		msgInvalidInterval:       "Nieprawidłowy interwał: `%s`, użyj co najmniej `1m`, np\\. `1h`",
+		msgDigestSet:             "Interwał podsumowania ustawiony na %s",
+		msgTimezoneUsage:         "Użycie: `/timezone <strefa|default>`, np\\. `/timezone Europe/Warsaw`",
+		msgInvalidTimezone:       "Nieznana strefa czasowa: `%s`, użyj nazwy jak `Europe/Warsaw`",
+		msgTimezoneSet:           "Strefa czasowa ustawiona na %s, Twoja godzina to %s",
+		msgSomethingWrong:        "Coś poszło nie tak\\. Spróbuj ponownie później\\.",
+		msgStatus:                "*Twoje ustawienia*\nWłączone: `%s`\nTryb: `%s`\nTematy: `%s`",
+		msgStatusAdmin:           "*Twoje ustawienia*\nRola: `%s`\nWłączone: `%s`\nPoziom logów: `%s`\nTryb: `%s`\nTematy: `%s`",
+		msgYes:                   "tak",
+		msgNo:                    "nie",
+		msgAllTopics:             "wszystkie",
+		msgHelp: "*Dostępne polecenia*\n\n" +
+			"`/start` \\- Rejestracja lub włączenie powiadomień\n" +
+			"`/help` \\- Ta pomoc\n",
+		msgHelpUser: "\n*Polecenia użytkownika:*\n" +
+			"`/stop` \\- Wyłącz powiadomienia\n" +
+			"`/topics` \\- Zarządzaj subskrypcjami tematów\n" +
+			"`/tier` \\- Ustaw tryb powiadomień\n" +
+			"`/digest [now|<interwał>|default]` \\- Podgląd lub wysyłka podsumowania albo zmiana jego interwału\n" +
+			"`/mute <temat> <czas|off>` \\- Wycisz temat na jakiś czas\n" +
+			"`/timezone <strefa|default>` \\- Ustaw strefę czasową\n" +
+			"`/status` \\- Pokaż swoje ustawienia\n",
+		msgHelpAdmin: "\n*Polecenia administratora:*\n" +
+			"`/level` \\- Ustaw poziom logów\n" +
+			"`/users` \\- Lista użytkowników\n" +
+			"`/approve <id|@user>` \\- Zatwierdź użytkownika\n" +
+			"`/revoke <id|@user>` \\- Odbierz dostęp użytkownikowi\n" +
+			"`/admin <id|@user>` \\- Nadaj uprawnienia administratora\n" +
+			"`/invite` \\- Wygeneruj kod zaproszenia\n" +
+			"`/retries` \\- Lista oczekujących ponowień faktur\n" +
+			"`/metrics` \\- Pokaż liczniki operacyjne\n" +
+			"`/reload` \\- Wczytaj użytkowników z bazy danych\n" +
+			"`/export [json|csv]` \\- Eksportuj listę użytkowników jako dokument\n" +
+			"`/features` \\- Pokaż przełączniki podsystemów\n" +
+			"`/feature <nazwa> on|off` \\- Włącz lub wyłącz podsystem\n" +
+			"`/order <order_id>` \\- Pokaż płatność i fakturę zamówienia\n" +
+			"`/invoice <order_id>` \\- Wyślij PDF faktury zamówienia\n",
+		msgTopicsPrompt:         "*Subskrypcje tematów*\nDotknij tematu, aby go przełączyć:",
+		msgTierPrompt:           "*Tryb powiadomień*\nWybierz sposób dostarczania:",
+		msgLevelPrompt:          "*Poziom logów*\nWybierz minimalny poziom:",
+		msgAccessApproved:       "Twoja rejestracja została zatwierdzona\\! Powiadomienia są włączone\\.",
+		msgAccessRevoked:        "Twój dostęp został odebrany\\.",
+		msgApprovedBy:           "%s\n\n✓ Zatwierdził\\(a\\) %s",
+		msgRevokedBy:            "%s\n\n✗ Odebrał\\(a\\) %s",
+		msgCancelled:            "Anulowano\\.",
+		msgUserRevoked:          "Odebrano dostęp użytkownikowi %s\\.",
+		msgUserPromoted:         "Użytkownik %s jest teraz administratorem\\.",
+		msgNoUsers:              "Nie znaleziono użytkowników Telegrama\\.",
+		msgUsage:                "Użycie: `%s`",
+		msgUserNotFound:         "Nie znaleziono użytkownika: %s",
+		msgUserApproved:         "Użytkownik %s został zatwierdzony\\.",
+		msgPendingUser:          "Oczekuje: %s",
+		msgConfirmRevoke:        "Odebrać dostęp użytkownikowi %s?",
+		msgConfirmAdmin:         "Nadać użytkownikowi %s uprawnienia administratora?",
+		msgMustBeApproved:       "Użytkownik musi najpierw zostać zatwierdzony\\.",
+		msgPromotedToAdmin:      "Nadano Ci uprawnienia administratora\\!",
+		msgLastAdmin:            "Nie można usunąć ostatniego administratora\\. Najpierw mianuj innego administratora\\.",
+		msgInviteCode:           "Kod zaproszenia: `%s`\nLink: %s",
+		msgInviteUsed:           "Twój kod zaproszenia `%s` został użyty przez @%s \\(%d\\)",
+		msgNoRetryJobs:          "Brak oczekujących ponowień\\.",
+		msgUsersReloaded:        "Wczytano użytkowników: *%d* łącznie, *%d* aktywnych, *%d* oczekujących, *%d* administratorów",
+		msgFeaturesUnconfigured: "Przełączniki funkcji nie są skonfigurowane\\.",
+		msgUnknownFeature:       "Nieznana funkcja: %s",
+		msgFeatureSwitched:      "Funkcja *%s* przełączona na %s\\.",
+		msgOrderNotFound:        "Nie znaleziono zamówienia: %s",
+		msgOrderNoInvoice:       "Zamówienie %s nie ma faktury\\.",
+		msgAlertUnacknowledged:  "*Niepotwierdzony alert*\n%s",
+		msgAlertReport:          "*Alert niepotwierdzony* przez %s od %s:\n%s",
+		btnSubscribeAll:         "Subskrybuj wszystkie",
+		btnUnsubscribeAll:       "Anuluj wszystkie",
+		btnRealtime:             "Na bieżąco",
+		btnCritical:             "Tylko krytyczne",
+		btnDigest:               "Podsumowanie",
+		btnTopics:               "Tematy",
+		btnTier:                 "Tryb",
+		btnLevel:                "Poziom",
+		btnApprove:              "Zatwierdź ✓",
+		btnRevoke:               "Odbierz ✗",
+		btnConfirm:              "Potwierdź ✓",
+		btnCancel:               "Anuluj ✗",
+		btnAck:                  "Potwierdzam ✓",
+		ansNotAuthorized:        "Brak uprawnień",
+		ansAdminRequired:        "Wymagane uprawnienia administratora",
+		ansUserNotFound:         "Nie znaleziono użytkownika",
+		ansInvalidUserId:        "Nieprawidłowy identyfikator użytkownika",
+		ansInvalidTopic:         "Nieznany temat",
+		ansInvalidTier:          "Nieznany tryb",
+		ansInvalidLevel:         "Nieznany poziom",
+		ansInvalidOption:        "Nieznana opcja",
+		ansError:                "Wystąpił błąd",
+		ansSubscribedAll:        "Subskrybujesz wszystkie tematy",
+		ansUnsubscribedAll:      "Anulowano subskrypcję wszystkich tematów",
+		ansSubscribed:           "Subskrybujesz %s",
+		ansUnsubscribed:         "Anulowano subskrypcję %s",
+		ansTierSet:              "Tryb ustawiony na %s",
+		ansLevelSet:             "Poziom ustawiony na %s",
+		ansLastAdmin:            "Nie można usunąć ostatniego administratora",
+		ansApprovalRequired:     "Użytkownik musi najpierw zostać zatwierdzony",
+		ansUserApproved:         "Użytkownik zatwierdzony",
+		ansUserRevoked:          "Dostęp odebrany",
+		ansCancelled:            "Anulowano",
+		ansDone:                 "Gotowe",
+		ansAlertGone:            "Alert został już eskalowany lub potwierdzony",
+		ansAcknowledged:         "Potwierdzono",
+	},
+}
+
+// supportedLanguage maps a language tag, such as Telegram's language_code "pl" or
+// "pl-PL", to a language with a message catalog. Returns "" when there is none.
+func supportedLanguage(tag string) string {
+	lang, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+	if _, ok := messageCatalogs[lang]; !ok {
+		return ""
+	}
+	return lang
+}
+
+// tr returns the reply for key in the language, filled in with args. Keys missing from
+// the language's catalog fall back to English.
+func tr(lang, key string, args ...any) string {
+	text, ok := messageCatalogs[lang][key]
+	if !ok {
+		text = messageCatalogs[defaultLanguage][key]
+	}
+	if len(args) == 0 {
+		return text
+	}
+	return fmt.Sprintf(text, args...)
+}
+
+// lang returns the language of the user's replies: their own language, the configured
+// language, or English.
+func (t *TgBot) lang(chatId int64) string {
+	if user := t.findUser(chatId); user != nil {
+		if lang := supportedLanguage(user.Language); lang != "" {
+			return lang
+		}
+	}
+	if lang := supportedLanguage(t.config.Language); lang != "" {
+		return lang
+	}
+	return defaultLanguage
+}
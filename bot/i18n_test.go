@@ -0,0 +1,175 @@
+package bot
+
+import (
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"wfsync/entity"
+
+	tgbotapi "github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+)
+
+// TestMessageCatalogsComplete checks that every language translates every English reply
+// and keeps its placeholders.
+func TestMessageCatalogsComplete(t *testing.T) {
+	for lang, catalog := range messageCatalogs {
+		if len(catalog) != len(messageCatalogs[defaultLanguage]) {
+			t.Errorf("%s: %d messages, want %d", lang, len(catalog), len(messageCatalogs[defaultLanguage]))
+		}
+		for key, en := range messageCatalogs[defaultLanguage] {
+			text, ok := catalog[key]
+			if !ok {
+				t.Errorf("%s: missing %q", lang, key)
+				continue
+			}
+			if strings.Count(text, "%s") != strings.Count(en, "%s") {
+				t.Errorf("%s: %q has other placeholders than in English: %q", lang, key, text)
+			}
+		}
+	}
+}
+
+// TestSupportedLanguage checks the mapping of Telegram language codes to catalogs.
+func TestSupportedLanguage(t *testing.T) {
+	cases := map[string]string{"pl": "pl", "pl-PL": "pl", "EN": "en", "en-GB": "en", "de": "", "": ""}
+	for tag, want := range cases {
+		if got := supportedLanguage(tag); got != want {
+			t.Errorf("supportedLanguage(%q) = %q, want %q", tag, got, want)
+		}
+	}
+}
+
+// TestLocalizedReplies runs user commands as a Polish, an English and a user without a
+// language, the latter following the configured language. Keyboard labels follow the
+// language of the reply.
+func TestLocalizedReplies(t *testing.T) {
+	cases := []struct {
+		name       string
+		language   string
+		config     string
+		text       string
+		want       string
+		wantMarkup string
+	}{
+		{"polish usage", "pl", "", "/mute", "Użycie: `/mute <temat> <czas|off>`", ""},
+		{"polish invalid topic", "pl", "", "/subscribe xyz", "Nieznany temat: `xyz`\nDostępne: invoice, payment, error", ""},
+		{"polish invalid interval", "pl", "", "/digest soon", "Nieprawidłowy interwał: `soon`", ""},
+		{"english", "en", "pl", "/mute", "Usage: `/mute <topic> <duration|off>`", ""},
+		{"configured language", "", "pl", "/subscribe xyz", "Nieznany temat", ""},
+		{"unsupported language", "de", "", "/subscribe xyz", "Invalid topic", ""},
+		{"polish status", "pl", "", "/status", "*Twoje ustawienia*\nWłączone: `tak`\nTryb: `realtime`\nTematy: `wszystkie`", `"text":"Tematy"`},
+		{"polish help", "pl", "", "/help", "`/stop` \\- Wyłącz powiadomienia", ""},
+		{"polish topics", "pl", "", "/topics", "*Subskrypcje tematów*", `"text":"Subskrybuj wszystkie"`},
+		{"english status", "en", "pl", "/status", "*Your Settings*\nEnabled: `yes`", `"text":"Topics"`},
+		{"polish admin command", "pl", "", "/users", "Wymagane uprawnienia administratora\\.", ""},
+		{"polish order command", "pl", "", "/order 100", "Wymagane uprawnienia administratora\\.", ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := &fakeBotClient{}
+			bot := &TgBot{
+				log: slog.New(slog.NewTextHandler(io.Discard, nil)),
+				api: &tgbotapi.Bot{Token: "token", BotClient: client},
+				db:  &orderDB{},
+				users: map[int64]*entity.User{
+					7: {TelegramId: 7, TelegramRole: entity.RoleUser, TelegramEnabled: true, Language: tc.language},
+				},
+				config: BotConfig{Language: tc.config},
+			}
+			ctx := ext.NewContext(bot.api, &tgbotapi.Update{Message: &tgbotapi.Message{
+				Text: tc.text,
+				From: &tgbotapi.User{Id: 7},
+				Chat: tgbotapi.Chat{Id: 7, Type: "private"},
+			}}, nil)
+
+			var err error
+			switch strings.Fields(tc.text)[0] {
+			case "/mute":
+				err = bot.mute(bot.api, ctx)
+			case "/subscribe":
+				err = bot.subscribe(bot.api, ctx)
+			case "/digest":
+				err = bot.digestCmd(bot.api, ctx)
+			case "/status":
+				err = bot.status(bot.api, ctx)
+			case "/help":
+				err = bot.help(bot.api, ctx)
+			case "/topics":
+				err = bot.topics(bot.api, ctx)
+			case "/users":
+				err = bot.usersCmd(bot.api, ctx)
+			case "/order":
+				err = bot.orderCmd(bot.api, ctx)
+			}
+			if err != nil {
+				t.Fatalf("handler: %v", err)
+			}
+			if len(client.params) != 1 || !strings.Contains(client.params[0]["text"], tc.want) {
+				t.Errorf("replies = %v, want %q", client.params, tc.want)
+			}
+			if len(client.params) == 1 && !strings.Contains(client.params[0]["reply_markup"], tc.wantMarkup) {
+				t.Errorf("reply_markup = %s, want %s", client.params[0]["reply_markup"], tc.wantMarkup)
+			}
+		})
+	}
+}
+
+// languageDB records the language stored for registering users.
+type languageDB struct {
+	startDB
+	languages map[int64]string
+}
+
+func (d *languageDB) SetLanguage(telegramId int64, language string) error {
+	d.languages[telegramId] = language
+	return nil
+}
+
+// TestRegistrationLanguage registers users from Telegram apps in different languages:
+// a supported language is stored and used for the reply, any other is not stored.
+func TestRegistrationLanguage(t *testing.T) {
+	cases := []struct {
+		code      string
+		wantLang  string
+		wantReply string
+	}{
+		{"pl-PL", "pl", "Rejestracja przyjęta"},
+		{"en", "en", "Registration received"},
+		{"de", "", "Registration received"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.code, func(t *testing.T) {
+			client := &fakeBotClient{}
+			db := &languageDB{
+				startDB: startDB{
+					usersDB:   usersDB{users: map[int64]*entity.User{}, topics: map[int64][]string{}},
+					invitedBy: map[int64]int64{},
+				},
+				languages: map[int64]string{},
+			}
+			bot := &TgBot{
+				log:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+				api:    &tgbotapi.Bot{Token: "token", BotClient: client},
+				db:     db,
+				config: BotConfig{RequireApproval: true},
+			}
+			ctx := ext.NewContext(bot.api, &tgbotapi.Update{Message: &tgbotapi.Message{
+				Text: "/start",
+				From: &tgbotapi.User{Id: 9, Username: "newbie", LanguageCode: tc.code},
+				Chat: tgbotapi.Chat{Id: 9, Type: "private"},
+			}}, nil)
+			if err := bot.start(bot.api, ctx); err != nil {
+				t.Fatalf("start: %v", err)
+			}
+
+			if got := db.languages[9]; got != tc.wantLang {
+				t.Errorf("stored language = %q, want %q", got, tc.wantLang)
+			}
+			if len(client.params) == 0 || !strings.Contains(client.params[0]["text"], tc.wantReply) {
+				t.Errorf("replies = %v, want %q", client.params, tc.wantReply)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package bot
 
 import (
+	"time"
 	"wfsync/entity"
 
 	tgbotapi "github.com/PaulSonOfLars/gotgbot/v2"
@@ -20,6 +21,9 @@ var commandsUser = []tgbotapi.BotCommand{
 	{Command: "stop", Description: "Disable notifications"},
 	{Command: "topics", Description: "Manage topic subscriptions"},
 	{Command: "tier", Description: "Set notification tier"},
+	{Command: "digest", Description: "Preview your digest or set its interval"},
+	{Command: "mute", Description: "Mute a topic for a while"},
+	{Command: "timezone", Description: "Set your timezone"},
 	{Command: "status", Description: "Show your settings"},
 	{Command: "help", Description: "Show available commands"},
 }
@@ -29,6 +33,9 @@ var commandsAdmin = []tgbotapi.BotCommand{
 	{Command: "stop", Description: "Disable notifications"},
 	{Command: "topics", Description: "Manage topic subscriptions"},
 	{Command: "tier", Description: "Set notification tier"},
+	{Command: "digest", Description: "Preview your digest or set its interval"},
+	{Command: "mute", Description: "Mute a topic for a while"},
+	{Command: "timezone", Description: "Set your timezone"},
 	{Command: "level", Description: "Set log level filter"},
 	{Command: "status", Description: "Show your settings"},
 	{Command: "users", Description: "List all users"},
@@ -37,40 +44,135 @@ var commandsAdmin = []tgbotapi.BotCommand{
 	{Command: "admin", Description: "Promote user to admin"},
 	{Command: "invite", Description: "Generate invite code"},
 	{Command: "retries", Description: "List pending invoice retry jobs"},
+	{Command: "metrics", Description: "Show operational counters"},
+	{Command: "reload", Description: "Reload users from the database"},
+	{Command: "export", Description: "Export the user list as JSON or CSV"},
+	{Command: "features", Description: "Show subsystem feature flags"},
+	{Command: "feature", Description: "Switch a subsystem on or off"},
+	{Command: "order", Description: "Show an order's payment and invoice"},
+	{Command: "invoice", Description: "Send an order's invoice PDF"},
 	{Command: "help", Description: "Show available commands"},
 }
 
-// setDefaultCommands sets the default bot menu for unknown users.
+// Menus are set by a background worker, so no handler waits on SetMyCommands. The
+// worker tries each menu menuAttempts times, waiting menuRetryDelay and then twice as
+// long before each further attempt. A menu that still fails stays queued and is set
+// again after the next loadUsers or menu update.
+const (
+	menuAttempts   = 3
+	menuRetryDelay = time.Second
+)
+
+// setDefaultCommands queues the default bot menu for unknown users.
 func (t *TgBot) setDefaultCommands() {
-	_, err := t.api.SetMyCommands(commandsAnonymous, &tgbotapi.SetMyCommandsOpts{
-		Scope: tgbotapi.BotCommandScopeDefault{},
-	})
-	if err != nil {
-		t.log.Warn("setting default commands", "error", err)
-	}
+	t.menuMu.Lock()
+	t.menuDefault = true
+	t.menuMu.Unlock()
+	t.updateMenusInBackground()
 }
 
-// setUserCommands sets the command menu for a specific user based on their role.
+// setUserCommands queues the command menu for a specific user based on their role.
 func (t *TgBot) setUserCommands(chatId int64, role entity.TelegramRole) {
-	var commands []tgbotapi.BotCommand
+	t.queueUserCommands(chatId, role)
+	t.updateMenusInBackground()
+}
+
+// queueUserCommands queues a user's menu; a later role replaces one still queued.
+func (t *TgBot) queueUserCommands(chatId int64, role entity.TelegramRole) {
+	t.menuMu.Lock()
+	defer t.menuMu.Unlock()
+	if t.menuChats == nil {
+		t.menuChats = make(map[int64]entity.TelegramRole)
+	}
+	t.menuChats[chatId] = role
+}
+
+// roleCommands returns the command menu of a role.
+func roleCommands(role entity.TelegramRole) []tgbotapi.BotCommand {
 	switch role {
 	case entity.RoleAdmin:
-		commands = commandsAdmin
+		return commandsAdmin
 	case entity.RoleUser:
-		commands = commandsUser
+		return commandsUser
 	default:
-		commands = commandsAnonymous
+		return commandsAnonymous
 	}
+}
+
+// setMyCommands calls SetMyCommands with bounded retries and exponential backoff.
+func (t *TgBot) setMyCommands(commands []tgbotapi.BotCommand, scope tgbotapi.BotCommandScope) error {
+	delay := menuRetryDelay
+	var err error
+	for attempt := 1; attempt <= menuAttempts; attempt++ {
+		_, err = t.api.SetMyCommands(commands, &tgbotapi.SetMyCommandsOpts{Scope: scope})
+		if err == nil {
+			return nil
+		}
+		if attempt < menuAttempts {
+			t.clock.Sleep(delay)
+			delay *= 2
+		}
+	}
+	return err
+}
+
+// updateMenusInBackground starts the worker that sets the queued menus, unless one is
+// already running; that worker picks up menus queued while it runs.
+func (t *TgBot) updateMenusInBackground() {
+	t.menuMu.Lock()
+	pending := len(t.menuChats) > 0 || t.menuDefault
+	t.menuMu.Unlock()
+	if !pending || !t.menuRetry.CompareAndSwap(false, true) {
+		return
+	}
+	t.menuWG.Add(1)
+	go func() {
+		defer t.menuWG.Done()
+		t.updatePendingMenus()
+	}()
+}
+
+// updatePendingMenus sets the queued menus until the queue is empty. Menus that fail
+// every attempt are queued again when the worker stops.
+func (t *TgBot) updatePendingMenus() {
+	failed := make(map[int64]entity.TelegramRole)
+	failedDefault := false
+	for {
+		t.menuMu.Lock()
+		chats, setDefault := t.menuChats, t.menuDefault
+		t.menuChats, t.menuDefault = nil, false
+		if len(chats) == 0 && !setDefault {
+			if len(failed) > 0 {
+				t.menuChats = failed
+			}
+			t.menuDefault = failedDefault
+			// Cleared under the lock, so a menu queued after the check starts a new worker.
+			t.menuRetry.Store(false)
+			t.menuMu.Unlock()
+			return
+		}
+		t.menuMu.Unlock()
 
-	_, err := t.api.SetMyCommands(commands, &tgbotapi.SetMyCommandsOpts{
-		Scope: tgbotapi.BotCommandScopeChat{ChatId: chatId},
-	})
-	if err != nil {
-		t.log.Warn("setting user commands", "chat_id", chatId, "error", err)
+		if setDefault {
+			if err := t.setMyCommands(commandsAnonymous, tgbotapi.BotCommandScopeDefault{}); err != nil {
+				t.log.Warn("setting default commands", "error", err)
+				failedDefault = true
+			} else {
+				failedDefault = false
+			}
+		}
+		for chatId, role := range chats {
+			if err := t.setMyCommands(roleCommands(role), tgbotapi.BotCommandScopeChat{ChatId: chatId}); err != nil {
+				t.log.Warn("setting user commands", "chat_id", chatId, "error", err)
+				failed[chatId] = role
+			} else {
+				delete(failed, chatId)
+			}
+		}
 	}
 }
 
-// syncAllUserMenus sets command menus for all known users based on their roles.
+// syncAllUserMenus queues command menus for all known users based on their roles.
 func (t *TgBot) syncAllUserMenus() {
 	t.mu.RLock()
 	users := make(map[int64]entity.TelegramRole, len(t.users))
@@ -80,6 +182,7 @@ func (t *TgBot) syncAllUserMenus() {
 	t.mu.RUnlock()
 
 	for chatId, role := range users {
-		t.setUserCommands(chatId, role)
+		t.queueUserCommands(chatId, role)
 	}
+	t.updateMenusInBackground()
 }
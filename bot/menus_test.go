@@ -0,0 +1,141 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+	"wfsync/entity"
+	"wfsync/lib/clock"
+
+	tgbotapi "github.com/PaulSonOfLars/gotgbot/v2"
+)
+
+// flakyBotClient records setMyCommands calls and fails the first failures of them.
+type flakyBotClient struct {
+	fakeBotClient
+	failures int
+}
+
+func (c *flakyBotClient) RequestWithContext(ctx context.Context, token string, method string, params map[string]string, data map[string]tgbotapi.FileReader, opts *tgbotapi.RequestOpts) (json.RawMessage, error) {
+	if method == "setMyCommands" {
+		c.methods = append(c.methods, method)
+		if c.failures > 0 {
+			c.failures--
+			return nil, errors.New("telegram: 502 bad gateway")
+		}
+	}
+	return c.fakeBotClient.RequestWithContext(ctx, token, method, params, data, opts)
+}
+
+// sleepRecorder is a mock clock that records how long it was asked to sleep.
+type sleepRecorder struct {
+	*clock.Mock
+	delays []time.Duration
+}
+
+func (c *sleepRecorder) Sleep(d time.Duration) {
+	c.delays = append(c.delays, d)
+	c.Mock.Sleep(d)
+}
+
+// TestSetUserCommandsRetry checks that a transient SetMyCommands failure is retried with
+// a doubling delay, and that a menu still failing after every attempt stays queued and is
+// set in the background after the next loadUsers.
+func TestSetUserCommandsRetry(t *testing.T) {
+	cases := []struct {
+		name        string
+		failures    int
+		wantCalls   int
+		wantDelays  []time.Duration
+		wantPending bool
+	}{
+		{"succeeds", 0, 1, nil, false},
+		{"transient", 1, 2, []time.Duration{time.Second}, false},
+		{"twice", 2, 3, []time.Duration{time.Second, 2 * time.Second}, false},
+		{"persistent", 3, 3, []time.Duration{time.Second, 2 * time.Second}, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := &flakyBotClient{failures: tc.failures}
+			clk := &sleepRecorder{Mock: clock.NewMock(time.Now())}
+			bot := &TgBot{
+				log:   slog.New(slog.NewTextHandler(io.Discard, nil)),
+				api:   &tgbotapi.Bot{Token: "token", BotClient: client},
+				db:    &usersDB{users: map[int64]*entity.User{7: {TelegramId: 7, TelegramRole: entity.RoleAdmin}}},
+				clock: clk,
+			}
+
+			bot.setUserCommands(7, entity.RoleUser)
+			bot.menuWG.Wait()
+			if len(client.methods) != tc.wantCalls {
+				t.Errorf("calls = %d, want %d", len(client.methods), tc.wantCalls)
+			}
+			if len(clk.delays) != len(tc.wantDelays) {
+				t.Fatalf("delays = %v, want %v", clk.delays, tc.wantDelays)
+			}
+			for i := range clk.delays {
+				if clk.delays[i] != tc.wantDelays[i] {
+					t.Errorf("delays = %v, want %v", clk.delays, tc.wantDelays)
+				}
+			}
+			if _, got := bot.menuChats[7]; got != tc.wantPending {
+				t.Fatalf("pending = %v, want %v", got, tc.wantPending)
+			}
+
+			client.methods = nil
+			bot.loadUsers()
+			bot.menuWG.Wait()
+			wantRetries := 0
+			if tc.wantPending {
+				wantRetries = 1
+			}
+			if len(client.methods) != wantRetries {
+				t.Errorf("calls on loadUsers = %d, want %d", len(client.methods), wantRetries)
+			}
+			if len(bot.menuChats) != 0 {
+				t.Errorf("menus still pending after loadUsers: %v", bot.menuChats)
+			}
+		})
+	}
+}
+
+// blockingClock holds every Sleep until released.
+type blockingClock struct {
+	*clock.Mock
+	release chan struct{}
+}
+
+func (c *blockingClock) Sleep(time.Duration) { <-c.release }
+
+// TestSetUserCommandsNoWait checks that a handler setting a menu returns at once, while
+// the retry backoff of a failing SetMyCommands runs in the background.
+func TestSetUserCommandsNoWait(t *testing.T) {
+	clk := &blockingClock{Mock: clock.NewMock(time.Now()), release: make(chan struct{})}
+	bot := &TgBot{
+		log:   slog.New(slog.NewTextHandler(io.Discard, nil)),
+		api:   &tgbotapi.Bot{Token: "token", BotClient: &flakyBotClient{failures: 1}},
+		clock: clk,
+	}
+
+	done := make(chan struct{})
+	go func() {
+		bot.setUserCommands(7, entity.RoleUser)
+		bot.setDefaultCommands()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("setUserCommands waited for the retry backoff")
+	}
+
+	close(clk.release)
+	bot.menuWG.Wait()
+	if len(bot.menuChats) != 0 || bot.menuDefault {
+		t.Errorf("menus still pending: %v, default %v", bot.menuChats, bot.menuDefault)
+	}
+}
@@ -1,7 +1,10 @@
 package bot
 
 import (
+	"fmt"
 	"log/slog"
+	"slices"
+	"strings"
 	"wfsync/entity"
 )
 
@@ -27,14 +30,38 @@ func (t *TgBot) SendMessageWithTopic(msg string, level slog.Level, topic string)
 	t.sendToUsers(msg, level, topic, false)
 }
 
-// sendToUsers is the core notification routing method.
-// For each cached user it checks: enabled → approved → log level → topic match.
+// Notify implements core.Notifier: a business notification is rendered with its event's
+// message template, headed with its topic like topic-tagged log messages, and routed to
+// the users subscribed to that topic. For an order, the messages sent earlier about it
+// are edited to show the new status, and the new messages are remembered in turn.
+func (t *TgBot) Notify(topic string, level slog.Level, n *entity.Notification) {
+	line := t.templates.render(n)
+	text := fmt.Sprintf("*%s* %s", strings.ToUpper(topic), line)
+	orderId := n.Fields["order_id"]
+	if orderId != "" {
+		t.editOrderMessages(orderId, line)
+	}
+	sent := t.sendToUsers(text, level, topic, false)
+	if orderId != "" && t.sentOrders != nil {
+		t.sentOrders.Track(orderId, sent)
+	}
+}
+
+// sendToUsers is the core notification routing method. Nothing is sent while the
+// Telegram feature flag is off.
+// For each cached user it checks: enabled → approved → log level → topic match → not muted.
 // When adminOnly is true, non-admin users are skipped (used for untagged log messages).
 // Then dispatches based on the user's subscription tier:
 //   - realtime: immediate send
-//   - critical: immediate send only if level ≥ ERROR
+//   - critical: immediate send only if level ≥ ERROR, with an Ack button when escalation is on
 //   - digest:   buffer in DigestBuffer for periodic flush
-func (t *TgBot) sendToUsers(msg string, level slog.Level, topic string, adminOnly bool) {
+//
+// Finally the message is posted to the configured group chats that take the topic.
+// Returns the messages sent right away to realtime-tier users and groups.
+func (t *TgBot) sendToUsers(msg string, level slog.Level, topic string, adminOnly bool) []sentMessage {
+	if !t.features.Enabled(entity.FeatureTelegram) {
+		return nil
+	}
 	t.mu.RLock()
 	users := make(map[int64]*entity.User, len(t.users))
 	for k, v := range t.users {
@@ -43,6 +70,8 @@ func (t *TgBot) sendToUsers(msg string, level slog.Level, topic string, adminOnl
 	t.mu.RUnlock()
 
 	l := int(level)
+	now := t.clock.Now()
+	var sent []sentMessage
 	for _, user := range users {
 		if !user.TelegramEnabled || !user.IsApproved() {
 			continue
@@ -53,7 +82,7 @@ func (t *TgBot) sendToUsers(msg string, level slog.Level, topic string, adminOnl
 		if l < user.LogLevel {
 			continue
 		}
-		if !user.HasTopic(topic) {
+		if !user.HasTopic(topic) || user.IsMuted(topic, now) {
 			continue
 		}
 
@@ -64,10 +93,12 @@ func (t *TgBot) sendToUsers(msg string, level slog.Level, topic string, adminOnl
 
 		switch tier {
 		case entity.TierRealtime:
-			t.plainResponse(user.TelegramId, msg)
+			if m := t.sendToThread(user.TelegramId, 0, msg); m != nil {
+				sent = append(sent, sentMessage{ChatId: user.TelegramId, MessageId: m.MessageId, Text: msg})
+			}
 		case entity.TierCritical:
 			if level >= slog.LevelError {
-				t.plainResponse(user.TelegramId, msg)
+				t.sendCritical(user.TelegramId, msg)
 			}
 		case entity.TierDigest:
 			if t.digest != nil {
@@ -75,4 +106,19 @@ func (t *TgBot) sendToUsers(msg string, level slog.Level, topic string, adminOnl
 			}
 		}
 	}
+	return append(sent, t.sendToGroups(msg, topic)...)
+}
+
+// sendToGroups posts a notification to the configured group chats that take its topic,
+// in the group's forum thread when one is set. Returns the messages sent.
+func (t *TgBot) sendToGroups(msg string, topic string) []sentMessage {
+	var sent []sentMessage
+	for _, group := range t.config.Groups {
+		if len(group.Topics) == 0 || slices.Contains(group.Topics, topic) {
+			if m := t.sendToThread(group.ChatId, group.MessageThreadId, msg); m != nil {
+				sent = append(sent, sentMessage{ChatId: group.ChatId, MessageId: m.MessageId, Text: msg})
+			}
+		}
+	}
+	return sent
 }
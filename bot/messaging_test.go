@@ -0,0 +1,90 @@
+package bot
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+	"wfsync/entity"
+	"wfsync/lib/clock"
+
+	tgbotapi "github.com/PaulSonOfLars/gotgbot/v2"
+)
+
+// TestSendToUsersMutes routes a payment notification at a fixed time: a mute still in
+// force suppresses it, an expired mute or a mute of another topic does not.
+func TestSendToUsersMutes(t *testing.T) {
+	now := time.Date(2025, 5, 20, 12, 0, 0, 0, time.UTC)
+	cases := []struct {
+		name     string
+		mutes    entity.TopicMutes
+		wantSent bool
+	}{
+		{"not muted", nil, true},
+		{"muted", entity.TopicMutes{entity.TopicPayment: now.Add(time.Hour)}, false},
+		{"mute expired", entity.TopicMutes{entity.TopicPayment: now.Add(-time.Minute)}, true},
+		{"mute expires now", entity.TopicMutes{entity.TopicPayment: now}, true},
+		{"other topic muted", entity.TopicMutes{entity.TopicInvoice: now.Add(time.Hour)}, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := &fakeBotClient{}
+			bot := &TgBot{
+				log: slog.New(slog.NewTextHandler(io.Discard, nil)),
+				api: &tgbotapi.Bot{Token: "token", BotClient: client},
+				users: map[int64]*entity.User{
+					7: {TelegramId: 7, TelegramRole: entity.RoleUser, TelegramEnabled: true, TopicMutes: tc.mutes},
+				},
+				clock: clock.NewMock(now),
+			}
+
+			bot.SendMessageWithTopic("payment received", slog.LevelInfo, entity.TopicPayment)
+			if sent := len(client.methods) > 0; sent != tc.wantSent {
+				t.Errorf("sent = %v, want %v", sent, tc.wantSent)
+			}
+		})
+	}
+}
+
+// TestSendToGroups checks that notifications reach the configured groups that take their
+// topic, with the group's forum thread id when one is configured.
+func TestSendToGroups(t *testing.T) {
+	cases := []struct {
+		name       string
+		group      GroupConfig
+		topic      string
+		wantSent   bool
+		wantThread string
+	}{
+		{"thread", GroupConfig{ChatId: -100, MessageThreadId: 42, Topics: []string{entity.TopicPayment}}, entity.TopicPayment, true, "42"},
+		{"no thread", GroupConfig{ChatId: -100, Topics: []string{entity.TopicPayment}}, entity.TopicPayment, true, ""},
+		{"all topics", GroupConfig{ChatId: -100, MessageThreadId: 7}, entity.TopicSystem, true, "7"},
+		{"other topic", GroupConfig{ChatId: -100, MessageThreadId: 42, Topics: []string{entity.TopicPayment}}, entity.TopicInvoice, false, ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := &fakeBotClient{}
+			bot := &TgBot{
+				log:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+				api:    &tgbotapi.Bot{Token: "token", BotClient: client},
+				users:  map[int64]*entity.User{},
+				config: BotConfig{Groups: []GroupConfig{tc.group}},
+				clock:  clock.Real,
+			}
+
+			bot.SendMessageWithTopic("payment received", slog.LevelInfo, tc.topic)
+			if sent := len(client.methods) > 0; sent != tc.wantSent {
+				t.Fatalf("sent = %v, want %v", sent, tc.wantSent)
+			}
+			if !tc.wantSent {
+				return
+			}
+			if got := client.params[0]["chat_id"]; got != "-100" {
+				t.Errorf("chat_id = %q, want -100", got)
+			}
+			if got := client.params[0]["message_thread_id"]; got != tc.wantThread {
+				t.Errorf("message_thread_id = %q, want %q", got, tc.wantThread)
+			}
+		})
+	}
+}
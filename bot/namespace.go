@@ -0,0 +1,59 @@
+package bot
+
+import (
+	"log/slog"
+	"strings"
+
+	tgbotapi "github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers"
+)
+
+// namespacedCommand is a command handler for running several bots in the same chats.
+// Commands addressed to another bot (/status@other_bot) are never answered. With a
+// suffix configured, bare commands in group chats are ignored too, since every bot in
+// the group receives them; only /status@suffix is answered there. Private chats
+// accept bare commands either way.
+type namespacedCommand struct {
+	handlers.Command
+	suffix string // lowercase username commands in groups must be addressed to
+}
+
+// command creates the handler for a bot command, honouring the configured suffix.
+func (t *TgBot) command(name string, r handlers.Response) ext.Handler {
+	return namespacedCommand{
+		Command: handlers.NewCommand(name, r),
+		suffix:  strings.ToLower(strings.TrimPrefix(t.config.CommandSuffix, "@")),
+	}
+}
+
+func (c namespacedCommand) CheckUpdate(b *tgbotapi.Bot, ctx *ext.Context) bool {
+	if msg := ctx.Message; msg != nil && !c.addressed(msg) {
+		return false
+	}
+	return c.Command.CheckUpdate(b, ctx)
+}
+
+// addressed reports whether a message's command is meant for this bot.
+func (c namespacedCommand) addressed(msg *tgbotapi.Message) bool {
+	fields := strings.Fields(msg.GetText())
+	if len(fields) == 0 || c.suffix == "" {
+		return true
+	}
+	if _, target, ok := strings.Cut(fields[0], "@"); ok {
+		return strings.EqualFold(target, c.suffix)
+	}
+	return msg.Chat.Type == "private"
+}
+
+// checkCommandSuffix warns when the configured suffix is not the bot's username, in
+// which case no addressed command would ever match.
+func (t *TgBot) checkCommandSuffix() {
+	suffix := strings.TrimPrefix(t.config.CommandSuffix, "@")
+	if suffix != "" && !strings.EqualFold(suffix, t.api.User.Username) {
+		t.log.With(
+			slog.String("command_suffix", suffix),
+			slog.String("username", t.api.User.Username),
+		).Warn("command suffix does not match the bot username")
+	}
+}
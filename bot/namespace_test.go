@@ -0,0 +1,47 @@
+package bot
+
+import (
+	"testing"
+
+	tgbotapi "github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+)
+
+// TestNamespacedCommand checks which /status messages the bot answers: commands
+// addressed to another bot are ignored, and with a suffix configured bare commands are
+// only answered in private chats.
+func TestNamespacedCommand(t *testing.T) {
+	cases := []struct {
+		name   string
+		suffix string
+		text   string
+		chat   string
+		want   bool
+	}{
+		{"bare private", "", "/status", "private", true},
+		{"bare group without suffix", "", "/status", "group", true},
+		{"own bot", "", "/status@wfsync_bot", "group", true},
+		{"other bot", "", "/status@other_bot", "group", false},
+		{"other bot with suffix", "@wfsync_bot", "/status@other_bot", "private", false},
+		{"own bot with suffix", "@wfsync_bot", "/status@WFsync_bot", "supergroup", true},
+		{"bare private with suffix", "wfsync_bot", "/status", "private", true},
+		{"bare group with suffix", "wfsync_bot", "/status", "supergroup", false},
+		{"other command", "wfsync_bot", "/stop@wfsync_bot", "group", false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			api := &tgbotapi.Bot{Token: "token", User: tgbotapi.User{Username: "wfsync_bot"}}
+			bot := &TgBot{api: api, config: BotConfig{CommandSuffix: tc.suffix}}
+			handler := bot.command("status", bot.status)
+			ctx := ext.NewContext(api, &tgbotapi.Update{Message: &tgbotapi.Message{
+				Text: tc.text,
+				From: &tgbotapi.User{Id: 7},
+				Chat: tgbotapi.Chat{Id: -100, Type: tc.chat},
+			}}, nil)
+
+			if got := handler.CheckUpdate(api, ctx); got != tc.want {
+				t.Errorf("CheckUpdate(%q in %s) = %v, want %v", tc.text, tc.chat, got, tc.want)
+			}
+		})
+	}
+}
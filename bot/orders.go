@@ -0,0 +1,195 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"wfsync/entity"
+	"wfsync/lib/money"
+	"wfsync/lib/sl"
+
+	tgbotapi "github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+)
+
+// orderCmd replies with a summary of an order's stored checkout: /order <order_id>.
+// Admin only.
+func (t *TgBot) orderCmd(_ *tgbotapi.Bot, ctx *ext.Context) error {
+	if t.db == nil {
+		return nil
+	}
+	chatId := ctx.EffectiveUser.Id
+	if !t.requireAdmin(chatId) {
+		t.plainResponse(chatId, tr(t.lang(chatId), msgAdminRequired))
+		return nil
+	}
+
+	args := strings.Fields(ctx.EffectiveMessage.Text)
+	if len(args) < 2 {
+		t.plainResponse(chatId, tr(t.lang(chatId), msgUsage, "/order <order_id>"))
+		return nil
+	}
+	if err := t.sendOrderSummary(chatId, args[1]); err != nil {
+		t.reportError(chatId, "/order", err)
+	}
+	return nil
+}
+
+// sendOrderSummary looks up the order's checkout params and replies with their summary.
+// The invoice number comes from the locally stored invoice; when that lookup fails the
+// summary falls back to the invoice id.
+func (t *TgBot) sendOrderSummary(chatId int64, orderId string) error {
+	params, err := t.db.GetCheckoutParamsByOrder(orderId)
+	if err != nil {
+		return fmt.Errorf("get checkout params: %w", err)
+	}
+	if params == nil {
+		t.plainResponse(chatId, tr(t.lang(chatId), msgOrderNotFound, Sanitize(orderId)))
+		return nil
+	}
+
+	invoiceNumber := ""
+	if params.InvoiceId != "" {
+		invoice, err := t.db.GetInvoiceById(params.InvoiceId)
+		if err != nil {
+			t.log.With(
+				slog.String("invoice_id", params.InvoiceId),
+				sl.Err(err),
+			).Warn("get invoice")
+		} else if invoice != nil {
+			invoiceNumber = invoice.Number
+		}
+	}
+	t.plainResponse(chatId, formatOrder(params, invoiceNumber))
+	return nil
+}
+
+// formatOrder renders an order's checkout params as a MarkdownV2 message.
+func formatOrder(params *entity.CheckoutParams, invoiceNumber string) string {
+	status := params.Status
+	if status == "" {
+		status = "pending"
+	}
+	paid := "no"
+	if params.Paid {
+		paid = "yes"
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("*Order %s*\n", Sanitize(params.OrderId)))
+	sb.WriteString(fmt.Sprintf("Status: %s\n", Sanitize(status)))
+	sb.WriteString(fmt.Sprintf("Paid: %s\n", paid))
+	sb.WriteString(fmt.Sprintf("Amount: %s\n", Sanitize(money.New(params.Total, params.Currency).String())))
+	if params.Refunded > 0 {
+		sb.WriteString(fmt.Sprintf("Refunded: %s\n", Sanitize(money.New(params.Refunded, params.Currency).String())))
+	}
+	switch {
+	case invoiceNumber != "":
+		sb.WriteString(fmt.Sprintf("Invoice: %s\n", Sanitize(invoiceNumber)))
+	case params.InvoiceId != "":
+		sb.WriteString(fmt.Sprintf("Invoice: id `%s`\n", Sanitize(params.InvoiceId)))
+	default:
+		sb.WriteString("Invoice: none\n")
+	}
+	if client := params.ClientDetails; client != nil {
+		customer := client.Name
+		if client.Email != "" {
+			customer = strings.TrimSpace(customer + " " + client.Email)
+		}
+		if customer != "" {
+			sb.WriteString(fmt.Sprintf("Customer: %s\n", Sanitize(customer)))
+		}
+	}
+	if !params.Created.IsZero() {
+		sb.WriteString(fmt.Sprintf("Created: %s", Sanitize(params.Created.Format(retryJobTimeFormat))))
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+// invoiceCmd sends the invoice document of an order: /invoice <order_id>. Admin only.
+func (t *TgBot) invoiceCmd(_ *tgbotapi.Bot, ctx *ext.Context) error {
+	if t.db == nil {
+		return nil
+	}
+	chatId := ctx.EffectiveUser.Id
+	if !t.requireAdmin(chatId) {
+		t.plainResponse(chatId, tr(t.lang(chatId), msgAdminRequired))
+		return nil
+	}
+
+	args := strings.Fields(ctx.EffectiveMessage.Text)
+	if len(args) < 2 {
+		t.plainResponse(chatId, tr(t.lang(chatId), msgUsage, "/invoice <order_id>"))
+		return nil
+	}
+	if err := t.sendOrderInvoice(chatId, args[1]); err != nil {
+		t.reportError(chatId, "/invoice", err)
+	}
+	return nil
+}
+
+// sendOrderInvoice looks up the order's stored invoice and sends its file as a document.
+// A file that was never downloaded, or is gone from disk, is downloaded from wFirma first
+// and recorded on the order. Orders without an invoice get a plain reply.
+func (t *TgBot) sendOrderInvoice(chatId int64, orderId string) error {
+	params, err := t.db.GetCheckoutParamsByOrder(orderId)
+	if err != nil {
+		return fmt.Errorf("get checkout params: %w", err)
+	}
+	if params == nil {
+		t.plainResponse(chatId, tr(t.lang(chatId), msgOrderNotFound, Sanitize(orderId)))
+		return nil
+	}
+	if params.InvoiceId == "" {
+		t.plainResponse(chatId, tr(t.lang(chatId), msgOrderNoInvoice, Sanitize(orderId)))
+		return nil
+	}
+
+	path, err := t.invoiceFile(params)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("open invoice file: %w", err)
+	}
+	defer f.Close()
+
+	_, err = t.api.SendDocument(chatId, tgbotapi.InputFileByReader(filepath.Base(path), f), &tgbotapi.SendDocumentOpts{
+		Caption: fmt.Sprintf("Invoice for order %s", params.OrderId),
+	})
+	if err != nil {
+		return fmt.Errorf("send document: %w", err)
+	}
+	return nil
+}
+
+// invoiceFile returns the path of the order's invoice file, downloading it when no
+// stored file exists.
+func (t *TgBot) invoiceFile(params *entity.CheckoutParams) (string, error) {
+	if params.InvoiceFile != "" {
+		path := filepath.Join(t.filePath, filepath.Base(params.InvoiceFile))
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	if t.invoices == nil {
+		return "", fmt.Errorf("invoice file of order %s not found and downloads are not configured", params.OrderId)
+	}
+
+	fileName, _, err := t.invoices.DownloadInvoice(context.Background(), params.InvoiceId)
+	if err != nil {
+		return "", fmt.Errorf("download invoice: %w", err)
+	}
+	if err = t.db.UpdateInvoiceFile(params.OrderId, params.InvoiceId, fileName); err != nil {
+		t.log.With(
+			slog.String("order_id", params.OrderId),
+			slog.String("invoice_id", params.InvoiceId),
+			sl.Err(err),
+		).Warn("record downloaded invoice file")
+	}
+	return filepath.Join(t.filePath, fileName), nil
+}
@@ -0,0 +1,220 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"wfsync/entity"
+
+	tgbotapi "github.com/PaulSonOfLars/gotgbot/v2"
+)
+
+// fakeBotClient records the Bot API calls and answers each with an empty message, or
+// with true for the calls returning a bool.
+type fakeBotClient struct {
+	methods []string
+	params  []map[string]string
+	files   []map[string]tgbotapi.FileReader
+	content []string // contents of the uploaded files
+}
+
+func (c *fakeBotClient) RequestWithContext(_ context.Context, _ string, method string, params map[string]string, data map[string]tgbotapi.FileReader, _ *tgbotapi.RequestOpts) (json.RawMessage, error) {
+	// Menus are set by a background worker; they are not recorded, so tests can read
+	// the replies while it runs.
+	if method == "setMyCommands" {
+		return json.RawMessage(`true`), nil
+	}
+	c.methods = append(c.methods, method)
+	c.params = append(c.params, params)
+	c.files = append(c.files, data)
+	for _, f := range data {
+		b, _ := io.ReadAll(f.Data)
+		c.content = append(c.content, string(b))
+	}
+	return json.RawMessage(`{"message_id":1,"date":0,"chat":{"id":7,"type":"private"}}`), nil
+}
+
+func (c *fakeBotClient) GetAPIURL(*tgbotapi.RequestOpts) string { return "https://api.telegram.test" }
+
+func (c *fakeBotClient) FileURL(string, string, *tgbotapi.RequestOpts) string { return "" }
+
+// orderDB serves stored checkout params by order and records invoice file updates.
+type orderDB struct {
+	Database
+	params  map[string]*entity.CheckoutParams
+	updated string
+}
+
+func (d *orderDB) GetCheckoutParamsByOrder(orderId string) (*entity.CheckoutParams, error) {
+	if orderId == "broken" {
+		return nil, errors.New("mongo down")
+	}
+	return d.params[orderId], nil
+}
+
+func (d *orderDB) GetInvoiceById(id string) (*entity.LocalInvoice, error) {
+	if id == "inv-1" {
+		return &entity.LocalInvoice{Id: id, Number: "FV 1/05/2025"}, nil
+	}
+	return nil, nil
+}
+
+func (d *orderDB) UpdateInvoiceFile(_, _, invoiceFile string) error {
+	d.updated = invoiceFile
+	return nil
+}
+
+// fakeDownloader writes a fixed invoice file into dir.
+type fakeDownloader struct {
+	dir   string
+	calls int
+}
+
+func (d *fakeDownloader) DownloadInvoice(_ context.Context, invoiceID string) (string, *entity.FileMeta, error) {
+	d.calls++
+	name := "downloaded-" + invoiceID + ".pdf"
+	return name, &entity.FileMeta{}, os.WriteFile(filepath.Join(d.dir, name), []byte("fresh pdf"), 0o644)
+}
+
+// TestSendOrderInvoice covers the /invoice lookup: a stored file is sent as a document,
+// a missing one is downloaded first and recorded, and orders without an invoice, unknown
+// orders and lookup failures get a reply or an error instead of a document.
+func TestSendOrderInvoice(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "stored.pdf"), []byte("stored pdf"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	db := &orderDB{params: map[string]*entity.CheckoutParams{
+		"101": {OrderId: "101", InvoiceId: "inv-1", InvoiceFile: "stored.pdf"},
+		"102": {OrderId: "102", InvoiceId: "inv-2", InvoiceFile: "deleted.pdf"},
+		"103": {OrderId: "103"},
+	}}
+
+	cases := []struct {
+		name        string
+		orderId     string
+		wantErr     bool
+		wantMethod  string
+		wantContent string
+		wantUpdated string
+		wantReply   string
+	}{
+		{name: "stored file", orderId: "101", wantMethod: "sendDocument", wantContent: "stored pdf"},
+		{name: "downloaded first", orderId: "102", wantMethod: "sendDocument", wantContent: "fresh pdf", wantUpdated: "downloaded-inv-2.pdf"},
+		{name: "no invoice", orderId: "103", wantMethod: "sendMessage", wantReply: "has no invoice"},
+		{name: "unknown order", orderId: "999", wantMethod: "sendMessage", wantReply: "Order not found"},
+		{name: "lookup fails", orderId: "broken", wantErr: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := &fakeBotClient{}
+			db.updated = ""
+			bot := &TgBot{
+				log:      slog.New(slog.NewTextHandler(io.Discard, nil)),
+				api:      &tgbotapi.Bot{Token: "token", BotClient: client},
+				db:       db,
+				users:    map[int64]*entity.User{},
+				invoices: &fakeDownloader{dir: dir},
+				filePath: dir,
+			}
+
+			err := bot.sendOrderInvoice(7, tc.orderId)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("sendOrderInvoice succeeded, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("sendOrderInvoice: %v", err)
+			}
+			if len(client.methods) != 1 || client.methods[0] != tc.wantMethod {
+				t.Fatalf("bot calls = %v, want one %s", client.methods, tc.wantMethod)
+			}
+			if tc.wantContent != "" {
+				if len(client.content) != 1 || client.content[0] != tc.wantContent {
+					t.Errorf("uploaded %q, want %q", client.content, tc.wantContent)
+				}
+				if got := client.params[0]["caption"]; !strings.Contains(got, tc.orderId) {
+					t.Errorf("caption = %q, want the order id", got)
+				}
+			}
+			if db.updated != tc.wantUpdated {
+				t.Errorf("recorded file = %q, want %q", db.updated, tc.wantUpdated)
+			}
+			if tc.wantReply != "" && !strings.Contains(client.params[0]["text"], tc.wantReply) {
+				t.Errorf("reply = %q, want %q", client.params[0]["text"], tc.wantReply)
+			}
+		})
+	}
+}
+
+// TestSendOrderSummary covers the /order replies: a found order is summarized with its
+// invoice number (or id when the invoice is not stored locally), an unknown order gets a
+// not-found reply, and a failing lookup is an error.
+func TestSendOrderSummary(t *testing.T) {
+	created := time.Date(2025, 5, 20, 17, 32, 0, 0, time.UTC)
+	db := &orderDB{params: map[string]*entity.CheckoutParams{
+		"101": {OrderId: "101", Status: "paid", Paid: true, Total: 12345, Currency: "pln", InvoiceId: "inv-1",
+			Created: created, ClientDetails: &entity.ClientDetails{Name: "Jan Kowalski", Email: "jan@example.com"}},
+		"102": {OrderId: "102", Status: "refunded", Paid: true, Total: 5000, Refunded: 2000, Currency: "EUR", InvoiceId: "inv-9"},
+		"103": {OrderId: "103", Total: 100, Currency: "PLN"},
+	}}
+
+	cases := []struct {
+		name    string
+		orderId string
+		wantErr bool
+		want    []string
+	}{
+		{"found", "101", false, []string{
+			"*Order 101*", "Status: paid", "Paid: yes", "Amount: 123\\.45 PLN", "Invoice: FV 1/05/2025",
+			"Customer: Jan Kowalski jan@example\\.com", "Created: 20\\-05\\-2025 17:32",
+		}},
+		{"invoice not stored locally", "102", false, []string{"Status: refunded", "Refunded: 20\\.00 EUR", "Invoice: id `inv\\-9`"}},
+		{"not invoiced", "103", false, []string{"Status: pending", "Paid: no", "Invoice: none"}},
+		{"not found", "999", false, []string{"Order not found: 999"}},
+		{"lookup fails", "broken", true, nil},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := &fakeBotClient{}
+			bot := &TgBot{
+				log:   slog.New(slog.NewTextHandler(io.Discard, nil)),
+				api:   &tgbotapi.Bot{Token: "token", BotClient: client},
+				db:    db,
+				users: map[int64]*entity.User{},
+			}
+
+			err := bot.sendOrderSummary(7, tc.orderId)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("sendOrderSummary succeeded, want error")
+				}
+				if len(client.methods) != 0 {
+					t.Errorf("bot calls = %v, want none", client.methods)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("sendOrderSummary: %v", err)
+			}
+			if len(client.methods) != 1 || client.methods[0] != "sendMessage" {
+				t.Fatalf("bot calls = %v, want one sendMessage", client.methods)
+			}
+			reply := client.params[0]["text"]
+			for _, want := range tc.want {
+				if !strings.Contains(reply, want) {
+					t.Errorf("reply missing %q:\n%s", want, reply)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package bot
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"text/template"
+	"wfsync/entity"
+	"wfsync/lib/sl"
+)
+
+// defaultLanguage is used when the configured language has no templates.
+const defaultLanguage = "en"
+
+// notificationTemplates holds the built-in wording of business notifications per
+// language. Templates are plain text with {{.field}} placeholders; the rendered message
+// is escaped for MarkdownV2 as a whole, so neither templates nor fields need escaping.
+var notificationTemplates = map[string]map[string]string{
+	"en": {
+		entity.EventOrderInvoiced:   "Order {{.order_id}} invoiced: {{.invoice}}",
+		entity.EventPaymentCaptured: "Order {{.order_id}} captured {{.captured}} of {{.authorized}}",
+		entity.EventOrderRefunded:   "Order {{.order_id}} refunded {{.refunded}}: correction {{.correction}}",
+	},
+	"pl": {
+		entity.EventOrderInvoiced:   "Zamówienie {{.order_id}} zafakturowane: {{.invoice}}",
+		entity.EventPaymentCaptured: "Zamówienie {{.order_id}}: pobrano {{.captured}} z {{.authorized}}",
+		entity.EventOrderRefunded:   "Zamówienie {{.order_id}}: zwrot {{.refunded}}, korekta {{.correction}}",
+	},
+}
+
+// messageTemplates renders business notifications. A nil *messageTemplates renders
+// with the built-in English templates.
+type messageTemplates struct {
+	byEvent map[string]*template.Template
+}
+
+// newMessageTemplates parses the built-in templates of the language, falling back to
+// English, and applies the custom templates on top. A custom template that does not
+// parse is logged and skipped, keeping the built-in one.
+func newMessageTemplates(language string, custom map[string]string, log *slog.Logger) *messageTemplates {
+	texts, ok := notificationTemplates[strings.ToLower(language)]
+	if !ok {
+		if language != "" {
+			log.With(slog.String("language", language)).Warn("no notification templates for language, using english")
+		}
+		texts = notificationTemplates[defaultLanguage]
+	}
+
+	m := &messageTemplates{byEvent: make(map[string]*template.Template, len(texts))}
+	for event, text := range texts {
+		m.byEvent[event] = template.Must(parseTemplate(event, text))
+	}
+	for event, text := range custom {
+		tmpl, err := parseTemplate(event, text)
+		if err != nil {
+			log.With(slog.String("event", event), sl.Err(err)).Warn("invalid notification template")
+			continue
+		}
+		m.byEvent[event] = tmpl
+	}
+	return m
+}
+
+func parseTemplate(event, text string) (*template.Template, error) {
+	return template.New(event).Option("missingkey=error").Parse(text)
+}
+
+// render fills in the event's template and escapes the result for MarkdownV2. An event
+// without a template, or whose template refers to a missing field, is rendered as the
+// event name followed by its fields, so the notification is not lost.
+func (m *messageTemplates) render(n *entity.Notification) string {
+	if m == nil {
+		m = defaultTemplates
+	}
+	if tmpl, ok := m.byEvent[n.Event]; ok {
+		var sb strings.Builder
+		if err := tmpl.Execute(&sb, n.Fields); err == nil {
+			return Sanitize(sb.String())
+		}
+	}
+	return Sanitize(plainNotification(n))
+}
+
+// plainNotification lists the event and its fields in key order: "order.invoiced order_id=1".
+func plainNotification(n *entity.Notification) string {
+	keys := make([]string, 0, len(n.Fields))
+	for k := range n.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := []string{n.Event}
+	for _, k := range keys {
+		parts = append(parts, fmt.Sprintf("%s=%s", k, n.Fields[k]))
+	}
+	return strings.Join(parts, " ")
+}
+
+// defaultTemplates renders notifications for a bot created without NewTgBot.
+var defaultTemplates = newMessageTemplates(defaultLanguage, nil, slog.Default())
@@ -0,0 +1,60 @@
+package bot
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+	"wfsync/entity"
+)
+
+// TestMessageTemplates renders every event in every built-in language, checks the result
+// is escaped for MarkdownV2, and covers custom overrides and the fallbacks for a broken
+// custom template, a missing field and an unknown event.
+func TestMessageTemplates(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	fields := map[string]string{
+		"order_id":   "ORD-1",
+		"invoice":    "FV 1/05/2025",
+		"captured":   "100.00",
+		"authorized": "100.00 PLN",
+		"refunded":   "20.00 PLN",
+		"correction": "FK 1/2025",
+	}
+	cases := []struct {
+		name     string
+		language string
+		custom   map[string]string
+		event    string
+		fields   map[string]string
+		want     string
+	}{
+		{"en invoiced", "en", nil, entity.EventOrderInvoiced, fields, "Order ORD\\-1 invoiced: FV 1/05/2025"},
+		{"en captured", "en", nil, entity.EventPaymentCaptured, fields, "Order ORD\\-1 captured 100\\.00 of 100\\.00 PLN"},
+		{"en refunded", "en", nil, entity.EventOrderRefunded, fields, "Order ORD\\-1 refunded 20\\.00 PLN: correction FK 1/2025"},
+		{"pl invoiced", "pl", nil, entity.EventOrderInvoiced, fields, "Zamówienie ORD\\-1 zafakturowane: FV 1/05/2025"},
+		{"pl captured", "PL", nil, entity.EventPaymentCaptured, fields, "Zamówienie ORD\\-1: pobrano 100\\.00 z 100\\.00 PLN"},
+		{"pl refunded", "pl", nil, entity.EventOrderRefunded, fields, "Zamówienie ORD\\-1: zwrot 20\\.00 PLN, korekta FK 1/2025"},
+		{"unknown language", "de", nil, entity.EventOrderInvoiced, fields, "Order ORD\\-1 invoiced: FV 1/05/2025"},
+		{"custom", "en", map[string]string{entity.EventOrderInvoiced: "#{{.order_id}} -> {{.invoice}}"}, entity.EventOrderInvoiced, fields, "\\#ORD\\-1 \\-> FV 1/05/2025"},
+		{"broken custom", "en", map[string]string{entity.EventOrderInvoiced: "{{.order_id"}, entity.EventOrderInvoiced, fields, "Order ORD\\-1 invoiced: FV 1/05/2025"},
+		{"missing field", "en", nil, entity.EventOrderInvoiced, map[string]string{"order_id": "ORD-1"}, "order\\.invoiced order\\_id\\=ORD\\-1"},
+		{"unknown event", "en", nil, "order.lost", map[string]string{"order_id": "7"}, "order\\.lost order\\_id\\=7"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := newMessageTemplates(tc.language, tc.custom, log)
+			got := m.render(&entity.Notification{Event: tc.event, Fields: tc.fields})
+			if got != tc.want {
+				t.Errorf("render = %q, want %q", got, tc.want)
+			}
+		})
+	}
+
+	for language, texts := range notificationTemplates {
+		for _, event := range entity.NotificationEvents {
+			if _, ok := texts[event]; !ok {
+				t.Errorf("language %s has no template for %s", language, event)
+			}
+		}
+	}
+}
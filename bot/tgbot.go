@@ -2,37 +2,50 @@
 //
 // Architecture overview:
 //   - tgbot.go    — TgBot struct, lifecycle (Start/Stop), user cache, Database interface
-//   - commands.go  — User-facing commands: /start, /stop, /level, /topics, /tier, /status, /help
-//   - admin.go     — Admin commands: /users, /approve, /revoke, /admin, /invite
+//   - commands.go  — User-facing commands: /start, /stop, /level, /topics, /tier, /digest, /timezone, /mute, /status, /help
+//   - admin.go     — Admin commands: /users, /approve, /revoke, /admin, /invite, /retries, /metrics, /reload, /export
+//   - orders.go    — Order lookups for admins: /order, /invoice
 //   - callbacks.go — Inline keyboard builders and callback query handlers
 //   - menus.go     — Per-user command menus via Telegram's BotCommandScope API
 //   - messaging.go — Notification routing: level filter → topic filter → tier dispatch
 //   - digest.go    — DigestBuffer for batched notification delivery
+//   - escalation.go — Escalator for unacknowledged critical-tier alerts
+//   - templates.go — Per-language message templates for business notifications
+//   - i18n.go      — Per-language catalogs of the replies to user commands
+//   - namespace.go — Command handlers that only answer commands addressed to this bot
+//   - tracking.go  — Sent order notifications, edited when the order's status changes
 //   - helpers.go   — Shared utilities: Sanitize, plainResponse, resolveUser, reportError
 //
 // Data flow for incoming notifications (e.g., from slog handler):
 //
-//	SendMessageWithTopic → for each user: check enabled/approved/level/topic → route by tier:
+//	SendMessageWithTopic → for each user: check enabled/approved/level/topic/mute → route by tier:
 //	  realtime → immediate send
-//	  critical → immediate send only if level >= ERROR
-//	  digest   → buffer in DigestBuffer, flushed on interval
+//	  critical → immediate send only if level >= ERROR, escalated to admins unless acknowledged
+//	  digest   → buffer in DigestBuffer, flushed on the user's interval
 //
 // Thread safety: the users map and adminIds are protected by sync.RWMutex.
 // All commands and callbacks acquire RLock to read; loadUsers() acquires full Lock to refresh.
 package bot
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"sync"
+	"sync/atomic"
 	"time"
 	"wfsync/entity"
+	"wfsync/lib/audit"
+	"wfsync/lib/clock"
+	"wfsync/lib/features"
 	"wfsync/lib/sl"
 
 	tgbotapi "github.com/PaulSonOfLars/gotgbot/v2"
 	"github.com/PaulSonOfLars/gotgbot/v2/ext"
 	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers"
 	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers/filters/callbackquery"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers/filters/message"
 )
 
 // BotConfig holds Telegram-specific configuration loaded from the YAML config file.
@@ -41,6 +54,34 @@ type BotConfig struct {
 	DigestIntervalMin int
 	DefaultTier       string
 	InviteCodeLength  int
+	// DigestMaxEntries caps the entries listed in one digest; 0 lists them all.
+	DigestMaxEntries int
+	// Default topic subscriptions per role; empty means all topics of the role.
+	UserTopics  []string
+	AdminTopics []string
+	// Language and Templates select and override the business notification wording.
+	Language  string
+	Templates map[string]string
+	// EscalationMin is how long a critical-tier user has to acknowledge an alert
+	// before it is re-sent and reported to admins; 0 disables escalation.
+	EscalationMin int
+	// Groups are group chats that receive notifications besides the users.
+	Groups []GroupConfig
+	// CommandSuffix is the bot's username; when set, group chat commands are only
+	// answered when addressed as /command@username.
+	CommandSuffix string
+	// AdminIds are registered as admins on /start, without approval.
+	AdminIds []int64
+	// MinLevel is the level of untagged messages and of newly enabled users.
+	MinLevel slog.Level
+}
+
+// GroupConfig is a group chat receiving the notifications of its topics, all topics
+// when Topics is empty. MessageThreadId posts into a forum topic of the group.
+type GroupConfig struct {
+	ChatId          int64
+	MessageThreadId int64
+	Topics          []string
 }
 
 // Database defines the storage operations the bot depends on.
@@ -54,11 +95,26 @@ type Database interface {
 	SetTelegramRole(telegramId int64, role entity.TelegramRole) error
 	GetPendingTelegramUsers() ([]*entity.User, error)
 	SetTelegramTopics(telegramId int64, topics []string) error
+	SetTopicMute(telegramId int64, topic string, until time.Time) error
+	SetDigestInterval(telegramId int64, minutes int) error
+	TouchUser(telegramId int64) error
 	SetSubscriptionTier(telegramId int64, tier entity.SubscriptionTier, schedule string) error
 	CreateInviteCode(code *entity.InviteCode) error
-	UseInviteCode(code string, telegramId int64) error
+	UseInviteCode(code string, telegramId int64) (*entity.InviteCode, error)
+	SetInvitedBy(telegramId, inviterId int64) error
+	SetLanguage(telegramId int64, language string) error
+	SetTimezone(telegramId int64, timezone string) error
 	MigrateExistingTelegramUsers() error
 	GetAllPendingRetryJobs() ([]*entity.RetryJob, error)
+	GetCheckoutParamsByOrder(orderId string) (*entity.CheckoutParams, error)
+	UpdateInvoiceFile(orderId, invoiceId, invoiceFile string) error
+	GetInvoiceById(id string) (*entity.LocalInvoice, error)
+}
+
+// InvoiceDownloader fetches invoice documents into the file directory.
+// Implemented by internal/wfirma.
+type InvoiceDownloader interface {
+	DownloadInvoice(ctx context.Context, invoiceID string) (string, *entity.FileMeta, error)
 }
 
 // TgBot is the central Telegram bot instance.
@@ -69,17 +125,52 @@ type TgBot struct {
 	api         *tgbotapi.Bot
 	db          Database
 	mu          sync.RWMutex           // guards users and adminIds
+	roleMu      sync.Mutex             // serializes role changes for the last-admin check
 	users       map[int64]*entity.User // telegram_id → User; includes all roles
 	minLogLevel slog.Level
 	updater     *ext.Updater
 	digest      *DigestBuffer
 	adminIds    []int64 // cached admin telegram IDs for quick notification
 	config      BotConfig
+	auditLog    *audit.Log
+	features    *features.Flags
+	invoices    InvoiceDownloader
+	filePath    string // directory of the stored invoice files
+	clock       clock.Clock
+	templates   *messageTemplates
+	escalator   *Escalator // nil when critical alerts are not escalated
+	sentOrders  *orderMessages
+	menuMu      sync.Mutex                    // guards the pending menu updates
+	menuChats   map[int64]entity.TelegramRole // queued user menus by chat
+	menuDefault bool
+	menuRetry   atomic.Bool    // set while the background worker sets queued menus
+	menuWG      sync.WaitGroup // background menu worker, waited for by Stop
+	polling     atomic.Bool    // set while the updater is polling
+}
+
+// Invite codes are prefixes of a UUID string, so they can be at most its 36 characters
+// long; the minimum keeps them from being guessed.
+const (
+	defaultInviteCodeLength = 8
+	minInviteCodeLength     = 6
+	maxInviteCodeLength     = 36
+)
+
+// clampInviteCodeLength brings an invite code length within the allowed range; 0 selects
+// the default length.
+func clampInviteCodeLength(n int) int {
+	if n == 0 {
+		return defaultInviteCodeLength
+	}
+	return min(max(n, minInviteCodeLength), maxInviteCodeLength)
 }
 
 func NewTgBot(apiKey string, db Database, log *slog.Logger, cfg BotConfig) (*TgBot, error) {
-	if cfg.InviteCodeLength == 0 {
-		cfg.InviteCodeLength = 8
+	if n := clampInviteCodeLength(cfg.InviteCodeLength); n != cfg.InviteCodeLength {
+		if cfg.InviteCodeLength != 0 {
+			log.With(slog.Int("configured", cfg.InviteCodeLength), slog.Int("used", n)).Warn("invite code length out of range")
+		}
+		cfg.InviteCodeLength = n
 	}
 	if cfg.DigestIntervalMin == 0 {
 		cfg.DigestIntervalMin = 60
@@ -88,10 +179,13 @@ func NewTgBot(apiKey string, db Database, log *slog.Logger, cfg BotConfig) (*TgB
 	tgBot := &TgBot{
 		log:         log.With(sl.Module("tgbot")),
 		db:          db,
-		minLogLevel: slog.LevelDebug,
+		minLogLevel: cfg.MinLevel,
 		users:       make(map[int64]*entity.User),
 		config:      cfg,
+		clock:       clock.Real,
+		sentOrders:  newOrderMessages(maxTrackedOrders),
 	}
+	tgBot.templates = newMessageTemplates(cfg.Language, cfg.Templates, tgBot.log)
 
 	api, err := tgbotapi.NewBot(apiKey, nil)
 	if err != nil {
@@ -102,15 +196,39 @@ func NewTgBot(apiKey string, db Database, log *slog.Logger, cfg BotConfig) (*TgB
 	return tgBot, nil
 }
 
+// SetAuditLog records role changes in the audit log.
+func (t *TgBot) SetAuditLog(l *audit.Log) {
+	t.auditLog = l
+}
+
+// SetFeatures mutes notifications while the Telegram feature flag is off and enables the
+// /features and /feature admin commands. Commands keep working, so an admin can switch
+// Telegram back on from the bot.
+func (t *TgBot) SetFeatures(f *features.Flags) {
+	t.features = f
+}
+
+// SetInvoiceDownloader lets /invoice download invoice files missing from filePath.
+func (t *TgBot) SetInvoiceDownloader(dl InvoiceDownloader, filePath string) {
+	t.invoices = dl
+	t.filePath = filePath
+}
+
 func (t *TgBot) Start() error {
 	t.loadUsers()
 	t.sanitizeUserTopics()
+	t.checkCommandSuffix()
 
 	// Start digest buffer
 	interval := time.Duration(t.config.DigestIntervalMin) * time.Minute
 	t.digest = NewDigestBuffer(t, interval)
 	t.digest.StartTicker()
 
+	if t.config.EscalationMin > 0 {
+		t.escalator = NewEscalator(t, time.Duration(t.config.EscalationMin)*time.Minute)
+		t.escalator.StartTicker()
+	}
+
 	dispatcher := ext.NewDispatcher(&ext.DispatcherOpts{
 		Error: func(b *tgbotapi.Bot, ctx *ext.Context, err error) ext.DispatcherAction {
 			t.log.Error("handling update:", sl.Err(err))
@@ -120,24 +238,37 @@ func (t *TgBot) Start() error {
 	})
 	t.updater = ext.NewUpdater(dispatcher, nil)
 
+	// Runs ahead of the command handlers, recording when each user was last seen
+	dispatcher.AddHandlerToGroup(handlers.NewMessage(message.Command, t.touchUser), -1)
+
 	// User commands
-	dispatcher.AddHandler(handlers.NewCommand("start", t.start))
-	dispatcher.AddHandler(handlers.NewCommand("stop", t.stop))
-	dispatcher.AddHandler(handlers.NewCommand("level", t.level))
-	dispatcher.AddHandler(handlers.NewCommand("topics", t.topics))
-	dispatcher.AddHandler(handlers.NewCommand("subscribe", t.subscribe))
-	dispatcher.AddHandler(handlers.NewCommand("unsubscribe", t.unsubscribe))
-	dispatcher.AddHandler(handlers.NewCommand("tier", t.tier))
-	dispatcher.AddHandler(handlers.NewCommand("status", t.status))
-	dispatcher.AddHandler(handlers.NewCommand("help", t.help))
+	dispatcher.AddHandler(t.command("start", t.start))
+	dispatcher.AddHandler(t.command("stop", t.stop))
+	dispatcher.AddHandler(t.command("level", t.level))
+	dispatcher.AddHandler(t.command("topics", t.topics))
+	dispatcher.AddHandler(t.command("subscribe", t.subscribe))
+	dispatcher.AddHandler(t.command("unsubscribe", t.unsubscribe))
+	dispatcher.AddHandler(t.command("tier", t.tier))
+	dispatcher.AddHandler(t.command("mute", t.mute))
+	dispatcher.AddHandler(t.command("timezone", t.timezoneCmd))
+	dispatcher.AddHandler(t.command("digest", t.digestCmd))
+	dispatcher.AddHandler(t.command("status", t.status))
+	dispatcher.AddHandler(t.command("help", t.help))
 
 	// Admin commands
-	dispatcher.AddHandler(handlers.NewCommand("users", t.usersCmd))
-	dispatcher.AddHandler(handlers.NewCommand("approve", t.approve))
-	dispatcher.AddHandler(handlers.NewCommand("revoke", t.revoke))
-	dispatcher.AddHandler(handlers.NewCommand("admin", t.adminCmd))
-	dispatcher.AddHandler(handlers.NewCommand("invite", t.invite))
-	dispatcher.AddHandler(handlers.NewCommand("retries", t.retries))
+	dispatcher.AddHandler(t.command("users", t.usersCmd))
+	dispatcher.AddHandler(t.command("approve", t.approve))
+	dispatcher.AddHandler(t.command("revoke", t.revoke))
+	dispatcher.AddHandler(t.command("admin", t.adminCmd))
+	dispatcher.AddHandler(t.command("invite", t.invite))
+	dispatcher.AddHandler(t.command("retries", t.retries))
+	dispatcher.AddHandler(t.command("metrics", t.metricsCmd))
+	dispatcher.AddHandler(t.command("reload", t.reloadCmd))
+	dispatcher.AddHandler(t.command("export", t.exportCmd))
+	dispatcher.AddHandler(t.command("features", t.featuresCmd))
+	dispatcher.AddHandler(t.command("feature", t.featureCmd))
+	dispatcher.AddHandler(t.command("order", t.orderCmd))
+	dispatcher.AddHandler(t.command("invoice", t.invoiceCmd))
 
 	// Callback query handlers
 	dispatcher.AddHandler(handlers.NewCallback(callbackquery.Prefix(cbTopicToggle), t.onTopicCallback))
@@ -145,6 +276,9 @@ func (t *TgBot) Start() error {
 	dispatcher.AddHandler(handlers.NewCallback(callbackquery.Prefix(cbLevel), t.onLevelCallback))
 	dispatcher.AddHandler(handlers.NewCallback(callbackquery.Prefix(cbApprove), t.onApproveCallback))
 	dispatcher.AddHandler(handlers.NewCallback(callbackquery.Prefix(cbRevoke), t.onRevokeCallback))
+	dispatcher.AddHandler(handlers.NewCallback(callbackquery.Prefix(cbOpen), t.onOpenCallback))
+	dispatcher.AddHandler(handlers.NewCallback(callbackquery.Prefix(cbAck), t.onAckCallback))
+	dispatcher.AddHandler(handlers.NewCallback(callbackquery.Prefix(cbConfirm), t.onConfirmCallback))
 
 	// Set default bot command menu and sync per-user menus
 	t.setDefaultCommands()
@@ -162,6 +296,7 @@ func (t *TgBot) Start() error {
 	if err != nil {
 		return fmt.Errorf("failed to start polling: %w", err)
 	}
+	t.polling.Store(true)
 
 	t.updater.Idle()
 	return nil
@@ -171,24 +306,39 @@ func (t *TgBot) Stop() {
 	if t.digest != nil {
 		t.digest.Stop()
 	}
+	if t.escalator != nil {
+		t.escalator.Stop()
+	}
 	if t.updater != nil {
 		t.log.Info("stopping telegram bot")
+		t.polling.Store(false)
 		t.updater.Stop()
 	}
+	t.menuWG.Wait()
+}
+
+// Ping reports whether the bot is polling for updates, for the health endpoint.
+func (t *TgBot) Ping(_ context.Context) error {
+	if !t.polling.Load() {
+		return errors.New("telegram bot is not polling")
+	}
+	return nil
 }
 
 // loadUsers refreshes the in-memory user cache from the database.
 // Called on startup and after every state-changing operation (approve, topic change, etc.).
 // Rebuilds the adminIds list used by notifyAdmins.
-func (t *TgBot) loadUsers() {
+func (t *TgBot) loadUsers() error {
 	if t.db == nil {
-		return
+		return nil
 	}
 	users, err := t.db.GetAllTelegramUsers()
 	if err != nil {
 		t.log.Error("loading users", sl.Err(err))
-		return
+		return err
 	}
+	// Deferred before the lock, so it starts once the cache is refreshed and unlocked.
+	defer t.updateMenusInBackground()
 
 	t.mu.Lock()
 	defer t.mu.Unlock()
@@ -210,6 +360,33 @@ func (t *TgBot) loadUsers() {
 		slog.Int("active", active),
 		slog.Int("admins", len(t.adminIds)),
 	).Debug("loaded users")
+	return nil
+}
+
+// touchUser records that a known user issued a command, in the database and in the
+// cache. It never stops the command from being handled.
+func (t *TgBot) touchUser(_ *tgbotapi.Bot, ctx *ext.Context) error {
+	if t.db == nil || ctx.EffectiveUser == nil {
+		return nil
+	}
+	id := ctx.EffectiveUser.Id
+	if t.findUser(id) == nil {
+		return nil
+	}
+	if err := t.db.TouchUser(id); err != nil {
+		t.log.With(slog.Int64("user_id", id), sl.Err(err)).Warn("touch user")
+		return nil
+	}
+
+	// Replace rather than modify the cached user, which readers use without the lock.
+	t.mu.Lock()
+	if user, ok := t.users[id]; ok {
+		seen := *user
+		seen.LastSeen = t.clock.Now()
+		t.users[id] = &seen
+	}
+	t.mu.Unlock()
+	return nil
 }
 
 func (t *TgBot) findUser(id int64) *entity.User {
@@ -0,0 +1,93 @@
+package bot
+
+import (
+	"log/slog"
+	"sync"
+	"wfsync/lib/sl"
+
+	tgbotapi "github.com/PaulSonOfLars/gotgbot/v2"
+)
+
+// maxTrackedOrders bounds the orders whose notification messages are remembered; the
+// oldest order is forgotten first.
+const maxTrackedOrders = 500
+
+// sentMessage is a notification message delivered to a chat, with the text it was
+// sent with.
+type sentMessage struct {
+	ChatId    int64
+	MessageId int64
+	Text      string
+}
+
+// orderMessages remembers the notification messages sent about each order, so they can
+// be edited when the order's status changes. In memory only: messages sent before a
+// restart are no longer edited.
+// Thread-safe: notifications are sent from the core's goroutines.
+type orderMessages struct {
+	mu      sync.Mutex
+	byOrder map[string][]sentMessage // order id → messages
+	orders  []string                 // order ids, oldest first
+	limit   int
+}
+
+func newOrderMessages(limit int) *orderMessages {
+	return &orderMessages{
+		byOrder: make(map[string][]sentMessage),
+		limit:   limit,
+	}
+}
+
+// Track records messages sent about an order.
+func (o *orderMessages) Track(orderId string, msgs []sentMessage) {
+	if len(msgs) == 0 {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if _, ok := o.byOrder[orderId]; !ok {
+		o.orders = append(o.orders, orderId)
+		if len(o.orders) > o.limit {
+			delete(o.byOrder, o.orders[0])
+			o.orders = o.orders[1:]
+		}
+	}
+	o.byOrder[orderId] = append(o.byOrder[orderId], msgs...)
+}
+
+// Messages returns a copy of the messages sent about an order.
+func (o *orderMessages) Messages(orderId string) []sentMessage {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	msgs := make([]sentMessage, len(o.byOrder[orderId]))
+	copy(msgs, o.byOrder[orderId])
+	return msgs
+}
+
+// editOrderMessages rewrites the messages already sent about an order with a status
+// line below their original text, so they no longer mislead once the order moves on.
+// status is MarkdownV2; each edit replaces the previous status line.
+func (t *TgBot) editOrderMessages(orderId, status string) {
+	if t.sentOrders == nil {
+		return
+	}
+	for _, m := range t.sentOrders.Messages(orderId) {
+		text := m.Text + "\n*Update:* " + status
+		_, _, err := t.api.EditMessageText(text, &tgbotapi.EditMessageTextOpts{
+			ChatId:    m.ChatId,
+			MessageId: m.MessageId,
+			ParseMode: "MarkdownV2",
+		})
+		if err != nil {
+			t.log.With(slog.Int64("id", m.ChatId), slog.String("order_id", orderId)).Warn("editing order message", sl.Err(err))
+			// Fallback: try without markdown
+			_, _, err = t.api.EditMessageText(stripMarkdown(text), &tgbotapi.EditMessageTextOpts{
+				ChatId:    m.ChatId,
+				MessageId: m.MessageId,
+			})
+			if err != nil {
+				t.log.With(slog.Int64("id", m.ChatId), slog.String("order_id", orderId)).Error("editing order message fallback", sl.Err(err))
+			}
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package bot
+
+import (
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"wfsync/entity"
+	"wfsync/lib/clock"
+
+	tgbotapi "github.com/PaulSonOfLars/gotgbot/v2"
+)
+
+// TestNotifyEditsOrderMessages sends an invoice notification and then a payment one for
+// the same order: the invoice message, to the user and to the group, is edited to show
+// the payment, while a notification about another order edits nothing.
+func TestNotifyEditsOrderMessages(t *testing.T) {
+	client := &fakeBotClient{}
+	bot := &TgBot{
+		log: slog.New(slog.NewTextHandler(io.Discard, nil)),
+		api: &tgbotapi.Bot{Token: "token", BotClient: client},
+		users: map[int64]*entity.User{
+			7: {TelegramId: 7, TelegramRole: entity.RoleUser, TelegramEnabled: true},
+		},
+		config:     BotConfig{Groups: []GroupConfig{{ChatId: -100}}},
+		clock:      clock.Real,
+		sentOrders: newOrderMessages(maxTrackedOrders),
+	}
+
+	bot.Notify(entity.TopicOrder, slog.LevelInfo, &entity.Notification{
+		Event:  entity.EventOrderInvoiced,
+		Fields: map[string]string{"order_id": "12", "invoice": "FV 1/2025"},
+	})
+	if got := bot.sentOrders.Messages("12"); len(got) != 2 {
+		t.Fatalf("tracked messages = %v, want the user's and the group's", got)
+	}
+
+	client.methods, client.params = nil, nil
+	bot.Notify(entity.TopicPayment, slog.LevelInfo, &entity.Notification{
+		Event:  entity.EventPaymentCaptured,
+		Fields: map[string]string{"order_id": "12", "captured": "10.00", "authorized": "10.00"},
+	})
+	edited := map[string]string{}
+	for i, method := range client.methods {
+		if method == "editMessageText" {
+			edited[client.params[i]["chat_id"]] = client.params[i]["text"]
+			if client.params[i]["message_id"] != "1" {
+				t.Errorf("edited message_id = %q, want 1", client.params[i]["message_id"])
+			}
+		}
+	}
+	for _, chat := range []string{"7", "-100"} {
+		text := edited[chat]
+		if !strings.Contains(text, "Order 12 invoiced: FV 1/2025") ||
+			!strings.Contains(text, "*Update:* Order 12 captured 10\\.00 of 10\\.00") {
+			t.Errorf("chat %s edited to %q, want the invoice with the payment status", chat, text)
+		}
+	}
+	if got := len(bot.sentOrders.Messages("12")); got != 4 {
+		t.Errorf("tracked messages = %d, want 4 after the payment notification", got)
+	}
+
+	client.methods, client.params = nil, nil
+	bot.Notify(entity.TopicOrder, slog.LevelInfo, &entity.Notification{
+		Event:  entity.EventOrderInvoiced,
+		Fields: map[string]string{"order_id": "13", "invoice": "FV 2/2025"},
+	})
+	for _, method := range client.methods {
+		if method == "editMessageText" {
+			t.Errorf("bot calls = %v, want no edits for a new order", client.methods)
+			break
+		}
+	}
+}
+
+// TestOrderMessagesLimit checks that the oldest order is forgotten past the limit.
+func TestOrderMessagesLimit(t *testing.T) {
+	o := newOrderMessages(2)
+	for i, id := range []string{"1", "2", "1", "3"} {
+		o.Track(id, []sentMessage{{ChatId: 7, MessageId: int64(i + 1)}})
+	}
+
+	if got := o.Messages("1"); len(got) != 0 {
+		t.Errorf("order 1 messages = %v, want forgotten", got)
+	}
+	if got := o.Messages("2"); len(got) != 1 {
+		t.Errorf("order 2 messages = %v, want one", got)
+	}
+	if got := o.Messages("3"); len(got) != 1 || got[0].MessageId != 4 {
+		t.Errorf("order 3 messages = %v, want message 4", got)
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"syscall"
 	"time"
 	"wfsync/bot"
+	"wfsync/entity"
 	"wfsync/impl/auth"
 	"wfsync/impl/core"
 	"wfsync/internal/config"
@@ -18,8 +19,11 @@ import (
 	"wfsync/internal/vatrates"
 	"wfsync/internal/vies"
 	"wfsync/internal/wfirma"
+	"wfsync/lib/audit"
+	"wfsync/lib/features"
 	"wfsync/lib/logger"
 	"wfsync/lib/sl"
+	"wfsync/lib/validate"
 	occlient "wfsync/opencart/oc-client"
 )
 
@@ -40,6 +44,10 @@ func main() {
 		slog.String("location", conf.Location),
 	).Info("config loaded")
 
+	if err := validate.SetLocale(conf.Listen.Locale); err != nil {
+		log.Warn("validation locale", sl.Err(err))
+	}
+
 	mongo := database.NewMongoClient(conf)
 	if mongo != nil {
 		log.With(
@@ -57,6 +65,25 @@ func main() {
 		if err := mongo.DedupeCheckoutParams(); err != nil {
 			log.Error("checkout params dedupe migration", sl.Err(err))
 		}
+		// Expired idempotency keys are dropped by a TTL index.
+		if err := mongo.EnsureIdempotencyIndex(); err != nil {
+			log.Error("idempotency ttl index", sl.Err(err))
+		}
+	}
+
+	// Invoice creation, payment captures and cancels, and role changes are recorded in
+	// the append-only audit_log collection.
+	var auditLog *audit.Log
+	if mongo != nil {
+		auditLog = audit.New(mongo, log)
+	}
+
+	// Runtime switches for Stripe, wFirma, OpenCart and Telegram, stored in the
+	// feature_flags collection; without Mongo every subsystem stays enabled.
+	var flags *features.Flags
+	if mongo != nil {
+		flags = features.New(mongo, log)
+		flags.SetAuditLog(auditLog)
 	}
 
 	// Initialize Telegram bot if enabled
@@ -65,16 +92,34 @@ func main() {
 		botCfg := bot.BotConfig{
 			RequireApproval:   conf.Telegram.RequireApproval,
 			DigestIntervalMin: conf.Telegram.DigestIntervalMin,
+			DigestMaxEntries:  conf.Telegram.DigestMaxEntries,
 			DefaultTier:       conf.Telegram.DefaultTier,
 			InviteCodeLength:  conf.Telegram.InviteCodeLength,
+			UserTopics:        conf.Telegram.UserTopics,
+			AdminTopics:       conf.Telegram.AdminTopics,
+			Language:          conf.Telegram.Language,
+			Templates:         conf.Telegram.Templates,
+			EscalationMin:     conf.Telegram.EscalationWindowMin,
+			CommandSuffix:     conf.Telegram.CommandSuffix,
+			AdminIds:          conf.Telegram.AdminIds,
+			MinLevel:          conf.Telegram.Level(),
+		}
+		for _, g := range conf.Telegram.Groups {
+			botCfg.Groups = append(botCfg.Groups, bot.GroupConfig{
+				ChatId:          g.ChatId,
+				MessageThreadId: g.MessageThreadId,
+				Topics:          g.Topics,
+			})
 		}
 		var err error
 		tgBot, err = bot.NewTgBot(conf.Telegram.ApiKey, mongo, log, botCfg)
 		if err != nil {
 			log.Error("initialize telegram bot", sl.Err(err))
 		} else {
+			tgBot.SetAuditLog(auditLog)
+			tgBot.SetFeatures(flags)
 			// Set up Telegram handler for the logger
-			log = logger.SetupTelegramHandler(log, tgBot, slog.LevelDebug)
+			log = logger.SetupTelegramHandler(log, tgBot, conf.Telegram.Level())
 			// Start the bot in a goroutine
 			go func() {
 				if err = tgBot.Start(); err != nil {
@@ -90,8 +135,16 @@ func main() {
 		log.Error("opencart client", sl.Err(err))
 	}
 
-	wfirmaClient := wfirma.NewClient(conf, log)
+	wfirmaClient, err := wfirma.NewClient(conf, log)
+	if err != nil {
+		log.Error("wfirma client", sl.Err(err))
+		return
+	}
 	wfirmaClient.SetDatabase(mongo)
+	wfirmaClient.SetFeatures(flags)
+	if tgBot != nil {
+		tgBot.SetInvoiceDownloader(wfirmaClient, conf.FilePath)
+	}
 
 	// Sync wFirma company (bank) accounts into the local DB on startup so the
 	// invoice flow can pick the right account by currency. Non-fatal — if this
@@ -118,14 +171,34 @@ func main() {
 		wfirmaClient.SetVIESProvider(viesService)
 	}
 
-	stripeClient := stripeclient.New(conf, log)
+	stripeClient, err := stripeclient.New(conf, log)
+	if err != nil {
+		log.Error("stripe client", sl.Err(err))
+		return
+	}
 	stripeClient.SetDatabase(mongo)
+	stripeClient.SetFeatures(flags)
 
 	handler := core.New(conf, log)
 	handler.SetStripeClient(stripeClient)
 	handler.SetInvoiceService(wfirmaClient)
+	handler.SetFeatures(flags)
 	if mongo != nil {
 		handler.SetPaymentDatabase(mongo)
+		handler.SetIdempotencyStore(mongo)
+		handler.SetDraftStore(mongo)
+		handler.SetEventStore(mongo)
+		handler.SetAuditLog(auditLog)
+	}
+	if tgBot != nil {
+		handler.SetNotifier(tgBot)
+	}
+	// Lock orders across instances polling the same OpenCart database, and let the
+	// processor restore document ids from Mongo; must be set before SetOpencart starts it.
+	if oc != nil && mongo != nil {
+		oc.WithOrderLocker(mongo)
+		oc.WithDocumentStore(mongo)
+		oc.WithFeatures(flags)
 	}
 	handler.SetOpencart(oc)
 
@@ -135,6 +208,8 @@ func main() {
 		retryQueue.SetDatabase(mongo)
 		retryQueue.SetInvoiceService(wfirmaClient)
 		retryQueue.SetOpencart(oc)
+		retryQueue.SetRegistrar(&handler)
+		retryQueue.SetRefunder(&handler)
 		handler.SetRetryQueue(retryQueue)
 		retryQueue.Start()
 		log.Info("retry queue started",
@@ -151,6 +226,63 @@ func main() {
 			slog.Int("interval_min", conf.PaymentReconciler.IntervalMin))
 	}
 
+	var archiver *core.Archiver
+	if conf.Retention.Enabled && mongo != nil {
+		archiver = core.NewArchiver(log, conf.Retention.IntervalMin, conf.Retention.MaxAgeDays, conf.Retention.BatchSize)
+		archiver.SetDatabase(mongo)
+		archiver.Start()
+		log.Info("checkout params archiver started",
+			slog.Int("interval_min", conf.Retention.IntervalMin),
+			slog.Int("max_age_days", conf.Retention.MaxAgeDays))
+	}
+
+	var janitor *core.FileJanitor
+	if conf.FileJanitor.Enabled && mongo != nil && conf.FilePath != "" {
+		// Files from before tracked_since are not recorded anywhere; without the date
+		// every one of them would look orphaned.
+		trackedSince, err := time.Parse(time.DateOnly, conf.FileJanitor.TrackedSince)
+		if err != nil {
+			log.With(
+				slog.String("tracked_since", conf.FileJanitor.TrackedSince),
+				sl.Err(err),
+			).Error("file janitor not started: invalid tracked_since")
+		} else {
+			janitor = core.NewFileJanitor(log, conf.FilePath, conf.FileJanitor.IntervalMin, conf.FileJanitor.GraceHours, trackedSince)
+			janitor.AddReferences(mongo)
+			if oc != nil {
+				janitor.AddReferences(oc)
+			}
+			janitor.Start()
+			log.Info("file janitor started",
+				slog.Int("interval_min", conf.FileJanitor.IntervalMin),
+				slog.Int("grace_hours", conf.FileJanitor.GraceHours),
+				slog.String("tracked_since", conf.FileJanitor.TrackedSince))
+		}
+	}
+
+	// GET /health and /readyz probe these subsystems. Mongo and the OpenCart database are
+	// required for /health; the enabled external APIs and the bot being down only degrade
+	// it, but take the instance out of rotation through /readyz.
+	if mongo != nil {
+		handler.AddHealthCheck("mongo", true, mongo.Ping)
+	}
+	if oc != nil {
+		handler.AddHealthCheck(entity.FeatureOpenCart, true, oc.Ping)
+	}
+	stripeKey := conf.Stripe.APIKey
+	if conf.Stripe.TestMode {
+		stripeKey = conf.Stripe.TestKey
+	}
+	if stripeKey != "" {
+		handler.AddHealthCheck(entity.FeatureStripe, false, stripeClient.Ping)
+	}
+	if conf.WFirma.Enabled {
+		handler.AddHealthCheck(entity.FeatureWFirma, false, wfirmaClient.Ping)
+	}
+	if tgBot != nil {
+		handler.AddHealthCheck(entity.FeatureTelegram, false, tgBot.Ping)
+	}
+
 	authenticate := auth.New(mongo)
 	handler.SetAuthService(authenticate)
 
@@ -184,6 +316,14 @@ func main() {
 		reconciler.Stop()
 	}
 
+	if archiver != nil {
+		archiver.Stop()
+	}
+
+	if janitor != nil {
+		janitor.Stop()
+	}
+
 	if retryQueue != nil {
 		retryQueue.Stop()
 	}
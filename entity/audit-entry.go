@@ -0,0 +1,26 @@
+package entity
+
+import "time"
+
+// Audit actions recorded in the audit log.
+const (
+	AuditInvoiceCreate  = "invoice.create"
+	AuditInvoiceCorrect = "invoice.correct"
+	AuditProformaCreate = "proforma.create"
+	AuditPaymentCapture = "payment.capture"
+	AuditPaymentCancel  = "payment.cancel"
+	AuditRoleChange     = "user.role"
+	AuditFeatureToggle  = "feature.toggle"
+)
+
+// AuditEntry records one state-changing operation: who (Actor) did what (Action) to
+// which object (Target), with the relevant state before and after. Before is empty for
+// creations. Entries are only ever appended.
+type AuditEntry struct {
+	Time   time.Time   `json:"time" bson:"time"`
+	Actor  string      `json:"actor" bson:"actor"`
+	Action string      `json:"action" bson:"action"`
+	Target string      `json:"target" bson:"target"`
+	Before interface{} `json:"before,omitempty" bson:"before,omitempty"`
+	After  interface{} `json:"after,omitempty" bson:"after,omitempty"`
+}
@@ -0,0 +1,14 @@
+package entity
+
+import "errors"
+
+// ErrBatchTimeLimit is the outcome of a batch order not started because too little of the
+// request's time was left to invoice it; the caller sends it again.
+var ErrBatchTimeLimit = errors.New("not processed: batch time limit reached, send the order again")
+
+// B2BBatchOutcome is the result of one order of a batch request: the created document,
+// or the error that stopped it.
+type B2BBatchOutcome struct {
+	Payment *Payment
+	Err     error
+}
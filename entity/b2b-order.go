@@ -2,10 +2,12 @@ package entity
 
 import (
 	"errors"
+	"fmt"
 	"math"
 	"net/http"
 	"strings"
 	"time"
+	"wfsync/lib/money"
 	"wfsync/lib/validate"
 )
 
@@ -19,6 +21,10 @@ const (
 // 400 validation error so the calling system can reconcile its VAT calculation.
 var ErrVATRateMismatch = errors.New("vat rate mismatch")
 
+// ErrCallbackUnsigned rejects an order asking for a callback while no callback secret is
+// configured: the receiver could not tell the callback from a forged one.
+var ErrCallbackUnsigned = errors.New("callback_url requires b2b.callback_secret to be configured")
+
 type B2BOrder struct {
 	OrderUID        string     `json:"order_uid" validate:"required"`
 	OrderNumber     string     `json:"order_number" validate:"required"`
@@ -46,6 +52,11 @@ type B2BOrder struct {
 	CurrencyCode    string     `json:"currency_code" validate:"required,oneof=PLN EUR USD"`
 	CreatedAt       time.Time  `json:"created_at"`
 	Items           []*B2BItem `json:"items" validate:"required,min=1,dive"`
+	// CallbackURL, when set, receives a signed POST of the resulting Payment once the
+	// document is created, so the B2B system does not have to poll for the outcome.
+	CallbackURL string `json:"callback_url,omitempty" validate:"omitempty,url"`
+	// IncludePDF asks for the generated PDF inline (Payment.FileData) in addition to the link.
+	IncludePDF bool `json:"include_pdf,omitempty"`
 }
 
 type B2BItem struct {
@@ -58,10 +69,70 @@ type B2BItem struct {
 	PriceDiscount float64 `json:"price_discount"`
 	Tax           float64 `json:"tax"`
 	Total         float64 `json:"total"`
+	// TaxExempt marks a 0% VAT product; it is carried over to the invoice line item.
+	TaxExempt bool `json:"tax_exempt,omitempty"`
+	// Unit is the invoice measurement unit (e.g. "godz."); empty prints "szt.".
+	Unit string `json:"unit,omitempty" validate:"omitempty,max=10"`
 }
 
-func (o *B2BOrder) Bind(_ *http.Request) error {
-	return validate.Struct(o)
+// b2bItemTotalTolerance is the allowed rounding difference per unit between an item's
+// total and its unit price times quantity: portals round the discounted unit price and
+// the line total independently, so each unit may drift by up to a grosz/cent.
+const b2bItemTotalTolerance = 0.01
+
+func (o *B2BOrder) Bind(r *http.Request) error {
+	if err := validate.Request(r, o); err != nil {
+		return err
+	}
+	return o.ValidateItems()
+}
+
+// ValidateItems checks each item's amounts for internal consistency, so a malformed
+// payload is rejected instead of producing an invoice that silently disagrees with the
+// portal. The invoice is built from the unit price, so a total that does not follow from
+// it means the two systems disagree on what was sold. Total is optional (0 skips the
+// check) and may be given net or gross of the item's tax.
+func (o *B2BOrder) ValidateItems() error {
+	var problems []string
+	for i, item := range o.Items {
+		if item == nil {
+			continue
+		}
+		if err := item.validate(); err != nil {
+			problems = append(problems, fmt.Sprintf("items[%d] (%s): %v", i, item.ProductName, err))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// EffectivePrice is the unit price the invoice is issued at: the discounted price when
+// the portal supplies one, the list price otherwise.
+func (i *B2BItem) EffectivePrice() float64 {
+	if i.PriceDiscount > 0 {
+		return i.PriceDiscount
+	}
+	return i.Price
+}
+
+func (i *B2BItem) validate() error {
+	if i.PriceDiscount < 0 {
+		return fmt.Errorf("price_discount %.2f is negative", i.PriceDiscount)
+	}
+	if i.PriceDiscount > i.Price {
+		return fmt.Errorf("price_discount %.2f exceeds price %.2f", i.PriceDiscount, i.Price)
+	}
+	if i.Total == 0 {
+		return nil
+	}
+	net := i.EffectivePrice() * float64(i.Quantity)
+	tolerance := b2bItemTotalTolerance * float64(i.Quantity)
+	if math.Abs(i.Total-net) <= tolerance || (i.Tax != 0 && math.Abs(i.Total-net-i.Tax) <= tolerance) {
+		return nil
+	}
+	return fmt.Errorf("total %.2f does not match %d × %.2f = %.2f", i.Total, i.Quantity, i.EffectivePrice(), net)
 }
 
 // ToCheckoutParams converts B2BOrder to CheckoutParams format.
@@ -89,7 +160,7 @@ func (o *B2BOrder) ToCheckoutParams() *CheckoutParams {
 			ZipCode: zipcode,
 			TaxId:   o.ClientVAT,
 		},
-		Total:         floatToCents(o.Total),
+		Total:         money.Cents(o.Total),
 		Currency:      o.CurrencyCode,
 		OrderId:       o.OrderNumber,
 		// The B2B portal is a separate system with its own id space, so OrderNumber can
@@ -100,26 +171,24 @@ func (o *B2BOrder) ToCheckoutParams() *CheckoutParams {
 		SuccessUrl:    "https://b2b.internal/success",
 		Created:       time.Now(),
 		Source:        SourceB2B,
-		TaxValue:      floatToCents(o.TotalVAT),
-		SubTotal:      floatToCents(o.Subtotal),
+		TaxValue:      money.Cents(o.TotalVAT),
+		SubTotal:      money.Cents(o.Subtotal),
 		CustomerGroup: DefaultCustomerGroupB2B,
 	}
 
 	if o.Shipment > 0 {
-		params.Shipping = floatToCents(o.Shipment)
+		params.Shipping = money.Cents(o.Shipment)
 		params.LineItems = append(params.LineItems, ShippingLineItem("", params.Shipping))
 	}
 
 	for _, item := range o.Items {
-		price := item.Price
-		if item.PriceDiscount > 0 {
-			price = item.PriceDiscount
-		}
 		lineItem := &LineItem{
-			Name:  item.ProductName,
-			Qty:   item.Quantity,
-			Price: floatToCents(price),
-			Sku:   item.ProductSKU,
+			Name:      item.ProductName,
+			Qty:       item.Quantity,
+			Price:     money.Cents(item.EffectivePrice()),
+			Sku:       item.ProductSKU,
+			TaxExempt: item.TaxExempt,
+			Unit:      item.Unit,
 		}
 		params.LineItems = append(params.LineItems, lineItem)
 	}
@@ -136,8 +205,3 @@ func firstNonEmpty(values ...string) string {
 	}
 	return ""
 }
-
-// floatToCents converts a float64 amount to int64 cents
-func floatToCents(amount float64) int64 {
-	return int64(math.Round(amount * 100))
-}
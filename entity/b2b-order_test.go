@@ -0,0 +1,62 @@
+package entity
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestB2BItemConsistency checks that item totals must follow from the unit price the
+// invoice is built from, and that a discounted price above the list price is rejected.
+func TestB2BItemConsistency(t *testing.T) {
+	cases := []struct {
+		name    string
+		item    B2BItem
+		wantErr string
+	}{
+		{"no total given", B2BItem{ProductName: "A", Quantity: 2, Price: 10}, ""},
+		{"net total matches", B2BItem{ProductName: "A", Quantity: 3, Price: 10, Total: 30}, ""},
+		{"gross total matches", B2BItem{ProductName: "A", Quantity: 3, Price: 10, Tax: 6.9, Total: 36.9}, ""},
+		{"discounted price used", B2BItem{ProductName: "A", Quantity: 2, Price: 10, PriceDiscount: 8.5, Total: 17}, ""},
+		{"rounding within tolerance", B2BItem{ProductName: "A", Quantity: 3, Price: 3.33, Total: 10}, ""},
+		{"total off", B2BItem{ProductName: "A", Quantity: 2, Price: 10, Total: 25}, "does not match"},
+		{"total ignores discount", B2BItem{ProductName: "A", Quantity: 2, Price: 10, PriceDiscount: 8, Total: 20}, "does not match"},
+		{"discount above price", B2BItem{ProductName: "A", Quantity: 1, Price: 10, PriceDiscount: 12}, "exceeds price"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.item.validate()
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("error = %v, want %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+// TestValidateItemsReportsEachItem checks that every offending item is named in the
+// error so the portal can fix the payload in one round trip.
+func TestValidateItemsReportsEachItem(t *testing.T) {
+	order := &B2BOrder{Items: []*B2BItem{
+		{ProductName: "Good", Quantity: 1, Price: 10, Total: 10},
+		{ProductName: "Bad total", Quantity: 2, Price: 10, Total: 30},
+		{ProductName: "Bad discount", Quantity: 1, Price: 10, PriceDiscount: 11},
+	}}
+	err := order.ValidateItems()
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	msg := err.Error()
+	for _, want := range []string{"items[1] (Bad total)", "items[2] (Bad discount)"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("error %q does not mention %q", msg, want)
+		}
+	}
+	if strings.Contains(msg, "items[0]") {
+		t.Errorf("error %q mentions the consistent item", msg)
+	}
+}
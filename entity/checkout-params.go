@@ -9,6 +9,7 @@ import (
 	"strings"
 	"time"
 	"unicode"
+	"wfsync/lib/money"
 	"wfsync/lib/validate"
 
 	"github.com/biter777/countries"
@@ -28,8 +29,17 @@ type CheckoutParams struct {
 	LineItems     []*LineItem    `json:"line_items" bson:"line_items" validate:"required,min=1,dive"`
 	Total         int64          `json:"total" bson:"total" validate:"required,min=1"`
 	Shipping      int64          `json:"shipping,omitempty" bson:"shipping,omitempty"`
+	// ShippingVatRate taxes the shipping line at its own rate (e.g. 0 for shipping that is
+	// a separate, exempt service). Nil follows wfirma.shipping_vat_code or the goods rate.
+	ShippingVatRate *int         `json:"shipping_vat_rate,omitempty" bson:"shipping_vat_rate,omitempty" validate:"omitempty,min=0,max=100"`
 	TaxTitle      string         `json:"tax_title" bson:"tax_title"`
 	TaxValue      int64          `json:"tax_value" bson:"tax_value"`
+	// AutomaticTax lets Stripe Tax compute the VAT of a checkout. Line prices are treated
+	// as tax-inclusive; the computed tax is read back from the completed session.
+	AutomaticTax  bool           `json:"automatic_tax,omitempty" bson:"automatic_tax,omitempty"`
+	// TaxRateError is set when Stripe Tax charged a rate an invoice line cannot carry (a
+	// fractional percentage). Such an order is left for manual review, not invoiced.
+	TaxRateError  string         `json:"-" bson:"tax_rate_error,omitempty"`
 	SubTotal      int64          `json:"sub_total,omitempty" bson:"sub_total,omitempty"`
 	Currency      string         `json:"currency" bson:"currency" validate:"required,oneof=PLN EUR USD"`
 	CurrencyValue float64        `json:"currency_value,omitempty" bson:"currency_value,omitempty"`
@@ -52,25 +62,67 @@ type CheckoutParams struct {
 	InvoiceFile   string         `json:"invoice_file,omitempty" bson:"invoice_file,omitempty"`
 	ProformaId    string         `json:"proforma_id,omitempty" bson:"proforma_id,omitempty"`
 	ProformaFile  string         `json:"proforma_file,omitempty" bson:"proforma_file,omitempty"`
+	// Files lists every document PDF downloaded for the order, split parts included. The
+	// file janitor treats them as in use; InvoiceFile/ProformaFile only name the head document.
+	Files         []string       `json:"-" bson:"files,omitempty"`
 	Paid          bool           `json:"paid,omitempty" bson:"paid"`
+	// Authorized is the amount held on a manual-capture payment; Captured is the amount
+	// captured from it so far. Staged captures may not exceed the difference.
+	Authorized    int64          `json:"authorized,omitempty" bson:"authorized,omitempty"`
+	Captured      int64          `json:"captured,omitempty" bson:"captured,omitempty"`
+	// Refunded is the amount refunded through Stripe so far; CorrectionId is the wFirma
+	// corrective invoice issued for the latest refund.
+	Refunded      int64          `json:"refunded,omitempty" bson:"refunded,omitempty"`
+	CorrectionId  string         `json:"correction_id,omitempty" bson:"correction_id,omitempty"`
 	Source        Source         `json:"source,omitempty" bson:"source"`
 	CustomerGroup int            `json:"customer_group,omitempty" bson:"customer_group,omitempty"`
+	// PaymentMethod is the store's payment method code (OpenCart payment_code, e.g.
+	// "bank_transfer", "cod"); wfirma.payment_methods maps it to the invoice payment method.
+	PaymentMethod string         `json:"payment_method,omitempty" bson:"payment_method,omitempty"`
+	// Mode is ModePayment (one-time, the default) or ModeSubscription, which bills the line
+	// items every IntervalCount Intervals ("day", "week", "month", "year").
+	Mode          string         `json:"mode,omitempty" bson:"mode,omitempty" validate:"omitempty,oneof=payment subscription"`
+	Interval      string         `json:"interval,omitempty" bson:"interval,omitempty" validate:"omitempty,oneof=day week month year"`
+	IntervalCount int64          `json:"interval_count,omitempty" bson:"interval_count,omitempty" validate:"omitempty,min=1"`
+	// Metadata is passed to the Stripe session as-is and restored from it on the webhook
+	// (e.g. "channel", "campaign"). "order_id" is reserved. Limits follow Stripe's.
+	Metadata      map[string]string `json:"metadata,omitempty" bson:"metadata,omitempty" validate:"omitempty,max=49,dive,keys,min=1,max=40,endkeys,max=500"`
 	Payload       interface{}    `json:"payload,omitempty" bson:"payload,omitempty"`
 }
 
-func (c *CheckoutParams) Bind(_ *http.Request) error {
+// metadataOrderId is the Stripe metadata key linking a session back to its order.
+const metadataOrderId = "order_id"
+
+// SupportedCurrency reports whether documents and payments can be issued in the currency,
+// the same set the currency fields accept.
+func SupportedCurrency(code string) bool {
+	switch code {
+	case "PLN", "EUR", "USD":
+		return true
+	}
+	return false
+}
+
+const (
+	ModePayment      = "payment"
+	ModeSubscription = "subscription"
+)
+
+func (c *CheckoutParams) Bind(r *http.Request) error {
 	if c.Created.IsZero() {
 		c.Created = time.Now()
 	}
 	if c.Shipping > 0 {
-		c.LineItems = append(c.LineItems, ShippingLineItem("", c.Shipping))
+		shipping := ShippingLineItem("", c.Shipping)
+		shipping.VatRate = c.ShippingVatRate
+		c.LineItems = append(c.LineItems, shipping)
 	}
 	// Auto-detect B2B: when a TaxId is provided and no customer group is set,
 	// treat the order as B2B so that EU VAT rules (WDT) apply correctly.
 	if c.ClientDetails != nil && c.ClientDetails.TaxId != "" && c.CustomerGroup == 0 {
 		c.CustomerGroup = -1
 	}
-	return validate.Struct(c)
+	return validate.Request(r, c)
 }
 
 // ExternalRef returns the value to use as the wFirma invoice id_external and as the
@@ -84,6 +136,41 @@ func (c *CheckoutParams) ExternalRef() string {
 	return c.OrderId
 }
 
+// CheckoutTerminalStatuses lists the stored statuses after which a checkout record needs
+// no further action. "complete" is deliberately absent: a completed session with manual
+// capture is still an open hold until the reconciler resolves it.
+var CheckoutTerminalStatuses = []string{"paid", "refunded", "canceled", "expired", "void"}
+
+// IsTerminal reports whether the record has reached a final state.
+func (c *CheckoutParams) IsTerminal() bool {
+	if c.Paid {
+		return true
+	}
+	for _, s := range CheckoutTerminalStatuses {
+		if c.Status == s {
+			return true
+		}
+	}
+	return false
+}
+
+// ArchivableBefore reports whether the record is terminal and was last touched before
+// cutoff. Modified is the age reference, with Created as a fallback for legacy records;
+// a record with neither timestamp is kept since its age is unknown.
+func (c *CheckoutParams) ArchivableBefore(cutoff time.Time) bool {
+	if !c.IsTerminal() {
+		return false
+	}
+	ref := c.Modified
+	if ref.IsZero() {
+		ref = c.Created
+	}
+	if ref.IsZero() {
+		return false
+	}
+	return ref.Before(cutoff)
+}
+
 func (c *CheckoutParams) ItemsTotal() int64 {
 	var total int64
 	for _, item := range c.LineItems {
@@ -92,31 +179,123 @@ func (c *CheckoutParams) ItemsTotal() int64 {
 	return total
 }
 
-func (c *CheckoutParams) ValidateTotal() error {
+// ExemptTotal is the value of tax-exempt goods in the order. No tax is charged on them,
+// so they must stay out of the taxable base TaxRate divides TaxValue by.
+func (c *CheckoutParams) ExemptTotal() int64 {
+	var total int64
+	for _, item := range c.LineItems {
+		if item.TaxExempt && !item.Shipping {
+			total += item.Qty * item.Price
+		}
+	}
+	return total
+}
+
+// ValidateTotal checks the order total against the sum of its line items, accepting a
+// rounding gap of up to tolerance minor units either way.
+func (c *CheckoutParams) ValidateTotal(tolerance int64) error {
 	total := c.ItemsTotal()
-	if c.Total == total {
+	if absInt64(c.Total-total) <= tolerance {
 		return nil
 	}
-	return fmt.Errorf("total amount %d does not match sum of line items %d", c.Total, total)
+	return fmt.Errorf("total amount %d does not match sum of line items %d (tolerance %d)", c.Total, total, tolerance)
 }
 
+// RefineTotal rejects a total outside the tolerance and otherwise adjusts the line prices
+// so they add up to the total, since Stripe charges the sum of the lines.
+func (c *CheckoutParams) RefineTotal(tolerance int64) error {
+	if err := c.ValidateTotal(tolerance); err != nil {
+		return err
+	}
+	c.RecalcWithDiscount()
+	return nil
+}
+
+// Validate checks the params before they reach Stripe or wFirma. Free lines (zero price
+// or zero quantity, e.g. a gift or free shipping) are dropped, since both APIs reject them
+// with opaque errors and they add nothing to the total; negative values are an error.
 func (c *CheckoutParams) Validate() error {
+	if err := c.dropFreeLines(); err != nil {
+		return err
+	}
 	if len(c.LineItems) == 0 {
 		return fmt.Errorf("no line items")
 	}
 	if c.ClientDetails == nil {
 		return fmt.Errorf("no client details")
 	}
-	//err := c.ValidateTotal()
+	if c.IsSubscription() && c.Interval == "" {
+		return fmt.Errorf("subscription requires a billing interval")
+	}
+	if err := c.validateCurrencies(); err != nil {
+		return err
+	}
+	//err := c.ValidateTotal(0)
 	//if err != nil {
 	//	return err
 	//}
 	return nil
 }
 
+// validateCurrencies rejects a line priced in another currency than the order (or, for
+// an order without one, than the other lines): its amount would be invoiced as if it
+// were in the order currency.
+func (c *CheckoutParams) validateCurrencies() error {
+	total := money.New(0, c.Currency)
+	for i, item := range c.LineItems {
+		var err error
+		total, err = total.Add(money.New(item.Price*item.Qty, item.Currency))
+		if err != nil {
+			return fmt.Errorf("line item %d (%s): %w", i+1, item.Name, err)
+		}
+	}
+	return nil
+}
+
+// StripeMetadata returns the session metadata: the caller's entries plus order_id, which
+// always wins so the webhook can find the order.
+func (c *CheckoutParams) StripeMetadata() map[string]string {
+	metadata := make(map[string]string, len(c.Metadata)+1)
+	for key, value := range c.Metadata {
+		metadata[key] = value
+	}
+	metadata[metadataOrderId] = c.OrderId
+	return metadata
+}
+
+// IsSubscription reports whether the order is billed on a recurring schedule.
+func (c *CheckoutParams) IsSubscription() bool {
+	return c.Mode == ModeSubscription
+}
+
+// dropFreeLines removes lines that contribute nothing to the order and rejects lines
+// with a negative quantity or price.
+func (c *CheckoutParams) dropFreeLines() error {
+	items := make([]*LineItem, 0, len(c.LineItems))
+	for i, item := range c.LineItems {
+		if item == nil {
+			continue
+		}
+		if item.Qty < 0 {
+			return fmt.Errorf("line item %d (%s): negative quantity %d", i+1, item.Name, item.Qty)
+		}
+		if item.Price < 0 {
+			return fmt.Errorf("line item %d (%s): negative price %d", i+1, item.Name, item.Price)
+		}
+		if item.Qty == 0 || item.Price == 0 {
+			continue
+		}
+		items = append(items, item)
+	}
+	c.LineItems = items
+	return nil
+}
+
 func (c *CheckoutParams) AddShipping(title string, amount int64) {
 	c.Shipping = amount
-	c.LineItems = append(c.LineItems, ShippingLineItem(title, amount))
+	shipping := ShippingLineItem(title, amount)
+	shipping.VatRate = c.ShippingVatRate
+	c.LineItems = append(c.LineItems, shipping)
 }
 
 func (c *CheckoutParams) RecalcWithDiscount() {
@@ -132,7 +311,7 @@ func (c *CheckoutParams) RecalcWithDiscount() {
 		if item.Shipping {
 			continue
 		}
-		item.Price = int64(math.Round(float64(item.Price) * k))
+		item.Price = money.New(item.Price, c.Currency).MulRate(k).Cents
 	}
 	itemsTotal = c.ItemsTotal()
 	diff := c.Total - itemsTotal
@@ -171,21 +350,37 @@ func (c *CheckoutParams) RecalcWithDiscount() {
 //
 // Since VAT rates are always whole numbers, we compute both and pick the result
 // whose fractional part is closest to zero.
-func (c *CheckoutParams) TaxRate() int {
+//
+// On a domestic sale, goods with their own VatRate are invoiced at that rate, so they and
+// their tax are left out as well and the result is the rate of the remaining goods. Other
+// sales ignore per-line rates, like the invoice does.
+func (c *CheckoutParams) TaxRate(domestic bool) int {
 	if c.TaxValue == 0 {
 		return 0
 	}
 
+	// Tax-exempt goods carry no tax, so they are excluded from both taxable bases.
+	exempt := float64(c.ExemptTotal())
+	taxValue := float64(c.TaxValue)
+	if domestic {
+		ownNet, ownTax := c.ownRateTotals()
+		exempt += ownNet
+		taxValue -= ownTax
+		if taxValue <= 0 {
+			return 0
+		}
+	}
+
 	// Method 1: derive net from Total — correct for pre-tax discounts (coupons).
 	var rateFromTotal float64
-	if net := float64(c.Total) - float64(c.Shipping) - float64(c.TaxValue); net > 0 {
-		rateFromTotal = float64(c.TaxValue) * 100 / net
+	if net := float64(c.Total) - float64(c.Shipping) - float64(c.TaxValue) - exempt; net > 0 {
+		rateFromTotal = taxValue * 100 / net
 	}
 
 	// Method 2: use SubTotal from order_total — correct for post-tax discounts
 	// (B2B volume) where OpenCart's OrderPRO module inflates per-product tax.
-	if c.SubTotal > 0 {
-		rateFromSubTotal := float64(c.TaxValue) * 100 / float64(c.SubTotal)
+	if subTotal := float64(c.SubTotal) - exempt; c.SubTotal > 0 && subTotal > 0 {
+		rateFromSubTotal := taxValue * 100 / subTotal
 		if fracPart(rateFromSubTotal) < fracPart(rateFromTotal) {
 			return int(math.Round(rateFromSubTotal))
 		}
@@ -197,17 +392,98 @@ func (c *CheckoutParams) TaxRate() int {
 	return int(math.Round(rateFromTotal))
 }
 
+// ownRateTotals returns the net amount and the tax of the goods lines that carry their
+// own VatRate. Line prices are gross.
+func (c *CheckoutParams) ownRateTotals() (net, tax float64) {
+	for _, item := range c.LineItems {
+		if item.VatRate == nil || item.TaxExempt || item.Shipping {
+			continue
+		}
+		gross := float64(item.Qty * item.Price)
+		lineTax := gross * float64(*item.VatRate) / float64(100+*item.VatRate)
+		net += gross - lineTax
+		tax += lineTax
+	}
+	return net, tax
+}
+
 // fracPart returns the distance from f to its nearest integer.
 func fracPart(f float64) float64 {
 	return math.Abs(f - math.Round(f))
 }
 
+// CaptureRemaining returns the held amount that can still be captured. Holds created
+// before Authorized was recorded were placed for the order total.
+func (c *CheckoutParams) CaptureRemaining() int64 {
+	authorized := c.Authorized
+	if authorized == 0 {
+		authorized = c.Total
+	}
+	return authorized - c.Captured
+}
+
 type LineItem struct {
 	Name     string `json:"name" validate:"required"`
 	Qty      int64  `json:"qty" validate:"required,min=1"`
 	Price    int64  `json:"price" validate:"required,min=1"`
 	Sku      string `json:"sku,omitempty" bson:"sku"`
 	Shipping bool   `json:"shipping,omitempty" bson:"shipping"`
+	// VatRate overrides the order-level rate for this line (e.g. 8 or 5 for reduced-rate
+	// goods in a mixed cart). Nil means "use the order rate"; a pointer keeps an explicit
+	// 0% distinguishable from unset.
+	VatRate *int `json:"vat_rate,omitempty" bson:"vat_rate,omitempty" validate:"omitempty,min=0,max=100"`
+	// TaxExempt marks 0% goods (books, certain services): the line is invoiced at 0%
+	// whatever the order rate, and its value is left out of the TaxRate base.
+	TaxExempt bool `json:"tax_exempt,omitempty" bson:"tax_exempt,omitempty"`
+	// Unit is the invoice measurement unit (e.g. "godz.", "mies.", "kg"). Empty means
+	// DefaultUnit for goods and ShippingUnit for shipping lines.
+	Unit string `json:"unit,omitempty" bson:"unit,omitempty" validate:"omitempty,max=10"`
+	// Currency is the currency the line is priced in, when the source states it. Empty
+	// means the order currency; any other value must match it.
+	Currency string `json:"currency,omitempty" bson:"currency,omitempty"`
+}
+
+const (
+	// DefaultUnit is the invoice unit for goods: pieces (sztuki).
+	DefaultUnit = "szt."
+	// ShippingUnit is the invoice unit for shipping lines, billed as a service (usługa).
+	ShippingUnit = "usł."
+)
+
+// InvoiceUnit returns the unit to print on the invoice for this line.
+func (l *LineItem) InvoiceUnit() string {
+	if unit := strings.TrimSpace(l.Unit); unit != "" {
+		return unit
+	}
+	if l.Shipping {
+		return ShippingUnit
+	}
+	return DefaultUnit
+}
+
+// TruncateName shortens a product name to at most max characters for providers that cap
+// name length. It cuts at the last word boundary that fits and appends "…"; a single word
+// longer than the limit is cut mid-word. max <= 0 disables truncation.
+func TruncateName(name string, max int) string {
+	name = strings.TrimSpace(name)
+	runes := []rune(name)
+	if max <= 0 || len(runes) <= max {
+		return name
+	}
+	if max == 1 {
+		return "…"
+	}
+	isBreak := func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.IsPunct(r)
+	}
+	cut := string(runes[:max-1])
+	if !isBreak(runes[max-1]) {
+		// The limit falls inside a word: drop that word.
+		if i := strings.LastIndexFunc(cut, unicode.IsSpace); i > 0 {
+			cut = cut[:i]
+		}
+	}
+	return strings.TrimRightFunc(cut, isBreak) + "…"
 }
 
 func ShippingLineItem(title string, amount int64) *LineItem {
@@ -221,6 +497,7 @@ func ShippingLineItem(title string, amount int64) *LineItem {
 		Qty:      1,
 		Price:    amount,
 		Shipping: true,
+		Unit:     ShippingUnit,
 	}
 }
 
@@ -232,9 +509,22 @@ type ClientDetails struct {
 	ZipCode string `json:"zip_code" bson:"zip_code"`
 	City    string `json:"city" bson:"city"`
 	Street  string `json:"street" bson:"street"`
+	// Street2 is the second address line (apartment, suite) when the source keeps it
+	// apart, as Stripe does; StreetAddress joins both for documents.
+	Street2 string `json:"street2,omitempty" bson:"street2,omitempty"`
 	TaxId   string `json:"tax_id" bson:"tax_id"`
 }
 
+// StreetAddress returns the street lines joined by a space, skipping empty ones.
+func (c *ClientDetails) StreetAddress() string {
+	line1 := strings.TrimSpace(c.Street)
+	line2 := strings.TrimSpace(c.Street2)
+	if line1 == "" || line2 == "" {
+		return line1 + line2
+	}
+	return line1 + " " + line2
+}
+
 func (c *ClientDetails) CountryCode() string {
 	if c.Country == "" {
 		return ""
@@ -351,10 +641,17 @@ func NewFromCheckoutSession(sess *stripe.CheckoutSession) *CheckoutParams {
 			client.Country = sess.Customer.Address.Country
 			client.ZipCode = sess.Customer.Address.PostalCode
 			client.City = sess.Customer.Address.City
-			client.Street = fmt.Sprintf("%s %s", sess.Customer.Address.Line1, sess.Customer.Address.Line2)
+			client.Street = strings.TrimSpace(sess.Customer.Address.Line1)
+			client.Street2 = strings.TrimSpace(sess.Customer.Address.Line2)
 		}
 		params.ClientDetails = client
 	}
+	if sess.AutomaticTax != nil && sess.AutomaticTax.Enabled {
+		params.AutomaticTax = true
+		if sess.TotalDetails != nil {
+			params.TaxValue = sess.TotalDetails.AmountTax
+		}
+	}
 	if sess.LineItems != nil {
 		for _, item := range sess.LineItems.Data {
 			if item.Quantity == 0 {
@@ -365,6 +662,9 @@ func NewFromCheckoutSession(sess *stripe.CheckoutSession) *CheckoutParams {
 				Qty:   item.Quantity,
 				Price: item.AmountTotal / item.Quantity,
 			}
+			if params.AutomaticTax {
+				params.readStripeTax(lineItem, item.Taxes)
+			}
 			params.LineItems = append(params.LineItems, lineItem)
 		}
 	}
@@ -372,10 +672,19 @@ func NewFromCheckoutSession(sess *stripe.CheckoutSession) *CheckoutParams {
 		params.AddShipping("", sess.ShippingCost.AmountTotal)
 	}
 	if sess.Metadata != nil {
-		id, ok := sess.Metadata["order_id"]
+		id, ok := sess.Metadata[metadataOrderId]
 		if ok {
 			params.OrderId = id
 		}
+		for key, value := range sess.Metadata {
+			if key == metadataOrderId {
+				continue
+			}
+			if params.Metadata == nil {
+				params.Metadata = make(map[string]string)
+			}
+			params.Metadata[key] = value
+		}
 	}
 	if params.OrderId == "" {
 		params.OrderId = sess.ID
@@ -386,6 +695,29 @@ func NewFromCheckoutSession(sess *stripe.CheckoutSession) *CheckoutParams {
 	return params
 }
 
+// readStripeTax copies the rate Stripe Tax applied to a session line onto the invoice
+// line, so the invoice carries the rates Stripe charged. The first rate's display name
+// ("VAT") becomes the order's tax title. Lines Stripe did not tax keep the order rate.
+// A fractional rate is not rounded, which would invoice another tax than was charged:
+// it sets TaxRateError instead.
+func (c *CheckoutParams) readStripeTax(line *LineItem, taxes []*stripe.LineItemTax) {
+	if len(taxes) == 0 || taxes[0] == nil || taxes[0].Rate == nil {
+		return
+	}
+	percentage := taxes[0].Rate.Percentage
+	if percentage != math.Trunc(percentage) {
+		if c.TaxRateError == "" {
+			c.TaxRateError = fmt.Sprintf("stripe tax rate %v%% on %q is not a whole percentage", percentage, line.Name)
+		}
+		return
+	}
+	rate := int(percentage)
+	line.VatRate = &rate
+	if c.TaxTitle == "" {
+		c.TaxTitle = taxes[0].Rate.DisplayName
+	}
+}
+
 func NewFromInvoice(inv *stripe.Invoice) *CheckoutParams {
 	params := &CheckoutParams{
 		SessionId: inv.ID,
@@ -407,7 +739,8 @@ func NewFromInvoice(inv *stripe.Invoice) *CheckoutParams {
 			client.Country = inv.Customer.Address.Country
 			client.ZipCode = inv.Customer.Address.PostalCode
 			client.City = inv.Customer.Address.City
-			client.Street = fmt.Sprintf("%s %s", inv.Customer.Address.Line1, inv.Customer.Address.Line2)
+			client.Street = strings.TrimSpace(inv.Customer.Address.Line1)
+			client.Street2 = strings.TrimSpace(inv.Customer.Address.Line2)
 		}
 		params.ClientDetails = client
 	}
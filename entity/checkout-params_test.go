@@ -0,0 +1,498 @@
+package entity
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"wfsync/lib/money"
+	"wfsync/lib/validate"
+
+	"github.com/stripe/stripe-go/v76"
+)
+
+// TestArchivableBefore pins the retention selection rule against a fixed clock: only
+// terminal records whose last modification (or creation, for legacy records) precedes
+// the cutoff are archived.
+func TestArchivableBefore(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	cutoff := now.Add(-90 * 24 * time.Hour)
+	old := cutoff.Add(-time.Hour)
+	recent := cutoff.Add(time.Hour)
+
+	cases := []struct {
+		name   string
+		params CheckoutParams
+		want   bool
+	}{
+		{"paid status, old", CheckoutParams{Status: "paid", Modified: old}, true},
+		{"refunded, old", CheckoutParams{Status: "refunded", Modified: old}, true},
+		{"canceled, old", CheckoutParams{Status: "canceled", Modified: old}, true},
+		{"expired session, old", CheckoutParams{Status: "expired", Modified: old}, true},
+		{"paid flag, old", CheckoutParams{Status: "complete", Paid: true, Modified: old}, true},
+		{"paid, recent", CheckoutParams{Status: "paid", Modified: recent}, false},
+		{"paid, exactly at cutoff", CheckoutParams{Status: "paid", Modified: cutoff}, false},
+		{"open, old", CheckoutParams{Status: "open", Modified: old}, false},
+		{"complete hold, old", CheckoutParams{Status: "complete", Modified: old}, false},
+		{"empty status, old", CheckoutParams{Modified: old}, false},
+		{"created fallback, old", CheckoutParams{Status: "paid", Created: old}, true},
+		{"modified wins over created", CheckoutParams{Status: "paid", Created: old, Modified: recent}, false},
+		{"no timestamps", CheckoutParams{Status: "paid"}, false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.params.ArchivableBefore(cutoff); got != tc.want {
+				t.Errorf("ArchivableBefore() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+// TestTaxRateExcludesExemptItems checks that 0% goods do not dilute the derived rate:
+// 100.00 at 23% plus a 50.00 exempt book must still resolve to 23, not 15.
+func TestTaxRateExcludesExemptItems(t *testing.T) {
+	cases := []struct {
+		name  string
+		items []*LineItem
+		total int64
+		tax   int64
+		sub   int64
+		want  int
+	}{
+		{
+			name:  "standard items only",
+			items: []*LineItem{{Name: "Gadget", Qty: 1, Price: 10000}},
+			total: 12300, tax: 2300, want: 23,
+		},
+		{
+			name: "mixed exempt and standard",
+			items: []*LineItem{
+				{Name: "Gadget", Qty: 1, Price: 10000},
+				{Name: "Book", Qty: 2, Price: 2500, TaxExempt: true},
+			},
+			total: 17300, tax: 2300, want: 23,
+		},
+		{
+			name: "mixed with subtotal",
+			items: []*LineItem{
+				{Name: "Gadget", Qty: 1, Price: 10000},
+				{Name: "Book", Qty: 1, Price: 5000, TaxExempt: true},
+			},
+			total: 17300, tax: 2300, sub: 15000, want: 23,
+		},
+		{
+			name:  "exempt only",
+			items: []*LineItem{{Name: "Book", Qty: 1, Price: 5000, TaxExempt: true}},
+			total: 5000, tax: 0, want: 0,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			params := &CheckoutParams{LineItems: tc.items, Total: tc.total, TaxValue: tc.tax, SubTotal: tc.sub}
+			if got := params.TaxRate(true); got != tc.want {
+				t.Errorf("TaxRate() = %d, want %d", got, tc.want)
+			}
+		})
+	}
+}
+
+// TestTaxRateOwnRateLines checks that goods with their own VatRate are left out of the
+// derived rate on a domestic sale only: 123.00 at 23% plus a 105.00 book at 5% resolves to
+// 23 at home, and to the blended rate abroad, where the book is invoiced at the order rate.
+func TestTaxRateOwnRateLines(t *testing.T) {
+	five := 5
+	params := &CheckoutParams{
+		LineItems: []*LineItem{
+			{Name: "Gadget", Qty: 1, Price: 12300},
+			{Name: "Book", Qty: 1, Price: 10500, VatRate: &five},
+		},
+		Total: 22800, TaxValue: 2800, SubTotal: 20000,
+	}
+	if got := params.TaxRate(true); got != 23 {
+		t.Errorf("domestic TaxRate() = %d, want 23", got)
+	}
+	if got := params.TaxRate(false); got != 14 {
+		t.Errorf("foreign TaxRate() = %d, want 14", got)
+	}
+}
+
+// TestValidateFreeLines checks that a zero-price gift or zero-quantity line is dropped
+// before the external APIs see it, and that negative values fail with the line named.
+func TestValidateFreeLines(t *testing.T) {
+	client := &ClientDetails{Name: "Jan", Email: "jan@example.com"}
+
+	cases := []struct {
+		name    string
+		items   []*LineItem
+		want    []string
+		wantErr string
+	}{
+		{
+			name: "zero price gift dropped",
+			items: []*LineItem{
+				{Name: "Book", Qty: 1, Price: 5000},
+				{Name: "Gift", Qty: 1, Price: 0},
+			},
+			want: []string{"Book"},
+		},
+		{
+			name: "zero quantity and free shipping dropped",
+			items: []*LineItem{
+				{Name: "Book", Qty: 2, Price: 5000},
+				{Name: "Removed", Qty: 0, Price: 1000},
+				ShippingLineItem("", 0),
+			},
+			want: []string{"Book"},
+		},
+		{
+			name:    "only free lines",
+			items:   []*LineItem{{Name: "Gift", Qty: 1, Price: 0}},
+			wantErr: "no line items",
+		},
+		{
+			name: "negative price",
+			items: []*LineItem{
+				{Name: "Book", Qty: 1, Price: 5000},
+				{Name: "Discount", Qty: 1, Price: -500},
+			},
+			wantErr: "line item 2 (Discount): negative price -500",
+		},
+		{
+			name:    "negative quantity",
+			items:   []*LineItem{{Name: "Book", Qty: -1, Price: 5000}},
+			wantErr: "line item 1 (Book): negative quantity -1",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			params := &CheckoutParams{ClientDetails: client, LineItems: tc.items}
+			err := params.Validate()
+			if tc.wantErr != "" {
+				if err == nil || err.Error() != tc.wantErr {
+					t.Fatalf("Validate() error = %v, want %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Validate() error = %v", err)
+			}
+			var got []string
+			for _, item := range params.LineItems {
+				got = append(got, item.Name)
+			}
+			if strings.Join(got, ",") != strings.Join(tc.want, ",") {
+				t.Errorf("line items = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+// TestValidateSubscriptionInterval checks that a subscription without an interval is
+// rejected before a session is created.
+func TestValidateSubscriptionInterval(t *testing.T) {
+	params := &CheckoutParams{
+		ClientDetails: &ClientDetails{Name: "Jan", Email: "jan@example.com"},
+		LineItems:     []*LineItem{{Name: "Plan", Qty: 1, Price: 1000}},
+		Mode:          ModeSubscription,
+	}
+	if err := params.Validate(); err == nil {
+		t.Fatal("expected an error for a subscription without interval")
+	}
+	params.Interval = "month"
+	if err := params.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+}
+
+// TestValidateLineCurrency rejects a line priced in another currency than the order,
+// such as a EUR item in a PLN cart, and accepts lines in the order currency (in any case)
+// or without a currency of their own.
+func TestValidateLineCurrency(t *testing.T) {
+	cases := []struct {
+		name     string
+		currency string
+		items    []*LineItem
+		wantErr  bool
+	}{
+		{"eur item in pln order", "pln", []*LineItem{
+			{Name: "Book", Qty: 1, Price: 5000},
+			{Name: "Import", Qty: 1, Price: 1000, Currency: "EUR"},
+		}, true},
+		{"matching item currency", "pln", []*LineItem{
+			{Name: "Book", Qty: 1, Price: 5000, Currency: "PLN"},
+			{Name: "Pen", Qty: 2, Price: 300},
+		}, false},
+		{"order without currency, lines disagree", "", []*LineItem{
+			{Name: "Book", Qty: 1, Price: 5000, Currency: "PLN"},
+			{Name: "Import", Qty: 1, Price: 1000, Currency: "EUR"},
+		}, true},
+		{"no line currencies", "eur", []*LineItem{
+			{Name: "Book", Qty: 1, Price: 5000},
+		}, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			params := &CheckoutParams{
+				ClientDetails: &ClientDetails{Name: "Jan", Email: "jan@example.com"},
+				LineItems:     tc.items,
+				Currency:      tc.currency,
+			}
+			err := params.Validate()
+			if tc.wantErr {
+				if err == nil || !errors.Is(err, money.ErrCurrencyMismatch) || !strings.Contains(err.Error(), "Import") {
+					t.Errorf("Validate() error = %v, want a currency mismatch naming the line", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("Validate() error = %v", err)
+			}
+		})
+	}
+}
+
+// TestValidateTotalTolerance checks the rounding tolerance at its boundary in both
+// directions, and that RefineTotal makes the lines add up to a total inside it.
+func TestValidateTotalTolerance(t *testing.T) {
+	cases := []struct {
+		name      string
+		total     int64
+		tolerance int64
+		wantErr   bool
+	}{
+		{"exact, no tolerance", 1000, 0, false},
+		{"one cent, no tolerance", 1001, 0, true},
+		{"at tolerance above", 1002, 2, false},
+		{"at tolerance below", 998, 2, false},
+		{"past tolerance above", 1003, 2, true},
+		{"past tolerance below", 997, 2, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			params := &CheckoutParams{
+				LineItems: []*LineItem{{Name: "Book", Qty: 1, Price: 600}, {Name: "Pen", Qty: 1, Price: 400}},
+				Total:     tc.total,
+			}
+			if err := params.ValidateTotal(tc.tolerance); (err != nil) != tc.wantErr {
+				t.Fatalf("ValidateTotal(%d) error = %v, want error %v", tc.tolerance, err, tc.wantErr)
+			}
+			err := params.RefineTotal(tc.tolerance)
+			if tc.wantErr {
+				if err == nil {
+					t.Error("RefineTotal accepted a total past the tolerance")
+				}
+				if params.ItemsTotal() != 1000 {
+					t.Errorf("RefineTotal changed lines of a rejected order: %d", params.ItemsTotal())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("RefineTotal: %v", err)
+			}
+			if got := params.ItemsTotal(); got != tc.total {
+				t.Errorf("lines total after RefineTotal = %d, want %d", got, tc.total)
+			}
+		})
+	}
+}
+
+// TestMetadataRoundTrip checks that custom metadata survives the trip through the Stripe
+// session and that a caller cannot override the reserved order_id key.
+func TestMetadataRoundTrip(t *testing.T) {
+	params := &CheckoutParams{
+		OrderId:  "ORD-1",
+		Metadata: map[string]string{"channel": "instagram", "campaign": "spring", "order_id": "spoofed"},
+	}
+	metadata := params.StripeMetadata()
+	if metadata["order_id"] != "ORD-1" {
+		t.Fatalf("order_id = %q, want ORD-1", metadata["order_id"])
+	}
+
+	restored := NewFromCheckoutSession(&stripe.CheckoutSession{ID: "cs_1", Metadata: metadata})
+	if restored.OrderId != "ORD-1" {
+		t.Errorf("OrderId = %q, want ORD-1", restored.OrderId)
+	}
+	want := map[string]string{"channel": "instagram", "campaign": "spring"}
+	if !reflect.DeepEqual(restored.Metadata, want) {
+		t.Errorf("Metadata = %v, want %v", restored.Metadata, want)
+	}
+
+	plain := NewFromCheckoutSession(&stripe.CheckoutSession{ID: "cs_2", Metadata: map[string]string{"order_id": "ORD-2"}})
+	if plain.Metadata != nil {
+		t.Errorf("Metadata = %v, want nil without custom entries", plain.Metadata)
+	}
+}
+
+// TestStripeAddressLines checks that the Stripe address lines map to Street and Street2
+// without the trailing space a missing second line used to leave, and that
+// StreetAddress joins them for documents.
+func TestStripeAddressLines(t *testing.T) {
+	cases := []struct {
+		name        string
+		line1       string
+		line2       string
+		wantStreet  string
+		wantStreet2 string
+		wantAddress string
+	}{
+		{"single line", "Main St 5", "", "Main St 5", "", "Main St 5"},
+		{"two lines", "Main St 5", "Apt 12", "Main St 5", "Apt 12", "Main St 5 Apt 12"},
+		{"padded lines", " Main St 5 ", " Apt 12", "Main St 5", "Apt 12", "Main St 5 Apt 12"},
+		{"second line only", "", "Apt 12", "", "Apt 12", "Apt 12"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			customer := &stripe.Customer{
+				Name:    "Jan",
+				Email:   "jan@example.com",
+				Address: &stripe.Address{Line1: tc.line1, Line2: tc.line2, City: "Warszawa"},
+			}
+			fromSession := NewFromCheckoutSession(&stripe.CheckoutSession{ID: "cs_1", Customer: customer})
+			fromInvoice := NewFromInvoice(&stripe.Invoice{ID: "in_1", Customer: customer})
+			for source, params := range map[string]*CheckoutParams{"session": fromSession, "invoice": fromInvoice} {
+				client := params.ClientDetails
+				if client.Street != tc.wantStreet || client.Street2 != tc.wantStreet2 {
+					t.Errorf("%s: street = %q / %q, want %q / %q", source, client.Street, client.Street2, tc.wantStreet, tc.wantStreet2)
+				}
+				if got := client.StreetAddress(); got != tc.wantAddress {
+					t.Errorf("%s: StreetAddress() = %q, want %q", source, got, tc.wantAddress)
+				}
+			}
+		})
+	}
+}
+
+// TestTruncateName checks that long names are cut at a word boundary within the limit,
+// counted in characters rather than bytes, and that short names pass through untouched.
+func TestTruncateName(t *testing.T) {
+	cases := []struct {
+		name string
+		in   string
+		max  int
+		want string
+	}{
+		{"under limit", "Kubek ceramiczny", 20, "Kubek ceramiczny"},
+		{"exact limit", "Kubek ceramiczny", 16, "Kubek ceramiczny"},
+		{"disabled", "Kubek ceramiczny biały", 0, "Kubek ceramiczny biały"},
+		{"word boundary", "Kubek ceramiczny biały 330 ml", 20, "Kubek ceramiczny…"},
+		{"trailing punctuation", "Zestaw: kubek, talerz, miska", 22, "Zestaw: kubek, talerz…"},
+		{"multibyte counted as characters", "Żółć gęślą jaźń", 11, "Żółć gęślą…"},
+		{"single long word", "Superkalifragilistyczny", 10, "Superkali…"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := TruncateName(tc.in, tc.max)
+			if got != tc.want {
+				t.Fatalf("TruncateName(%q, %d) = %q, want %q", tc.in, tc.max, got, tc.want)
+			}
+			if tc.max > 0 && len([]rune(got)) > tc.max {
+				t.Errorf("result has %d characters, limit is %d", len([]rune(got)), tc.max)
+			}
+		})
+	}
+}
+
+// TestBindFieldErrors checks the structured validation error of a CheckoutParams body
+// missing required fields: each failure names its JSON path and rule, and the error
+// string keeps the flat "field rule" form.
+func TestBindFieldErrors(t *testing.T) {
+	params := &CheckoutParams{
+		ClientDetails: &ClientDetails{Name: "Jan", Email: "not-an-email"},
+		LineItems:     []*LineItem{{Name: "Book", Qty: 0, Price: 500}},
+		Total:         500,
+		Currency:      "GBP",
+		SuccessUrl:    "https://shop.example.com/thanks",
+	}
+	err := params.Bind(nil)
+	fields := validate.Fields(err)
+	if fields == nil {
+		t.Fatalf("Bind error = %v, want field errors", err)
+	}
+
+	want := map[string]string{
+		"client_details.email": "email",
+		"line_items[0].qty":    "required",
+		"currency":             "oneof",
+		"order_id":             "required",
+	}
+	got := make(map[string]string, len(fields))
+	for _, f := range fields {
+		got[f.Field] = f.Rule
+		if f.Message == "" {
+			t.Errorf("%s: empty message", f.Field)
+		}
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("field errors = %v, want %v", got, want)
+	}
+	if !strings.Contains(err.Error(), "email email; ") || !strings.Contains(err.Error(), "order_id required") {
+		t.Errorf("error string = %q, want the flat field rule form", err)
+	}
+}
+
+// TestStripeAutomaticTax reads a completed Stripe Tax session back: the order total tax,
+// each line's applied rate and the rate's display name as tax title. Untaxed sessions
+// and lines keep their defaults.
+func TestStripeAutomaticTax(t *testing.T) {
+	vat := &stripe.TaxRate{DisplayName: "VAT", Percentage: 23}
+	reduced := &stripe.TaxRate{DisplayName: "VAT", Percentage: 8}
+	sess := &stripe.CheckoutSession{
+		ID:           "cs_1",
+		AutomaticTax: &stripe.CheckoutSessionAutomaticTax{Enabled: true},
+		TotalDetails: &stripe.CheckoutSessionTotalDetails{AmountTax: 2700},
+		LineItems: &stripe.LineItemList{Data: []*stripe.LineItem{
+			{Description: "Mug", Quantity: 1, AmountTotal: 12300, Taxes: []*stripe.LineItemTax{{Amount: 2300, Rate: vat}}},
+			{Description: "Coffee", Quantity: 1, AmountTotal: 5400, Taxes: []*stripe.LineItemTax{{Amount: 400, Rate: reduced}}},
+			{Description: "Gift card", Quantity: 1, AmountTotal: 1000},
+		}},
+	}
+
+	params := NewFromCheckoutSession(sess)
+	if !params.AutomaticTax || params.TaxValue != 2700 || params.TaxTitle != "VAT" {
+		t.Fatalf("params automatic=%v tax=%d title=%q, want true 2700 VAT", params.AutomaticTax, params.TaxValue, params.TaxTitle)
+	}
+	wantRates := []int{23, 8, -1}
+	for i, want := range wantRates {
+		got := params.LineItems[i].VatRate
+		switch {
+		case want < 0 && got != nil:
+			t.Errorf("line %d vat rate = %d, want unset", i, *got)
+		case want >= 0 && (got == nil || *got != want):
+			t.Errorf("line %d vat rate = %v, want %d", i, got, want)
+		}
+	}
+
+	sess.AutomaticTax.Enabled = false
+	plain := NewFromCheckoutSession(sess)
+	if plain.AutomaticTax || plain.TaxValue != 0 || plain.LineItems[0].VatRate != nil {
+		t.Errorf("untaxed session read tax: automatic=%v tax=%d", plain.AutomaticTax, plain.TaxValue)
+	}
+}
+
+// TestStripeFractionalTax checks a fractional Stripe Tax rate is not rounded onto the
+// line but flags the order for manual review.
+func TestStripeFractionalTax(t *testing.T) {
+	sess := &stripe.CheckoutSession{
+		ID:           "cs_1",
+		AutomaticTax: &stripe.CheckoutSessionAutomaticTax{Enabled: true},
+		LineItems: &stripe.LineItemList{Data: []*stripe.LineItem{
+			{Description: "Mug", Quantity: 1, AmountTotal: 12300,
+				Taxes: []*stripe.LineItemTax{{Amount: 2300, Rate: &stripe.TaxRate{DisplayName: "VAT", Percentage: 23}}}},
+			{Description: "Wine", Quantity: 1, AmountTotal: 5400,
+				Taxes: []*stripe.LineItemTax{{Amount: 400, Rate: &stripe.TaxRate{DisplayName: "VAT", Percentage: 8.875}}}},
+		}},
+	}
+
+	params := NewFromCheckoutSession(sess)
+	if params.LineItems[1].VatRate != nil {
+		t.Errorf("fractional rate rounded to %d", *params.LineItems[1].VatRate)
+	}
+	if !strings.Contains(params.TaxRateError, "8.875%") || !strings.Contains(params.TaxRateError, "Wine") {
+		t.Errorf("TaxRateError = %q, want the rate and line", params.TaxRateError)
+	}
+	if rate := params.LineItems[0].VatRate; rate == nil || *rate != 23 {
+		t.Errorf("whole rate = %v, want 23", rate)
+	}
+}
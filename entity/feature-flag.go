@@ -0,0 +1,43 @@
+package entity
+
+import (
+	"errors"
+	"net/http"
+	"time"
+	"wfsync/lib/validate"
+)
+
+// Subsystems that can be switched off at runtime with a feature flag.
+const (
+	FeatureStripe   = "stripe"
+	FeatureWFirma   = "wfirma"
+	FeatureOpenCart = "opencart"
+	FeatureTelegram = "telegram"
+)
+
+// Features lists every subsystem with a feature flag.
+var Features = []string{FeatureStripe, FeatureWFirma, FeatureOpenCart, FeatureTelegram}
+
+// ErrSubsystemDisabled is returned by a client whose subsystem is switched off.
+var ErrSubsystemDisabled = errors.New("subsystem disabled")
+
+// ErrUnknownFeature is returned when toggling a name that is not in Features.
+var ErrUnknownFeature = errors.New("unknown feature")
+
+// FeatureFlag is the runtime state of a subsystem. A subsystem without a stored flag is
+// enabled.
+type FeatureFlag struct {
+	Name      string    `json:"name" bson:"_id"`
+	Enabled   bool      `json:"enabled" bson:"enabled"`
+	UpdatedBy string    `json:"updated_by,omitempty" bson:"updated_by"`
+	UpdatedAt time.Time `json:"updated_at,omitempty" bson:"updated_at"`
+}
+
+// FeatureFlagRequest is the body of PUT /v1/features/{name}.
+type FeatureFlagRequest struct {
+	Enabled *bool `json:"enabled" validate:"required"`
+}
+
+func (f *FeatureFlagRequest) Bind(r *http.Request) error {
+	return validate.Request(r, f)
+}
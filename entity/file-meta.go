@@ -1,5 +1,13 @@
 package entity
 
+import "errors"
+
+// Signed document link failures. Handlers answer them with 403 and 410 respectively.
+var (
+	ErrFileLinkInvalid = errors.New("invalid file link")
+	ErrFileLinkExpired = errors.New("file link expired")
+)
+
 type FileMeta struct {
 	ContentType   string
 	ContentLength int64
@@ -0,0 +1,43 @@
+package entity
+
+// Health states of the service and of each subsystem.
+const (
+	HealthOk       = "ok"
+	HealthDegraded = "degraded" // an optional subsystem is down
+	HealthDown     = "down"
+	HealthDisabled = "disabled" // switched off with a feature flag, not probed
+)
+
+// SubsystemHealth is the result of probing one subsystem. Error is logged, not served:
+// the health endpoints are public.
+type SubsystemHealth struct {
+	Name     string `json:"name"`
+	Status   string `json:"status"`
+	Required bool   `json:"required"`
+	Error    string `json:"-"`
+}
+
+// HealthStatus is the body of GET /health and /readyz: down when a required subsystem
+// is down, degraded when only optional ones are.
+type HealthStatus struct {
+	Status     string             `json:"status"`
+	Subsystems []*SubsystemHealth `json:"subsystems,omitempty"`
+}
+
+// Healthy reports whether every required subsystem (the databases) is up. It gates
+// /health: an optional subsystem being down only degrades the status.
+func (h *HealthStatus) Healthy() bool {
+	return h.Status != HealthDown
+}
+
+// Ready reports whether every enabled subsystem is up, optional ones included. It gates
+// /readyz: an instance that cannot reach Stripe, wFirma or Telegram is held out of
+// rotation, while subsystems switched off with a feature flag do not count.
+func (h *HealthStatus) Ready() bool {
+	for _, s := range h.Subsystems {
+		if s.Status == HealthDown {
+			return false
+		}
+	}
+	return h.Status != HealthDown
+}
@@ -0,0 +1,23 @@
+package entity
+
+import "time"
+
+// IdempotentResponse is the stored first response to a request sent with an
+// Idempotency-Key header. Repeats of the request by the same user within the TTL get
+// this response back instead of running the handler again. ID is "<user>/<key>".
+type IdempotentResponse struct {
+	ID          string    `json:"id" bson:"_id"`
+	User        string    `json:"user" bson:"user"`
+	Key         string    `json:"key" bson:"key"`
+	Fingerprint string    `json:"fingerprint" bson:"fingerprint"`
+	Status      int       `json:"status" bson:"status"`
+	ContentType string    `json:"content_type" bson:"content_type"`
+	Body        []byte    `json:"body" bson:"body"`
+	CreatedAt   time.Time `json:"created_at" bson:"created_at"`
+	ExpiresAt   time.Time `json:"expires_at" bson:"expires_at"`
+}
+
+// IdempotentResponseID builds the storage id of a user's key.
+func IdempotentResponseID(user, key string) string {
+	return user + "/" + key
+}
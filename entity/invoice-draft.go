@@ -0,0 +1,10 @@
+package entity
+
+import "errors"
+
+// InvoiceDraftStatus is the status of checkout params held as an editable invoice draft:
+// computed and stored, but not yet registered in wFirma.
+const InvoiceDraftStatus = "draft"
+
+// ErrInvoiceDraftNotFound reports an issue request for an order that has no draft.
+var ErrInvoiceDraftNotFound = errors.New("invoice draft not found")
@@ -0,0 +1,8 @@
+package entity
+
+import "errors"
+
+// ErrInvoiceSeriesMissing reports that wFirma rejected a document because the company has
+// no numbering series for it. Nothing in the order can fix that: the series has to be
+// configured in wFirma before the order is retried.
+var ErrInvoiceSeriesMissing = errors.New("invoice series not configured in wFirma")
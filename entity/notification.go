@@ -0,0 +1,19 @@
+package entity
+
+// Business notification events. Each event has a message template in the bot, filled
+// in from the notification fields listed next to it.
+const (
+	EventOrderInvoiced   = "order.invoiced"   // order_id, invoice
+	EventPaymentCaptured = "payment.captured" // order_id, captured, authorized
+	EventOrderRefunded   = "order.refunded"   // order_id, refunded, correction
+)
+
+// NotificationEvents lists every business notification event.
+var NotificationEvents = []string{EventOrderInvoiced, EventPaymentCaptured, EventOrderRefunded}
+
+// Notification is a business event with the values its message template refers to.
+// Fields hold plain text; escaping for the delivery channel is left to the notifier.
+type Notification struct {
+	Event  string
+	Fields map[string]string
+}
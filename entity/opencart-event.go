@@ -0,0 +1,44 @@
+package entity
+
+import (
+	"errors"
+	"net/http"
+	"wfsync/lib/validate"
+)
+
+// OpenCart order events a store can push to POST /webhook/opencart. Each names the job
+// run for the order; the order must be in that job's request status.
+const (
+	OpenCartEventPaymentLink = "stripe-pay-link"
+	OpenCartEventProforma    = "wfirma-proforma"
+	OpenCartEventInvoice     = "wfirma-invoice"
+)
+
+// ErrOrderNotInRequestStatus reports an order event for an order whose status does not
+// request the event's job (not set yet, or already handled).
+var ErrOrderNotInRequestStatus = errors.New("order is not in the job's request status")
+
+// ErrOrderNotFound reports an order event for an order the store does not have.
+var ErrOrderNotFound = errors.New("order not found")
+
+// ErrJobNotConfigured reports an order event for a job without a configured request status.
+var ErrJobNotConfigured = errors.New("job not configured")
+
+// OpenCartEvent is a store's notification that an order is ready for a job.
+type OpenCartEvent struct {
+	OrderId int64  `json:"order_id" validate:"required,min=1"`
+	Event   string `json:"event" validate:"required,oneof=stripe-pay-link wfirma-proforma wfirma-invoice"`
+}
+
+func (e *OpenCartEvent) Bind(r *http.Request) error {
+	return validate.Request(r, e)
+}
+
+// OpenCartEventResult reports what an order event triggered. Processed is true when the
+// job was started for the order; it runs in the background. It is false when an order
+// pass was already running; that pass or the next one picks the order up.
+type OpenCartEventResult struct {
+	OrderId   int64  `json:"order_id"`
+	Event     string `json:"event"`
+	Processed bool   `json:"processed"`
+}
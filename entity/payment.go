@@ -8,14 +8,20 @@ import (
 type Payment struct {
 	Amount      int64  `json:"amount"`
 	Id          string `json:"id" validate:"required"`
+	Number      string `json:"number,omitempty"`
 	OrderId     string `json:"order_id" validate:"required"`
 	Link        string `json:"link,omitempty"`
 	InvoiceFile string `json:"invoice_file,omitempty"`
+	// FileData is the base64-encoded PDF of the document, filled only on request
+	// (B2BOrder.IncludePDF) and only for the head document of a split order.
+	FileData string `json:"file_data,omitempty"`
 	// Parts carries every document produced for the order when the request was
 	// split across multiple wFirma invoices (over the soft item limit).
 	// Includes the first part as well, so consumers can iterate uniformly.
 	// Empty when the order produced a single document.
 	Parts []*Payment `json:"parts,omitempty"`
+	// Tax is the order's VAT summary, one line per rate, filled for created invoices.
+	Tax []*TaxLine `json:"tax,omitempty"`
 }
 
 func (p *Payment) Bind(_ *http.Request) error {
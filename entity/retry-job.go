@@ -11,12 +11,24 @@ const (
 	RetryJobFailed    RetryJobStatus = "failed"
 )
 
-// RetryJob tracks a failed invoice creation that should be retried with exponential backoff.
-// The ID is set to EventId for idempotent upserts — each Stripe event produces at most one retry job.
+// RetryJobKind tells what a retry job re-runs. Jobs stored without a kind register invoices.
+type RetryJobKind string
+
+const (
+	RetryJobInvoice RetryJobKind = ""
+	RetryJobRefund  RetryJobKind = "refund"
+)
+
+// RetryJob tracks a failed invoice creation, or a failed refund correction, that should be
+// retried with exponential backoff. The ID is set to EventId for idempotent upserts — each
+// Stripe event produces at most one retry job. Refunded is the cumulative amount a refund
+// job records once its corrective invoice is issued.
 type RetryJob struct {
 	ID          string         `json:"id" bson:"_id"`
 	EventId     string         `json:"event_id" bson:"event_id"`
 	OrderId     string         `json:"order_id" bson:"order_id"`
+	Kind        RetryJobKind   `json:"kind,omitempty" bson:"kind,omitempty"`
+	Refunded    int64          `json:"refunded,omitempty" bson:"refunded,omitempty"`
 	Status      RetryJobStatus `json:"status" bson:"status"`
 	Attempts    int            `json:"attempts" bson:"attempts"`
 	MaxAttempts int            `json:"max_attempts" bson:"max_attempts"`
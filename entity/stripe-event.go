@@ -0,0 +1,15 @@
+package entity
+
+import "time"
+
+// StripeEventRecord is a Stripe webhook event kept as received, for disputes and audits.
+// The derived CheckoutParams lose most of the event; Payload keeps all of it. ID is the
+// Stripe event id, so a redelivered event is stored once.
+type StripeEventRecord struct {
+	ID         string    `json:"id" bson:"_id"`
+	Type       string    `json:"type" bson:"type"`
+	Created    time.Time `json:"created" bson:"created"`
+	ReceivedAt time.Time `json:"received_at" bson:"received_at"`
+	ExpiresAt  time.Time `json:"expires_at" bson:"expires_at"`
+	Payload    string    `json:"payload" bson:"payload"`
+}
@@ -0,0 +1,29 @@
+package entity
+
+import (
+	"strconv"
+	"strings"
+)
+
+// TaxLine summarizes the VAT of one rate group of an invoiced order. Amounts are in
+// minor units and derived from the gross line prices, the same way wFirma computes
+// a "brutto" invoice, so the summary matches the document.
+type TaxLine struct {
+	Title string  `json:"title" bson:"title"`
+	Code  string  `json:"code" bson:"code"` // wFirma VAT code: "23", "8", "WDT", "ZW", ...
+	Rate  float64 `json:"rate" bson:"rate"` // percent; 0 for zero-rated and exempt codes
+	Net   int64   `json:"net" bson:"net"`
+	Value int64   `json:"value" bson:"value"`
+	Gross int64   `json:"gross" bson:"gross"`
+	// Text is the ready-to-print line, e.g. "VAT 23%: 18.70 PLN".
+	Text string `json:"text" bson:"text"`
+}
+
+// TaxLabel is the short human label of a VAT code: "23%" for a rate, the code itself
+// ("WDT", "ZW") otherwise.
+func TaxLabel(code string) string {
+	if _, err := strconv.ParseFloat(code, 64); err == nil {
+		return code + "%"
+	}
+	return strings.ToUpper(code)
+}
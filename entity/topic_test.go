@@ -0,0 +1,89 @@
+package entity
+
+import (
+	"slices"
+	"testing"
+)
+
+// TestTopicRoleMatrix pins which topics each role may subscribe to: admins every topic,
+// approved users only invoice, payment and error, and unknown topics nobody.
+func TestTopicRoleMatrix(t *testing.T) {
+	topics := append(AllTopics(), "unknown")
+	want := map[TelegramRole][]string{
+		RoleAdmin:   {TopicPayment, TopicInvoice, TopicError, TopicSystem, TopicOrder, TopicSecurity},
+		RoleUser:    {TopicPayment, TopicInvoice, TopicError},
+		RolePending: {TopicPayment, TopicInvoice, TopicError},
+		RoleNone:    {TopicPayment, TopicInvoice, TopicError},
+	}
+	for role, allowed := range want {
+		for _, topic := range topics {
+			if got := IsTopicAllowedForRole(topic, role); got != slices.Contains(allowed, topic) {
+				t.Errorf("IsTopicAllowedForRole(%q, %q) = %v", topic, role, got)
+			}
+		}
+		got := TopicsForRole(role)
+		if len(got) != len(allowed) {
+			t.Errorf("TopicsForRole(%q) = %v, want %v", role, got, allowed)
+		}
+		for _, topic := range got {
+			if !slices.Contains(allowed, topic) {
+				t.Errorf("TopicsForRole(%q) offers %q", role, topic)
+			}
+		}
+	}
+}
+
+// TestTopicsForRoleCopies checks that callers cannot change the topic lists.
+func TestTopicsForRoleCopies(t *testing.T) {
+	TopicsForRole(RoleAdmin)[0] = "changed"
+	TopicsForRole(RoleUser)[0] = "changed"
+	if slices.Contains(AllTopics(), "changed") || slices.Contains(UserTopics(), "changed") {
+		t.Error("topic list modified through a returned slice")
+	}
+}
+
+// TestRolePredicates pins IsAdmin, IsApproved and IsPending for every role.
+func TestRolePredicates(t *testing.T) {
+	cases := []struct {
+		role                     TelegramRole
+		admin, approved, pending bool
+	}{
+		{RoleAdmin, true, true, false},
+		{RoleUser, false, true, false},
+		{RolePending, false, false, true},
+		{RoleNone, false, false, false},
+	}
+	for _, tc := range cases {
+		u := &User{TelegramRole: tc.role}
+		if u.IsAdmin() != tc.admin || u.IsApproved() != tc.approved || u.IsPending() != tc.pending {
+			t.Errorf("role %q: admin=%v approved=%v pending=%v, want %v %v %v",
+				tc.role, u.IsAdmin(), u.IsApproved(), u.IsPending(), tc.admin, tc.approved, tc.pending)
+		}
+	}
+}
+
+// TestHasTopic checks that no topics means every topic, that "none" means no topic,
+// and that otherwise only the listed topics match.
+func TestHasTopic(t *testing.T) {
+	cases := []struct {
+		name   string
+		topics []string
+		topic  string
+		want   bool
+	}{
+		{"nil means all", nil, TopicSecurity, true},
+		{"empty means all", []string{}, TopicPayment, true},
+		{"listed", []string{TopicInvoice, TopicPayment}, TopicPayment, true},
+		{"not listed", []string{TopicInvoice}, TopicPayment, false},
+		{"none", []string{"none"}, TopicPayment, false},
+		{"case sensitive", []string{TopicPayment}, "Payment", false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			u := &User{TelegramTopics: tc.topics}
+			if got := u.HasTopic(tc.topic); got != tc.want {
+				t.Errorf("HasTopic(%q) with %v = %v, want %v", tc.topic, tc.topics, got, tc.want)
+			}
+		})
+	}
+}
@@ -27,6 +27,15 @@ const (
 	TierDigest   SubscriptionTier = "digest"   // batched summary at configured interval
 )
 
+// TopicMutes maps a notification topic to the time its mute expires.
+type TopicMutes map[string]time.Time
+
+// Active reports whether the topic is muted at the given time.
+func (m TopicMutes) Active(topic string, now time.Time) bool {
+	until, ok := m[topic]
+	return ok && now.Before(until)
+}
+
 // User represents both an API user (Token-based auth) and a Telegram bot subscriber.
 // Telegram-specific fields are populated during bot registration (/start command).
 type User struct {
@@ -43,7 +52,13 @@ type User struct {
 	TelegramTopics     []string         `json:"telegram_topics" bson:"telegram_topics"`
 	SubscriptionTier   SubscriptionTier `json:"subscription_tier" bson:"subscription_tier"`
 	DigestSchedule     string           `json:"digest_schedule" bson:"digest_schedule"`
+	DigestIntervalMin  int              `json:"digest_interval_min,omitempty" bson:"digest_interval_min,omitempty"`
+	TopicMutes         TopicMutes       `json:"topic_mutes,omitempty" bson:"topic_mutes,omitempty"`
 	RegisteredAt       time.Time        `json:"registered_at" bson:"registered_at"`
+	LastSeen           time.Time        `json:"last_seen,omitempty" bson:"last_seen,omitempty"`
+	InvitedBy          int64            `json:"invited_by,omitempty" bson:"invited_by,omitempty"`
+	Language           string           `json:"language,omitempty" bson:"language,omitempty"`
+	Timezone           string           `json:"timezone,omitempty" bson:"timezone,omitempty"`
 }
 
 func (u *User) Bind(_ *http.Request) error {
@@ -79,3 +94,8 @@ func (u *User) HasTopic(topic string) bool {
 	}
 	return false
 }
+
+// IsMuted checks if the user has temporarily muted a notification topic.
+func (u *User) IsMuted(topic string, now time.Time) bool {
+	return u.TopicMutes.Active(topic, now)
+}
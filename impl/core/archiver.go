@@ -0,0 +1,116 @@
+// Package core — archiver.go implements the retention job for checkout_params. Every
+// Stripe session, hold and invoice flow leaves a document behind, so without pruning the
+// collection grows forever. Terminal records older than the configured age are moved to
+// checkout_params_archive, keeping them available for audits while the hot collection
+// (scanned by the reconciler and dedupe lookups) stays small.
+package core
+
+import (
+	"log/slog"
+	"time"
+	"wfsync/lib/clock"
+	"wfsync/lib/sl"
+)
+
+// ArchiveDatabase defines the persistence methods the archiver needs.
+type ArchiveDatabase interface {
+	ArchiveCheckoutParams(cutoff time.Time, limit int) (int, error)
+}
+
+// Archiver periodically archives old terminal checkout params. Follows the same
+// Start/Stop pattern as RetryQueue.
+type Archiver struct {
+	db        ArchiveDatabase
+	log       *slog.Logger
+	interval  time.Duration
+	maxAge    time.Duration
+	batchSize int
+	clock     clock.Clock
+	done      chan struct{}
+	stopped   chan struct{}
+}
+
+// NewArchiver creates an archiver. Call Start() to begin background processing.
+func NewArchiver(log *slog.Logger, intervalMin, maxAgeDays, batchSize int) *Archiver {
+	if intervalMin <= 0 {
+		intervalMin = 1440
+	}
+	if maxAgeDays <= 0 {
+		maxAgeDays = 180
+	}
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+	return &Archiver{
+		log:       log.With(sl.Module("archiver")),
+		interval:  time.Duration(intervalMin) * time.Minute,
+		maxAge:    time.Duration(maxAgeDays) * 24 * time.Hour,
+		batchSize: batchSize,
+		clock:     clock.Real,
+	}
+}
+
+func (a *Archiver) SetDatabase(db ArchiveDatabase) { a.db = db }
+
+// Start launches the background polling goroutine.
+func (a *Archiver) Start() {
+	a.done = make(chan struct{})
+	a.stopped = make(chan struct{})
+	go func() {
+		defer close(a.stopped)
+
+		a.archive()
+
+		ticker := time.NewTicker(a.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-a.done:
+				a.log.Debug("archiver stopped")
+				return
+			case <-ticker.C:
+				a.archive()
+			}
+		}
+	}()
+}
+
+// Stop signals the background goroutine to exit and waits for it to finish.
+func (a *Archiver) Stop() {
+	if a.done != nil {
+		a.log.Debug("stopping archiver")
+		close(a.done)
+		<-a.stopped
+	}
+}
+
+// cutoff is the moment before which terminal records are eligible for archival.
+func (a *Archiver) cutoff() time.Time {
+	return a.clock.Now().Add(-a.maxAge)
+}
+
+// archive moves batches of eligible records until a batch comes back short, so a large
+// first-run backlog is cleared in one tick without loading it all into memory at once.
+func (a *Archiver) archive() {
+	if a.db == nil {
+		return
+	}
+	cutoff := a.cutoff()
+	total := 0
+	for {
+		n, err := a.db.ArchiveCheckoutParams(cutoff, a.batchSize)
+		if err != nil {
+			a.log.Error("archive checkout params", sl.Err(err))
+			break
+		}
+		total += n
+		if n < a.batchSize {
+			break
+		}
+	}
+	if total > 0 {
+		a.log.Info("checkout params archived",
+			slog.Int("count", total),
+			slog.Time("cutoff", cutoff))
+	}
+}
@@ -0,0 +1,47 @@
+package core
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+	"wfsync/lib/clock"
+)
+
+// fakeArchiveDB records the cutoffs it is called with and returns queued batch sizes.
+type fakeArchiveDB struct {
+	batches []int
+	cutoffs []time.Time
+}
+
+func (f *fakeArchiveDB) ArchiveCheckoutParams(cutoff time.Time, _ int) (int, error) {
+	f.cutoffs = append(f.cutoffs, cutoff)
+	if len(f.batches) == 0 {
+		return 0, nil
+	}
+	n := f.batches[0]
+	f.batches = f.batches[1:]
+	return n, nil
+}
+
+// TestArchiverCutoffAndBatching checks that the cutoff is derived from the injected clock
+// and that full batches are drained until a short one comes back.
+func TestArchiverCutoffAndBatching(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	db := &fakeArchiveDB{batches: []int{10, 10, 3}}
+
+	a := NewArchiver(slog.New(slog.NewTextHandler(io.Discard, nil)), 60, 30, 10)
+	a.clock = clock.NewMock(now)
+	a.SetDatabase(db)
+	a.archive()
+
+	if len(db.cutoffs) != 3 {
+		t.Fatalf("ArchiveCheckoutParams called %d times, want 3", len(db.cutoffs))
+	}
+	want := now.Add(-30 * 24 * time.Hour)
+	for i, c := range db.cutoffs {
+		if !c.Equal(want) {
+			t.Errorf("call %d cutoff = %v, want %v", i, c, want)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+// Package core — audit.go builds the state snapshots recorded in the audit log. They
+// keep the few fields a reviewer needs to see what changed, not whole documents.
+package core
+
+import "wfsync/entity"
+
+// documentState describes a document issued for an order.
+func documentState(params *entity.CheckoutParams, payment *entity.Payment) map[string]interface{} {
+	state := map[string]interface{}{
+		"document_id": payment.Id,
+		"number":      payment.Number,
+		"amount":      payment.Amount,
+		"currency":    params.Currency,
+	}
+	if len(payment.Parts) > 1 {
+		state["parts"] = len(payment.Parts)
+	}
+	return state
+}
+
+// paymentState describes the payment state of an order.
+func paymentState(params *entity.CheckoutParams) map[string]interface{} {
+	return map[string]interface{}{
+		"payment_id": params.PaymentId,
+		"status":     params.Status,
+		"authorized": params.Authorized,
+		"captured":   params.Captured,
+		"paid":       params.Paid,
+		"currency":   params.Currency,
+	}
+}
+
+// auditedPayment returns the payment state of a session before it is changed, when the
+// audit log is on and the session is known.
+func (c *Core) auditedPayment(sessionId string) map[string]interface{} {
+	if c.auditLog == nil || c.sc == nil {
+		return nil
+	}
+	params := c.sc.SessionParams(sessionId)
+	if params == nil {
+		return nil
+	}
+	return paymentState(params)
+}
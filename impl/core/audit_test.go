@@ -0,0 +1,104 @@
+package core
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+	"wfsync/entity"
+	"wfsync/internal/config"
+	"wfsync/internal/stripeclient"
+	"wfsync/lib/api/cont"
+	"wfsync/lib/audit"
+	"wfsync/lib/clock"
+
+	"github.com/stripe/stripe-go/v76"
+)
+
+// memAudit is an in-memory audit store.
+type memAudit struct {
+	entries []*entity.AuditEntry
+}
+
+func (m *memAudit) AppendAuditEntry(entry *entity.AuditEntry) error {
+	m.entries = append(m.entries, entry)
+	return nil
+}
+
+// TestInvoiceCreationAudited checks that registering an invoice appends one audit entry
+// naming the API user, the order and the issued document, and that reusing an invoice
+// wFirma already has records nothing.
+func TestInvoiceCreationAudited(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	store := &memAudit{}
+	auditLog := audit.New(store, log)
+	now := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+	auditLog.SetClock(clock.NewMock(now))
+	c := &Core{inv: &draftInvoicer{}, fileUrl: "https://files.example.com", log: log}
+	c.SetAuditLog(auditLog)
+
+	ctx := cont.PutUser(context.Background(), &entity.User{Username: "shop-api"})
+	params := &entity.CheckoutParams{
+		OrderId:       "100",
+		Currency:      "PLN",
+		Total:         10000,
+		ClientDetails: &entity.ClientDetails{Name: "Jan", Email: "jan@example.com"},
+		LineItems:     []*entity.LineItem{{Name: "Book", Qty: 2, Price: 5000}},
+	}
+	if _, err := c.WFirmaRegisterInvoice(ctx, params); err != nil {
+		t.Fatalf("WFirmaRegisterInvoice: %v", err)
+	}
+
+	if len(store.entries) != 1 {
+		t.Fatalf("audit entries = %d, want 1", len(store.entries))
+	}
+	entry := store.entries[0]
+	if entry.Actor != "shop-api" || entry.Action != entity.AuditInvoiceCreate || entry.Target != "order:100" || !entry.Time.Equal(now) {
+		t.Errorf("entry = %+v", entry)
+	}
+	after, ok := entry.After.(map[string]interface{})
+	if !ok || after["document_id"] != "inv-1" || after["amount"] != int64(10000) {
+		t.Errorf("after = %+v, want the issued invoice", entry.After)
+	}
+	if entry.Before != nil {
+		t.Errorf("before = %+v, want none for a creation", entry.Before)
+	}
+
+	existing := *params
+	existing.InvoiceId = "inv-1"
+	if _, err := c.WFirmaRegisterInvoice(context.Background(), &existing); err != nil {
+		t.Fatalf("WFirmaRegisterInvoice existing: %v", err)
+	}
+	if len(store.entries) != 1 {
+		t.Errorf("audit entries = %d after reusing an invoice, want 1", len(store.entries))
+	}
+}
+
+// TestWebhookInvoiceAudited checks an invoice created from a Stripe webhook is audited
+// like one created through the API, with the system as actor.
+func TestWebhookInvoiceAudited(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	store := &memAudit{}
+	auditLog := audit.New(store, log)
+	auditLog.SetClock(clock.NewMock(time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)))
+
+	orders := &orderStore{params: map[string]*entity.CheckoutParams{}}
+	sc, _ := stripeclient.New(&config.Config{}, log)
+	sc.SetAPI(&eventAPI{})
+	sc.SetDatabase(orders)
+	c := &Core{sc: sc, inv: &orderInvoicer{store: orders}, db: orders, log: log}
+	c.SetAuditLog(auditLog)
+
+	evt := &stripe.Event{ID: "evt_session", Type: stripe.EventTypeCheckoutSessionCompleted,
+		Data: &stripe.EventData{Object: map[string]interface{}{"id": "cs_1"}}}
+	c.StripeEvent(context.Background(), evt, nil)
+
+	if len(store.entries) != 1 {
+		t.Fatalf("audit entries = %d, want 1", len(store.entries))
+	}
+	entry := store.entries[0]
+	if entry.Actor != audit.ActorSystem || entry.Action != entity.AuditInvoiceCreate || entry.Target != "order:ORD-1" {
+		t.Errorf("entry = %+v", entry)
+	}
+}
@@ -0,0 +1,72 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+	"wfsync/entity"
+	"wfsync/lib/sl"
+)
+
+// batchOrderReserve is the time a batch order needs left on the request context to be
+// started: enough for wFirma to create the invoice and hand over its PDF.
+const batchOrderReserve = 20 * time.Second
+
+// B2BCreateInvoices creates the invoices of a batch of B2B orders, at most batchWorkers
+// at a time. Every order gets an outcome at its index; a failing
+// order does not stop the others. An order is only started while batchOrderReserve is
+// left before the context deadline, so the batch answers within the request timeout;
+// the orders left over get ErrBatchTimeLimit.
+func (c *Core) B2BCreateInvoices(ctx context.Context, orders []*entity.B2BOrder) []entity.B2BBatchOutcome {
+	outcomes := make([]entity.B2BBatchOutcome, len(orders))
+	workers := c.batchWorkers
+	if workers <= 0 {
+		workers = 1
+	}
+	deadline, hasDeadline := ctx.Deadline()
+	slots := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	for i, order := range orders {
+		slots <- struct{}{}
+		if hasDeadline && time.Until(deadline) < batchOrderReserve {
+			<-slots
+			outcomes[i] = entity.B2BBatchOutcome{Err: entity.ErrBatchTimeLimit}
+			continue
+		}
+		wg.Add(1)
+		go func(i int, order *entity.B2BOrder) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			outcomes[i] = c.b2bBatchInvoice(ctx, order)
+		}(i, order)
+	}
+	wg.Wait()
+	return outcomes
+}
+
+// b2bBatchInvoice creates the invoice of one batch order. A panic is turned into the
+// order's error so it cannot take the rest of the batch down with it.
+func (c *Core) b2bBatchInvoice(ctx context.Context, order *entity.B2BOrder) (outcome entity.B2BBatchOutcome) {
+	defer func() {
+		if r := recover(); r != nil {
+			outcome = entity.B2BBatchOutcome{Err: fmt.Errorf("internal error: %v", r)}
+			c.log.With(
+				slog.String("order_number", order.OrderNumber),
+				slog.Any("panic", r),
+			).Error("b2b batch order")
+		}
+	}()
+	if err := ctx.Err(); err != nil {
+		return entity.B2BBatchOutcome{Err: err}
+	}
+	payment, err := c.B2BCreateInvoice(ctx, order)
+	if err != nil {
+		c.log.With(
+			slog.String("order_number", order.OrderNumber),
+			sl.Err(err),
+		).Warn("b2b batch order failed")
+	}
+	return entity.B2BBatchOutcome{Payment: payment, Err: err}
+}
@@ -0,0 +1,138 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+	"wfsync/entity"
+)
+
+// batchInvoicer registers invoices concurrently, failing the order numbers in fail, and
+// records the highest number of registrations in flight at once.
+type batchInvoicer struct {
+	InvoiceService
+	fail map[string]bool
+
+	mu          sync.Mutex
+	inFlight    int
+	maxInFlight int
+}
+
+func (b *batchInvoicer) ExpectedB2BVATRate(countryCode string, _ bool) int {
+	if countryCode == "PL" {
+		return 23
+	}
+	return 0
+}
+
+func (b *batchInvoicer) FindInvoiceByExternalId(_ context.Context, _ string) (string, error) {
+	return "", nil
+}
+
+func (b *batchInvoicer) RegisterInvoice(_ context.Context, params *entity.CheckoutParams) (*entity.Payment, error) {
+	b.mu.Lock()
+	b.inFlight++
+	if b.inFlight > b.maxInFlight {
+		b.maxInFlight = b.inFlight
+	}
+	b.mu.Unlock()
+	time.Sleep(5 * time.Millisecond)
+	b.mu.Lock()
+	b.inFlight--
+	b.mu.Unlock()
+
+	if b.fail[params.OrderId] {
+		return nil, errors.New("wfirma 500")
+	}
+	return &entity.Payment{Id: "inv-" + params.OrderId, OrderId: params.OrderId, Amount: params.Total}, nil
+}
+
+func (b *batchInvoicer) DownloadInvoice(_ context.Context, invoiceID string) (string, *entity.FileMeta, error) {
+	return invoiceID + ".pdf", &entity.FileMeta{ContentType: "application/pdf"}, nil
+}
+
+func batchOrder(number, country string) *entity.B2BOrder {
+	return &entity.B2BOrder{
+		OrderUID:      "uid-" + number,
+		OrderNumber:   number,
+		ClientName:    "Firma",
+		ClientEmail:   "firma@example.com",
+		ClientCountry: country,
+		Total:         100,
+		CurrencyCode:  "EUR",
+		Items:         []*entity.B2BItem{{ProductName: "Book", Quantity: 1, Price: 100}},
+	}
+}
+
+// TestB2BCreateInvoicesMixed runs a batch where one order fails in wFirma and one fails
+// VAT validation: the other orders are still invoiced, every outcome sits at its order's
+// index, and no more than batchWorkers orders are registered at a time.
+func TestB2BCreateInvoicesMixed(t *testing.T) {
+	inv := &batchInvoicer{fail: map[string]bool{"B-2": true}}
+	c := &Core{inv: inv, batchWorkers: 2, fileUrl: "https://files.example.com", log: slog.New(slog.NewTextHandler(io.Discard, nil))}
+
+	orders := []*entity.B2BOrder{
+		batchOrder("B-1", "DE"),
+		batchOrder("B-2", "DE"),
+		batchOrder("B-3", "PL"), // declares 0% where 23% is required
+		batchOrder("B-4", "FR"),
+		batchOrder("B-5", "DE"),
+	}
+	outcomes := c.B2BCreateInvoices(context.Background(), orders)
+	if len(outcomes) != len(orders) {
+		t.Fatalf("outcomes = %d, want %d", len(outcomes), len(orders))
+	}
+
+	for i, order := range orders {
+		outcome := outcomes[i]
+		switch order.OrderNumber {
+		case "B-2":
+			if outcome.Err == nil || outcome.Payment != nil {
+				t.Errorf("%s: outcome = %+v, want the wFirma error", order.OrderNumber, outcome)
+			}
+		case "B-3":
+			if !errors.Is(outcome.Err, entity.ErrVATRateMismatch) {
+				t.Errorf("%s: error = %v, want ErrVATRateMismatch", order.OrderNumber, outcome.Err)
+			}
+		default:
+			if outcome.Err != nil {
+				t.Errorf("%s: %v", order.OrderNumber, outcome.Err)
+				continue
+			}
+			if outcome.Payment.Id != "inv-"+order.OrderNumber {
+				t.Errorf("%s: invoice %q at its index", order.OrderNumber, outcome.Payment.Id)
+			}
+		}
+	}
+	if inv.maxInFlight > 2 {
+		t.Errorf("%d orders registered at once, want at most 2", inv.maxInFlight)
+	}
+}
+
+// TestB2BCreateInvoicesTimeLimit starts no order once less than batchOrderReserve is left
+// on the request context, and reports those orders for sending again.
+func TestB2BCreateInvoicesTimeLimit(t *testing.T) {
+	inv := &batchInvoicer{}
+	c := &Core{inv: inv, batchWorkers: 2, fileUrl: "https://files.example.com", log: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	orders := []*entity.B2BOrder{batchOrder("B-1", "DE"), batchOrder("B-2", "DE")}
+
+	ctx, cancel := context.WithTimeout(context.Background(), batchOrderReserve+time.Minute)
+	defer cancel()
+	for i, outcome := range c.B2BCreateInvoices(ctx, orders) {
+		if outcome.Err != nil {
+			t.Errorf("order %d with time left: %v", i, outcome.Err)
+		}
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), batchOrderReserve/2)
+	defer cancel()
+	for i, outcome := range c.B2BCreateInvoices(ctx, orders) {
+		if !errors.Is(outcome.Err, entity.ErrBatchTimeLimit) || outcome.Payment != nil {
+			t.Errorf("order %d near the deadline: outcome = %+v, want ErrBatchTimeLimit", i, outcome)
+		}
+	}
+}
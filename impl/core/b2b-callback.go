@@ -0,0 +1,168 @@
+// Package core — b2b-callback.go delivers B2B documents beyond the plain link: the
+// optional inline PDF and the callback to the portal. The portal passes a callback_url
+// with the order; once the proforma or invoice exists, the resulting Payment is POSTed
+// there so the portal gets the document id, number and file link without polling.
+//
+// The request is signed the same way Stripe signs its webhooks: the receiver recomputes
+// HMAC-SHA256 over "<timestamp>.<body>" with the shared secret and compares it with the
+// X-WFSync-Signature header, rejecting stale timestamps to prevent replays.
+package core
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+	"wfsync/entity"
+	"wfsync/lib/sl"
+)
+
+const (
+	callbackHeaderEvent     = "X-WFSync-Event"
+	callbackHeaderTimestamp = "X-WFSync-Timestamp"
+	callbackHeaderSignature = "X-WFSync-Signature"
+
+	callbackEventProforma = "proforma.created"
+	callbackEventInvoice  = "invoice.created"
+
+	// defaultMaxInlinePDF caps inline PDFs when b2b.max_inline_pdf_kb is not positive.
+	defaultMaxInlinePDF = 5120 * 1024
+)
+
+// signCallback returns the hex HMAC-SHA256 of "<timestamp>.<body>" keyed with secret.
+func signCallback(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// newCallbackRequest builds the signed POST carrying the payment as JSON. Without a
+// secret there is no request: a callback is never sent unsigned.
+func newCallbackRequest(ctx context.Context, callbackURL, secret, event string, payment *entity.Payment, now time.Time) (*http.Request, error) {
+	if secret == "" {
+		return nil, entity.ErrCallbackUnsigned
+	}
+	body, err := json.Marshal(payment)
+	if err != nil {
+		return nil, fmt.Errorf("marshal payment: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, callbackURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	ts := now.Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(callbackHeaderEvent, event)
+	req.Header.Set(callbackHeaderTimestamp, strconv.FormatInt(ts, 10))
+	req.Header.Set(callbackHeaderSignature, "sha256="+signCallback(secret, ts, body))
+	return req, nil
+}
+
+// validateB2BCallback rejects an order with a callback_url while no callback secret is
+// configured, before any document is created for it.
+func (c *Core) validateB2BCallback(order *entity.B2BOrder) error {
+	if order.CallbackURL != "" && c.callbackSecret == "" {
+		return entity.ErrCallbackUnsigned
+	}
+	return nil
+}
+
+// notifyB2BCallback posts the payment to the order's callback URL in the background.
+// The inline PDF (FileData) is never included; receivers fetch the file by its link.
+// It runs detached from the request context: the HTTP response to the B2B portal must
+// not wait for (or be canceled together with) the callback delivery. Failures are
+// logged only — the document already exists and the portal can still fetch it.
+func (c *Core) notifyB2BCallback(order *entity.B2BOrder, event string, payment *entity.Payment) {
+	if order == nil || order.CallbackURL == "" || payment == nil {
+		return
+	}
+	// Snapshot the head payment: the caller may still fill FileData for its own response,
+	// and the callback must carry neither that payload nor a data race.
+	snapshot := *payment
+	snapshot.FileData = ""
+	go func() {
+		log := c.log.With(
+			slog.String("order_number", order.OrderNumber),
+			slog.String("event", event),
+			slog.String("callback_url", order.CallbackURL),
+		)
+		ctx, cancel := context.WithTimeout(context.Background(), c.callbackTimeout)
+		defer cancel()
+		if err := c.sendB2BCallback(ctx, order.CallbackURL, event, &snapshot); err != nil {
+			log.With(slog.String("tg_topic", entity.TopicError)).Warn("b2b callback", sl.Err(err))
+			return
+		}
+		log.Debug("b2b callback delivered")
+	}()
+}
+
+// sendB2BCallback performs a single delivery attempt and treats any non-2xx reply as failure.
+func (c *Core) sendB2BCallback(ctx context.Context, callbackURL, event string, payment *entity.Payment) error {
+	req, err := newCallbackRequest(ctx, callbackURL, c.callbackSecret, event, payment, time.Now())
+	if err != nil {
+		return err
+	}
+	resp, err := c.callbackClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("post callback: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("callback returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// attachPDF inlines the created document's PDF when the B2B order asked for it. The
+// document exists at this point, so a failed attach must not fail the request — the
+// caller still gets the link.
+func (c *Core) attachPDF(order *entity.B2BOrder, payment *entity.Payment) {
+	if !order.IncludePDF {
+		return
+	}
+	if err := c.inlinePDF(payment); err != nil {
+		c.log.With(slog.String("order_number", order.OrderNumber)).Warn("attach pdf", sl.Err(err))
+	}
+}
+
+// inlinePDF fills payment.FileData with the base64-encoded PDF of the head document, read
+// from the local copy downloaded during registration. Files above the configured cap, or
+// defaultMaxInlinePDF when none is configured, are rejected rather than truncated, since
+// a partial PDF is useless to the caller.
+func (c *Core) inlinePDF(payment *entity.Payment) error {
+	if payment == nil || payment.InvoiceFile == "" {
+		return fmt.Errorf("no document file to attach")
+	}
+	path := filepath.Join(c.filePath, payment.InvoiceFile)
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("stat document file: %w", err)
+	}
+	limit := c.maxInlinePDF
+	if limit <= 0 {
+		limit = defaultMaxInlinePDF
+	}
+	if info.Size() > limit {
+		return fmt.Errorf("document file is %d bytes, inline limit is %d", info.Size(), limit)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read document file: %w", err)
+	}
+	payment.FileData = base64.StdEncoding.EncodeToString(data)
+	return nil
+}
@@ -0,0 +1,177 @@
+package core
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+	"wfsync/entity"
+)
+
+// TestSignCallbackKnownVector pins the signature scheme (HMAC-SHA256 over
+// "<timestamp>.<body>") so receivers built against the documented recipe keep verifying.
+func TestSignCallbackKnownVector(t *testing.T) {
+	got := signCallback("secret", 1700000000, []byte(`{"id":"1"}`))
+	want := "086f6aff7bd084c98679825129c5a64dbad88c760016d6d2c0fb123f27951d54"
+	if got != want {
+		t.Fatalf("signCallback() = %s, want %s", got, want)
+	}
+}
+
+// TestB2BCallbackPayloadAndSignature delivers a callback to a test server and verifies
+// the receiver-side contract: JSON Payment body, event and timestamp headers, and an
+// HMAC that validates against the shared secret.
+func TestB2BCallbackPayloadAndSignature(t *testing.T) {
+	const secret = "s3cr3t"
+
+	var (
+		gotBody    []byte
+		gotHeaders http.Header
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotBody, _ = io.ReadAll(r.Body)
+		gotHeaders = r.Header.Clone()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	c := &Core{
+		log:             slog.New(slog.NewTextHandler(io.Discard, nil)),
+		callbackSecret:  secret,
+		callbackTimeout: 5 * time.Second,
+		callbackClient:  srv.Client(),
+	}
+	payment := &entity.Payment{
+		Amount:  15000,
+		Id:      "987654",
+		Number:  "FV 12/2025",
+		OrderId: "B2B-123456",
+		Link:    "https://files.example.com/uuid-1.pdf",
+	}
+
+	if err := c.sendB2BCallback(context.Background(), srv.URL, callbackEventInvoice, payment); err != nil {
+		t.Fatalf("sendB2BCallback: %v", err)
+	}
+
+	var decoded entity.Payment
+	if err := json.Unmarshal(gotBody, &decoded); err != nil {
+		t.Fatalf("body is not a Payment: %v", err)
+	}
+	if decoded.Id != payment.Id || decoded.Number != payment.Number || decoded.Link != payment.Link {
+		t.Errorf("payload = %+v, want %+v", decoded, *payment)
+	}
+	if ev := gotHeaders.Get(callbackHeaderEvent); ev != callbackEventInvoice {
+		t.Errorf("event header = %q, want %q", ev, callbackEventInvoice)
+	}
+
+	ts, err := strconv.ParseInt(gotHeaders.Get(callbackHeaderTimestamp), 10, 64)
+	if err != nil {
+		t.Fatalf("timestamp header: %v", err)
+	}
+	want := "sha256=" + signCallback(secret, ts, gotBody)
+	if !hmac.Equal([]byte(gotHeaders.Get(callbackHeaderSignature)), []byte(want)) {
+		t.Errorf("signature header = %q, want %q", gotHeaders.Get(callbackHeaderSignature), want)
+	}
+}
+
+// TestB2BCallbackErrors covers the failure modes the caller logs: a non-2xx receiver and
+// a missing secret, which sends nothing rather than an unsigned request.
+func TestB2BCallbackErrors(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	c := &Core{
+		log:             slog.New(slog.NewTextHandler(io.Discard, nil)),
+		callbackSecret:  "s3cr3t",
+		callbackTimeout: 5 * time.Second,
+		callbackClient:  srv.Client(),
+	}
+	payment := &entity.Payment{Id: "1", OrderId: "X"}
+	if err := c.sendB2BCallback(context.Background(), srv.URL, callbackEventProforma, payment); err == nil {
+		t.Fatal("expected an error for a 500 response")
+	}
+
+	c.callbackSecret = ""
+	err := c.sendB2BCallback(context.Background(), srv.URL, callbackEventProforma, payment)
+	if !errors.Is(err, entity.ErrCallbackUnsigned) {
+		t.Errorf("error = %v, want %v without a secret", err, entity.ErrCallbackUnsigned)
+	}
+	if requests != 1 {
+		t.Errorf("requests = %d, want 1: nothing is sent without a secret", requests)
+	}
+}
+
+// TestB2BCallbackRequiresSecret checks an order asking for a callback is rejected before
+// any document is created when no callback secret is configured.
+func TestB2BCallbackRequiresSecret(t *testing.T) {
+	inv := &batchInvoicer{}
+	c := &Core{inv: inv, log: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	order := batchOrder("B2B-1", "PL")
+	order.CallbackURL = "https://portal.example.com/callback"
+
+	if _, err := c.B2BCreateInvoice(context.Background(), order); !errors.Is(err, entity.ErrCallbackUnsigned) {
+		t.Errorf("B2BCreateInvoice error = %v, want %v", err, entity.ErrCallbackUnsigned)
+	}
+	if _, err := c.B2BCreateProforma(context.Background(), order); !errors.Is(err, entity.ErrCallbackUnsigned) {
+		t.Errorf("B2BCreateProforma error = %v, want %v", err, entity.ErrCallbackUnsigned)
+	}
+	if inv.maxInFlight != 0 {
+		t.Error("a document was registered for a rejected order")
+	}
+}
+
+// TestAttachPDF checks that include_pdf produces the file as base64 and that files above
+// the inline cap, or the default cap when none is configured, are refused instead of
+// being returned truncated.
+func TestAttachPDF(t *testing.T) {
+	dir := t.TempDir()
+	content := []byte("%PDF-1.4 test document")
+	if err := os.WriteFile(filepath.Join(dir, "doc.pdf"), content, 0o644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+
+	c := &Core{filePath: dir, maxInlinePDF: 1024}
+	payment := &entity.Payment{Id: "1", InvoiceFile: "doc.pdf"}
+	if err := c.inlinePDF(payment); err != nil {
+		t.Fatalf("inlinePDF: %v", err)
+	}
+	decoded, err := base64.StdEncoding.DecodeString(payment.FileData)
+	if err != nil {
+		t.Fatalf("file data is not base64: %v", err)
+	}
+	if string(decoded) != string(content) {
+		t.Errorf("decoded file = %q, want %q", decoded, content)
+	}
+
+	c.maxInlinePDF = int64(len(content) - 1)
+	capped := &entity.Payment{Id: "1", InvoiceFile: "doc.pdf"}
+	if err = c.inlinePDF(capped); err == nil {
+		t.Error("expected an error above the inline size cap")
+	}
+	if capped.FileData != "" {
+		t.Error("file data must stay empty when the cap is exceeded")
+	}
+
+	// An unset cap falls back to the default rather than allowing any size.
+	c.maxInlinePDF = 0
+	if err = os.Truncate(filepath.Join(dir, "doc.pdf"), defaultMaxInlinePDF+1); err != nil {
+		t.Fatalf("grow file: %v", err)
+	}
+	if err = c.inlinePDF(&entity.Payment{Id: "1", InvoiceFile: "doc.pdf"}); err == nil {
+		t.Error("expected an error above the default inline size cap")
+	}
+}
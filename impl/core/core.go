@@ -5,7 +5,7 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
-	"net/url"
+	"net/http"
 	"os"
 	"path/filepath"
 	"sort"
@@ -15,6 +15,10 @@ import (
 	"wfsync/internal/config"
 	"wfsync/internal/stripeclient"
 	"wfsync/internal/wfirma"
+	"wfsync/lib/audit"
+	"wfsync/lib/features"
+	"wfsync/lib/metrics"
+	"wfsync/lib/money"
 	"wfsync/lib/sl"
 	occlient "wfsync/opencart/oc-client"
 
@@ -32,9 +36,11 @@ type AuthService interface {
 
 type InvoiceService interface {
 	DownloadInvoice(ctx context.Context, invoiceID string) (string, *entity.FileMeta, error)
+	StreamInvoice(ctx context.Context, invoiceID string) (io.ReadCloser, *entity.FileMeta, error)
 	RegisterInvoice(ctx context.Context, params *entity.CheckoutParams) (*entity.Payment, error)
 	RegisterProforma(ctx context.Context, params *entity.CheckoutParams) (*entity.Payment, error)
 	DeleteProforma(ctx context.Context, invoiceID string) error
+	CreateCorrectiveInvoice(ctx context.Context, originalInvoiceID string, corrected *entity.CheckoutParams) (*entity.Payment, error)
 	SyncFromRemote(ctx context.Context, from, to string) (*entity.SyncResult, error)
 	SyncToRemote(ctx context.Context, from, to string) (*entity.SyncResult, error)
 	FindInvoices(ctx context.Context, from, to string) ([]*entity.LocalInvoice, error)
@@ -46,7 +52,36 @@ type InvoiceService interface {
 // PaymentDatabase provides access to payment-related data in MongoDB.
 type PaymentDatabase interface {
 	GetStripeOrderIds(orderIds []string) (map[string]bool, error)
+	GetCheckoutParamsByOrder(orderId string) (*entity.CheckoutParams, error)
 	GetUnresolvedHeldParams(limit int) ([]*entity.CheckoutParams, error)
+	UpdateInvoiceFile(orderId, invoiceId, invoiceFile string) error
+	SaveRefund(orderId, eventId string, refunded int64, correctionId string) error
+	RecordDocumentFiles(orderId string, files ...string) error
+}
+
+// IdempotencyStore keeps the responses replayed for repeated Idempotency-Key requests.
+type IdempotencyStore interface {
+	GetIdempotentResponse(user, key string) (*entity.IdempotentResponse, error)
+	SaveIdempotentResponse(resp *entity.IdempotentResponse) error
+}
+
+// DraftStore keeps invoice drafts, one per order, until they are issued.
+type DraftStore interface {
+	SaveInvoiceDraft(params *entity.CheckoutParams) error
+	GetInvoiceDraft(orderId string) (*entity.CheckoutParams, error)
+	DeleteInvoiceDraft(orderId string) error
+}
+
+// EventStore keeps raw Stripe webhook events for audits.
+type EventStore interface {
+	SaveStripeEvent(record *entity.StripeEventRecord) error
+}
+
+// Notifier delivers business notifications (payment captured, order invoiced) to
+// subscribers of a topic (entity.TopicXxx), rendering each event with its message
+// template. The Telegram bot implements it.
+type Notifier interface {
+	Notify(topic string, level slog.Level, n *entity.Notification)
 }
 
 type Core struct {
@@ -55,17 +90,61 @@ type Core struct {
 	inv        InvoiceService
 	db         PaymentDatabase
 	auth       AuthService
+	idem       IdempotencyStore
+	drafts     DraftStore
+	events     EventStore
+	auditLog   *audit.Log
+	features   *features.Flags
+	notifier   Notifier
 	retryQueue *RetryQueue
 	filePath   string
 	fileUrl    string
 	log        *slog.Logger
+
+	callbackSecret  string
+	callbackTimeout time.Duration
+	callbackClient  *http.Client
+	maxInlinePDF    int64
+	batchWorkers    int // B2B batch orders invoiced at a time
+
+	linkSecret  string
+	linkBaseURL string
+	linkTTL     time.Duration
+
+	eventRetention time.Duration
+	totalTolerance int64
+
+	health healthState
+	orders orderLocks // serializes invoice registration per order
 }
 
 func New(conf *config.Config, log *slog.Logger) Core {
+	callbackTimeout := time.Duration(conf.B2B.CallbackTimeoutSec) * time.Second
+	if callbackTimeout <= 0 {
+		callbackTimeout = 10 * time.Second
+	}
+	linkTTL := time.Duration(conf.FileLinks.TTLMin) * time.Minute
+	if linkTTL <= 0 {
+		linkTTL = 7 * 24 * time.Hour
+	}
+	eventRetention := time.Duration(conf.Stripe.EventRetentionDays) * 24 * time.Hour
+	if eventRetention <= 0 {
+		eventRetention = 365 * 24 * time.Hour
+	}
 	return Core{
-		filePath: conf.FilePath,
-		fileUrl:  conf.OpenCart.FileUrl,
-		log:      log.With(sl.Module("core")),
+		filePath:        conf.FilePath,
+		fileUrl:         conf.OpenCart.FileUrl,
+		log:             log.With(sl.Module("core")),
+		callbackSecret:  conf.B2B.CallbackSecret,
+		callbackTimeout: callbackTimeout,
+		callbackClient:  &http.Client{Timeout: callbackTimeout},
+		maxInlinePDF:    int64(conf.B2B.MaxInlinePDFKB) * 1024,
+		batchWorkers:    conf.B2B.BatchConcurrency,
+		linkSecret:      conf.FileLinks.Secret,
+		linkBaseURL:     conf.FileLinks.BaseURL,
+		linkTTL:         linkTTL,
+		eventRetention:  eventRetention,
+		totalTolerance:  conf.TotalTolerance,
 	}
 }
 
@@ -81,6 +160,37 @@ func (c *Core) SetAuthService(auth AuthService) {
 	c.auth = auth
 }
 
+func (c *Core) SetIdempotencyStore(store IdempotencyStore) {
+	c.idem = store
+}
+
+func (c *Core) SetDraftStore(store DraftStore) {
+	c.drafts = store
+}
+
+func (c *Core) SetEventStore(store EventStore) {
+	c.events = store
+}
+
+func (c *Core) SetAuditLog(l *audit.Log) {
+	c.auditLog = l
+}
+
+func (c *Core) SetFeatures(f *features.Flags) {
+	c.features = f
+}
+
+func (c *Core) SetNotifier(n Notifier) {
+	c.notifier = n
+}
+
+// notify sends a business notification when a notifier is connected.
+func (c *Core) notify(topic string, level slog.Level, event string, fields map[string]string) {
+	if c.notifier != nil {
+		c.notifier.Notify(topic, level, &entity.Notification{Event: event, Fields: fields})
+	}
+}
+
 func (c *Core) SetPaymentDatabase(db PaymentDatabase) {
 	c.db = db
 }
@@ -111,11 +221,29 @@ func (c *Core) AuthenticateByToken(token string) (*entity.User, error) {
 	return c.auth.UserByToken(token)
 }
 
+func (c *Core) GetIdempotentResponse(user, key string) (*entity.IdempotentResponse, error) {
+	if c.idem == nil {
+		return nil, fmt.Errorf("idempotency store not connected")
+	}
+	return c.idem.GetIdempotentResponse(user, key)
+}
+
+func (c *Core) SaveIdempotentResponse(resp *entity.IdempotentResponse) error {
+	if c.idem == nil {
+		return fmt.Errorf("idempotency store not connected")
+	}
+	return c.idem.SaveIdempotentResponse(resp)
+}
+
 func (c *Core) StripeVerifySignature(payload []byte, header string, tolerance time.Duration) bool {
 	return c.sc.VerifySignature(payload, header, tolerance)
 }
 
-func (c *Core) StripeEvent(ctx context.Context, evt *stripe.Event) {
+// StripeEvent stores and handles a webhook event; payload is the verified request body
+// the event was parsed from.
+func (c *Core) StripeEvent(ctx context.Context, evt *stripe.Event, payload []byte) {
+	c.saveStripeEvent(evt, payload)
+
 	// create checkout params from the stripe event
 	params := c.sc.HandleEvent(evt)
 	if params == nil {
@@ -151,6 +279,11 @@ func (c *Core) StripeEvent(ctx context.Context, evt *stripe.Event) {
 		}
 	}
 
+	if params.Status == "refunded" {
+		c.processRefund(ctx, params)
+		return
+	}
+
 	if !params.Paid {
 		return
 	}
@@ -232,6 +365,38 @@ func (c *Core) processInvoice(ctx context.Context, params *entity.CheckoutParams
 		params.TaxTitle = order.TaxTitle
 		params.SubTotal = order.SubTotal
 		params.CustomerGroup = order.CustomerGroup
+		// The OpenCart lines carry their own rates; Stripe's no longer matter.
+		params.TaxRateError = ""
+	}
+
+	if params.TaxRateError != "" {
+		c.log.With(
+			slog.String("order_id", params.OrderId),
+			slog.String("event_id", params.EventId),
+			slog.String("error", params.TaxRateError),
+			slog.String("tg_topic", entity.TopicError),
+		).Warn("stripe tax rate cannot be invoiced, order left for manual review")
+		return nil
+	}
+
+	// Stripe reports one paid order through several events (checkout.session.completed,
+	// invoice.finalized, payment_intent.succeeded), each building its own params. Once one
+	// of them registered the invoice, the order's stored record carries its id. The order
+	// stays locked from this check until the new invoice is stored, so concurrent webhooks
+	// see each other's invoice.
+	if params.OrderId != "" {
+		defer c.orders.lock(params.OrderId)()
+	}
+	if params.InvoiceId == "" && params.OrderId != "" && c.db != nil {
+		stored, err := c.db.GetCheckoutParamsByOrder(params.OrderId)
+		if err != nil {
+			c.log.With(
+				sl.Err(err),
+				slog.String("order_id", params.OrderId),
+			).Warn("get stored checkout params")
+		} else if stored != nil && stored.InvoiceId != "" {
+			params.InvoiceId = stored.InvoiceId
+		}
 	}
 
 	if params.InvoiceId != "" && params.OrderId != "" {
@@ -244,7 +409,7 @@ func (c *Core) processInvoice(ctx context.Context, params *entity.CheckoutParams
 	}
 
 	// register new invoice
-	payment, err := c.inv.RegisterInvoice(ctx, params)
+	payment, err := c.RegisterInvoice(ctx, params)
 	if err != nil {
 		// wfirma layer already reports the user-facing error to Telegram;
 		// keep this local log for event_id correlation but suppress duplicate notification.
@@ -254,6 +419,7 @@ func (c *Core) processInvoice(ctx context.Context, params *entity.CheckoutParams
 			slog.String("order_id", params.OrderId),
 			slog.Bool("tg_skip", true),
 		).Error("register invoice")
+		metrics.Failures.Inc()
 		if c.retryQueue != nil {
 			c.retryQueue.Enqueue(params, err.Error())
 		}
@@ -268,23 +434,27 @@ func (c *Core) processInvoice(ctx context.Context, params *entity.CheckoutParams
 			).Error("save invoice id")
 		}
 	}
+	if payment != nil {
+		metrics.OrdersProcessed.Inc()
+		number := payment.Number
+		if number == "" {
+			number = payment.Id
+		}
+		c.notify(entity.TopicOrder, slog.LevelInfo, entity.EventOrderInvoiced, map[string]string{
+			"order_id": params.OrderId,
+			"invoice":  number,
+		})
+	}
 	return payment
 }
 
+// WFirmaInvoiceDownload streams the invoice document from wFirma to the caller. Nothing is
+// written to disk: the file would not be referenced by any order, only read back once.
 func (c *Core) WFirmaInvoiceDownload(ctx context.Context, invoiceID string) (io.ReadCloser, *entity.FileMeta, error) {
 	if c.inv == nil {
 		return nil, nil, fmt.Errorf("invoice service not connected")
 	}
-	fileName, meta, err := c.inv.DownloadInvoice(ctx, invoiceID)
-	if err != nil {
-		return nil, nil, err
-	}
-	filePath := filepath.Join(c.filePath, fileName)
-	file, err := os.Open(filePath)
-	if err != nil {
-		return nil, nil, fmt.Errorf("open file: %w", err)
-	}
-	return file, meta, nil
+	return c.inv.StreamInvoice(ctx, invoiceID)
 }
 
 func (c *Core) WFirmaOrderToInvoice(ctx context.Context, orderId int64, useCurrentDate bool) (*entity.CheckoutParams, error) {
@@ -331,11 +501,10 @@ func (c *Core) WFirmaOrderToInvoice(ctx context.Context, orderId int64, useCurre
 		params.InvoiceId = ""
 	}
 
-	linesTotal := params.ItemsTotal()
-	if linesTotal != params.Total {
+	if err := params.ValidateTotal(c.totalTolerance); err != nil {
 		log.With(
-			slog.Int64("lines_total", linesTotal),
-			slog.Int64("diff", params.Total-linesTotal),
+			slog.Int64("diff", params.Total-params.ItemsTotal()),
+			sl.Err(err),
 		).Warn("order total mismatch")
 		//params.RecalcWithDiscount()
 	}
@@ -344,7 +513,7 @@ func (c *Core) WFirmaOrderToInvoice(ctx context.Context, orderId int64, useCurre
 
 	log.Debug("order to invoice")
 
-	payment, err := c.inv.RegisterInvoice(ctx, params)
+	payment, err := c.RegisterInvoice(ctx, params)
 	if err != nil {
 		return nil, err
 	}
@@ -377,6 +546,7 @@ func (c *Core) WFirmaRegisterProforma(ctx context.Context, params *entity.Checko
 	if err != nil {
 		return nil, err
 	}
+	c.auditLog.Record(audit.Actor(ctx), entity.AuditProformaCreate, audit.OrderTarget(params.OrderId), nil, documentState(params, payment))
 
 	fileName, link, err := c.downloadInvoice(ctx, params.ProformaFile, payment.Id)
 	if err != nil {
@@ -390,6 +560,7 @@ func (c *Core) WFirmaRegisterProforma(ctx context.Context, params *entity.Checko
 	if err := c.downloadParts(ctx, payment); err != nil {
 		return nil, err
 	}
+	c.recordFiles(params.OrderId, payment)
 
 	return payment, nil
 }
@@ -444,6 +615,20 @@ func (c *Core) discardExistingProforma(ctx context.Context, params *entity.Check
 	params.ProformaFile = ""
 }
 
+// RegisterInvoice creates the order's wFirma invoice and records it in the audit log.
+// Every path that creates an invoice goes through it, the retry queue as its Registrar.
+func (c *Core) RegisterInvoice(ctx context.Context, params *entity.CheckoutParams) (*entity.Payment, error) {
+	if c.inv == nil {
+		return nil, fmt.Errorf("invoice service not connected")
+	}
+	payment, err := c.inv.RegisterInvoice(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	c.auditLog.Record(audit.Actor(ctx), entity.AuditInvoiceCreate, audit.OrderTarget(params.OrderId), nil, documentState(params, payment))
+	return payment, nil
+}
+
 func (c *Core) WFirmaRegisterInvoice(ctx context.Context, params *entity.CheckoutParams) (*entity.Payment, error) {
 	if c.inv == nil {
 		return nil, fmt.Errorf("invoice service not connected")
@@ -477,7 +662,7 @@ func (c *Core) WFirmaRegisterInvoice(ctx context.Context, params *entity.Checkou
 	}
 
 	if params.InvoiceId == "" {
-		payment, err = c.inv.RegisterInvoice(ctx, params)
+		payment, err = c.RegisterInvoice(ctx, params)
 		if err != nil {
 			return nil, err
 		}
@@ -499,10 +684,33 @@ func (c *Core) WFirmaRegisterInvoice(ctx context.Context, params *entity.Checkou
 	if err := c.downloadParts(ctx, payment); err != nil {
 		return nil, err
 	}
+	c.recordFiles(params.OrderId, payment)
 
 	return payment, nil
 }
 
+// recordFiles records the payment's document files (head and split parts), whether or not
+// the order has checkout params. Without it the file janitor would see B2B and split-part
+// PDFs, which OpenCart never stores, as orphans. Failures are logged only: the document
+// is issued.
+func (c *Core) recordFiles(orderId string, payment *entity.Payment) {
+	if c.db == nil || payment == nil {
+		return
+	}
+	files := []string{payment.InvoiceFile}
+	for _, part := range payment.Parts {
+		if part != nil && part.InvoiceFile != "" && part.InvoiceFile != payment.InvoiceFile {
+			files = append(files, part.InvoiceFile)
+		}
+	}
+	if err := c.db.RecordDocumentFiles(orderId, files...); err != nil {
+		c.log.With(
+			slog.String("order_id", orderId),
+			sl.Err(err),
+		).Warn("record document files")
+	}
+}
+
 // downloadParts fetches the PDF for every additional split part on the payment
 // and fills in Link/InvoiceFile in place. The first part is assumed to already
 // carry its own file fields (downloaded by the caller); the slice is iterated
@@ -539,9 +747,9 @@ func (c *Core) downloadInvoice(ctx context.Context, fileName, paymentId string)
 		}
 	}
 
-	link, err := url.JoinPath(c.fileUrl, fileName)
+	link, err := c.fileLink(fileName)
 	if err != nil {
-		return "", "", fmt.Errorf("join url: %w", err)
+		return "", "", err
 	}
 	return fileName, link, nil
 }
@@ -557,21 +765,47 @@ func (c *Core) StripeHoldAmount(params *entity.CheckoutParams) (*entity.Payment,
 // StripeCaptureAmount captures a held payment. It returns the checkout params (resolved
 // from the session) alongside the payment so handlers can log the OpenCart order id even
 // when the capture fails.
-func (c *Core) StripeCaptureAmount(sessionId string, amount int64) (*entity.Payment, *entity.CheckoutParams, error) {
+func (c *Core) StripeCaptureAmount(ctx context.Context, sessionId string, amount int64) (*entity.Payment, *entity.CheckoutParams, error) {
+	if c.sc == nil {
+		return nil, nil, fmt.Errorf("stripe service not connected")
+	}
+	if sessionId == "" {
+		return nil, nil, fmt.Errorf("missing session id")
+	}
+	before := c.auditedPayment(sessionId)
 	pm, params, err := c.sc.CaptureAmount(sessionId, amount)
 	if err != nil {
 		return nil, params, err
 	}
+	if params != nil {
+		c.auditLog.Record(audit.Actor(ctx), entity.AuditPaymentCapture, audit.OrderTarget(params.OrderId), before, paymentState(params))
+	}
+	// The order records the running total captured, not the amount of this capture, so a
+	// staged capture does not overwrite the earlier ones.
+	status, captured := "paid", pm.Amount
+	if params != nil {
+		captured = params.Captured
+		if !params.Paid {
+			status = "partially_captured"
+		}
+	}
 	if c.oc != nil && pm.OrderId != "" {
-		if saveErr := c.oc.SavePaymentData(pm.OrderId, pm.Id, sessionId, "paid", pm.Amount); saveErr != nil {
+		if saveErr := c.oc.SavePaymentData(pm.OrderId, pm.Id, sessionId, status, captured); saveErr != nil {
 			c.log.With(sl.Err(saveErr), slog.String("order_id", pm.OrderId)).Error("update payment status after capture")
 		}
 	}
+	if params != nil {
+		c.notify(entity.TopicPayment, slog.LevelInfo, entity.EventPaymentCaptured, map[string]string{
+			"order_id":   params.OrderId,
+			"captured":   money.New(params.Captured, "").Format("."),
+			"authorized": money.New(params.Authorized, params.Currency).String(),
+		})
+	}
 	// Register the wFirma invoice asynchronously so the capture HTTP response is not
 	// blocked by wFirma latency; failures fall through to the retry queue. A manual
 	// capture emits no Stripe webhook we handle, so this is the only invoice trigger
-	// for held-then-captured payments.
-	if params != nil {
+	// for held-then-captured payments. Staged captures invoice once, on the final one.
+	if params != nil && params.Paid {
 		go c.processInvoice(context.Background(), params)
 	}
 	return pm, params, nil
@@ -613,11 +847,16 @@ func (c *Core) StripePaymentStatus(orderId string) (*entity.PaymentStatus, error
 // StripeCancelPayment cancels a held payment. It returns the checkout params (resolved
 // from the session) alongside the payment so handlers can log the OpenCart order id even
 // when the cancellation fails.
-func (c *Core) StripeCancelPayment(sessionId, reason string) (*entity.Payment, *entity.CheckoutParams, error) {
+func (c *Core) StripeCancelPayment(ctx context.Context, sessionId, reason string) (*entity.Payment, *entity.CheckoutParams, error) {
+	before := c.auditedPayment(sessionId)
 	pm, params, err := c.sc.CancelPayment(sessionId, reason)
 	if err != nil {
 		return nil, params, err
 	}
+	if params != nil {
+		c.auditLog.Record(audit.Actor(ctx), entity.AuditPaymentCancel, audit.OrderTarget(params.OrderId), before,
+			map[string]interface{}{"status": "canceled", "reason": reason})
+	}
 	if c.oc != nil && pm.OrderId != "" {
 		if saveErr := c.oc.SavePaymentData(pm.OrderId, pm.Id, sessionId, "canceled", pm.Amount); saveErr != nil {
 			c.log.With(sl.Err(saveErr), slog.String("order_id", pm.OrderId)).Error("update payment status after cancel")
@@ -631,15 +870,15 @@ func (c *Core) StripePayAmount(_ context.Context, params *entity.CheckoutParams)
 	if err != nil {
 		return nil, err
 	}
-	err = params.ValidateTotal()
-	if err != nil {
-		// not an error because may have a difference in 0.01 cent
+	// A gap beyond the rounding tolerance is an order-level discount (e.g. an OpenCart
+	// coupon); either way the lines are adjusted to the total.
+	if err = params.ValidateTotal(c.totalTolerance); err != nil {
 		c.log.With(
 			slog.String("order_id", params.OrderId),
 			sl.Err(err),
 		).Warn("invalid order total")
-		params.RecalcWithDiscount()
 	}
+	params.RecalcWithDiscount()
 	return c.sc.PayAmount(params)
 }
 
@@ -695,6 +934,80 @@ func (c *Core) WFirmaOrderFileInvoice(ctx context.Context, orderId int64) (*enti
 	return payment, nil
 }
 
+// WFirmaRedownloadInvoice fetches a fresh copy of an order's invoice PDF from wFirma and
+// replaces the stored file. WFirmaRegisterInvoice only downloads when no file is recorded,
+// so a file deleted or corrupted on disk could otherwise never be recovered. The invoice
+// itself is not touched; only the file and the columns pointing at it change.
+func (c *Core) WFirmaRedownloadInvoice(ctx context.Context, orderId int64) (*entity.Payment, error) {
+	if c.inv == nil {
+		return nil, fmt.Errorf("invoice service not connected")
+	}
+	if c.oc == nil {
+		return nil, fmt.Errorf("opencart service not connected")
+	}
+
+	params, err := c.oc.GetOrder(orderId)
+	if err != nil {
+		return nil, err
+	}
+	if params == nil {
+		return nil, fmt.Errorf("order not found")
+	}
+	if params.InvoiceId == "" {
+		return nil, fmt.Errorf("order has no invoice")
+	}
+
+	fileName, link, err := c.redownloadInvoiceFile(ctx, params.InvoiceId, params.InvoiceFile)
+	if err != nil {
+		return nil, err
+	}
+	log := c.log.With(
+		slog.Int64("order_id", orderId),
+		slog.String("invoice_id", params.InvoiceId),
+		slog.String("invoice_file", fileName),
+	)
+
+	if err = c.oc.UpdateOrderWithInvoice(orderId, params.InvoiceId, fileName); err != nil {
+		log.Error("update order with invoice file", sl.Err(err))
+	}
+	if c.db != nil {
+		if err = c.db.UpdateInvoiceFile(params.OrderId, params.InvoiceId, fileName); err != nil {
+			log.Error("update checkout params invoice file", sl.Err(err))
+		}
+	}
+	log.Info("invoice file re-downloaded")
+
+	return &entity.Payment{
+		Id:          params.InvoiceId,
+		Amount:      params.Total,
+		OrderId:     params.OrderId,
+		Link:        link,
+		InvoiceFile: fileName,
+	}, nil
+}
+
+// redownloadInvoiceFile downloads the invoice unconditionally and removes the previous
+// file once the new one is in place, so a failed download never leaves the order without
+// any file. A previous file that is already gone is the usual reason to re-download and
+// is not an error.
+func (c *Core) redownloadInvoiceFile(ctx context.Context, invoiceId, oldFile string) (string, string, error) {
+	fileName, link, err := c.downloadInvoice(ctx, "", invoiceId)
+	if err != nil {
+		return "", "", err
+	}
+	if oldFile != "" && oldFile != fileName {
+		oldPath := filepath.Join(c.filePath, filepath.Base(oldFile))
+		if err = os.Remove(oldPath); err != nil && !os.IsNotExist(err) {
+			c.log.With(
+				slog.String("invoice_id", invoiceId),
+				slog.String("file", oldFile),
+				sl.Err(err),
+			).Warn("remove previous invoice file")
+		}
+	}
+	return fileName, link, nil
+}
+
 func (c *Core) WFirmaCreateProforma(ctx context.Context, params *entity.CheckoutParams) (*entity.Payment, error) {
 	return c.WFirmaRegisterProforma(ctx, params)
 }
@@ -703,20 +1016,97 @@ func (c *Core) WFirmaCreateInvoice(ctx context.Context, params *entity.CheckoutP
 	return c.WFirmaRegisterInvoice(ctx, params)
 }
 
+// WFirmaDraftInvoice stores the invoice params for an order as a draft instead of
+// registering them, so line items can be reviewed and corrected first. Posting a draft
+// again for the same order replaces it; WFirmaIssueInvoice registers the latest one.
+// The returned params are the editable representation: shipping is already folded into
+// the line items, so Shipping is cleared to keep a re-posted draft from adding it twice.
+func (c *Core) WFirmaDraftInvoice(_ context.Context, params *entity.CheckoutParams) (*entity.CheckoutParams, error) {
+	if c.drafts == nil {
+		return nil, fmt.Errorf("draft store not connected")
+	}
+	if params.InvoiceId != "" {
+		return nil, fmt.Errorf("order %s already has invoice %s", params.OrderId, params.InvoiceId)
+	}
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+	params.Shipping = 0
+	params.ShippingVatRate = nil
+	params.Status = entity.InvoiceDraftStatus
+	params.Modified = time.Now()
+	if err := c.drafts.SaveInvoiceDraft(params); err != nil {
+		return nil, fmt.Errorf("save invoice draft: %w", err)
+	}
+	c.log.With(
+		slog.String("order_id", params.OrderId),
+		slog.Int64("total", params.Total),
+		slog.Int("items", len(params.LineItems)),
+	).Debug("invoice draft saved")
+	return params, nil
+}
+
+// WFirmaIssueInvoice registers the order's invoice draft in wFirma and removes the draft.
+// Returns entity.ErrInvoiceDraftNotFound when the order has no draft.
+func (c *Core) WFirmaIssueInvoice(ctx context.Context, orderId string) (*entity.Payment, error) {
+	if c.drafts == nil {
+		return nil, fmt.Errorf("draft store not connected")
+	}
+	params, err := c.drafts.GetInvoiceDraft(orderId)
+	if err != nil {
+		return nil, fmt.Errorf("get invoice draft: %w", err)
+	}
+	if params == nil {
+		return nil, entity.ErrInvoiceDraftNotFound
+	}
+	params.Status = ""
+	payment, err := c.WFirmaRegisterInvoice(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	// The invoice exists now; a draft left behind is harmless because issuing it again
+	// finds the invoice by order id instead of creating a second one.
+	if err = c.drafts.DeleteInvoiceDraft(orderId); err != nil {
+		c.log.With(
+			slog.String("order_id", orderId),
+			sl.Err(err),
+		).Warn("delete issued invoice draft")
+	}
+	return payment, nil
+}
+
 func (c *Core) B2BCreateProforma(ctx context.Context, order *entity.B2BOrder) (*entity.Payment, error) {
+	if err := c.validateB2BCallback(order); err != nil {
+		return nil, err
+	}
 	params := order.ToCheckoutParams()
 	if err := c.validateB2BVATRate(params); err != nil {
 		return nil, err
 	}
-	return c.WFirmaRegisterProforma(ctx, params)
+	payment, err := c.WFirmaRegisterProforma(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	c.notifyB2BCallback(order, callbackEventProforma, payment)
+	c.attachPDF(order, payment)
+	return payment, nil
 }
 
 func (c *Core) B2BCreateInvoice(ctx context.Context, order *entity.B2BOrder) (*entity.Payment, error) {
+	if err := c.validateB2BCallback(order); err != nil {
+		return nil, err
+	}
 	params := order.ToCheckoutParams()
 	if err := c.validateB2BVATRate(params); err != nil {
 		return nil, err
 	}
-	return c.WFirmaRegisterInvoice(ctx, params)
+	payment, err := c.WFirmaRegisterInvoice(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	c.notifyB2BCallback(order, callbackEventInvoice, payment)
+	c.attachPDF(order, payment)
+	return payment, nil
 }
 
 // validateB2BVATRate cross-checks the VAT rate implied by a B2B order payload
@@ -738,7 +1128,7 @@ func (c *Core) validateB2BVATRate(params *entity.CheckoutParams) error {
 	hasTaxId := params.ClientDetails.TaxId != ""
 
 	expected := c.inv.ExpectedB2BVATRate(countryCode, hasTaxId)
-	declared := params.TaxRate()
+	declared := params.TaxRate(wfirma.DomesticSale(countryCode))
 
 	if declared != expected {
 		c.log.With(
@@ -864,7 +1254,7 @@ func (c *Core) InvoiceList(ctx context.Context, from, to string) ([]*entity.Invo
 		if inv.Contractor != nil {
 			item.ContractorName = inv.Contractor.Name
 		}
-		total := int64(inv.Total * 100)
+		total := money.Cents(inv.Total)
 		if inv.Currency == "PLN" {
 			item.TotalPLN = total
 		} else if inv.Currency == "EUR" {
@@ -896,3 +1286,20 @@ func (c *Core) WFirmaSyncToRemote(ctx context.Context, from, to string) (*entity
 	}
 	return c.inv.SyncToRemote(ctx, from, to)
 }
+
+// OpenCartOrderEvent runs the job named by a store's order event for that order now,
+// rather than on the next poll.
+func (c *Core) OpenCartOrderEvent(ctx context.Context, event *entity.OpenCartEvent) (*entity.OpenCartEventResult, error) {
+	if c.oc == nil {
+		return nil, fmt.Errorf("opencart not connected: %w", entity.ErrSubsystemDisabled)
+	}
+	processed, err := c.oc.ProcessOrder(ctx, event.OrderId, occlient.JobType(event.Event))
+	if err != nil {
+		return nil, err
+	}
+	return &entity.OpenCartEventResult{
+		OrderId:   event.OrderId,
+		Event:     event.Event,
+		Processed: processed,
+	}, nil
+}
@@ -0,0 +1,462 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	"wfsync/entity"
+	"wfsync/internal/config"
+	"wfsync/internal/stripeclient"
+
+	"github.com/stripe/stripe-go/v76"
+)
+
+// captureAPI is a Stripe API that captures any known PaymentIntent in full.
+type captureAPI struct {
+	stripeclient.API
+	amount int64
+}
+
+func (a *captureAPI) CapturePaymentIntent(id string, params *stripe.PaymentIntentCaptureParams) (*stripe.PaymentIntent, error) {
+	return &stripe.PaymentIntent{
+		ID:             id,
+		Amount:         a.amount,
+		AmountReceived: *params.AmountToCapture,
+		Status:         stripe.PaymentIntentStatusSucceeded,
+	}, nil
+}
+
+// heldParams stores checkout params by order id and finds them by session id.
+type heldParams struct {
+	stripeclient.Database
+	params map[string]*entity.CheckoutParams
+}
+
+func (h *heldParams) SaveCheckoutParams(params *entity.CheckoutParams) error {
+	stored := *params
+	h.params[params.OrderId] = &stored
+	return nil
+}
+
+func (h *heldParams) GetCheckoutParamsSession(sessionId string) (*entity.CheckoutParams, error) {
+	for _, p := range h.params {
+		if p.SessionId == sessionId {
+			stored := *p
+			return &stored, nil
+		}
+	}
+	return nil, nil
+}
+
+// invoiceRecorder reports every invoice registration on a channel.
+type invoiceRecorder struct {
+	InvoiceService
+	registered chan *entity.CheckoutParams
+}
+
+func (r *invoiceRecorder) RegisterInvoice(_ context.Context, params *entity.CheckoutParams) (*entity.Payment, error) {
+	r.registered <- params
+	return &entity.Payment{Id: "inv-1", OrderId: params.OrderId}, nil
+}
+
+// TestStripeCaptureAmount covers the capture entry point: a held session is captured
+// and invoiced, while an unknown session or a missing Stripe client fails cleanly.
+func TestStripeCaptureAmount(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	sc, _ := stripeclient.New(&config.Config{}, log)
+	sc.SetAPI(&captureAPI{amount: 10000})
+	sc.SetDatabase(&heldParams{params: map[string]*entity.CheckoutParams{
+		"ORD-1": {
+			OrderId:       "ORD-1",
+			SessionId:     "cs_1",
+			PaymentId:     "pi_1",
+			Total:         10000,
+			Authorized:    10000,
+			Currency:      "pln",
+			ClientDetails: &entity.ClientDetails{Name: "Jan", Email: "jan@example.com"},
+		},
+	}})
+	inv := &invoiceRecorder{registered: make(chan *entity.CheckoutParams, 1)}
+	c := &Core{sc: sc, inv: inv, log: log}
+
+	pm, params, err := c.StripeCaptureAmount(context.Background(), "cs_1", 0)
+	if err != nil {
+		t.Fatalf("StripeCaptureAmount: %v", err)
+	}
+	if pm.Id != "pi_1" || pm.OrderId != "ORD-1" || !params.Paid {
+		t.Errorf("payment = %+v (paid %v), want pi_1 for ORD-1, paid", pm, params.Paid)
+	}
+	select {
+	case got := <-inv.registered:
+		if got.OrderId != "ORD-1" {
+			t.Errorf("invoiced order %q, want ORD-1", got.OrderId)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no invoice registered after the final capture")
+	}
+
+	if _, _, err = c.StripeCaptureAmount(context.Background(), "cs_missing", 0); err == nil {
+		t.Error("expected an error for an unknown session")
+	}
+	if _, _, err = (&Core{log: log}).StripeCaptureAmount(context.Background(), "cs_1", 0); err == nil {
+		t.Error("expected an error without a Stripe client")
+	}
+}
+
+// notification is one call recorded by recordingNotifier.
+type notification struct {
+	topic string
+	level slog.Level
+	n     *entity.Notification
+}
+
+// recordingNotifier reports every notification on a channel; processInvoice notifies
+// from its own goroutine after a final capture.
+type recordingNotifier struct {
+	sent chan notification
+}
+
+func (n *recordingNotifier) Notify(topic string, level slog.Level, event *entity.Notification) {
+	n.sent <- notification{topic: topic, level: level, n: event}
+}
+
+// TestNotifyBusinessEvents checks the notifications core emits: a capture goes to the
+// payment topic, a registered invoice to the order topic, and a failed capture to none.
+func TestNotifyBusinessEvents(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	held := func() *entity.CheckoutParams {
+		return &entity.CheckoutParams{
+			OrderId:       "ORD-1",
+			SessionId:     "cs_1",
+			PaymentId:     "pi_1",
+			Total:         10000,
+			Authorized:    10000,
+			Currency:      "pln",
+			ClientDetails: &entity.ClientDetails{Name: "Jan", Email: "jan@example.com"},
+		}
+	}
+
+	cases := []struct {
+		name       string
+		run        func(c *Core)
+		want       *notification
+		wantEvent  string
+		wantFields map[string]string
+	}{
+		{
+			name:       "capture",
+			run:        func(c *Core) { _, _, _ = c.StripeCaptureAmount(context.Background(), "cs_1", 0) },
+			want:       &notification{topic: entity.TopicPayment, level: slog.LevelInfo},
+			wantEvent:  entity.EventPaymentCaptured,
+			wantFields: map[string]string{"order_id": "ORD-1", "captured": "100.00", "authorized": "100.00 PLN"},
+		},
+		{
+			name:       "invoice",
+			run:        func(c *Core) { c.processInvoice(context.Background(), held()) },
+			want:       &notification{topic: entity.TopicOrder, level: slog.LevelInfo},
+			wantEvent:  entity.EventOrderInvoiced,
+			wantFields: map[string]string{"order_id": "ORD-1"},
+		},
+		{
+			name: "failed capture",
+			run:  func(c *Core) { _, _, _ = c.StripeCaptureAmount(context.Background(), "cs_missing", 0) },
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			sc, _ := stripeclient.New(&config.Config{}, log)
+			sc.SetAPI(&captureAPI{amount: 10000})
+			sc.SetDatabase(&heldParams{params: map[string]*entity.CheckoutParams{"ORD-1": held()}})
+			n := &recordingNotifier{sent: make(chan notification, 4)}
+			inv := &invoiceRecorder{registered: make(chan *entity.CheckoutParams, 1)}
+			c := &Core{sc: sc, inv: inv, log: log}
+			c.SetNotifier(n)
+
+			tc.run(c)
+
+			if tc.want == nil {
+				select {
+				case got := <-n.sent:
+					t.Errorf("unexpected notification %+v", got)
+				default:
+				}
+				return
+			}
+			select {
+			case got := <-n.sent:
+				if got.topic != tc.want.topic || got.level != tc.want.level {
+					t.Errorf("notification = %s/%s, want %s/%s", got.topic, got.level, tc.want.topic, tc.want.level)
+				}
+				if got.n.Event != tc.wantEvent {
+					t.Errorf("event = %q, want %q", got.n.Event, tc.wantEvent)
+				}
+				for k, v := range tc.wantFields {
+					if got.n.Fields[k] != v {
+						t.Errorf("field %s = %q, want %q", k, got.n.Fields[k], v)
+					}
+				}
+			case <-time.After(time.Second):
+				t.Fatal("no notification sent")
+			}
+		})
+	}
+}
+
+// eventAPI serves one paid checkout session and the Stripe invoice it created, both
+// for order ORD-1.
+type eventAPI struct {
+	stripeclient.API
+}
+
+func (a *eventAPI) GetCheckoutSession(id string, _ *stripe.CheckoutSessionParams) (*stripe.CheckoutSession, error) {
+	return &stripe.CheckoutSession{
+		ID:            id,
+		Status:        stripe.CheckoutSessionStatusComplete,
+		PaymentStatus: stripe.CheckoutSessionPaymentStatusPaid,
+		AmountTotal:   10000,
+		Currency:      "pln",
+		Metadata:      map[string]string{"order_id": "ORD-1"},
+		CustomerDetails: &stripe.CheckoutSessionCustomerDetails{
+			Name:    "Jan",
+			Email:   "jan@example.com",
+			Address: &stripe.Address{Country: "PL", City: "Warszawa", Line1: "Prosta 1"},
+		},
+		PaymentIntent: &stripe.PaymentIntent{ID: "pi_1"},
+	}, nil
+}
+
+func (a *eventAPI) GetInvoice(id string) (*stripe.Invoice, error) {
+	return &stripe.Invoice{
+		ID:       id,
+		Status:   stripe.InvoiceStatusPaid,
+		Paid:     true,
+		Total:    10000,
+		Currency: "pln",
+		Metadata: map[string]string{"order_id": "ORD-1"},
+		Customer: &stripe.Customer{Name: "Jan", Email: "jan@example.com"},
+	}, nil
+}
+
+// orderStore keeps one record per order like the checkout_params collection: a save
+// never clears an id the saved params do not carry.
+type orderStore struct {
+	stripeclient.Database
+	PaymentDatabase
+	mu     sync.Mutex
+	params map[string]*entity.CheckoutParams
+}
+
+func (s *orderStore) SaveCheckoutParams(params *entity.CheckoutParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored := *params
+	if prev, ok := s.params[params.OrderId]; ok && stored.InvoiceId == "" {
+		stored.InvoiceId = prev.InvoiceId
+	}
+	s.params[params.OrderId] = &stored
+	return nil
+}
+
+func (s *orderStore) GetCheckoutParamsForEvent(eventId string) (*entity.CheckoutParams, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, p := range s.params {
+		if p.EventId == eventId {
+			stored := *p
+			return &stored, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *orderStore) GetCheckoutParamsByOrder(orderId string) (*entity.CheckoutParams, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.params[orderId]
+	if !ok {
+		return nil, nil
+	}
+	stored := *p
+	return &stored, nil
+}
+
+// orderInvoicer registers invoices and, like the wFirma client, records the invoice id
+// on the order's stored params after taking delay to do so.
+type orderInvoicer struct {
+	InvoiceService
+	store      *orderStore
+	delay      time.Duration
+	registered atomic.Int32
+}
+
+func (o *orderInvoicer) RegisterInvoice(_ context.Context, params *entity.CheckoutParams) (*entity.Payment, error) {
+	o.registered.Add(1)
+	time.Sleep(o.delay)
+	params.InvoiceId = "inv-1"
+	_ = o.store.SaveCheckoutParams(params)
+	return &entity.Payment{Id: "inv-1", OrderId: params.OrderId}, nil
+}
+
+// TestStripeEventsInvoiceOnce replays the two Stripe events a paid checkout with invoice
+// creation produces, in either order, and checks the order is invoiced once and keeps
+// its checkout session id.
+func TestStripeEventsInvoiceOnce(t *testing.T) {
+	session := &stripe.Event{ID: "evt_session", Type: stripe.EventTypeCheckoutSessionCompleted,
+		Data: &stripe.EventData{Object: map[string]interface{}{"id": "cs_1"}}}
+	invoice := &stripe.Event{ID: "evt_invoice", Type: stripe.EventTypeInvoiceFinalized,
+		Data: &stripe.EventData{Object: map[string]interface{}{"id": "in_1"}}}
+
+	cases := []struct {
+		name   string
+		events []*stripe.Event
+	}{
+		{"session then invoice", []*stripe.Event{session, invoice}},
+		{"invoice then session", []*stripe.Event{invoice, session}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			log := slog.New(slog.NewTextHandler(io.Discard, nil))
+			store := &orderStore{params: map[string]*entity.CheckoutParams{}}
+			sc, _ := stripeclient.New(&config.Config{}, log)
+			sc.SetAPI(&eventAPI{})
+			sc.SetDatabase(store)
+			inv := &orderInvoicer{store: store}
+			c := &Core{sc: sc, inv: inv, db: store, log: log}
+
+			for _, evt := range tc.events {
+				c.StripeEvent(context.Background(), evt, nil)
+			}
+
+			if n := inv.registered.Load(); n != 1 {
+				t.Errorf("invoices registered = %d, want 1", n)
+			}
+			if tc.events[0] == session {
+				if got := store.params["ORD-1"].SessionId; got != "cs_1" {
+					t.Errorf("stored session id = %q, want cs_1", got)
+				}
+			}
+		})
+	}
+}
+
+// TestProcessInvoiceTaxRateError checks an order whose Stripe tax rate cannot be
+// invoiced is left for manual review instead of being registered.
+func TestProcessInvoiceTaxRateError(t *testing.T) {
+	store := &orderStore{params: map[string]*entity.CheckoutParams{}}
+	inv := &orderInvoicer{store: store}
+	c := &Core{inv: inv, db: store, log: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	params := &entity.CheckoutParams{OrderId: "ORD-1", Paid: true, TaxRateError: "stripe tax rate 8.875% on \"Wine\" is not a whole percentage"}
+
+	if payment := c.processInvoice(context.Background(), params); payment != nil {
+		t.Errorf("payment = %+v, want none", payment)
+	}
+	if n := inv.registered.Load(); n != 0 {
+		t.Errorf("invoices registered = %d, want 0", n)
+	}
+}
+
+// TestConcurrentStripeEventsInvoiceOnce delivers the events of one paid order at the
+// same time, as the webhook handler does, and checks the order is invoiced once.
+func TestConcurrentStripeEventsInvoiceOnce(t *testing.T) {
+	events := []*stripe.Event{
+		{ID: "evt_session", Type: stripe.EventTypeCheckoutSessionCompleted,
+			Data: &stripe.EventData{Object: map[string]interface{}{"id": "cs_1"}}},
+		{ID: "evt_invoice", Type: stripe.EventTypeInvoiceFinalized,
+			Data: &stripe.EventData{Object: map[string]interface{}{"id": "in_1"}}},
+		{ID: "evt_session_again", Type: stripe.EventTypeCheckoutSessionCompleted,
+			Data: &stripe.EventData{Object: map[string]interface{}{"id": "cs_1"}}},
+	}
+
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	store := &orderStore{params: map[string]*entity.CheckoutParams{}}
+	sc, _ := stripeclient.New(&config.Config{}, log)
+	sc.SetAPI(&eventAPI{})
+	sc.SetDatabase(store)
+	inv := &orderInvoicer{store: store, delay: 20 * time.Millisecond}
+	c := &Core{sc: sc, inv: inv, db: store, log: log}
+
+	var wg sync.WaitGroup
+	for _, evt := range events {
+		wg.Add(1)
+		go func(evt *stripe.Event) {
+			defer wg.Done()
+			c.StripeEvent(context.Background(), evt, nil)
+		}(evt)
+	}
+	wg.Wait()
+
+	if n := inv.registered.Load(); n != 1 {
+		t.Errorf("invoices registered = %d, want 1", n)
+	}
+}
+
+// eventLog is an EventStore that keeps the raw events it is given.
+type eventLog struct {
+	records []*entity.StripeEventRecord
+}
+
+func (l *eventLog) SaveStripeEvent(record *entity.StripeEventRecord) error {
+	l.records = append(l.records, record)
+	return nil
+}
+
+// auditAPI serves the eventAPI session and records how many raw events were stored by
+// the time the session is read, i.e. when HandleEvent starts deriving params.
+type auditAPI struct {
+	eventAPI
+	events       *eventLog
+	storedBefore int
+}
+
+func (a *auditAPI) GetCheckoutSession(id string, params *stripe.CheckoutSessionParams) (*stripe.CheckoutSession, error) {
+	a.storedBefore = len(a.events.records)
+	return a.eventAPI.GetCheckoutSession(id, params)
+}
+
+// TestStripeEventStoredRaw checks the webhook body is stored byte for byte, including
+// fields the stripe-go types do not know, before HandleEvent derives the order's params.
+func TestStripeEventStoredRaw(t *testing.T) {
+	raw := `{"id":"evt_session","type":"checkout.session.completed","created":1700000000,` +
+		`"context":"acct_1","data":{"object":{"id":"cs_1","object":"checkout.session","metadata":{"order_id":"ORD-1"}}}}`
+	var evt stripe.Event
+	if err := json.Unmarshal([]byte(raw), &evt); err != nil {
+		t.Fatalf("unmarshal event: %v", err)
+	}
+
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	events := &eventLog{}
+	api := &auditAPI{events: events}
+	store := &orderStore{params: map[string]*entity.CheckoutParams{}}
+	sc, _ := stripeclient.New(&config.Config{}, log)
+	sc.SetAPI(api)
+	sc.SetDatabase(store)
+	c := &Core{sc: sc, inv: &orderInvoicer{store: store}, db: store, log: log, eventRetention: time.Hour}
+	c.SetEventStore(events)
+
+	c.StripeEvent(context.Background(), &evt, []byte(raw))
+
+	if api.storedBefore != 1 {
+		t.Errorf("events stored before params were derived = %d, want 1", api.storedBefore)
+	}
+	if len(events.records) != 1 {
+		t.Fatalf("events stored = %d, want 1", len(events.records))
+	}
+	record := events.records[0]
+	if record.ID != "evt_session" || record.Type != "checkout.session.completed" || record.Created.Unix() != 1700000000 {
+		t.Errorf("record = %+v", record)
+	}
+	if record.Payload != raw {
+		t.Errorf("payload = %s, want the webhook body %s", record.Payload, raw)
+	}
+	if got := record.ExpiresAt.Sub(record.ReceivedAt); got != time.Hour {
+		t.Errorf("retention = %v, want 1h", got)
+	}
+	if store.params["ORD-1"] == nil {
+		t.Error("event was not processed after being stored")
+	}
+}
@@ -0,0 +1,119 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"wfsync/entity"
+)
+
+// memDrafts is an in-memory DraftStore.
+type memDrafts struct {
+	drafts map[string]*entity.CheckoutParams
+}
+
+func (m *memDrafts) SaveInvoiceDraft(params *entity.CheckoutParams) error {
+	stored := *params
+	m.drafts[params.OrderId] = &stored
+	return nil
+}
+
+func (m *memDrafts) GetInvoiceDraft(orderId string) (*entity.CheckoutParams, error) {
+	draft, ok := m.drafts[orderId]
+	if !ok {
+		return nil, nil
+	}
+	stored := *draft
+	return &stored, nil
+}
+
+func (m *memDrafts) DeleteInvoiceDraft(orderId string) error {
+	delete(m.drafts, orderId)
+	return nil
+}
+
+// draftInvoicer registers invoices for orders that have none in wFirma yet and records
+// the params it was given.
+type draftInvoicer struct {
+	InvoiceService
+	registered []*entity.CheckoutParams
+}
+
+func (d *draftInvoicer) FindInvoiceByExternalId(_ context.Context, _ string) (string, error) {
+	return "", nil
+}
+
+func (d *draftInvoicer) RegisterInvoice(_ context.Context, params *entity.CheckoutParams) (*entity.Payment, error) {
+	d.registered = append(d.registered, params)
+	return &entity.Payment{Id: "inv-1", OrderId: params.OrderId, Amount: params.Total}, nil
+}
+
+func (d *draftInvoicer) DownloadInvoice(_ context.Context, _ string) (string, *entity.FileMeta, error) {
+	return "inv-1.pdf", &entity.FileMeta{ContentType: "application/pdf"}, nil
+}
+
+// TestInvoiceDraftIssue walks the draft flow: a draft is stored without touching wFirma,
+// an edited draft replaces it, and issuing registers the edited line items once and
+// removes the draft.
+func TestInvoiceDraftIssue(t *testing.T) {
+	drafts := &memDrafts{drafts: map[string]*entity.CheckoutParams{}}
+	inv := &draftInvoicer{}
+	c := &Core{inv: inv, drafts: drafts, fileUrl: "https://files.example.com", log: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	ctx := context.Background()
+
+	params := &entity.CheckoutParams{
+		OrderId:       "100",
+		Currency:      "PLN",
+		Total:         10000,
+		ClientDetails: &entity.ClientDetails{Name: "Jan", Email: "jan@example.com"},
+		LineItems:     []*entity.LineItem{{Name: "Book", Qty: 2, Price: 5000}},
+	}
+	draft, err := c.WFirmaDraftInvoice(ctx, params)
+	if err != nil {
+		t.Fatalf("WFirmaDraftInvoice: %v", err)
+	}
+	if draft.Status != entity.InvoiceDraftStatus || len(inv.registered) != 0 {
+		t.Fatalf("draft status %q, registered %d: want a stored draft and nothing sent", draft.Status, len(inv.registered))
+	}
+
+	draft.LineItems = []*entity.LineItem{{Name: "Book", Qty: 1, Price: 5000}, {Name: "Pen", Qty: 1, Price: 4000}}
+	draft.Total = 9000
+	if _, err = c.WFirmaDraftInvoice(ctx, draft); err != nil {
+		t.Fatalf("edit draft: %v", err)
+	}
+
+	payment, err := c.WFirmaIssueInvoice(ctx, "100")
+	if err != nil {
+		t.Fatalf("WFirmaIssueInvoice: %v", err)
+	}
+	if payment.Id != "inv-1" || payment.Link != "https://files.example.com/inv-1.pdf" {
+		t.Errorf("payment = %+v, want inv-1 with its file link", payment)
+	}
+	if len(inv.registered) != 1 {
+		t.Fatalf("invoices registered = %d, want 1", len(inv.registered))
+	}
+	sent := inv.registered[0]
+	if sent.Total != 9000 || len(sent.LineItems) != 2 || sent.Status == entity.InvoiceDraftStatus {
+		t.Errorf("registered params = total %d, %d items, status %q; want the edited draft", sent.Total, len(sent.LineItems), sent.Status)
+	}
+	if _, ok := drafts.drafts["100"]; ok {
+		t.Error("draft kept after issue")
+	}
+}
+
+// TestIssueMissingDraft checks that issuing an order without a draft reports
+// ErrInvoiceDraftNotFound and sends nothing to wFirma.
+func TestIssueMissingDraft(t *testing.T) {
+	inv := &draftInvoicer{}
+	c := &Core{inv: inv, drafts: &memDrafts{drafts: map[string]*entity.CheckoutParams{}}, log: slog.New(slog.NewTextHandler(io.Discard, nil))}
+
+	_, err := c.WFirmaIssueInvoice(context.Background(), "404")
+	if !errors.Is(err, entity.ErrInvoiceDraftNotFound) {
+		t.Errorf("error = %v, want ErrInvoiceDraftNotFound", err)
+	}
+	if len(inv.registered) != 0 {
+		t.Errorf("invoices registered = %d, want none", len(inv.registered))
+	}
+}
@@ -0,0 +1,22 @@
+package core
+
+import (
+	"context"
+	"wfsync/entity"
+	"wfsync/lib/audit"
+)
+
+// FeatureEnabled reports whether a subsystem is switched on.
+func (c *Core) FeatureEnabled(name string) bool {
+	return c.features.Enabled(name)
+}
+
+// FeatureFlags returns the state of every subsystem.
+func (c *Core) FeatureFlags() []*entity.FeatureFlag {
+	return c.features.List()
+}
+
+// SetFeatureFlag switches a subsystem on or off on behalf of the API user in ctx.
+func (c *Core) SetFeatureFlag(ctx context.Context, name string, enabled bool) (*entity.FeatureFlag, error) {
+	return c.features.Set(name, enabled, audit.Actor(ctx))
+}
@@ -0,0 +1,104 @@
+package core
+
+import (
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+	"wfsync/entity"
+)
+
+// TestSignFileLinkKnownVector pins the link signature (HMAC-SHA256 over
+// "<file name>.<expiry>") so links issued before a restart keep verifying after it.
+func TestSignFileLinkKnownVector(t *testing.T) {
+	got := signFileLink("secret", "doc.pdf", 1700000000)
+	want := "3511c6be858c6c838a5a5180e077cf0e1ed6782b20aa81133634fd55e1f0db27"
+	if got != want {
+		t.Fatalf("signFileLink() = %s, want %s", got, want)
+	}
+}
+
+// TestVerifyFileLink covers the three outcomes a link holder can hit: a valid link, an
+// expired one, and one whose file, expiry or signature was altered.
+func TestVerifyFileLink(t *testing.T) {
+	const secret = "link-secret"
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	exp := now.Add(time.Hour).Unix()
+	expStr := strconv.FormatInt(exp, 10)
+	sig := signFileLink(secret, "doc.pdf", exp)
+
+	cases := []struct {
+		name    string
+		file    string
+		expires string
+		sig     string
+		now     time.Time
+		want    error
+	}{
+		{"valid", "doc.pdf", expStr, sig, now, nil},
+		{"expired", "doc.pdf", expStr, sig, now.Add(2 * time.Hour), entity.ErrFileLinkExpired},
+		{"other file", "other.pdf", expStr, sig, now, entity.ErrFileLinkInvalid},
+		{"extended expiry", "doc.pdf", strconv.FormatInt(exp+86400, 10), sig, now, entity.ErrFileLinkInvalid},
+		{"tampered signature", "doc.pdf", expStr, sig[:len(sig)-1] + "0", now, entity.ErrFileLinkInvalid},
+		{"missing signature", "doc.pdf", expStr, "", now, entity.ErrFileLinkInvalid},
+		{"malformed expiry", "doc.pdf", "tomorrow", sig, now, entity.ErrFileLinkInvalid},
+		{"wrong secret", "doc.pdf", expStr, signFileLink("other", "doc.pdf", exp), now, entity.ErrFileLinkInvalid},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := verifyFileLink(secret, tc.file, tc.expires, tc.sig, tc.now)
+			if !errors.Is(err, tc.want) {
+				t.Errorf("verifyFileLink() = %v, want %v", err, tc.want)
+			}
+		})
+	}
+}
+
+// TestSignedFileLinkRoundTrip issues a link the way document flows do and serves it back
+// through OpenSignedFile, which must also refuse names that escape the file directory.
+func TestSignedFileLinkRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "doc.pdf"), []byte("%PDF"), 0o644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	c := &Core{
+		filePath:    dir,
+		linkSecret:  "link-secret",
+		linkBaseURL: "https://api.example.com",
+		linkTTL:     time.Hour,
+	}
+
+	link, err := c.fileLink("doc.pdf")
+	if err != nil {
+		t.Fatalf("fileLink: %v", err)
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		t.Fatalf("parse link: %v", err)
+	}
+	if u.Path != "/files/doc.pdf" {
+		t.Fatalf("link path = %q, want /files/doc.pdf", u.Path)
+	}
+	q := u.Query()
+	f, err := c.OpenSignedFile("doc.pdf", q.Get("expires"), q.Get("sig"))
+	if err != nil {
+		t.Fatalf("OpenSignedFile: %v", err)
+	}
+	_ = f.Close()
+
+	if _, err = c.OpenSignedFile("../doc.pdf", q.Get("expires"), q.Get("sig")); !errors.Is(err, entity.ErrFileLinkInvalid) {
+		t.Errorf("traversal name error = %v, want %v", err, entity.ErrFileLinkInvalid)
+	}
+
+	// Without a secret, links stay plain and nothing can be served through /files.
+	plain := &Core{fileUrl: "https://files.example.com"}
+	if link, _ = plain.fileLink("doc.pdf"); link != "https://files.example.com/doc.pdf" {
+		t.Errorf("plain link = %q", link)
+	}
+	if _, err = plain.OpenSignedFile("doc.pdf", q.Get("expires"), q.Get("sig")); !errors.Is(err, entity.ErrFileLinkInvalid) {
+		t.Errorf("unsigned mode error = %v, want %v", err, entity.ErrFileLinkInvalid)
+	}
+}
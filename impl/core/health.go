@@ -0,0 +1,114 @@
+// Package core — health.go probes the subsystems for GET /health and /readyz.
+package core
+
+import (
+	"context"
+	"sync"
+	"time"
+	"wfsync/entity"
+	"wfsync/lib/clock"
+)
+
+const (
+	// healthCheckTimeout bounds each probe, so a hanging subsystem reports down instead
+	// of stalling the endpoint.
+	healthCheckTimeout = 5 * time.Second
+	// healthCacheTTL is how long probe results are served before the subsystems are
+	// probed again. The endpoints are public: without it every request would open a
+	// Mongo connection and spend Stripe and wFirma API quota.
+	healthCacheTTL = 30 * time.Second
+)
+
+// HealthCheck probes one subsystem. A subsystem named like a feature flag is reported
+// disabled, and not probed, while the flag is off.
+type HealthCheck struct {
+	Name     string
+	Required bool
+	Check    func(ctx context.Context) error
+}
+
+// healthState holds the registered probes and their last results.
+type healthState struct {
+	mu      sync.Mutex // held while probing, so concurrent requests share one round
+	checks  []HealthCheck
+	status  *entity.HealthStatus
+	checked time.Time
+	clock   clock.Clock   // clock.Real when nil
+	timeout time.Duration // healthCheckTimeout when 0
+}
+
+// AddHealthCheck registers a subsystem probe; required subsystems must be up for the
+// service to be healthy.
+func (c *Core) AddHealthCheck(name string, required bool, check func(ctx context.Context) error) {
+	c.health.mu.Lock()
+	defer c.health.mu.Unlock()
+	c.health.checks = append(c.health.checks, HealthCheck{Name: name, Required: required, Check: check})
+	c.health.status = nil
+}
+
+// Health returns the status of every registered subsystem, probed at most once per
+// healthCacheTTL. The probes run concurrently and are not canceled with ctx, as their
+// results are shared with other callers.
+func (c *Core) Health(ctx context.Context) *entity.HealthStatus {
+	h := &c.health
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	clk := h.clock
+	if clk == nil {
+		clk = clock.Real
+	}
+	if h.status != nil && clk.Now().Sub(h.checked) < healthCacheTTL {
+		return h.status
+	}
+	h.status = c.probe(context.WithoutCancel(ctx))
+	h.checked = clk.Now()
+	return h.status
+}
+
+// probe runs every registered probe and aggregates the results.
+func (c *Core) probe(ctx context.Context) *entity.HealthStatus {
+	timeout := c.health.timeout
+	if timeout == 0 {
+		timeout = healthCheckTimeout
+	}
+	results := make([]*entity.SubsystemHealth, len(c.health.checks))
+	var wg sync.WaitGroup
+	for i, hc := range c.health.checks {
+		result := &entity.SubsystemHealth{Name: hc.Name, Status: entity.HealthOk, Required: hc.Required}
+		results[i] = result
+		if !c.features.Enabled(hc.Name) {
+			result.Status = entity.HealthDisabled
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			checkCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			if err := hc.Check(checkCtx); err != nil {
+				result.Status = entity.HealthDown
+				result.Error = err.Error()
+			}
+		}()
+	}
+	wg.Wait()
+	return aggregateHealth(results)
+}
+
+// aggregateHealth sets the overall status: down when a required subsystem is down,
+// degraded when an optional one is, ok otherwise. Disabled subsystems do not count.
+func aggregateHealth(results []*entity.SubsystemHealth) *entity.HealthStatus {
+	status := &entity.HealthStatus{Status: entity.HealthOk, Subsystems: results}
+	for _, r := range results {
+		if r.Status != entity.HealthDown {
+			continue
+		}
+		if r.Required {
+			status.Status = entity.HealthDown
+			break
+		}
+		status.Status = entity.HealthDegraded
+	}
+	return status
+}
@@ -0,0 +1,133 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+	"wfsync/entity"
+	"wfsync/lib/clock"
+	"wfsync/lib/features"
+)
+
+type flagStore []*entity.FeatureFlag
+
+func (s flagStore) GetFeatureFlags() ([]*entity.FeatureFlag, error) { return s, nil }
+
+func (s flagStore) SaveFeatureFlag(*entity.FeatureFlag) error { return nil }
+
+func up(context.Context) error { return nil }
+
+func down(context.Context) error { return errors.New("connection refused") }
+
+// TestHealthAggregation registers required and optional subsystems in different states
+// and checks the overall status: a required subsystem down makes the service down, an
+// optional one only degrades it, and either makes it not ready.
+func TestHealthAggregation(t *testing.T) {
+	cases := []struct {
+		name        string
+		mongo       func(context.Context) error
+		wfirma      func(context.Context) error
+		wantStatus  string
+		wantHealthy bool
+		wantReady   bool
+	}{
+		{"all up", up, up, entity.HealthOk, true, true},
+		{"optional down", up, down, entity.HealthDegraded, true, false},
+		{"required down", down, up, entity.HealthDown, false, false},
+		{"both down", down, down, entity.HealthDown, false, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &Core{}
+			c.AddHealthCheck("mongo", true, tc.mongo)
+			c.AddHealthCheck(entity.FeatureWFirma, false, tc.wfirma)
+
+			status := c.Health(context.Background())
+			if status.Status != tc.wantStatus || status.Healthy() != tc.wantHealthy {
+				t.Errorf("status = %s, healthy %v; want %s, %v", status.Status, status.Healthy(), tc.wantStatus, tc.wantHealthy)
+			}
+			if status.Ready() != tc.wantReady {
+				t.Errorf("ready = %v, want %v", status.Ready(), tc.wantReady)
+			}
+			if len(status.Subsystems) != 2 || status.Subsystems[0].Name != "mongo" || status.Subsystems[1].Name != entity.FeatureWFirma {
+				t.Fatalf("subsystems = %+v, want mongo and wfirma in order", status.Subsystems)
+			}
+			for _, s := range status.Subsystems {
+				if (s.Status == entity.HealthDown) != (s.Error != "") {
+					t.Errorf("%s: status %s with error %q", s.Name, s.Status, s.Error)
+				}
+			}
+		})
+	}
+}
+
+// TestHealthDisabledSubsystem checks that a subsystem switched off with its feature flag
+// is reported disabled without being probed, and does not make the service down.
+func TestHealthDisabledSubsystem(t *testing.T) {
+	c := &Core{}
+	c.SetFeatures(features.New(flagStore{{Name: entity.FeatureOpenCart}}, slog.New(slog.NewTextHandler(io.Discard, nil))))
+	probed := false
+	c.AddHealthCheck(entity.FeatureOpenCart, true, func(context.Context) error {
+		probed = true
+		return errors.New("unreachable")
+	})
+
+	status := c.Health(context.Background())
+	if probed {
+		t.Error("disabled subsystem was probed")
+	}
+	if status.Status != entity.HealthOk || status.Subsystems[0].Status != entity.HealthDisabled {
+		t.Errorf("status = %s, opencart %s; want ok, disabled", status.Status, status.Subsystems[0].Status)
+	}
+}
+
+// TestHealthCheckTimeout checks that a probe is given a deadline, so a subsystem that
+// does not answer is reported down.
+func TestHealthCheckTimeout(t *testing.T) {
+	c := &Core{}
+	c.health.timeout = 10 * time.Millisecond
+	c.AddHealthCheck("mongo", true, func(ctx context.Context) error {
+		if _, ok := ctx.Deadline(); !ok {
+			return nil
+		}
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	status := c.Health(context.Background())
+	if status.Status != entity.HealthDown || status.Subsystems[0].Error == "" {
+		t.Errorf("status = %s, subsystem %+v; want down with the deadline error", status.Status, status.Subsystems[0])
+	}
+}
+
+// TestHealthCached checks that repeated requests within the cache TTL are served from
+// the last probe round, and that a canceled request does not fail the shared round.
+func TestHealthCached(t *testing.T) {
+	clk := clock.NewMock(time.Date(2025, 5, 1, 9, 0, 0, 0, time.UTC))
+	c := &Core{}
+	c.health.clock = clk
+	probes := 0
+	c.AddHealthCheck("mongo", true, func(ctx context.Context) error {
+		probes++
+		return ctx.Err()
+	})
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if status := c.Health(canceled); status.Status != entity.HealthOk {
+		t.Errorf("status = %s, want ok despite the canceled request", status.Status)
+	}
+	clk.Advance(healthCacheTTL - time.Second)
+	c.Health(context.Background())
+	if probes != 1 {
+		t.Errorf("probes = %d within the TTL, want 1", probes)
+	}
+	clk.Advance(time.Second)
+	c.Health(context.Background())
+	if probes != 2 {
+		t.Errorf("probes = %d after the TTL, want 2", probes)
+	}
+}
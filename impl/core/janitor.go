@@ -0,0 +1,154 @@
+// Package core — janitor.go removes orphaned document PDFs from the file directory.
+// DownloadInvoice writes a new UUID-named file for every download, and flows that fail
+// after the download (or replace a document) leave files nobody points to. The janitor
+// deletes PDFs that no reference source knows about once they are older than a grace
+// period, which covers documents still being registered when the sweep runs.
+//
+// Deleting is irreversible, so a sweep is skipped entirely when any reference source
+// fails: a partial reference set would make referenced files look orphaned. Files from
+// before trackedSince, when document files started being recorded, are never deleted:
+// nothing records the older split-part and B2B PDFs.
+package core
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"wfsync/lib/clock"
+	"wfsync/lib/sl"
+)
+
+// FileReferences reports the document file names a store still points to.
+type FileReferences interface {
+	ReferencedFiles() (map[string]bool, error)
+}
+
+// FileJanitor periodically deletes unreferenced PDFs. Follows the same Start/Stop
+// pattern as RetryQueue.
+type FileJanitor struct {
+	sources  []FileReferences
+	log      *slog.Logger
+	dir      string
+	interval time.Duration
+	grace    time.Duration
+	since    time.Time
+	clock    clock.Clock
+	done     chan struct{}
+	stopped  chan struct{}
+}
+
+// NewFileJanitor creates a janitor for dir that only deletes files modified after
+// trackedSince. Call Start() to begin background processing.
+func NewFileJanitor(log *slog.Logger, dir string, intervalMin, graceHours int, trackedSince time.Time) *FileJanitor {
+	if intervalMin <= 0 {
+		intervalMin = 1440
+	}
+	if graceHours <= 0 {
+		graceHours = 168
+	}
+	return &FileJanitor{
+		log:      log.With(sl.Module("janitor")),
+		dir:      dir,
+		interval: time.Duration(intervalMin) * time.Minute,
+		grace:    time.Duration(graceHours) * time.Hour,
+		since:    trackedSince,
+		clock:    clock.Real,
+	}
+}
+
+// AddReferences registers a store whose file references must be kept.
+func (j *FileJanitor) AddReferences(src FileReferences) {
+	j.sources = append(j.sources, src)
+}
+
+// Start launches the background polling goroutine.
+func (j *FileJanitor) Start() {
+	j.done = make(chan struct{})
+	j.stopped = make(chan struct{})
+	go func() {
+		defer close(j.stopped)
+
+		j.sweep()
+
+		ticker := time.NewTicker(j.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-j.done:
+				j.log.Debug("file janitor stopped")
+				return
+			case <-ticker.C:
+				j.sweep()
+			}
+		}
+	}()
+}
+
+// Stop signals the background goroutine to exit and waits for it to finish.
+func (j *FileJanitor) Stop() {
+	if j.done != nil {
+		j.log.Debug("stopping file janitor")
+		close(j.done)
+		<-j.stopped
+	}
+}
+
+// references merges the file names of all sources. Any failure aborts the merge.
+func (j *FileJanitor) references() (map[string]bool, error) {
+	if len(j.sources) == 0 {
+		return nil, fmt.Errorf("no reference sources")
+	}
+	refs := make(map[string]bool)
+	for _, src := range j.sources {
+		files, err := src.ReferencedFiles()
+		if err != nil {
+			return nil, err
+		}
+		for name := range files {
+			refs[filepath.Base(name)] = true
+		}
+	}
+	return refs, nil
+}
+
+// sweep deletes PDFs in dir that are unreferenced, older than the grace period and newer
+// than trackedSince.
+// Only top-level .pdf files are considered; anything else in the directory is not ours.
+func (j *FileJanitor) sweep() {
+	refs, err := j.references()
+	if err != nil {
+		j.log.Warn("file references unavailable, skipping cleanup", sl.Err(err))
+		return
+	}
+	entries, err := os.ReadDir(j.dir)
+	if err != nil {
+		j.log.Error("read file directory", slog.String("dir", j.dir), sl.Err(err))
+		return
+	}
+
+	cutoff := j.clock.Now().Add(-j.grace)
+	removed := 0
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.Type().IsRegular() || !strings.EqualFold(filepath.Ext(name), ".pdf") || refs[name] {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || !info.ModTime().Before(cutoff) || info.ModTime().Before(j.since) {
+			continue
+		}
+		if err = os.Remove(filepath.Join(j.dir, name)); err != nil && !os.IsNotExist(err) {
+			j.log.Warn("remove orphaned file", slog.String("file", name), sl.Err(err))
+			continue
+		}
+		removed++
+	}
+	if removed > 0 {
+		j.log.Info("orphaned files removed",
+			slog.Int("count", removed),
+			slog.Int("referenced", len(refs)))
+	}
+}
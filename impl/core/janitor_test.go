@@ -0,0 +1,103 @@
+package core
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"wfsync/lib/clock"
+)
+
+// staticReferences is a FileReferences backed by a fixed set or a fixed error.
+type staticReferences struct {
+	files map[string]bool
+	err   error
+}
+
+func (s staticReferences) ReferencedFiles() (map[string]bool, error) {
+	return s.files, s.err
+}
+
+// TestFileJanitorSweep checks that only old, unreferenced PDFs are removed: referenced
+// files from any source, files within the grace period, files from before tracking
+// started and non-PDF files are kept.
+func TestFileJanitorSweep(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	old := now.Add(-10 * 24 * time.Hour)
+	recent := now.Add(-time.Hour)
+	tracked := now.Add(-30 * 24 * time.Hour)
+	legacy := tracked.Add(-time.Hour)
+
+	dir := t.TempDir()
+	files := map[string]time.Time{
+		"referenced-mongo.pdf": old,
+		"referenced-oc.pdf":    old,
+		"orphan.pdf":           old,
+		"orphan-recent.pdf":    recent,
+		"legacy-part.pdf":      legacy,
+		"notes.txt":            old,
+	}
+	for name, mtime := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("x"), 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatalf("chtimes %s: %v", name, err)
+		}
+	}
+
+	j := NewFileJanitor(slog.New(slog.NewTextHandler(io.Discard, nil)), dir, 60, 24, tracked)
+	j.clock = clock.NewMock(now)
+	j.AddReferences(staticReferences{files: map[string]bool{"referenced-mongo.pdf": true}})
+	j.AddReferences(staticReferences{files: map[string]bool{"referenced-oc.pdf": true}})
+	j.sweep()
+
+	want := map[string]bool{
+		"referenced-mongo.pdf": true,
+		"referenced-oc.pdf":    true,
+		"orphan.pdf":           false,
+		"orphan-recent.pdf":    true,
+		"legacy-part.pdf":      true,
+		"notes.txt":            true,
+	}
+	for name, kept := range want {
+		_, err := os.Stat(filepath.Join(dir, name))
+		if got := err == nil; got != kept {
+			t.Errorf("%s kept = %v, want %v", name, got, kept)
+		}
+	}
+}
+
+// TestFileJanitorSkipsOnSourceError checks that a failing reference source aborts the
+// sweep instead of treating every file as orphaned.
+func TestFileJanitorSkipsOnSourceError(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "doc.pdf")
+	if err := os.WriteFile(path, []byte("x"), 0o644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	old := time.Now().Add(-30 * 24 * time.Hour)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+
+	j := NewFileJanitor(slog.New(slog.NewTextHandler(io.Discard, nil)), dir, 60, 24, time.Time{})
+	j.AddReferences(staticReferences{files: map[string]bool{}})
+	j.AddReferences(staticReferences{err: errors.New("mysql: connection refused")})
+	j.sweep()
+
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("file removed despite a failing reference source: %v", err)
+	}
+
+	// No sources at all is equally unsafe.
+	bare := NewFileJanitor(slog.New(slog.NewTextHandler(io.Discard, nil)), dir, 60, 24, time.Time{})
+	bare.sweep()
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("file removed without any reference source: %v", err)
+	}
+}
@@ -0,0 +1,45 @@
+// Package core — order-lock.go serializes invoice registration per order.
+package core
+
+import "sync"
+
+// orderLocks serializes work on one order within this instance. Stripe reports a paid
+// order through several events whose webhooks are handled concurrently; without it two
+// of them could both find no stored invoice id and invoice the order twice.
+type orderLocks struct {
+	mu    sync.Mutex
+	locks map[string]*orderLock
+}
+
+// orderLock is one order's mutex and the number of goroutines holding or awaiting it,
+// so the entry is dropped once nobody needs it.
+type orderLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// lock blocks until the order is free and returns the function that releases it.
+func (l *orderLocks) lock(orderId string) (unlock func()) {
+	l.mu.Lock()
+	if l.locks == nil {
+		l.locks = make(map[string]*orderLock)
+	}
+	ol, ok := l.locks[orderId]
+	if !ok {
+		ol = &orderLock{}
+		l.locks[orderId] = ol
+	}
+	ol.refs++
+	l.mu.Unlock()
+
+	ol.mu.Lock()
+	return func() {
+		ol.mu.Unlock()
+		l.mu.Lock()
+		ol.refs--
+		if ol.refs == 0 {
+			delete(l.locks, orderId)
+		}
+		l.mu.Unlock()
+	}
+}
@@ -0,0 +1,88 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"wfsync/entity"
+)
+
+// fakeDownloader implements only DownloadInvoice; any other InvoiceService call panics,
+// which keeps the test honest about what the re-download path touches.
+type fakeDownloader struct {
+	InvoiceService
+	dir   string
+	name  string
+	err   error
+	calls []string
+}
+
+func (f *fakeDownloader) DownloadInvoice(_ context.Context, invoiceID string) (string, *entity.FileMeta, error) {
+	f.calls = append(f.calls, invoiceID)
+	if f.err != nil {
+		return "", nil, f.err
+	}
+	if err := os.WriteFile(filepath.Join(f.dir, f.name), []byte("%PDF-1.4 fresh"), 0o644); err != nil {
+		return "", nil, err
+	}
+	return f.name, &entity.FileMeta{ContentType: "application/pdf"}, nil
+}
+
+// TestRedownloadInvoiceFile checks that a stored file name does not short-circuit the
+// download, that the previous file is replaced, and that a failed download keeps it.
+func TestRedownloadInvoiceFile(t *testing.T) {
+	cases := []struct {
+		name        string
+		oldExists   bool
+		downloadErr error
+		wantErr     bool
+		wantOldKept bool
+	}{
+		{name: "corrupted file is replaced", oldExists: true},
+		{name: "missing file is restored", oldExists: false},
+		{name: "failed download keeps the old file", oldExists: true, downloadErr: errors.New("wfirma status: 500"), wantErr: true, wantOldKept: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			const oldFile = "old.pdf"
+			if tc.oldExists {
+				if err := os.WriteFile(filepath.Join(dir, oldFile), []byte("garbage"), 0o644); err != nil {
+					t.Fatalf("write old file: %v", err)
+				}
+			}
+			inv := &fakeDownloader{dir: dir, name: "new.pdf", err: tc.downloadErr}
+			c := &Core{
+				inv:      inv,
+				filePath: dir,
+				fileUrl:  "https://files.example.com",
+				log:      slog.New(slog.NewTextHandler(io.Discard, nil)),
+			}
+
+			fileName, link, err := c.redownloadInvoiceFile(context.Background(), "123", oldFile)
+			if len(inv.calls) != 1 || inv.calls[0] != "123" {
+				t.Fatalf("DownloadInvoice calls = %v, want [123]", inv.calls)
+			}
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("redownloadInvoiceFile: %v", err)
+				}
+				if fileName != "new.pdf" || link != "https://files.example.com/new.pdf" {
+					t.Errorf("got (%q, %q), want new.pdf and its link", fileName, link)
+				}
+			}
+			_, statErr := os.Stat(filepath.Join(dir, oldFile))
+			if kept := statErr == nil; kept != tc.wantOldKept {
+				t.Errorf("old file kept = %v, want %v", kept, tc.wantOldKept)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+// Package core — refund.go issues the corrective invoice (faktura korygująca) Polish law
+// requires when an invoiced order is refunded; a Stripe refund alone leaves the books
+// showing the original sale.
+package core
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"wfsync/entity"
+	"wfsync/lib/audit"
+	"wfsync/lib/metrics"
+	"wfsync/lib/money"
+	"wfsync/lib/sl"
+)
+
+// processRefund corrects the order's invoice after a Stripe refund. params carries the
+// total refunded so far; the correction restates the order at its remaining value and
+// references the latest document of the order, so successive partial refunds chain
+// corrections instead of each correcting the original. Orders without an invoice need no
+// correction. The refund is recorded on the order only once it is settled: a failed
+// correction goes to the retry queue, and a redelivered event is not taken as already
+// handled. Returns the correction, or nil when none was issued.
+func (c *Core) processRefund(ctx context.Context, params *entity.CheckoutParams) *entity.Payment {
+	payment, err := c.correctRefund(ctx, params)
+	if err != nil {
+		metrics.Failures.Inc()
+		if c.retryQueue != nil {
+			c.retryQueue.EnqueueRefund(params, err.Error())
+		}
+		return nil
+	}
+	return payment
+}
+
+// RetryRefund re-runs a refund correction from the retry queue. refunded is the
+// cumulative amount of the refund event; a refund recorded since, by this event or a
+// later one, leaves nothing to do.
+func (c *Core) RetryRefund(ctx context.Context, orderId, eventId string, refunded int64) error {
+	if c.db == nil {
+		return fmt.Errorf("database not connected")
+	}
+	params, err := c.db.GetCheckoutParamsByOrder(orderId)
+	if err != nil {
+		return fmt.Errorf("get checkout params: %w", err)
+	}
+	if params == nil {
+		return fmt.Errorf("checkout params not found")
+	}
+	if refunded <= params.Refunded {
+		return nil
+	}
+	params.Refunded = refunded
+	params.Status = "refunded"
+	params.EventId = eventId
+	_, err = c.correctRefund(ctx, params)
+	return err
+}
+
+// correctRefund issues the corrective invoice for params and then records the refund on
+// the order. Nothing is recorded when the correction fails.
+func (c *Core) correctRefund(ctx context.Context, params *entity.CheckoutParams) (*entity.Payment, error) {
+	log := c.log.With(
+		slog.String("order_id", params.OrderId),
+		slog.String("event_id", params.EventId),
+		slog.Int64("refunded", params.Refunded),
+	)
+	if params.InvoiceId == "" {
+		log.Info("refunded order has no invoice, no correction needed")
+		c.saveRefund(log, params, "")
+		return nil, nil
+	}
+	if c.inv == nil {
+		return nil, fmt.Errorf("invoice service not connected")
+	}
+	parent := params.InvoiceId
+	if params.CorrectionId != "" {
+		parent = params.CorrectionId
+	}
+
+	payment, err := c.inv.CreateCorrectiveInvoice(ctx, parent, correctedParams(params))
+	if err != nil {
+		log.With(
+			sl.Err(err),
+			slog.String("invoice_id", parent),
+			slog.String("tg_topic", entity.TopicError),
+		).Error("create corrective invoice")
+		return nil, err
+	}
+
+	c.saveRefund(log, params, payment.Id)
+	c.auditLog.Record(audit.Actor(ctx), entity.AuditInvoiceCorrect, audit.OrderTarget(params.OrderId),
+		map[string]interface{}{"document_id": parent}, documentState(params, payment))
+
+	number := payment.Number
+	if number == "" {
+		number = payment.Id
+	}
+	c.notify(entity.TopicOrder, slog.LevelInfo, entity.EventOrderRefunded, map[string]string{
+		"order_id":   params.OrderId,
+		"refunded":   money.New(params.Refunded, params.Currency).String(),
+		"correction": number,
+	})
+	return payment, nil
+}
+
+func (c *Core) saveRefund(log *slog.Logger, params *entity.CheckoutParams, correctionId string) {
+	if c.db == nil {
+		return
+	}
+	if err := c.db.SaveRefund(params.OrderId, params.EventId, params.Refunded, correctionId); err != nil {
+		log.With(sl.Err(err)).Error("save refund")
+	}
+}
+
+// correctedParams returns the order as it stands after the refund: a full refund leaves
+// no lines, a partial one scales the goods down to the remaining total.
+func correctedParams(params *entity.CheckoutParams) *entity.CheckoutParams {
+	corrected := *params
+	corrected.Total = params.Total - params.Refunded
+	corrected.LineItems = nil
+	if corrected.Total <= 0 {
+		corrected.Total = 0
+		return &corrected
+	}
+	for _, line := range params.LineItems {
+		item := *line
+		corrected.LineItems = append(corrected.LineItems, &item)
+	}
+	corrected.RecalcWithDiscount()
+	return &corrected
+}
@@ -0,0 +1,179 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"wfsync/entity"
+)
+
+// TestCorrectedParams restates a refunded order: a full refund leaves no lines, a partial
+// one scales the goods to the remaining total and keeps shipping, without touching the
+// stored order's lines.
+func TestCorrectedParams(t *testing.T) {
+	cases := []struct {
+		name      string
+		refunded  int64
+		wantLines int
+		wantTotal int64
+	}{
+		{"full", 12000, 0, 0},
+		{"more than paid", 15000, 0, 0},
+		{"partial", 5000, 2, 7000},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			params := &entity.CheckoutParams{
+				OrderId:  "ORD-1",
+				Currency: "PLN",
+				Total:    12000,
+				Shipping: 2000,
+				Refunded: tc.refunded,
+				LineItems: []*entity.LineItem{
+					{Name: "Book", Qty: 2, Price: 5000},
+					{Name: "Shipping", Qty: 1, Price: 2000, Shipping: true},
+				},
+			}
+			corrected := correctedParams(params)
+			if corrected.Total != tc.wantTotal || len(corrected.LineItems) != tc.wantLines {
+				t.Fatalf("corrected = total %d, %d lines; want %d, %d", corrected.Total, len(corrected.LineItems), tc.wantTotal, tc.wantLines)
+			}
+			if tc.wantLines > 0 {
+				if got := corrected.ItemsTotal(); got != tc.wantTotal {
+					t.Errorf("items total = %d, want %d", got, tc.wantTotal)
+				}
+				if corrected.LineItems[1].Price != 2000 {
+					t.Errorf("shipping = %d, want it unchanged", corrected.LineItems[1].Price)
+				}
+			}
+			if params.LineItems[0].Price != 5000 || params.Total != 12000 {
+				t.Errorf("stored order changed: %+v", params.LineItems[0])
+			}
+		})
+	}
+}
+
+// refundStore keeps one order's checkout params and records the refunds saved on it.
+type refundStore struct {
+	PaymentDatabase
+	params *entity.CheckoutParams
+}
+
+func (s *refundStore) GetCheckoutParamsByOrder(orderId string) (*entity.CheckoutParams, error) {
+	stored := *s.params
+	return &stored, nil
+}
+
+func (s *refundStore) SaveRefund(orderId, eventId string, refunded int64, correctionId string) error {
+	s.params.Refunded, s.params.Status, s.params.EventId = refunded, "refunded", eventId
+	if correctionId != "" {
+		s.params.CorrectionId = correctionId
+	}
+	return nil
+}
+
+// retryStore is an in-memory RetryDatabase.
+type retryStore struct {
+	RetryDatabase
+	jobs map[string]*entity.RetryJob
+}
+
+func (s *retryStore) SaveRetryJob(job *entity.RetryJob) error {
+	s.jobs[job.ID] = job
+	return nil
+}
+
+func (s *retryStore) GetRetryJobByEventId(eventId string) (*entity.RetryJob, error) {
+	return s.jobs[eventId], nil
+}
+
+func (s *retryStore) UpdateRetryJob(job *entity.RetryJob) error {
+	s.jobs[job.ID] = job
+	return nil
+}
+
+// corrector issues corrective invoices while wFirma is up.
+type corrector struct {
+	InvoiceService
+	down   bool
+	issued int
+}
+
+func (c *corrector) CreateCorrectiveInvoice(_ context.Context, _ string, _ *entity.CheckoutParams) (*entity.Payment, error) {
+	if c.down {
+		return nil, errors.New("wfirma unavailable")
+	}
+	c.issued++
+	return &entity.Payment{Id: "fk-1", Number: "FK 1/2025"}, nil
+}
+
+// TestRefundCorrectionRetried fails the corrective invoice of a refund: the refund is not
+// recorded on the order but queued, and the retry issues the correction and records it
+// once.
+func TestRefundCorrectionRetried(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	store := &refundStore{params: &entity.CheckoutParams{
+		OrderId: "ORD-1", InvoiceId: "inv-1", Currency: "PLN", Total: 12000, Status: "paid",
+	}}
+	inv := &corrector{down: true}
+	retries := &retryStore{jobs: map[string]*entity.RetryJob{}}
+	rq := NewRetryQueue(log, 0, 0, 0, 0)
+	rq.SetDatabase(retries)
+	c := &Core{inv: inv, db: store, retryQueue: rq, log: log}
+	rq.SetRefunder(c)
+
+	refund, _ := store.GetCheckoutParamsByOrder("ORD-1")
+	refund.Refunded, refund.Status, refund.EventId = 5000, "refunded", "evt_refund"
+	if payment := c.processRefund(context.Background(), refund); payment != nil {
+		t.Fatalf("correction = %+v while wFirma is down", payment)
+	}
+	if store.params.Refunded != 0 || store.params.Status != "paid" {
+		t.Fatalf("refund recorded before its correction: %+v", store.params)
+	}
+	job := retries.jobs["evt_refund"]
+	if job == nil || job.Kind != entity.RetryJobRefund || job.Refunded != 5000 || job.OrderId != "ORD-1" {
+		t.Fatalf("retry job = %+v, want a refund job for 5000", job)
+	}
+
+	inv.down = false
+	rq.processOneJob(job)
+	if job.Status != entity.RetryJobCompleted {
+		t.Fatalf("job status = %s, want completed (last error %q)", job.Status, job.LastError)
+	}
+	if store.params.Refunded != 5000 || store.params.CorrectionId != "fk-1" || store.params.Status != "refunded" {
+		t.Errorf("stored params = %+v, want the refund and its correction", store.params)
+	}
+
+	job.Status = entity.RetryJobPending
+	rq.processOneJob(job)
+	if inv.issued != 1 {
+		t.Errorf("corrections issued = %d, want 1", inv.issued)
+	}
+}
+
+// TestRefundWithoutInvoiceService refunds an invoiced order with no invoice service
+// connected: the correction fails, so the refund is queued rather than recorded.
+func TestRefundWithoutInvoiceService(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	store := &refundStore{params: &entity.CheckoutParams{
+		OrderId: "ORD-1", InvoiceId: "inv-1", Currency: "PLN", Total: 12000, Status: "paid",
+	}}
+	retries := &retryStore{jobs: map[string]*entity.RetryJob{}}
+	rq := NewRetryQueue(log, 0, 0, 0, 0)
+	rq.SetDatabase(retries)
+	c := &Core{db: store, retryQueue: rq, log: log}
+
+	refund, _ := store.GetCheckoutParamsByOrder("ORD-1")
+	refund.Refunded, refund.Status, refund.EventId = 5000, "refunded", "evt_refund"
+	if payment := c.processRefund(context.Background(), refund); payment != nil {
+		t.Fatalf("correction = %+v without an invoice service", payment)
+	}
+	if store.params.Refunded != 0 {
+		t.Errorf("refund recorded without its correction: %+v", store.params)
+	}
+	if job := retries.jobs["evt_refund"]; job == nil || job.LastError != "invoice service not connected" {
+		t.Errorf("retry job = %+v, want one failed on the missing invoice service", job)
+	}
+}
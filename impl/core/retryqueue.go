@@ -1,6 +1,7 @@
 // Package core — retryqueue.go implements a persistent retry queue for failed wFirma invoice
-// registrations. When the wFirma API is down during a Stripe webhook, the failed job is saved
-// to MongoDB and retried with exponential backoff until it succeeds or exhausts max attempts.
+// registrations and refund corrections. When the wFirma API is down during a Stripe webhook,
+// the failed job is saved to MongoDB and retried with exponential backoff until it succeeds
+// or exhausts max attempts.
 package core
 
 import (
@@ -22,11 +23,24 @@ type RetryDatabase interface {
 	GetCheckoutParamsForEvent(eventId string) (*entity.CheckoutParams, error)
 }
 
+// Registrar creates the invoice of a retried job, recording it like any other path;
+// Core implements it.
+type Registrar interface {
+	RegisterInvoice(ctx context.Context, params *entity.CheckoutParams) (*entity.Payment, error)
+}
+
+// Refunder re-runs a refund correction that failed; Core implements it.
+type Refunder interface {
+	RetryRefund(ctx context.Context, orderId, eventId string, refunded int64) error
+}
+
 // RetryQueue polls for pending retry jobs and attempts to re-register invoices
 // with exponential backoff. Follows the same Start/Stop pattern as vatrates.Service.
 type RetryQueue struct {
 	db          RetryDatabase
 	inv         InvoiceService
+	registrar   Registrar
+	refunder    Refunder
 	oc          *occlient.Opencart
 	log         *slog.Logger
 	interval    time.Duration
@@ -62,50 +76,63 @@ func NewRetryQueue(log *slog.Logger, intervalMin, maxRetries, baseDelaySec, maxO
 func (rq *RetryQueue) SetDatabase(db RetryDatabase)         { rq.db = db }
 func (rq *RetryQueue) SetInvoiceService(inv InvoiceService) { rq.inv = inv }
 func (rq *RetryQueue) SetOpencart(oc *occlient.Opencart)    { rq.oc = oc }
+func (rq *RetryQueue) SetRegistrar(r Registrar)             { rq.registrar = r }
+func (rq *RetryQueue) SetRefunder(r Refunder)               { rq.refunder = r }
 
 // Enqueue creates a pending retry job for a failed invoice registration.
 // Idempotent by EventId — if a job for this event already exists, it's a no-op.
 func (rq *RetryQueue) Enqueue(params *entity.CheckoutParams, errMsg string) {
+	rq.enqueue(&entity.RetryJob{OrderId: params.OrderId}, params.EventId, errMsg)
+}
+
+// EnqueueRefund creates a pending retry job for a refund whose corrective invoice failed;
+// params carries the refund event and the cumulative refunded amount.
+func (rq *RetryQueue) EnqueueRefund(params *entity.CheckoutParams, errMsg string) {
+	rq.enqueue(&entity.RetryJob{
+		OrderId:  params.OrderId,
+		Kind:     entity.RetryJobRefund,
+		Refunded: params.Refunded,
+	}, params.EventId, errMsg)
+}
+
+func (rq *RetryQueue) enqueue(job *entity.RetryJob, eventId, errMsg string) {
 	// No mutex needed: SaveRetryJob is an upsert by _id (= EventId), so
 	// concurrent enqueues for the same event collapse to a single document.
 	if rq.db == nil {
 		rq.log.Warn("no database configured, cannot enqueue retry job",
-			slog.String("event_id", params.EventId))
+			slog.String("event_id", eventId))
 		return
 	}
 
-	existing, _ := rq.db.GetRetryJobByEventId(params.EventId)
+	existing, _ := rq.db.GetRetryJobByEventId(eventId)
 	if existing != nil {
 		rq.log.Debug("retry job already exists",
-			slog.String("event_id", params.EventId))
+			slog.String("event_id", eventId))
 		return
 	}
 
 	now := time.Now()
-	job := &entity.RetryJob{
-		ID:          params.EventId,
-		EventId:     params.EventId,
-		OrderId:     params.OrderId,
-		Status:      entity.RetryJobPending,
-		Attempts:    0,
-		MaxAttempts: rq.maxRetries,
-		LastError:   errMsg,
-		NextRetryAt: now.Add(rq.baseDelay),
-		CreatedAt:   now,
-		UpdatedAt:   now,
-	}
+	job.ID = eventId
+	job.EventId = eventId
+	job.Status = entity.RetryJobPending
+	job.MaxAttempts = rq.maxRetries
+	job.LastError = errMsg
+	job.NextRetryAt = now.Add(rq.baseDelay)
+	job.CreatedAt = now
+	job.UpdatedAt = now
 
 	if err := rq.db.SaveRetryJob(job); err != nil {
 		rq.log.Error("save retry job", sl.Err(err),
-			slog.String("event_id", params.EventId))
+			slog.String("event_id", eventId))
 		return
 	}
 
 	// The underlying error has already been reported to Telegram by the wfirma layer;
 	// keep this as a local-only log so it doesn't render as a fresh retry-queue error.
 	rq.log.Info("retry job enqueued",
-		slog.String("event_id", params.EventId),
-		slog.String("order_id", params.OrderId),
+		slog.String("event_id", eventId),
+		slog.String("order_id", job.OrderId),
+		slog.String("kind", string(job.Kind)),
 		slog.String("error", errMsg),
 		slog.Bool("tg_skip", true))
 }
@@ -174,6 +201,16 @@ func (rq *RetryQueue) processOneJob(job *entity.RetryJob) {
 		slog.Int("attempt", job.Attempts+1),
 	)
 
+	if job.Kind == entity.RetryJobRefund {
+		rq.processRefundJob(job, log)
+		return
+	}
+
+	if rq.registrar == nil {
+		rq.failJob(job, "invoices cannot be retried: no registrar configured")
+		return
+	}
+
 	// Load the original checkout params from the database
 	params, err := rq.db.GetCheckoutParamsForEvent(job.EventId)
 	if err != nil {
@@ -247,7 +284,7 @@ func (rq *RetryQueue) processOneJob(job *entity.RetryJob) {
 	}
 
 	// Attempt to register the invoice.
-	payment, err := rq.inv.RegisterInvoice(ctx, params)
+	payment, err := rq.registrar.RegisterInvoice(ctx, params)
 	job.Attempts++
 	job.UpdatedAt = time.Now()
 
@@ -275,6 +312,33 @@ func (rq *RetryQueue) processOneJob(job *entity.RetryJob) {
 		slog.String("tg_topic", entity.TopicPayment))
 }
 
+// processRefundJob re-runs the corrective invoice of a refund job. The refund event's
+// params are not stored until the correction succeeds, so the job carries the order and
+// the refunded amount itself.
+func (rq *RetryQueue) processRefundJob(job *entity.RetryJob, log *slog.Logger) {
+	if rq.refunder == nil {
+		rq.failJob(job, "refunds cannot be retried: no refunder configured")
+		return
+	}
+	err := rq.refunder.RetryRefund(entity.WithRetry(context.Background()), job.OrderId, job.EventId, job.Refunded)
+	job.Attempts++
+	job.UpdatedAt = time.Now()
+	if err != nil {
+		log.Warn("retry refund correction failed", sl.Err(err))
+		rq.retryLater(job, log, err.Error())
+		return
+	}
+
+	job.Status = entity.RetryJobCompleted
+	job.LastError = ""
+	if dbErr := rq.db.UpdateRetryJob(job); dbErr != nil {
+		log.Error("update retry job after success", sl.Err(dbErr))
+	}
+	log.Info("refund retry job completed",
+		slog.Int64("refunded", job.Refunded),
+		slog.String("tg_topic", entity.TopicPayment))
+}
+
 // retryLater records a failed attempt: it applies exponential backoff, or marks the job
 // permanently failed once MaxAttempts is reached, then persists the change. The caller is
 // responsible for having already incremented job.Attempts and set job.UpdatedAt.
@@ -0,0 +1,36 @@
+// Package core — stripe-events.go keeps the raw Stripe webhook events. HandleEvent only
+// derives CheckoutParams, which drop most of what Stripe sent; for disputes and audits
+// the event itself is stored first, before anything is derived from it. Storing is best
+// effort: a failure is logged and the event is still processed.
+package core
+
+import (
+	"log/slog"
+	"time"
+	"wfsync/entity"
+	"wfsync/lib/sl"
+
+	"github.com/stripe/stripe-go/v76"
+)
+
+// saveStripeEvent stores the event when an event store is connected. payload is the
+// webhook body whose signature was verified, kept byte for byte; re-encoding the parsed
+// event would drop fields the stripe-go types do not know.
+func (c *Core) saveStripeEvent(evt *stripe.Event, payload []byte) {
+	if c.events == nil || evt == nil {
+		return
+	}
+	log := c.log.With(slog.String("event_id", evt.ID))
+	now := time.Now()
+	record := &entity.StripeEventRecord{
+		ID:         evt.ID,
+		Type:       string(evt.Type),
+		Created:    time.Unix(evt.Created, 0),
+		ReceivedAt: now,
+		ExpiresAt:  now.Add(c.eventRetention),
+		Payload:    string(payload),
+	}
+	if err := c.events.SaveStripeEvent(record); err != nil {
+		log.Error("save stripe event", sl.Err(err))
+	}
+}
@@ -3,7 +3,10 @@ package config
 import (
 	"fmt"
 	"log"
+	"log/slog"
 	"sync"
+	"time"
+	"wfsync/lib/httpclient"
 
 	"github.com/ilyakaznacheev/cleanenv"
 )
@@ -11,6 +14,16 @@ import (
 type Listen struct {
 	BindIp string `yaml:"bind_ip" env-default:"0.0.0.0"`
 	Port   string `yaml:"port" env-default:"8080"`
+	// Locale is the language of validation messages ("en", "pl") for requests whose
+	// Accept-Language header names no supported language.
+	Locale string `yaml:"locale" env-default:"en"`
+	// IdempotencyTTLMin is how long a response to a request with an Idempotency-Key
+	// header is replayed for repeats of that request.
+	IdempotencyTTLMin int `yaml:"idempotency_ttl_min" env-default:"1440"`
+	// RateLimitPerMin refills each user's /v1 request budget; RateLimitBurst is the
+	// budget itself. 0 disables rate limiting.
+	RateLimitPerMin int `yaml:"rate_limit_per_min" env-default:"0"`
+	RateLimitBurst  int `yaml:"rate_limit_burst" env-default:"20"`
 }
 
 type StripeConfig struct {
@@ -20,6 +33,25 @@ type StripeConfig struct {
 	TestKey           string `yaml:"test_key" env-default:""`
 	TestWebhookSecret string `yaml:"webhook_test_secret" env-default:""`
 	SuccessURL        string `yaml:"success_url" env-default:""`
+	// SuccessURLs overrides SuccessURL per order source ("api", "opencart", "b2b"). An
+	// order's own success_url still wins.
+	SuccessURLs map[string]string `yaml:"success_urls"`
+	// Multicapture requests multi-capture on held payments, so a hold can be captured in
+	// stages; the last capture (or one reaching the held amount) releases the rest.
+	// Requires a Stripe account eligible for multicapture.
+	Multicapture bool `yaml:"multicapture" env-default:"false"`
+	// MaxNameLength truncates line item names on checkout sessions at a word boundary.
+	// 0 disables truncation.
+	MaxNameLength int `yaml:"max_name_length" env-default:"250"`
+	// NotifyExpired posts abandoned (expired) checkout sessions to the payment topic.
+	NotifyExpired bool `yaml:"notify_expired" env-default:"false"`
+	// CollectBillingAddress and CollectPhone make Checkout ask for the customer's full
+	// billing address and phone number, so the invoice contractor is complete.
+	CollectBillingAddress bool `yaml:"collect_billing_address" env-default:"true"`
+	CollectPhone          bool `yaml:"collect_phone" env-default:"true"`
+	// EventRetentionDays is how long raw webhook events are kept in stripe_events for
+	// audits (requires MongoDB).
+	EventRetentionDays int `yaml:"event_retention_days" env-default:"365"`
 }
 
 type WfirmaConfig struct {
@@ -42,17 +74,75 @@ type WfirmaConfig struct {
 	// the assigned KSeF number first. 0 disables the gate (download immediately, legacy
 	// behavior). See docs/wfirma-ksef-download-confirmation.md.
 	KSefDownloadWaitSeconds int `yaml:"ksef_download_wait_seconds" env-default:"30"`
+
+	// DefaultVATRate is the domestic rate applied when an order carries no tax_value
+	// (e.g. 8 for a shop selling only reduced-rate goods). Lines with their own vat_rate
+	// keep it.
+	DefaultVATRate int `yaml:"default_vat_rate" env-default:"23"`
+
+	// DefaultCountry, DefaultCity and DefaultZip fill the address fields wFirma requires
+	// on a new contractor when the order leaves them empty. They should point at the
+	// seller's own location: a Polish fallback is wrong for a shop operating elsewhere.
+	// DefaultCity and DefaultZip apply only to customers in DefaultCountry.
+	DefaultCountry string `yaml:"default_country" env-default:"PL"`
+	DefaultCity    string `yaml:"default_city" env-default:"Warszawa"`
+	DefaultZip     string `yaml:"default_zip" env-default:"01-001"`
+
+	// ShippingVATCode taxes shipping lines at a fixed code (e.g. "23", "8", "0", "ZW")
+	// instead of the goods rate. Empty keeps shipping at the goods rate, the default for
+	// shipping that is ancillary to the goods; zero-rated supplies (WDT, EXP) keep their
+	// code either way. An order's shipping_vat_rate takes precedence.
+	ShippingVATCode string `yaml:"shipping_vat_code" env-default:""`
+
+	// PaymentMethods maps store payment method codes (OpenCart payment_code) to wFirma
+	// payment methods: transfer, cash, compensation, cod, payment_card. Unmapped codes
+	// use "transfer".
+	PaymentMethods map[string]string `yaml:"payment_methods"`
+
+	// MaxNameLength truncates invoice line names at a word boundary; long OpenCart
+	// product names are otherwise rejected by wFirma. 0 disables truncation.
+	MaxNameLength int `yaml:"max_name_length" env-default:"250"`
+
+	// DescriptionTemplate is a Go text/template for the invoice description, rendered with
+	// .OrderId, .Date (issue date), .CustomerName, .Email, .Part and .Parts (split orders).
+	// Empty keeps the default "Numer zamówienia: <order id>" with "(część n/m)" on splits.
+	DescriptionTemplate string `yaml:"description_template" env-default:""`
+
+	// TaxTitle is a Go text/template for the title of each tax summary line, rendered with
+	// .Label ("23%", "WDT"), .Code, .Rate and .StoreTitle (the order's tax_title).
+	// Empty keeps the default "VAT <label>".
+	TaxTitle string `yaml:"tax_title" env-default:""`
+
+	// DecimalSeparator formats amounts in the tax summary text, e.g. "," for "18,70".
+	DecimalSeparator string `yaml:"decimal_separator" env-default:"."`
+
+	// DefaultSeries is the wFirma numbering series id for VAT invoices; Series overrides it
+	// per order source ("api", "opencart", "b2b", "stripe"). Empty leaves the choice to
+	// wFirma. Proformas always use the wFirma default, since a series is bound to one
+	// document type.
+	DefaultSeries string            `yaml:"default_series" env-default:""`
+	Series        map[string]string `yaml:"series"`
 }
 
+// Mongo configures the MongoDB connection. TLS, ReplicaSet and SRV cover Atlas and
+// secured clusters; Options carries any other connection string option verbatim
+// (e.g. retryWrites, w, authMechanism). Port is ignored for SRV, which resolves hosts via DNS.
 type Mongo struct {
-	Enabled  bool   `yaml:"enabled" env-default:"false"`
-	Host     string `yaml:"host" env-default:"127.0.0.1"`
-	Port     string `yaml:"port" env-default:"27017"`
-	User     string `yaml:"user" env-default:"admin"`
-	Password string `yaml:"password" env-default:"pass"`
-	Database string `yaml:"database" env-default:""`
+	Enabled    bool              `yaml:"enabled" env-default:"false"`
+	Host       string            `yaml:"host" env-default:"127.0.0.1"`
+	Port       string            `yaml:"port" env-default:"27017"`
+	User       string            `yaml:"user" env-default:"admin"`
+	Password   string            `yaml:"password" env-default:"pass"`
+	Database   string            `yaml:"database" env-default:""`
+	TLS        bool              `yaml:"tls" env-default:"false"`
+	ReplicaSet string            `yaml:"replica_set" env-default:""`
+	SRV        bool              `yaml:"srv" env-default:"false"`
+	Options    map[string]string `yaml:"options"`
 }
 
+// OpenCart configures the store database. The Status* triggers are order status ids,
+// or status names as shown in the store admin, resolved to ids against the
+// order_status table at startup.
 type OpenCart struct {
 	Enabled               bool   `yaml:"enabled" env-default:"false"`
 	Driver                string `yaml:"driver" env-default:"mysql"`
@@ -70,6 +160,17 @@ type OpenCart struct {
 	StatusInvoiceRequest  string `yaml:"status_invoice_request" env-default:""`
 	StatusInvoiceResult   string `yaml:"status_invoice_result" env-default:""`
 	CustomFieldNIP        string `yaml:"custom_field_nip" env-default:""`
+	// CommentTemplate is an html/template for the order history entry written after a
+	// job succeeds; empty uses the built-in link + number + amount + time entry.
+	CommentTemplate string `yaml:"comment_template" env-default:""`
+	// ForceInvoice passes orders that already carry wf_invoice to the invoice handler,
+	// which reuses the invoice and downloads its file again. By default such orders are
+	// skipped and moved to the result status.
+	ForceInvoice bool `yaml:"force_invoice" env-default:"false"`
+	// BaseCurrency is the store's default currency, whose currency_value is 1 by
+	// definition; it is the only currency a missing/zero rate may fall back for. Orders
+	// with an empty or unsupported currency_code are invoiced in it.
+	BaseCurrency string `yaml:"base_currency" env-default:"PLN"`
 }
 
 type Telegram struct {
@@ -79,6 +180,47 @@ type Telegram struct {
 	DigestIntervalMin int    `yaml:"digest_interval_min" env-default:"60"`
 	DefaultTier       string `yaml:"default_tier" env-default:"realtime"`
 	InviteCodeLength  int    `yaml:"invite_code_length" env-default:"8"`
+	// DigestMaxEntries caps the entries listed in one digest, the rest are counted per
+	// topic and level; 0 lists them all.
+	DigestMaxEntries int `yaml:"digest_max_entries" env-default:"100"`
+	// UserTopics and AdminTopics are the topic subscriptions assigned when a user is
+	// approved or promoted to admin. An empty list subscribes to every topic of the role.
+	UserTopics  []string `yaml:"user_topics" env-default:"invoice,payment"`
+	AdminTopics []string `yaml:"admin_topics"`
+	// Language selects the built-in wording of business notifications (en, pl);
+	// Templates overrides it per event, e.g. order.invoiced: "Order {{.order_id}} done".
+	Language  string            `yaml:"language" env-default:"en"`
+	Templates map[string]string `yaml:"templates"`
+	// EscalationWindowMin re-sends an unacknowledged critical-tier alert and reports it
+	// to admins after this many minutes; 0 disables escalation.
+	EscalationWindowMin int `yaml:"escalation_window_min" env-default:"0"`
+	// Groups are group chats that receive the notifications of their topics.
+	Groups []TelegramGroup `yaml:"groups"`
+	// CommandSuffix is the bot's username. When several bots share a group, setting it
+	// makes this bot answer only commands addressed as /command@username there.
+	CommandSuffix string `yaml:"command_suffix" env-default:""`
+	// AdminIds are telegram ids made admins on their first /start, so the first admin
+	// needs no database edit.
+	AdminIds []int64 `yaml:"admin_ids"`
+	// MinLevel is the lowest log level forwarded to the bot: debug, info, warn or error.
+	MinLevel string `yaml:"min_level" env-default:"debug"`
+}
+
+// Level parses MinLevel, falling back to debug when it is not a level name.
+func (t Telegram) Level() slog.Level {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(t.MinLevel)); err != nil {
+		return slog.LevelDebug
+	}
+	return level
+}
+
+// TelegramGroup is a group chat receiving notifications. In a group with forum topics
+// enabled, MessageThreadId selects the forum topic to post in; 0 posts to the general one.
+type TelegramGroup struct {
+	ChatId          int64    `yaml:"chat_id"`
+	MessageThreadId int64    `yaml:"message_thread_id"`
+	Topics          []string `yaml:"topics"` // empty receives every topic
 }
 
 type VATRates struct {
@@ -107,6 +249,73 @@ type PaymentReconciler struct {
 	IntervalMin int  `yaml:"interval_min" env-default:"15"`
 }
 
+// B2B configures the B2B portal integration. CallbackSecret signs the optional
+// per-order callback (HMAC-SHA256); orders with a callback_url are rejected when it is empty.
+// MaxInlinePDFKB caps the PDF size returned inline as base64 on include_pdf requests;
+// zero or less keeps the 5120 KB default.
+// BatchMaxOrders caps the orders of one batch request, of which BatchConcurrency are
+// invoiced at a time; the default lets a batch finish within the 60s request timeout.
+type B2B struct {
+	CallbackSecret     string `yaml:"callback_secret" env-default:""`
+	CallbackTimeoutSec int    `yaml:"callback_timeout_sec" env-default:"10"`
+	MaxInlinePDFKB     int    `yaml:"max_inline_pdf_kb" env-default:"5120"`
+	BatchMaxOrders     int    `yaml:"batch_max_orders" env-default:"20"`
+	BatchConcurrency   int    `yaml:"batch_concurrency" env-default:"4"`
+}
+
+// Retention configures the periodic job that moves old terminal checkout params
+// (paid/refunded/canceled) into the archive collection so checkout_params stays small.
+type Retention struct {
+	Enabled     bool `yaml:"enabled" env-default:"false"`
+	IntervalMin int  `yaml:"interval_min" env-default:"1440"`
+	MaxAgeDays  int  `yaml:"max_age_days" env-default:"180"`
+	BatchSize   int  `yaml:"batch_size" env-default:"500"`
+}
+
+// FileJanitor configures the periodic cleanup of document PDFs in file_path that no
+// checkout record or OpenCart order references. GraceHours protects files of documents
+// that are still being registered. TrackedSince (YYYY-MM-DD) is the day document files
+// started being recorded; older files are never deleted, and the janitor does not start
+// without it.
+type FileJanitor struct {
+	Enabled      bool   `yaml:"enabled" env-default:"false"`
+	IntervalMin  int    `yaml:"interval_min" env-default:"1440"`
+	GraceHours   int    `yaml:"grace_hours" env-default:"168"`
+	TrackedSince string `yaml:"tracked_since" env-default:""`
+}
+
+// FileLinks switches document links from plain file_url links to signed, expiring links
+// served by this service under /files. Enabled when both Secret and BaseURL (the public
+// URL of this service) are set.
+type FileLinks struct {
+	Secret  string `yaml:"secret" env-default:""`
+	BaseURL string `yaml:"base_url" env-default:""`
+	TTLMin  int    `yaml:"ttl_min" env-default:"10080"`
+}
+
+// Enabled reports whether document links are signed and expire.
+func (f FileLinks) Enabled() bool {
+	return f.Secret != "" && f.BaseURL != ""
+}
+
+// HTTPClient configures outbound calls to wFirma and Stripe. Proxy overrides the
+// HTTP_PROXY/HTTPS_PROXY environment, CAFile adds a PEM bundle to the system CA pool, and
+// TimeoutSec replaces each client's own default timeout when set.
+type HTTPClient struct {
+	Proxy      string `yaml:"proxy" env-default:""`
+	CAFile     string `yaml:"ca_file" env-default:""`
+	TimeoutSec int    `yaml:"timeout_sec" env-default:"0"`
+}
+
+// Options converts the section to lib/httpclient options.
+func (h HTTPClient) Options() httpclient.Options {
+	return httpclient.Options{
+		Proxy:   h.Proxy,
+		CAFile:  h.CAFile,
+		Timeout: time.Duration(h.TimeoutSec) * time.Second,
+	}
+}
+
 type Config struct {
 	Stripe            StripeConfig      `yaml:"stripe"`
 	WFirma            WfirmaConfig      `yaml:"wfirma"`
@@ -118,10 +327,18 @@ type Config struct {
 	VIES              VIES              `yaml:"vies"`
 	RetryQueue        RetryQueue        `yaml:"retry_queue"`
 	PaymentReconciler PaymentReconciler `yaml:"payment_reconciler"`
+	Retention         Retention         `yaml:"retention"`
+	FileJanitor       FileJanitor       `yaml:"file_janitor"`
+	FileLinks         FileLinks         `yaml:"file_links"`
+	B2B               B2B               `yaml:"b2b"`
+	HTTPClient        HTTPClient        `yaml:"http_client"`
 	Env               string            `yaml:"env" env-default:"local"`
 	Log               string            `yaml:"log"`
 	Location          string            `yaml:"location" env-default:"UTC"`
 	FilePath          string            `yaml:"file_path" env-default:""`
+	// TotalTolerance is the gap in minor units between an order total and the sum of its
+	// lines that is treated as rounding: accepted and spread over the lines.
+	TotalTolerance int64 `yaml:"total_tolerance" env-default:"2"`
 }
 
 var instance *Config
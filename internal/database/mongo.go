@@ -4,6 +4,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net"
+	"net/url"
+	"strings"
 	"time"
 	"wfsync/entity"
 	"wfsync/internal/config"
@@ -17,6 +20,7 @@ import (
 const (
 	collectionUsers           = "users"
 	collectionCheckoutParams  = "checkout_params"
+	collectionCheckoutArchive = "checkout_params_archive"
 	collectionInvoice         = "wfirma_invoice"
 	collectionProducts        = "products"
 	collectionInviteCodes     = "invite_codes"
@@ -24,6 +28,13 @@ const (
 	collectionVIESValidations = "vies_validations"
 	collectionRetryJobs       = "retry_jobs"
 	collectionBankAccounts    = "wfirma_bank_accounts"
+	collectionOrderLocks      = "order_locks"
+	collectionIdempotency     = "idempotency_keys"
+	collectionInvoiceDrafts   = "invoice_drafts"
+	collectionStripeEvents    = "stripe_events"
+	collectionAuditLog        = "audit_log"
+	collectionFeatureFlags    = "feature_flags"
+	collectionDocumentFiles   = "document_files"
 )
 
 type MongoDB struct {
@@ -47,8 +58,7 @@ func NewMongoClient(conf *config.Config) *MongoDB {
 	if !conf.Mongo.Enabled {
 		return nil
 	}
-	connectionUri := fmt.Sprintf("mongodb://%s:%s", conf.Mongo.Host, conf.Mongo.Port)
-	clientOptions := options.Client().ApplyURI(connectionUri)
+	clientOptions := options.Client().ApplyURI(buildMongoURI(conf.Mongo))
 	if conf.Mongo.User != "" {
 		clientOptions.SetAuth(options.Credential{
 			Username:   conf.Mongo.User,
@@ -63,6 +73,37 @@ func NewMongoClient(conf *config.Config) *MongoDB {
 	return client
 }
 
+// buildMongoURI assembles the connection string from config. Credentials are not
+// embedded here — they are applied through SetAuth so they never end up in a URI that
+// might be logged. Options are emitted in sorted order to keep the URI deterministic;
+// the dedicated tls/replica_set fields take precedence over the same keys in Options.
+func buildMongoURI(conf config.Mongo) string {
+	scheme := "mongodb"
+	host := conf.Host
+	if conf.SRV {
+		scheme = "mongodb+srv"
+	} else if conf.Port != "" && !strings.Contains(host, ",") {
+		host = net.JoinHostPort(host, conf.Port)
+	}
+
+	query := url.Values{}
+	for k, v := range conf.Options {
+		query.Set(k, v)
+	}
+	if conf.TLS {
+		query.Set("tls", "true")
+	}
+	if conf.ReplicaSet != "" {
+		query.Set("replicaSet", conf.ReplicaSet)
+	}
+
+	uri := fmt.Sprintf("%s://%s/", scheme, host)
+	if len(query) > 0 {
+		uri += "?" + query.Encode()
+	}
+	return uri
+}
+
 func (m *MongoDB) connect(ctx context.Context) (*mongo.Client, error) {
 	connection, err := mongo.Connect(ctx, m.clientOptions)
 	if err != nil {
@@ -75,6 +116,19 @@ func (m *MongoDB) disconnect(ctx context.Context, connection *mongo.Client) {
 	_ = connection.Disconnect(ctx)
 }
 
+// Ping checks that the server answers, for the health endpoint.
+func (m *MongoDB) Ping(ctx context.Context) error {
+	connection, err := m.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer m.disconnect(ctx, connection)
+	if err = connection.Ping(ctx, nil); err != nil {
+		return fmt.Errorf("mongodb ping: %w", err)
+	}
+	return nil
+}
+
 // Close is a no-op since connections are created per-operation.
 // This method exists for interface consistency with other databases.
 func (m *MongoDB) Close(_ context.Context) error {
@@ -228,6 +282,156 @@ func (m *MongoDB) UpdateCheckoutParams(params *entity.CheckoutParams) error {
 	return err
 }
 
+// UpdateInvoiceFile points the order's checkout params at a re-downloaded invoice file.
+// Matching on invoice_id as well keeps a stale request from attaching the file to a
+// different invoice, and orders that never went through checkout are simply not found.
+func (m *MongoDB) UpdateInvoiceFile(orderId, invoiceId, invoiceFile string) error {
+	ctx, cancel := m.opCtx()
+	defer cancel()
+	connection, err := m.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer m.disconnect(ctx, connection)
+
+	collection := connection.Database(m.database).Collection(collectionCheckoutParams)
+	filter := bson.D{{"order_id", orderId}, {"invoice_id", invoiceId}}
+	update := bson.D{{"$set", bson.D{{"invoice_file", invoiceFile}}}}
+	_, err = collection.UpdateMany(ctx, filter, update)
+	return err
+}
+
+// SaveRefund records a refund on the order's checkout params once it is settled: the
+// cumulative refunded amount, the refund event and, when one was issued, the corrective
+// invoice.
+func (m *MongoDB) SaveRefund(orderId, eventId string, refunded int64, correctionId string) error {
+	ctx, cancel := m.opCtx()
+	defer cancel()
+	connection, err := m.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer m.disconnect(ctx, connection)
+
+	collection := connection.Database(m.database).Collection(collectionCheckoutParams)
+	filter := bson.D{{"order_id", orderId}}
+	set := bson.D{
+		{"refunded", refunded},
+		{"status", "refunded"},
+		{"event_id", eventId},
+		{"modified", time.Now()},
+	}
+	if correctionId != "" {
+		set = append(set, bson.E{Key: "correction_id", Value: correctionId})
+	}
+	_, err = collection.UpdateMany(ctx, filter, bson.D{{"$set", set}})
+	return err
+}
+
+// RecordDocumentFiles records downloaded document files so the file janitor knows they
+// are in use. Each file is upserted into its own collection, keyed by name: unlike a field
+// on checkout params, the record exists for orders that never had a checkout.
+func (m *MongoDB) RecordDocumentFiles(orderId string, files ...string) error {
+	if len(files) == 0 {
+		return nil
+	}
+	ctx, cancel := m.opCtx()
+	defer cancel()
+	connection, err := m.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer m.disconnect(ctx, connection)
+
+	collection := connection.Database(m.database).Collection(collectionDocumentFiles)
+	now := time.Now()
+	var models []mongo.WriteModel
+	for _, file := range files {
+		if file == "" {
+			continue
+		}
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(bson.D{{"_id", file}}).
+			SetUpdate(bson.D{{"$setOnInsert", bson.D{{"order_id", orderId}, {"recorded_at", now}}}}).
+			SetUpsert(true))
+	}
+	if len(models) == 0 {
+		return nil
+	}
+	_, err = collection.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	return err
+}
+
+// ReferencedFiles returns the names of all recorded document files and of those stored on
+// checkout params, archived ones included: an archived order's PDF is still a valid
+// document. The files field of checkout params holds the records written before the
+// document_files collection.
+func (m *MongoDB) ReferencedFiles() (map[string]bool, error) {
+	ctx, cancel := m.opCtx()
+	defer cancel()
+	connection, err := m.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer m.disconnect(ctx, connection)
+
+	db := connection.Database(m.database)
+	opts := options.Find().SetProjection(bson.D{
+		{"invoice_file", 1},
+		{"proforma_file", 1},
+		{"files", 1},
+	})
+	filter := bson.D{{"$or", bson.A{
+		bson.D{{"invoice_file", bson.D{{"$nin", bson.A{nil, ""}}}}},
+		bson.D{{"proforma_file", bson.D{{"$nin", bson.A{nil, ""}}}}},
+		bson.D{{"files.0", bson.D{{"$exists", true}}}},
+	}}}
+
+	refs := make(map[string]bool)
+	for _, name := range []string{collectionCheckoutParams, collectionCheckoutArchive} {
+		cursor, err := db.Collection(name).Find(ctx, filter, opts)
+		if err != nil {
+			return nil, fmt.Errorf("find %s files: %w", name, err)
+		}
+		for cursor.Next(ctx) {
+			var params entity.CheckoutParams
+			if err = cursor.Decode(&params); err != nil {
+				_ = cursor.Close(ctx)
+				return nil, fmt.Errorf("decode %s: %w", name, err)
+			}
+			for _, file := range append(params.Files, params.InvoiceFile, params.ProformaFile) {
+				if file != "" {
+					refs[file] = true
+				}
+			}
+		}
+		err = cursor.Err()
+		_ = cursor.Close(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	cursor, err := db.Collection(collectionDocumentFiles).Find(ctx, bson.D{}, options.Find().SetProjection(bson.D{{"_id", 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("find document files: %w", err)
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		var doc struct {
+			Name string `bson:"_id"`
+		}
+		if err = cursor.Decode(&doc); err != nil {
+			return nil, fmt.Errorf("decode document file: %w", err)
+		}
+		refs[doc.Name] = true
+	}
+	if err = cursor.Err(); err != nil {
+		return nil, err
+	}
+	return refs, nil
+}
+
 // CloseCheckoutParams marks a checkout params document resolved by stamping closed
 // (and invoice_id when provided), keyed on payment_id so it always targets the original
 // document even if the in-memory order_id was repaired. payment_id is used rather than
@@ -365,6 +569,89 @@ func (m *MongoDB) GetCheckoutParamsByOrder(orderId string) (*entity.CheckoutPara
 	return &params, nil
 }
 
+// archiveFilter pre-selects the checkout params ArchiveCheckoutParams moves: terminal or
+// paid, and not touched since cutoff. Both conditions are alternatives, so they go under
+// $and; a document carries only one "$or" key.
+func archiveFilter(cutoff time.Time) bson.D {
+	return bson.D{{"$and", bson.A{
+		bson.D{{"$or", bson.A{
+			bson.D{{"status", bson.D{{"$in", entity.CheckoutTerminalStatuses}}}},
+			bson.D{{"paid", true}},
+		}}},
+		bson.D{{"$or", bson.A{
+			bson.D{{"modified", bson.D{{"$lt", cutoff}}}},
+			bson.D{{"created", bson.D{{"$lt", cutoff}}}},
+		}}},
+	}}}
+}
+
+// ArchiveCheckoutParams moves up to limit terminal checkout params last modified before
+// cutoff into the archive collection, stamping archived_at. The query only pre-selects
+// candidates; entity.CheckoutParams.ArchivableBefore has the final say, so the selection
+// rule lives in one tested place. Documents are inserted into the archive before being
+// deleted, so an interrupted run can at worst leave a copy in both collections, never lose one.
+func (m *MongoDB) ArchiveCheckoutParams(cutoff time.Time, limit int) (int, error) {
+	ctx, cancel := m.opCtx()
+	defer cancel()
+	connection, err := m.connect(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer m.disconnect(ctx, connection)
+
+	db := connection.Database(m.database)
+	collection := db.Collection(collectionCheckoutParams)
+	filter := archiveFilter(cutoff)
+	opts := options.Find().SetSort(bson.D{{"modified", 1}})
+	if limit > 0 {
+		opts.SetLimit(int64(limit))
+	}
+
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return 0, fmt.Errorf("find archivable: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	now := time.Now()
+	var docs []interface{}
+	var ids bson.A
+	for cursor.Next(ctx) {
+		var params entity.CheckoutParams
+		if err = cursor.Decode(&params); err != nil {
+			return 0, fmt.Errorf("decode checkout params: %w", err)
+		}
+		if !params.ArchivableBefore(cutoff) {
+			continue
+		}
+		var doc bson.M
+		if err = cursor.Decode(&doc); err != nil {
+			return 0, fmt.Errorf("decode raw document: %w", err)
+		}
+		doc["archived_at"] = now
+		docs = append(docs, doc)
+		ids = append(ids, doc["_id"])
+	}
+	if err = cursor.Err(); err != nil {
+		return 0, err
+	}
+	if len(docs) == 0 {
+		return 0, nil
+	}
+
+	// Ordered=false so a document already copied by an interrupted run (duplicate _id)
+	// does not block the rest of the batch; its original is still deleted below.
+	_, err = db.Collection(collectionCheckoutArchive).InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		return 0, fmt.Errorf("insert archive: %w", err)
+	}
+	res, err := collection.DeleteMany(ctx, bson.D{{"_id", bson.D{{"$in", ids}}}})
+	if err != nil {
+		return 0, fmt.Errorf("delete archived: %w", err)
+	}
+	return int(res.DeletedCount), nil
+}
+
 func (m *MongoDB) GetStripeOrderIds(orderIds []string) (map[string]bool, error) {
 	if len(orderIds) == 0 {
 		return nil, nil
@@ -492,6 +779,27 @@ func (m *MongoDB) GetInvoicesByDateRange(from, to, invType string) ([]*entity.Lo
 	return invoices, nil
 }
 
+// GetInvoiceById returns the locally stored invoice document with the given wFirma ID,
+// or nil when there is none.
+func (m *MongoDB) GetInvoiceById(id string) (*entity.LocalInvoice, error) {
+	ctx, cancel := m.opCtx()
+	defer cancel()
+	connection, err := m.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer m.disconnect(ctx, connection)
+
+	collection := connection.Database(m.database).Collection(collectionInvoice)
+	filter := bson.D{{"id", id}}
+	var invoice entity.LocalInvoice
+	err = collection.FindOne(ctx, filter).Decode(&invoice)
+	if err != nil {
+		return nil, m.findError(err)
+	}
+	return &invoice, nil
+}
+
 // DeleteInvoiceById removes a single invoice document by its wFirma ID.
 func (m *MongoDB) DeleteInvoiceById(id string) error {
 	ctx, cancel := m.opCtx()
@@ -573,7 +881,11 @@ func (m *MongoDB) GetTelegramUserById(telegramId int64) (*entity.User, error) {
 	return &user, nil
 }
 
-// RegisterTelegramUser upserts a new user with role=pending.
+// RegisterTelegramUser upserts a new user with role=pending, keyed on telegram_id.
+// Repeated /start calls (e.g. before the bot's user cache reloads) converge on the same
+// document and never reset an already granted role. Two concurrent upserts can both miss
+// the filter; the unique telegram_id index makes the loser fail with a duplicate key
+// error, and retrying once turns it into a plain update of the winner's document.
 func (m *MongoDB) RegisterTelegramUser(telegramId int64, username string) error {
 	ctx, cancel := m.opCtx()
 	defer cancel()
@@ -585,13 +897,27 @@ func (m *MongoDB) RegisterTelegramUser(telegramId int64, username string) error
 
 	collection := connection.Database(m.database).Collection(collectionUsers)
 	filter := bson.D{{"telegram_id", telegramId}}
-	update := bson.D{
+	update := telegramRegistrationUpdate(telegramId, username, time.Now())
+	opts := options.Update().SetUpsert(true)
+	_, err = collection.UpdateOne(ctx, filter, update, opts)
+	if mongo.IsDuplicateKeyError(err) {
+		_, err = collection.UpdateOne(ctx, filter, update, opts)
+	}
+	return err
+}
+
+// telegramRegistrationUpdate builds the registration upsert. Everything that defines the
+// user's standing (role, enabled, tier, registration time, API username/token) goes into
+// $setOnInsert; only the Telegram handle, which the user may change, is refreshed on
+// every call.
+func telegramRegistrationUpdate(telegramId int64, username string, now time.Time) bson.D {
+	return bson.D{
 		{"$setOnInsert", bson.D{
 			{"telegram_id", telegramId},
 			{"telegram_role", entity.RolePending},
 			{"telegram_enabled", false},
 			{"subscription_tier", entity.TierRealtime},
-			{"registered_at", time.Now()},
+			{"registered_at", now},
 			{"username", username},
 			{"token", ""},
 		}},
@@ -599,9 +925,6 @@ func (m *MongoDB) RegisterTelegramUser(telegramId int64, username string) error
 			{"telegram_username", username},
 		}},
 	}
-	opts := options.Update().SetUpsert(true)
-	_, err = collection.UpdateOne(ctx, filter, update, opts)
-	return err
 }
 
 // SetTelegramRole sets the telegram role for a user.
@@ -669,6 +992,65 @@ func (m *MongoDB) SetTelegramTopics(telegramId int64, topics []string) error {
 	return err
 }
 
+// TouchUser records that a telegram user has just issued a bot command.
+func (m *MongoDB) TouchUser(telegramId int64) error {
+	ctx, cancel := m.opCtx()
+	defer cancel()
+	connection, err := m.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer m.disconnect(ctx, connection)
+
+	collection := connection.Database(m.database).Collection(collectionUsers)
+	filter := bson.D{{"telegram_id", telegramId}}
+	update := bson.D{{"$set", bson.D{{"last_seen", time.Now()}}}}
+	_, err = collection.UpdateOne(ctx, filter, update)
+	return err
+}
+
+// SetTopicMute mutes a topic for a user until the given time; a zero time lifts the mute.
+func (m *MongoDB) SetTopicMute(telegramId int64, topic string, until time.Time) error {
+	ctx, cancel := m.opCtx()
+	defer cancel()
+	connection, err := m.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer m.disconnect(ctx, connection)
+
+	collection := connection.Database(m.database).Collection(collectionUsers)
+	filter := bson.D{{"telegram_id", telegramId}}
+	field := "topic_mutes." + topic
+	update := bson.D{{"$set", bson.D{{field, until}}}}
+	if until.IsZero() {
+		update = bson.D{{"$unset", bson.D{{field, ""}}}}
+	}
+	_, err = collection.UpdateOne(ctx, filter, update)
+	return err
+}
+
+// SetDigestInterval sets how often a user on the digest tier gets a digest; 0 restores
+// the configured default.
+func (m *MongoDB) SetDigestInterval(telegramId int64, minutes int) error {
+	ctx, cancel := m.opCtx()
+	defer cancel()
+	connection, err := m.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer m.disconnect(ctx, connection)
+
+	collection := connection.Database(m.database).Collection(collectionUsers)
+	filter := bson.D{{"telegram_id", telegramId}}
+	update := bson.D{{"$set", bson.D{{"digest_interval_min", minutes}}}}
+	if minutes == 0 {
+		update = bson.D{{"$unset", bson.D{{"digest_interval_min", ""}}}}
+	}
+	_, err = collection.UpdateOne(ctx, filter, update)
+	return err
+}
+
 // SetSubscriptionTier sets the subscription tier and digest schedule for a user.
 func (m *MongoDB) SetSubscriptionTier(telegramId int64, tier entity.SubscriptionTier, schedule string) error {
 	ctx, cancel := m.opCtx()
@@ -704,13 +1086,13 @@ func (m *MongoDB) CreateInviteCode(code *entity.InviteCode) error {
 	return err
 }
 
-// UseInviteCode atomically finds and uses an invite code.
-func (m *MongoDB) UseInviteCode(code string, telegramId int64) error {
+// UseInviteCode atomically finds and uses an invite code, returning the code as used.
+func (m *MongoDB) UseInviteCode(code string, telegramId int64) (*entity.InviteCode, error) {
 	ctx, cancel := m.opCtx()
 	defer cancel()
 	connection, err := m.connect(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer m.disconnect(ctx, connection)
 
@@ -726,14 +1108,71 @@ func (m *MongoDB) UseInviteCode(code string, telegramId int64) error {
 		}},
 		{"$inc", bson.D{{"use_count", 1}}},
 	}
-	result, err := collection.UpdateOne(ctx, filter, update)
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var invite entity.InviteCode
+	err = collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&invite)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, fmt.Errorf("invite code not found or exhausted")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &invite, nil
+}
+
+// SetInvitedBy records which admin's invite code a telegram user registered with.
+func (m *MongoDB) SetInvitedBy(telegramId, inviterId int64) error {
+	ctx, cancel := m.opCtx()
+	defer cancel()
+	connection, err := m.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer m.disconnect(ctx, connection)
+
+	collection := connection.Database(m.database).Collection(collectionUsers)
+	filter := bson.D{{"telegram_id", telegramId}}
+	update := bson.D{{"$set", bson.D{{"invited_by", inviterId}}}}
+	_, err = collection.UpdateOne(ctx, filter, update)
+	return err
+}
+
+// SetLanguage sets the language of a telegram user's bot replies.
+func (m *MongoDB) SetLanguage(telegramId int64, language string) error {
+	ctx, cancel := m.opCtx()
+	defer cancel()
+	connection, err := m.connect(ctx)
 	if err != nil {
 		return err
 	}
-	if result.MatchedCount == 0 {
-		return fmt.Errorf("invite code not found or exhausted")
+	defer m.disconnect(ctx, connection)
+
+	collection := connection.Database(m.database).Collection(collectionUsers)
+	filter := bson.D{{"telegram_id", telegramId}}
+	update := bson.D{{"$set", bson.D{{"language", language}}}}
+	_, err = collection.UpdateOne(ctx, filter, update)
+	return err
+}
+
+// SetTimezone sets the IANA zone a telegram user's times are shown in; an empty zone
+// restores the server's.
+func (m *MongoDB) SetTimezone(telegramId int64, timezone string) error {
+	ctx, cancel := m.opCtx()
+	defer cancel()
+	connection, err := m.connect(ctx)
+	if err != nil {
+		return err
 	}
-	return nil
+	defer m.disconnect(ctx, connection)
+
+	collection := connection.Database(m.database).Collection(collectionUsers)
+	filter := bson.D{{"telegram_id", telegramId}}
+	update := bson.D{{"$set", bson.D{{"timezone", timezone}}}}
+	if timezone == "" {
+		update = bson.D{{"$unset", bson.D{{"timezone", ""}}}}
+	}
+	_, err = collection.UpdateOne(ctx, filter, update)
+	return err
 }
 
 // SaveVATRate upserts a VAT rate document by country_code.
@@ -937,6 +1376,237 @@ func (m *MongoDB) GetRetryJobByEventId(eventId string) (*entity.RetryJob, error)
 	return &job, nil
 }
 
+// AcquireOrderLock takes the processing lock for an order on behalf of owner. The lock is
+// a document keyed by order id; it is granted when none exists, when the existing one
+// has expired (its holder crashed), or when owner already holds it. A lock held by
+// another instance makes the upsert collide on _id, which reports false, not an error.
+func (m *MongoDB) AcquireOrderLock(orderId, owner string, ttl time.Duration) (bool, error) {
+	ctx, cancel := m.opCtx()
+	defer cancel()
+	connection, err := m.connect(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer m.disconnect(ctx, connection)
+
+	collection := connection.Database(m.database).Collection(collectionOrderLocks)
+	now := time.Now()
+	filter := bson.D{
+		{"_id", orderId},
+		{"$or", bson.A{
+			bson.D{{"expires_at", bson.D{{"$lte", now}}}},
+			bson.D{{"owner", owner}},
+		}},
+	}
+	update := bson.D{{"$set", bson.D{
+		{"owner", owner},
+		{"locked_at", now},
+		{"expires_at", now.Add(ttl)},
+	}}}
+	opts := options.Update().SetUpsert(true)
+	_, err = collection.UpdateOne(ctx, filter, update, opts)
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ReleaseOrderLock removes the order's lock if owner still holds it. A lock that expired
+// and was taken over by another instance is left alone.
+func (m *MongoDB) ReleaseOrderLock(orderId, owner string) error {
+	ctx, cancel := m.opCtx()
+	defer cancel()
+	connection, err := m.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer m.disconnect(ctx, connection)
+
+	collection := connection.Database(m.database).Collection(collectionOrderLocks)
+	_, err = collection.DeleteOne(ctx, bson.D{{"_id", orderId}, {"owner", owner}})
+	return err
+}
+
+// GetIdempotentResponse returns the stored response for a user's Idempotency-Key, or nil
+// when there is none or it has expired.
+func (m *MongoDB) GetIdempotentResponse(user, key string) (*entity.IdempotentResponse, error) {
+	ctx, cancel := m.opCtx()
+	defer cancel()
+	connection, err := m.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer m.disconnect(ctx, connection)
+
+	collection := connection.Database(m.database).Collection(collectionIdempotency)
+	filter := bson.D{
+		{"_id", entity.IdempotentResponseID(user, key)},
+		{"expires_at", bson.D{{"$gt", time.Now()}}},
+	}
+	var resp entity.IdempotentResponse
+	err = collection.FindOne(ctx, filter).Decode(&resp)
+	if err != nil {
+		return nil, m.findError(err)
+	}
+	return &resp, nil
+}
+
+// SaveIdempotentResponse stores a response under its user and key, replacing an expired
+// one. The TTL index created by EnsureIdempotencyIndex drops the record once it has expired.
+func (m *MongoDB) SaveIdempotentResponse(resp *entity.IdempotentResponse) error {
+	ctx, cancel := m.opCtx()
+	defer cancel()
+	connection, err := m.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer m.disconnect(ctx, connection)
+
+	collection := connection.Database(m.database).Collection(collectionIdempotency)
+	resp.ID = entity.IdempotentResponseID(resp.User, resp.Key)
+	opts := options.Replace().SetUpsert(true)
+	_, err = collection.ReplaceOne(ctx, bson.D{{"_id", resp.ID}}, resp, opts)
+	return err
+}
+
+// SaveStripeEvent stores a raw Stripe event unless one with its id is already stored, so
+// a redelivery keeps the first receipt. A TTL index on expires_at applies the retention.
+func (m *MongoDB) SaveStripeEvent(record *entity.StripeEventRecord) error {
+	ctx, cancel := m.opCtx()
+	defer cancel()
+	connection, err := m.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer m.disconnect(ctx, connection)
+
+	collection := connection.Database(m.database).Collection(collectionStripeEvents)
+	_, err = collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{"expires_at", 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		return fmt.Errorf("ensure ttl index: %w", err)
+	}
+	opts := options.Update().SetUpsert(true)
+	_, err = collection.UpdateOne(ctx, bson.D{{"_id", record.ID}}, bson.D{{"$setOnInsert", record}}, opts)
+	return err
+}
+
+// AppendAuditEntry inserts an audit entry. The audit log is append-only: there is no
+// method to change or remove entries.
+func (m *MongoDB) AppendAuditEntry(entry *entity.AuditEntry) error {
+	ctx, cancel := m.opCtx()
+	defer cancel()
+	connection, err := m.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer m.disconnect(ctx, connection)
+
+	collection := connection.Database(m.database).Collection(collectionAuditLog)
+	_, err = collection.InsertOne(ctx, entry)
+	return err
+}
+
+// GetFeatureFlags returns every stored feature flag.
+func (m *MongoDB) GetFeatureFlags() ([]*entity.FeatureFlag, error) {
+	ctx, cancel := m.opCtx()
+	defer cancel()
+	connection, err := m.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer m.disconnect(ctx, connection)
+
+	collection := connection.Database(m.database).Collection(collectionFeatureFlags)
+	cursor, err := collection.Find(ctx, bson.D{})
+	if err != nil {
+		return nil, err
+	}
+	defer func(cursor *mongo.Cursor, ctx context.Context) {
+		_ = cursor.Close(ctx)
+	}(cursor, ctx)
+
+	var flags []*entity.FeatureFlag
+	err = cursor.All(ctx, &flags)
+	if err != nil {
+		return nil, err
+	}
+	return flags, nil
+}
+
+// SaveFeatureFlag upserts a feature flag by name.
+func (m *MongoDB) SaveFeatureFlag(flag *entity.FeatureFlag) error {
+	ctx, cancel := m.opCtx()
+	defer cancel()
+	connection, err := m.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer m.disconnect(ctx, connection)
+
+	collection := connection.Database(m.database).Collection(collectionFeatureFlags)
+	filter := bson.D{{"_id", flag.Name}}
+	opts := options.Replace().SetUpsert(true)
+	_, err = collection.ReplaceOne(ctx, filter, flag, opts)
+	return err
+}
+
+// SaveInvoiceDraft stores an order's invoice draft, replacing an earlier one. Drafts live
+// apart from checkout_params so an edit never touches the order's payment record.
+func (m *MongoDB) SaveInvoiceDraft(params *entity.CheckoutParams) error {
+	ctx, cancel := m.opCtx()
+	defer cancel()
+	connection, err := m.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer m.disconnect(ctx, connection)
+
+	collection := connection.Database(m.database).Collection(collectionInvoiceDrafts)
+	opts := options.Replace().SetUpsert(true)
+	_, err = collection.ReplaceOne(ctx, bson.D{{"order_id", params.OrderId}}, params, opts)
+	return err
+}
+
+// GetInvoiceDraft returns the order's invoice draft, or nil when there is none.
+func (m *MongoDB) GetInvoiceDraft(orderId string) (*entity.CheckoutParams, error) {
+	ctx, cancel := m.opCtx()
+	defer cancel()
+	connection, err := m.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer m.disconnect(ctx, connection)
+
+	collection := connection.Database(m.database).Collection(collectionInvoiceDrafts)
+	var params entity.CheckoutParams
+	err = collection.FindOne(ctx, bson.D{{"order_id", orderId}}).Decode(&params)
+	if err != nil {
+		return nil, m.findError(err)
+	}
+	return &params, nil
+}
+
+// DeleteInvoiceDraft removes the order's invoice draft once it has been issued.
+func (m *MongoDB) DeleteInvoiceDraft(orderId string) error {
+	ctx, cancel := m.opCtx()
+	defer cancel()
+	connection, err := m.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer m.disconnect(ctx, connection)
+
+	collection := connection.Database(m.database).Collection(collectionInvoiceDrafts)
+	_, err = collection.DeleteOne(ctx, bson.D{{"order_id", orderId}})
+	return err
+}
+
 // SaveBankAccount upserts a wFirma company_account record by ID. Fields synced
 // from wFirma overwrite existing values, but is_allowed is preserved on update
 // (and defaults to false on first insert) so operator toggles survive re-sync.
@@ -998,7 +1668,8 @@ func (m *MongoDB) GetAllowedBankAccount(currency string) (*entity.BankAccount, e
 	return &account, nil
 }
 
-// MigrateExistingTelegramUsers sets existing enabled users to RoleAdmin + TierRealtime (idempotent).
+// MigrateExistingTelegramUsers sets existing enabled users to RoleAdmin + TierRealtime and
+// ensures the unique telegram_id index (idempotent).
 func (m *MongoDB) MigrateExistingTelegramUsers() error {
 	ctx, cancel := m.opCtx()
 	defer cancel()
@@ -1021,7 +1692,28 @@ func (m *MongoDB) MigrateExistingTelegramUsers() error {
 		{"telegram_role", entity.RoleAdmin},
 		{"subscription_tier", entity.TierRealtime},
 	}}}
-	_, err = collection.UpdateMany(ctx, filter, update)
+	if _, err = collection.UpdateMany(ctx, filter, update); err != nil {
+		return err
+	}
+	if err = m.ensureTelegramUserIndex(ctx, collection); err != nil {
+		return fmt.Errorf("ensure telegram_id index: %w", err)
+	}
+	return nil
+}
+
+// ensureTelegramUserIndex creates a partial unique index on telegram_id so registration
+// cannot insert a second document for the same Telegram account. The partial filter
+// (telegram_id > 0) leaves API-only users, which carry no Telegram id, unconstrained.
+// Idempotent — re-creating an identical index is a no-op.
+func (m *MongoDB) ensureTelegramUserIndex(ctx context.Context, collection *mongo.Collection) error {
+	model := mongo.IndexModel{
+		Keys: bson.D{{"telegram_id", 1}},
+		Options: options.Index().
+			SetName("uniq_telegram_id").
+			SetUnique(true).
+			SetPartialFilterExpression(bson.D{{"telegram_id", bson.D{{"$gt", 0}}}}),
+	}
+	_, err := collection.Indexes().CreateOne(ctx, model)
 	return err
 }
 
@@ -1153,6 +1845,26 @@ func (m *MongoDB) ensureCheckoutParamsIndex(ctx context.Context, collection *mon
 	return err
 }
 
+// EnsureIdempotencyIndex creates the TTL index on expires_at that lets MongoDB drop
+// stored idempotent responses once they have expired. Idempotent — re-creating an
+// identical index is a no-op.
+func (m *MongoDB) EnsureIdempotencyIndex() error {
+	ctx, cancel := m.opCtx()
+	defer cancel()
+	connection, err := m.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer m.disconnect(ctx, connection)
+
+	collection := connection.Database(m.database).Collection(collectionIdempotency)
+	_, err = collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{"expires_at", 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	return err
+}
+
 // fillIfEmpty copies src into dst only when dst is empty and src is not, used to backfill
 // linkage fields during the checkout params dedupe without overwriting an existing value.
 func fillIfEmpty(dst *string, src string) {
@@ -0,0 +1,185 @@
+package database
+
+import (
+	"os"
+	"testing"
+	"time"
+	"wfsync/entity"
+	"wfsync/internal/config"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// TestBuildMongoURI covers the connection string combinations needed for local,
+// replica-set, TLS and Atlas (SRV) deployments.
+func TestBuildMongoURI(t *testing.T) {
+	cases := []struct {
+		name string
+		conf config.Mongo
+		want string
+	}{
+		{
+			name: "plain host and port",
+			conf: config.Mongo{Host: "127.0.0.1", Port: "27017"},
+			want: "mongodb://127.0.0.1:27017/",
+		},
+		{
+			name: "tls",
+			conf: config.Mongo{Host: "db.local", Port: "27017", TLS: true},
+			want: "mongodb://db.local:27017/?tls=true",
+		},
+		{
+			name: "replica set seed list keeps its own ports",
+			conf: config.Mongo{Host: "a:27017,b:27018", Port: "27017", ReplicaSet: "rs0"},
+			want: "mongodb://a:27017,b:27018/?replicaSet=rs0",
+		},
+		{
+			name: "srv ignores port",
+			conf: config.Mongo{Host: "cluster0.abc.mongodb.net", Port: "27017", SRV: true},
+			want: "mongodb+srv://cluster0.abc.mongodb.net/",
+		},
+		{
+			name: "srv with tls and extra options sorted",
+			conf: config.Mongo{
+				Host:    "cluster0.abc.mongodb.net",
+				SRV:     true,
+				TLS:     true,
+				Options: map[string]string{"w": "majority", "retryWrites": "true"},
+			},
+			want: "mongodb+srv://cluster0.abc.mongodb.net/?retryWrites=true&tls=true&w=majority",
+		},
+		{
+			name: "dedicated fields override options",
+			conf: config.Mongo{
+				Host:       "db.local",
+				Port:       "27017",
+				ReplicaSet: "rs1",
+				Options:    map[string]string{"replicaSet": "other"},
+			},
+			want: "mongodb://db.local:27017/?replicaSet=rs1",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := buildMongoURI(tc.conf)
+			if got != tc.want {
+				t.Fatalf("buildMongoURI() = %q, want %q", got, tc.want)
+			}
+			if tc.conf.SRV {
+				return // SRV parsing performs a DNS lookup
+			}
+			if err := options.Client().ApplyURI(got).Validate(); err != nil {
+				t.Errorf("driver rejected %q: %v", got, err)
+			}
+		})
+	}
+}
+
+// TestTelegramRegistrationUpdate guards the idempotency contract of RegisterTelegramUser:
+// a repeated /start may only refresh the Telegram handle, never the role or registration.
+func TestTelegramRegistrationUpdate(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	update := telegramRegistrationUpdate(42, "alice", now).Map()
+
+	onInsert, ok := update["$setOnInsert"].(bson.D)
+	if !ok {
+		t.Fatalf("$setOnInsert missing: %v", update)
+	}
+	set, ok := update["$set"].(bson.D)
+	if !ok {
+		t.Fatalf("$set missing: %v", update)
+	}
+
+	insertFields := onInsert.Map()
+	for _, key := range []string{"telegram_id", "telegram_role", "telegram_enabled", "registered_at", "subscription_tier"} {
+		if _, ok := insertFields[key]; !ok {
+			t.Errorf("%s must be set on insert", key)
+		}
+	}
+	if insertFields["telegram_role"] != entity.RolePending {
+		t.Errorf("telegram_role on insert = %v, want %v", insertFields["telegram_role"], entity.RolePending)
+	}
+
+	setFields := set.Map()
+	if len(setFields) != 1 || setFields["telegram_username"] != "alice" {
+		t.Errorf("$set = %v, want only telegram_username", setFields)
+	}
+}
+
+// TestArchiveFilter guards against the two "$or" conditions landing side by side in one
+// document, where the second would silently replace the first.
+func TestArchiveFilter(t *testing.T) {
+	filter := archiveFilter(time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC))
+	if len(filter) != 1 || filter[0].Key != "$and" {
+		t.Fatalf("filter = %v, want a single $and", filter)
+	}
+	conditions, ok := filter[0].Value.(bson.A)
+	if !ok || len(conditions) != 2 {
+		t.Fatalf("$and = %v, want two conditions", filter[0].Value)
+	}
+	for i, condition := range conditions {
+		doc, ok := condition.(bson.D)
+		if !ok || len(doc) != 1 || doc[0].Key != "$or" {
+			t.Errorf("condition %d = %v, want one $or", i, condition)
+		}
+	}
+}
+
+// TestRegisterTelegramUserIdempotent runs against a real MongoDB when
+// WFSYNC_TEST_MONGO_URI is set: registering twice must leave a single document, and a
+// later registration must not reset a role granted in between.
+func TestRegisterTelegramUserIdempotent(t *testing.T) {
+	uri := os.Getenv("WFSYNC_TEST_MONGO_URI")
+	if uri == "" || testing.Short() {
+		t.Skip("WFSYNC_TEST_MONGO_URI not set")
+	}
+	m := &MongoDB{
+		clientOptions: options.Client().ApplyURI(uri),
+		database:      "wfsync_test",
+	}
+	ctx, cancel := m.opCtx()
+	defer cancel()
+	connection, err := m.connect(ctx)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer m.disconnect(ctx, connection)
+	collection := connection.Database(m.database).Collection(collectionUsers)
+	_ = collection.Drop(ctx)
+	if err = m.ensureTelegramUserIndex(ctx, collection); err != nil {
+		t.Fatalf("ensure index: %v", err)
+	}
+
+	const id int64 = 1001
+	for i := 0; i < 2; i++ {
+		if err = m.RegisterTelegramUser(id, "alice"); err != nil {
+			t.Fatalf("register #%d: %v", i+1, err)
+		}
+	}
+	count, err := collection.CountDocuments(ctx, bson.D{{"telegram_id", id}})
+	if err != nil {
+		t.Fatalf("count: %v", err)
+	}
+	if count != 1 {
+		t.Fatalf("documents = %d, want 1", count)
+	}
+
+	if err = m.SetTelegramRole(id, entity.RoleAdmin); err != nil {
+		t.Fatalf("set role: %v", err)
+	}
+	if err = m.RegisterTelegramUser(id, "alice_new"); err != nil {
+		t.Fatalf("register again: %v", err)
+	}
+	user, err := m.GetTelegramUserById(id)
+	if err != nil || user == nil {
+		t.Fatalf("get user: %v", err)
+	}
+	if user.TelegramRole != entity.RoleAdmin {
+		t.Errorf("role = %v, want %v (must not be reset)", user.TelegramRole, entity.RoleAdmin)
+	}
+	if user.TelegramUsername != "alice_new" {
+		t.Errorf("telegram_username = %q, want refreshed handle", user.TelegramUsername)
+	}
+}
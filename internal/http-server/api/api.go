@@ -10,6 +10,11 @@ import (
 	"wfsync/internal/config"
 	"wfsync/internal/http-server/handlers/b2b"
 	"wfsync/internal/http-server/handlers/errors"
+	"wfsync/internal/http-server/handlers/features"
+	"wfsync/internal/http-server/handlers/files"
+	"wfsync/internal/http-server/handlers/health"
+	"wfsync/internal/http-server/handlers/ochook"
+	"wfsync/internal/http-server/handlers/openapi"
 	"wfsync/internal/http-server/handlers/payment"
 	"wfsync/internal/http-server/handlers/stripehandler"
 	"wfsync/internal/http-server/handlers/wfinvoice"
@@ -20,7 +25,10 @@ import (
 	"github.com/go-chi/render"
 
 	"wfsync/internal/http-server/middleware/authenticate"
+	"wfsync/internal/http-server/middleware/idempotency"
+	"wfsync/internal/http-server/middleware/ratelimit"
 	"wfsync/internal/http-server/middleware/timeout"
+	"wfsync/lib/clock"
 	"wfsync/lib/sl"
 )
 
@@ -37,6 +45,11 @@ type Handler interface {
 	wfsync.Core
 	payment.Core
 	b2b.Core
+	files.Core
+	ochook.Core
+	features.Core
+	health.Core
+	idempotency.Store
 }
 
 func New(conf *config.Config, log *slog.Logger, handler Handler) (*Server, error) {
@@ -45,6 +58,44 @@ func New(conf *config.Config, log *slog.Logger, handler Handler) (*Server, error
 		log:  log.With(sl.Module("api.server")),
 	}
 
+	router := newRouter(conf, log, handler)
+
+	// The document describes the routes above; /openapi.json itself is not part of it.
+	doc, err := openapi.Build(openapi.Info{Title: "wfsync API", Version: "v1"}, router, operations)
+	if err != nil {
+		server.log.Warn("openapi document incomplete", sl.Err(err))
+	}
+	router.Get("/openapi.json", openapi.Serve(log, doc))
+
+	httpLog := slog.NewLogLogger(log.Handler(), slog.LevelError)
+	server.httpServer = &http.Server{
+		Handler:      router,
+		ErrorLog:     httpLog,
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: 65 * time.Second, // must exceed the context deadline (60s) to avoid premature connection close
+		IdleTimeout:  60 * time.Second,
+	}
+
+	serverAddress := fmt.Sprintf("%s:%s", conf.Listen.BindIp, conf.Listen.Port)
+	listener, err := net.Listen("tcp", serverAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	server.log.Info("starting api server", slog.String("address", serverAddress))
+
+	go func() {
+		if err := server.httpServer.Serve(listener); err != nil && err != http.ErrServerClosed {
+			server.log.Error("http server error", sl.Err(err))
+		}
+	}()
+
+	return server, nil
+}
+
+// newRouter registers the API routes. Kept apart from New so the route table can be
+// walked without starting a listener.
+func newRouter(conf *config.Config, log *slog.Logger, handler Handler) chi.Router {
 	router := chi.NewRouter()
 	router.Use(timeout.Timeout(60 * time.Second)) // wfirma requests need long timeouts
 	router.Use(middleware.RequestID)
@@ -56,20 +107,26 @@ func New(conf *config.Config, log *slog.Logger, handler Handler) (*Server, error
 
 	router.Route("/v1", func(rootApi chi.Router) {
 		rootApi.Use(authenticate.New(log, handler))
+		rootApi.Use(ratelimit.New(log, ratelimit.NewLimiter(conf.Listen.RateLimitPerMin, conf.Listen.RateLimitBurst, clock.Real)))
 		rootApi.Route("/wf", func(wf chi.Router) {
 			wf.Get("/invoice/{id}", wfinvoice.Download(log, handler))
 			wf.Get("/order/{id}", wfinvoice.OrderToInvoice(log, handler))
+			wf.Get("/order/{id}/redownload", wfinvoice.RedownloadInvoice(log, handler))
 			wf.Get("/file/proforma/{id}", wfinvoice.FileProforma(log, handler))
 			wf.Get("/file/invoice/{id}", wfinvoice.FileInvoice(log, handler))
 			wf.Post("/proforma", wfinvoice.CreateProforma(log, handler))
 			wf.Post("/invoice", wfinvoice.CreateInvoice(log, handler))
+			wf.Post("/draft", wfinvoice.DraftInvoice(log, handler))
+			wf.Post("/draft/{id}/issue", wfinvoice.IssueInvoice(log, handler))
 			wf.Post("/sync/pull", wfsync.SyncFromRemote(log, handler))
 			wf.Post("/sync/push", wfsync.SyncToRemote(log, handler))
 			wf.Get("/list", wfsync.InvoiceList(log, handler))
 		})
 		rootApi.Route("/st", func(st chi.Router) {
-			st.Post("/hold", payment.Hold(log, handler))
-			st.Post("/pay", payment.Pay(log, handler))
+			// Retried session requests replay the first response instead of opening another session.
+			idem := idempotency.New(log, handler, time.Duration(conf.Listen.IdempotencyTTLMin)*time.Minute)
+			st.With(idem).Post("/hold", payment.Hold(log, handler, conf.TotalTolerance))
+			st.With(idem).Post("/pay", payment.Pay(log, handler, conf.TotalTolerance))
 			st.Post("/capture/{id}", payment.Capture(log, handler))
 			st.Post("/cancel/{id}", payment.Cancel(log, handler))
 			st.Get("/status/{id}", payment.Status(log, handler))
@@ -78,36 +135,23 @@ func New(conf *config.Config, log *slog.Logger, handler Handler) (*Server, error
 		rootApi.Route("/b2b", func(b2bRouter chi.Router) {
 			b2bRouter.Post("/proforma", b2b.CreateProforma(log, handler))
 			b2bRouter.Post("/invoice", b2b.CreateInvoice(log, handler))
+			b2bRouter.Post("/invoices/batch", b2b.CreateInvoiceBatch(log, handler, conf.B2B.BatchMaxOrders))
 		})
+		rootApi.Get("/features", features.List(log, handler))
+		rootApi.Put("/features/{name}", features.Set(log, handler))
 	})
+	router.Get("/health", health.Check(log, handler))
+	router.Get("/livez", health.Live())
+	router.Get("/readyz", health.Ready(log, handler))
+	// Signed document links carry their own credential, so they bypass bearer auth.
+	router.Get("/files/{name}", files.Serve(log, handler))
 	router.Route("/webhook", func(rootWH chi.Router) {
 		rootWH.Post("/event", stripehandler.Event(log, handler))
+		// Store modules authenticate with a bearer token like /v1 clients.
+		rootWH.With(authenticate.New(log, handler)).Post("/opencart", ochook.OrderEvent(log, handler))
 	})
 
-	httpLog := slog.NewLogLogger(log.Handler(), slog.LevelError)
-	server.httpServer = &http.Server{
-		Handler:      router,
-		ErrorLog:     httpLog,
-		ReadTimeout:  5 * time.Second,
-		WriteTimeout: 65 * time.Second, // must exceed the context deadline (60s) to avoid premature connection close
-		IdleTimeout:  60 * time.Second,
-	}
-
-	serverAddress := fmt.Sprintf("%s:%s", conf.Listen.BindIp, conf.Listen.Port)
-	listener, err := net.Listen("tcp", serverAddress)
-	if err != nil {
-		return nil, err
-	}
-
-	server.log.Info("starting api server", slog.String("address", serverAddress))
-
-	go func() {
-		if err := server.httpServer.Serve(listener); err != nil && err != http.ErrServerClosed {
-			server.log.Error("http server error", sl.Err(err))
-		}
-	}()
-
-	return server, nil
+	return router
 }
 
 func (s *Server) Shutdown(ctx context.Context) error {
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"net/http"
+	"wfsync/entity"
+	"wfsync/internal/http-server/handlers/b2b"
+	"wfsync/internal/http-server/handlers/openapi"
+)
+
+var dateRange = []openapi.Param{
+	{Name: "from", Description: "Start date, YYYY-MM-DD", Required: true},
+	{Name: "to", Description: "End date, YYYY-MM-DD", Required: true},
+}
+
+// operations documents every route of newRouter for GET /openapi.json. Add an entry
+// with each new route; TestOpenAPICoversRoutes fails on a route without one.
+var operations = []openapi.Operation{
+	{Method: http.MethodGet, Path: "/v1/wf/invoice/{id}", Tag: "wfirma", Produces: "application/pdf",
+		Summary: "Download a wFirma invoice PDF"},
+	{Method: http.MethodGet, Path: "/v1/wf/order/{id}", Tag: "wfirma", Response: entity.CheckoutParams{},
+		Summary: "Register the invoice of an OpenCart order",
+		Query:   []openapi.Param{{Name: "current_date", Description: "\"false\" keeps the order date as the invoice date"}}},
+	{Method: http.MethodGet, Path: "/v1/wf/order/{id}/redownload", Tag: "wfirma", Response: entity.Payment{},
+		Summary: "Download the invoice PDF of an order again"},
+	{Method: http.MethodGet, Path: "/v1/wf/file/proforma/{id}", Tag: "wfirma", Response: entity.Payment{},
+		Summary: "Create the proforma file of an OpenCart order"},
+	{Method: http.MethodGet, Path: "/v1/wf/file/invoice/{id}", Tag: "wfirma", Response: entity.Payment{},
+		Summary: "Create the invoice file of an OpenCart order"},
+	{Method: http.MethodPost, Path: "/v1/wf/proforma", Tag: "wfirma", Request: entity.CheckoutParams{}, Response: entity.Payment{},
+		Summary: "Create a proforma"},
+	{Method: http.MethodPost, Path: "/v1/wf/invoice", Tag: "wfirma", Request: entity.CheckoutParams{}, Response: entity.Payment{},
+		Summary: "Create an invoice"},
+	{Method: http.MethodPost, Path: "/v1/wf/draft", Tag: "wfirma", Request: entity.CheckoutParams{}, Response: entity.CheckoutParams{},
+		Summary: "Store an invoice draft for review; posting it again replaces it"},
+	{Method: http.MethodPost, Path: "/v1/wf/draft/{id}/issue", Tag: "wfirma", Response: entity.Payment{},
+		Summary: "Register the invoice draft of an order"},
+	{Method: http.MethodPost, Path: "/v1/wf/sync/pull", Tag: "wfirma", Response: entity.SyncResult{}, Query: dateRange,
+		Summary: "Pull invoices from wFirma into the local database"},
+	{Method: http.MethodPost, Path: "/v1/wf/sync/push", Tag: "wfirma", Response: entity.SyncResult{}, Query: dateRange,
+		Summary: "Push local invoices to wFirma"},
+	{Method: http.MethodGet, Path: "/v1/wf/list", Tag: "wfirma", Response: []*entity.InvoiceListItem{},
+		Summary: "List invoices from wFirma, OpenCart and the local database",
+		Query: []openapi.Param{
+			dateRange[0], dateRange[1],
+			{Name: "format", Description: "\"csv\" returns text/csv instead of JSON"},
+		}},
+
+	{Method: http.MethodPost, Path: "/v1/st/hold", Tag: "stripe", Request: entity.CheckoutParams{}, Response: entity.Payment{},
+		Summary: "Create a manual-capture checkout session"},
+	{Method: http.MethodPost, Path: "/v1/st/pay", Tag: "stripe", Request: entity.CheckoutParams{}, Response: entity.Payment{},
+		Summary: "Create a checkout session for immediate payment"},
+	{Method: http.MethodPost, Path: "/v1/st/capture/{id}", Tag: "stripe", Request: entity.CheckoutParams{}, Response: entity.Payment{},
+		Summary: "Capture a held payment by checkout session id"},
+	{Method: http.MethodPost, Path: "/v1/st/cancel/{id}", Tag: "stripe", Response: entity.Payment{},
+		Summary: "Cancel a held payment by checkout session id",
+		Query:   []openapi.Param{{Name: "reason", Description: "Stripe cancellation reason"}}},
+	{Method: http.MethodGet, Path: "/v1/st/status/{id}", Tag: "stripe", Response: entity.PaymentStatus{},
+		Summary: "Live Stripe payment state of an order"},
+	{Method: http.MethodGet, Path: "/v1/st/queue", Tag: "stripe", Response: []*entity.HeldPaymentSummary{},
+		Summary: "Held payments awaiting reconciliation"},
+
+	{Method: http.MethodPost, Path: "/v1/b2b/proforma", Tag: "b2b", Request: entity.B2BOrder{},
+		Bare: true, Response: b2b.URLResponse{}, Error: b2b.ErrorResponse{},
+		Summary: "Create a proforma for a B2B order"},
+	{Method: http.MethodPost, Path: "/v1/b2b/invoice", Tag: "b2b", Request: entity.B2BOrder{},
+		Bare: true, Response: b2b.URLResponse{}, Error: b2b.ErrorResponse{},
+		Summary: "Create an invoice for a B2B order"},
+	{Method: http.MethodPost, Path: "/v1/b2b/invoices/batch", Tag: "b2b", Request: []*entity.B2BOrder{},
+		Bare: true, Response: b2b.BatchResponse{}, Error: b2b.ErrorResponse{},
+		Summary: "Create the invoices of several B2B orders; each order gets its own result"},
+
+	{Method: http.MethodGet, Path: "/v1/features", Tag: "features", Response: []*entity.FeatureFlag{},
+		Summary: "Runtime state of the subsystem feature flags (admin)"},
+	{Method: http.MethodPut, Path: "/v1/features/{name}", Tag: "features", Request: entity.FeatureFlagRequest{}, Response: entity.FeatureFlag{},
+		Summary: "Switch a subsystem on or off at runtime (admin)"},
+
+	{Method: http.MethodGet, Path: "/health", Tag: "health", Public: true,
+		Bare: true, Response: entity.HealthStatus{}, Error: entity.HealthStatus{},
+		Summary: "Status of the service and its subsystems; 503 when a required one is down"},
+	{Method: http.MethodGet, Path: "/livez", Tag: "health", Public: true,
+		Bare: true, Response: entity.HealthStatus{},
+		Summary: "Liveness: 200 while the process serves requests"},
+	{Method: http.MethodGet, Path: "/readyz", Tag: "health", Public: true,
+		Bare: true, Response: entity.HealthStatus{}, Error: entity.HealthStatus{},
+		Summary: "Readiness: 503 while any enabled subsystem is down"},
+
+	{Method: http.MethodGet, Path: "/files/{name}", Tag: "files", Produces: "application/pdf", Public: true,
+		Summary: "Download a document through a signed link",
+		Query: []openapi.Param{
+			{Name: "expires", Description: "Link expiry, unix seconds", Required: true},
+			{Name: "sig", Description: "Link signature", Required: true},
+		}},
+	{Method: http.MethodPost, Path: "/webhook/opencart", Tag: "webhook", Request: entity.OpenCartEvent{},
+		Response: entity.OpenCartEventResult{},
+		Summary:  "Run an order's job now; sent by the OpenCart store module"},
+	{Method: http.MethodPost, Path: "/webhook/event", Tag: "webhook", Bare: true, Public: true,
+		Summary: "Stripe webhook; verified by the Stripe-Signature header"},
+}
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"wfsync/internal/config"
+	"wfsync/internal/http-server/handlers/openapi"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// TestOpenAPICoversRoutes builds the document from the real router: every served route
+// must be documented, and the document must be internally consistent — each $ref
+// resolves, each path parameter is declared and each operation has a response.
+func TestOpenAPICoversRoutes(t *testing.T) {
+	router := newRouter(&config.Config{}, slog.New(slog.NewTextHandler(io.Discard, nil)), nil)
+	doc, err := openapi.Build(openapi.Info{Title: "wfsync API", Version: "v1"}, router, operations)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	if doc.OpenAPI != openapi.Version {
+		t.Errorf("openapi = %q, want %q", doc.OpenAPI, openapi.Version)
+	}
+
+	_ = chi.Walk(router, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		if doc.Paths[route][strings.ToLower(method)] == nil {
+			t.Errorf("route %s %s missing from the document", method, route)
+		}
+		return nil
+	})
+
+	raw, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var generic struct {
+		Paths      map[string]map[string]map[string]any `json:"paths"`
+		Components struct {
+			Schemas map[string]any `json:"schemas"`
+		} `json:"components"`
+	}
+	if err = json.Unmarshal(raw, &generic); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	for _, ref := range regexp.MustCompile(`"\$ref":"#/components/schemas/([^"]+)"`).FindAllStringSubmatch(string(raw), -1) {
+		if _, ok := generic.Components.Schemas[ref[1]]; !ok {
+			t.Errorf("unresolved $ref %s", ref[1])
+		}
+	}
+
+	for path, methods := range generic.Paths {
+		for method, op := range methods {
+			if responses, _ := op["responses"].(map[string]any); len(responses) == 0 {
+				t.Errorf("%s %s has no responses", method, path)
+			}
+			declared := map[string]bool{}
+			params, _ := op["parameters"].([]any)
+			for _, p := range params {
+				if p, ok := p.(map[string]any); ok && p["in"] == "path" {
+					declared[p["name"].(string)] = true
+				}
+			}
+			for _, m := range regexp.MustCompile(`\{([^}]+)}`).FindAllStringSubmatch(path, -1) {
+				if !declared[m[1]] {
+					t.Errorf("%s %s does not declare path parameter %q", method, path, m[1])
+				}
+			}
+		}
+	}
+}
+
+// TestOpenAPIReportsUndocumentedRoutes checks that Build names routes missing from the
+// operation list and operations no route serves.
+func TestOpenAPIReportsUndocumentedRoutes(t *testing.T) {
+	router := chi.NewRouter()
+	router.Get("/v1/new/{id}", func(http.ResponseWriter, *http.Request) {})
+
+	ops := []openapi.Operation{{Method: http.MethodGet, Path: "/v1/gone", Summary: "Removed"}}
+	doc, err := openapi.Build(openapi.Info{Title: "test", Version: "v1"}, router, ops)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, want := range []string{"GET /v1/new/{id}", "GET /v1/gone"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not name %s", err, want)
+		}
+	}
+	if doc.Paths["/v1/new/{id}"]["get"] == nil {
+		t.Error("undocumented route should still be listed")
+	}
+}
+
+// TestOpenAPIServe checks the document is served as JSON.
+func TestOpenAPIServe(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	doc, _ := openapi.Build(openapi.Info{Title: "wfsync API", Version: "v1"}, newRouter(&config.Config{}, log, nil), operations)
+
+	rec := httptest.NewRecorder()
+	openapi.Serve(log, doc)(rec, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d", rec.Code)
+	}
+	var got map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("body is not JSON: %v", err)
+	}
+	if got["openapi"] != openapi.Version {
+		t.Errorf("openapi = %v", got["openapi"])
+	}
+}
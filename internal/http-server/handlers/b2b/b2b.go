@@ -9,6 +9,7 @@ import (
 	"wfsync/entity"
 	"wfsync/lib/api/cont"
 	"wfsync/lib/sl"
+	"wfsync/lib/validate"
 
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/render"
@@ -17,19 +18,22 @@ import (
 type Core interface {
 	B2BCreateProforma(ctx context.Context, order *entity.B2BOrder) (*entity.Payment, error)
 	B2BCreateInvoice(ctx context.Context, order *entity.B2BOrder) (*entity.Payment, error)
+	B2BCreateInvoices(ctx context.Context, orders []*entity.B2BOrder) []entity.B2BBatchOutcome
 }
 
-// urlResponse carries the URL of the first generated document plus the full list.
+// URLResponse carries the URL of the first generated document plus the full list.
 // URL stays for backward compatibility with clients that read a single field;
 // URLs is the authoritative list and contains every part when the order was
 // split across multiple wFirma invoices (and a single entry otherwise).
-type urlResponse struct {
+type URLResponse struct {
 	URL  string   `json:"url"`
 	URLs []string `json:"urls"`
+	// FileData is the base64 PDF of the first document, present only for include_pdf requests.
+	FileData string `json:"file_data,omitempty"`
 }
 
 // buildURLResponse extracts the URL list from a payment, including all split parts.
-func buildURLResponse(payment *entity.Payment) urlResponse {
+func buildURLResponse(payment *entity.Payment) URLResponse {
 	urls := []string{payment.Link}
 	if len(payment.Parts) > 1 {
 		urls = urls[:0]
@@ -40,11 +44,14 @@ func buildURLResponse(payment *entity.Payment) urlResponse {
 			urls = append(urls, part.Link)
 		}
 	}
-	return urlResponse{URL: payment.Link, URLs: urls}
+	return URLResponse{URL: payment.Link, URLs: urls, FileData: payment.FileData}
 }
 
-type errorResponse struct {
+// ErrorResponse is the body of a failed B2B request.
+type ErrorResponse struct {
 	Error string `json:"error"`
+	// Fields lists the per-field failures when the request body failed validation.
+	Fields validate.Errors `json:"fields,omitempty"`
 }
 
 func CreateProforma(logger *slog.Logger, handler Core) http.HandlerFunc {
@@ -60,21 +67,21 @@ func CreateProforma(logger *slog.Logger, handler Core) http.HandlerFunc {
 		if user == nil {
 			log.Error("user not found")
 			render.Status(r, 401)
-			render.JSON(w, r, errorResponse{Error: "User not found"})
+			render.JSON(w, r, ErrorResponse{Error: "User not found"})
 			return
 		}
 
 		if !user.WFirmaAllowInvoice {
 			log.Error("invoice not allowed")
 			render.Status(r, 403)
-			render.JSON(w, r, errorResponse{Error: "Invoice not allowed"})
+			render.JSON(w, r, ErrorResponse{Error: "Invoice not allowed"})
 			return
 		}
 
 		if handler == nil {
 			log.Error("b2b service not available")
 			render.Status(r, 500)
-			render.JSON(w, r, errorResponse{Error: "B2B service not available"})
+			render.JSON(w, r, ErrorResponse{Error: "B2B service not available"})
 			return
 		}
 
@@ -82,7 +89,7 @@ func CreateProforma(logger *slog.Logger, handler Core) http.HandlerFunc {
 		if err := render.Bind(r, &order); err != nil {
 			log.Warn("invalid request body", sl.Err(err))
 			render.Status(r, 400)
-			render.JSON(w, r, errorResponse{Error: fmt.Sprintf("Invalid request: %v", err)})
+			render.JSON(w, r, ErrorResponse{Error: fmt.Sprintf("Invalid request: %v", err), Fields: validate.Fields(err)})
 			return
 		}
 
@@ -90,15 +97,15 @@ func CreateProforma(logger *slog.Logger, handler Core) http.HandlerFunc {
 
 		payment, err := handler.B2BCreateProforma(r.Context(), &order)
 		if err != nil {
-			if errors.Is(err, entity.ErrVATRateMismatch) {
-				log.Warn("proforma vat rate mismatch", sl.Err(err))
+			if errors.Is(err, entity.ErrVATRateMismatch) || errors.Is(err, entity.ErrCallbackUnsigned) {
+				log.Warn("proforma order rejected", sl.Err(err))
 				render.Status(r, 400)
-				render.JSON(w, r, errorResponse{Error: err.Error()})
+				render.JSON(w, r, ErrorResponse{Error: err.Error()})
 				return
 			}
 			log.Error("proforma creation", sl.Err(err))
 			render.Status(r, 500)
-			render.JSON(w, r, errorResponse{Error: fmt.Sprintf("Request failed: %v", err)})
+			render.JSON(w, r, ErrorResponse{Error: fmt.Sprintf("Request failed: %v", err)})
 			return
 		}
 		log.With(
@@ -122,21 +129,21 @@ func CreateInvoice(logger *slog.Logger, handler Core) http.HandlerFunc {
 		if user == nil {
 			log.Error("user not found")
 			render.Status(r, 401)
-			render.JSON(w, r, errorResponse{Error: "User not found"})
+			render.JSON(w, r, ErrorResponse{Error: "User not found"})
 			return
 		}
 
 		if !user.WFirmaAllowInvoice {
 			log.Error("invoice not allowed")
 			render.Status(r, 403)
-			render.JSON(w, r, errorResponse{Error: "Invoice not allowed"})
+			render.JSON(w, r, ErrorResponse{Error: "Invoice not allowed"})
 			return
 		}
 
 		if handler == nil {
 			log.Error("b2b service not available")
 			render.Status(r, 500)
-			render.JSON(w, r, errorResponse{Error: "B2B service not available"})
+			render.JSON(w, r, ErrorResponse{Error: "B2B service not available"})
 			return
 		}
 
@@ -144,7 +151,7 @@ func CreateInvoice(logger *slog.Logger, handler Core) http.HandlerFunc {
 		if err := render.Bind(r, &order); err != nil {
 			log.Warn("invalid request body", sl.Err(err))
 			render.Status(r, 400)
-			render.JSON(w, r, errorResponse{Error: fmt.Sprintf("Invalid request: %v", err)})
+			render.JSON(w, r, ErrorResponse{Error: fmt.Sprintf("Invalid request: %v", err), Fields: validate.Fields(err)})
 			return
 		}
 
@@ -152,15 +159,15 @@ func CreateInvoice(logger *slog.Logger, handler Core) http.HandlerFunc {
 
 		payment, err := handler.B2BCreateInvoice(r.Context(), &order)
 		if err != nil {
-			if errors.Is(err, entity.ErrVATRateMismatch) {
-				log.Warn("invoice vat rate mismatch", sl.Err(err))
+			if errors.Is(err, entity.ErrVATRateMismatch) || errors.Is(err, entity.ErrCallbackUnsigned) {
+				log.Warn("invoice order rejected", sl.Err(err))
 				render.Status(r, 400)
-				render.JSON(w, r, errorResponse{Error: err.Error()})
+				render.JSON(w, r, ErrorResponse{Error: err.Error()})
 				return
 			}
 			log.Error("invoice creation", sl.Err(err))
 			render.Status(r, 500)
-			render.JSON(w, r, errorResponse{Error: fmt.Sprintf("Request failed: %v", err)})
+			render.JSON(w, r, ErrorResponse{Error: fmt.Sprintf("Request failed: %v", err)})
 			return
 		}
 		log.With(
@@ -170,3 +177,129 @@ func CreateInvoice(logger *slog.Logger, handler Core) http.HandlerFunc {
 		render.JSON(w, r, buildURLResponse(payment))
 	}
 }
+
+// BatchResult is the outcome of one order of a batch request. On success it carries the
+// document URLs like URLResponse, otherwise the error.
+type BatchResult struct {
+	OrderUID    string          `json:"order_uid"`
+	OrderNumber string          `json:"order_number"`
+	Success     bool            `json:"success"`
+	URL         string          `json:"url,omitempty"`
+	URLs        []string        `json:"urls,omitempty"`
+	FileData    string          `json:"file_data,omitempty"`
+	Error       string          `json:"error,omitempty"`
+	Fields      validate.Errors `json:"fields,omitempty"`
+}
+
+// BatchResponse lists the results of a batch request in the order of the request.
+type BatchResponse struct {
+	Succeeded int           `json:"succeeded"`
+	Failed    int           `json:"failed"`
+	Results   []BatchResult `json:"results"`
+}
+
+// CreateInvoiceBatch creates the invoices of an array of B2B orders. Each order is
+// validated and invoiced on its own, so an invalid or failing order is reported in its
+// result and does not abort the batch. The batch holds at most maxOrders orders.
+func CreateInvoiceBatch(logger *slog.Logger, handler Core, maxOrders int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		mod := sl.Module("http.handlers.b2b")
+
+		log := logger.With(
+			mod,
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		user := cont.GetUser(r.Context())
+		if user == nil {
+			log.Error("user not found")
+			render.Status(r, 401)
+			render.JSON(w, r, ErrorResponse{Error: "User not found"})
+			return
+		}
+
+		if !user.WFirmaAllowInvoice {
+			log.Error("invoice not allowed")
+			render.Status(r, 403)
+			render.JSON(w, r, ErrorResponse{Error: "Invoice not allowed"})
+			return
+		}
+
+		if handler == nil {
+			log.Error("b2b service not available")
+			render.Status(r, 500)
+			render.JSON(w, r, ErrorResponse{Error: "B2B service not available"})
+			return
+		}
+
+		var orders []*entity.B2BOrder
+		if err := render.DecodeJSON(r.Body, &orders); err != nil {
+			log.Warn("invalid request body", sl.Err(err))
+			render.Status(r, 400)
+			render.JSON(w, r, ErrorResponse{Error: fmt.Sprintf("Invalid request: %v", err)})
+			return
+		}
+		if len(orders) == 0 {
+			render.Status(r, 400)
+			render.JSON(w, r, ErrorResponse{Error: "Invalid request: no orders"})
+			return
+		}
+		if maxOrders > 0 && len(orders) > maxOrders {
+			log.Warn("batch too large", slog.Int("orders", len(orders)))
+			render.Status(r, 400)
+			render.JSON(w, r, ErrorResponse{Error: fmt.Sprintf("Invalid request: %d orders, at most %d per batch", len(orders), maxOrders)})
+			return
+		}
+
+		results := make([]BatchResult, len(orders))
+		var valid []*entity.B2BOrder
+		var validIdx []int
+		for i, order := range orders {
+			if order == nil {
+				results[i] = BatchResult{Error: "Invalid request: empty order"}
+				continue
+			}
+			results[i] = BatchResult{OrderUID: order.OrderUID, OrderNumber: order.OrderNumber}
+			if err := order.Bind(r); err != nil {
+				results[i].Error = fmt.Sprintf("Invalid request: %v", err)
+				results[i].Fields = validate.Fields(err)
+				continue
+			}
+			valid = append(valid, order)
+			validIdx = append(validIdx, i)
+		}
+
+		if len(valid) > 0 {
+			for j, outcome := range handler.B2BCreateInvoices(r.Context(), valid) {
+				result := &results[validIdx[j]]
+				if outcome.Err != nil {
+					result.Error = fmt.Sprintf("Request failed: %v", outcome.Err)
+					if errors.Is(outcome.Err, entity.ErrVATRateMismatch) || errors.Is(outcome.Err, entity.ErrCallbackUnsigned) ||
+						errors.Is(outcome.Err, entity.ErrBatchTimeLimit) {
+						result.Error = outcome.Err.Error()
+					}
+					continue
+				}
+				urls := buildURLResponse(outcome.Payment)
+				result.Success = true
+				result.URL, result.URLs, result.FileData = urls.URL, urls.URLs, urls.FileData
+			}
+		}
+
+		response := BatchResponse{Results: results}
+		for _, result := range results {
+			if result.Success {
+				response.Succeeded++
+			} else {
+				response.Failed++
+			}
+		}
+		log.With(
+			slog.Int("orders", len(orders)),
+			slog.Int("succeeded", response.Succeeded),
+			slog.Int("failed", response.Failed),
+		).Info("b2b invoice batch processed")
+
+		render.JSON(w, r, response)
+	}
+}
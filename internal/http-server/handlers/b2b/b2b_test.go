@@ -0,0 +1,108 @@
+package b2b
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"wfsync/entity"
+	"wfsync/lib/api/cont"
+)
+
+// batchCore invoices batch orders, failing the order numbers in fail.
+type batchCore struct {
+	Core
+	fail map[string]bool
+	got  []string
+}
+
+func (f *batchCore) B2BCreateInvoices(_ context.Context, orders []*entity.B2BOrder) []entity.B2BBatchOutcome {
+	outcomes := make([]entity.B2BBatchOutcome, len(orders))
+	for i, order := range orders {
+		f.got = append(f.got, order.OrderNumber)
+		if f.fail[order.OrderNumber] {
+			outcomes[i].Err = errors.New("wfirma 500")
+			continue
+		}
+		outcomes[i].Payment = &entity.Payment{Link: "https://files.example.com/" + order.OrderNumber + ".pdf"}
+	}
+	return outcomes
+}
+
+func batchOrderJSON(number string) string {
+	return `{"order_uid":"uid-` + number + `","order_number":"` + number + `","client_name":"Firma",` +
+		`"client_email":"firma@example.com","client_country":"DE","total":100,"currency_code":"EUR",` +
+		`"items":[{"product_name":"Book","quantity":1,"price":100}]}`
+}
+
+// TestCreateInvoiceBatchMixed posts a batch with a valid order, an order that fails in
+// core and an order that fails validation: only valid orders reach core, and each order
+// gets its own result in request order.
+func TestCreateInvoiceBatchMixed(t *testing.T) {
+	invalid := `{"order_uid":"uid-B-3","order_number":"B-3","client_name":"Firma","client_email":"not-an-email",` +
+		`"client_country":"DE","total":100,"currency_code":"EUR","items":[{"product_name":"Book","quantity":1,"price":100}]}`
+	body := "[" + batchOrderJSON("B-1") + "," + batchOrderJSON("B-2") + "," + invalid + "]"
+
+	core := &batchCore{fail: map[string]bool{"B-2": true}}
+	r := httptest.NewRequest(http.MethodPost, "/v1/b2b/invoices/batch", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	r = r.WithContext(cont.PutUser(r.Context(), &entity.User{Username: "portal", WFirmaAllowInvoice: true}))
+	rec := httptest.NewRecorder()
+	CreateInvoiceBatch(slog.New(slog.NewTextHandler(io.Discard, nil)), core, 10)(rec, r)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 (%s)", rec.Code, rec.Body)
+	}
+	var resp BatchResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if strings.Join(core.got, ",") != "B-1,B-2" {
+		t.Errorf("core got %v, want the valid orders B-1,B-2", core.got)
+	}
+	if resp.Succeeded != 1 || resp.Failed != 2 || len(resp.Results) != 3 {
+		t.Fatalf("response = %+v, want 1 succeeded and 2 failed of 3", resp)
+	}
+	if ok := resp.Results[0]; !ok.Success || ok.OrderNumber != "B-1" || ok.URL != "https://files.example.com/B-1.pdf" {
+		t.Errorf("results[0] = %+v, want B-1 with its link", ok)
+	}
+	if failed := resp.Results[1]; failed.Success || failed.OrderNumber != "B-2" || !strings.Contains(failed.Error, "wfirma 500") {
+		t.Errorf("results[1] = %+v, want the B-2 core error", failed)
+	}
+	if bad := resp.Results[2]; bad.Success || bad.OrderNumber != "B-3" || len(bad.Fields) == 0 {
+		t.Errorf("results[2] = %+v, want the B-3 validation fields", bad)
+	}
+}
+
+// TestCreateInvoiceBatchLimits refuses empty and oversized batches before calling core.
+func TestCreateInvoiceBatchLimits(t *testing.T) {
+	cases := []struct {
+		name string
+		body string
+	}{
+		{"empty", "[]"},
+		{"too many", "[" + batchOrderJSON("B-1") + "," + batchOrderJSON("B-2") + "," + batchOrderJSON("B-3") + "]"},
+		{"not an array", batchOrderJSON("B-1")},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			core := &batchCore{}
+			r := httptest.NewRequest(http.MethodPost, "/v1/b2b/invoices/batch", strings.NewReader(tc.body))
+			r = r.WithContext(cont.PutUser(r.Context(), &entity.User{Username: "portal", WFirmaAllowInvoice: true}))
+			rec := httptest.NewRecorder()
+			CreateInvoiceBatch(slog.New(slog.NewTextHandler(io.Discard, nil)), core, 2)(rec, r)
+
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want 400", rec.Code)
+			}
+			if len(core.got) != 0 {
+				t.Errorf("core called with %v", core.got)
+			}
+		})
+	}
+}
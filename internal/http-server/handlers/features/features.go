@@ -0,0 +1,88 @@
+package features
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"wfsync/entity"
+	"wfsync/lib/api/cont"
+	"wfsync/lib/api/response"
+	"wfsync/lib/sl"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+)
+
+type Core interface {
+	FeatureFlags() []*entity.FeatureFlag
+	SetFeatureFlag(ctx context.Context, name string, enabled bool) (*entity.FeatureFlag, error)
+}
+
+// List returns the runtime state of every subsystem. Admin users only.
+func List(log *slog.Logger, handler Core) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := log.With(
+			sl.Module("http.handlers.features"),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+
+		if !requireAdmin(w, r, logger) {
+			return
+		}
+
+		render.JSON(w, r, response.Ok(handler.FeatureFlags()))
+	}
+}
+
+// Set switches a subsystem on or off. Admin users only.
+func Set(log *slog.Logger, handler Core) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := chi.URLParam(r, "name")
+		logger := log.With(
+			sl.Module("http.handlers.features"),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			slog.String("feature", name),
+		)
+
+		if !requireAdmin(w, r, logger) {
+			return
+		}
+
+		var req entity.FeatureFlagRequest
+		if err := render.Bind(r, &req); err != nil {
+			logger.Error("bind request", sl.Err(err))
+			render.Status(r, 400)
+			render.JSON(w, r, response.Invalid(fmt.Sprintf("Invalid request: %v", err), err))
+			return
+		}
+
+		flag, err := handler.SetFeatureFlag(r.Context(), name, *req.Enabled)
+		if err != nil {
+			logger.Error("set feature flag", sl.Err(err))
+			if errors.Is(err, entity.ErrUnknownFeature) {
+				render.Status(r, 404)
+			} else {
+				render.Status(r, 500)
+			}
+			render.JSON(w, r, response.Error(fmt.Sprintf("Feature: %v", err)))
+			return
+		}
+
+		render.JSON(w, r, response.Ok(flag))
+	}
+}
+
+// requireAdmin answers 403 unless the request was authenticated as an admin user.
+func requireAdmin(w http.ResponseWriter, r *http.Request, logger *slog.Logger) bool {
+	user := cont.GetUser(r.Context())
+	if user.IsAdmin() {
+		return true
+	}
+	logger.With(slog.String("user", user.Username)).Warn("feature flags: admin access required")
+	render.Status(r, 403)
+	render.JSON(w, r, response.Error("Admin access required"))
+	return false
+}
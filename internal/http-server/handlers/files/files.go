@@ -0,0 +1,72 @@
+package files
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"wfsync/entity"
+	"wfsync/lib/api/response"
+	"wfsync/lib/sl"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+)
+
+type Core interface {
+	OpenSignedFile(fileName, expires, sig string) (*os.File, error)
+}
+
+// Serve delivers a document behind a signed link. The signature is the only credential,
+// so the route sits outside the bearer-token API; every failure is answered without
+// revealing whether the file exists.
+func Serve(logger *slog.Logger, handler Core) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		mod := sl.Module("http.handlers.files")
+		name := chi.URLParam(r, "name")
+
+		log := logger.With(
+			mod,
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			slog.String("file", name),
+		)
+
+		if handler == nil {
+			log.Error("file service not available")
+			render.Status(r, 500)
+			render.JSON(w, r, response.Error("File service not available"))
+			return
+		}
+
+		file, err := handler.OpenSignedFile(name, r.URL.Query().Get("expires"), r.URL.Query().Get("sig"))
+		switch {
+		case errors.Is(err, entity.ErrFileLinkExpired):
+			log.Debug("expired file link")
+			render.Status(r, 410)
+			render.JSON(w, r, response.Error("Link expired"))
+			return
+		case errors.Is(err, entity.ErrFileLinkInvalid):
+			log.Warn("invalid file link signature")
+			render.Status(r, 403)
+			render.JSON(w, r, response.Error("Invalid link"))
+			return
+		case err != nil:
+			log.Warn("open file", sl.Err(err))
+			render.Status(r, 404)
+			render.JSON(w, r, response.Error("File not found"))
+			return
+		}
+		defer file.Close()
+
+		info, err := file.Stat()
+		if err != nil {
+			log.Error("stat file", sl.Err(err))
+			render.Status(r, 500)
+			render.JSON(w, r, response.Error("File not available"))
+			return
+		}
+		w.Header().Set("Cache-Control", "private, no-store")
+		http.ServeContent(w, r, name, info.ModTime(), file)
+	}
+}
@@ -0,0 +1,66 @@
+package health
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+	"wfsync/entity"
+	"wfsync/lib/sl"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+)
+
+type Core interface {
+	Health(ctx context.Context) *entity.HealthStatus
+}
+
+// Check reports the status of the service and of each subsystem. Answers 200 while the
+// required subsystems are up, even when optional ones are down, and 503 otherwise.
+// Unauthenticated, for load balancers and monitoring.
+func Check(log *slog.Logger, handler Core) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := handler.Health(r.Context())
+		respond(w, r, log, status, status.Healthy())
+	}
+}
+
+// Live answers 200 as long as the process serves requests, without probing any
+// subsystem; an orchestrator restarts the service when it stops answering.
+func Live() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		render.JSON(w, r, &entity.HealthStatus{Status: entity.HealthOk})
+	}
+}
+
+// Ready answers 200 while every enabled subsystem is up and 503 otherwise, from the
+// same cached probe results as Check; an orchestrator holds traffic back until then.
+// Unlike Check, the enabled clients (Stripe, wFirma, Telegram) gate readiness too: an
+// instance that cannot reach them would accept webhooks it cannot process.
+func Ready(log *slog.Logger, handler Core) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := handler.Health(r.Context())
+		respond(w, r, log, status, status.Ready())
+	}
+}
+
+// respond writes the status, with 503 and a warning when the check failed.
+func respond(w http.ResponseWriter, r *http.Request, log *slog.Logger, status *entity.HealthStatus, ok bool) {
+	if !ok {
+		var down []string
+		for _, s := range status.Subsystems {
+			if s.Status == entity.HealthDown {
+				down = append(down, s.Name+": "+s.Error)
+			}
+		}
+		log.With(
+			sl.Module("http.handlers.health"),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			slog.String("path", r.URL.Path),
+			slog.String("down", strings.Join(down, "; ")),
+		).Warn("health check failed")
+		render.Status(r, http.StatusServiceUnavailable)
+	}
+	render.JSON(w, r, status)
+}
@@ -0,0 +1,103 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"wfsync/entity"
+)
+
+type fakeCore struct {
+	status *entity.HealthStatus
+}
+
+func (f fakeCore) Health(context.Context) *entity.HealthStatus {
+	return f.status
+}
+
+// TestCheck answers 200 while the service is ok or degraded and 503 when it is down,
+// with the subsystem results in the body either way.
+func TestCheck(t *testing.T) {
+	cases := []struct {
+		status   string
+		wantCode int
+	}{
+		{entity.HealthOk, http.StatusOK},
+		{entity.HealthDegraded, http.StatusOK},
+		{entity.HealthDown, http.StatusServiceUnavailable},
+	}
+	for _, tc := range cases {
+		t.Run(tc.status, func(t *testing.T) {
+			status := &entity.HealthStatus{Status: tc.status, Subsystems: []*entity.SubsystemHealth{
+				{Name: "mongo", Status: entity.HealthOk, Required: true, Error: "dial tcp 10.0.0.5:27017"},
+			}}
+			handler := Check(slog.New(slog.NewTextHandler(io.Discard, nil)), fakeCore{status})
+
+			rec := httptest.NewRecorder()
+			handler(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+			if rec.Code != tc.wantCode {
+				t.Errorf("code = %d, want %d", rec.Code, tc.wantCode)
+			}
+			if strings.Contains(rec.Body.String(), "10.0.0.5") {
+				t.Errorf("body %s exposes the probe error", rec.Body.String())
+			}
+			var body entity.HealthStatus
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("decode body %q: %v", rec.Body.String(), err)
+			}
+			if body.Status != tc.status || len(body.Subsystems) != 1 || body.Subsystems[0].Name != "mongo" {
+				t.Errorf("body = %+v", body)
+			}
+		})
+	}
+}
+
+// TestLiveAndReady takes the subsystems down one after another: /livez keeps answering
+// 200 and /health answers 503 only while a required subsystem is down, while /readyz
+// answers 503 while any enabled one is.
+func TestLiveAndReady(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	mongo := &entity.SubsystemHealth{Name: "mongo", Status: entity.HealthOk, Required: true}
+	wfirma := &entity.SubsystemHealth{Name: entity.FeatureWFirma, Status: entity.HealthOk}
+	stripe := &entity.SubsystemHealth{Name: entity.FeatureStripe, Status: entity.HealthDisabled}
+	core := &fakeCore{status: &entity.HealthStatus{Subsystems: []*entity.SubsystemHealth{mongo, wfirma, stripe}}}
+	live, check, ready := Live(), Check(log, core), Ready(log, core)
+
+	get := func(handler http.HandlerFunc) int {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rec.Code
+	}
+	steps := []struct {
+		name       string
+		change     func()
+		wantHealth int
+		wantReady  int
+	}{
+		{"all up, stripe switched off", func() {}, http.StatusOK, http.StatusOK},
+		{"enabled client down", func() { wfirma.Status, core.status.Status = entity.HealthDown, entity.HealthDegraded },
+			http.StatusOK, http.StatusServiceUnavailable},
+		{"required down", func() { mongo.Status, core.status.Status = entity.HealthDown, entity.HealthDown },
+			http.StatusServiceUnavailable, http.StatusServiceUnavailable},
+		{"recovered", func() {
+			mongo.Status, wfirma.Status, core.status.Status = entity.HealthOk, entity.HealthOk, entity.HealthOk
+		}, http.StatusOK, http.StatusOK},
+	}
+	for _, step := range steps {
+		step.change()
+		if code := get(live); code != http.StatusOK {
+			t.Errorf("%s: /livez = %d, want 200", step.name, code)
+		}
+		if code := get(check); code != step.wantHealth {
+			t.Errorf("%s: /health = %d, want %d", step.name, code, step.wantHealth)
+		}
+		if code := get(ready); code != step.wantReady {
+			t.Errorf("%s: /readyz = %d, want %d", step.name, code, step.wantReady)
+		}
+	}
+}
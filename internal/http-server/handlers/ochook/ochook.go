@@ -0,0 +1,88 @@
+package ochook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"wfsync/entity"
+	"wfsync/lib/api/cont"
+	"wfsync/lib/api/response"
+	"wfsync/lib/sl"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+)
+
+type Core interface {
+	OpenCartOrderEvent(ctx context.Context, event *entity.OpenCartEvent) (*entity.OpenCartEventResult, error)
+}
+
+// OrderEvent handles POST /webhook/opencart: a store module reports that an order is
+// ready for a job, which then starts immediately instead of on the next poll. The order
+// is checked before the answer; the job runs in the background.
+func OrderEvent(logger *slog.Logger, handler Core) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.With(
+			sl.Module("http.handlers.ochook"),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			slog.String("user", cont.GetUser(r.Context()).Username),
+		)
+
+		if handler == nil {
+			log.Error("opencart service not available")
+			render.Status(r, 500)
+			render.JSON(w, r, response.Error("OpenCart service not available"))
+			return
+		}
+
+		var event entity.OpenCartEvent
+		if err := render.Bind(r, &event); err != nil {
+			log.Warn("invalid request body", sl.Err(err))
+			render.Status(r, 400)
+			render.JSON(w, r, response.Invalid(fmt.Sprintf("Invalid request: %v", err), err))
+			return
+		}
+		log = log.With(
+			slog.Int64("order_id", event.OrderId),
+			slog.String("event", event.Event),
+		)
+
+		result, err := handler.OpenCartOrderEvent(r.Context(), &event)
+		if err != nil {
+			status := eventErrorStatus(err)
+			if status >= 500 {
+				log.Error("order event", sl.Err(err))
+				render.Status(r, status)
+				render.JSON(w, r, response.Error("Order event failed"))
+				return
+			}
+			log.Warn("order event", sl.Err(err))
+			render.Status(r, status)
+			render.JSON(w, r, response.Error(fmt.Sprintf("Order event: %v", err)))
+			return
+		}
+		log.Debug("order event handled", slog.Bool("processed", result.Processed))
+
+		render.JSON(w, r, response.Ok(result))
+	}
+}
+
+// eventErrorStatus maps an order event failure to its response status: 4xx for an event
+// the store should not send as is, 5xx when this side could not take it, so the store
+// may send it again.
+func eventErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, entity.ErrOrderNotInRequestStatus):
+		return http.StatusConflict
+	case errors.Is(err, entity.ErrOrderNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, entity.ErrJobNotConfigured):
+		return http.StatusBadRequest
+	case errors.Is(err, entity.ErrSubsystemDisabled):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
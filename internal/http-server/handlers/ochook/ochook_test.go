@@ -0,0 +1,79 @@
+package ochook
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"wfsync/entity"
+)
+
+// fakeCore records the event it is asked to run.
+type fakeCore struct {
+	got *entity.OpenCartEvent
+	err error
+}
+
+func (f *fakeCore) OpenCartOrderEvent(_ context.Context, event *entity.OpenCartEvent) (*entity.OpenCartEventResult, error) {
+	f.got = event
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &entity.OpenCartEventResult{OrderId: event.OrderId, Event: event.Event, Processed: true}, nil
+}
+
+// TestOrderEventDispatch checks that each event reaches core with its order id and job,
+// and that bad events, orders outside the request status and failures on this side are
+// answered accordingly.
+func TestOrderEventDispatch(t *testing.T) {
+	cases := []struct {
+		name       string
+		body       string
+		coreErr    error
+		wantStatus int
+		wantEvent  string
+	}{
+		{"payment link", `{"order_id":101,"event":"stripe-pay-link"}`, nil, 200, entity.OpenCartEventPaymentLink},
+		{"proforma", `{"order_id":101,"event":"wfirma-proforma"}`, nil, 200, entity.OpenCartEventProforma},
+		{"invoice", `{"order_id":101,"event":"wfirma-invoice"}`, nil, 200, entity.OpenCartEventInvoice},
+		{"unknown event", `{"order_id":101,"event":"refund"}`, nil, 400, ""},
+		{"missing order id", `{"event":"wfirma-invoice"}`, nil, 400, ""},
+		{"order not in request status", `{"order_id":101,"event":"wfirma-invoice"}`,
+			fmt.Errorf("%w: status 5", entity.ErrOrderNotInRequestStatus), 409, entity.OpenCartEventInvoice},
+		{"order not found", `{"order_id":101,"event":"wfirma-invoice"}`,
+			fmt.Errorf("%w: 101", entity.ErrOrderNotFound), 404, entity.OpenCartEventInvoice},
+		{"job not configured", `{"order_id":101,"event":"stripe-pay-link"}`,
+			fmt.Errorf("%w: stripe-pay-link", entity.ErrJobNotConfigured), 400, entity.OpenCartEventPaymentLink},
+		{"opencart switched off", `{"order_id":101,"event":"wfirma-invoice"}`,
+			fmt.Errorf("opencart: %w", entity.ErrSubsystemDisabled), 503, entity.OpenCartEventInvoice},
+		{"database failure", `{"order_id":101,"event":"wfirma-invoice"}`,
+			fmt.Errorf("read order status: connection refused"), 500, entity.OpenCartEventInvoice},
+	}
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			core := &fakeCore{err: tc.coreErr}
+			r := httptest.NewRequest(http.MethodPost, "/webhook/opencart", strings.NewReader(tc.body))
+			r.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			OrderEvent(log, core)(rec, r)
+
+			if rec.Code != tc.wantStatus {
+				t.Errorf("status = %d, want %d (%s)", rec.Code, tc.wantStatus, rec.Body)
+			}
+			if tc.wantEvent == "" {
+				if core.got != nil {
+					t.Errorf("core called with %+v for an invalid event", core.got)
+				}
+				return
+			}
+			if core.got == nil || core.got.OrderId != 101 || core.got.Event != tc.wantEvent {
+				t.Errorf("core got %+v, want order 101 event %s", core.got, tc.wantEvent)
+			}
+		})
+	}
+}
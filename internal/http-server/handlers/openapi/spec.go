@@ -0,0 +1,248 @@
+// Package openapi generates the OpenAPI 3 document served at GET /openapi.json. Request
+// and response schemas are derived from the entity structs by reflection, and the paths
+// come from walking the chi router, so the document cannot list a route that is not
+// served. Each route is described by an Operation; a route without one is still listed
+// and reported by Build, which the api package test turns into a failure.
+package openapi
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"wfsync/lib/api/response"
+	"wfsync/lib/sl"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+)
+
+// Version is the OpenAPI specification version of the generated document.
+const Version = "3.0.3"
+
+// Operation describes one route. Response is the type of the data field of the
+// response.Response envelope, unless Bare is set and it is the whole body.
+type Operation struct {
+	Method  string
+	Path    string
+	Summary string
+	Tag     string
+	// Request is the JSON body type, nil when the route takes no body.
+	Request any
+	// Response is the success payload type; nil means a success envelope without data.
+	Response any
+	// Produces is the content type of a non-JSON success body, e.g. "application/pdf".
+	Produces string
+	// Bare responses are not wrapped in response.Response; Error is their error body.
+	Bare  bool
+	Error any
+	// Query lists the query parameters the handler reads.
+	Query []Param
+	// Public routes do not take the bearer token.
+	Public bool
+}
+
+// Param is a query parameter.
+type Param struct {
+	Name        string
+	Description string
+	Required    bool
+}
+
+type Document struct {
+	OpenAPI    string                        `json:"openapi"`
+	Info       Info                          `json:"info"`
+	Paths      map[string]map[string]*pathOp `json:"paths"`
+	Components Components                    `json:"components"`
+}
+
+type Info struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas"`
+	SecuritySchemes map[string]securityScheme `json:"securitySchemes"`
+}
+
+type securityScheme struct {
+	Type   string `json:"type"`
+	Scheme string `json:"scheme"`
+}
+
+type pathOp struct {
+	Summary     string                `json:"summary,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Parameters  []parameter           `json:"parameters,omitempty"`
+	RequestBody *body                 `json:"requestBody,omitempty"`
+	Responses   map[string]*body      `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+}
+
+type parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required"`
+	Schema      *Schema `json:"schema"`
+}
+
+// body serves as both requestBody and response object; requestBody ignores description
+// and responses ignore required.
+type body struct {
+	Description string               `json:"description,omitempty"`
+	Required    bool                 `json:"required,omitempty"`
+	Content     map[string]mediaType `json:"content,omitempty"`
+}
+
+type mediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+const bearerAuth = "bearerAuth"
+
+var pathParam = regexp.MustCompile(`\{([^}:]+)(:[^}]*)?}`)
+
+// Build walks the router and describes every route it serves. Routes missing from ops
+// are listed without schemas and named in the returned error; so are documented
+// operations the router does not serve.
+func Build(info Info, routes chi.Routes, ops []Operation) (*Document, error) {
+	byRoute := make(map[string]Operation, len(ops))
+	for _, op := range ops {
+		byRoute[op.Method+" "+op.Path] = op
+	}
+
+	doc := &Document{
+		OpenAPI: Version,
+		Info:    info,
+		Paths:   make(map[string]map[string]*pathOp),
+		Components: Components{
+			SecuritySchemes: map[string]securityScheme{bearerAuth: {Type: "http", Scheme: "bearer"}},
+		},
+	}
+	s := newSchemas()
+
+	var undocumented []string
+	err := chi.Walk(routes, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		key := method + " " + route
+		op, ok := byRoute[key]
+		if !ok {
+			undocumented = append(undocumented, key)
+			op = Operation{Method: method, Path: route}
+		}
+		delete(byRoute, key)
+
+		path := pathParam.ReplaceAllString(route, "{$1}")
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = make(map[string]*pathOp)
+		}
+		doc.Paths[path][strings.ToLower(method)] = describe(s, path, op)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("walk routes: %w", err)
+	}
+	doc.Components.Schemas = s.components
+
+	var problems []string
+	if len(undocumented) > 0 {
+		sort.Strings(undocumented)
+		problems = append(problems, "undocumented routes: "+strings.Join(undocumented, ", "))
+	}
+	if len(byRoute) > 0 {
+		var stale []string
+		for key := range byRoute {
+			stale = append(stale, key)
+		}
+		sort.Strings(stale)
+		problems = append(problems, "documented routes not served: "+strings.Join(stale, ", "))
+	}
+	if len(problems) > 0 {
+		return doc, fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+	return doc, nil
+}
+
+func describe(s *schemas, path string, op Operation) *pathOp {
+	out := &pathOp{
+		Summary:   op.Summary,
+		Responses: make(map[string]*body),
+	}
+	if op.Tag != "" {
+		out.Tags = []string{op.Tag}
+	}
+	for _, m := range pathParam.FindAllStringSubmatch(path, -1) {
+		out.Parameters = append(out.Parameters, parameter{
+			Name: m[1], In: "path", Required: true, Schema: &Schema{Type: "string"},
+		})
+	}
+	for _, q := range op.Query {
+		out.Parameters = append(out.Parameters, parameter{
+			Name: q.Name, In: "query", Description: q.Description, Required: q.Required, Schema: &Schema{Type: "string"},
+		})
+	}
+	if op.Request != nil {
+		out.RequestBody = &body{Required: true, Content: jsonContent(s.of(op.Request))}
+	}
+	if !op.Public {
+		out.Security = []map[string][]string{{bearerAuth: {}}}
+	}
+
+	success := &body{Description: "Success"}
+	switch {
+	case op.Produces != "":
+		success.Content = map[string]mediaType{op.Produces: {Schema: &Schema{Type: "string", Format: "binary"}}}
+	case op.Bare && op.Response != nil:
+		success.Content = jsonContent(s.of(op.Response))
+	case !op.Bare:
+		success.Content = jsonContent(envelope(s, op.Response))
+	}
+	out.Responses["200"] = success
+
+	failure := &body{Description: "Error"}
+	if op.Bare {
+		if op.Error != nil {
+			failure.Content = jsonContent(s.of(op.Error))
+		}
+	} else {
+		failure.Content = jsonContent(s.of(response.Response{}))
+	}
+	out.Responses["default"] = failure
+	return out
+}
+
+// envelope is response.Response with its data field narrowed to the payload type.
+func envelope(s *schemas, data any) *Schema {
+	env := s.object(reflect.TypeOf(response.Response{}))
+	delete(env.Properties, "data")
+	if data != nil {
+		env.Properties["data"] = s.of(data)
+	}
+	return env
+}
+
+func jsonContent(schema *Schema) map[string]mediaType {
+	return map[string]mediaType{"application/json": {Schema: schema}}
+}
+
+// Serve returns the handler for GET /openapi.json.
+func Serve(logger *slog.Logger, doc *Document) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.With(
+			sl.Module("http.handlers.openapi"),
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+		)
+		if doc == nil {
+			log.Error("openapi document not available")
+			render.Status(r, 500)
+			render.JSON(w, r, response.Error("OpenAPI document not available"))
+			return
+		}
+		render.JSON(w, r, doc)
+	}
+}
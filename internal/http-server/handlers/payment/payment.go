@@ -16,14 +16,16 @@ import (
 
 type Core interface {
 	StripeHoldAmount(params *entity.CheckoutParams) (*entity.Payment, error)
-	StripeCaptureAmount(sessionId string, amount int64) (*entity.Payment, *entity.CheckoutParams, error)
-	StripeCancelPayment(sessionId, reason string) (*entity.Payment, *entity.CheckoutParams, error)
+	StripeCaptureAmount(ctx context.Context, sessionId string, amount int64) (*entity.Payment, *entity.CheckoutParams, error)
+	StripeCancelPayment(ctx context.Context, sessionId, reason string) (*entity.Payment, *entity.CheckoutParams, error)
 	StripePayAmount(ctx context.Context, params *entity.CheckoutParams) (*entity.Payment, error)
 	StripePaymentStatus(orderId string) (*entity.PaymentStatus, error)
 	ReconcileQueue() ([]*entity.HeldPaymentSummary, error)
 }
 
-func Hold(log *slog.Logger, handler Core) http.HandlerFunc {
+// Hold opens a checkout session with a manual-capture hold. A total that differs from
+// the line sum by more than tolerance (minor units) is logged as a discount gap.
+func Hold(log *slog.Logger, handler Core, tolerance int64) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		mod := sl.Module("http.handlers.payment")
 
@@ -42,15 +44,15 @@ func Hold(log *slog.Logger, handler Core) http.HandlerFunc {
 		if err := render.Bind(r, &checkoutParams); err != nil {
 			logger.Error("bind request", sl.Err(err))
 			render.Status(r, 400)
-			render.JSON(w, r, response.Error(fmt.Sprintf("Invalid request: %v", err)))
+			render.JSON(w, r, response.Invalid(fmt.Sprintf("Invalid request: %v", err), err))
 			return
 		}
-		if err := checkoutParams.ValidateTotal(); err != nil {
-			// Tolerate discount/rounding gaps: redistribute line items to match
-			// the authoritative total instead of rejecting the request.
+		// Tolerate discount/rounding gaps: redistribute line items to match
+		// the authoritative total instead of rejecting the request.
+		if err := checkoutParams.ValidateTotal(tolerance); err != nil {
 			logger.Warn("total mismatch, recalculating", sl.Err(err))
-			checkoutParams.RecalcWithDiscount()
 		}
+		checkoutParams.RecalcWithDiscount()
 		logger = logger.With(
 			slog.Int("items_count", len(checkoutParams.LineItems)),
 			slog.Int64("total", checkoutParams.Total),
@@ -108,7 +110,7 @@ func Capture(log *slog.Logger, handler Core) http.HandlerFunc {
 		if err := render.Bind(r, &checkoutParams); err != nil {
 			logger.Error("bind request", sl.Err(err))
 			render.Status(r, 400)
-			render.JSON(w, r, response.Error(fmt.Sprintf("Invalid request: %v", err)))
+			render.JSON(w, r, response.Invalid(fmt.Sprintf("Invalid request: %v", err), err))
 			return
 		}
 		logger = logger.With(slog.Int64("amount", checkoutParams.Total))
@@ -116,7 +118,7 @@ func Capture(log *slog.Logger, handler Core) http.HandlerFunc {
 			logger = logger.With(slog.String("client_name", checkoutParams.ClientDetails.Name))
 		}
 
-		pm, params, err := handler.StripeCaptureAmount(id, checkoutParams.Total)
+		pm, params, err := handler.StripeCaptureAmount(r.Context(), id, checkoutParams.Total)
 		// Prefer the order id resolved from the held session over the request body, which
 		// may carry an unrelated external reference (e.g. a Zoho id).
 		if params != nil && params.OrderId != "" {
@@ -161,7 +163,7 @@ func Cancel(log *slog.Logger, handler Core) http.HandlerFunc {
 			return
 		}
 
-		pm, params, err := handler.StripeCancelPayment(id, reason)
+		pm, params, err := handler.StripeCancelPayment(r.Context(), id, reason)
 		// Log the OpenCart order id resolved from the held session so the cancel event can
 		// be tracked alongside the matching hold/capture events.
 		if params != nil && params.OrderId != "" {
@@ -179,7 +181,9 @@ func Cancel(log *slog.Logger, handler Core) http.HandlerFunc {
 	}
 }
 
-func Pay(log *slog.Logger, handler Core) http.HandlerFunc {
+// Pay opens a checkout session for an immediate payment. The total must match the line
+// sum within tolerance (minor units); a gap inside it is spread over the lines.
+func Pay(log *slog.Logger, handler Core, tolerance int64) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		mod := sl.Module("http.handlers.payment")
 
@@ -198,10 +202,10 @@ func Pay(log *slog.Logger, handler Core) http.HandlerFunc {
 		if err := render.Bind(r, &checkoutParams); err != nil {
 			logger.Error("bind request", sl.Err(err))
 			render.Status(r, 400)
-			render.JSON(w, r, response.Error(fmt.Sprintf("Invalid request: %v", err)))
+			render.JSON(w, r, response.Invalid(fmt.Sprintf("Invalid request: %v", err), err))
 			return
 		}
-		if err := checkoutParams.ValidateTotal(); err != nil {
+		if err := checkoutParams.RefineTotal(tolerance); err != nil {
 			logger.Error("validate total", sl.Err(err))
 			render.Status(r, 400)
 			render.JSON(w, r, response.Error(fmt.Sprintf("Invalid total: %v", err)))
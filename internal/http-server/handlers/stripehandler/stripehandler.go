@@ -7,6 +7,7 @@ import (
 	"log/slog"
 	"net/http"
 	"time"
+	"wfsync/entity"
 	"wfsync/lib/sl"
 
 	"github.com/stripe/stripe-go/v76"
@@ -14,7 +15,8 @@ import (
 
 type Core interface {
 	StripeVerifySignature(payload []byte, header string, tolerance time.Duration) bool
-	StripeEvent(ctx context.Context, evt *stripe.Event)
+	StripeEvent(ctx context.Context, evt *stripe.Event, payload []byte)
+	FeatureEnabled(name string) bool
 }
 
 func Event(logger *slog.Logger, handler Core) http.HandlerFunc {
@@ -25,6 +27,14 @@ func Event(logger *slog.Logger, handler Core) http.HandlerFunc {
 			slog.String("path", r.URL.Path),
 		)
 
+		// While Stripe is switched off, refuse events instead of dropping them: Stripe
+		// redelivers them with backoff, so nothing is lost once it is switched back on.
+		if !handler.FeatureEnabled(entity.FeatureStripe) {
+			log.Warn("stripe disabled, event refused")
+			http.Error(w, "disabled", http.StatusServiceUnavailable)
+			return
+		}
+
 		// Stripe webhook payloads are small; cap at 256KB to prevent unbounded
 		// memory use before signature verification.
 		r.Body = http.MaxBytesReader(w, r.Body, 256*1024)
@@ -62,7 +72,7 @@ func Event(logger *slog.Logger, handler Core) http.HandlerFunc {
 		// regardless of how long downstream wFirma/OpenCart calls take. We use
 		// a fresh background context since r.Context() is cancelled once we
 		// return; failures inside StripeEvent are persisted via the retry queue.
-		go handler.StripeEvent(context.Background(), &evt)
+		go handler.StripeEvent(context.Background(), &evt, payload)
 
 		w.WriteHeader(http.StatusOK)
 	}
@@ -2,6 +2,7 @@ package wfinvoice
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
@@ -31,8 +32,11 @@ type Core interface {
 	WFirmaOrderToInvoice(ctx context.Context, orderId int64, useCurrentDate bool) (*entity.CheckoutParams, error)
 	WFirmaOrderFileProforma(ctx context.Context, orderId int64) (*entity.Payment, error)
 	WFirmaOrderFileInvoice(ctx context.Context, orderId int64) (*entity.Payment, error)
+	WFirmaRedownloadInvoice(ctx context.Context, orderId int64) (*entity.Payment, error)
 	WFirmaCreateProforma(ctx context.Context, params *entity.CheckoutParams) (*entity.Payment, error)
 	WFirmaCreateInvoice(ctx context.Context, params *entity.CheckoutParams) (*entity.Payment, error)
+	WFirmaDraftInvoice(ctx context.Context, params *entity.CheckoutParams) (*entity.CheckoutParams, error)
+	WFirmaIssueInvoice(ctx context.Context, orderId string) (*entity.Payment, error)
 }
 
 func Download(logger *slog.Logger, handler Core) http.HandlerFunc {
@@ -231,6 +235,56 @@ func FileInvoice(logger *slog.Logger, handler Core) http.HandlerFunc {
 	}
 }
 
+// RedownloadInvoice replaces an order's invoice PDF with a fresh copy from wFirma, for
+// files that went missing or got corrupted on disk.
+func RedownloadInvoice(logger *slog.Logger, handler Core) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		mod := sl.Module("http.handlers.wfinvoice")
+		orderId := chi.URLParam(r, "id")
+		user := cont.GetUser(r.Context())
+
+		log := logger.With(
+			mod,
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			slog.String("order_id", orderId),
+			slog.String("user", userName(user)),
+		)
+		if user == nil {
+			log.Error("user not found")
+			render.Status(r, 401)
+			render.JSON(w, r, response.Error("User not found"))
+			return
+		}
+
+		if handler == nil {
+			log.Error("invoice service not available")
+			render.JSON(w, r, response.Error("Invoice service not available"))
+			return
+		}
+
+		id, err := strconv.ParseInt(orderId, 10, 64)
+		if err != nil {
+			log.Warn("invalid order id")
+			render.Status(r, 400)
+			render.JSON(w, r, response.Error("Invalid order id"))
+			return
+		}
+
+		payment, err := handler.WFirmaRedownloadInvoice(r.Context(), id)
+		if err != nil {
+			log.Error("invoice re-download", sl.Err(err))
+			render.JSON(w, r, response.Error(fmt.Sprintf("Request failed: %v", err)))
+			return
+		}
+		log.With(
+			slog.String("invoice_id", payment.Id),
+			slog.String("invoice_file", payment.InvoiceFile),
+		).Info("invoice file re-downloaded")
+
+		render.JSON(w, r, response.Ok(payment))
+	}
+}
+
 func CreateProforma(logger *slog.Logger, handler Core) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		mod := sl.Module("http.handlers.wfinvoice")
@@ -258,7 +312,7 @@ func CreateProforma(logger *slog.Logger, handler Core) http.HandlerFunc {
 		if err := render.Bind(r, &params); err != nil {
 			log.Warn("invalid request body", sl.Err(err))
 			render.Status(r, 400)
-			render.JSON(w, r, response.Error(fmt.Sprintf("Invalid request: %v", err)))
+			render.JSON(w, r, response.Invalid(fmt.Sprintf("Invalid request: %v", err), err))
 			return
 		}
 
@@ -305,7 +359,7 @@ func CreateInvoice(logger *slog.Logger, handler Core) http.HandlerFunc {
 		if err := render.Bind(r, &params); err != nil {
 			log.Warn("invalid request body", sl.Err(err))
 			render.Status(r, 400)
-			render.JSON(w, r, response.Error(fmt.Sprintf("Invalid request: %v", err)))
+			render.JSON(w, r, response.Invalid(fmt.Sprintf("Invalid request: %v", err), err))
 			return
 		}
 
@@ -324,3 +378,96 @@ func CreateInvoice(logger *slog.Logger, handler Core) http.HandlerFunc {
 		render.JSON(w, r, response.Ok(payment))
 	}
 }
+
+// DraftInvoice stores an invoice draft for review instead of registering it. Posting
+// the returned draft again, edited, replaces it.
+func DraftInvoice(logger *slog.Logger, handler Core) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		mod := sl.Module("http.handlers.wfinvoice")
+		user := cont.GetUser(r.Context())
+
+		log := logger.With(
+			mod,
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			slog.String("user", userName(user)),
+		)
+		if user == nil {
+			log.Error("user not found")
+			render.Status(r, 401)
+			render.JSON(w, r, response.Error("User not found"))
+			return
+		}
+
+		if handler == nil {
+			log.Error("invoice service not available")
+			render.JSON(w, r, response.Error("Invoice service not available"))
+			return
+		}
+
+		var params entity.CheckoutParams
+		if err := render.Bind(r, &params); err != nil {
+			log.Warn("invalid request body", sl.Err(err))
+			render.Status(r, 400)
+			render.JSON(w, r, response.Invalid(fmt.Sprintf("Invalid request: %v", err), err))
+			return
+		}
+
+		log = log.With(slog.String("order_id", params.OrderId))
+
+		draft, err := handler.WFirmaDraftInvoice(r.Context(), &params)
+		if err != nil {
+			log.Error("invoice draft", sl.Err(err))
+			render.JSON(w, r, response.Error(fmt.Sprintf("Request failed: %v", err)))
+			return
+		}
+		log.Debug("invoice draft saved")
+
+		render.JSON(w, r, response.Ok(draft))
+	}
+}
+
+// IssueInvoice registers an order's invoice draft in wFirma.
+func IssueInvoice(logger *slog.Logger, handler Core) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		mod := sl.Module("http.handlers.wfinvoice")
+		orderId := chi.URLParam(r, "id")
+		user := cont.GetUser(r.Context())
+
+		log := logger.With(
+			mod,
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			slog.String("order_id", orderId),
+			slog.String("user", userName(user)),
+		)
+		if user == nil {
+			log.Error("user not found")
+			render.Status(r, 401)
+			render.JSON(w, r, response.Error("User not found"))
+			return
+		}
+
+		if handler == nil {
+			log.Error("invoice service not available")
+			render.JSON(w, r, response.Error("Invoice service not available"))
+			return
+		}
+
+		payment, err := handler.WFirmaIssueInvoice(r.Context(), orderId)
+		if errors.Is(err, entity.ErrInvoiceDraftNotFound) {
+			log.Warn("invoice draft not found")
+			render.Status(r, 404)
+			render.JSON(w, r, response.Error("Invoice draft not found"))
+			return
+		}
+		if err != nil {
+			log.Error("invoice creation", sl.Err(err))
+			render.JSON(w, r, response.Error(fmt.Sprintf("Request failed: %v", err)))
+			return
+		}
+		log.With(
+			slog.String("invoice_id", payment.Id),
+		).Debug("invoice draft issued")
+
+		render.JSON(w, r, response.Ok(payment))
+	}
+}
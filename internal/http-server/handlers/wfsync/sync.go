@@ -11,6 +11,7 @@ import (
 	"wfsync/entity"
 	"wfsync/lib/api/cont"
 	"wfsync/lib/api/response"
+	"wfsync/lib/money"
 	"wfsync/lib/sl"
 
 	"github.com/go-chi/chi/v5/middleware"
@@ -190,5 +191,5 @@ func formatCents(v int64) string {
 	if v == 0 {
 		return ""
 	}
-	return strconv.FormatFloat(float64(v)/100, 'f', 2, 64)
+	return money.New(v, "").Format(".")
 }
@@ -0,0 +1,166 @@
+// Package idempotency replays the stored response of a request repeated with the same
+// Idempotency-Key header, so a client retrying a payment request after a timeout gets
+// the session it already created instead of a second one. Keys are scoped per user and
+// tied to the request they were first used with: reusing a key for a different body or
+// path is rejected. Server errors (5xx) are not stored, so they can be retried.
+package idempotency
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"wfsync/entity"
+	"wfsync/lib/api/cont"
+	"wfsync/lib/api/response"
+	"wfsync/lib/sl"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+)
+
+// Header is the request header carrying the client's key.
+const Header = "Idempotency-Key"
+
+// ReplayedHeader marks a response served from the store.
+const ReplayedHeader = "Idempotent-Replayed"
+
+// maxKeyLength bounds the key the way Stripe does.
+const maxKeyLength = 255
+
+type Store interface {
+	GetIdempotentResponse(user, key string) (*entity.IdempotentResponse, error)
+	SaveIdempotentResponse(resp *entity.IdempotentResponse) error
+}
+
+// New returns the middleware. It must run after authentication, since keys belong to
+// the authenticated user. Requests without the header pass through; so does every
+// request when the store fails, as serving the request beats refusing it.
+func New(log *slog.Logger, store Store, ttl time.Duration) func(next http.Handler) http.Handler {
+	mod := sl.Module("middleware.idempotency")
+	var inFlight sync.Map
+
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(Header)
+			user := cont.GetUser(r.Context()).Username
+			if key == "" || user == "" || store == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			logger := log.With(
+				mod,
+				slog.String("request_id", middleware.GetReqID(r.Context())),
+				slog.String("user", user),
+				slog.String("idempotency_key", key),
+			)
+			if len(key) > maxKeyLength {
+				render.Status(r, http.StatusBadRequest)
+				render.JSON(w, r, response.Error("Idempotency-Key is too long"))
+				return
+			}
+
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				render.Status(r, http.StatusBadRequest)
+				render.JSON(w, r, response.Error("Request body not readable"))
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			fingerprint := requestFingerprint(r, body)
+
+			id := entity.IdempotentResponseID(user, key)
+			if _, busy := inFlight.LoadOrStore(id, struct{}{}); busy {
+				render.Status(r, http.StatusConflict)
+				render.JSON(w, r, response.Error("A request with this Idempotency-Key is in progress"))
+				return
+			}
+			defer inFlight.Delete(id)
+
+			stored, err := store.GetIdempotentResponse(user, key)
+			if err != nil {
+				logger.Error("get stored response", sl.Err(err))
+			}
+			if stored != nil {
+				if stored.Fingerprint != fingerprint {
+					logger.Warn("idempotency key reused for a different request")
+					render.Status(r, http.StatusUnprocessableEntity)
+					render.JSON(w, r, response.Error("Idempotency-Key was used with a different request"))
+					return
+				}
+				logger.Debug("replaying stored response")
+				replay(w, stored)
+				return
+			}
+
+			rec := &recorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(rec, r)
+			if rec.status >= 500 {
+				return
+			}
+
+			now := time.Now()
+			err = store.SaveIdempotentResponse(&entity.IdempotentResponse{
+				User:        user,
+				Key:         key,
+				Fingerprint: fingerprint,
+				Status:      rec.status,
+				ContentType: rec.Header().Get("Content-Type"),
+				Body:        rec.body.Bytes(),
+				CreatedAt:   now,
+				ExpiresAt:   now.Add(ttl),
+			})
+			if err != nil {
+				logger.Error("save response", sl.Err(err))
+			}
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+// requestFingerprint identifies the request a key was first used with.
+func requestFingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(r.Method))
+	h.Write([]byte{0})
+	h.Write([]byte(r.URL.Path))
+	h.Write([]byte{0})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func replay(w http.ResponseWriter, stored *entity.IdempotentResponse) {
+	if stored.ContentType != "" {
+		w.Header().Set("Content-Type", stored.ContentType)
+	}
+	w.Header().Set(ReplayedHeader, "true")
+	w.WriteHeader(stored.Status)
+	_, _ = w.Write(stored.Body)
+}
+
+// recorder passes the response through while keeping a copy of it.
+type recorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (r *recorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
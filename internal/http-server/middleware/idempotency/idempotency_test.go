@@ -0,0 +1,119 @@
+package idempotency
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"wfsync/entity"
+	"wfsync/lib/api/cont"
+)
+
+// memStore keeps responses in memory, honoring their expiry like the Mongo store.
+type memStore struct {
+	responses map[string]*entity.IdempotentResponse
+}
+
+func (m *memStore) GetIdempotentResponse(user, key string) (*entity.IdempotentResponse, error) {
+	resp := m.responses[entity.IdempotentResponseID(user, key)]
+	if resp == nil || !resp.ExpiresAt.After(time.Now()) {
+		return nil, nil
+	}
+	return resp, nil
+}
+
+func (m *memStore) SaveIdempotentResponse(resp *entity.IdempotentResponse) error {
+	m.responses[entity.IdempotentResponseID(resp.User, resp.Key)] = resp
+	return nil
+}
+
+// sessions stands in for the pay handler: every call opens a new "session".
+type sessions struct {
+	calls  int
+	status int
+}
+
+func (s *sessions) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	s.calls++
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(s.status)
+	_, _ = fmt.Fprintf(w, `{"data":{"id":"cs_%d"}}`, s.calls)
+}
+
+func send(h http.Handler, user, key, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/v1/st/pay", strings.NewReader(body))
+	if key != "" {
+		r.Header.Set(Header, key)
+	}
+	r = r.WithContext(cont.PutUser(r.Context(), &entity.User{Username: user}))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	return rec
+}
+
+// TestRepeatedRequests checks that a repeat with the same key gets the identical stored
+// response without reaching the handler, while other users, other bodies, requests
+// without a key and failed requests are handled as usual.
+func TestRepeatedRequests(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	newHandler := func(status int) (http.Handler, *sessions) {
+		next := &sessions{status: status}
+		return New(log, &memStore{responses: map[string]*entity.IdempotentResponse{}}, time.Hour)(next), next
+	}
+
+	t.Run("same key replays", func(t *testing.T) {
+		h, next := newHandler(http.StatusOK)
+		first := send(h, "shop", "k1", `{"order_id":"1"}`)
+		second := send(h, "shop", "k1", `{"order_id":"1"}`)
+		if next.calls != 1 {
+			t.Errorf("handler calls = %d, want 1", next.calls)
+		}
+		if second.Code != first.Code || second.Body.String() != first.Body.String() {
+			t.Errorf("replay = %d %q, want %d %q", second.Code, second.Body, first.Code, first.Body)
+		}
+		if second.Header().Get("Content-Type") != "application/json" || second.Header().Get(ReplayedHeader) != "true" {
+			t.Errorf("replay headers = %v", second.Header())
+		}
+	})
+
+	t.Run("keys are per user", func(t *testing.T) {
+		h, next := newHandler(http.StatusOK)
+		send(h, "shop", "k1", `{}`)
+		send(h, "portal", "k1", `{}`)
+		if next.calls != 2 {
+			t.Errorf("handler calls = %d, want 2", next.calls)
+		}
+	})
+
+	t.Run("different request with the same key", func(t *testing.T) {
+		h, next := newHandler(http.StatusOK)
+		send(h, "shop", "k1", `{"order_id":"1"}`)
+		rec := send(h, "shop", "k1", `{"order_id":"2"}`)
+		if rec.Code != http.StatusUnprocessableEntity || next.calls != 1 {
+			t.Errorf("status = %d, calls = %d; want 422 and 1", rec.Code, next.calls)
+		}
+	})
+
+	t.Run("no key", func(t *testing.T) {
+		h, next := newHandler(http.StatusOK)
+		send(h, "shop", "", `{}`)
+		send(h, "shop", "", `{}`)
+		if next.calls != 2 {
+			t.Errorf("handler calls = %d, want 2", next.calls)
+		}
+	})
+
+	t.Run("server errors are not stored", func(t *testing.T) {
+		h, next := newHandler(http.StatusInternalServerError)
+		send(h, "shop", "k1", `{}`)
+		send(h, "shop", "k1", `{}`)
+		if next.calls != 2 {
+			t.Errorf("handler calls = %d, want 2", next.calls)
+		}
+	})
+}
@@ -0,0 +1,114 @@
+// Package ratelimit limits /v1 requests per authenticated user with a token bucket:
+// each user may send Burst requests at once, refilled at Rate per minute. A request
+// over the limit gets 429 with a Retry-After header naming the seconds until the next
+// token. Webhooks are registered outside /v1 and are never limited.
+package ratelimit
+
+import (
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"wfsync/lib/api/cont"
+	"wfsync/lib/api/response"
+	"wfsync/lib/clock"
+	"wfsync/lib/sl"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+)
+
+// Limiter holds one token bucket per key.
+type Limiter struct {
+	perSecond float64
+	burst     float64
+	clock     clock.Clock
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewLimiter allows burst requests at once per key, refilled at perMinute. A burst
+// below 1 is raised to 1.
+func NewLimiter(perMinute, burst int, clk clock.Clock) *Limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &Limiter{
+		perSecond: float64(perMinute) / 60,
+		burst:     float64(burst),
+		clock:     clk,
+		buckets:   make(map[string]*bucket),
+	}
+}
+
+// Allow takes a token from key's bucket. When none is left it reports how long until
+// the next one.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.clock.Now()
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(l.burst, b.tokens+elapsed*l.perSecond)
+		b.last = now
+	}
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - b.tokens) / l.perSecond * float64(time.Second))
+	return false, wait
+}
+
+// New returns the middleware; it must run after authentication. A nil limiter or a
+// zero rate disables limiting.
+func New(log *slog.Logger, limiter *Limiter) func(next http.Handler) http.Handler {
+	mod := sl.Module("middleware.ratelimit")
+
+	return func(next http.Handler) http.Handler {
+		if limiter == nil || limiter.perSecond <= 0 {
+			return next
+		}
+		log.With(mod).Info("rate limit middleware initialized",
+			slog.Float64("per_minute", limiter.perSecond*60),
+			slog.Int("burst", int(limiter.burst)))
+
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			user := cont.GetUser(r.Context()).Username
+			if user == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			ok, wait := limiter.Allow(user)
+			if !ok {
+				retryAfter := int(math.Ceil(wait.Seconds()))
+				log.With(
+					mod,
+					slog.String("request_id", middleware.GetReqID(r.Context())),
+					slog.String("user", user),
+					slog.String("path", r.URL.Path),
+					slog.Int("retry_after", retryAfter),
+				).Warn("rate limit exceeded")
+				w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+				render.Status(r, http.StatusTooManyRequests)
+				render.JSON(w, r, response.Error("Rate limit exceeded"))
+				return
+			}
+			next.ServeHTTP(w, r)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
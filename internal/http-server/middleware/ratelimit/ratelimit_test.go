@@ -0,0 +1,71 @@
+package ratelimit
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"wfsync/entity"
+	"wfsync/lib/api/cont"
+	"wfsync/lib/clock"
+)
+
+func request(h http.Handler, user string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, "/v1/st/queue", nil)
+	if user != "" {
+		r = r.WithContext(cont.PutUser(r.Context(), &entity.User{Username: user}))
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	return rec
+}
+
+// TestLimitPerUser sends a burst over the limit on a stopped clock: the request after the
+// burst is rejected with 429 and Retry-After, other users keep their own budget, and
+// the budget refills as time passes.
+func TestLimitPerUser(t *testing.T) {
+	clk := clock.NewMock(time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC))
+	ok := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusOK) })
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	h := New(log, NewLimiter(30, 3, clk))(ok)
+
+	for i := 1; i <= 3; i++ {
+		if rec := request(h, "shop"); rec.Code != http.StatusOK {
+			t.Fatalf("request %d: status %d, want 200", i, rec.Code)
+		}
+	}
+	rec := request(h, "shop")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("request 4: status %d, want 429", rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "2" {
+		t.Errorf("Retry-After = %q, want 2 (30/min refills a token every 2s)", got)
+	}
+
+	if rec = request(h, "portal"); rec.Code != http.StatusOK {
+		t.Errorf("other user: status %d, want 200", rec.Code)
+	}
+
+	clk.Advance(2 * time.Second)
+	if rec = request(h, "shop"); rec.Code != http.StatusOK {
+		t.Errorf("after refill: status %d, want 200", rec.Code)
+	}
+	if rec = request(h, "shop"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("after refill, second request: status %d, want 429", rec.Code)
+	}
+}
+
+// TestLimitDisabled checks that a zero rate passes every request through.
+func TestLimitDisabled(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusOK) })
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	h := New(log, NewLimiter(0, 1, clock.Real))(ok)
+	for i := 0; i < 5; i++ {
+		if rec := request(h, "shop"); rec.Code != http.StatusOK {
+			t.Fatalf("request %d: status %d, want 200", i+1, rec.Code)
+		}
+	}
+}
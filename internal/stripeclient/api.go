@@ -0,0 +1,117 @@
+package stripeclient
+
+import (
+	"fmt"
+	"time"
+	"wfsync/lib/httpclient"
+
+	"github.com/stripe/stripe-go/v76"
+	"github.com/stripe/stripe-go/v76/client"
+)
+
+// stripeTimeout is the SDK's own request timeout, kept when http_client sets none.
+const stripeTimeout = 80 * time.Second
+
+// API is the part of the Stripe API the service calls. StripeClient depends on it rather
+// than on *client.API so payment flows can be tested against a fake; stripeAPI adapts
+// the SDK client.
+type API interface {
+	NewCheckoutSession(params *stripe.CheckoutSessionParams) (*stripe.CheckoutSession, error)
+	GetCheckoutSession(id string, params *stripe.CheckoutSessionParams) (*stripe.CheckoutSession, error)
+	// SessionForPaymentIntent returns the id of the checkout session that created the
+	// PaymentIntent, or "" when there is none.
+	SessionForPaymentIntent(paymentIntentId string) (string, error)
+	GetPaymentIntent(id string) (*stripe.PaymentIntent, error)
+	CapturePaymentIntent(id string, params *stripe.PaymentIntentCaptureParams) (*stripe.PaymentIntent, error)
+	CancelPaymentIntent(id string, params *stripe.PaymentIntentCancelParams) (*stripe.PaymentIntent, error)
+	GetInvoice(id string) (*stripe.Invoice, error)
+	// ChargeBillingDetails returns the billing details of the PaymentIntent's latest
+	// charge, or nil when it has not been charged yet.
+	ChargeBillingDetails(paymentIntentId string) (*stripe.ChargeBillingDetails, error)
+	GetCustomer(id string) (*stripe.Customer, error)
+	GetBalance(params *stripe.BalanceParams) (*stripe.Balance, error)
+}
+
+// backends returns SDK backends that send requests through the configured outbound HTTP
+// client, or nil (the SDK defaults) when http_client is not configured.
+func backends(opts httpclient.Options) (*stripe.Backends, error) {
+	if opts.IsZero() {
+		return nil, nil
+	}
+	hc, err := httpclient.New(opts, stripeTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("outbound http client: %w", err)
+	}
+	// GetBackendWithConfig fills the config in place (URL per backend), so each backend
+	// gets its own.
+	return &stripe.Backends{
+		API:     stripe.GetBackendWithConfig(stripe.APIBackend, &stripe.BackendConfig{HTTPClient: hc}),
+		Connect: stripe.GetBackendWithConfig(stripe.ConnectBackend, &stripe.BackendConfig{HTTPClient: hc}),
+		Uploads: stripe.GetBackendWithConfig(stripe.UploadsBackend, &stripe.BackendConfig{HTTPClient: hc}),
+	}, nil
+}
+
+type stripeAPI struct {
+	sc *client.API
+}
+
+// NewAPI wraps an initialized SDK client.
+func NewAPI(sc *client.API) API {
+	return &stripeAPI{sc: sc}
+}
+
+func (a *stripeAPI) NewCheckoutSession(params *stripe.CheckoutSessionParams) (*stripe.CheckoutSession, error) {
+	return a.sc.CheckoutSessions.New(params)
+}
+
+func (a *stripeAPI) GetCheckoutSession(id string, params *stripe.CheckoutSessionParams) (*stripe.CheckoutSession, error) {
+	return a.sc.CheckoutSessions.Get(id, params)
+}
+
+func (a *stripeAPI) SessionForPaymentIntent(paymentIntentId string) (string, error) {
+	iter := a.sc.CheckoutSessions.List(&stripe.CheckoutSessionListParams{
+		PaymentIntent: stripe.String(paymentIntentId),
+	})
+	var sessionID string
+	if iter.Next() {
+		sessionID = iter.CheckoutSession().ID
+	}
+	return sessionID, iter.Err()
+}
+
+func (a *stripeAPI) GetPaymentIntent(id string) (*stripe.PaymentIntent, error) {
+	return a.sc.PaymentIntents.Get(id, nil)
+}
+
+func (a *stripeAPI) CapturePaymentIntent(id string, params *stripe.PaymentIntentCaptureParams) (*stripe.PaymentIntent, error) {
+	return a.sc.PaymentIntents.Capture(id, params)
+}
+
+func (a *stripeAPI) CancelPaymentIntent(id string, params *stripe.PaymentIntentCancelParams) (*stripe.PaymentIntent, error) {
+	return a.sc.PaymentIntents.Cancel(id, params)
+}
+
+func (a *stripeAPI) GetInvoice(id string) (*stripe.Invoice, error) {
+	return a.sc.Invoices.Get(id, nil)
+}
+
+func (a *stripeAPI) ChargeBillingDetails(paymentIntentId string) (*stripe.ChargeBillingDetails, error) {
+	params := &stripe.PaymentIntentParams{}
+	params.AddExpand("latest_charge")
+	pi, err := a.sc.PaymentIntents.Get(paymentIntentId, params)
+	if err != nil {
+		return nil, err
+	}
+	if pi.LatestCharge == nil {
+		return nil, nil
+	}
+	return pi.LatestCharge.BillingDetails, nil
+}
+
+func (a *stripeAPI) GetCustomer(id string) (*stripe.Customer, error) {
+	return a.sc.Customers.Get(id, nil)
+}
+
+func (a *stripeAPI) GetBalance(params *stripe.BalanceParams) (*stripe.Balance, error) {
+	return a.sc.Balance.Get(params)
+}
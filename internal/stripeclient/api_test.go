@@ -0,0 +1,388 @@
+package stripeclient
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"wfsync/entity"
+	"wfsync/internal/config"
+	"wfsync/lib/clock"
+	"wfsync/lib/features"
+
+	"github.com/stripe/stripe-go/v76"
+)
+
+// fakeAPI is an in-memory Stripe: sessions get sequential ids, PaymentIntents are kept
+// by id and captures accumulate amount_received. Embedding API panics on calls a test
+// does not expect.
+type fakeAPI struct {
+	API
+	sessions   []*stripe.CheckoutSessionParams
+	intents    map[string]*stripe.PaymentIntent
+	captures   []*stripe.PaymentIntentCaptureParams
+	sessionErr error
+	billing    map[string]*stripe.ChargeBillingDetails
+	customers  map[string]*stripe.Customer
+}
+
+func (f *fakeAPI) ChargeBillingDetails(paymentIntentId string) (*stripe.ChargeBillingDetails, error) {
+	return f.billing[paymentIntentId], nil
+}
+
+func (f *fakeAPI) GetCustomer(id string) (*stripe.Customer, error) {
+	customer, ok := f.customers[id]
+	if !ok {
+		return nil, &stripe.Error{HTTPStatusCode: 404, Code: stripe.ErrorCodeResourceMissing, Msg: "no such customer"}
+	}
+	return customer, nil
+}
+
+func (f *fakeAPI) NewCheckoutSession(params *stripe.CheckoutSessionParams) (*stripe.CheckoutSession, error) {
+	if f.sessionErr != nil {
+		return nil, f.sessionErr
+	}
+	f.sessions = append(f.sessions, params)
+	id := fmt.Sprintf("cs_fake_%d", len(f.sessions))
+	return &stripe.CheckoutSession{
+		ID:     id,
+		URL:    "https://checkout.stripe.test/" + id,
+		Status: stripe.CheckoutSessionStatusOpen,
+	}, nil
+}
+
+func (f *fakeAPI) CapturePaymentIntent(id string, params *stripe.PaymentIntentCaptureParams) (*stripe.PaymentIntent, error) {
+	pi, ok := f.intents[id]
+	if !ok {
+		return nil, &stripe.Error{HTTPStatusCode: 404, Code: stripe.ErrorCodeResourceMissing, Msg: "no such payment_intent"}
+	}
+	f.captures = append(f.captures, params)
+	pi.AmountReceived += *params.AmountToCapture
+	pi.Status = stripe.PaymentIntentStatusRequiresCapture
+	if pi.AmountReceived == pi.Amount || params.FinalCapture == nil || *params.FinalCapture {
+		pi.Status = stripe.PaymentIntentStatusSucceeded
+	}
+	result := *pi
+	return &result, nil
+}
+
+func newFakeClient(api *fakeAPI, multicapture bool) (*StripeClient, *memDB) {
+	db := &memDB{params: map[string]*entity.CheckoutParams{}}
+	return &StripeClient{
+		sc:           api,
+		db:           db,
+		log:          slog.New(slog.NewTextHandler(io.Discard, nil)),
+		clock:        clock.Real,
+		successUrl:   "https://shop.example.com/thanks",
+		multicapture: multicapture,
+	}, db
+}
+
+func testOrder() *entity.CheckoutParams {
+	return &entity.CheckoutParams{
+		ClientDetails: &entity.ClientDetails{Name: "Jan Kowalski", Email: "jan@example.com"},
+		LineItems:     []*entity.LineItem{{Name: "Book", Qty: 2, Price: 5000}},
+		Total:         10000,
+		Currency:      "pln",
+		OrderId:       "ORD-1",
+	}
+}
+
+// TestHoldAmountRequestsManualCapture checks the session a hold creates: manual capture,
+// multicapture requested when enabled, and the params recording the held amount.
+func TestHoldAmountRequestsManualCapture(t *testing.T) {
+	api := &fakeAPI{}
+	s, db := newFakeClient(api, true)
+
+	payment, err := s.HoldAmount(testOrder())
+	if err != nil {
+		t.Fatalf("HoldAmount: %v", err)
+	}
+	if len(api.sessions) != 1 {
+		t.Fatalf("sessions created = %d, want 1", len(api.sessions))
+	}
+	sent := api.sessions[0]
+	if sent.PaymentIntentData == nil || *sent.PaymentIntentData.CaptureMethod != "manual" {
+		t.Errorf("capture method not manual: %+v", sent.PaymentIntentData)
+	}
+	if got := sent.Extra.Values.Get("payment_method_options[card][request_multicapture]"); got != "if_available" {
+		t.Errorf("multicapture extra = %q, want if_available", got)
+	}
+	if payment.Link != "https://checkout.stripe.test/cs_fake_1" {
+		t.Errorf("payment link = %q", payment.Link)
+	}
+	stored := db.params["ORD-1"]
+	if stored == nil || stored.SessionId != "cs_fake_1" || stored.Authorized != 10000 {
+		t.Errorf("stored params = %+v, want session cs_fake_1 authorized 10000", stored)
+	}
+}
+
+// TestCaptureAmountStages captures a hold in two steps through the fake API: the first
+// capture is partial and leaves the order unpaid, the second completes it.
+func TestCaptureAmountStages(t *testing.T) {
+	api := &fakeAPI{intents: map[string]*stripe.PaymentIntent{
+		"pi_1": {ID: "pi_1", Amount: 10000, Status: stripe.PaymentIntentStatusRequiresCapture},
+	}}
+	s, db := newFakeClient(api, true)
+	order := testOrder()
+	order.SessionId = "cs_1"
+	order.PaymentId = "pi_1"
+	order.Authorized = 10000
+	db.params[order.OrderId] = order
+
+	_, params, err := s.CaptureAmount("cs_1", 4000)
+	if err != nil {
+		t.Fatalf("first capture: %v", err)
+	}
+	if params.Paid || params.Captured != 4000 || *api.captures[0].FinalCapture {
+		t.Errorf("after first capture: paid=%v captured=%d final=%v", params.Paid, params.Captured, *api.captures[0].FinalCapture)
+	}
+
+	_, params, err = s.CaptureAmount("cs_1", 0)
+	if err != nil {
+		t.Fatalf("second capture: %v", err)
+	}
+	if !params.Paid || params.Captured != 10000 || *api.captures[1].AmountToCapture != 6000 {
+		t.Errorf("after second capture: paid=%v captured=%d amount=%d", params.Paid, params.Captured, *api.captures[1].AmountToCapture)
+	}
+
+	if _, _, err = s.CaptureAmount("cs_1", 0); err == nil {
+		t.Error("expected an error capturing a fully captured hold")
+	}
+	if len(api.captures) != 2 {
+		t.Errorf("captures sent = %d, want 2", len(api.captures))
+	}
+}
+
+// TestPayAmountStripeError checks that a Stripe rejection is reported with its status
+// and code rather than as an opaque SDK error.
+func TestPayAmountStripeError(t *testing.T) {
+	api := &fakeAPI{sessionErr: &stripe.Error{HTTPStatusCode: 400, Code: stripe.ErrorCodeParameterInvalidInteger, Msg: "Invalid integer"}}
+	s, _ := newFakeClient(api, false)
+
+	_, err := s.PayAmount(testOrder())
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	var stripeErr *stripe.Error
+	if errors.As(err, &stripeErr) {
+		t.Errorf("error should be parsed, got raw %v", err)
+	}
+	if !strings.Contains(err.Error(), "status 400") || !strings.Contains(err.Error(), "Invalid integer") {
+		t.Errorf("error = %q, want status and message", err)
+	}
+}
+
+// TestCaptureBySessionId checks the documented identifier: capture takes the Checkout
+// Session id from the hold response, while a PaymentIntent id or an unknown session is
+// refused before anything reaches Stripe.
+func TestCaptureBySessionId(t *testing.T) {
+	api := &fakeAPI{intents: map[string]*stripe.PaymentIntent{
+		"pi_1": {ID: "pi_1", Amount: 10000, Status: stripe.PaymentIntentStatusRequiresCapture},
+	}}
+	s, db := newFakeClient(api, false)
+	order := testOrder()
+	order.SessionId = "cs_1"
+	order.PaymentId = "pi_1"
+	db.params[order.OrderId] = order
+
+	cases := []struct {
+		name    string
+		id      string
+		wantErr string
+	}{
+		{"payment intent id", "pi_1", "expected a checkout session id"},
+		{"unknown session", "cs_missing", "session not found"},
+		{"session id", "cs_1", ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			payment, _, err := s.CaptureAmount(tc.id, 0)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("CaptureAmount(%q) error = %v, want %q", tc.id, err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("CaptureAmount(%q): %v", tc.id, err)
+			}
+			if payment.Id != "pi_1" || payment.OrderId != "ORD-1" {
+				t.Errorf("payment = %+v, want pi_1 for ORD-1", payment)
+			}
+		})
+	}
+	if len(api.captures) != 1 {
+		t.Errorf("captures sent = %d, want only the one by session id", len(api.captures))
+	}
+}
+
+// TestCheckoutExpired replays checkout.session.expired events: an open checkout becomes
+// "expired", while a paid one or an unknown session is left untouched.
+func TestCheckoutExpired(t *testing.T) {
+	cases := []struct {
+		name       string
+		session    string
+		paid       bool
+		wantStatus string
+	}{
+		{"open checkout", "cs_1", false, "expired"},
+		{"already paid", "cs_1", true, "open"},
+		{"unknown session", "cs_missing", false, "open"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			s, db := newFakeClient(&fakeAPI{}, false)
+			order := testOrder()
+			order.SessionId = "cs_1"
+			order.Status = "open"
+			order.Paid = tc.paid
+			db.params[order.OrderId] = order
+
+			evt := &stripe.Event{
+				ID:   "evt_expired_1",
+				Type: stripe.EventTypeCheckoutSessionExpired,
+				Data: &stripe.EventData{Object: map[string]interface{}{
+					"id":     tc.session,
+					"object": "checkout.session",
+					"status": "expired",
+				}},
+			}
+			if params := s.HandleEvent(evt); params != nil {
+				t.Errorf("HandleEvent returned %+v, want nil", params)
+			}
+			if got := db.params["ORD-1"].Status; got != tc.wantStatus {
+				t.Errorf("status = %q, want %q", got, tc.wantStatus)
+			}
+		})
+	}
+}
+
+// TestEnrichClientDetails fills the details a guest checkout left out: from the charge's
+// billing details first, then from the Stripe customer, never overwriting what the
+// session already had.
+func TestEnrichClientDetails(t *testing.T) {
+	address := &stripe.Address{Country: "PL", PostalCode: "00-001", City: "Warszawa", Line1: "Prosta 1"}
+	cases := []struct {
+		name      string
+		client    *entity.ClientDetails
+		billing   *stripe.ChargeBillingDetails
+		customer  *stripe.Customer
+		wantEmail string
+		wantName  string
+		wantCity  string
+	}{
+		{
+			name:      "email from charge",
+			client:    &entity.ClientDetails{Name: "Jan Kowalski"},
+			billing:   &stripe.ChargeBillingDetails{Name: "J. K.", Email: "jan@example.com", Address: address},
+			wantEmail: "jan@example.com",
+			wantName:  "Jan Kowalski",
+			wantCity:  "Warszawa",
+		},
+		{
+			name:      "email from customer",
+			client:    nil,
+			billing:   &stripe.ChargeBillingDetails{Address: address},
+			customer:  &stripe.Customer{ID: "cus_1", Name: "Jan Kowalski", Email: "jan@example.com"},
+			wantEmail: "jan@example.com",
+			wantName:  "Jan Kowalski",
+			wantCity:  "Warszawa",
+		},
+		{
+			name:      "complete details untouched",
+			client:    &entity.ClientDetails{Name: "Anna", Email: "anna@example.com", City: "Kraków"},
+			billing:   &stripe.ChargeBillingDetails{Name: "Jan", Email: "jan@example.com", Address: address},
+			wantEmail: "anna@example.com",
+			wantName:  "Anna",
+			wantCity:  "Kraków",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			api := &fakeAPI{
+				billing:   map[string]*stripe.ChargeBillingDetails{"pi_1": tc.billing},
+				customers: map[string]*stripe.Customer{},
+			}
+			sess := &stripe.CheckoutSession{ID: "cs_1"}
+			if tc.customer != nil {
+				api.customers[tc.customer.ID] = tc.customer
+				sess.Customer = &stripe.Customer{ID: tc.customer.ID}
+			}
+			s, _ := newFakeClient(api, false)
+			params := &entity.CheckoutParams{PaymentId: "pi_1", ClientDetails: tc.client}
+
+			s.enrichClientDetails(s.log, params, sess)
+
+			got := params.ClientDetails
+			if got == nil {
+				t.Fatal("client details still nil")
+			}
+			if got.Email != tc.wantEmail || got.Name != tc.wantName || got.City != tc.wantCity {
+				t.Errorf("client = %+v, want email %q name %q city %q", got, tc.wantEmail, tc.wantName, tc.wantCity)
+			}
+		})
+	}
+}
+
+// flagStore serves fixed feature flags.
+type flagStore []*entity.FeatureFlag
+
+func (s flagStore) GetFeatureFlags() ([]*entity.FeatureFlag, error) { return s, nil }
+
+func (s flagStore) SaveFeatureFlag(*entity.FeatureFlag) error { return nil }
+
+// TestStripeDisabled checks that with the Stripe feature flag off, payment operations
+// fail with ErrSubsystemDisabled before reaching the Stripe API or the database, and
+// webhook events are ignored.
+func TestStripeDisabled(t *testing.T) {
+	api := &fakeAPI{intents: map[string]*stripe.PaymentIntent{
+		"pi_1": {ID: "pi_1", Amount: 10000, Status: stripe.PaymentIntentStatusRequiresCapture},
+	}}
+	s, db := newFakeClient(api, true)
+	s.SetFeatures(features.New(flagStore{{Name: entity.FeatureStripe}}, s.log))
+	held := testOrder()
+	held.OrderId = "ORD-2"
+	held.SessionId = "cs_1"
+	held.PaymentId = "pi_1"
+	db.params[held.OrderId] = held
+
+	if _, err := s.HoldAmount(testOrder()); !errors.Is(err, entity.ErrSubsystemDisabled) {
+		t.Errorf("HoldAmount error = %v, want ErrSubsystemDisabled", err)
+	}
+	if _, err := s.PayAmount(testOrder()); !errors.Is(err, entity.ErrSubsystemDisabled) {
+		t.Errorf("PayAmount error = %v, want ErrSubsystemDisabled", err)
+	}
+	if _, _, err := s.CaptureAmount("cs_1", 0); !errors.Is(err, entity.ErrSubsystemDisabled) {
+		t.Errorf("CaptureAmount error = %v, want ErrSubsystemDisabled", err)
+	}
+	if _, _, err := s.CancelPayment("cs_1", ""); !errors.Is(err, entity.ErrSubsystemDisabled) {
+		t.Errorf("CancelPayment error = %v, want ErrSubsystemDisabled", err)
+	}
+	if len(api.sessions) != 0 || len(api.captures) != 0 {
+		t.Errorf("Stripe API called: %d sessions, %d captures", len(api.sessions), len(api.captures))
+	}
+	if _, ok := db.params["ORD-1"]; ok {
+		t.Error("params of a refused order were stored")
+	}
+
+	evt := &stripe.Event{ID: "evt_1", Type: stripe.EventTypeCheckoutSessionCompleted}
+	if params := s.HandleEvent(evt); params != nil {
+		t.Errorf("HandleEvent = %+v, want nil", params)
+	}
+}
+
+// TestNewInvalidHTTPClient checks a misconfigured proxy fails the constructor instead of
+// falling back to the SDK's direct connection.
+func TestNewInvalidHTTPClient(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	conf := &config.Config{HTTPClient: config.HTTPClient{Proxy: "proxy.local:3128"}}
+	if _, err := New(conf, log); err == nil {
+		t.Error("New succeeded with an invalid proxy, want an error")
+	}
+	if _, err := New(&config.Config{}, log); err != nil {
+		t.Errorf("New without http_client: %v", err)
+	}
+}
@@ -0,0 +1,73 @@
+package stripeclient
+
+import (
+	"log/slog"
+	"wfsync/entity"
+	"wfsync/lib/sl"
+
+	"github.com/stripe/stripe-go/v76"
+)
+
+// clientDetailsMissing reports whether the invoice would lack the customer's email or
+// address. wFirma rejects a contractor without them.
+func clientDetailsMissing(client *entity.ClientDetails) bool {
+	return client == nil || client.Email == "" || (client.Country == "" && client.City == "" && client.Street == "")
+}
+
+// enrichClientDetails fills customer details a completed session did not carry (guest
+// checkout without collection) before the order is invoiced. The billing details of the
+// PaymentIntent's charge are tried first, then the Stripe customer record. Only empty
+// fields are filled; lookup failures are logged and leave the params as they are.
+func (s *StripeClient) enrichClientDetails(log *slog.Logger, params *entity.CheckoutParams, sess *stripe.CheckoutSession) {
+	if !clientDetailsMissing(params.ClientDetails) {
+		return
+	}
+	if params.ClientDetails == nil {
+		params.ClientDetails = &entity.ClientDetails{}
+	}
+	client := params.ClientDetails
+
+	if params.PaymentId != "" {
+		billing, err := s.sc.ChargeBillingDetails(params.PaymentId)
+		if err != nil {
+			log.With(sl.Err(err)).Warn("get charge billing details")
+		} else if billing != nil {
+			fillClientDetails(client, billing.Name, billing.Email, billing.Phone, billing.Address)
+		}
+	}
+	if clientDetailsMissing(client) && sess.Customer != nil && sess.Customer.ID != "" {
+		customer, err := s.sc.GetCustomer(sess.Customer.ID)
+		if err != nil {
+			log.With(sl.Err(err)).Warn("get stripe customer")
+		} else if customer != nil {
+			fillClientDetails(client, customer.Name, customer.Email, customer.Phone, customer.Address)
+		}
+	}
+
+	if clientDetailsMissing(client) {
+		log.With(slog.String("tg_topic", entity.TopicPayment)).Warn("customer details incomplete, invoice may fail")
+	} else {
+		log.Info("customer details filled from stripe")
+	}
+}
+
+// fillClientDetails copies the given details into the empty fields of client. The
+// address is taken as a whole, and only when the client has none.
+func fillClientDetails(client *entity.ClientDetails, name, email, phone string, address *stripe.Address) {
+	if client.Name == "" {
+		client.Name = name
+	}
+	if client.Email == "" {
+		client.Email = email
+	}
+	if client.Phone == "" {
+		client.Phone = phone
+	}
+	if address != nil && client.Country == "" && client.City == "" && client.Street == "" {
+		client.Country = address.Country
+		client.ZipCode = address.PostalCode
+		client.City = address.City
+		client.Street = address.Line1
+		client.Street2 = address.Line2
+	}
+}
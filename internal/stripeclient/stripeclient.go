@@ -1,6 +1,7 @@
 package stripeclient
 
 import (
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
@@ -12,6 +13,8 @@ import (
 	"time"
 	"wfsync/entity"
 	"wfsync/internal/config"
+	"wfsync/lib/clock"
+	"wfsync/lib/features"
 	"wfsync/lib/sl"
 
 	"github.com/stripe/stripe-go/v76"
@@ -27,15 +30,25 @@ type Database interface {
 }
 
 type StripeClient struct {
-	sc            *client.API
+	sc            API
 	webhookSecret string
 	successUrl    string
+	successUrls   map[entity.Source]string
 	db            Database
 	log           *slog.Logger
+	clock         clock.Clock
+	features      *features.Flags
 	testMode      bool
+	multicapture  bool
+	maxNameLength int
+	notifyExpired bool
+	// collectAddress and collectPhone request the billing address and phone on sessions.
+	collectAddress bool
+	collectPhone   bool
 }
 
-func New(conf *config.Config, logger *slog.Logger) *StripeClient {
+// New fails when the outbound HTTP client is misconfigured (proxy URL, CA file).
+func New(conf *config.Config, logger *slog.Logger) (*StripeClient, error) {
 	stripeKey := conf.Stripe.APIKey
 	webhookSecret := conf.Stripe.WebhookSecret
 	if conf.Stripe.TestMode {
@@ -46,21 +59,58 @@ func New(conf *config.Config, logger *slog.Logger) *StripeClient {
 			sl.Secret("webhook_secret", webhookSecret),
 		).Info("using test mode for stripe")
 	}
+	be, err := backends(conf.HTTPClient.Options())
+	if err != nil {
+		return nil, err
+	}
 	sc := &client.API{}
-	sc.Init(stripeKey, nil)
+	sc.Init(stripeKey, be)
 	return &StripeClient{
-		sc:            sc,
-		webhookSecret: webhookSecret,
-		successUrl:    conf.Stripe.SuccessURL,
-		testMode:      conf.Stripe.TestMode,
-		log:           logger.With(sl.Module("stripe")),
-	}
+		sc:             NewAPI(sc),
+		webhookSecret:  webhookSecret,
+		successUrl:     conf.Stripe.SuccessURL,
+		successUrls:    successURLsBySource(conf.Stripe.SuccessURLs),
+		testMode:       conf.Stripe.TestMode,
+		multicapture:   conf.Stripe.Multicapture,
+		maxNameLength:  conf.Stripe.MaxNameLength,
+		notifyExpired:  conf.Stripe.NotifyExpired,
+		collectAddress: conf.Stripe.CollectBillingAddress,
+		collectPhone:   conf.Stripe.CollectPhone,
+		log:            logger.With(sl.Module("stripe")),
+		clock:          clock.Real,
+	}, nil
 }
 
 func (s *StripeClient) SetDatabase(db Database) {
 	s.db = db
 }
 
+// SetAPI replaces the Stripe API the client calls, e.g. with a fake in tests.
+func (s *StripeClient) SetAPI(api API) {
+	s.sc = api
+}
+
+// SetClock replaces the clock used for webhook timestamp tolerance.
+func (s *StripeClient) SetClock(c clock.Clock) {
+	s.clock = c
+}
+
+// SetFeatures makes the payment operations and event handling check the Stripe feature
+// flag first.
+func (s *StripeClient) SetFeatures(f *features.Flags) {
+	s.features = f
+}
+
+// Ping checks that Stripe accepts the API key, for the health endpoint.
+func (s *StripeClient) Ping(ctx context.Context) error {
+	params := &stripe.BalanceParams{}
+	params.Context = ctx
+	if _, err := s.sc.GetBalance(params); err != nil {
+		return fmt.Errorf("stripe balance: %w", err)
+	}
+	return nil
+}
+
 func (s *StripeClient) VerifySignature(payload []byte, header string, tolerance time.Duration) bool {
 	secret := s.webhookSecret
 	parts := strings.Split(header, ",")
@@ -87,7 +137,7 @@ func (s *StripeClient) VerifySignature(payload []byte, header string, tolerance
 	}
 
 	eventTime := time.Unix(tsInt, 0)
-	timeSince := time.Since(eventTime)
+	timeSince := s.clock.Now().Sub(eventTime)
 	if timeSince > tolerance {
 		s.log.With(
 			slog.Time("timestamp", eventTime),
@@ -114,15 +164,26 @@ func (s *StripeClient) VerifySignature(payload []byte, header string, tolerance
 }
 
 func (s *StripeClient) HandleEvent(evt *stripe.Event) *entity.CheckoutParams {
+	if !s.features.Enabled(entity.FeatureStripe) {
+		s.log.With(
+			slog.Any("event_type", evt.Type),
+			slog.String("event_id", evt.ID),
+		).Warn("stripe disabled, event ignored")
+		return nil
+	}
 	switch evt.Type {
 	case stripe.EventTypeCheckoutSessionCompleted:
 		return s.handleCheckoutCompleted(evt)
+	case stripe.EventTypeCheckoutSessionExpired:
+		return s.handleCheckoutExpired(evt)
 	case stripe.EventTypeInvoiceFinalized:
 		return s.handleInvoiceFinalized(evt)
 	case stripe.EventTypePaymentIntentAmountCapturableUpdated:
 		return s.handleAmountCapturable(evt)
 	case stripe.EventTypePaymentIntentSucceeded:
 		return s.handlePaymentIntentSucceeded(evt)
+	case stripe.EventTypeChargeRefunded:
+		return s.handleChargeRefunded(evt)
 	default:
 		return nil
 	}
@@ -144,9 +205,10 @@ func (s *StripeClient) handleCheckoutCompleted(evt *stripe.Event) *entity.Checko
 		return params
 	}
 
-	sess, err := s.sc.CheckoutSessions.Get(invID, &stripe.CheckoutSessionParams{
+	sess, err := s.sc.GetCheckoutSession(invID, &stripe.CheckoutSessionParams{
 		Expand: []*string{
 			stripe.String("line_items"),
+			stripe.String("line_items.data.taxes"), // Stripe Tax rates, for automatic_tax sessions
 			stripe.String("shipping_cost"),
 		},
 	})
@@ -166,13 +228,19 @@ func (s *StripeClient) handleCheckoutCompleted(evt *stripe.Event) *entity.Checko
 
 	s.checkCustomer(sess)
 
+	// NewFromCheckoutSession carries sess.PaymentIntent.ID into PaymentId: capture and
+	// cancel of a held payment look the record up by session and act on that id.
 	params = entity.NewFromCheckoutSession(sess)
 	params.EventId = evt.ID
+	if params.PaymentId == "" && sess.Mode == stripe.CheckoutSessionModePayment {
+		log.Warn("completed session has no payment intent, hold cannot be captured")
+	}
 
 	log = log.With(
 		slog.String("order_id", params.OrderId),
 		slog.String("payment_id", params.PaymentId),
 	)
+	s.enrichClientDetails(log, params, sess)
 	if params.ClientDetails != nil {
 		log = log.With(
 			slog.String("client_name", params.ClientDetails.Name),
@@ -187,6 +255,57 @@ func (s *StripeClient) handleCheckoutCompleted(evt *stripe.Event) *entity.Checko
 	return params
 }
 
+// handleCheckoutExpired marks the stored params of an abandoned checkout session as
+// "expired", so the record reaches a terminal status instead of staying open forever.
+// Nothing is returned: an expired session has no payment to save or invoice.
+func (s *StripeClient) handleCheckoutExpired(evt *stripe.Event) *entity.CheckoutParams {
+	sessionID := evt.GetObjectValue("id")
+	log := s.log.With(
+		slog.Any("event_type", evt.Type),
+		slog.String("event_id", evt.ID),
+		slog.String("session_id", sessionID),
+	)
+
+	if s.db == nil {
+		log.Warn("database not configured")
+		return nil
+	}
+
+	params, err := s.db.GetCheckoutParamsSession(sessionID)
+	if err != nil {
+		log.With(sl.Err(err)).Error("get checkout params from database")
+		return nil
+	}
+	if params == nil || params.OrderId == "" {
+		log.Debug("checkout params not found for expired session")
+		return nil
+	}
+	log = log.With(slog.String("order_id", params.OrderId))
+	if params.IsTerminal() {
+		log.With(slog.String("status", params.Status)).Debug("expired session already in a final state")
+		return nil
+	}
+
+	params.Status = "expired"
+	params.EventId = evt.ID
+	params.Modified = time.Now()
+	if err = s.db.SaveCheckoutParams(params); err != nil {
+		log.With(sl.Err(err)).Error("update checkout params")
+		return nil
+	}
+
+	log = log.With(
+		slog.Int64("amount", params.Total),
+		slog.String("currency", params.Currency),
+	)
+	if s.notifyExpired {
+		log = log.With(slog.String("tg_topic", entity.TopicPayment))
+	}
+	log.Info("checkout session expired")
+
+	return nil
+}
+
 func (s *StripeClient) handleInvoiceFinalized(evt *stripe.Event) *entity.CheckoutParams {
 	invID := evt.GetObjectValue("id")
 	s.log.With(
@@ -194,14 +313,48 @@ func (s *StripeClient) handleInvoiceFinalized(evt *stripe.Event) *entity.Checkou
 		slog.String("invoice_id", invID),
 	).Debug("fetching invoice from stripe")
 
-	inv, err := s.sc.Invoices.Get(invID, nil)
+	inv, err := s.sc.GetInvoice(invID)
 	if err != nil {
 		s.log.With(
 			sl.Err(err),
 		).Error("get invoice from stripe")
 		return nil
 	}
-	return entity.NewFromInvoice(inv)
+	params := entity.NewFromInvoice(inv)
+	s.mergeStoredOrder(params)
+	return params
+}
+
+// mergeStoredOrder carries the ids of an order's stored record into params built from a
+// Stripe invoice. A checkout session with invoice creation reports the same order twice
+// (checkout.session.completed, then invoice.finalized): without the stored session and
+// payment ids the invoice id would replace them on the order's record, and without the
+// stored wFirma invoice id the order would be invoiced a second time.
+func (s *StripeClient) mergeStoredOrder(params *entity.CheckoutParams) {
+	if s.db == nil || params.OrderId == "" {
+		return
+	}
+	stored, err := s.db.GetCheckoutParamsByOrder(params.OrderId)
+	if err != nil {
+		s.log.With(
+			slog.String("order_id", params.OrderId),
+			sl.Err(err),
+		).Warn("get stored checkout params")
+		return
+	}
+	if stored == nil {
+		return
+	}
+	if stored.SessionId != "" {
+		params.SessionId = stored.SessionId
+	}
+	if stored.PaymentId != "" {
+		params.PaymentId = stored.PaymentId
+	}
+	params.InvoiceId = stored.InvoiceId
+	params.InvoiceFile = stored.InvoiceFile
+	params.ProformaId = stored.ProformaId
+	params.ProformaFile = stored.ProformaFile
 }
 
 func (s *StripeClient) handleAmountCapturable(evt *stripe.Event) *entity.CheckoutParams {
@@ -212,7 +365,7 @@ func (s *StripeClient) handleAmountCapturable(evt *stripe.Event) *entity.Checkou
 		slog.String("payment_id", piID),
 	)
 
-	pi, err := s.sc.PaymentIntents.Get(piID, nil)
+	pi, err := s.sc.GetPaymentIntent(piID)
 	if err != nil {
 		log.With(
 			sl.Err(err),
@@ -239,14 +392,8 @@ func (s *StripeClient) handleAmountCapturable(evt *stripe.Event) *entity.Checkou
 	}
 
 	// Find the checkout session that created this PaymentIntent via Stripe API
-	iter := s.sc.CheckoutSessions.List(&stripe.CheckoutSessionListParams{
-		PaymentIntent: stripe.String(piID),
-	})
-	var sessionID string
-	if iter.Next() {
-		sessionID = iter.CheckoutSession().ID
-	}
-	if err := iter.Err(); err != nil {
+	sessionID, err := s.sc.SessionForPaymentIntent(piID)
+	if err != nil {
 		log.With(sl.Err(err)).Error("list checkout sessions for payment intent")
 	}
 
@@ -317,7 +464,7 @@ func (s *StripeClient) handlePaymentIntentSucceeded(evt *stripe.Event) *entity.C
 		return nil
 	}
 
-	pi, err := s.sc.PaymentIntents.Get(piID, nil)
+	pi, err := s.sc.GetPaymentIntent(piID)
 	if err != nil {
 		log.With(sl.Err(err)).Error("get payment intent from stripe")
 		return nil
@@ -325,14 +472,8 @@ func (s *StripeClient) handlePaymentIntentSucceeded(evt *stripe.Event) *entity.C
 
 	// Resolve the originating checkout session (same approach as handleAmountCapturable)
 	// so we can load the saved checkout params by session_id.
-	iter := s.sc.CheckoutSessions.List(&stripe.CheckoutSessionListParams{
-		PaymentIntent: stripe.String(piID),
-	})
-	var sessionID string
-	if iter.Next() {
-		sessionID = iter.CheckoutSession().ID
-	}
-	if err := iter.Err(); err != nil {
+	sessionID, err := s.sc.SessionForPaymentIntent(piID)
+	if err != nil {
 		log.With(sl.Err(err)).Error("list checkout sessions for payment intent")
 	}
 	if sessionID == "" {
@@ -375,6 +516,72 @@ func (s *StripeClient) handlePaymentIntentSucceeded(evt *stripe.Event) *entity.C
 	return params
 }
 
+// handleChargeRefunded returns the params of the order whose charge was refunded, with
+// status "refunded" and Refunded set to the total refunded so far. Nothing is saved: the
+// caller records the refund once the corrective invoice is issued. amount_refunded is
+// cumulative: a redelivered event, or one not adding to what is already recorded, returns
+// nil.
+func (s *StripeClient) handleChargeRefunded(evt *stripe.Event) *entity.CheckoutParams {
+	piID := evt.GetObjectValue("payment_intent")
+	log := s.log.With(
+		slog.Any("event_type", evt.Type),
+		slog.String("event_id", evt.ID),
+		slog.String("payment_id", piID),
+	)
+
+	if s.db == nil {
+		log.Warn("database not configured")
+		return nil
+	}
+	if piID == "" {
+		log.Debug("refunded charge has no payment intent, ignoring")
+		return nil
+	}
+	refunded, err := strconv.ParseInt(evt.GetObjectValue("amount_refunded"), 10, 64)
+	if err != nil || refunded <= 0 {
+		log.With(slog.String("amount_refunded", evt.GetObjectValue("amount_refunded"))).Warn("invalid refunded amount")
+		return nil
+	}
+
+	sessionID, err := s.sc.SessionForPaymentIntent(piID)
+	if err != nil {
+		log.With(sl.Err(err)).Error("list checkout sessions for payment intent")
+	}
+	if sessionID == "" {
+		log.Debug("no checkout session found for payment intent, ignoring")
+		return nil
+	}
+
+	params, err := s.db.GetCheckoutParamsSession(sessionID)
+	if err != nil {
+		log.With(sl.Err(err), slog.String("session_id", sessionID)).Error("get checkout params from database")
+		return nil
+	}
+	if params == nil || params.OrderId == "" {
+		log.With(slog.String("session_id", sessionID)).Warn("checkout params not found for refunded charge")
+		return nil
+	}
+	log = log.With(slog.String("order_id", params.OrderId))
+	if refunded <= params.Refunded {
+		log.With(slog.Int64("refunded", refunded)).Debug("refund already recorded")
+		return nil
+	}
+
+	params.Refunded = refunded
+	params.Status = "refunded"
+	params.EventId = evt.ID
+
+	log.With(
+		slog.String("session_id", sessionID),
+		slog.Int64("amount", params.Total),
+		slog.Int64("refunded", refunded),
+		slog.String("currency", params.Currency),
+		slog.String("tg_topic", entity.TopicPayment),
+	).Info("payment refunded")
+
+	return params
+}
+
 func (s *StripeClient) checkCustomer(sess *stripe.CheckoutSession) {
 	customer := sess.Customer
 	if customer == nil {
@@ -395,6 +602,9 @@ func (s *StripeClient) checkCustomer(sess *stripe.CheckoutSession) {
 }
 
 func (s *StripeClient) HoldAmount(params *entity.CheckoutParams) (*entity.Payment, error) {
+	if err := s.features.Check(entity.FeatureStripe); err != nil {
+		return nil, err
+	}
 	log := s.log.With(
 		slog.Int64("total", params.Total),
 		slog.String("currency", params.Currency),
@@ -404,20 +614,26 @@ func (s *StripeClient) HoldAmount(params *entity.CheckoutParams) (*entity.Paymen
 		s.saveCheckoutParams(params)
 	}()
 
-	successUrl := params.SuccessUrl
-	if successUrl == "" {
-		successUrl = s.successUrl
+	if params.IsSubscription() {
+		// Subscription sessions have no PaymentIntent to place a manual-capture hold on.
+		return nil, fmt.Errorf("subscriptions cannot be held, use a payment link")
 	}
+
+	successUrl := s.successURLFor(params)
 	if successUrl == "" {
 		return nil, fmt.Errorf("missing success url")
 	}
 
-	csParams := s.sessionParamsFromCheckout(params)
+	csParams := s.sessionParamsFromCheckout(params, successUrl)
 	csParams.PaymentIntentData = &stripe.CheckoutSessionPaymentIntentDataParams{
 		CaptureMethod: stripe.String("manual"),
 	}
+	if s.multicapture {
+		// Not typed on CheckoutSessionParams in this SDK version.
+		csParams.AddExtra("payment_method_options[card][request_multicapture]", "if_available")
+	}
 
-	cs, err := s.sc.CheckoutSessions.New(csParams)
+	cs, err := s.sc.NewCheckoutSession(csParams)
 	if err != nil {
 		err = s.parseErr(err)
 		return nil, fmt.Errorf("stripe response: %w", err)
@@ -426,6 +642,7 @@ func (s *StripeClient) HoldAmount(params *entity.CheckoutParams) (*entity.Paymen
 	params.Payload = cs
 	params.SessionId = cs.ID
 	params.Status = string(cs.Status)
+	params.Authorized = params.Total
 
 	payment := &entity.Payment{
 		Id:      cs.ID,
@@ -440,31 +657,88 @@ func (s *StripeClient) HoldAmount(params *entity.CheckoutParams) (*entity.Paymen
 	return payment, nil
 }
 
-// CaptureAmount captures a previously held PaymentIntent. On success it marks the
-// stored checkout params as paid and persists them (assigning a synthetic event id
-// when none exists yet) so the returned params can drive asynchronous invoice
-// registration and survive a retry-queue reload by event id.
-func (s *StripeClient) CaptureAmount(sessionId string, amount int64) (*entity.Payment, *entity.CheckoutParams, error) {
-	log := s.log.With(
-		slog.Int64("amount", amount),
-		slog.String("session_id", sessionId),
-	)
+// planCapture validates a capture request against the hold and returns the amount to
+// capture (the whole remainder when amount is 0) and whether this is the final capture.
+// Without multicapture, Stripe allows a single capture that releases any remainder, so
+// that capture is always final and a second one is rejected.
+func planCapture(params *entity.CheckoutParams, amount int64, multicapture bool) (int64, bool, error) {
+	remaining := params.CaptureRemaining()
+	if remaining <= 0 {
+		return 0, false, fmt.Errorf("payment already fully captured")
+	}
+	if params.Captured > 0 && !multicapture {
+		return 0, false, fmt.Errorf("payment already captured")
+	}
+	if amount == 0 {
+		amount = remaining
+	}
+	if amount < 0 {
+		return 0, false, fmt.Errorf("invalid capture amount %d", amount)
+	}
+	if amount > remaining {
+		return 0, false, fmt.Errorf("capture amount %d exceeds remaining authorization %d", amount, remaining)
+	}
+	return amount, !multicapture || amount == remaining, nil
+}
 
+// heldSession loads the checkout params of a hold by its Checkout Session id, the id the
+// hold response returns and capture/cancel take. A PaymentIntent id is refused with a
+// clear message instead of the generic "session not found".
+func (s *StripeClient) heldSession(log *slog.Logger, sessionId string) (*entity.CheckoutParams, error) {
+	if strings.HasPrefix(sessionId, "pi_") {
+		return nil, fmt.Errorf("expected a checkout session id (cs_...), got payment intent %s", sessionId)
+	}
 	params, err := s.db.GetCheckoutParamsSession(sessionId)
 	if err != nil {
 		log.With(
 			sl.Err(err),
 		).Warn("failed to get checkout params from database")
-		return nil, nil, fmt.Errorf("session not found")
+		return nil, fmt.Errorf("session not found")
 	}
 	if params == nil {
-		return nil, nil, fmt.Errorf("session not found")
+		return nil, fmt.Errorf("session not found")
+	}
+	return params, nil
+}
+
+// SessionParams returns the stored checkout params of a session, or nil when there are
+// none or they cannot be read.
+func (s *StripeClient) SessionParams(sessionId string) *entity.CheckoutParams {
+	if s.db == nil {
+		return nil
+	}
+	params, err := s.db.GetCheckoutParamsSession(sessionId)
+	if err != nil {
+		return nil
+	}
+	return params
+}
+
+// CaptureAmount captures a previously held PaymentIntent. With multicapture enabled the
+// hold can be captured in stages; the cumulative amount is tracked in Captured and a
+// capture beyond the held amount is rejected before reaching Stripe. On the final capture
+// it marks the stored checkout params as paid and persists them (assigning a synthetic
+// event id when none exists yet) so the returned params can drive asynchronous invoice
+// registration and survive a retry-queue reload by event id.
+func (s *StripeClient) CaptureAmount(sessionId string, amount int64) (*entity.Payment, *entity.CheckoutParams, error) {
+	if err := s.features.Check(entity.FeatureStripe); err != nil {
+		return nil, nil, err
+	}
+	log := s.log.With(
+		slog.Int64("amount", amount),
+		slog.String("session_id", sessionId),
+	)
+
+	params, err := s.heldSession(log, sessionId)
+	if err != nil {
+		return nil, nil, err
 	}
 	if params.PaymentId == "" {
 		return nil, nil, fmt.Errorf("payment id not found")
 	}
-	if amount == 0 {
-		amount = params.Total
+	amount, final, err := planCapture(params, amount, s.multicapture)
+	if err != nil {
+		return nil, params, err
 	}
 
 	log = log.With(
@@ -479,8 +753,11 @@ func (s *StripeClient) CaptureAmount(sessionId string, amount int64) (*entity.Pa
 	captureParams := &stripe.PaymentIntentCaptureParams{
 		AmountToCapture: stripe.Int64(amount),
 	}
+	if s.multicapture {
+		captureParams.FinalCapture = stripe.Bool(final)
+	}
 
-	result, err := s.sc.PaymentIntents.Capture(params.PaymentId, captureParams)
+	result, err := s.sc.CapturePaymentIntent(params.PaymentId, captureParams)
 	if err != nil {
 		err = s.parseErr(err)
 		// Return params so callers can log the order being captured (resolved from the
@@ -491,7 +768,16 @@ func (s *StripeClient) CaptureAmount(sessionId string, amount int64) (*entity.Pa
 	params.PaymentId = result.ID
 	params.Total = result.Amount
 	params.Status = string(result.Status)
-	params.Paid = true
+	params.Paid = final
+	if params.Authorized == 0 {
+		params.Authorized = result.Amount
+	}
+	// amount_received is cumulative across captures
+	if result.AmountReceived > 0 {
+		params.Captured = result.AmountReceived
+	} else {
+		params.Captured += amount
+	}
 	if params.EventId == "" {
 		params.EventId = "capture_" + result.ID
 	}
@@ -503,7 +789,10 @@ func (s *StripeClient) CaptureAmount(sessionId string, amount int64) (*entity.Pa
 		Amount:  result.Amount,
 	}
 
-	log.Info("capture amount successful")
+	log.With(
+		slog.Int64("captured", params.Captured),
+		slog.Bool("final", final),
+	).Info("capture amount successful")
 	return payment, params, nil
 }
 
@@ -516,7 +805,10 @@ var ErrPaymentIntentNotFound = errors.New("payment intent not found")
 // the amount captured so far. Used by the reconciler to decide per-hold actions.
 // Returns ErrPaymentIntentNotFound when Stripe reports the intent does not exist.
 func (s *StripeClient) PaymentIntentStatus(piID string) (status string, amountReceived int64, err error) {
-	pi, err := s.sc.PaymentIntents.Get(piID, nil)
+	if err = s.features.Check(entity.FeatureStripe); err != nil {
+		return "", 0, err
+	}
+	pi, err := s.sc.GetPaymentIntent(piID)
 	if err != nil {
 		var stripeErr *stripe.Error
 		if errors.As(err, &stripeErr) &&
@@ -553,7 +845,7 @@ func (s *StripeClient) PaymentStatus(orderId string) (*entity.PaymentStatus, err
 	}
 
 	if params.PaymentId != "" {
-		pi, err := s.sc.PaymentIntents.Get(params.PaymentId, nil)
+		pi, err := s.sc.GetPaymentIntent(params.PaymentId)
 		if err != nil {
 			return nil, fmt.Errorf("stripe response: %w", s.parseErr(err))
 		}
@@ -568,7 +860,7 @@ func (s *StripeClient) PaymentStatus(orderId string) (*entity.PaymentStatus, err
 	}
 
 	if params.SessionId != "" {
-		sess, err := s.sc.CheckoutSessions.Get(params.SessionId, nil)
+		sess, err := s.sc.GetCheckoutSession(params.SessionId, nil)
 		if err != nil {
 			return nil, fmt.Errorf("stripe response: %w", s.parseErr(err))
 		}
@@ -590,19 +882,16 @@ func (s *StripeClient) PaymentStatus(orderId string) (*entity.PaymentStatus, err
 // resolved from the session so callers can log the order being canceled (resolved from
 // the session) rather than whatever order_id the request carried.
 func (s *StripeClient) CancelPayment(sessionId, reason string) (*entity.Payment, *entity.CheckoutParams, error) {
+	if err := s.features.Check(entity.FeatureStripe); err != nil {
+		return nil, nil, err
+	}
 	log := s.log.With(
 		slog.String("session_id", sessionId),
 	)
 
-	params, err := s.db.GetCheckoutParamsSession(sessionId)
+	params, err := s.heldSession(log, sessionId)
 	if err != nil {
-		log.With(
-			sl.Err(err),
-		).Warn("failed to get checkout params from database")
-		return nil, nil, fmt.Errorf("session not found")
-	}
-	if params == nil {
-		return nil, nil, fmt.Errorf("session not found")
+		return nil, nil, err
 	}
 	if params.PaymentId == "" {
 		return nil, params, fmt.Errorf("payment id not found")
@@ -631,7 +920,7 @@ func (s *StripeClient) CancelPayment(sessionId, reason string) (*entity.Payment,
 		CancellationReason: stripe.String(reason),
 	}
 
-	result, err := s.sc.PaymentIntents.Cancel(params.PaymentId, cancelParams)
+	result, err := s.sc.CancelPaymentIntent(params.PaymentId, cancelParams)
 	if err != nil {
 		err = s.parseErr(err)
 		return nil, params, fmt.Errorf("stripe response: %w", err)
@@ -648,6 +937,9 @@ func (s *StripeClient) CancelPayment(sessionId, reason string) (*entity.Payment,
 }
 
 func (s *StripeClient) PayAmount(params *entity.CheckoutParams) (*entity.Payment, error) {
+	if err := s.features.Check(entity.FeatureStripe); err != nil {
+		return nil, err
+	}
 	log := s.log.With(
 		slog.Int64("total", params.Total),
 		slog.String("currency", params.Currency),
@@ -657,10 +949,7 @@ func (s *StripeClient) PayAmount(params *entity.CheckoutParams) (*entity.Payment
 		s.saveCheckoutParams(params)
 	}()
 
-	successUrl := params.SuccessUrl
-	if successUrl == "" {
-		successUrl = s.successUrl
-	}
+	successUrl := s.successURLFor(params)
 	if successUrl == "" {
 		return nil, fmt.Errorf("missing success url")
 	}
@@ -670,9 +959,9 @@ func (s *StripeClient) PayAmount(params *entity.CheckoutParams) (*entity.Payment
 	}
 	log = log.With(slog.String("email", params.ClientDetails.Email))
 
-	csParams := s.sessionParamsFromCheckout(params)
+	csParams := s.sessionParamsFromCheckout(params, successUrl)
 
-	cs, err := s.sc.CheckoutSessions.New(csParams)
+	cs, err := s.sc.NewCheckoutSession(csParams)
 	if err != nil {
 		err = s.parseErr(err)
 		return nil, fmt.Errorf("stripe checkout session: %w", err)
@@ -694,27 +983,90 @@ func (s *StripeClient) PayAmount(params *entity.CheckoutParams) (*entity.Payment
 	return payment, nil
 }
 
-func (s *StripeClient) sessionParamsFromCheckout(pm *entity.CheckoutParams) *stripe.CheckoutSessionParams {
+// successURLsBySource converts the configured per-source success URLs, skipping blanks.
+func successURLsBySource(urls map[string]string) map[entity.Source]string {
+	bySource := make(map[entity.Source]string, len(urls))
+	for source, url := range urls {
+		if url = strings.TrimSpace(url); url != "" {
+			bySource[entity.Source(strings.ToLower(strings.TrimSpace(source)))] = url
+		}
+	}
+	return bySource
+}
+
+// successURLFor picks the redirect after checkout: the order's own success URL, then the
+// one configured for its source, then the global one. Orders without a source come from
+// the API.
+func (s *StripeClient) successURLFor(params *entity.CheckoutParams) string {
+	if params.SuccessUrl != "" {
+		return params.SuccessUrl
+	}
+	source := params.Source
+	if source == "" {
+		source = entity.SourceApi
+	}
+	if url := s.successUrls[source]; url != "" {
+		return url
+	}
+	return s.successUrl
+}
+
+// sessionParamsFromCheckout builds the Checkout Session for the order. In subscription
+// mode every line gets a recurring price on the order's interval, so Stripe creates the
+// subscription and charges the whole cart each period. With automatic tax, Stripe Tax
+// computes the VAT included in the line prices, so the amount charged is unchanged.
+func (s *StripeClient) sessionParamsFromCheckout(pm *entity.CheckoutParams, successUrl string) *stripe.CheckoutSessionParams {
+	mode := stripe.CheckoutSessionModePayment
+	var recurring *stripe.CheckoutSessionLineItemPriceDataRecurringParams
+	if pm.IsSubscription() {
+		mode = stripe.CheckoutSessionModeSubscription
+		intervalCount := pm.IntervalCount
+		if intervalCount <= 0 {
+			intervalCount = 1
+		}
+		recurring = &stripe.CheckoutSessionLineItemPriceDataRecurringParams{
+			Interval:      stripe.String(pm.Interval),
+			IntervalCount: stripe.Int64(intervalCount),
+		}
+	}
+	var taxBehavior *string
+	if pm.AutomaticTax {
+		taxBehavior = stripe.String(string(stripe.PriceTaxBehaviorInclusive))
+	}
 	var lineItems []*stripe.CheckoutSessionLineItemParams
 	for _, item := range pm.LineItems {
 		lineItems = append(lineItems, &stripe.CheckoutSessionLineItemParams{
 			PriceData: &stripe.CheckoutSessionLineItemPriceDataParams{
 				Currency: stripe.String(pm.Currency),
 				ProductData: &stripe.CheckoutSessionLineItemPriceDataProductDataParams{
-					Name: stripe.String(item.Name),
+					Name: stripe.String(entity.TruncateName(item.Name, s.maxNameLength)),
 				},
-				UnitAmount: stripe.Int64(item.Price),
+				UnitAmount:  stripe.Int64(item.Price),
+				Recurring:   recurring,
+				TaxBehavior: taxBehavior,
 			},
 			Quantity: stripe.Int64(item.Qty),
 		})
 	}
-	return &stripe.CheckoutSessionParams{
-		Mode:          stripe.String(string(stripe.CheckoutSessionModePayment)),
+	params := &stripe.CheckoutSessionParams{
+		Mode:          stripe.String(string(mode)),
 		LineItems:     lineItems,
-		Metadata:      map[string]string{"order_id": pm.OrderId},
-		SuccessURL:    stripe.String(s.successUrl),
+		Metadata:      pm.StripeMetadata(),
+		SuccessURL:    stripe.String(successUrl),
 		CustomerEmail: stripe.String(strings.TrimSpace(pm.ClientDetails.Email)),
 	}
+	if pm.AutomaticTax {
+		params.AutomaticTax = &stripe.CheckoutSessionAutomaticTaxParams{Enabled: stripe.Bool(true)}
+	}
+	// Collected details land in the session's customer_details, which checkCustomer
+	// copies onto the invoice contractor.
+	if s.collectAddress {
+		params.BillingAddressCollection = stripe.String(string(stripe.CheckoutSessionBillingAddressCollectionRequired))
+	}
+	if s.collectPhone {
+		params.PhoneNumberCollection = &stripe.CheckoutSessionPhoneNumberCollectionParams{Enabled: stripe.Bool(true)}
+	}
+	return params
 }
 
 func (s *StripeClient) saveCheckoutParams(params *entity.CheckoutParams) {
@@ -0,0 +1,367 @@
+package stripeclient
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"wfsync/entity"
+	"wfsync/lib/clock"
+
+	"github.com/stripe/stripe-go/v76"
+	"github.com/stripe/stripe-go/v76/client"
+)
+
+// signHeader builds a Stripe-Signature header for payload signed at ts.
+func signHeader(secret string, ts int64, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(fmt.Sprintf("%d.", ts)))
+	mac.Write(payload)
+	return fmt.Sprintf("t=%d,v1=%s", ts, hex.EncodeToString(mac.Sum(nil)))
+}
+
+// TestVerifySignatureTolerance pins "now" with a mock clock to check the webhook age
+// limit at its boundary, along with signature tampering.
+func TestVerifySignatureTolerance(t *testing.T) {
+	const secret = "whsec_test"
+	payload := []byte(`{"id":"evt_1"}`)
+	signedAt := time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)
+	header := signHeader(secret, signedAt.Unix(), payload)
+	tolerance := 5 * time.Minute
+
+	cases := []struct {
+		name    string
+		now     time.Time
+		header  string
+		payload []byte
+		want    bool
+	}{
+		{"fresh", signedAt.Add(time.Second), header, payload, true},
+		{"at tolerance", signedAt.Add(tolerance), header, payload, true},
+		{"past tolerance", signedAt.Add(tolerance + time.Second), header, payload, false},
+		{"tampered payload", signedAt, header, []byte(`{"id":"evt_2"}`), false},
+		{"wrong secret", signedAt, signHeader("other", signedAt.Unix(), payload), payload, false},
+		{"missing signature", signedAt, fmt.Sprintf("t=%d", signedAt.Unix()), payload, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &StripeClient{
+				webhookSecret: secret,
+				log:           slog.New(slog.NewTextHandler(io.Discard, nil)),
+				clock:         clock.NewMock(tc.now),
+			}
+			if got := s.VerifySignature(tc.payload, tc.header, tolerance); got != tc.want {
+				t.Errorf("VerifySignature() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+// TestPlanCaptureStaged runs sequential partial captures against a multicapture hold:
+// they may sum up to the held amount, only the one reaching it is final, and anything
+// beyond the remainder is rejected.
+func TestPlanCaptureStaged(t *testing.T) {
+	params := &entity.CheckoutParams{Total: 10000, Authorized: 10000}
+
+	steps := []struct {
+		amount    int64
+		wantFinal bool
+	}{
+		{3000, false},
+		{2500, false},
+		{4500, true},
+	}
+	for i, step := range steps {
+		amount, final, err := planCapture(params, step.amount, true)
+		if err != nil {
+			t.Fatalf("capture %d: %v", i+1, err)
+		}
+		if amount != step.amount || final != step.wantFinal {
+			t.Fatalf("capture %d = (%d, %v), want (%d, %v)", i+1, amount, final, step.amount, step.wantFinal)
+		}
+		params.Captured += amount
+	}
+	if params.Captured != params.Authorized {
+		t.Fatalf("captured %d, want %d", params.Captured, params.Authorized)
+	}
+	if _, _, err := planCapture(params, 1, true); err == nil {
+		t.Error("capture after the hold was fully captured was accepted")
+	}
+}
+
+// TestPlanCaptureRejects covers over-capture and the single-capture rules without
+// multicapture.
+func TestPlanCaptureRejects(t *testing.T) {
+	cases := []struct {
+		name         string
+		params       entity.CheckoutParams
+		amount       int64
+		multicapture bool
+		wantAmount   int64
+		wantFinal    bool
+		wantErr      bool
+	}{
+		{"over-capture", entity.CheckoutParams{Authorized: 10000, Captured: 6000}, 4001, true, 0, false, true},
+		{"over-capture first", entity.CheckoutParams{Total: 10000}, 10001, false, 0, false, true},
+		{"negative amount", entity.CheckoutParams{Total: 10000}, -1, false, 0, false, true},
+		{"zero captures remainder", entity.CheckoutParams{Authorized: 10000, Captured: 6000}, 0, true, 4000, true, false},
+		{"legacy hold uses total", entity.CheckoutParams{Total: 5000}, 0, false, 5000, true, false},
+		{"single partial capture is final", entity.CheckoutParams{Total: 5000}, 2000, false, 2000, true, false},
+		{"second capture without multicapture", entity.CheckoutParams{Authorized: 5000, Captured: 2000}, 1000, false, 0, false, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			amount, final, err := planCapture(&tc.params, tc.amount, tc.multicapture)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("planCapture() error = %v, wantErr %v", err, tc.wantErr)
+			}
+			if amount != tc.wantAmount || final != tc.wantFinal {
+				t.Errorf("planCapture() = (%d, %v), want (%d, %v)", amount, final, tc.wantAmount, tc.wantFinal)
+			}
+		})
+	}
+}
+
+// memDB stores checkout params by order id the way MongoDB.SaveCheckoutParams does.
+type memDB struct {
+	params map[string]*entity.CheckoutParams
+}
+
+func (m *memDB) Save(string, interface{}) error { return nil }
+
+func (m *memDB) SaveCheckoutParams(params *entity.CheckoutParams) error {
+	stored := *params
+	m.params[params.OrderId] = &stored
+	return nil
+}
+
+func (m *memDB) GetCheckoutParamsForEvent(eventId string) (*entity.CheckoutParams, error) {
+	for _, p := range m.params {
+		if p.EventId == eventId {
+			stored := *p
+			return &stored, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *memDB) GetCheckoutParamsSession(sessionId string) (*entity.CheckoutParams, error) {
+	for _, p := range m.params {
+		if p.SessionId == sessionId {
+			stored := *p
+			return &stored, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *memDB) GetCheckoutParamsByOrder(orderId string) (*entity.CheckoutParams, error) {
+	return m.params[orderId], nil
+}
+
+// TestCheckoutCompletedEnablesCapture replays a checkout.session.completed event for a
+// manual-capture session against a fake Stripe API: the stored params must carry the
+// PaymentIntent id, and a capture by session id must then reach that PaymentIntent.
+func TestCheckoutCompletedEnablesCapture(t *testing.T) {
+	var capturedPI string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v1/checkout/sessions/cs_test_1":
+			_, _ = io.WriteString(w, `{"id":"cs_test_1","object":"checkout.session","mode":"payment",
+				"status":"complete","payment_status":"unpaid","amount_total":10000,"currency":"pln",
+				"metadata":{"order_id":"123"},"payment_intent":"pi_test_1"}`)
+		case r.Method == http.MethodPost && r.URL.Path == "/v1/payment_intents/pi_test_1/capture":
+			capturedPI = "pi_test_1"
+			_, _ = io.WriteString(w, `{"id":"pi_test_1","object":"payment_intent","amount":10000,
+				"amount_received":10000,"currency":"pln","status":"succeeded"}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	backend := stripe.GetBackendWithConfig(stripe.APIBackend, &stripe.BackendConfig{
+		URL:               stripe.String(srv.URL),
+		HTTPClient:        srv.Client(),
+		LeveledLogger:     &stripe.LeveledLogger{Level: stripe.LevelNull},
+		MaxNetworkRetries: stripe.Int64(0),
+	})
+	sc := &client.API{}
+	sc.Init("sk_test_123", &stripe.Backends{API: backend, Connect: backend, Uploads: backend})
+
+	db := &memDB{params: map[string]*entity.CheckoutParams{}}
+	s := &StripeClient{
+		sc:    NewAPI(sc),
+		db:    db,
+		log:   slog.New(slog.NewTextHandler(io.Discard, nil)),
+		clock: clock.Real,
+	}
+
+	evt := &stripe.Event{
+		ID:   "evt_test_1",
+		Type: stripe.EventTypeCheckoutSessionCompleted,
+		Data: &stripe.EventData{Object: map[string]interface{}{"id": "cs_test_1"}},
+	}
+	if params := s.HandleEvent(evt); params == nil {
+		t.Fatal("HandleEvent returned no params")
+	}
+	stored := db.params["123"]
+	if stored == nil || stored.PaymentId != "pi_test_1" {
+		t.Fatalf("stored params = %+v, want payment_id pi_test_1", stored)
+	}
+
+	payment, params, err := s.CaptureAmount("cs_test_1", 0)
+	if err != nil {
+		t.Fatalf("CaptureAmount: %v", err)
+	}
+	if capturedPI != "pi_test_1" || payment.Id != "pi_test_1" {
+		t.Errorf("captured %q (payment %q), want pi_test_1", capturedPI, payment.Id)
+	}
+	if !params.Paid || params.Captured != 10000 {
+		t.Errorf("params after capture: paid=%v captured=%d, want paid with 10000", params.Paid, params.Captured)
+	}
+}
+
+// TestSuccessURLFor checks the redirect precedence: the order's own URL, then the URL
+// configured for its source, then the global one — and that the session carries it.
+func TestSuccessURLFor(t *testing.T) {
+	s := &StripeClient{
+		successUrl: "https://shop.example.com/thanks",
+		successUrls: successURLsBySource(map[string]string{
+			"OpenCart": "https://shop.example.com/oc/success",
+			"b2b":      "https://b2b.example.com/paid",
+			"api":      " ",
+		}),
+	}
+
+	cases := []struct {
+		name   string
+		params entity.CheckoutParams
+		want   string
+	}{
+		{"order url wins", entity.CheckoutParams{Source: entity.SourceOpenCart, SuccessUrl: "https://x.example.com/ok"}, "https://x.example.com/ok"},
+		{"opencart source", entity.CheckoutParams{Source: entity.SourceOpenCart}, "https://shop.example.com/oc/success"},
+		{"b2b source", entity.CheckoutParams{Source: entity.SourceB2B}, "https://b2b.example.com/paid"},
+		{"blank source url falls back", entity.CheckoutParams{Source: entity.SourceApi}, "https://shop.example.com/thanks"},
+		{"no source is api", entity.CheckoutParams{}, "https://shop.example.com/thanks"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := s.successURLFor(&tc.params)
+			if got != tc.want {
+				t.Fatalf("successURLFor() = %q, want %q", got, tc.want)
+			}
+			tc.params.ClientDetails = &entity.ClientDetails{Email: "c@example.com"}
+			session := s.sessionParamsFromCheckout(&tc.params, got)
+			if session.SuccessURL == nil || *session.SuccessURL != tc.want {
+				t.Errorf("session success_url = %v, want %q", session.SuccessURL, tc.want)
+			}
+		})
+	}
+}
+
+// TestSessionParamsSubscription checks that subscription orders produce a subscription
+// session with every line priced on the order's interval, and one-time orders do not.
+func TestSessionParamsSubscription(t *testing.T) {
+	s := &StripeClient{}
+	items := []*entity.LineItem{
+		{Name: "Support plan", Qty: 1, Price: 20000},
+		{Name: "Extra seat", Qty: 3, Price: 5000},
+	}
+	client := &entity.ClientDetails{Email: "b2b@example.com"}
+
+	cases := []struct {
+		name      string
+		params    entity.CheckoutParams
+		wantMode  stripe.CheckoutSessionMode
+		wantEvery string
+		wantCount int64
+	}{
+		{"one-time", entity.CheckoutParams{}, stripe.CheckoutSessionModePayment, "", 0},
+		{"monthly", entity.CheckoutParams{Mode: entity.ModeSubscription, Interval: "month"}, stripe.CheckoutSessionModeSubscription, "month", 1},
+		{"quarterly", entity.CheckoutParams{Mode: entity.ModeSubscription, Interval: "month", IntervalCount: 3}, stripe.CheckoutSessionModeSubscription, "month", 3},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.params.LineItems = items
+			tc.params.ClientDetails = client
+			tc.params.Currency = "pln"
+			got := s.sessionParamsFromCheckout(&tc.params, "https://example.com/ok")
+			if *got.Mode != string(tc.wantMode) {
+				t.Fatalf("mode = %s, want %s", *got.Mode, tc.wantMode)
+			}
+			for _, li := range got.LineItems {
+				recurring := li.PriceData.Recurring
+				if tc.wantEvery == "" {
+					if recurring != nil {
+						t.Errorf("%s: unexpected recurring price", *li.PriceData.ProductData.Name)
+					}
+					continue
+				}
+				if recurring == nil || *recurring.Interval != tc.wantEvery || *recurring.IntervalCount != tc.wantCount {
+					t.Errorf("%s: recurring = %+v, want every %d %s", *li.PriceData.ProductData.Name, recurring, tc.wantCount, tc.wantEvery)
+				}
+			}
+		})
+	}
+}
+
+// TestSessionParamsAutomaticTax checks that an automatic-tax order enables Stripe Tax on
+// the session with tax-inclusive prices, and that other orders leave both unset.
+func TestSessionParamsAutomaticTax(t *testing.T) {
+	s := &StripeClient{}
+	for _, automatic := range []bool{true, false} {
+		params := &entity.CheckoutParams{
+			ClientDetails: &entity.ClientDetails{Email: "c@example.com"},
+			LineItems:     []*entity.LineItem{{Name: "Book", Qty: 1, Price: 12300}},
+			Currency:      "pln",
+			AutomaticTax:  automatic,
+		}
+		got := s.sessionParamsFromCheckout(params, "https://example.com/ok")
+		enabled := got.AutomaticTax != nil && got.AutomaticTax.Enabled != nil && *got.AutomaticTax.Enabled
+		if enabled != automatic {
+			t.Errorf("automatic=%v: session automatic_tax enabled = %v", automatic, enabled)
+		}
+		behavior := got.LineItems[0].PriceData.TaxBehavior
+		switch {
+		case automatic && (behavior == nil || *behavior != "inclusive"):
+			t.Errorf("automatic tax: line tax_behavior = %v, want inclusive", behavior)
+		case !automatic && behavior != nil:
+			t.Errorf("no automatic tax: line tax_behavior = %q, want unset", *behavior)
+		}
+		if *got.LineItems[0].PriceData.UnitAmount != 12300 {
+			t.Errorf("automatic=%v: unit amount changed to %d", automatic, *got.LineItems[0].PriceData.UnitAmount)
+		}
+	}
+}
+
+// TestSessionParamsCollectDetails checks that sessions require the billing address and
+// enable phone collection when configured, and request neither when turned off.
+func TestSessionParamsCollectDetails(t *testing.T) {
+	params := &entity.CheckoutParams{
+		ClientDetails: &entity.ClientDetails{Email: "c@example.com"},
+		LineItems:     []*entity.LineItem{{Name: "Book", Qty: 1, Price: 5000}},
+		Currency:      "pln",
+	}
+
+	s := &StripeClient{collectAddress: true, collectPhone: true}
+	got := s.sessionParamsFromCheckout(params, "https://example.com/ok")
+	if got.BillingAddressCollection == nil || *got.BillingAddressCollection != "required" {
+		t.Errorf("billing_address_collection = %v, want required", got.BillingAddressCollection)
+	}
+	if got.PhoneNumberCollection == nil || got.PhoneNumberCollection.Enabled == nil || !*got.PhoneNumberCollection.Enabled {
+		t.Errorf("phone_number_collection = %+v, want enabled", got.PhoneNumberCollection)
+	}
+
+	off := (&StripeClient{}).sessionParamsFromCheckout(params, "https://example.com/ok")
+	if off.BillingAddressCollection != nil || off.PhoneNumberCollection != nil {
+		t.Errorf("collection requested while disabled: address=%v phone=%+v", off.BillingAddressCollection, off.PhoneNumberCollection)
+	}
+}
@@ -0,0 +1,70 @@
+package wfirma
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"wfsync/lib/sl"
+)
+
+// authStatusCode is the response status wFirma returns when it rejects the credentials
+// of a request that otherwise reached the API.
+const authStatusCode = "AUTH"
+
+// CredentialsRefresher re-issues the API keys after wFirma rejected the current ones,
+// for deployments whose keys rotate. The keys it returns replace the configured ones.
+type CredentialsRefresher interface {
+	RefreshCredentials(ctx context.Context) (accessKey, secretKey string, err error)
+}
+
+// SetCredentialsRefresher injects the hook request calls once after an auth failure.
+// Without one, the request is simply retried once with the same keys.
+func (c *Client) SetCredentialsRefresher(r CredentialsRefresher) {
+	c.refresher = r
+}
+
+// setAuthHeaders signs a request with the current keys.
+func (c *Client) setAuthHeaders(req *http.Request) {
+	c.authMu.RLock()
+	defer c.authMu.RUnlock()
+	req.Header.Set("appKey", c.appID)
+	req.Header.Set("accessKey", c.accessKey)
+	req.Header.Set("secretKey", c.secretKey)
+}
+
+// isAuthFailure reports whether a response rejects the request's credentials: HTTP 401
+// or 403, or a JSON body with status code AUTH.
+func isAuthFailure(statusCode int, body []byte) bool {
+	if statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden {
+		return true
+	}
+	if !bytes.Contains(body, []byte(`"`+authStatusCode+`"`)) {
+		return false
+	}
+	var resp struct {
+		Status Status `json:"status"`
+	}
+	return json.Unmarshal(body, &resp) == nil && resp.Status.Code == authStatusCode
+}
+
+// reauth runs the credentials refresher, if any, before the single retry of a request
+// that failed authentication.
+func (c *Client) reauth(ctx context.Context, log *slog.Logger) error {
+	if c.refresher == nil {
+		log.Warn("wFirma rejected credentials, retrying once")
+		return nil
+	}
+	accessKey, secretKey, err := c.refresher.RefreshCredentials(ctx)
+	if err != nil {
+		log.Error("refresh wFirma credentials", sl.Err(err))
+		return fmt.Errorf("refresh credentials: %w", err)
+	}
+	c.authMu.Lock()
+	c.accessKey, c.secretKey = accessKey, secretKey
+	c.authMu.Unlock()
+	log.Warn("wFirma rejected credentials, refreshed and retrying once")
+	return nil
+}
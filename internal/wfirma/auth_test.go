@@ -0,0 +1,122 @@
+package wfirma
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+	"wfsync/entity"
+	"wfsync/lib/features"
+)
+
+// authDoer answers with canned status codes and bodies, in order, and records the
+// access key each request was signed with.
+type authDoer struct {
+	statuses []int
+	bodies   []string
+	keys     []string
+}
+
+func (d *authDoer) Do(req *http.Request) (*http.Response, error) {
+	d.keys = append(d.keys, req.Header.Get("accessKey"))
+	status, body := d.statuses[0], d.bodies[0]
+	d.statuses, d.bodies = d.statuses[1:], d.bodies[1:]
+	return &http.Response{
+		StatusCode: status,
+		Status:     http.StatusText(status),
+		Body:       io.NopCloser(strings.NewReader(body)),
+	}, nil
+}
+
+type fakeRefresher struct {
+	calls int
+	err   error
+}
+
+func (r *fakeRefresher) RefreshCredentials(context.Context) (string, string, error) {
+	r.calls++
+	return "access-2", "secret-2", r.err
+}
+
+// TestRequestReauth checks the auth-failure path of request: a rejected request is
+// retried exactly once, after the refresher supplied new keys, and succeeds; a second
+// rejection or a failing refresher fails the request.
+func TestRequestReauth(t *testing.T) {
+	const ok = `{"status":{"code":"OK"}}`
+	const authBody = `{"status":{"code":"AUTH","message":"Authentication failed"}}`
+
+	cases := []struct {
+		name      string
+		statuses  []int
+		bodies    []string
+		refresher *fakeRefresher
+		wantErr   bool
+		wantKeys  []string
+		wantCalls int
+	}{
+		{"401 then ok", []int{401, 200}, []string{"", ok}, &fakeRefresher{}, false, []string{"access-1", "access-2"}, 1},
+		{"auth status then ok", []int{200, 200}, []string{authBody, ok}, &fakeRefresher{}, false, []string{"access-1", "access-2"}, 1},
+		{"no refresher retries same keys", []int{403, 200}, []string{"", ok}, nil, false, []string{"access-1", "access-1"}, 0},
+		{"rejected twice", []int{401, 401}, []string{"", ""}, &fakeRefresher{}, true, []string{"access-1", "access-2"}, 1},
+		{"refresher fails", []int{401}, []string{""}, &fakeRefresher{err: errors.New("token endpoint down")}, true, []string{"access-1"}, 1},
+		{"other error not retried", []int{500}, []string{"boom"}, &fakeRefresher{}, true, []string{"access-1"}, 0},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			hc := &authDoer{statuses: tc.statuses, bodies: tc.bodies}
+			c := &Client{
+				hc:        hc,
+				baseURL:   "https://api.wfirma.test",
+				accessKey: "access-1",
+				secretKey: "secret-1",
+				log:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+			}
+			if tc.refresher != nil {
+				c.SetCredentialsRefresher(tc.refresher)
+			}
+
+			body, err := c.request(context.Background(), "invoices", "find", map[string]string{})
+			if tc.wantErr != (err != nil) {
+				t.Fatalf("request error = %v, want error %v", err, tc.wantErr)
+			}
+			if !tc.wantErr && string(body) != ok {
+				t.Errorf("body = %q, want the retried response", body)
+			}
+			if strings.Join(hc.keys, ",") != strings.Join(tc.wantKeys, ",") {
+				t.Errorf("requests signed with %v, want %v", hc.keys, tc.wantKeys)
+			}
+			if tc.refresher != nil && tc.refresher.calls != tc.wantCalls {
+				t.Errorf("refresher calls = %d, want %d", tc.refresher.calls, tc.wantCalls)
+			}
+		})
+	}
+}
+
+// flagStore serves fixed feature flags.
+type flagStore []*entity.FeatureFlag
+
+func (s flagStore) GetFeatureFlags() ([]*entity.FeatureFlag, error) { return s, nil }
+
+func (s flagStore) SaveFeatureFlag(*entity.FeatureFlag) error { return nil }
+
+// TestRequestFeatureDisabled checks that with the wFirma feature flag off, API calls and
+// document downloads fail with ErrSubsystemDisabled without sending anything.
+func TestRequestFeatureDisabled(t *testing.T) {
+	hc := &authDoer{}
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	c := &Client{hc: hc, baseURL: "https://api.wfirma.test", log: log}
+	c.SetFeatures(features.New(flagStore{{Name: entity.FeatureWFirma}}, log))
+
+	if _, err := c.request(context.Background(), "invoices", "find", map[string]string{}); !errors.Is(err, entity.ErrSubsystemDisabled) {
+		t.Errorf("request error = %v, want ErrSubsystemDisabled", err)
+	}
+	if _, _, _, err := c.openDownload(context.Background(), "1", log); !errors.Is(err, entity.ErrSubsystemDisabled) {
+		t.Errorf("openDownload error = %v, want ErrSubsystemDisabled", err)
+	}
+	if len(hc.keys) != 0 {
+		t.Errorf("%d requests sent", len(hc.keys))
+	}
+}
@@ -35,6 +35,28 @@ type bankAccountWrapper struct {
 	} `json:"company_account"`
 }
 
+// Ping checks that wFirma accepts the credentials by listing the company accounts, for
+// the health endpoint.
+func (c *Client) Ping(ctx context.Context) error {
+	payload := map[string]interface{}{
+		"api": map[string]interface{}{
+			"company_accounts": map[string]interface{}{},
+		},
+	}
+	res, err := c.request(ctx, "company_accounts", "find", payload)
+	if err != nil {
+		return err
+	}
+	var resp bankAccountResponse
+	if err = json.Unmarshal(res, &resp); err != nil {
+		return fmt.Errorf("unmarshal company accounts: %w", err)
+	}
+	if resp.Status.Code != "OK" {
+		return fmt.Errorf("wFirma status: %s", resp.Status.Code)
+	}
+	return nil
+}
+
 // SyncBankAccounts fetches all company accounts from wFirma and upserts them
 // into the local DB. The is_allowed flag is preserved across syncs (set only
 // on first insert; manual operator toggles are never overwritten).
@@ -7,11 +7,15 @@
 // File layout:
 //
 //	client.go      — Client struct, interfaces, constructor, HTTP transport
+//	auth.go        — auth failure detection and the one-time credentials refresh
 //	contractor.go  — contractor find/create operations
 //	goods.go       — goods catalog (SKU) lookups
 //	vat.go         — VAT code constants and resolution logic
 //	vat-codes.go   — wFirma vat_code/declaration_country fetching, caching, and OSS resolution
 //	invoice.go     — invoice creation, download, payment registration
+//	correction.go  — corrective invoices (faktura korygująca) for refunds
+//	description.go — configurable invoice description template
+//	tax-summary.go — per-rate tax summary returned with created invoices
 //	sync.go        — bidirectional sync between local DB and wFirma
 //	entity.go      — request/response payload structs
 //	response.go    — API response wrapper types
@@ -26,10 +30,14 @@ import (
 	"log/slog"
 	"net/http"
 	"net/url"
+	"strings"
 	"sync"
+	"text/template"
 	"time"
 	"wfsync/entity"
 	"wfsync/internal/config"
+	"wfsync/lib/features"
+	"wfsync/lib/httpclient"
 	"wfsync/lib/sl"
 )
 
@@ -63,21 +71,42 @@ type Database interface {
 	GetAllowedBankAccount(currency string) (*entity.BankAccount, error)
 }
 
+// doer sends HTTP requests. *http.Client satisfies it; tests substitute a stub that
+// answers without a server.
+type doer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
 // Client is the wFirma API client. Use NewClient to create one.
 type Client struct {
 	enabled          bool
 	draftFallback    bool          // fall back to a KSeF-free draft when wFirma rejects on KSeF authorization
 	ksefDownloadWait time.Duration // max wait for KSeF processing before downloading; 0 disables the gate
-	hc               *http.Client
+	defaultVatRate   int           // domestic rate when the order carries no tax data
+	defaultCountry   string        // contractor country when the order has none
+	defaultCity      string        // contractor city when the order has none
+	defaultZip       string        // contractor zip when the order has none
+	hc               doer
 	db               Database
 	vatRates         VATProvider
 	vies             VIESProvider
+	features         *features.Flags
 	baseURL          string
+	authMu           sync.RWMutex // guards accessKey, secretKey; see auth.go
 	accessKey        string
 	secretKey        string
 	appID            string
+	refresher        CredentialsRefresher
 	filePath         string
 	log              *slog.Logger
+	paymentMethods   map[string]string            // store payment code (lowercase) → wFirma payment method
+	shippingVatCode  string                       // fixed VAT code for shipping lines; empty follows the goods rate
+	maxNameLength    int                          // line name cap; 0 disables truncation
+	descriptionTmpl  *template.Template           // invoice description; see description.go
+	taxTitleTmpl     *template.Template           // tax summary title; see tax-summary.go
+	decimalSeparator string                       // decimal separator of formatted amounts
+	defaultSeries    string                       // numbering series id for VAT invoices; empty = wFirma default
+	seriesBySource   map[entity.Source]string     // per-source series overrides
 	cacheMu          sync.Mutex                   // guards vatCodes, ossVatCodes, declCountries
 	vatCodes         map[string]string            // cached Polish vat code name → wFirma ID (e.g. "23" → "222")
 	ossVatCodes      map[string]map[string]string // cached declaration_country_id → normalized rate ("27") → wFirma vat_code ID
@@ -91,25 +120,49 @@ type Config struct {
 	AppID     string
 }
 
-func NewClient(conf *config.Config, logger *slog.Logger) *Client {
+// NewClient fails when the outbound HTTP client is misconfigured (proxy URL, CA file):
+// silently falling back to a direct connection would bypass the configured proxy.
+func NewClient(conf *config.Config, logger *slog.Logger) (*Client, error) {
+	log := logger.With(sl.Module("wfirma"))
+	hc, err := httpclient.New(conf.HTTPClient.Options(), 55*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("outbound http client: %w", err)
+	}
 	return &Client{
 		enabled:          conf.WFirma.Enabled,
 		draftFallback:    conf.WFirma.KSefDraftFallback,
 		ksefDownloadWait: time.Duration(conf.WFirma.KSefDownloadWaitSeconds) * time.Second,
-		hc:               &http.Client{Timeout: 55 * time.Second},
+		defaultVatRate:   conf.WFirma.DefaultVATRate,
+		defaultCountry:   strings.ToUpper(conf.WFirma.DefaultCountry),
+		defaultCity:      conf.WFirma.DefaultCity,
+		defaultZip:       conf.WFirma.DefaultZip,
+		paymentMethods:   newPaymentMethods(conf.WFirma.PaymentMethods, log),
+		shippingVatCode:  strings.ToUpper(strings.TrimSpace(conf.WFirma.ShippingVATCode)),
+		maxNameLength:    conf.WFirma.MaxNameLength,
+		descriptionTmpl:  newDescriptionTemplate(conf.WFirma.DescriptionTemplate, log),
+		taxTitleTmpl:     newTaxTitleTemplate(conf.WFirma.TaxTitle, log),
+		decimalSeparator: conf.WFirma.DecimalSeparator,
+		defaultSeries:    strings.TrimSpace(conf.WFirma.DefaultSeries),
+		seriesBySource:   seriesBySource(conf.WFirma.Series),
+		hc:               hc,
 		baseURL:          "https://api2.wfirma.pl",
 		accessKey:        conf.WFirma.AccessKey,
 		secretKey:        conf.WFirma.SecretKey,
 		appID:            conf.WFirma.AppID,
 		filePath:         conf.FilePath,
-		log:              logger.With(sl.Module("wfirma")),
-	}
+		log:              log,
+	}, nil
 }
 
 func (c *Client) SetDatabase(db Database) {
 	c.db = db
 }
 
+// SetFeatures makes every API call check the wFirma feature flag first.
+func (c *Client) SetFeatures(f *features.Flags) {
+	c.features = f
+}
+
 // SetVATProvider injects a dynamic EU VAT rate provider.
 // When set, resolveGoodsVatCode uses it instead of the hardcoded euCountries map.
 func (c *Client) SetVATProvider(vp VATProvider) {
@@ -137,8 +190,12 @@ func (c *Client) SetVIESProvider(vp VIESProvider) {
 
 // request sends a signed POST to the wFirma API (https://api2.wfirma.pl).
 // All endpoints use POST with JSON input/output.
-// Auth is via HTTP headers: appKey, accessKey, secretKey.
+// Auth is via HTTP headers: appKey, accessKey, secretKey. A response rejecting the
+// credentials is retried once, after the credentials refresher (if any) has run.
 func (c *Client) request(ctx context.Context, module, action string, payload interface{}) ([]byte, error) {
+	if err := c.features.Check(entity.FeatureWFirma); err != nil {
+		return nil, err
+	}
 	log := c.log.With(
 		slog.String("module", module),
 		slog.String("action", action),
@@ -154,34 +211,49 @@ func (c *Client) request(ctx context.Context, module, action string, payload int
 	q.Set("outputFormat", "json")
 	endpoint := fmt.Sprintf("%s/%s/%s?%s", c.baseURL, module, action, q.Encode())
 
+	resp, body, err := c.send(ctx, log, endpoint, data)
+	if err != nil {
+		return nil, err
+	}
+	if isAuthFailure(resp.StatusCode, body) {
+		if err = c.reauth(ctx, log); err != nil {
+			return nil, err
+		}
+		if resp, body, err = c.send(ctx, log, endpoint, data); err != nil {
+			return nil, err
+		}
+	}
+
+	if resp.StatusCode >= 300 {
+		log.Error("wFirma API returned error",
+			slog.String("status", resp.Status),
+			slog.String("body", string(body)))
+		return nil, fmt.Errorf("wfirma %s: %s", resp.Status, body)
+	}
+
+	return body, nil
+}
+
+// send posts one signed request and reads the whole response.
+func (c *Client) send(ctx context.Context, log *slog.Logger, endpoint string, data []byte) (*http.Response, []byte, error) {
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(data))
 	if err != nil {
 		log.Error("create request", slog.String("error", err.Error()))
-		return nil, err
+		return nil, nil, err
 	}
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("appKey", c.appID)
-	req.Header.Set("accessKey", c.accessKey)
-	req.Header.Set("secretKey", c.secretKey)
+	c.setAuthHeaders(req)
 
 	resp, err := c.hc.Do(req)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	defer func(Body io.ReadCloser) {
 		_ = Body.Close()
 	}(resp.Body)
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("read response body: %w", err)
+		return nil, nil, fmt.Errorf("read response body: %w", err)
 	}
-
-	if resp.StatusCode >= 300 {
-		log.Error("wFirma API returned error",
-			slog.String("status", resp.Status),
-			slog.String("body", string(body)))
-		return nil, fmt.Errorf("wfirma %s: %s", resp.Status, body)
-	}
-
-	return body, nil
+	return resp, body, nil
 }
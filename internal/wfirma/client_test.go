@@ -0,0 +1,28 @@
+package wfirma
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+	"wfsync/internal/config"
+)
+
+// TestNewClientInvalidHTTPClient checks a misconfigured proxy or CA file fails the
+// constructor instead of falling back to a direct connection.
+func TestNewClientInvalidHTTPClient(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cases := map[string]config.HTTPClient{
+		"proxy":   {Proxy: "proxy.local:3128"},
+		"ca file": {CAFile: "/nonexistent/ca.pem"},
+	}
+	for name, hc := range cases {
+		t.Run(name, func(t *testing.T) {
+			if _, err := NewClient(&config.Config{HTTPClient: hc}, log); err == nil {
+				t.Error("NewClient succeeded, want an error")
+			}
+		})
+	}
+	if _, err := NewClient(&config.Config{}, log); err != nil {
+		t.Errorf("NewClient without http_client: %v", err)
+	}
+}
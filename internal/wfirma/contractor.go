@@ -6,43 +6,40 @@ import (
 	"fmt"
 	"log/slog"
 	"strings"
+	"unicode"
 	"wfsync/entity"
 	"wfsync/lib/sl"
+
+	"github.com/biter777/countries"
 )
 
 // createContractor registers a new contractor in wFirma and returns its ID.
 //
 // wFirma mandatory fields: name, zip, city (API returns validation error if any is empty).
-// The function defaults name to "Kontrahent <email>", zip to "01-001", city to "Warszawa".
+// Missing values are filled by applyContractorDefaults.
 //
-// Optional fields sent: email, country (ISO 3166 alpha-2), street, nip, tax_id_type.
+// Optional fields sent: email, phone (E.164), country (ISO 3166 alpha-2), street, nip, tax_id_type.
 // tax_id_type: "none" = no tax ID provided, "custom" = tax ID present in the nip field.
 // Using "none"/"custom" (instead of "other") allows wFirma to accept custom VAT rates on invoices.
 func (c *Client) createContractor(ctx context.Context, customer *entity.ClientDetails) (string, error) {
 	if customer == nil {
 		return "", fmt.Errorf("no customer")
 	}
-	if customer.Name == "" {
-		customer.Name = "Kontrahent " + customer.Email
-	}
-	if customer.ZipCode == "" {
-		customer.ZipCode = "01-001"
-	}
-	if customer.City == "" {
-		customer.City = "Warszawa"
-	}
+	countryCode := c.applyContractorDefaults(customer)
 	taxIdType := "none"
 	if customer.TaxId != "" {
 		taxIdType = "custom"
 	}
 
-	countryCode := customer.CountryCode()
-	if countryCode == "PL" {
-		customer.ZipCode = customer.NormalizeZipCode()
-	}
 	// Foreign EU buyers need the country prefix on their VAT-UE number or wFirma
 	// rejects 0% WDT / EU reverse-charge invoices (contractor.nip validation).
 	nip := normalizeEUVatNumber(countryCode, customer.TaxId)
+	phone := normalizePhone(countryCode, customer.Phone)
+	if phone == "" && customer.Phone != "" {
+		c.log.Debug("phone number dropped",
+			slog.String("email", customer.Email),
+			slog.String("phone", customer.Phone))
+	}
 
 	// If not found, create a new contractor.
 	payload := map[string]interface{}{
@@ -52,10 +49,11 @@ func (c *Client) createContractor(ctx context.Context, customer *entity.ClientDe
 					"contractor": map[string]interface{}{
 						"name":        customer.Name,
 						"email":       customer.Email,
+						"phone":       phone,
 						"country":     countryCode,
 						"zip":         customer.ZipCode,
 						"city":        customer.City,
-						"street":      customer.Street,
+						"street":      customer.StreetAddress(),
 						"tax_id_type": taxIdType,
 						"nip":         nip,
 					},
@@ -104,6 +102,34 @@ func (c *Client) createContractor(ctx context.Context, customer *entity.ClientDe
 	return contr.ID, nil
 }
 
+// applyContractorDefaults fills the mandatory contractor fields the order left empty and
+// returns the effective country code. Name defaults to "Kontrahent <email>"; country,
+// city and zip come from the deployment config, the city and zip only for customers in
+// the default country, as they are an address there. The zip is formatted for the
+// effective country, so a configured Polish fallback and a customer's "01001" both
+// become "01-001".
+func (c *Client) applyContractorDefaults(customer *entity.ClientDetails) string {
+	if customer.Name == "" {
+		customer.Name = "Kontrahent " + customer.Email
+	}
+	countryCode := customer.CountryCode()
+	if countryCode == "" {
+		countryCode = c.defaultCountry
+	}
+	if countryCode == c.defaultCountry {
+		if customer.ZipCode == "" {
+			customer.ZipCode = c.defaultZip
+		}
+		if customer.City == "" {
+			customer.City = c.defaultCity
+		}
+	}
+	if countryCode == "PL" && customer.ZipCode != "" {
+		customer.ZipCode = customer.NormalizeZipCode()
+	}
+	return countryCode
+}
+
 // syncContractor refreshes an existing wFirma contractor from the current order.
 //
 // wFirma prints the invoice header from the contractor record, not from the invoice
@@ -127,14 +153,16 @@ func (c *Client) syncContractor(ctx context.Context, stored *Contractor, custome
 	nip := normalizeEUVatNumber(countryCode, customer.TaxId)
 
 	fields := map[string]string{
+		"phone":   firstNonEmpty(normalizePhone(countryCode, customer.Phone), stored.Phone),
 		"name":    firstNonEmpty(customer.Name, stored.Name),
 		"country": firstNonEmpty(countryCode, stored.Country),
 		"zip":     firstNonEmpty(zip, stored.Zip),
 		"city":    firstNonEmpty(customer.City, stored.City),
-		"street":  firstNonEmpty(customer.Street, stored.Street),
+		"street":  firstNonEmpty(customer.StreetAddress(), stored.Street),
 		"nip":     firstNonEmpty(nip, stored.Nip),
 	}
 	current := map[string]string{
+		"phone":   stored.Phone,
 		"name":    stored.Name,
 		"country": stored.Country,
 		"zip":     stored.Zip,
@@ -194,6 +222,75 @@ func (c *Client) syncContractor(ctx context.Context, stored *Contractor, custome
 	return nil
 }
 
+// normalizePhone converts a free-form phone number into E.164 ("+48600123456") using the
+// buyer's country for numbers written without an international prefix. The phone is a
+// convenience field on the contractor, so anything that cannot be normalized confidently
+// returns "" and is left out instead of failing the invoice.
+func normalizePhone(countryCode, raw string) string {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return ""
+	}
+
+	international := strings.HasPrefix(raw, "+")
+	var digits strings.Builder
+	for i, r := range raw {
+		switch {
+		case unicode.IsDigit(r):
+			digits.WriteRune(r)
+		case r == '+' && i == 0:
+		case r == ' ' || r == '-' || r == '.' || r == '/' || r == '(' || r == ')':
+		default:
+			return "" // letters, extensions ("ext. 12") and the like
+		}
+	}
+	number := digits.String()
+	if !international && strings.HasPrefix(number, "00") {
+		international = true
+		number = number[2:]
+	}
+
+	if !international {
+		callCode := countryCallCode(countryCode)
+		if callCode == "" {
+			return ""
+		}
+		// A national number of 11+ digits that already starts with the calling code was
+		// typed without the "+" ("48600123456"); shorter ones are genuine national numbers.
+		if !(len(number) >= 11 && strings.HasPrefix(number, callCode)) {
+			// Italy keeps the leading 0 of landline numbers in the international format.
+			if countryCode != "IT" {
+				number = strings.TrimPrefix(number, "0")
+			}
+			number = callCode + number
+		}
+	}
+
+	// E.164 allows at most 15 digits; fewer than 8 cannot hold a calling code plus a
+	// subscriber number anywhere we ship to.
+	if len(number) < 8 || len(number) > 15 || number[0] == '0' {
+		return ""
+	}
+	// Polish numbers are always nine digits, which catches the most common typos.
+	if strings.HasPrefix(number, "48") && len(number) != 11 {
+		return ""
+	}
+	return "+" + number
+}
+
+// countryCallCode returns the international calling code for an ISO alpha-2 country
+// without the "+" ("48" for PL), or "" for unknown countries.
+func countryCallCode(countryCode string) string {
+	if countryCode == "" {
+		countryCode = "PL"
+	}
+	codes := countries.ByName(countryCode).CallCodes()
+	if len(codes) == 0 || codes[0] == countries.CallCodeUnknown {
+		return ""
+	}
+	return strings.TrimPrefix(codes[0].String(), "+")
+}
+
 // firstNonEmpty returns the first non-empty value, ignoring surrounding whitespace.
 func firstNonEmpty(values ...string) string {
 	for _, v := range values {
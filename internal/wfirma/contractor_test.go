@@ -0,0 +1,104 @@
+package wfirma
+
+import (
+	"testing"
+	"wfsync/entity"
+)
+
+// TestNormalizePhone covers the formats customers actually type at checkout: Polish
+// numbers with and without a prefix, foreign numbers resolved via the buyer's country,
+// and garbage that must be dropped rather than sent to wFirma.
+func TestNormalizePhone(t *testing.T) {
+	cases := []struct {
+		name    string
+		country string
+		phone   string
+		want    string
+	}{
+		{"PL national with spaces", "PL", "600 123 456", "+48600123456"},
+		{"PL national with dashes", "PL", "600-123-456", "+48600123456"},
+		{"PL already E.164", "PL", "+48 600 123 456", "+48600123456"},
+		{"PL 00 prefix", "PL", "0048600123456", "+48600123456"},
+		{"PL calling code without plus", "PL", "48600123456", "+48600123456"},
+		{"empty country treated as PL", "", "600123456", "+48600123456"},
+		{"PL too short dropped", "PL", "60012345", ""},
+		{"PL too long dropped", "PL", "+48 600 123 4567", ""},
+		{"DE national drops trunk zero", "DE", "030 1234567", "+49301234567"},
+		{"DE with parentheses", "DE", "(0151) 2345-6789", "+4915123456789"},
+		{"IT keeps leading zero", "IT", "06 1234 5678", "+390612345678"},
+		{"foreign number on PL order", "PL", "+44 20 7946 0958", "+442079460958"},
+		{"US number", "US", "(212) 555-0123", "+12125550123"},
+		{"extension dropped", "PL", "600123456 ext. 12", ""},
+		{"letters dropped", "PL", "brak", ""},
+		{"unknown country dropped", "XX", "600123456", ""},
+		{"empty phone", "PL", "", ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := normalizePhone(tc.country, tc.phone); got != tc.want {
+				t.Errorf("normalizePhone(%q, %q) = %q, want %q", tc.country, tc.phone, got, tc.want)
+			}
+		})
+	}
+}
+
+// TestApplyContractorDefaults checks that the configured fallbacks, not hardcoded Polish
+// ones, fill missing address fields, and that zip formatting follows the effective country.
+func TestApplyContractorDefaults(t *testing.T) {
+	de := &Client{defaultCountry: "DE", defaultCity: "Berlin", defaultZip: "10115"}
+	pl := &Client{defaultCountry: "PL", defaultCity: "Kraków", defaultZip: "31001"}
+
+	cases := []struct {
+		name        string
+		client      *Client
+		customer    entity.ClientDetails
+		wantCountry string
+		wantCity    string
+		wantZip     string
+		wantName    string
+	}{
+		{
+			name:        "empty address uses configured DE defaults",
+			client:      de,
+			customer:    entity.ClientDetails{Email: "a@example.com"},
+			wantCountry: "DE", wantCity: "Berlin", wantZip: "10115", wantName: "Kontrahent a@example.com",
+		},
+		{
+			name:        "PL fallback zip gets postal formatting",
+			client:      pl,
+			customer:    entity.ClientDetails{Name: "Jan", Email: "j@example.com"},
+			wantCountry: "PL", wantCity: "Kraków", wantZip: "31-001", wantName: "Jan",
+		},
+		{
+			name:        "customer fields win over defaults",
+			client:      de,
+			customer:    entity.ClientDetails{Name: "Anna", Country: "PL", City: "Gdańsk", ZipCode: "80001"},
+			wantCountry: "PL", wantCity: "Gdańsk", wantZip: "80-001", wantName: "Anna",
+		},
+		{
+			name:        "foreign zip left untouched",
+			client:      pl,
+			customer:    entity.ClientDetails{Name: "Max", Country: "DE", ZipCode: "10115"},
+			wantCountry: "DE", wantCity: "", wantZip: "10115", wantName: "Max",
+		},
+		{
+			name:        "foreign customer gets no default address",
+			client:      pl,
+			customer:    entity.ClientDetails{Name: "Max", Country: "DE"},
+			wantCountry: "DE", wantCity: "", wantZip: "", wantName: "Max",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			customer := tc.customer
+			country := tc.client.applyContractorDefaults(&customer)
+			if country != tc.wantCountry {
+				t.Errorf("country = %q, want %q", country, tc.wantCountry)
+			}
+			if customer.City != tc.wantCity || customer.ZipCode != tc.wantZip || customer.Name != tc.wantName {
+				t.Errorf("got name=%q city=%q zip=%q, want name=%q city=%q zip=%q",
+					customer.Name, customer.City, customer.ZipCode, tc.wantName, tc.wantCity, tc.wantZip)
+			}
+		})
+	}
+}
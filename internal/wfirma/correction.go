@@ -0,0 +1,270 @@
+package wfirma
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"wfsync/entity"
+	"wfsync/lib/metrics"
+	"wfsync/lib/money"
+	"wfsync/lib/sl"
+)
+
+// invoiceCorrection is a corrective invoice (faktura korygująca). Polish law requires one
+// whenever an invoiced sale is refunded or changed; it references the corrected document
+// and restates its lines as they are after the correction.
+const invoiceCorrection invoiceType = "correction"
+
+// correctionSource is the part of an invoices/get response a correction is built from.
+// wFirma returns ids as strings there, so the references are decoded locally instead of
+// through the payload types.
+type correctionSource struct {
+	Invoices map[string]struct {
+		Invoice struct {
+			Id            string `json:"id"`
+			Number        string `json:"fullnumber"`
+			Type          string `json:"type"`
+			Currency      string `json:"currency"`
+			PaymentMethod string `json:"paymentmethod"`
+			DisposalDate  string `json:"disposaldate"`
+			Contractor    *idRef `json:"contractor"`
+			Contents      map[string]struct {
+				Content correctionLine `json:"invoicecontent"`
+			} `json:"invoicecontents"`
+		} `json:"invoice"`
+	} `json:"invoices"`
+	Status Status `json:"status"`
+}
+
+// correctionLine is a line of the corrected document.
+type correctionLine struct {
+	Name    string      `json:"name"`
+	Unit    string      `json:"unit"`
+	Vat     string      `json:"vat"`
+	VatCode *VatCodeRef `json:"vat_code"`
+	Good    *idRef      `json:"good"`
+}
+
+// idRef is an object reference as wFirma returns it, with a string id.
+type idRef struct {
+	ID string `json:"id"`
+}
+
+// CreateCorrectiveInvoice issues a correction of the wFirma document originalInvoiceID.
+// corrected lists the order's lines as they are after the correction: a line of the
+// original missing from it is corrected to a zero quantity, so params without line items
+// correct the whole document to zero (a full refund). Lines are matched by name and keep
+// the VAT code and goods reference of the original; a line the original does not have is
+// an error, as a correction cannot add goods.
+func (c *Client) CreateCorrectiveInvoice(ctx context.Context, originalInvoiceID string, corrected *entity.CheckoutParams) (*entity.Payment, error) {
+	if !c.enabled {
+		return nil, fmt.Errorf("wFirma is disabled")
+	}
+	if originalInvoiceID == "" {
+		return nil, fmt.Errorf("no invoice to correct")
+	}
+	if corrected == nil {
+		return nil, fmt.Errorf("no corrected params")
+	}
+	log := c.log.With(
+		slog.String("order_id", corrected.OrderId),
+		slog.String("parent_id", originalInvoiceID),
+	)
+
+	original, err := c.correctedInvoice(ctx, originalInvoiceID)
+	if err != nil {
+		return nil, err
+	}
+
+	contents, err := c.correctionContents(original, corrected)
+	if err != nil {
+		return nil, err
+	}
+	var totalCents int64
+	for _, cl := range contents {
+		totalCents += money.Cents(cl.Content.Price) * cl.Content.Count
+	}
+	currency := strings.ToUpper(original.Currency)
+	if currency == "" {
+		currency = strings.ToUpper(corrected.Currency)
+	}
+	total := money.New(totalCents, currency)
+
+	now := time.Now()
+	issueDate := now.Format("2006-01-02")
+	disposalDate := original.DisposalDate
+	if disposalDate == "" {
+		disposalDate = issueDate
+	}
+	paymentMethod := original.PaymentMethod
+	if paymentMethod == "" {
+		paymentMethod = c.paymentMethod(corrected.PaymentMethod)
+	}
+
+	inv := &Invoice{
+		Contractor:    &Contractor{ID: original.Contractor.ID},
+		Type:          string(invoiceCorrection),
+		Parent:        &ParentRef{ID: originalInvoiceID},
+		PriceType:     "brutto",
+		PaymentMethod: paymentMethod,
+		PaymentDate:   now.AddDate(0, 0, defaultPaymentDays).Format("2006-01-02"),
+		DisposalDate:  disposalDate,
+		Total:         total.Major(),
+		IdExternal:    corrected.ExternalRef(),
+		Description:   correctionDescription(original.Number, originalInvoiceID),
+		Date:          issueDate,
+		Currency:      currency,
+		Contents:      contents,
+	}
+
+	result, err := c.submitInvoice(ctx, log, inv, contents)
+	if err != nil {
+		return nil, err
+	}
+	inv.Id = result.Id
+	inv.Number = result.Number
+	metrics.InvoicesCreated.Inc()
+
+	if c.db != nil {
+		if saveErr := c.db.SaveInvoice(inv.Id, inv); saveErr != nil {
+			log.Error("save invoice", sl.Err(saveErr))
+		}
+	}
+
+	log.With(
+		slog.String("wfirma_id", inv.Id),
+		slog.String("wfirma_number", inv.Number),
+		slog.String("parent_number", original.Number),
+		slog.String("total", total.Format(".")),
+		slog.String("currency", currency),
+		slog.String("tg_topic", entity.TopicInvoice),
+	).Info("corrective invoice created")
+
+	return &entity.Payment{
+		Amount:  total.Cents,
+		Id:      inv.Id,
+		Number:  inv.Number,
+		OrderId: corrected.OrderId,
+	}, nil
+}
+
+// correctedInvoice fetches the document to correct. Proformas are not accounting
+// documents and are never corrected.
+func (c *Client) correctedInvoice(ctx context.Context, invoiceID string) (*correctedDocument, error) {
+	res, err := c.request(ctx, "invoices", "get/"+invoiceID, map[string]interface{}{})
+	if err != nil {
+		return nil, fmt.Errorf("get invoice to correct: %w", err)
+	}
+	var resp correctionSource
+	if err = json.Unmarshal(res, &resp); err != nil {
+		return nil, fmt.Errorf("parse get response: %w", err)
+	}
+	if resp.Status.Code != "OK" {
+		msg := resp.Status.Message
+		if msg == "" {
+			msg = resp.Status.Code
+		}
+		return nil, fmt.Errorf("wfirma get invoice %s: %s", invoiceID, msg)
+	}
+	for _, w := range resp.Invoices {
+		inv := w.Invoice
+		if inv.Id == "" {
+			continue
+		}
+		if inv.Type == string(invoiceProforma) {
+			return nil, fmt.Errorf("invoice %s is a proforma and cannot be corrected", invoiceID)
+		}
+		if inv.Contractor == nil || inv.Contractor.ID == "" {
+			return nil, fmt.Errorf("invoice %s has no contractor", invoiceID)
+		}
+		src := &correctedDocument{
+			Number:        inv.Number,
+			Currency:      inv.Currency,
+			PaymentMethod: inv.PaymentMethod,
+			DisposalDate:  inv.DisposalDate,
+			Contractor:    inv.Contractor,
+		}
+		// The contents map is keyed by position ("0", "1", ...); keep the document order.
+		keys := make([]string, 0, len(inv.Contents))
+		for k := range inv.Contents {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			a, _ := strconv.Atoi(keys[i])
+			b, _ := strconv.Atoi(keys[j])
+			return a < b
+		})
+		for _, k := range keys {
+			line := inv.Contents[k].Content
+			src.Lines = append(src.Lines, &line)
+		}
+		return src, nil
+	}
+	return nil, fmt.Errorf("invoice %s not found", invoiceID)
+}
+
+// correctedDocument is the corrected document with its lines in order.
+type correctedDocument struct {
+	Number        string
+	Currency      string
+	PaymentMethod string
+	DisposalDate  string
+	Contractor    *idRef
+	Lines         []*correctionLine
+}
+
+// correctionContents builds the lines of a correction: every line of the original, with
+// the quantity and price it has after the correction.
+func (c *Client) correctionContents(original *correctedDocument, corrected *entity.CheckoutParams) ([]*ContentLine, error) {
+	byName := make(map[string]*entity.LineItem, len(corrected.LineItems))
+	for _, line := range corrected.LineItems {
+		byName[entity.TruncateName(line.Name, c.maxNameLength)] = line
+	}
+
+	contents := make([]*ContentLine, 0, len(original.Lines))
+	for _, line := range original.Lines {
+		content := &Content{
+			Name:    line.Name,
+			Unit:    line.Unit,
+			VatCode: line.VatCode,
+		}
+		if content.VatCode == nil || content.VatCode.ID == "" || content.VatCode.ID == "0" {
+			content.VatCode = nil
+			content.Vat = line.Vat
+		}
+		if line.Good != nil {
+			if id, err := strconv.ParseInt(line.Good.ID, 10, 64); err == nil && id > 0 {
+				content.Good = &GoodRef{ID: id}
+			}
+		}
+		if item, ok := byName[line.Name]; ok {
+			content.Count = item.Qty
+			content.Price = money.Major(item.Price)
+			delete(byName, line.Name)
+		}
+		contents = append(contents, &ContentLine{Content: content})
+	}
+	if len(byName) > 0 {
+		names := make([]string, 0, len(byName))
+		for name := range byName {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("lines not on the corrected invoice: %s", strings.Join(names, ", "))
+	}
+	return contents, nil
+}
+
+// correctionDescription names the corrected document, which the law requires the
+// correction to state.
+func correctionDescription(number, id string) string {
+	if number == "" {
+		number = id
+	}
+	return "Korekta faktury " + number
+}
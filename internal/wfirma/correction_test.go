@@ -0,0 +1,122 @@
+package wfirma
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"testing"
+	"wfsync/entity"
+)
+
+// TestCreateCorrectiveInvoice drives a correction through a stubbed HTTP layer: the
+// original is fetched, and the invoices/add payload references it through parent.id and
+// restates its lines after the correction, keeping their VAT codes and goods.
+func TestCreateCorrectiveInvoice(t *testing.T) {
+	const original = `{"invoices":{"0":{"invoice":{"id":"100","fullnumber":"FV 3/2025","type":"normal",
+		"currency":"PLN","paymentmethod":"payment_card","disposaldate":"2025-03-01","contractor":{"id":"42"},
+		"invoicecontents":{
+			"1":{"invoicecontent":{"name":"Shipping","unit":"usł.","vat_code":{"id":"222"}}},
+			"0":{"invoicecontent":{"name":"Book","unit":"szt.","vat_code":{"id":"223"},"good":{"id":"77"}}}}}}},
+		"status":{"code":"OK"}}`
+	const proforma = `{"invoices":{"0":{"invoice":{"id":"100","type":"proforma","contractor":{"id":"42"}}}},"status":{"code":"OK"}}`
+	const created = `{"invoices":{"0":{"invoice":{"id":"101","fullnumber":"FK 1/2025"}}},"status":{"code":"OK"}}`
+
+	cases := []struct {
+		name       string
+		bodies     []string
+		lines      []*entity.LineItem
+		wantErr    bool
+		wantCounts []int64
+		wantPrices []float64
+		wantAmount int64
+	}{
+		{
+			name:       "full refund",
+			bodies:     []string{original, created},
+			wantCounts: []int64{0, 0},
+			wantPrices: []float64{0, 0},
+		},
+		{
+			name:       "partial",
+			bodies:     []string{original, created},
+			lines:      []*entity.LineItem{{Name: "Book", Qty: 1, Price: 3000}, {Name: "Shipping", Qty: 1, Price: 1500, Shipping: true}},
+			wantCounts: []int64{1, 1},
+			wantPrices: []float64{30, 15},
+			wantAmount: 4500,
+		},
+		{
+			name:    "line not on original",
+			bodies:  []string{original},
+			lines:   []*entity.LineItem{{Name: "Pen", Qty: 1, Price: 500}},
+			wantErr: true,
+		},
+		{
+			name:    "proforma",
+			bodies:  []string{proforma},
+			wantErr: true,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			hc := &stubDoer{bodies: tc.bodies}
+			c := &Client{
+				enabled: true,
+				hc:      hc,
+				baseURL: "https://api.wfirma.test",
+				log:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+			}
+			corrected := &entity.CheckoutParams{OrderId: "1001", Currency: "PLN", LineItems: tc.lines}
+
+			payment, err := c.CreateCorrectiveInvoice(context.Background(), "100", corrected)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("CreateCorrectiveInvoice succeeded, want error")
+				}
+				if len(hc.paths) != 1 {
+					t.Errorf("requests = %d, want only the invoices/get", len(hc.paths))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("CreateCorrectiveInvoice: %v", err)
+			}
+			if payment.Id != "101" || payment.Number != "FK 1/2025" || payment.Amount != tc.wantAmount {
+				t.Errorf("payment = %+v, want id 101 amount %d", payment, tc.wantAmount)
+			}
+			if len(hc.paths) != 2 || hc.paths[0] != "/invoices/get/100" || hc.paths[1] != "/invoices/add" {
+				t.Fatalf("request paths = %v", hc.paths)
+			}
+
+			var sent struct {
+				Api struct {
+					Invoices []struct {
+						Invoice Invoice `json:"invoice"`
+					} `json:"invoices"`
+				} `json:"api"`
+			}
+			if err := json.Unmarshal([]byte(hc.payloads[1]), &sent); err != nil {
+				t.Fatalf("decode payload: %v", err)
+			}
+			inv := sent.Api.Invoices[0].Invoice
+			if inv.Type != "correction" || inv.Parent == nil || inv.Parent.ID != "100" {
+				t.Errorf("type %q parent %+v, want a correction of 100", inv.Type, inv.Parent)
+			}
+			if inv.Contractor.ID != "42" || inv.Currency != "PLN" || inv.PaymentMethod != "payment_card" || inv.DisposalDate != "2025-03-01" {
+				t.Errorf("invoice = %+v, want the original's contractor, currency, method and dates", inv)
+			}
+			if len(inv.Contents) != 2 {
+				t.Fatalf("contents = %d, want 2", len(inv.Contents))
+			}
+			for i, name := range []string{"Book", "Shipping"} {
+				content := inv.Contents[i].Content
+				if content.Name != name || content.Count != tc.wantCounts[i] || content.Price != tc.wantPrices[i] {
+					t.Errorf("line %d = %+v, want %s x%d at %v", i, content, name, tc.wantCounts[i], tc.wantPrices[i])
+				}
+			}
+			if book := inv.Contents[0].Content; book.VatCode == nil || book.VatCode.ID != "223" || book.Good == nil || book.Good.ID != 77 {
+				t.Errorf("book line = %+v, want the original vat code and good", book)
+			}
+		})
+	}
+}
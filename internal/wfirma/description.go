@@ -0,0 +1,70 @@
+package wfirma
+
+import (
+	"log/slog"
+	"strings"
+	"text/template"
+	"wfsync/entity"
+	"wfsync/lib/sl"
+)
+
+// defaultDescription is the invoice description used when wfirma.description_template is
+// empty or invalid: the order number, with the part number on split invoices.
+const defaultDescription = `Numer zamówienia: {{.OrderId}}{{if gt .Parts 1}} (część {{.Part}}/{{.Parts}}){{end}}`
+
+var defaultDescriptionTemplate = template.Must(template.New("description").Parse(defaultDescription))
+
+// descriptionData is what a description template renders. Part and Parts number the
+// documents of a split order; Parts is 1 for an order sent as a single invoice.
+type descriptionData struct {
+	OrderId      string
+	Date         string // issue date, 2006-01-02
+	CustomerName string
+	Email        string
+	Part         int
+	Parts        int
+}
+
+// newDescriptionTemplate parses the configured description template. A template that
+// does not parse is logged and replaced by the default, so a typo never fails invoices.
+func newDescriptionTemplate(text string, log *slog.Logger) *template.Template {
+	if strings.TrimSpace(text) == "" {
+		return defaultDescriptionTemplate
+	}
+	tmpl, err := template.New("description").Option("missingkey=error").Parse(text)
+	if err != nil {
+		log.Error("invalid invoice description template, using default", sl.Err(err))
+		return defaultDescriptionTemplate
+	}
+	return tmpl
+}
+
+// description renders the invoice description for one part of an order, falling back
+// to the default template when the configured one fails on this data.
+func (c *Client) description(params *entity.CheckoutParams, issueDate string, part, parts int) string {
+	data := descriptionData{
+		OrderId: params.OrderId,
+		Date:    issueDate,
+		Part:    part,
+		Parts:   parts,
+	}
+	if params.ClientDetails != nil {
+		data.CustomerName = params.ClientDetails.Name
+		data.Email = params.ClientDetails.Email
+	}
+
+	tmpl := c.descriptionTmpl
+	if tmpl == nil {
+		tmpl = defaultDescriptionTemplate
+	}
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, data); err != nil {
+		c.log.With(
+			slog.String("order_id", params.OrderId),
+			sl.Err(err),
+		).Warn("render invoice description, using default")
+		sb.Reset()
+		_ = defaultDescriptionTemplate.Execute(&sb, data)
+	}
+	return strings.TrimSpace(sb.String())
+}
@@ -0,0 +1,44 @@
+package wfirma
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+	"wfsync/entity"
+)
+
+// TestDescription renders description templates with sample order data: the default
+// (single and split), a custom template, and templates that fail to parse or execute,
+// which fall back to the default.
+func TestDescription(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	params := &entity.CheckoutParams{
+		OrderId:       "12345",
+		ClientDetails: &entity.ClientDetails{Name: "Jan Kowalski", Email: "jan@example.com"},
+	}
+
+	cases := []struct {
+		name     string
+		template string
+		part     int
+		parts    int
+		want     string
+	}{
+		{"default", "", 1, 1, "Numer zamówienia: 12345"},
+		{"default split", "", 2, 3, "Numer zamówienia: 12345 (część 2/3)"},
+		{"custom", "Order {{.OrderId}} of {{.Date}} for {{.CustomerName}} <{{.Email}}>", 1, 1,
+			"Order 12345 of 2025-05-01 for Jan Kowalski <jan@example.com>"},
+		{"custom split", "Zamówienie {{.OrderId}}{{if gt .Parts 1}}, część {{.Part}} z {{.Parts}}{{end}}", 1, 2,
+			"Zamówienie 12345, część 1 z 2"},
+		{"parse error", "Order {{.OrderId", 1, 1, "Numer zamówienia: 12345"},
+		{"unknown field", "Order {{.Number}}", 1, 1, "Numer zamówienia: 12345"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &Client{log: log, descriptionTmpl: newDescriptionTemplate(tc.template, log)}
+			if got := c.description(params, "2025-05-01", tc.part, tc.parts); got != tc.want {
+				t.Errorf("description = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
@@ -6,6 +6,8 @@ package wfirma
 // Invoice types (type field):
 //   "normal"   — standard VAT invoice (faktura VAT)
 //   "proforma" — proforma invoice
+//   "correction" — corrective invoice (faktura korygująca); references the corrected
+//                  document through parent.id
 //
 // Price types (price_type field):
 //   "brutto" — prices include VAT (gross)
@@ -26,12 +28,14 @@ package wfirma
 // Note: the API computes totals from invoicecontents automatically.
 // The "total" field is included for local reference but ignored by the API on create.
 
+import "wfsync/entity"
+
 // Invoice represents a wFirma invoice payload for the invoices/add API action.
 type Invoice struct {
 	Id             string                  `json:"id,omitempty" bson:"id"`
 	Number         string                  `json:"fullnumber,omitempty" bson:"number"`
 	Contractor     *Contractor             `json:"contractor" bson:"contractor"`
-	Type           string                  `json:"type" bson:"type"`                   // "normal" or "proforma"
+	Type           string                  `json:"type" bson:"type"`                   // "normal", "proforma" or "correction"
 	PriceType      string                  `json:"price_type" bson:"price_type"`       // "brutto" (gross) or "netto" (net)
 	PaymentMethod  string                  `json:"paymentmethod" bson:"paymentmethod"` // e.g. "transfer", "cash", "payment_card"
 	PaymentDate    string                  `json:"paymentdate" bson:"paymentdate"`     // payment due date, format "YYYY-MM-DD"
@@ -44,7 +48,10 @@ type Invoice struct {
 	Contents       []*ContentLine          `json:"invoicecontents" bson:"invoicecontents"`
 	VatMossDetails *VatMossDetailWrapper   `json:"vat_moss_details,omitempty" bson:"vat_moss_details,omitempty"`
 	CompanyAccount *CompanyAccountRef      `json:"company_account,omitempty" bson:"company_account,omitempty"`
+	Series         *SeriesRef              `json:"series,omitempty" bson:"series,omitempty"`
+	Parent         *ParentRef              `json:"parent,omitempty" bson:"parent,omitempty"` // corrected document; corrections only
 	Errors         ErrorsMap               `json:"errors,omitempty" bson:"errors,omitempty"`
+	Tax            []*entity.TaxLine       `json:"-" bson:"tax,omitempty"` // local tax summary, never sent to wFirma
 }
 
 // CompanyAccountRef references a wFirma company (bank) account by its internal ID.
@@ -54,6 +61,17 @@ type CompanyAccountRef struct {
 	ID string `json:"id" bson:"id"`
 }
 
+// SeriesRef references a wFirma numbering series by its internal ID. Without it wFirma
+// numbers the document in the default series of its type.
+type SeriesRef struct {
+	ID string `json:"id" bson:"id"`
+}
+
+// ParentRef references the document a correction corrects by its wFirma ID.
+type ParentRef struct {
+	ID string `json:"id" bson:"id"`
+}
+
 // VatMossDetailWrapper wraps a VatMossDetail for the wFirma API singular relation.
 // The API expects: "vat_moss_details": {"vat_moss_detail": {...}}
 type VatMossDetailWrapper struct {
@@ -1,6 +1,7 @@
 package wfirma
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
@@ -8,6 +9,7 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"mime"
 	"net/http"
 	"net/url"
 	"os"
@@ -16,6 +18,8 @@ import (
 	"strings"
 	"time"
 	"wfsync/entity"
+	"wfsync/lib/metrics"
+	"wfsync/lib/money"
 	"wfsync/lib/sl"
 
 	"github.com/google/uuid"
@@ -36,18 +40,13 @@ const (
 	// wFirma to become a legal invoice. Used only as a fallback — see submitInvoice.
 	invoiceNormalDraft invoiceType = "normal_draft"
 
-	// defaultPaymentMethod is used for all created invoices.
-	// Supported values: "transfer", "cash", "compensation", "cod", "payment_card".
+	// defaultPaymentMethod is used for orders whose payment method is not mapped by
+	// wfirma.payment_methods. See paymentMethods for the supported values.
 	defaultPaymentMethod = "transfer"
 
 	// defaultPaymentDays is the number of days from the invoice date until payment is due.
 	defaultPaymentDays = 7
 
-	// shippingVatCode overrides the VAT code for shipping line items.
-	// When empty, shipping uses the same VAT code as goods.
-	// Set to a specific code (e.g. "NP", "ZW", "23") to tax shipping differently.
-	shippingVatCode = ""
-
 	// shippingSku is the default SKU used for shipping line items when no SKU is set.
 	// Used to look up the wFirma good ID for shipping costs.
 	shippingSku = "Zwrot"
@@ -142,7 +141,8 @@ func (c *Client) invoice(ctx context.Context, invType invoiceType, params *entit
 	countryCode := params.ClientDetails.CountryCode()
 	hasTaxId := params.ClientDetails.TaxId != ""
 	isB2B := b2bCustomerGroups[params.CustomerGroup]
-	opencartRate := params.TaxRate()
+	domestic := DomesticSale(countryCode)
+	opencartRate := orderVatRate(params, countryCode, c.defaultVatRate)
 
 	// VIES validation: check the TaxId against the EU VIES service.
 	// Non-blocking — the result is logged but does not change hasTaxId or prevent invoice creation.
@@ -216,16 +216,26 @@ func (c *Client) invoice(ctx context.Context, invType invoiceType, params *entit
 	// For OSS, resolve the foreign vat_code ID via declaration_countries → vat_codes chain.
 	// For non-OSS, resolve Polish vat_code IDs by code name.
 	vatCodeIDCache := make(map[string]string)
-	var ossVatCodeID string
+	ossVatCodeIDs := make(map[string]string)
 	if isOSS {
-		ossVatCodeID = c.resolveOSSVatCodeIDWithRate(ctx, countryCode, goodsVat)
-		if ossVatCodeID == "" {
-			log.Warn("OSS vat_code not found, falling back to plain vat field",
-				slog.String("country", countryCode),
-				slog.String("rate", goodsVat))
+		for _, line := range params.LineItems {
+			code := contentVatCode(line, goodsVat, c.shippingVatCode, domestic)
+			if _, ok := ossVatCodeIDs[code]; ok {
+				continue
+			}
+			ossVatCodeIDs[code] = c.resolveOSSVatCodeIDWithRate(ctx, countryCode, code)
+			if ossVatCodeIDs[code] == "" {
+				log.Warn("OSS vat_code not found, falling back to plain vat field",
+					slog.String("country", countryCode),
+					slog.String("rate", code))
+			}
 		}
 	} else {
-		for _, code := range []string{goodsVat, shippingVatCode} {
+		codes := []string{goodsVat}
+		for _, line := range params.LineItems {
+			codes = append(codes, contentVatCode(line, goodsVat, c.shippingVatCode, domestic))
+		}
+		for _, code := range codes {
 			if code == "" {
 				continue
 			}
@@ -236,21 +246,16 @@ func (c *Client) invoice(ctx context.Context, invType invoiceType, params *entit
 	}
 
 	var contents []*ContentLine
-	for _, line := range params.LineItems {
-		vatCode := goodsVat
-		if line.Shipping && shippingVatCode != "" {
-			vatCode = shippingVatCode
-		}
-		content := &Content{
-			Name:  line.Name,
-			Count: line.Qty,
-			Price: float64(line.Price) / 100.0,
-			Unit:  "szt.",
-		}
+	lineCodes := make([]string, len(params.LineItems))
+	for i, line := range params.LineItems {
+		vatCode := contentVatCode(line, goodsVat, c.shippingVatCode, domestic)
+		lineCodes[i] = vatCode
+		content := lineContent(line)
+		content.Name = entity.TruncateName(content.Name, c.maxNameLength)
 		// For OSS invoices, use the foreign vat_code ID resolved via declaration_countries.
 		// Falls back to plain "vat" field if the foreign vat_code was not found.
-		if isOSS && ossVatCodeID != "" {
-			content.VatCode = &VatCodeRef{ID: ossVatCodeID}
+		if isOSS && ossVatCodeIDs[vatCode] != "" {
+			content.VatCode = &VatCodeRef{ID: ossVatCodeIDs[vatCode]}
 		} else if !isOSS {
 			if vcID := vatCodeIDCache[vatCode]; vcID != "" {
 				content.VatCode = &VatCodeRef{ID: vcID}
@@ -281,6 +286,8 @@ func (c *Client) invoice(ctx context.Context, invType invoiceType, params *entit
 	chunks := chunkContents(contents, maxInvoiceItems, softInvoiceLimit)
 	totalParts := len(chunks)
 
+	taxSummary := c.taxSummary(params, lineCodes)
+
 	var firstPayment *entity.Payment
 	var parts []*entity.Payment
 
@@ -288,24 +295,22 @@ func (c *Client) invoice(ctx context.Context, invType invoiceType, params *entit
 		partNum := partIdx + 1
 
 		// Calculate the total for this chunk from its line items.
-		var chunkTotal float64
+		var chunkCents int64
 		for _, cl := range chunk {
-			chunkTotal += cl.Content.Price * float64(cl.Content.Count)
+			chunkCents += money.Cents(cl.Content.Price) * cl.Content.Count
 		}
+		chunkTotal := money.New(chunkCents, params.Currency)
 
-		description := "Numer zamówienia: " + params.OrderId
-		if totalParts > 1 {
-			description = fmt.Sprintf("Numer zamówienia: %s (część %d/%d)", params.OrderId, partNum, totalParts)
-		}
+		description := c.description(params, issueDate, partNum, totalParts)
 
 		inv := &Invoice{
 			Contractor:    contractor,
 			Type:          string(invType),
 			PriceType:     "brutto",
-			PaymentMethod: defaultPaymentMethod,
+			PaymentMethod: c.paymentMethod(params.PaymentMethod),
 			PaymentDate:   paymentDate,
 			DisposalDate:  disposalDate,
-			Total:         chunkTotal,
+			Total:         chunkTotal.Major(),
 			IdExternal:    params.ExternalRef(),
 			Description:   description,
 			Date:          issueDate,
@@ -313,6 +318,17 @@ func (c *Client) invoice(ctx context.Context, invType invoiceType, params *entit
 			Contents:      chunk,
 		}
 
+		// The summary covers the whole order, so it is kept only with a single document.
+		if totalParts == 1 {
+			inv.Tax = taxSummary
+		}
+
+		if invType == invoiceNormal {
+			if series := c.seriesFor(params.Source); series != "" {
+				inv.Series = &SeriesRef{ID: series}
+			}
+		}
+
 		if isOSS {
 			inv.VatMossDetails = buildVatMossDetails(params.ClientDetails, countryCode)
 		}
@@ -336,6 +352,7 @@ func (c *Client) invoice(ctx context.Context, invType invoiceType, params *entit
 
 		inv.Id = resultInv.Id
 		inv.Number = resultInv.Number
+		metrics.InvoicesCreated.Inc()
 
 		if c.db != nil {
 			if saveErr := c.db.SaveInvoice(inv.Id, inv); saveErr != nil {
@@ -347,7 +364,7 @@ func (c *Client) invoice(ctx context.Context, invType invoiceType, params *entit
 			slog.String("wfirma_id", inv.Id),
 			slog.String("wfirma_number", inv.Number),
 			slog.String("order_id", params.OrderId),
-			slog.String("total", fmt.Sprintf("%.2f", chunkTotal)),
+			slog.String("total", chunkTotal.Format(".")),
 			slog.String("tax", func() string {
 				if isOSS {
 					return goodsVat + " OSS"
@@ -365,8 +382,9 @@ func (c *Client) invoice(ctx context.Context, invType invoiceType, params *entit
 		).Info("invoice created")
 
 		parts = append(parts, &entity.Payment{
-			Amount:  int64(chunkTotal * 100),
+			Amount:  chunkTotal.Cents,
 			Id:      inv.Id,
+			Number:  inv.Number,
 			OrderId: params.OrderId,
 		})
 	}
@@ -384,6 +402,9 @@ func (c *Client) invoice(ctx context.Context, invType invoiceType, params *entit
 	if firstPayment != nil && len(parts) > 1 {
 		firstPayment.Parts = parts
 	}
+	if firstPayment != nil {
+		firstPayment.Tax = taxSummary
+	}
 
 	// Persist the first invoice ID back to checkout params.
 	if c.db != nil && firstPayment != nil {
@@ -487,6 +508,15 @@ func (c *Client) submitInvoice(ctx context.Context, log *slog.Logger, inv *Invoi
 				return nil, draftErr
 			}
 			return draftInv, nil
+		} else if hasSeriesError(&addResp) {
+			// Not a payload problem: the wFirma account has no series for this document
+			// type. Say what to do instead of dumping the response.
+			log.With(
+				slog.String("error", errMsg),
+				slog.String("invoice_type", inv.Type),
+				tgAttr,
+			).Error("invoice series missing: configure the invoice series in wFirma")
+			return nil, fmt.Errorf("%w: configure the %s series in wFirma (%s)", entity.ErrInvoiceSeriesMissing, inv.Type, errMsg)
 		} else {
 			el := log.With(slog.String("error", errMsg), tgAttr)
 			if !isRetry {
@@ -643,6 +673,31 @@ func extractInvoiceErrors(resp *InvoiceResponse) string {
 	return strings.Join(msgs, "; ")
 }
 
+// seriesErrorPhrases are fragments of the wFirma error returned when the company has no
+// numbering series for the document, e.g. "Firma nie posiada takiej serii". Matched
+// case-insensitively against the message of any error on the invoice itself.
+var seriesErrorPhrases = []string{"serii", "series"}
+
+// hasSeriesError reports whether an invoices/add error response rejects the document for
+// a missing numbering series: an invoice-level error on a series field, or one whose
+// message names a series.
+func hasSeriesError(resp *InvoiceResponse) bool {
+	for _, wrapper := range resp.Invoices {
+		for _, ew := range wrapper.Invoice.Errors {
+			if strings.HasPrefix(strings.ToLower(ew.Error.Field), "series") {
+				return true
+			}
+			msg := strings.ToLower(ew.Error.Message)
+			for _, p := range seriesErrorPhrases {
+				if strings.Contains(msg, p) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
 // stockErrorPhrases are the wFirma error message fragments that indicate a
 // warehouse stock problem for a line item. Matching items are retried without
 // their Good reference, which turns the line into a plain free-text product
@@ -686,8 +741,8 @@ func isStockError(msg string) bool {
 // Uses the customer's address as evidence type A and the delivery country as evidence type F.
 func buildVatMossDetails(client *entity.ClientDetails, countryCode string) *VatMossDetailWrapper {
 	var addrParts []string
-	if client.Street != "" {
-		addrParts = append(addrParts, client.Street)
+	if street := client.StreetAddress(); street != "" {
+		addrParts = append(addrParts, street)
 	}
 	if client.ZipCode != "" {
 		addrParts = append(addrParts, client.ZipCode)
@@ -714,6 +769,76 @@ func buildVatMossDetails(client *entity.ClientDetails, countryCode string) *VatM
 	}
 }
 
+// lineContent maps an order line to the wFirma content fields that come from the line
+// itself; VAT and goods references are resolved by the caller.
+func lineContent(line *entity.LineItem) *Content {
+	return &Content{
+		Name:  line.Name,
+		Count: line.Qty,
+		Price: money.Major(line.Price),
+		Unit:  line.InvoiceUnit(),
+	}
+}
+
+// seriesBySource converts the configured per-source series ids, skipping blanks.
+func seriesBySource(series map[string]string) map[entity.Source]string {
+	bySource := make(map[entity.Source]string, len(series))
+	for source, id := range series {
+		if id = strings.TrimSpace(id); id != "" {
+			bySource[entity.Source(strings.ToLower(strings.TrimSpace(source)))] = id
+		}
+	}
+	return bySource
+}
+
+// seriesFor picks the numbering series of a VAT invoice: the one configured for the
+// order's source, then the default. Orders without a source come from the API.
+func (c *Client) seriesFor(source entity.Source) string {
+	if source == "" {
+		source = entity.SourceApi
+	}
+	if id := c.seriesBySource[source]; id != "" {
+		return id
+	}
+	return c.defaultSeries
+}
+
+// paymentMethods lists the payment methods wFirma accepts on invoices and payments.
+var paymentMethods = map[string]bool{
+	"transfer":     true,
+	"cash":         true,
+	"compensation": true,
+	"cod":          true,
+	"payment_card": true,
+}
+
+// newPaymentMethods normalizes the configured store → wFirma payment method table. Codes
+// are matched case-insensitively; entries naming a method wFirma does not know are
+// dropped with a warning, so a typo falls back to the default instead of failing invoices.
+func newPaymentMethods(table map[string]string, log *slog.Logger) map[string]string {
+	methods := make(map[string]string, len(table))
+	for code, method := range table {
+		method = strings.ToLower(strings.TrimSpace(method))
+		if !paymentMethods[method] {
+			log.Warn("unsupported payment method mapping ignored",
+				slog.String("payment_code", code),
+				slog.String("payment_method", method))
+			continue
+		}
+		methods[strings.ToLower(strings.TrimSpace(code))] = method
+	}
+	return methods
+}
+
+// paymentMethod maps an order's store payment method code to a wFirma payment method,
+// defaulting to transfer for empty and unmapped codes.
+func (c *Client) paymentMethod(code string) string {
+	if method, ok := c.paymentMethods[strings.ToLower(strings.TrimSpace(code))]; ok {
+		return method
+	}
+	return defaultPaymentMethod
+}
+
 // addPayment registers a payment against an existing invoice in wFirma (payments/add).
 // Currently disabled — see the commented-out call in invoice().
 func (c *Client) addPayment(ctx context.Context, invoice Invoice) error {
@@ -722,10 +847,11 @@ func (c *Client) addPayment(ctx context.Context, invoice Invoice) error {
 			"payments": []map[string]interface{}{
 				{
 					"payment": map[string]interface{}{
-						"object_name": "invoice",
-						"object_id":   invoice.Id,
-						"value":       invoice.Total,
-						"date":        invoice.Date,
+						"object_name":    "invoice",
+						"object_id":      invoice.Id,
+						"value":          invoice.Total,
+						"date":           invoice.Date,
+						"payment_method": invoice.PaymentMethod,
 					},
 				},
 			},
@@ -980,6 +1106,72 @@ func (c *Client) DownloadInvoice(ctx context.Context, invoiceID string) (fileNam
 		}
 	}()
 
+	body, meta, ext, err := c.openDownload(ctx, invoiceID, log)
+	if err != nil {
+		return "", nil, err
+	}
+	fileName = uuid.New().String() + ext
+	filePath := filepath.Join(c.filePath, fileName)
+
+	f, err := os.Create(filePath)
+	if err != nil {
+		_ = body.Close()
+		return "", nil, fmt.Errorf("create file: %w", err)
+	}
+
+	_, copyErr := io.Copy(f, body)
+	_ = body.Close()
+
+	// Sync to ensure data is flushed to disk before closing
+	if copyErr == nil {
+		copyErr = f.Sync()
+	}
+
+	closeErr := f.Close()
+	if copyErr != nil {
+		_ = os.Remove(filePath)
+		return "", nil, fmt.Errorf("save file: %w", copyErr)
+	}
+	if closeErr != nil {
+		_ = os.Remove(filePath)
+		return "", nil, fmt.Errorf("close file: %w", closeErr)
+	}
+
+	log.With(
+		slog.String("file", fileName),
+		slog.String("content_type", meta.ContentType),
+		slog.Int64("content_length", meta.ContentLength),
+	).Info("invoice downloaded")
+
+	return fileName, meta, nil
+}
+
+// StreamInvoice returns the invoice document as a stream straight from wFirma, without
+// storing it. The caller must close the stream. Used where the file is only passed
+// through to an HTTP client: a stored copy would be written, reopened and then never
+// referenced again.
+func (c *Client) StreamInvoice(ctx context.Context, invoiceID string) (io.ReadCloser, *entity.FileMeta, error) {
+	if !c.enabled {
+		return nil, nil, fmt.Errorf("wFirma is disabled")
+	}
+	log := c.log.With(slog.String("invoice_id", invoiceID))
+	body, meta, _, err := c.openDownload(ctx, invoiceID, log)
+	if err != nil {
+		return nil, nil, err
+	}
+	log.With(
+		slog.String("content_type", meta.ContentType),
+		slog.Int64("content_length", meta.ContentLength),
+	).Debug("invoice stream opened")
+	return body, meta, nil
+}
+
+// openDownload requests the invoice document and validates its type. The returned body
+// still holds the sniffed bytes, so reading it yields the complete upstream document.
+func (c *Client) openDownload(ctx context.Context, invoiceID string, log *slog.Logger) (io.ReadCloser, *entity.FileMeta, string, error) {
+	if err := c.features.Check(entity.FeatureWFirma); err != nil {
+		return nil, nil, "", err
+	}
 	// Wait for KSeF to finish processing before downloading. Until the invoice has an
 	// assigned KSeF number, wFirma can only render an interim "transaction confirmation"
 	// (a QR-only summary without line items), not the full invoice. See waitForKSefProcessed
@@ -1008,74 +1200,80 @@ func (c *Client) DownloadInvoice(ctx context.Context, invoiceID string) (fileNam
 	data, err := json.Marshal(payload)
 	if err != nil {
 		log.Error("marshal payload", sl.Err(err))
-		return "", nil, err
+		return nil, nil, "", err
 	}
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(data))
 	if err != nil {
 		log.Error("create request", sl.Err(err))
-		return "", nil, err
+		return nil, nil, "", err
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("appKey", c.appID)
-	req.Header.Set("accessKey", c.accessKey)
-	req.Header.Set("secretKey", c.secretKey)
+	c.setAuthHeaders(req)
 
 	resp, err := c.hc.Do(req)
 	if err != nil {
 		log.Error("request failed", sl.Err(err))
-		return "", nil, err
+		return nil, nil, "", err
 	}
 
 	if resp.StatusCode >= 300 {
 		_ = resp.Body.Close()
 		log.Error("wfirma api", slog.String("status", resp.Status))
-		return "", nil, fmt.Errorf("wfirma status: %s", resp.Status)
-	}
-	meta = &entity.FileMeta{
-		ContentType:   resp.Header.Get("Content-Type"),
-		ContentLength: resp.ContentLength,
+		return nil, nil, "", fmt.Errorf("wfirma status: %s", resp.Status)
 	}
 
-	ext := ".pdf"
-	if !strings.Contains(meta.ContentType, "pdf") {
-		return "", nil, fmt.Errorf("unsupported content type: %s", meta.ContentType)
-	}
-	fileName = uuid.New().String() + ext
-	filePath := filepath.Join(c.filePath, fileName)
-
-	f, err := os.Create(filePath)
+	// Decide the file type from the body itself: wFirma answers some failures with a 200
+	// HTML page, which must not be stored (and later served) as a PDF.
+	body := bufio.NewReaderSize(resp.Body, sniffLen)
+	head, _ := body.Peek(sniffLen)
+	contentType, ext, err := detectDocumentType(resp.Header.Get("Content-Type"), head)
 	if err != nil {
 		_ = resp.Body.Close()
-		return "", nil, fmt.Errorf("create file: %w", err)
+		log.With(slog.String("tg_topic", entity.TopicError)).Error("download invoice", sl.Err(err))
+		return nil, nil, "", err
 	}
+	meta := &entity.FileMeta{
+		ContentType:   contentType,
+		ContentLength: resp.ContentLength,
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{body, resp.Body}, meta, ext, nil
+}
 
-	_, copyErr := io.Copy(f, resp.Body)
-	_ = resp.Body.Close()
+// sniffLen is how much of a download is inspected to detect its type (the amount
+// http.DetectContentType considers).
+const sniffLen = 512
 
-	// Sync to ensure data is flushed to disk before closing
-	if copyErr == nil {
-		copyErr = f.Sync()
-	}
+// documentTypes maps the media types wFirma documents are delivered as to file extensions.
+var documentTypes = map[string]string{
+	"application/pdf": ".pdf",
+	"application/xml": ".xml",
+	"text/xml":        ".xml",
+	"application/zip": ".zip",
+}
 
-	closeErr := f.Close()
-	if copyErr != nil {
-		_ = os.Remove(filePath)
-		return "", nil, fmt.Errorf("save file: %w", copyErr)
+// detectDocumentType determines the media type and file extension of a downloaded
+// document. The sniffed body wins over the Content-Type header, so an HTML error page is
+// rejected even when labelled as a PDF; the header is only trusted when sniffing is
+// inconclusive (e.g. XML without a declaration reads as plain text). A genuine PDF always
+// sniffs as one, so a PDF header on anything else is never trusted.
+func detectDocumentType(header string, head []byte) (contentType, ext string, err error) {
+	sniffed, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+	if ext, ok := documentTypes[sniffed]; ok {
+		return sniffed, ext, nil
 	}
-	if closeErr != nil {
-		_ = os.Remove(filePath)
-		return "", nil, fmt.Errorf("close file: %w", closeErr)
+	if sniffed == "text/html" {
+		return "", "", fmt.Errorf("unexpected content type: got an HTML page instead of a document")
 	}
-
-	log.With(
-		slog.String("file", fileName),
-		slog.String("content_type", meta.ContentType),
-		slog.Int64("content_length", meta.ContentLength),
-	).Info("invoice downloaded")
-
-	return fileName, meta, nil
+	declared, _, _ := mime.ParseMediaType(header)
+	if ext, ok := documentTypes[declared]; ok && declared != "application/pdf" {
+		return declared, ext, nil
+	}
+	return "", "", fmt.Errorf("unsupported content type: %s (detected %s)", header, sniffed)
 }
 
 // ksefDownloadPollInterval is how often waitForKSefProcessed re-checks the KSeF state.
@@ -1,8 +1,18 @@
 package wfirma
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"wfsync/entity"
 )
 
 // TestIsKSefAuthError ensures the KSeF-authorization detector fires only on the
@@ -129,3 +139,418 @@ func TestRawJSONString(t *testing.T) {
 		}
 	}
 }
+
+// TestDetectDocumentType checks that the body decides the file type: real PDFs, XML and
+// ZIP get their extensions, while an HTML error page or unknown bytes are rejected even
+// when the header claims a PDF.
+func TestDetectDocumentType(t *testing.T) {
+	cases := []struct {
+		name     string
+		header   string
+		body     string
+		wantType string
+		wantExt  string
+		wantErr  bool
+	}{
+		{"pdf", "application/pdf", "%PDF-1.7\n%...", "application/pdf", ".pdf", false},
+		{"pdf with generic header", "application/octet-stream", "%PDF-1.4\n", "application/pdf", ".pdf", false},
+		{"xml with declaration", "application/xml", "<?xml version=\"1.0\"?><Faktura/>", "text/xml", ".xml", false},
+		{"xml without declaration trusts header", "application/xml; charset=utf-8", "<Faktura></Faktura>", "application/xml", ".xml", false},
+		{"zip", "application/zip", "PK\x03\x04rest", "application/zip", ".zip", false},
+		{"html error page labelled pdf", "application/pdf", "<!DOCTYPE html><html><body>Error</body></html>", "", "", true},
+		{"html error page", "text/html; charset=utf-8", "<html><body>Błąd</body></html>", "", "", true},
+		{"unknown bytes labelled pdf", "application/pdf", "\x00\x01\x02garbage", "", "", true},
+		{"unknown type", "image/png", "\x89PNG\r\n\x1a\n", "", "", true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			gotType, gotExt, err := detectDocumentType(tc.header, []byte(tc.body))
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got (%q, %q)", gotType, gotExt)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if gotType != tc.wantType || gotExt != tc.wantExt {
+				t.Errorf("got (%q, %q), want (%q, %q)", gotType, gotExt, tc.wantType, tc.wantExt)
+			}
+		})
+	}
+}
+
+// TestDownloadInvoiceRejectsHTML runs DownloadInvoice against a fake wFirma that answers
+// with an HTML page: no file may be left behind, while a PDF is stored with its extension.
+func TestDownloadInvoiceRejectsHTML(t *testing.T) {
+	body := "<html><body>Session expired</body></html>"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/pdf")
+		_, _ = io.WriteString(w, body)
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	c := &Client{
+		enabled:  true,
+		hc:       srv.Client(),
+		baseURL:  srv.URL,
+		filePath: dir,
+		log:      slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+
+	if _, _, err := c.DownloadInvoice(context.Background(), "1"); err == nil {
+		t.Fatal("expected an error for an HTML body")
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Fatalf("files left behind: %d", len(entries))
+	}
+
+	body = "%PDF-1.4 document"
+	name, meta, err := c.DownloadInvoice(context.Background(), "1")
+	if err != nil {
+		t.Fatalf("DownloadInvoice: %v", err)
+	}
+	if filepath.Ext(name) != ".pdf" || meta.ContentType != "application/pdf" {
+		t.Errorf("got file %q with type %q, want a .pdf", name, meta.ContentType)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil || string(data) != body {
+		t.Errorf("stored file = %q (%v), want %q", data, err, body)
+	}
+}
+
+// TestStreamInvoiceMatchesUpstream checks that the streamed document is byte-for-byte the
+// upstream body, including the bytes consumed for type sniffing, and that nothing is
+// written to the file directory.
+func TestStreamInvoiceMatchesUpstream(t *testing.T) {
+	upstream := []byte("%PDF-1.7\n")
+	for i := 0; len(upstream) < 4*sniffLen; i++ {
+		upstream = append(upstream, byte(i))
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/pdf")
+		_, _ = w.Write(upstream)
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	c := &Client{
+		enabled:  true,
+		hc:       srv.Client(),
+		baseURL:  srv.URL,
+		filePath: dir,
+		log:      slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+
+	stream, meta, err := c.StreamInvoice(context.Background(), "1")
+	if err != nil {
+		t.Fatalf("StreamInvoice: %v", err)
+	}
+	got, err := io.ReadAll(stream)
+	_ = stream.Close()
+	if err != nil {
+		t.Fatalf("read stream: %v", err)
+	}
+	if string(got) != string(upstream) {
+		t.Fatalf("streamed %d bytes, want the %d upstream bytes unchanged", len(got), len(upstream))
+	}
+	if meta.ContentType != "application/pdf" || meta.ContentLength != int64(len(upstream)) {
+		t.Errorf("meta = %+v, want application/pdf with length %d", meta, len(upstream))
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("streaming wrote %d files", len(entries))
+	}
+}
+
+// TestPaymentMethodMapping covers the store → wFirma payment method table: configured
+// codes match case-insensitively, unsupported targets are dropped, and anything unmapped
+// falls back to transfer.
+func TestPaymentMethodMapping(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	c := &Client{paymentMethods: newPaymentMethods(map[string]string{
+		"cod":           "cod",
+		"Bank_Transfer": "transfer",
+		"stripe":        "Payment_Card",
+		"paypal":        "paypal", // not a wFirma method
+	}, log)}
+
+	cases := []struct {
+		code string
+		want string
+	}{
+		{"cod", "cod"},
+		{"bank_transfer", "transfer"},
+		{"STRIPE", "payment_card"},
+		{"paypal", defaultPaymentMethod},
+		{"free_checkout", defaultPaymentMethod},
+		{"", defaultPaymentMethod},
+	}
+	for _, tc := range cases {
+		t.Run(tc.code, func(t *testing.T) {
+			if got := c.paymentMethod(tc.code); got != tc.want {
+				t.Errorf("paymentMethod(%q) = %q, want %q", tc.code, got, tc.want)
+			}
+		})
+	}
+
+	unconfigured := &Client{}
+	if got := unconfigured.paymentMethod("cod"); got != defaultPaymentMethod {
+		t.Errorf("paymentMethod without a table = %q, want %q", got, defaultPaymentMethod)
+	}
+}
+
+// TestLineContentUnit checks that line units reach the invoice content: explicit units
+// are kept, goods default to pieces and shipping to a service unit, including shipping
+// added by B2B orders.
+func TestLineContentUnit(t *testing.T) {
+	b2b := (&entity.B2BOrder{
+		Shipment: 20,
+		Items: []*entity.B2BItem{
+			{ProductName: "Consulting", Quantity: 3, Price: 150, Unit: "godz."},
+		},
+	}).ToCheckoutParams()
+
+	cases := []struct {
+		name string
+		line *entity.LineItem
+		want string
+	}{
+		{"custom unit", &entity.LineItem{Name: "Hosting", Qty: 1, Price: 5000, Unit: "mies."}, "mies."},
+		{"goods default", &entity.LineItem{Name: "Widget", Qty: 2, Price: 1000}, entity.DefaultUnit},
+		{"blank unit", &entity.LineItem{Name: "Widget", Qty: 2, Price: 1000, Unit: "  "}, entity.DefaultUnit},
+		{"shipping default", &entity.LineItem{Name: "Delivery", Qty: 1, Price: 1500, Shipping: true}, entity.ShippingUnit},
+		{"shipping helper", entity.ShippingLineItem("DPD", 1500), entity.ShippingUnit},
+		{"b2b shipping", b2b.LineItems[0], entity.ShippingUnit},
+		{"b2b item", b2b.LineItems[1], "godz."},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			content := lineContent(tc.line)
+			if content.Unit != tc.want {
+				t.Errorf("Unit = %q, want %q", content.Unit, tc.want)
+			}
+			if content.Name != tc.line.Name || content.Count != tc.line.Qty {
+				t.Errorf("content = %+v, want name %q count %d", content, tc.line.Name, tc.line.Qty)
+			}
+		})
+	}
+}
+
+// stubDoer answers wFirma requests with canned JSON bodies, in order, and records what
+// was sent.
+type stubDoer struct {
+	bodies   []string
+	paths    []string
+	payloads []string
+}
+
+func (d *stubDoer) Do(req *http.Request) (*http.Response, error) {
+	payload, _ := io.ReadAll(req.Body)
+	d.paths = append(d.paths, req.URL.Path)
+	d.payloads = append(d.payloads, string(payload))
+	body := d.bodies[0]
+	d.bodies = d.bodies[1:]
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(body)),
+	}, nil
+}
+
+// TestSubmitInvoiceStubbed drives invoices/add through a stubbed HTTP layer: a created
+// invoice returns its id, and a stock error is retried once without goods references.
+func TestSubmitInvoiceStubbed(t *testing.T) {
+	const created = `{"invoices":{"0":{"invoice":{"id":"501","fullnumber":"FV 7/2025"}}},"status":{"code":"OK"}}`
+	const stockErr = `{"invoices":{"0":{"invoice":{"invoicecontents":{"0":{"invoicecontent":{"name":"Book",
+		"errors":{"0":{"error":{"field":"count","message":"Stan magazynowy jest niewystarczający"}}}}}}}}},
+		"status":{"code":"ERROR"}}`
+
+	cases := []struct {
+		name      string
+		bodies    []string
+		wantCalls int
+	}{
+		{"created", []string{created}, 1},
+		{"stock error retried", []string{stockErr, created}, 2},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			hc := &stubDoer{bodies: tc.bodies}
+			c := &Client{
+				enabled: true,
+				hc:      hc,
+				baseURL: "https://api.wfirma.test",
+				log:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+			}
+			contents := []*ContentLine{{Content: &Content{Name: "Book", Count: 1, Price: 50, Good: &GoodRef{ID: 77}}}}
+			inv := &Invoice{Type: string(invoiceNormal), Contents: contents}
+
+			got, err := c.submitInvoice(context.Background(), c.log, inv, contents)
+			if err != nil {
+				t.Fatalf("submitInvoice: %v", err)
+			}
+			if got.Id != "501" || got.Number != "FV 7/2025" {
+				t.Errorf("invoice = %+v, want id 501", got)
+			}
+			if len(hc.paths) != tc.wantCalls {
+				t.Fatalf("requests = %d, want %d", len(hc.paths), tc.wantCalls)
+			}
+			for _, path := range hc.paths {
+				if path != "/invoices/add" {
+					t.Errorf("request path = %q, want /invoices/add", path)
+				}
+			}
+			last := hc.payloads[len(hc.payloads)-1]
+			if hasGood := strings.Contains(last, `"good"`); hasGood != (tc.wantCalls == 1) {
+				t.Errorf("goods reference sent = %v on the final request", hasGood)
+			}
+		})
+	}
+}
+
+// TestSeriesError decodes invoices/add error responses: a missing numbering series is
+// recognized by its field or message and surfaces as entity.ErrInvoiceSeriesMissing,
+// while other invoice and line errors are not mistaken for it.
+func TestSeriesError(t *testing.T) {
+	cases := []struct {
+		name string
+		body string
+		want bool
+	}{
+		{"series field", `{"invoices":{"0":{"invoice":{"errors":{"0":{"error":{"field":"series",
+			"message":"Firma nie posiada takiej serii.","method":{"name":"notEmpty","parameters":""}}}}}}},
+			"status":{"code":"ERROR"}}`, true},
+		{"message only", `{"invoices":{"0":{"invoice":{"errors":{"0":{"error":{"field":"type",
+			"message":"Company has no such series for this document type"}}}}}},"status":{"code":"ERROR"}}`, true},
+		{"other invoice error", `{"invoices":{"0":{"invoice":{"errors":{"0":{"error":{"field":"paymentdate",
+			"message":"Niepoprawna data"}}}}}},"status":{"code":"ERROR"}}`, false},
+		{"line error", `{"invoices":{"0":{"invoice":{"invoicecontents":{"0":{"invoicecontent":{"name":"Seria książek",
+			"errors":{"0":{"error":{"field":"count","message":"Stan magazynowy jest niewystarczający"}}}}}}}}},
+			"status":{"code":"ERROR"}}`, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var resp InvoiceResponse
+			if err := json.Unmarshal([]byte(tc.body), &resp); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if got := hasSeriesError(&resp); got != tc.want {
+				t.Errorf("hasSeriesError = %v, want %v", got, tc.want)
+			}
+		})
+	}
+
+	c := &Client{
+		enabled: true,
+		hc:      &stubDoer{bodies: []string{cases[0].body}},
+		baseURL: "https://api.wfirma.test",
+		log:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	inv := &Invoice{Type: string(invoiceNormal)}
+	_, err := c.submitInvoice(context.Background(), c.log, inv, nil)
+	if !errors.Is(err, entity.ErrInvoiceSeriesMissing) {
+		t.Fatalf("submitInvoice error = %v, want ErrInvoiceSeriesMissing", err)
+	}
+	if !strings.Contains(err.Error(), "configure the normal series in wFirma") {
+		t.Errorf("error %q does not say what to configure", err)
+	}
+}
+
+// routeDoer answers wFirma requests by module and action path, recording the payload
+// sent to each; paths without a canned body get a bare OK status.
+type routeDoer struct {
+	bodies   map[string]string
+	payloads map[string]string
+}
+
+func (d *routeDoer) Do(req *http.Request) (*http.Response, error) {
+	payload, _ := io.ReadAll(req.Body)
+	if d.payloads == nil {
+		d.payloads = make(map[string]string)
+	}
+	d.payloads[req.URL.Path] = string(payload)
+	body, ok := d.bodies[req.URL.Path]
+	if !ok {
+		body = `{"status":{"code":"OK"}}`
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(body)),
+	}, nil
+}
+
+// TestInvoiceSeries registers orders from each source through RegisterInvoice and checks
+// the numbering series on the invoices/add payload: the source's own series, else the
+// default, else none. Proformas never carry the VAT invoice series.
+func TestInvoiceSeries(t *testing.T) {
+	const created = `{"invoices":{"0":{"invoice":{"id":"501","fullnumber":"FV 7/2025"}}},"status":{"code":"OK"}}`
+	const found = `{"contractors":{"0":{"contractor":{"id":"77","name":"Buyer","country":"PL"}}},"status":{"code":"OK"}}`
+	cases := []struct {
+		name     string
+		fallback string
+		series   map[string]string
+		source   entity.Source
+		proforma bool
+		want     string
+	}{
+		{"not configured", "", nil, entity.SourceOpenCart, false, ""},
+		{"default", "11", nil, entity.SourceOpenCart, false, "11"},
+		{"per source", "11", map[string]string{"opencart": "12", " B2B ": "13"}, entity.SourceOpenCart, false, "12"},
+		{"source key normalized", "11", map[string]string{" B2B ": "13"}, entity.SourceB2B, false, "13"},
+		{"api when no source", "", map[string]string{"api": "14"}, "", false, "14"},
+		{"blank override ignored", "11", map[string]string{"stripe": " "}, entity.SourceStripe, false, "11"},
+		{"proforma", "11", map[string]string{"opencart": "12"}, entity.SourceOpenCart, true, ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			hc := &routeDoer{bodies: map[string]string{
+				"/contractors/find": found,
+				"/invoices/add":     created,
+			}}
+			c := &Client{
+				enabled:        true,
+				hc:             hc,
+				baseURL:        "https://api.wfirma.test",
+				log:            slog.New(slog.NewTextHandler(io.Discard, nil)),
+				defaultSeries:  tc.fallback,
+				seriesBySource: seriesBySource(tc.series),
+				vatCodes:       map[string]string{"23": "222"},
+			}
+			params := &entity.CheckoutParams{
+				OrderId:       "1001",
+				Source:        tc.source,
+				Currency:      "PLN",
+				Total:         12300,
+				ClientDetails: &entity.ClientDetails{Name: "Buyer", Email: "buyer@example.com", Country: "PL"},
+				LineItems:     []*entity.LineItem{{Name: "Book", Qty: 1, Price: 12300}},
+			}
+
+			register := c.RegisterInvoice
+			if tc.proforma {
+				register = c.RegisterProforma
+			}
+			payment, err := register(context.Background(), params)
+			if err != nil {
+				t.Fatalf("register: %v", err)
+			}
+			if payment.Id != "501" {
+				t.Errorf("payment id = %q, want 501", payment.Id)
+			}
+			sent, ok := hc.payloads["/invoices/add"]
+			if !ok {
+				t.Fatalf("no invoices/add request, sent %v", hc.payloads)
+			}
+			wantField := `"series":{"id":"` + tc.want + `"}`
+			if tc.want == "" {
+				if strings.Contains(sent, `"series"`) {
+					t.Errorf("payload carries a series without one configured: %s", sent)
+				}
+			} else if !strings.Contains(sent, wantField) {
+				t.Errorf("payload %s lacks %s", sent, wantField)
+			}
+		})
+	}
+}
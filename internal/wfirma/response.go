@@ -26,6 +26,7 @@ type Contractor struct {
 	City      string    `json:"city,omitempty" bson:"city,omitempty"`
 	Country   string    `json:"country,omitempty" bson:"country,omitempty"`
 	Email     string    `json:"email,omitempty" bson:"email,omitempty"`
+	Phone     string    `json:"phone,omitempty" bson:"phone,omitempty"`
 	Name      string    `json:"name,omitempty" bson:"name,omitempty"`
 	Street    string    `json:"street,omitempty" bson:"street,omitempty"`
 	Zip       string    `json:"zip,omitempty" bson:"zip,omitempty"`
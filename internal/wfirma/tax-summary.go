@@ -0,0 +1,99 @@
+package wfirma
+
+import (
+	"log/slog"
+	"strconv"
+	"strings"
+	"text/template"
+	"wfsync/entity"
+	"wfsync/lib/money"
+	"wfsync/lib/sl"
+)
+
+// defaultTaxTitle is the tax summary title used when wfirma.tax_title is empty or
+// invalid: "VAT 23%", "VAT WDT".
+const defaultTaxTitle = `VAT {{.Label}}`
+
+var defaultTaxTitleTemplate = template.Must(template.New("tax_title").Parse(defaultTaxTitle))
+
+// taxTitleData is what a tax title template renders. StoreTitle is the tax total title
+// the store sent with the order (CheckoutParams.TaxTitle), empty for B2B orders.
+type taxTitleData struct {
+	Code       string
+	Label      string
+	Rate       float64
+	StoreTitle string
+}
+
+// newTaxTitleTemplate parses the configured tax title template. A template that does
+// not parse is logged and replaced by the default.
+func newTaxTitleTemplate(text string, log *slog.Logger) *template.Template {
+	if strings.TrimSpace(text) == "" {
+		return defaultTaxTitleTemplate
+	}
+	tmpl, err := template.New("tax_title").Option("missingkey=error").Parse(text)
+	if err != nil {
+		log.Error("invalid tax title template, using default", sl.Err(err))
+		return defaultTaxTitleTemplate
+	}
+	return tmpl
+}
+
+// taxSummary groups the order lines by the VAT code they were invoiced with (codes[i]
+// belongs to params.LineItems[i]) and returns one TaxLine per code, in order of first
+// appearance. The VAT of each group is extracted from its gross total and rounded once
+// per group, as wFirma does for a "brutto" invoice.
+func (c *Client) taxSummary(params *entity.CheckoutParams, codes []string) []*entity.TaxLine {
+	var summary []*entity.TaxLine
+	groups := make(map[string]*entity.TaxLine)
+	for i, line := range params.LineItems {
+		if line == nil || i >= len(codes) {
+			continue
+		}
+		code := codes[i]
+		group, ok := groups[code]
+		if !ok {
+			rate, _ := strconv.ParseFloat(code, 64)
+			group = &entity.TaxLine{Code: code, Rate: rate}
+			groups[code] = group
+			summary = append(summary, group)
+		}
+		group.Gross += line.Price * line.Qty
+	}
+
+	currency := strings.ToUpper(params.Currency)
+	for _, group := range summary {
+		gross := money.New(group.Gross, currency)
+		value := gross.MulRate(group.Rate / (100 + group.Rate))
+		group.Value = value.Cents
+		group.Net = group.Gross - group.Value
+		group.Title = c.taxTitle(params, group)
+		group.Text = strings.TrimSpace(group.Title + ": " + value.Format(c.decimalSeparator) + " " + currency)
+	}
+	return summary
+}
+
+// taxTitle renders the title of one tax group, falling back to the default template when
+// the configured one fails on this data.
+func (c *Client) taxTitle(params *entity.CheckoutParams, group *entity.TaxLine) string {
+	data := taxTitleData{
+		Code:       group.Code,
+		Label:      entity.TaxLabel(group.Code),
+		Rate:       group.Rate,
+		StoreTitle: params.TaxTitle,
+	}
+	tmpl := c.taxTitleTmpl
+	if tmpl == nil {
+		tmpl = defaultTaxTitleTemplate
+	}
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, data); err != nil {
+		c.log.With(
+			slog.String("order_id", params.OrderId),
+			sl.Err(err),
+		).Warn("render tax title, using default")
+		sb.Reset()
+		_ = defaultTaxTitleTemplate.Execute(&sb, data)
+	}
+	return strings.TrimSpace(sb.String())
+}
@@ -0,0 +1,85 @@
+package wfirma
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+	"wfsync/entity"
+)
+
+// TestTaxSummaryMixedCart summarizes a cart with standard, reduced, exempt and shipping
+// lines: one group per VAT code in order of first appearance, VAT extracted from the
+// gross group total, and the title and text rendered with the configured template and
+// decimal separator.
+func TestTaxSummaryMixedCart(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	reduced := 8
+	params := &entity.CheckoutParams{
+		OrderId:  "12345",
+		Currency: "pln",
+		TaxTitle: "VAT (23%)",
+		LineItems: []*entity.LineItem{
+			{Name: "Mug", Qty: 2, Price: 4100},
+			{Name: "Coffee", Qty: 1, Price: 5400, VatRate: &reduced},
+			{Name: "Book", Qty: 1, Price: 3000, TaxExempt: true},
+			{Name: "Poster", Qty: 1, Price: 1230},
+			{Name: "Delivery", Qty: 1, Price: 1845, Shipping: true},
+		},
+	}
+	codes := make([]string, len(params.LineItems))
+	for i, line := range params.LineItems {
+		codes[i] = contentVatCode(line, "23", "", true)
+	}
+
+	type want struct {
+		code              string
+		net, value, gross int64
+		title, text       string
+	}
+	cases := []struct {
+		name      string
+		template  string
+		separator string
+		want      []want
+	}{
+		{"default", "", ".", []want{
+			{"23", 9167, 2108, 11275, "VAT 23%", "VAT 23%: 21.08 PLN"},
+			{"8", 5000, 400, 5400, "VAT 8%", "VAT 8%: 4.00 PLN"},
+			{"0", 3000, 0, 3000, "VAT 0%", "VAT 0%: 0.00 PLN"},
+		}},
+		{"custom title and comma", "Podatek {{.Label}}", ",", []want{
+			{"23", 9167, 2108, 11275, "Podatek 23%", "Podatek 23%: 21,08 PLN"},
+			{"8", 5000, 400, 5400, "Podatek 8%", "Podatek 8%: 4,00 PLN"},
+			{"0", 3000, 0, 3000, "Podatek 0%", "Podatek 0%: 0,00 PLN"},
+		}},
+		{"unknown field", "{{.Name}}", "", []want{
+			{"23", 9167, 2108, 11275, "VAT 23%", "VAT 23%: 21.08 PLN"},
+			{"8", 5000, 400, 5400, "VAT 8%", "VAT 8%: 4.00 PLN"},
+			{"0", 3000, 0, 3000, "VAT 0%", "VAT 0%: 0.00 PLN"},
+		}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &Client{log: log, taxTitleTmpl: newTaxTitleTemplate(tc.template, log), decimalSeparator: tc.separator}
+			got := c.taxSummary(params, codes)
+			if len(got) != len(tc.want) {
+				t.Fatalf("tax lines = %d, want %d", len(got), len(tc.want))
+			}
+			var gross int64
+			for i, w := range tc.want {
+				g := got[i]
+				if g.Code != w.code || g.Net != w.net || g.Value != w.value || g.Gross != w.gross {
+					t.Errorf("line %d = %s net %d vat %d gross %d, want %s net %d vat %d gross %d",
+						i, g.Code, g.Net, g.Value, g.Gross, w.code, w.net, w.value, w.gross)
+				}
+				if g.Title != w.title || g.Text != w.text {
+					t.Errorf("line %d title %q text %q, want %q %q", i, g.Title, g.Text, w.title, w.text)
+				}
+				gross += g.Gross
+			}
+			if gross != 19675 {
+				t.Errorf("summed gross = %d, want the cart total 19675", gross)
+			}
+		})
+	}
+}
@@ -60,7 +60,8 @@ func buildDefaultEURates() map[string]int {
 // calculates the destination-country VAT rate and we pass it through to wfirma.
 //
 // When taxRate is 0 (caller didn't provide tax_value), the rate is inferred:
-//   - PL or unknown country → 23% (Polish standard rate)
+//   - PL or unknown country → 23% (Polish standard rate); invoice() substitutes the
+//     configured default_vat_rate beforehand via orderVatRate
 //   - EU B2C → destination-country rate from VATProvider or defaultEURates
 //   - Non-EU / EU B2B → handled by WDT/EXP codes (rate irrelevant)
 //
@@ -115,6 +116,60 @@ func resolveGoodsVatCode(taxRate int, countryCode string, hasTaxId bool, b2b boo
 	return strconv.Itoa(taxRate)
 }
 
+// DomesticSale reports whether an order is taxed as a sale in Poland: the only case where
+// a line's own Polish rate applies. An OSS sale is taxed at the destination's rates.
+func DomesticSale(countryCode string) bool {
+	return countryCode == "" || countryCode == "PL"
+}
+
+// orderVatRate returns the order-level VAT rate derived from the OpenCart tax total. A
+// domestic order without tax data falls back to the configured default rate rather than
+// the standard 23%, so shops selling reduced-rate goods are invoiced correctly.
+func orderVatRate(params *entity.CheckoutParams, countryCode string, defaultRate int) int {
+	domestic := DomesticSale(countryCode)
+	rate := params.TaxRate(domestic)
+	if rate == 0 && domestic && defaultRate > 0 {
+		return defaultRate
+	}
+	return rate
+}
+
+// lineVatCode returns the VAT code for a single invoice line. A tax-exempt line is
+// invoiced at 0%, but only when the sale is rated at all: zero-rated cross-border codes
+// (WDT, EXP, ...) apply to the whole supply regardless of the goods. A line's explicit
+// VatRate (reduced-rate goods in a mixed cart) is a Polish rate, so it replaces the
+// order-level rate on domestic sales only; other sales keep the order rate.
+func lineVatCode(line *entity.LineItem, goodsVat string, domestic bool) string {
+	ownRate := domestic && line != nil && line.VatRate != nil
+	if line == nil || (!ownRate && !line.TaxExempt) {
+		return goodsVat
+	}
+	switch goodsVat {
+	case vatWDT, vatEXP, vatNP, vatNPUE, vatZW:
+		return goodsVat
+	}
+	if line.TaxExempt {
+		return "0"
+	}
+	return strconv.Itoa(*line.VatRate)
+}
+
+// contentVatCode returns the VAT code for an invoice line, applying the configured
+// shipping code to shipping lines. A rate carried by the line itself (the order's
+// shipping_vat_rate) wins over the configured code on domestic sales, and zero-rated
+// supplies keep their code for shipping too, since the shipping follows the goods out of
+// the country.
+func contentVatCode(line *entity.LineItem, goodsVat, shippingCode string, domestic bool) string {
+	if line == nil || !line.Shipping || shippingCode == "" || (domestic && line.VatRate != nil) || line.TaxExempt {
+		return lineVatCode(line, goodsVat, domestic)
+	}
+	switch goodsVat {
+	case vatWDT, vatEXP, vatNP, vatNPUE, vatZW:
+		return goodsVat
+	}
+	return shippingCode
+}
+
 // ExpectedB2BVATRate returns the VAT rate percent that internal rules require for
 // a B2B order shipped to countryCode, given whether the buyer supplied a VAT
 // number. It mirrors resolveGoodsVatCode's B2B branch but yields a plain numeric
@@ -96,3 +96,106 @@ func TestNormalizeEUVatNumber(t *testing.T) {
 		})
 	}
 }
+
+// TestOrderVatRateDefault checks that only a domestic order without tax data picks up
+// the configured default rate; derived rates and foreign orders are never overridden.
+func TestOrderVatRateDefault(t *testing.T) {
+	noTax := &entity.CheckoutParams{Total: 10800}
+	taxed := &entity.CheckoutParams{Total: 12300, TaxValue: 2300}
+	cases := []struct {
+		name        string
+		params      *entity.CheckoutParams
+		country     string
+		defaultRate int
+		want        int
+	}{
+		{"PL without tax uses configured default", noTax, "PL", 8, 8},
+		{"unknown country without tax uses configured default", noTax, "", 5, 5},
+		{"derived rate wins over default", taxed, "PL", 8, 23},
+		{"EU order keeps provider fallback", noTax, "DE", 8, 0},
+		{"unset default keeps legacy behaviour", noTax, "PL", 0, 0},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := orderVatRate(tc.params, tc.country, tc.defaultRate); got != tc.want {
+				t.Errorf("orderVatRate() = %d, want %d", got, tc.want)
+			}
+		})
+	}
+}
+
+// TestLineVatCodeMixedCart covers a cart with standard, reduced-rate and tax-exempt goods:
+// domestic sales take each line's own rate (0% for exempt lines, which wins over VatRate),
+// EU B2C sales keep the destination rate for reduced-rate goods, and zero-rated
+// cross-border codes apply to every line.
+func TestLineVatCodeMixedCart(t *testing.T) {
+	rate := func(v int) *int { return &v }
+	book := &entity.LineItem{Name: "Book", Qty: 1, Price: 5000, VatRate: rate(5)}
+	food := &entity.LineItem{Name: "Food", Qty: 2, Price: 1000, VatRate: rate(8)}
+	gadget := &entity.LineItem{Name: "Gadget", Qty: 1, Price: 12300}
+	exempt := &entity.LineItem{Name: "Course", Qty: 1, Price: 20000, TaxExempt: true, VatRate: rate(8)}
+
+	cases := []struct {
+		name     string
+		goodsVat string
+		domestic bool
+		want     []string
+	}{
+		{"domestic mixed cart", "23", true, []string{"5", "8", "23", "0"}},
+		{"EU B2C ignores per-line rates", "19", false, []string{"19", "19", "19", "0"}},
+		{"intra-community delivery", vatWDT, false, []string{vatWDT, vatWDT, vatWDT, vatWDT}},
+		{"export", vatEXP, false, []string{vatEXP, vatEXP, vatEXP, vatEXP}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			for i, line := range []*entity.LineItem{book, food, gadget, exempt} {
+				if got := lineVatCode(line, tc.goodsVat, tc.domestic); got != tc.want[i] {
+					t.Errorf("%s: lineVatCode() = %q, want %q", line.Name, got, tc.want[i])
+				}
+			}
+		})
+	}
+}
+
+// TestContentVatCode checks shipping VAT at the goods rate, at a configured standard or
+// zero rate, and at a rate carried by the order on domestic sales only, and that
+// zero-rated supplies and goods lines are unaffected by the shipping setting.
+func TestContentVatCode(t *testing.T) {
+	zero := 0
+	standard := 23
+	withRate := func(rate *int) *entity.LineItem {
+		p := &entity.CheckoutParams{ShippingVatRate: rate}
+		p.AddShipping("", 1500)
+		return p.LineItems[0]
+	}
+	shipping := entity.ShippingLineItem("", 1500)
+	goods := &entity.LineItem{Name: "Book", Qty: 1, Price: 3000}
+
+	cases := []struct {
+		name       string
+		line       *entity.LineItem
+		goodsVat   string
+		configured string
+		want       string
+	}{
+		{"follows goods rate", shipping, "8", "", "8"},
+		{"configured standard rate", shipping, "8", "23", "23"},
+		{"configured zero rate", shipping, "23", "0", "0"},
+		{"configured exempt code", shipping, "23", "ZW", "ZW"},
+		{"order zero rate wins", withRate(&zero), "23", "8", "0"},
+		{"order standard rate wins", withRate(&standard), "8", "0", "23"},
+		{"export keeps its code", shipping, vatEXP, "23", vatEXP},
+		{"intra-EU keeps its code", withRate(&standard), vatWDT, "", vatWDT},
+		{"goods line ignores shipping code", goods, "8", "23", "8"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := contentVatCode(tc.line, tc.goodsVat, tc.configured, true); got != tc.want {
+				t.Errorf("contentVatCode() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+	if got := contentVatCode(withRate(&zero), "19", "", false); got != "19" {
+		t.Errorf("EU B2C shipping with an order rate = %q, want the goods rate 19", got)
+	}
+}
@@ -1,6 +1,9 @@
 package response
 
-import "wfsync/lib/clock"
+import (
+	"wfsync/lib/clock"
+	"wfsync/lib/validate"
+)
 
 type Response struct {
 	Data          interface{} `json:"data,omitempty"`
@@ -25,3 +28,13 @@ func Error(message string) Response {
 		Timestamp:     clock.Now(),
 	}
 }
+
+// Invalid is Error for a rejected request body: when err carries field validation
+// failures they are returned in Data, so clients can point at the offending fields.
+func Invalid(message string, err error) Response {
+	resp := Error(message)
+	if fields := validate.Fields(err); len(fields) > 0 {
+		resp.Data = fields
+	}
+	return resp
+}
@@ -0,0 +1,87 @@
+// Package audit records state-changing operations (documents issued, payments captured
+// or canceled, user roles changed) in an append-only log for compliance.
+package audit
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"wfsync/entity"
+	"wfsync/lib/api/cont"
+	"wfsync/lib/clock"
+	"wfsync/lib/sl"
+)
+
+// ActorSystem is the actor of operations nobody requested directly: webhooks, pollers
+// and background jobs.
+const ActorSystem = "system"
+
+// Store appends audit entries; it never updates or deletes them.
+type Store interface {
+	AppendAuditEntry(entry *entity.AuditEntry) error
+}
+
+// Log writes audit entries to a store. A nil *Log records nothing, so callers need no
+// checks when auditing is not configured.
+type Log struct {
+	store Store
+	log   *slog.Logger
+	clock clock.Clock
+}
+
+func New(store Store, log *slog.Logger) *Log {
+	return &Log{
+		store: store,
+		log:   log.With(sl.Module("audit")),
+		clock: clock.Real,
+	}
+}
+
+// SetClock replaces the clock entries are stamped with.
+func (l *Log) SetClock(c clock.Clock) {
+	l.clock = c
+}
+
+// Record appends an entry. A failure is logged and does not fail the operation, which
+// has already happened.
+func (l *Log) Record(actor, action, target string, before, after interface{}) {
+	if l == nil {
+		return
+	}
+	entry := &entity.AuditEntry{
+		Time:   l.clock.Now(),
+		Actor:  actor,
+		Action: action,
+		Target: target,
+		Before: before,
+		After:  after,
+	}
+	if err := l.store.AppendAuditEntry(entry); err != nil {
+		l.log.With(
+			slog.String("action", action),
+			slog.String("target", target),
+			sl.Err(err),
+		).Error("append audit entry")
+	}
+}
+
+// Actor returns the API user a request was authenticated as, or ActorSystem when the
+// context carries none.
+func Actor(ctx context.Context) string {
+	if ctx != nil {
+		if user := cont.GetUser(ctx); user.Username != "" {
+			return user.Username
+		}
+	}
+	return ActorSystem
+}
+
+// TelegramActor names a Telegram user as an actor or target.
+func TelegramActor(telegramId int64) string {
+	return fmt.Sprintf("telegram:%d", telegramId)
+}
+
+// OrderTarget names an order as a target.
+func OrderTarget(orderId string) string {
+	return "order:" + orderId
+}
@@ -0,0 +1,193 @@
+// Package features switches subsystems (Stripe, wFirma, OpenCart, Telegram) on and off at
+// runtime. Flags are stored in Mongo and cached; each client checks its flag at its entry
+// points, so a toggle applies without a restart.
+package features
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+	"wfsync/entity"
+	"wfsync/lib/audit"
+	"wfsync/lib/clock"
+	"wfsync/lib/sl"
+)
+
+// refreshInterval bounds how long a toggle made by another instance takes to apply here.
+const refreshInterval = 30 * time.Second
+
+// Store loads and saves feature flags.
+type Store interface {
+	GetFeatureFlags() ([]*entity.FeatureFlag, error)
+	SaveFeatureFlag(flag *entity.FeatureFlag) error
+}
+
+// Flags holds the cached state of the subsystem flags. A nil *Flags reports every
+// subsystem as enabled, so clients need no checks when flags are not configured.
+type Flags struct {
+	store    Store
+	log      *slog.Logger
+	clock    clock.Clock
+	auditLog *audit.Log
+
+	mu         sync.Mutex
+	flags      map[string]*entity.FeatureFlag
+	loaded     time.Time
+	refreshing bool
+	version    int // bumped by Set, so a reload started before it does not undo it
+}
+
+func New(store Store, log *slog.Logger) *Flags {
+	return &Flags{
+		store: store,
+		log:   log.With(sl.Module("features")),
+		clock: clock.Real,
+		flags: make(map[string]*entity.FeatureFlag),
+	}
+}
+
+// SetClock replaces the clock the cache expiry and flag updates are measured with.
+func (f *Flags) SetClock(c clock.Clock) {
+	f.clock = c
+}
+
+// SetAuditLog records every toggle in the audit log.
+func (f *Flags) SetAuditLog(auditLog *audit.Log) {
+	f.auditLog = auditLog
+}
+
+// Enabled reports whether a subsystem is switched on. Subsystems without a stored flag
+// are enabled.
+func (f *Flags) Enabled(name string) bool {
+	if f == nil {
+		return true
+	}
+	flag, ok := f.current()[name]
+	return !ok || flag.Enabled
+}
+
+// Check returns an error wrapping entity.ErrSubsystemDisabled when the subsystem is off.
+func (f *Flags) Check(name string) error {
+	if f.Enabled(name) {
+		return nil
+	}
+	return fmt.Errorf("%s: %w", name, entity.ErrSubsystemDisabled)
+}
+
+// List returns the state of every subsystem in entity.Features order, unset ones
+// included.
+func (f *Flags) List() []*entity.FeatureFlag {
+	var flags map[string]*entity.FeatureFlag
+	if f != nil {
+		flags = f.current()
+	}
+	list := make([]*entity.FeatureFlag, 0, len(entity.Features))
+	for _, name := range entity.Features {
+		if flag, ok := flags[name]; ok {
+			copied := *flag
+			list = append(list, &copied)
+			continue
+		}
+		list = append(list, &entity.FeatureFlag{Name: name, Enabled: true})
+	}
+	return list
+}
+
+// Set switches a subsystem on or off, stores the flag and applies it at once.
+func (f *Flags) Set(name string, enabled bool, actor string) (*entity.FeatureFlag, error) {
+	if f == nil {
+		return nil, fmt.Errorf("feature flags not configured")
+	}
+	if !known(name) {
+		return nil, fmt.Errorf("%w: %q", entity.ErrUnknownFeature, name)
+	}
+
+	before := true
+	if old, ok := f.current()[name]; ok {
+		before = old.Enabled
+	}
+	flag := &entity.FeatureFlag{
+		Name:      name,
+		Enabled:   enabled,
+		UpdatedBy: actor,
+		UpdatedAt: f.clock.Now(),
+	}
+	if err := f.store.SaveFeatureFlag(flag); err != nil {
+		return nil, fmt.Errorf("save feature flag: %w", err)
+	}
+
+	f.mu.Lock()
+	flags := make(map[string]*entity.FeatureFlag, len(f.flags)+1)
+	for k, v := range f.flags {
+		flags[k] = v
+	}
+	flags[name] = flag
+	f.flags = flags
+	f.version++
+	f.mu.Unlock()
+
+	f.auditLog.Record(actor, entity.AuditFeatureToggle, "feature:"+name,
+		map[string]bool{"enabled": before}, map[string]bool{"enabled": enabled})
+	f.log.With(
+		slog.String("feature", name),
+		slog.Bool("enabled", enabled),
+		slog.String("actor", actor),
+	).Info("feature flag changed")
+	return flag, nil
+}
+
+// current returns the cached flags. Once the cache is older than refreshInterval, the
+// first caller reloads it from the store, outside the lock; callers meanwhile get the
+// last snapshot instead of waiting for the store. Only the very first load is waited for,
+// so a switched-off subsystem is not reported enabled at startup. On a load error the
+// last known states stay in effect. The map is never modified once published, so callers
+// may read it without the lock.
+func (f *Flags) current() map[string]*entity.FeatureFlag {
+	f.mu.Lock()
+	now := f.clock.Now()
+	flags, first := f.flags, f.loaded.IsZero()
+	if !first && (f.refreshing || now.Sub(f.loaded) < refreshInterval) {
+		f.mu.Unlock()
+		return flags
+	}
+	f.refreshing = true
+	version := f.version
+	f.mu.Unlock()
+
+	return f.reload(now, version)
+}
+
+// reload loads the flags from the store and publishes them, unless Set changed a flag
+// since version was read. Logging happens after the lock is released: the Telegram log
+// handler checks a flag itself.
+func (f *Flags) reload(now time.Time, version int) map[string]*entity.FeatureFlag {
+	stored, err := f.store.GetFeatureFlags()
+
+	f.mu.Lock()
+	f.refreshing = false
+	f.loaded = now
+	if err == nil && f.version == version {
+		flags := make(map[string]*entity.FeatureFlag, len(stored))
+		for _, flag := range stored {
+			flags[flag.Name] = flag
+		}
+		f.flags = flags
+	}
+	flags := f.flags
+	f.mu.Unlock()
+
+	if err != nil {
+		f.log.Warn("load feature flags", sl.Err(err))
+	}
+	return flags
+}
+
+func known(name string) bool {
+	for _, n := range entity.Features {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
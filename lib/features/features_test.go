@@ -0,0 +1,171 @@
+package features
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+	"wfsync/entity"
+	"wfsync/lib/clock"
+)
+
+// memStore keeps flags in memory; err fails every load. When hold is set, a load reads
+// the flags, reports on hold and waits for hold to be closed before returning them.
+type memStore struct {
+	flags map[string]*entity.FeatureFlag
+	loads int
+	err   error
+	hold  chan struct{}
+}
+
+func (s *memStore) GetFeatureFlags() ([]*entity.FeatureFlag, error) {
+	s.loads++
+	var list []*entity.FeatureFlag
+	for _, flag := range s.flags {
+		list = append(list, flag)
+	}
+	if hold := s.hold; hold != nil {
+		hold <- struct{}{}
+		<-hold
+	}
+	if s.err != nil {
+		return nil, s.err
+	}
+	return list, nil
+}
+
+func (s *memStore) SaveFeatureFlag(flag *entity.FeatureFlag) error {
+	s.flags[flag.Name] = flag
+	return nil
+}
+
+func newTestFlags(store *memStore) (*Flags, *clock.Mock) {
+	f := New(store, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	mock := clock.NewMock(time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC))
+	f.SetClock(mock)
+	return f, mock
+}
+
+// TestFlagsDefaultEnabled checks that a nil Flags and a subsystem without a stored flag
+// are both enabled.
+func TestFlagsDefaultEnabled(t *testing.T) {
+	var none *Flags
+	if !none.Enabled(entity.FeatureStripe) || none.Check(entity.FeatureWFirma) != nil {
+		t.Error("nil flags must report every subsystem enabled")
+	}
+	if _, err := none.Set(entity.FeatureStripe, false, "admin"); err == nil {
+		t.Error("Set on nil flags must fail")
+	}
+
+	f, _ := newTestFlags(&memStore{flags: map[string]*entity.FeatureFlag{}})
+	for _, flag := range f.List() {
+		if !flag.Enabled {
+			t.Errorf("%s disabled without a stored flag", flag.Name)
+		}
+	}
+	if len(f.List()) != len(entity.Features) {
+		t.Errorf("List returned %d flags, want %d", len(f.List()), len(entity.Features))
+	}
+}
+
+// TestFlagsSet switches a subsystem off and on again, and refuses unknown names.
+func TestFlagsSet(t *testing.T) {
+	store := &memStore{flags: map[string]*entity.FeatureFlag{}}
+	f, mock := newTestFlags(store)
+
+	flag, err := f.Set(entity.FeatureWFirma, false, "admin")
+	if err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if flag.UpdatedBy != "admin" || !flag.UpdatedAt.Equal(mock.Now()) {
+		t.Errorf("flag = %+v, want updated by admin at %v", flag, mock.Now())
+	}
+	if stored := store.flags[entity.FeatureWFirma]; stored == nil || stored.Enabled {
+		t.Errorf("stored flag = %+v, want disabled", stored)
+	}
+	if err = f.Check(entity.FeatureWFirma); !errors.Is(err, entity.ErrSubsystemDisabled) {
+		t.Errorf("Check = %v, want ErrSubsystemDisabled", err)
+	}
+	if !f.Enabled(entity.FeatureStripe) {
+		t.Error("switching wfirma off must not affect stripe")
+	}
+
+	if _, err = f.Set(entity.FeatureWFirma, true, "admin"); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if !f.Enabled(entity.FeatureWFirma) {
+		t.Error("wfirma still disabled after switching it on")
+	}
+
+	if _, err = f.Set("billing", false, "admin"); !errors.Is(err, entity.ErrUnknownFeature) {
+		t.Errorf("Set unknown = %v, want ErrUnknownFeature", err)
+	}
+}
+
+// TestFlagsRefresh checks the cache: a change made by another instance applies once the
+// refresh interval has passed, and a failed reload keeps the last known states.
+func TestFlagsRefresh(t *testing.T) {
+	store := &memStore{flags: map[string]*entity.FeatureFlag{}}
+	f, mock := newTestFlags(store)
+
+	if !f.Enabled(entity.FeatureOpenCart) {
+		t.Fatal("opencart disabled at start")
+	}
+	store.flags[entity.FeatureOpenCart] = &entity.FeatureFlag{Name: entity.FeatureOpenCart}
+
+	mock.Advance(refreshInterval / 2)
+	if !f.Enabled(entity.FeatureOpenCart) || store.loads != 1 {
+		t.Errorf("reloaded before the interval: loads = %d", store.loads)
+	}
+
+	mock.Advance(refreshInterval)
+	if f.Enabled(entity.FeatureOpenCart) {
+		t.Error("remote change not applied after the interval")
+	}
+
+	store.err = errors.New("mongo down")
+	mock.Advance(refreshInterval)
+	if f.Enabled(entity.FeatureOpenCart) {
+		t.Error("failed reload must keep the last known state")
+	}
+}
+
+// TestFlagsRefreshOutsideLock holds a reload in the store: other callers keep getting the
+// last snapshot meanwhile, and a flag set during the reload is not undone by it.
+func TestFlagsRefreshOutsideLock(t *testing.T) {
+	store := &memStore{flags: map[string]*entity.FeatureFlag{}}
+	f, mock := newTestFlags(store)
+	f.Enabled(entity.FeatureStripe)
+
+	hold := make(chan struct{})
+	store.hold = hold
+	mock.Advance(refreshInterval)
+	done := make(chan struct{})
+	go func() {
+		f.Enabled(entity.FeatureWFirma)
+		close(done)
+	}()
+	<-hold
+	store.hold = nil
+
+	served := make(chan bool)
+	go func() { served <- f.Enabled(entity.FeatureStripe) }()
+	select {
+	case enabled := <-served:
+		if !enabled {
+			t.Error("snapshot served during the reload reports stripe disabled")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("caller blocked behind the reload")
+	}
+
+	if _, err := f.Set(entity.FeatureWFirma, false, "admin"); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	close(hold)
+	<-done
+	if f.Enabled(entity.FeatureWFirma) {
+		t.Error("reload started before Set undid the flag")
+	}
+}
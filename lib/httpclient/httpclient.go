@@ -0,0 +1,62 @@
+// Package httpclient builds the http.Client used for outbound API calls (wFirma, Stripe),
+// so deployments behind a corporate proxy or with a private CA bundle are configured once.
+package httpclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// Options configures outbound HTTP. The zero value gives a client that behaves like the
+// standard library default: proxy from the HTTP_PROXY/HTTPS_PROXY environment and the
+// system CA pool.
+type Options struct {
+	Proxy   string        // proxy URL, e.g. "http://proxy.local:3128"; empty uses the environment
+	CAFile  string        // PEM bundle added to the system CA pool
+	Timeout time.Duration // overall request timeout; 0 uses the caller's default
+}
+
+// IsZero reports whether no outbound setting is configured.
+func (o Options) IsZero() bool {
+	return o.Proxy == "" && o.CAFile == "" && o.Timeout == 0
+}
+
+// New returns a client for the options. defaultTimeout applies when Options.Timeout is
+// not set, so each integration keeps its own default.
+func New(opts Options, defaultTimeout time.Duration) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if opts.Proxy != "" {
+		proxyURL, err := url.Parse(opts.Proxy)
+		if err != nil || proxyURL.Scheme == "" || proxyURL.Host == "" {
+			return nil, fmt.Errorf("invalid proxy url %q", opts.Proxy)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	if opts.CAFile != "" {
+		pem, err := os.ReadFile(opts.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read ca file: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in ca file %s", opts.CAFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	return &http.Client{Transport: transport, Timeout: timeout}, nil
+}
@@ -0,0 +1,111 @@
+package httpclient
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestNewProxy sends a request through a configured proxy: the proxy, not the target
+// host, receives it, with the target as the absolute request URL.
+func TestNewProxy(t *testing.T) {
+	var got string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.URL.String()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer proxy.Close()
+
+	hc, err := New(Options{Proxy: proxy.URL}, time.Second)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	resp, err := hc.Get("http://api.wfirma.invalid/invoices/find")
+	if err != nil {
+		t.Fatalf("request through proxy: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent || got != "http://api.wfirma.invalid/invoices/find" {
+		t.Errorf("proxy saw %q with status %d, want the target url", got, resp.StatusCode)
+	}
+}
+
+// TestNewTimeout checks that a configured timeout wins over the caller's default and
+// that the default applies otherwise, and that a slow server is cut off.
+func TestNewTimeout(t *testing.T) {
+	cases := []struct {
+		name    string
+		timeout time.Duration
+		want    time.Duration
+	}{
+		{"configured", 5 * time.Second, 5 * time.Second},
+		{"default", 0, 55 * time.Second},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			hc, err := New(Options{Timeout: tc.timeout}, 55*time.Second)
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			if hc.Timeout != tc.want {
+				t.Errorf("timeout = %v, want %v", hc.Timeout, tc.want)
+			}
+		})
+	}
+
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer slow.Close()
+	defer close(release)
+	hc, _ := New(Options{Timeout: 50 * time.Millisecond}, time.Minute)
+	if _, err := hc.Get(slow.URL); err == nil {
+		t.Error("expected a timeout from a server that never answers")
+	}
+}
+
+// TestNewCAFile trusts a server certificate from a PEM bundle, and rejects a missing
+// file, a file without certificates and a malformed proxy url.
+func TestNewCAFile(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.pem")
+	block := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := os.WriteFile(caFile, block, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	hc, err := New(Options{CAFile: caFile}, time.Second)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	resp, err := hc.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("request with custom ca: %v", err)
+	}
+	_ = resp.Body.Close()
+
+	plain, _ := New(Options{}, time.Second)
+	if _, err = plain.Get(srv.URL); err == nil {
+		t.Error("server certificate trusted without the ca file")
+	}
+
+	empty := filepath.Join(dir, "empty.pem")
+	_ = os.WriteFile(empty, []byte("not a certificate"), 0o600)
+	for _, opts := range []Options{
+		{CAFile: filepath.Join(dir, "missing.pem")},
+		{CAFile: empty},
+		{Proxy: "proxy.local:3128"},
+	} {
+		if _, err = New(opts, time.Second); err == nil {
+			t.Errorf("New(%+v): expected an error", opts)
+		}
+	}
+}
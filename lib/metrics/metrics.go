@@ -0,0 +1,55 @@
+// Package metrics keeps lightweight in-process counters for operational visibility
+// (the bot's /metrics command). The counters are package-level so any layer can count
+// an event without extra wiring; they start at zero on every restart.
+package metrics
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Counter is a monotonically increasing event count, safe for concurrent use.
+type Counter struct {
+	v atomic.Int64
+}
+
+// Inc counts one event.
+func (c *Counter) Inc() {
+	c.v.Add(1)
+}
+
+// Value returns the current count.
+func (c *Counter) Value() int64 {
+	return c.v.Load()
+}
+
+var (
+	// OrdersProcessed counts orders taken to their result status: OpenCart jobs and
+	// Stripe payments invoiced by core.
+	OrdersProcessed Counter
+	// InvoicesCreated counts documents (invoices and proformas) registered in wFirma,
+	// one per split part.
+	InvoicesCreated Counter
+	// Failures counts order and invoice flows that ended in an error.
+	Failures Counter
+
+	started = time.Now()
+)
+
+// Snapshot is a point-in-time copy of the counters.
+type Snapshot struct {
+	OrdersProcessed int64
+	InvoicesCreated int64
+	Failures        int64
+	Started         time.Time
+}
+
+// Read returns the current counter values and the process start time.
+func Read() Snapshot {
+	return Snapshot{
+		OrdersProcessed: OrdersProcessed.Value(),
+		InvoicesCreated: InvoicesCreated.Value(),
+		Failures:        Failures.Value(),
+		Started:         started,
+	}
+}
@@ -0,0 +1,140 @@
+// Package money represents amounts as integer minor units (cents) with their currency,
+// so conversions to and from the float64 values of the OpenCart database, B2B payloads
+// and the wFirma API round one way everywhere instead of truncating in some places.
+package money
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ErrCurrencyMismatch is returned when amounts in different currencies are combined.
+var ErrCurrencyMismatch = errors.New("currency mismatch")
+
+// Amount is an amount in minor units. Currency is an upper-case ISO 4217 code; an empty
+// currency means "unknown" and combines with any other.
+type Amount struct {
+	Cents    int64
+	Currency string
+}
+
+// New returns an amount of cents in currency. The currency code is upper-cased, so
+// Stripe's "pln" and wFirma's "PLN" compare equal.
+func New(cents int64, currency string) Amount {
+	return Amount{Cents: cents, Currency: strings.ToUpper(strings.TrimSpace(currency))}
+}
+
+// FromMajor converts an amount in major units (12.34) to an Amount, rounding to the
+// nearest cent.
+func FromMajor(value float64, currency string) Amount {
+	return New(Cents(value), currency)
+}
+
+// Cents converts major units to minor units, rounding half away from zero on the value
+// as written: 1.005 becomes 101 although 1.005*100 is 100.49999… in binary.
+func Cents(value float64) int64 {
+	return int64(round(value * 100))
+}
+
+// Major converts minor units to major units: 1234 → 12.34.
+func Major(cents int64) float64 {
+	return float64(cents) / 100
+}
+
+// round rounds half away from zero after dropping the binary noise below 1e-6, so a
+// product that is a half in decimal arithmetic is treated as one.
+func round(x float64) float64 {
+	return math.Round(math.Round(x*1e6) / 1e6)
+}
+
+// Major returns the amount in major units.
+func (a Amount) Major() float64 {
+	return Major(a.Cents)
+}
+
+func (a Amount) IsZero() bool {
+	return a.Cents == 0
+}
+
+// Neg returns the amount with the opposite sign.
+func (a Amount) Neg() Amount {
+	return Amount{Cents: -a.Cents, Currency: a.Currency}
+}
+
+// currency returns the currency of a result combining a and b, or an error when both
+// are known and differ.
+func (a Amount) currency(b Amount) (string, error) {
+	switch {
+	case a.Currency == "":
+		return b.Currency, nil
+	case b.Currency == "" || a.Currency == b.Currency:
+		return a.Currency, nil
+	}
+	return "", fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, a.Currency, b.Currency)
+}
+
+// Add returns a+b.
+func (a Amount) Add(b Amount) (Amount, error) {
+	cur, err := a.currency(b)
+	if err != nil {
+		return Amount{}, err
+	}
+	return Amount{Cents: a.Cents + b.Cents, Currency: cur}, nil
+}
+
+// Sub returns a-b.
+func (a Amount) Sub(b Amount) (Amount, error) {
+	return a.Add(b.Neg())
+}
+
+// Mul returns the amount times a whole quantity.
+func (a Amount) Mul(qty int64) Amount {
+	return Amount{Cents: a.Cents * qty, Currency: a.Currency}
+}
+
+// MulRate returns the amount scaled by k, rounded to the nearest cent.
+func (a Amount) MulRate(k float64) Amount {
+	return Amount{Cents: int64(round(float64(a.Cents) * k)), Currency: a.Currency}
+}
+
+// Sum adds amounts in one currency; an empty list sums to zero.
+func Sum(amounts ...Amount) (Amount, error) {
+	var total Amount
+	for _, a := range amounts {
+		var err error
+		if total, err = total.Add(a); err != nil {
+			return Amount{}, err
+		}
+	}
+	return total, nil
+}
+
+// Format renders the amount with two decimal places and sep as the decimal separator
+// ("." when empty), without the currency: 1870 → "18.70", -5 → "-0.05".
+func (a Amount) Format(sep string) string {
+	if sep == "" {
+		sep = "."
+	}
+	cents := a.Cents
+	sign := ""
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+	frac := strconv.FormatInt(cents%100, 10)
+	if len(frac) < 2 {
+		frac = "0" + frac
+	}
+	return sign + strconv.FormatInt(cents/100, 10) + sep + frac
+}
+
+// String renders the amount with its currency: "18.70 PLN".
+func (a Amount) String() string {
+	if a.Currency == "" {
+		return a.Format(".")
+	}
+	return a.Format(".") + " " + a.Currency
+}
@@ -0,0 +1,156 @@
+package money
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestCents covers the float → cents rounding: half away from zero on the decimal value,
+// including amounts whose binary representation falls just below the half.
+func TestCents(t *testing.T) {
+	cases := []struct {
+		value float64
+		want  int64
+	}{
+		{0, 0},
+		{0.01, 1},
+		{0.1 + 0.2, 30},
+		{1.15, 115},
+		{1.005, 101},
+		{2.675, 268},
+		{19.99, 1999},
+		{0.004, 0},
+		{0.005, 1},
+		{0.0049999, 0},
+		{-0.005, -1},
+		{-1.005, -101},
+		{-19.99, -1999},
+		{123456.785, 12345679},
+		{8.325 * 3, 2498},
+	}
+	for _, tc := range cases {
+		if got := Cents(tc.value); got != tc.want {
+			t.Errorf("Cents(%v) = %d, want %d", tc.value, got, tc.want)
+		}
+	}
+}
+
+// TestMajor converts cents back to major units and round-trips them through Cents.
+func TestMajor(t *testing.T) {
+	for _, cents := range []int64{0, 1, 5, 99, 100, 115, 1999, 100001, -1, -115} {
+		if got := Cents(Major(cents)); got != cents {
+			t.Errorf("Cents(Major(%d)) = %d", cents, got)
+		}
+	}
+	if got := New(1234, "pln").Major(); got != 12.34 {
+		t.Errorf("Major = %v, want 12.34", got)
+	}
+}
+
+// TestMulRate scales amounts and rounds half away from zero, as the VAT share of a gross
+// price and the proportional line adjustments need.
+func TestMulRate(t *testing.T) {
+	cases := []struct {
+		name  string
+		cents int64
+		k     float64
+		want  int64
+	}{
+		{"vat 23 share", 11275, 23.0 / 123, 2108},
+		{"vat 8 share", 5400, 8.0 / 108, 400},
+		{"vat 5 share of one cent", 1, 5.0 / 105, 0},
+		{"half up", 5, 0.5, 3},
+		{"half down negative", -5, 0.5, -3},
+		{"identity", 1999, 1, 1999},
+		{"zero", 1999, 0, 0},
+		{"proportional", 3333, 10000.0 / 9999, 3333},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := New(tc.cents, "PLN").MulRate(tc.k)
+			if got.Cents != tc.want || got.Currency != "PLN" {
+				t.Errorf("MulRate = %+v, want %d PLN", got, tc.want)
+			}
+		})
+	}
+}
+
+// TestArithmeticCurrency checks the currency guard: amounts in the same currency (in
+// any case) combine, an unknown currency adopts the other, and different currencies are
+// refused with ErrCurrencyMismatch.
+func TestArithmeticCurrency(t *testing.T) {
+	cases := []struct {
+		name     string
+		a, b     Amount
+		wantAdd  Amount
+		wantSub  Amount
+		mismatch bool
+	}{
+		{"same currency", New(1000, "PLN"), New(250, "PLN"), New(1250, "PLN"), New(750, "PLN"), false},
+		{"case insensitive", New(1000, "pln"), New(250, "PLN"), New(1250, "PLN"), New(750, "PLN"), false},
+		{"unknown left", New(1000, ""), New(250, "EUR"), New(1250, "EUR"), New(750, "EUR"), false},
+		{"unknown right", New(1000, "EUR"), New(250, ""), New(1250, "EUR"), New(750, "EUR"), false},
+		{"negative result", New(100, "EUR"), New(250, "EUR"), New(350, "EUR"), New(-150, "EUR"), false},
+		{"mismatch", New(1000, "PLN"), New(250, "EUR"), Amount{}, Amount{}, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			sum, err := tc.a.Add(tc.b)
+			if tc.mismatch {
+				if !errors.Is(err, ErrCurrencyMismatch) {
+					t.Errorf("Add error = %v, want ErrCurrencyMismatch", err)
+				}
+			} else if err != nil || sum != tc.wantAdd {
+				t.Errorf("Add = %+v, %v; want %+v", sum, err, tc.wantAdd)
+			}
+			diff, err := tc.a.Sub(tc.b)
+			if tc.mismatch {
+				if !errors.Is(err, ErrCurrencyMismatch) {
+					t.Errorf("Sub error = %v, want ErrCurrencyMismatch", err)
+				}
+			} else if err != nil || diff != tc.wantSub {
+				t.Errorf("Sub = %+v, %v; want %+v", diff, err, tc.wantSub)
+			}
+		})
+	}
+}
+
+// TestSum adds line totals and stops at the first amount in another currency.
+func TestSum(t *testing.T) {
+	total, err := Sum(New(500, "PLN").Mul(3), New(199, "PLN"), New(1, ""))
+	if err != nil || total != New(1700, "PLN") {
+		t.Errorf("Sum = %+v, %v; want 17.00 PLN", total, err)
+	}
+	if total, err = Sum(); err != nil || !total.IsZero() {
+		t.Errorf("empty Sum = %+v, %v; want zero", total, err)
+	}
+	if _, err = Sum(New(500, "PLN"), New(100, "EUR")); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("mixed Sum error = %v, want ErrCurrencyMismatch", err)
+	}
+}
+
+// TestFormat renders two decimal places with the configured separator and the currency.
+func TestFormat(t *testing.T) {
+	cases := []struct {
+		amount Amount
+		sep    string
+		want   string
+		str    string
+	}{
+		{New(1870, "pln"), "", "18.70", "18.70 PLN"},
+		{New(1870, "PLN"), ",", "18,70", "18.70 PLN"},
+		{New(5, "EUR"), ".", "0.05", "0.05 EUR"},
+		{New(-5, "EUR"), ".", "-0.05", "-0.05 EUR"},
+		{New(-123456, ""), ".", "-1234.56", "-1234.56"},
+		{New(0, "USD"), ".", "0.00", "0.00 USD"},
+		{New(100, "USD"), ".", "1.00", "1.00 USD"},
+	}
+	for _, tc := range cases {
+		if got := tc.amount.Format(tc.sep); got != tc.want {
+			t.Errorf("Format(%+v, %q) = %q, want %q", tc.amount, tc.sep, got, tc.want)
+		}
+		if got := tc.amount.String(); got != tc.str {
+			t.Errorf("String(%+v) = %q, want %q", tc.amount, got, tc.str)
+		}
+	}
+}
@@ -3,13 +3,134 @@ package validate
 import (
 	"errors"
 	"fmt"
+	"github.com/go-playground/locales/en"
+	"github.com/go-playground/locales/pl"
+	ut "github.com/go-playground/universal-translator"
 	"github.com/go-playground/validator/v10"
+	entranslations "github.com/go-playground/validator/v10/translations/en"
+	pltranslations "github.com/go-playground/validator/v10/translations/pl"
+	"net/http"
 	"reflect"
 	"strings"
+	"sync"
+	"sync/atomic"
 )
 
-// Struct validates a single struct object
+// Locales lists the languages validation messages are available in.
+var Locales = []string{"en", "pl"}
+
+var (
+	initOnce      sync.Once
+	shared        *validator.Validate
+	translators   *ut.UniversalTranslator
+	defaultLocale atomic.Value
+)
+
+func init() {
+	defaultLocale.Store("en")
+}
+
+// SetLocale selects the language of validation messages when a request names none.
+func SetLocale(locale string) error {
+	locale = strings.ToLower(strings.TrimSpace(locale))
+	for _, l := range Locales {
+		if l == locale {
+			defaultLocale.Store(locale)
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported locale %q, expected one of %s", locale, strings.Join(Locales, ", "))
+}
+
+// instance returns the shared validator, with the message translations of every locale
+// registered on it. The validator caches struct metadata, so it is built once.
+func instance() (*validator.Validate, *ut.UniversalTranslator) {
+	initOnce.Do(func() {
+		shared = validator.New()
+		shared.RegisterTagNameFunc(func(fld reflect.StructField) string {
+			name := strings.SplitN(fld.Tag.Get("json"), ",", 2)[0]
+			if name == "-" {
+				return ""
+			}
+			return name
+		})
+		translators = ut.New(en.New(), en.New(), pl.New())
+		enTrans, _ := translators.GetTranslator("en")
+		_ = entranslations.RegisterDefaultTranslations(shared, enTrans)
+		plTrans, _ := translators.GetTranslator("pl")
+		_ = pltranslations.RegisterDefaultTranslations(shared, plTrans)
+	})
+	return shared, translators
+}
+
+// acceptedLocale picks the first supported language of an Accept-Language header,
+// ignoring quality values and region subtags ("pl-PL;q=0.9" is "pl").
+func acceptedLocale(header string) string {
+	for _, part := range strings.Split(header, ",") {
+		tag, _, _ := strings.Cut(part, ";")
+		tag, _, _ = strings.Cut(strings.TrimSpace(tag), "-")
+		tag = strings.ToLower(tag)
+		for _, l := range Locales {
+			if l == tag {
+				return l
+			}
+		}
+	}
+	return ""
+}
+
+// FieldError is one failed validation rule. Field is the JSON path of the value, e.g.
+// "client_details.email" or "line_items[0].qty".
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Param   string `json:"param,omitempty"`
+	Message string `json:"message"`
+}
+
+// Errors is returned by Struct when fields fail validation. Error() keeps the
+// "field rule; field rule" form, so logs and status messages read as before.
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	message := ""
+	for _, fieldErr := range e {
+		if len(message) > 0 {
+			message += "; "
+		}
+		message += fmt.Sprintf("%s %s", fieldErr.Field[strings.LastIndex(fieldErr.Field, ".")+1:], fieldErr.Rule)
+	}
+	return message
+}
+
+// Fields returns the per-field failures carried by err, or nil when err is not a
+// validation error.
+func Fields(err error) Errors {
+	var fieldErrors Errors
+	if errors.As(err, &fieldErrors) {
+		return fieldErrors
+	}
+	return nil
+}
+
+// Struct validates a single struct object. Messages use the default locale.
 func Struct(s interface{}) error {
+	return structLocale(s, defaultLocale.Load().(string))
+}
+
+// Request validates a struct bound from r, with messages in the first language of the
+// Accept-Language header that is supported, or the default locale. r may be nil.
+func Request(r *http.Request, s interface{}) error {
+	locale := defaultLocale.Load().(string)
+	if r != nil {
+		if accepted := acceptedLocale(r.Header.Get("Accept-Language")); accepted != "" {
+			locale = accepted
+		}
+	}
+	return structLocale(s, locale)
+}
+
+func structLocale(s interface{}, locale string) error {
 	if s == nil {
 		return fmt.Errorf("is nil")
 	}
@@ -19,28 +140,24 @@ func Struct(s interface{}) error {
 	var validationErrors validator.ValidationErrors
 	var invalidValidationError *validator.InvalidValidationError
 
-	validate := validator.New()
-	validate.RegisterTagNameFunc(func(fld reflect.StructField) string {
-		name := strings.SplitN(fld.Tag.Get("json"), ",", 2)[0]
-		if name == "-" {
-			return ""
-		}
-		return name
-	})
+	validate, trans := instance()
 	err := validate.Struct(s)
 	if err == nil {
 		return nil
 	}
 
 	if errors.As(err, &validationErrors) {
-		message := ""
+		translator, _ := trans.GetTranslator(locale)
+		fieldErrors := make(Errors, 0, len(validationErrors))
 		for _, fieldErr := range validationErrors {
-			if len(message) > 0 {
-				message += "; "
-			}
-			message += fmt.Sprintf("%s %s", fieldErr.Field(), fieldErr.Tag())
+			fieldErrors = append(fieldErrors, FieldError{
+				Field:   fieldPath(fieldErr),
+				Rule:    fieldErr.Tag(),
+				Param:   fieldErr.Param(),
+				Message: message(fieldErr, translator),
+			})
 		}
-		return errors.New(message)
+		return fieldErrors
 	} else if errors.As(err, &invalidValidationError) {
 		return fmt.Errorf("invalid validation error: %w", err)
 	} else {
@@ -48,6 +165,30 @@ func Struct(s interface{}) error {
 	}
 }
 
+// fieldPath drops the root struct name from the namespace, leaving the JSON path.
+func fieldPath(fieldErr validator.FieldError) string {
+	_, path, found := strings.Cut(fieldErr.Namespace(), ".")
+	if !found {
+		return fieldErr.Field()
+	}
+	return path
+}
+
+// message describes a failed rule in the translator's language. Rules without a
+// translation get a generic English description.
+func message(fieldErr validator.FieldError, translator ut.Translator) string {
+	if translator != nil {
+		// Translate falls back to the raw validator error when the rule has no translation.
+		if translated := fieldErr.Translate(translator); translated != fieldErr.Error() {
+			return translated
+		}
+	}
+	if fieldErr.Param() != "" {
+		return fmt.Sprintf("%s failed the %s=%s rule", fieldErr.Field(), fieldErr.Tag(), fieldErr.Param())
+	}
+	return fmt.Sprintf("%s failed the %s rule", fieldErr.Field(), fieldErr.Tag())
+}
+
 func isStruct(s interface{}) bool {
 	r := reflect.TypeOf(s)
 	if r.Kind() == reflect.Ptr {
@@ -0,0 +1,59 @@
+package validate
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+type order struct {
+	Email    string `json:"email" validate:"required,email"`
+	Currency string `json:"currency" validate:"required,oneof=PLN EUR"`
+}
+
+// TestRequestLocale compares the English and Polish messages of the same violations, with
+// the language taken from Accept-Language and the default locale as the fallback.
+func TestRequestLocale(t *testing.T) {
+	cases := []struct {
+		name           string
+		acceptLanguage string
+		wantEmail      string
+		wantCurrency   string
+	}{
+		{"english", "en-US,en;q=0.9", "email must be a valid email address", "currency must be one of [PLN EUR]"},
+		{"polish", "pl-PL,pl;q=0.9,en;q=0.8", "email musi być poprawnym adresem email", "currency musi być jednym z [PLN EUR]"},
+		{"unsupported falls back to default", "de-DE", "email must be a valid email address", "currency must be one of [PLN EUR]"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/v1/st/pay", nil)
+			r.Header.Set("Accept-Language", tc.acceptLanguage)
+
+			fields := Fields(Request(r, &order{Email: "nope", Currency: "GBP"}))
+			if len(fields) != 2 {
+				t.Fatalf("field errors = %v, want 2", fields)
+			}
+			if fields[0].Message != tc.wantEmail {
+				t.Errorf("email message = %q, want %q", fields[0].Message, tc.wantEmail)
+			}
+			if fields[1].Message != tc.wantCurrency {
+				t.Errorf("currency message = %q, want %q", fields[1].Message, tc.wantCurrency)
+			}
+		})
+	}
+}
+
+// TestSetLocale checks that the configured locale applies to requests without a
+// preference and that an unknown locale is refused.
+func TestSetLocale(t *testing.T) {
+	t.Cleanup(func() { _ = SetLocale("en") })
+	if err := SetLocale("xx"); err == nil {
+		t.Error("expected an error for an unsupported locale")
+	}
+	if err := SetLocale("PL"); err != nil {
+		t.Fatalf("SetLocale: %v", err)
+	}
+	fields := Fields(Struct(&order{Currency: "PLN"}))
+	if len(fields) != 1 || fields[0].Message != "email jest wymaganym polem" {
+		t.Errorf("field errors = %v, want the Polish required message", fields)
+	}
+}
@@ -1,17 +1,20 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
 	"log/slog"
 	"math"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 	"wfsync/entity"
 	"wfsync/internal/config"
+	"wfsync/lib/money"
 	"wfsync/lib/sl"
 
 	_ "github.com/go-sql-driver/mysql" // MySQL driver
@@ -25,6 +28,9 @@ const (
 	//totalCodeTotal    = "total"
 )
 
+// ErrUnknownOrderStatus is returned when no order status has the name looked up.
+var ErrUnknownOrderStatus = errors.New("unknown order status")
+
 type MySql struct {
 	db         *sql.DB
 	loc        *time.Location
@@ -33,6 +39,7 @@ type MySql struct {
 	structure  map[string]map[string]Column
 	statements map[string]*sql.Stmt
 	nipId      string
+	baseCurr   string
 	mu         sync.Mutex
 }
 
@@ -69,6 +76,7 @@ func NewSQLClient(conf *config.Config, log *slog.Logger) (*MySql, error) {
 		structure:  make(map[string]map[string]Column),
 		statements: make(map[string]*sql.Stmt),
 		nipId:      conf.OpenCart.CustomFieldNIP,
+		baseCurr:   conf.OpenCart.BaseCurrency,
 	}
 
 	if err = sdb.addColumnIfNotExists("order", "wf_proforma", "VARCHAR(64) NOT NULL DEFAULT ''"); err != nil {
@@ -105,17 +113,22 @@ func NewSQLClient(conf *config.Config, log *slog.Logger) (*MySql, error) {
 	return sdb, nil
 }
 
+// Ping checks that the database answers.
+func (s *MySql) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
 func (s *MySql) Close() {
 	s.closeStmt()
 	_ = s.db.Close()
 }
 
-func (s *MySql) OrderProducts(orderId int64, currencyValue float64, ignoreTax bool) ([]*entity.LineItem, error) {
+func (s *MySql) OrderProducts(ctx context.Context, orderId int64, currencyValue float64, ignoreTax bool) ([]*entity.LineItem, error) {
 	stmt, err := s.stmtSelectOrderProducts()
 	if err != nil {
 		return nil, err
 	}
-	rows, err := stmt.Query(orderId)
+	rows, err := stmt.QueryContext(ctx, orderId)
 	if err != nil {
 		return nil, err
 	}
@@ -149,7 +162,7 @@ func (s *MySql) OrderProducts(orderId int64, currencyValue float64, ignoreTax bo
 				// 'tax' contains row total VAT
 				priceVAT = price + tax/float64(product.Qty)
 			}
-			product.Price = int64(math.Round(priceVAT * currencyValue * 100))
+			product.Price = money.Cents(priceVAT * currencyValue)
 			products = append(products, &product)
 		}
 	}
@@ -161,41 +174,52 @@ func (s *MySql) OrderProducts(orderId int64, currencyValue float64, ignoreTax bo
 	return products, nil
 }
 
-func (s *MySql) OrderTotal(orderId int64, code string, currencyValue float64) (string, int64, error) {
+// OrderTotal returns the order_total rows of one code. Some extensions write several rows
+// per code (e.g. two stacked discounts or split shipping), so values are summed and the
+// distinct titles joined.
+func (s *MySql) OrderTotal(ctx context.Context, orderId int64, code string, currencyValue float64) (string, int64, error) {
 	stmt, err := s.stmtSelectOrderTotals()
 	if err != nil {
 		return "", 0, err
 	}
-	rows, err := stmt.Query(orderId, code)
+	rows, err := stmt.QueryContext(ctx, orderId, code)
 	if err != nil {
 		return "", 0, err
 	}
 	defer rows.Close()
 
-	var title string
-	var value float64
+	var titles []string
+	var sum float64
 	for rows.Next() {
+		var title string
+		var value float64
 		if err = rows.Scan(
 			&title,
 			&value,
 		); err != nil {
 			return "", 0, err
 		}
+		sum += value
+		if title != "" && !slices.Contains(titles, title) {
+			titles = append(titles, title)
+		}
 	}
 
 	if err = rows.Err(); err != nil {
 		return "", 0, err
 	}
 
-	return title, int64(math.Round(value * currencyValue * 100)), nil
+	return strings.Join(titles, ", "), money.Cents(sum * currencyValue), nil
 }
 
-func (s *MySql) OrderSearchStatus(statusId int) ([]*entity.CheckoutParams, error) {
+// OrderSearchStatus returns the orders in a status with their line items and totals.
+// Cancelling ctx aborts the search, e.g. when the order processor is stopped.
+func (s *MySql) OrderSearchStatus(ctx context.Context, statusId int) ([]*entity.CheckoutParams, error) {
 	stmt, err := s.stmtSelectOrderStatus()
 	if err != nil {
 		return nil, err
 	}
-	rows, err := stmt.Query(statusId)
+	rows, err := stmt.QueryContext(ctx, statusId)
 	if err != nil {
 		return nil, fmt.Errorf("query: %w", err)
 	}
@@ -230,17 +254,23 @@ func (s *MySql) OrderSearchStatus(statusId int) ([]*entity.CheckoutParams, error
 			&order.ProformaFile,
 			&total,
 			&order.CustomerGroup,
+			&order.PaymentMethod,
 		); err != nil {
 			return nil, err
 		}
 
+		// a bad rate would silently zero every amount; skip the order so it is not invoiced
+		if !s.fixCurrencyValue(&order) {
+			continue
+		}
+
 		// client data
 		taxErr := client.ParseTaxId(s.nipId, customField)
 		s.logTaxId(order.OrderId, customField, client.TaxId, taxErr)
 		client.Name = firstName + " " + lastName
 		order.ClientDetails = &client
 		// order summary
-		order.Total = int64(math.Round(total * order.CurrencyValue * 100))
+		order.Total = money.Cents(total * order.CurrencyValue)
 		order.Source = entity.SourceOpenCart
 		order.Created = time.Now().In(s.loc)
 
@@ -257,7 +287,7 @@ func (s *MySql) OrderSearchStatus(statusId int) ([]*entity.CheckoutParams, error
 		if err != nil {
 			return nil, fmt.Errorf("invalid order id: %s", order.OrderId)
 		}
-		_, err = s.addOrderData(id, order)
+		_, err = s.addOrderData(ctx, id, order)
 		if err != nil {
 			return nil, fmt.Errorf("add order data: %w", err)
 		}
@@ -266,12 +296,12 @@ func (s *MySql) OrderSearchStatus(statusId int) ([]*entity.CheckoutParams, error
 	return orders, nil
 }
 
-func (s *MySql) OrderSearchId(orderId int64) (*entity.CheckoutParams, error) {
+func (s *MySql) OrderSearchId(ctx context.Context, orderId int64) (*entity.CheckoutParams, error) {
 	stmt, err := s.stmtSelectOrderId()
 	if err != nil {
 		return nil, err
 	}
-	rows, err := stmt.Query(orderId)
+	rows, err := stmt.QueryContext(ctx, orderId)
 	if err != nil {
 		return nil, fmt.Errorf("query: %w", err)
 	}
@@ -305,17 +335,22 @@ func (s *MySql) OrderSearchId(orderId int64) (*entity.CheckoutParams, error) {
 			&order.ProformaFile,
 			&total,
 			&order.CustomerGroup,
+			&order.PaymentMethod,
 		); err != nil {
 			return nil, err
 		}
 
+		if !s.fixCurrencyValue(&order) {
+			return nil, fmt.Errorf("order %s: invalid currency_value %v for %s", order.OrderId, order.CurrencyValue, order.Currency)
+		}
+
 		// client data
 		taxErr := client.ParseTaxId(s.nipId, customField)
 		s.logTaxId(order.OrderId, customField, client.TaxId, taxErr)
 		client.Name = firstName + " " + lastName
 		order.ClientDetails = &client
 		// order summary
-		order.Total = int64(math.Round(total * order.CurrencyValue * 100))
+		order.Total = money.Cents(total * order.CurrencyValue)
 		order.Source = entity.SourceOpenCart
 		//order.Created = time.Now().In(s.loc)
 	}
@@ -324,7 +359,68 @@ func (s *MySql) OrderSearchId(orderId int64) (*entity.CheckoutParams, error) {
 		return nil, err
 	}
 
-	return s.addOrderData(orderId, &order)
+	return s.addOrderData(ctx, orderId, &order)
+}
+
+// validCurrencyValue returns the conversion rate to use for an order. A positive, finite
+// rate is returned as is. A zero, negative or non-finite rate is only recoverable for the
+// store base currency (whose rate is 1 by definition) and for an empty currency code,
+// which OpenCart treats as the base; ok is false for any other currency, since guessing
+// a rate there would invoice the wrong amounts.
+func validCurrencyValue(currency string, value float64, base string) (rate float64, ok bool) {
+	if value > 0 && !math.IsInf(value, 0) && !math.IsNaN(value) {
+		return value, true
+	}
+	if currency == "" || strings.EqualFold(currency, base) {
+		return 1.0, true
+	}
+	return 0, false
+}
+
+// fixCurrencyCode replaces an empty or unsupported currency_code with the base currency.
+// OpenCart stores totals in the base currency and currency_value only converts them for
+// display, so switching to the base currency at rate 1.0 keeps the amounts correct.
+func (s *MySql) fixCurrencyCode(order *entity.CheckoutParams) {
+	code := strings.ToUpper(strings.TrimSpace(order.Currency))
+	if entity.SupportedCurrency(code) {
+		order.Currency = code
+		return
+	}
+	if s.log != nil {
+		s.log.Warn("unsupported currency_code, using base currency",
+			slog.String("order_id", order.OrderId),
+			slog.String("currency", order.Currency),
+			slog.String("base_currency", s.baseCurr))
+	}
+	order.Currency = s.baseCurr
+	order.CurrencyValue = 1.0
+}
+
+// fixCurrencyValue applies validCurrencyValue to a scanned order, logging every
+// correction or rejection. Returns false when the order must not be processed.
+func (s *MySql) fixCurrencyValue(order *entity.CheckoutParams) bool {
+	s.fixCurrencyCode(order)
+	rate, ok := validCurrencyValue(order.Currency, order.CurrencyValue, s.baseCurr)
+	// ok first: a rejected rate of 0 equals the 0 returned with it.
+	if ok && rate == order.CurrencyValue {
+		return true
+	}
+	if s.log != nil {
+		log := s.log.With(
+			slog.String("order_id", order.OrderId),
+			slog.String("currency", order.Currency),
+			slog.Float64("currency_value", order.CurrencyValue),
+		)
+		if ok {
+			log.Warn("invalid currency_value, using 1.0 for base currency")
+		} else {
+			log.Error("invalid currency_value, order skipped")
+		}
+	}
+	if ok {
+		order.CurrencyValue = rate
+	}
+	return ok
 }
 
 // logTaxId records the outcome of NIP extraction from an order's custom_field.
@@ -417,6 +513,59 @@ func (s *MySql) OrderIdByZohoId(zohoId string) (int64, error) {
 	return id, nil
 }
 
+// OrderStatusIdByName resolves an order status name, as shown in the store admin in any
+// of its languages, to the status id. Fails with ErrUnknownOrderStatus when no status
+// has the name, and with an error listing the ids when several statuses share it.
+func (s *MySql) OrderStatusIdByName(ctx context.Context, name string) (int, error) {
+	stmt, err := s.stmtSelectOrderStatusIdByName()
+	if err != nil {
+		return 0, err
+	}
+	rows, err := stmt.QueryContext(ctx, name)
+	if err != nil {
+		return 0, fmt.Errorf("query: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err = rows.Scan(&id); err != nil {
+			return 0, fmt.Errorf("scan: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err = rows.Err(); err != nil {
+		return 0, fmt.Errorf("rows: %w", err)
+	}
+	switch len(ids) {
+	case 0:
+		return 0, fmt.Errorf("%w: %q", ErrUnknownOrderStatus, name)
+	case 1:
+		return ids[0], nil
+	default:
+		return 0, fmt.Errorf("order status %q is ambiguous, ids %v", name, ids)
+	}
+}
+
+// OrderStatusId returns the current status of an order. Returns 0 (no error) when the
+// order does not exist.
+func (s *MySql) OrderStatusId(ctx context.Context, orderId int64) (int, error) {
+	stmt, err := s.stmtSelectOrderStatusId()
+	if err != nil {
+		return 0, err
+	}
+	var statusId int
+	err = stmt.QueryRowContext(ctx, orderId).Scan(&statusId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("query: %w", err)
+	}
+	return statusId, nil
+}
+
 // OrderSearchByDateRange returns lightweight order summaries for orders within a date range.
 // Unlike OrderSearchStatus/OrderSearchId, this skips line items and tax details.
 func (s *MySql) OrderSearchByDateRange(from, to string) ([]*entity.OrderSummary, error) {
@@ -453,7 +602,21 @@ func (s *MySql) OrderSearchByDateRange(from, to string) ([]*entity.OrderSummary,
 		}
 
 		o.ClientName = firstName + " " + lastName
-		o.Total = int64(math.Round(total * o.CurrencyValue * 100))
+		rate, ok := validCurrencyValue(o.Currency, o.CurrencyValue, s.baseCurr)
+		if !ok {
+			// OpenCart stores totals in the base currency: without a usable rate the
+			// summary reports the unconverted total in that currency.
+			if s.log != nil {
+				s.log.Error("invalid currency_value, total left in base currency",
+					slog.String("order_id", o.OrderId),
+					slog.String("currency", o.Currency),
+					slog.Float64("currency_value", o.CurrencyValue),
+					slog.String("base_currency", s.baseCurr))
+			}
+			o.Currency, rate = s.baseCurr, 1.0
+		}
+		o.CurrencyValue = rate
+		o.Total = money.Cents(total * o.CurrencyValue)
 		orders = append(orders, &o)
 	}
 
@@ -464,24 +627,24 @@ func (s *MySql) OrderSearchByDateRange(from, to string) ([]*entity.OrderSummary,
 }
 
 // addOrderData retrieves and calculates tax, line items, and shipping costs for a specific order and updates its details.
-func (s *MySql) addOrderData(orderId int64, order *entity.CheckoutParams) (*entity.CheckoutParams, error) {
+func (s *MySql) addOrderData(ctx context.Context, orderId int64, order *entity.CheckoutParams) (*entity.CheckoutParams, error) {
 	var err error
 	// before adding line items and shipping costs to each order, get order tax and sub-total
-	order.TaxTitle, order.TaxValue, err = s.OrderTotal(orderId, totalCodeTax, order.CurrencyValue)
+	order.TaxTitle, order.TaxValue, err = s.OrderTotal(ctx, orderId, totalCodeTax, order.CurrencyValue)
 	if err != nil {
 		return nil, fmt.Errorf("get order tax: %w", err)
 	}
-	_, order.SubTotal, err = s.OrderTotal(orderId, totalCodeSubTotal, order.CurrencyValue)
+	_, order.SubTotal, err = s.OrderTotal(ctx, orderId, totalCodeSubTotal, order.CurrencyValue)
 	if err != nil {
 		return nil, fmt.Errorf("get order sub_total: %w", err)
 	}
 
 	// add line items and shipping costs to each order
-	order.LineItems, err = s.OrderProducts(orderId, order.CurrencyValue, order.TaxValue == 0)
+	order.LineItems, err = s.OrderProducts(ctx, orderId, order.CurrencyValue, order.TaxValue == 0)
 	if err != nil {
 		return nil, fmt.Errorf("get order products: %w", err)
 	}
-	title, value, err := s.OrderTotal(orderId, totalCodeShipping, order.CurrencyValue)
+	title, value, err := s.OrderTotal(ctx, orderId, totalCodeShipping, order.CurrencyValue)
 	if err != nil {
 		return nil, fmt.Errorf("get order shipping: %w", err)
 	}
@@ -493,7 +656,7 @@ func (s *MySql) addOrderData(orderId int64, order *entity.CheckoutParams) (*enti
 	return order, nil
 }
 
-func (s *MySql) ChangeOrderStatus(orderId int64, orderStatusId int, comment string) error {
+func (s *MySql) ChangeOrderStatus(ctx context.Context, orderId int64, orderStatusId int, comment string) error {
 	stmt, err := s.stmtUpdateOrderStatus()
 	if err != nil {
 		return err
@@ -508,54 +671,112 @@ func (s *MySql) ChangeOrderStatus(orderId int64, orderStatusId int, comment stri
 		"comment":         comment,
 		"date_added":      dateModified,
 	}
-	_, err = s.insert("order_history", rec)
+	_, err = s.insert(ctx, "order_history", rec)
 	if err != nil {
 		return fmt.Errorf("insert order history: %w", err)
 	}
 
-	_, err = stmt.Exec(dateModified, orderStatusId, orderId)
+	_, err = stmt.ExecContext(ctx, dateModified, orderStatusId, orderId)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (s *MySql) ClearStatusHistory(orderId int64, orderStatusId int) error {
+func (s *MySql) ClearStatusHistory(ctx context.Context, orderId int64, orderStatusId int) error {
 	stmt, err := s.stmtDeleteStatusHistory()
 	if err != nil {
 		return err
 	}
-	_, err = stmt.Exec(orderId, orderStatusId)
+	_, err = stmt.ExecContext(ctx, orderId, orderStatusId)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (s *MySql) UpdateProforma(orderId int64, proformaId, proformaFile string) error {
+func (s *MySql) UpdateProforma(ctx context.Context, orderId int64, proformaId, proformaFile string) error {
 	stmt, err := s.stmtUpdateOrderProforma()
 	if err != nil {
 		return err
 	}
-	_, err = stmt.Exec(proformaId, proformaFile, orderId)
+	_, err = stmt.ExecContext(ctx, proformaId, proformaFile, orderId)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (s *MySql) UpdateInvoice(orderId int64, invoiceId, invoiceFile string) error {
+func (s *MySql) UpdateInvoice(ctx context.Context, orderId int64, invoiceId, invoiceFile string) error {
 	stmt, err := s.stmtUpdateOrderInvoice()
 	if err != nil {
 		return err
 	}
-	_, err = stmt.Exec(invoiceId, invoiceFile, orderId)
+	_, err = stmt.ExecContext(ctx, invoiceId, invoiceFile, orderId)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+// OrdersWithoutDocument returns the ids of orders in a status, modified since the given
+// time, whose wf_proforma (proforma true) or wf_invoice column is empty. Ids come in
+// pages of up to 20 in ascending order; pass the last id of a page as afterId to get the
+// next one, and 0 for the first. An empty page ends the list.
+func (s *MySql) OrdersWithoutDocument(ctx context.Context, statusId int, proforma bool, since time.Time, afterId int64) ([]int64, error) {
+	column := "wf_invoice"
+	if proforma {
+		column = "wf_proforma"
+	}
+	stmt, err := s.stmtSelectOrdersWithoutDocument(column)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := stmt.QueryContext(ctx, statusId, since.In(s.loc), afterId)
+	if err != nil {
+		return nil, fmt.Errorf("query: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err = rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// ReferencedFiles returns the invoice and proforma file names stored on OpenCart orders.
+func (s *MySql) ReferencedFiles() (map[string]bool, error) {
+	stmt, err := s.stmtSelectOrderFiles()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := stmt.Query()
+	if err != nil {
+		return nil, fmt.Errorf("query: %w", err)
+	}
+	defer rows.Close()
+
+	refs := make(map[string]bool)
+	for rows.Next() {
+		var invoiceFile, proformaFile sql.NullString
+		if err = rows.Scan(&invoiceFile, &proformaFile); err != nil {
+			return nil, err
+		}
+		if invoiceFile.String != "" {
+			refs[invoiceFile.String] = true
+		}
+		if proformaFile.String != "" {
+			refs[proformaFile.String] = true
+		}
+	}
+	return refs, rows.Err()
+}
+
 func (s *MySql) UpdatePayment(orderId int64, paymentId, sessionId, status string, amount int64) error {
 	stmt, err := s.stmtUpdateOrderPayment()
 	if err != nil {
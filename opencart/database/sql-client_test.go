@@ -0,0 +1,374 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"log/slog"
+	"math"
+	"sync"
+	"testing"
+	"time"
+	"wfsync/entity"
+)
+
+// TestValidCurrencyValue covers the rate sanity check: a zero or negative rate must never
+// reach the amount conversion, and may only fall back to 1.0 for the base currency.
+func TestValidCurrencyValue(t *testing.T) {
+	cases := []struct {
+		name     string
+		currency string
+		value    float64
+		wantRate float64
+		wantOk   bool
+	}{
+		{"positive rate kept", "EUR", 0.2345, 0.2345, true},
+		{"base currency rate kept", "PLN", 1, 1, true},
+		{"zero for base currency", "PLN", 0, 1, true},
+		{"zero for base currency, lower case", "pln", 0, 1, true},
+		{"negative for base currency", "PLN", -1, 1, true},
+		{"zero with empty currency", "", 0, 1, true},
+		{"zero for foreign currency", "EUR", 0, 0, false},
+		{"negative for foreign currency", "EUR", -0.23, 0, false},
+		{"NaN for foreign currency", "USD", math.NaN(), 0, false},
+		{"infinite for base currency", "PLN", math.Inf(1), 1, true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rate, ok := validCurrencyValue(tc.currency, tc.value, "PLN")
+			if ok != tc.wantOk || rate != tc.wantRate {
+				t.Errorf("validCurrencyValue(%q, %v) = (%v, %v), want (%v, %v)",
+					tc.currency, tc.value, rate, ok, tc.wantRate, tc.wantOk)
+			}
+		})
+	}
+}
+
+// TestFixCurrencyValueKeepsRejectedRate ensures a rejected order keeps its original rate
+// so the error reported for it shows the offending value.
+func TestFixCurrencyValueKeepsRejectedRate(t *testing.T) {
+	s := &MySql{log: slog.New(slog.NewTextHandler(io.Discard, nil)), baseCurr: "PLN"}
+
+	rejected := &entity.CheckoutParams{OrderId: "1", Currency: "EUR", CurrencyValue: -2}
+	if s.fixCurrencyValue(rejected) {
+		t.Fatal("negative EUR rate must be rejected")
+	}
+	if rejected.CurrencyValue != -2 {
+		t.Errorf("CurrencyValue = %v, want original -2", rejected.CurrencyValue)
+	}
+
+	zero := &entity.CheckoutParams{OrderId: "2", Currency: "EUR", CurrencyValue: 0}
+	if s.fixCurrencyValue(zero) {
+		t.Error("zero EUR rate must be rejected")
+	}
+
+	fixed := &entity.CheckoutParams{OrderId: "3", Currency: "PLN", CurrencyValue: 0}
+	if !s.fixCurrencyValue(fixed) || fixed.CurrencyValue != 1 {
+		t.Errorf("PLN zero rate = %v, want fallback 1.0", fixed.CurrencyValue)
+	}
+}
+
+// fakeQuery answers a statement run through the fake driver with its columns and rows.
+type fakeQuery func(ctx context.Context, query string, args []driver.NamedValue) ([]string, [][]driver.Value, error)
+
+// fakeQueries maps a DSN to the handler of the test that opened it.
+var fakeQueries sync.Map
+
+func init() {
+	sql.Register("fakeoc", fakeDriver{})
+}
+
+// newFakeMySql returns a client whose statements are answered by handler instead of MySQL.
+func newFakeMySql(t *testing.T, handler fakeQuery) *MySql {
+	t.Helper()
+	fakeQueries.Store(t.Name(), handler)
+	t.Cleanup(func() { fakeQueries.Delete(t.Name()) })
+	db, err := sql.Open("fakeoc", t.Name())
+	if err != nil {
+		t.Fatalf("open fake db: %v", err)
+	}
+	s := &MySql{
+		db:         db,
+		loc:        time.UTC,
+		log:        slog.New(slog.NewTextHandler(io.Discard, nil)),
+		statements: make(map[string]*sql.Stmt),
+		baseCurr:   "PLN",
+	}
+	t.Cleanup(s.Close)
+	return s
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(dsn string) (driver.Conn, error) {
+	handler, ok := fakeQueries.Load(dsn)
+	if !ok {
+		return nil, errors.New("no fake handler for " + dsn)
+	}
+	return &fakeConn{handler: handler.(fakeQuery)}, nil
+}
+
+type fakeConn struct {
+	handler fakeQuery
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{conn: c, query: query}, nil
+}
+
+func (c *fakeConn) Close() error { return nil }
+
+func (c *fakeConn) Begin() (driver.Tx, error) { return nil, errors.New("not supported") }
+
+type fakeStmt struct {
+	conn  *fakeConn
+	query string
+}
+
+func (s *fakeStmt) Close() error { return nil }
+
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec([]driver.Value) (driver.Result, error) {
+	return nil, errors.New("use ExecContext")
+}
+
+func (s *fakeStmt) Query([]driver.Value) (driver.Rows, error) {
+	return nil, errors.New("use QueryContext")
+}
+
+func (s *fakeStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	if _, _, err := s.conn.handler(ctx, s.query, args); err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (s *fakeStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	columns, rows, err := s.conn.handler(ctx, s.query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &fakeRows{columns: columns, rows: rows}, nil
+}
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+
+func (r *fakeRows) Close() error { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+// TestOrderSearchStatusCanceled checks that cancelling the context aborts a query that
+// is still waiting on the database, so Stop does not hang behind a slow search.
+func TestOrderSearchStatusCanceled(t *testing.T) {
+	started := make(chan struct{})
+	s := newFakeMySql(t, func(ctx context.Context, _ string, _ []driver.NamedValue) ([]string, [][]driver.Value, error) {
+		close(started)
+		<-ctx.Done()
+		return nil, nil, ctx.Err()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error, 1)
+	go func() {
+		_, err := s.OrderSearchStatus(ctx, 2)
+		result <- err
+	}()
+	<-started
+	cancel()
+
+	select {
+	case err := <-result:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("OrderSearchStatus() error = %v, want context.Canceled", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("OrderSearchStatus did not return after cancel")
+	}
+}
+
+// orderTotalRows is an order_total table for one order, answered by code the way the
+// selectOrderTotals statement filters it.
+func orderTotalRows(rows map[string][][]driver.Value) fakeQuery {
+	return func(_ context.Context, _ string, args []driver.NamedValue) ([]string, [][]driver.Value, error) {
+		code, _ := args[1].Value.(string)
+		return []string{"title", "value"}, rows[code], nil
+	}
+}
+
+// TestOrderTotalByCode checks that totals are selected by the bound code: shipping and
+// coupon rows of the same order come back separately, and a missing code yields zero.
+func TestOrderTotalByCode(t *testing.T) {
+	s := newFakeMySql(t, orderTotalRows(map[string][][]driver.Value{
+		"shipping": {{"Kurier DPD", 15.0}},
+		"coupon":   {{"Kupon (SPRING)", -20.0}},
+	}))
+
+	cases := []struct {
+		code      string
+		wantTitle string
+		wantValue int64
+	}{
+		{"shipping", "Kurier DPD", 1500},
+		{"coupon", "Kupon (SPRING)", -2000},
+		{"tax", "", 0},
+	}
+	for _, tc := range cases {
+		t.Run(tc.code, func(t *testing.T) {
+			title, value, err := s.OrderTotal(context.Background(), 1, tc.code, 1)
+			if err != nil {
+				t.Fatalf("OrderTotal: %v", err)
+			}
+			if title != tc.wantTitle || value != tc.wantValue {
+				t.Errorf("OrderTotal(%q) = (%q, %d), want (%q, %d)", tc.code, title, value, tc.wantTitle, tc.wantValue)
+			}
+		})
+	}
+}
+
+// TestOrderTotalSumsRows checks an order with two discount rows (a coupon stacked with a
+// loyalty discount): both count, rather than the last row overwriting the first.
+func TestOrderTotalSumsRows(t *testing.T) {
+	s := newFakeMySql(t, orderTotalRows(map[string][][]driver.Value{
+		"coupon":   {{"Kupon (SPRING)", -20.0}, {"Rabat stałego klienta", -5.5}},
+		"shipping": {{"Kurier", 10.0}, {"Kurier", 2.5}},
+	}))
+
+	cases := []struct {
+		code      string
+		wantTitle string
+		wantValue int64
+	}{
+		{"coupon", "Kupon (SPRING), Rabat stałego klienta", -2550},
+		{"shipping", "Kurier", 1250},
+	}
+	for _, tc := range cases {
+		t.Run(tc.code, func(t *testing.T) {
+			title, value, err := s.OrderTotal(context.Background(), 1, tc.code, 1)
+			if err != nil {
+				t.Fatalf("OrderTotal: %v", err)
+			}
+			if title != tc.wantTitle || value != tc.wantValue {
+				t.Errorf("OrderTotal(%q) = (%q, %d), want (%q, %d)", tc.code, title, value, tc.wantTitle, tc.wantValue)
+			}
+		})
+	}
+}
+
+// TestFixCurrencyCode checks that an empty or unsupported currency_code falls back to the
+// base currency at rate 1.0, while a supported code is only normalized.
+func TestFixCurrencyCode(t *testing.T) {
+	s := &MySql{log: slog.New(slog.NewTextHandler(io.Discard, nil)), baseCurr: "PLN"}
+
+	cases := []struct {
+		name     string
+		currency string
+		value    float64
+		wantCode string
+		wantRate float64
+	}{
+		{"empty code", "", 1, "PLN", 1},
+		{"unsupported code", "GBP", 0.19, "PLN", 1},
+		{"supported code kept", "EUR", 0.23, "EUR", 0.23},
+		{"lower case normalized", " eur", 0.23, "EUR", 0.23},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			order := &entity.CheckoutParams{OrderId: "1", Currency: tc.currency, CurrencyValue: tc.value}
+			if !s.fixCurrencyValue(order) {
+				t.Fatal("order rejected")
+			}
+			if order.Currency != tc.wantCode || order.CurrencyValue != tc.wantRate {
+				t.Errorf("currency = (%q, %v), want (%q, %v)", order.Currency, order.CurrencyValue, tc.wantCode, tc.wantRate)
+			}
+		})
+	}
+}
+
+// TestOrderSearchByDateRangeInvalidRate lists a converted EUR order and one whose EUR
+// rate is unusable: the latter keeps its unconverted total, reported in the base currency.
+func TestOrderSearchByDateRangeInvalidRate(t *testing.T) {
+	added := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+	s := newFakeMySql(t, func(context.Context, string, []driver.NamedValue) ([]string, [][]driver.Value, error) {
+		return []string{"order_id", "date_added", "firstname", "lastname", "email", "currency_code",
+				"currency_value", "total", "invoice_id", "customer_group_id", "order_status_id"},
+			[][]driver.Value{
+				{"1", added, "Jan", "Nowak", "jan@example.com", "EUR", 0.25, 100.0, "", int64(1), int64(2)},
+				{"2", added, "Anna", "Kowalska", "anna@example.com", "EUR", 0.0, 100.0, "", int64(1), int64(2)},
+			}, nil
+	})
+
+	orders, err := s.OrderSearchByDateRange("2026-03-01", "2026-03-31")
+	if err != nil {
+		t.Fatalf("OrderSearchByDateRange: %v", err)
+	}
+	if len(orders) != 2 {
+		t.Fatalf("orders = %d, want 2", len(orders))
+	}
+	if o := orders[0]; o.Currency != "EUR" || o.Total != 2500 {
+		t.Errorf("order 1 = %s %d, want EUR 2500", o.Currency, o.Total)
+	}
+	if o := orders[1]; o.Currency != "PLN" || o.CurrencyValue != 1 || o.Total != 10000 {
+		t.Errorf("order 2 = %s %d at %v, want PLN 10000 at 1", o.Currency, o.Total, o.CurrencyValue)
+	}
+}
+
+// orderStatusRows is an order_status table in two languages, answered by name the way
+// the stmtSelectOrderStatusIdByName statement filters it.
+func orderStatusRows(_ context.Context, _ string, args []driver.NamedValue) ([]string, [][]driver.Value, error) {
+	ids := map[string][]driver.Value{
+		"Processing":    {int64(2)},
+		"W realizacji":  {int64(2)},
+		"Invoice ready": {int64(17)},
+		"Shipped":       {int64(3), int64(18)},
+	}[args[0].Value.(string)]
+	rows := make([][]driver.Value, 0, len(ids))
+	for _, id := range ids {
+		rows = append(rows, []driver.Value{id})
+	}
+	return []string{"order_status_id"}, rows, nil
+}
+
+// TestOrderStatusIdByName resolves status names in either store language, and fails on
+// a name no status has or several statuses share.
+func TestOrderStatusIdByName(t *testing.T) {
+	s := newFakeMySql(t, orderStatusRows)
+	cases := []struct {
+		name        string
+		want        int
+		wantUnknown bool
+		wantErr     bool
+	}{
+		{"Processing", 2, false, false},
+		{"W realizacji", 2, false, false},
+		{"Invoice ready", 17, false, false},
+		{"Invoiced", 0, true, true},
+		{"Shipped", 0, false, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			id, err := s.OrderStatusIdByName(context.Background(), tc.name)
+			if (err != nil) != tc.wantErr || errors.Is(err, ErrUnknownOrderStatus) != tc.wantUnknown {
+				t.Fatalf("OrderStatusIdByName(%q) error = %v, want error %v, unknown %v", tc.name, err, tc.wantErr, tc.wantUnknown)
+			}
+			if id != tc.want {
+				t.Errorf("OrderStatusIdByName(%q) = %d, want %d", tc.name, id, tc.want)
+			}
+		})
+	}
+}
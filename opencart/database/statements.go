@@ -76,6 +76,30 @@ func (s *MySql) stmtUpdateOrderInvoice() (*sql.Stmt, error) {
 	return s.prepareStmt("updateOrderInvoice", query)
 }
 
+// stmtSelectOrderFiles lists the document files stored on orders, for the file janitor.
+func (s *MySql) stmtSelectOrderFiles() (*sql.Stmt, error) {
+	query := fmt.Sprintf(
+		`SELECT wf_file_invoice, wf_file_proforma FROM %sorder
+		 WHERE wf_file_invoice <> '' OR wf_file_proforma <> ''`,
+		s.prefix,
+	)
+	return s.prepareStmt("selectOrderFiles", query)
+}
+
+// stmtSelectOrdersWithoutDocument lists one page of orders in a status modified since a
+// given time whose document column (wf_invoice or wf_proforma) is still empty, in id
+// order after the given order id.
+func (s *MySql) stmtSelectOrdersWithoutDocument(column string) (*sql.Stmt, error) {
+	query := fmt.Sprintf(
+		`SELECT order_id FROM %sorder
+		 WHERE order_status_id = ? AND %s = '' AND date_modified >= ? AND order_id > ?
+		 ORDER BY order_id
+		 LIMIT 20`,
+		s.prefix, column,
+	)
+	return s.prepareStmt("selectOrdersWithout_"+column, query)
+}
+
 func (s *MySql) stmtUpdateOrderPayment() (*sql.Stmt, error) {
 	query := fmt.Sprintf(
 		`UPDATE %sorder SET
@@ -121,6 +145,24 @@ func (s *MySql) stmtSelectOrderIdByZohoId() (*sql.Stmt, error) {
 	return s.prepareStmt("stmtSelectOrderIdByZohoId", query)
 }
 
+// stmtSelectOrderStatusId reads an order's current status, used to re-check an order
+// after its processing lock is acquired.
+func (s *MySql) stmtSelectOrderStatusId() (*sql.Stmt, error) {
+	query := fmt.Sprintf(
+		`SELECT order_status_id FROM %sorder WHERE order_id = ?`,
+		s.prefix,
+	)
+	return s.prepareStmt("stmtSelectOrderStatusId", query)
+}
+
+func (s *MySql) stmtSelectOrderStatusIdByName() (*sql.Stmt, error) {
+	query := fmt.Sprintf(
+		`SELECT DISTINCT order_status_id FROM %sorder_status WHERE name = ?`,
+		s.prefix,
+	)
+	return s.prepareStmt("stmtSelectOrderStatusIdByName", query)
+}
+
 func (s *MySql) stmtSelectOrderProducts() (*sql.Stmt, error) {
 	query := fmt.Sprintf(
 		`SELECT
@@ -171,7 +213,8 @@ func (s *MySql) stmtSelectOrderStatus() (*sql.Stmt, error) {
 			wf_proforma,
 			wf_file_proforma,
 			total,
-			customer_group_id
+			customer_group_id,
+			payment_code
 		 FROM %sorder
 		 WHERE order_status_id = ?
 		 LIMIT 5`,
@@ -223,7 +266,8 @@ func (s *MySql) stmtSelectOrderId() (*sql.Stmt, error) {
 			wf_proforma,
 			wf_file_proforma,
 			total,
-			customer_group_id
+			customer_group_id,
+			payment_code
 		 FROM %sorder
 		 WHERE order_id = ?`,
 		s.prefix,
@@ -1,6 +1,7 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
@@ -105,7 +106,7 @@ func (s *MySql) readStructure(table string) (map[string]Column, error) {
 	return tableInfo, nil
 }
 
-func (s *MySql) insert(table string, userData map[string]interface{}) (int64, error) {
+func (s *MySql) insert(ctx context.Context, table string, userData map[string]interface{}) (int64, error) {
 
 	// Получаем структуру таблицы
 	tableInfo, err := s.readStructure(table)
@@ -165,7 +166,7 @@ func (s *MySql) insert(table string, userData map[string]interface{}) (int64, er
 		strings.Join(colNames, ", "),
 		strings.Join(placeholders, ", "),
 	)
-	res, err := s.db.Exec(insertSQL, values...)
+	res, err := s.db.ExecContext(ctx, insertSQL, values...)
 	if err != nil {
 		return 0, fmt.Errorf("%s insert: %w", table, err)
 	}
@@ -0,0 +1,84 @@
+package oc_client
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"html/template"
+	"time"
+	"wfsync/lib/money"
+
+	"wfsync/entity"
+)
+
+// defaultCommentTemplate renders the order history entry written after a job succeeds:
+// the document link followed by its number, amount and the processing time. Without a
+// link the job name stands alone.
+const defaultCommentTemplate = `{{if .Link}}<a href="{{.Link}}" target="_blank">{{.Job}}</a>{{else}}{{.Job}}{{end}}` +
+	`{{if .Number}} {{.Number}}{{end}}` +
+	`{{if .Amount}}, {{.Amount}} {{.Currency}}{{end}}` +
+	` ({{.Time}})`
+
+// commentTimeLayout formats CommentData.Time.
+const commentTimeLayout = "2006-01-02 15:04"
+
+// CommentData is the data available to opencart.comment_template.
+type CommentData struct {
+	Job      string // job name, e.g. "wfirma-invoice"
+	Link     string // payment or document link; empty for a document link that expires
+	Number   string // wFirma document number, empty for payment links
+	Amount   string // amount in major units, e.g. "123.45"; empty when zero
+	Currency string // order currency code
+	Time     string // processing time, "YYYY-MM-DD HH:MM" local time
+}
+
+// parseCommentTemplate parses a custom history comment template, or the default one when
+// text is empty. html/template escapes every field for the HTML context it appears in,
+// so values from wFirma or the order cannot break OpenCart's admin page.
+func parseCommentTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		text = defaultCommentTemplate
+	}
+	return template.New("comment").Parse(text)
+}
+
+// newCommentData collects the template fields for a processed order.
+func newCommentData(jobName JobType, order *entity.CheckoutParams, payment *entity.Payment, now time.Time) CommentData {
+	data := CommentData{
+		Job:    string(jobName),
+		Link:   payment.Link,
+		Number: payment.Number,
+		Time:   now.Format(commentTimeLayout),
+	}
+	if payment.Amount != 0 {
+		data.Amount = money.New(payment.Amount, order.Currency).Format(".")
+		data.Currency = order.Currency
+	}
+	return data
+}
+
+// statusComment renders the history comment for a processed order. A template that fails
+// at execution falls back to the bare link, so the status change is never lost. The
+// comment is kept for good, so signed document links, which expire, are left out of it;
+// the document stays reachable through wfsync by its order.
+func (oc *Opencart) statusComment(jobName JobType, order *entity.CheckoutParams, payment *entity.Payment, now time.Time) string {
+	data := newCommentData(jobName, order, payment, now)
+	if oc.expiringLinks && jobName != JobStripeLink {
+		data.Link = ""
+	}
+	if oc.comment != nil {
+		var buf bytes.Buffer
+		if err := oc.comment.Execute(&buf, data); err == nil {
+			return buf.String()
+		}
+	}
+	if data.Link == "" {
+		return html.EscapeString(data.Job)
+	}
+	return fmt.Sprintf("<a href=\"%s\" target=\"_blank\">%s</a>", html.EscapeString(data.Link), html.EscapeString(data.Job))
+}
+
+// errorComment renders the history comment for a failed order.
+func errorComment(err error) string {
+	return html.EscapeString(fmt.Sprintf("Error: %v", err))
+}
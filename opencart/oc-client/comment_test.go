@@ -0,0 +1,105 @@
+package oc_client
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"wfsync/entity"
+)
+
+// TestStatusComment covers the history entries written after a job: the default entry,
+// escaping of values that would break OpenCart's admin page, and a custom template.
+func TestStatusComment(t *testing.T) {
+	now := time.Date(2025, 3, 14, 9, 30, 0, 0, time.UTC)
+	order := &entity.CheckoutParams{Currency: "PLN"}
+
+	cases := []struct {
+		name     string
+		template string
+		payment  *entity.Payment
+		want     string
+	}{
+		{
+			name:    "invoice with number and amount",
+			payment: &entity.Payment{Link: "https://files.example.com/a.pdf", Number: "FV 12/2025", Amount: 12345},
+			want:    `<a href="https://files.example.com/a.pdf" target="_blank">wfirma-invoice</a> FV 12/2025, 123.45 PLN (2025-03-14 09:30)`,
+		},
+		{
+			name:    "no number, no amount",
+			payment: &entity.Payment{Link: "https://files.example.com/a.pdf"},
+			want:    `<a href="https://files.example.com/a.pdf" target="_blank">wfirma-invoice</a> (2025-03-14 09:30)`,
+		},
+		{
+			name:    "escapes markup in values",
+			payment: &entity.Payment{Link: `https://x.example/a.pdf"><script>`, Number: `<b>FV</b>`},
+			want:    `<a href="https://x.example/a.pdf%22%3e%3cscript%3e" target="_blank">wfirma-invoice</a> &lt;b&gt;FV&lt;/b&gt; (2025-03-14 09:30)`,
+		},
+		{
+			name:    "rejects script links",
+			payment: &entity.Payment{Link: "javascript:alert(1)"},
+			want:    `<a href="#ZgotmplZ" target="_blank">wfirma-invoice</a> (2025-03-14 09:30)`,
+		},
+		{
+			name:     "custom template",
+			template: `Invoice {{.Number}}: <a href="{{.Link}}">PDF</a> [{{.Amount}} {{.Currency}}]`,
+			payment:  &entity.Payment{Link: "https://files.example.com/a.pdf", Number: "FV 1/2025", Amount: 100},
+			want:     `Invoice FV 1/2025: <a href="https://files.example.com/a.pdf">PDF</a> [1.00 PLN]`,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tmpl, err := parseCommentTemplate(tc.template)
+			if err != nil {
+				t.Fatalf("parseCommentTemplate: %v", err)
+			}
+			oc := &Opencart{comment: tmpl}
+			if got := oc.statusComment(JobInvoice, order, tc.payment, now); got != tc.want {
+				t.Errorf("statusComment() =\n %s\nwant\n %s", got, tc.want)
+			}
+		})
+	}
+}
+
+// TestStatusCommentExpiringLinks checks signed document links, which expire, are kept out
+// of the persistent history comment, while payment links are written as before.
+func TestStatusCommentExpiringLinks(t *testing.T) {
+	now := time.Date(2025, 3, 14, 9, 30, 0, 0, time.UTC)
+	tmpl, err := parseCommentTemplate("")
+	if err != nil {
+		t.Fatalf("parseCommentTemplate: %v", err)
+	}
+	oc := &Opencart{comment: tmpl, expiringLinks: true}
+	order := &entity.CheckoutParams{Currency: "PLN"}
+	signed := &entity.Payment{Link: "https://api.example.com/files/a.pdf?expires=1&sig=ab", Number: "FV 12/2025", Amount: 12345}
+
+	want := `wfirma-invoice FV 12/2025, 123.45 PLN (2025-03-14 09:30)`
+	if got := oc.statusComment(JobInvoice, order, signed, now); got != want {
+		t.Errorf("invoice comment = %s, want %s", got, want)
+	}
+	payLink := &entity.Payment{Link: "https://checkout.stripe.com/c/pay/cs_1"}
+	want = `<a href="https://checkout.stripe.com/c/pay/cs_1" target="_blank">stripe-pay-link</a> (2025-03-14 09:30)`
+	if got := oc.statusComment(JobStripeLink, order, payLink, now); got != want {
+		t.Errorf("payment link comment = %s, want %s", got, want)
+	}
+}
+
+// TestStatusCommentFallback checks that a template failing at execution still yields an
+// escaped link, and that error comments are escaped too.
+func TestStatusCommentFallback(t *testing.T) {
+	tmpl, err := parseCommentTemplate(`{{.Missing}}`)
+	if err != nil {
+		t.Fatalf("parseCommentTemplate: %v", err)
+	}
+	oc := &Opencart{comment: tmpl}
+	got := oc.statusComment(JobProforma, &entity.CheckoutParams{}, &entity.Payment{Link: `https://x.example/"a.pdf`}, time.Now())
+	want := `<a href="https://x.example/&#34;a.pdf" target="_blank">wfirma-proforma</a>`
+	if got != want {
+		t.Errorf("fallback comment = %s, want %s", got, want)
+	}
+
+	if got = errorComment(errors.New("<missing> NIP")); !strings.Contains(got, "&lt;missing&gt;") {
+		t.Errorf("error comment not escaped: %s", got)
+	}
+}
@@ -3,15 +3,19 @@ package oc_client
 import (
 	"context"
 	"fmt"
+	"html"
+	"html/template"
 	"log/slog"
 	"regexp"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
+	"wfsync/lib/features"
 
 	"wfsync/entity"
 	"wfsync/internal/config"
+	"wfsync/lib/metrics"
 	"wfsync/lib/sl"
 	"wfsync/opencart/database"
 )
@@ -26,8 +30,26 @@ const (
 
 type CheckoutHandler func(ctx context.Context, params *entity.CheckoutParams) (*entity.Payment, error)
 
+// orderDatabase is the OpenCart database the client reads orders from and writes their
+// status and document columns to; implemented by *database.MySql.
+type orderDatabase interface {
+	documentColumns
+	OrderSearchStatus(ctx context.Context, statusId int) ([]*entity.CheckoutParams, error)
+	OrderSearchId(ctx context.Context, orderId int64) (*entity.CheckoutParams, error)
+	OrderSearchByDateRange(from, to string) ([]*entity.OrderSummary, error)
+	OrderStatusId(ctx context.Context, orderId int64) (int, error)
+	OrderIdByPaymentRef(paymentId, sessionId string) (int64, error)
+	OrderIdByZohoId(zohoId string) (int64, error)
+	ChangeOrderStatus(ctx context.Context, orderId int64, orderStatusId int, comment string) error
+	ClearStatusHistory(ctx context.Context, orderId int64, orderStatusId int) error
+	UpdatePayment(orderId int64, paymentId, sessionId, status string, amount int64) error
+	ReferencedFiles() (map[string]bool, error)
+	Ping(ctx context.Context) error
+	Close()
+}
+
 type Opencart struct {
-	db                    *database.MySql
+	db                    orderDatabase
 	log                   *slog.Logger
 	statusUrlRequest      int
 	statusUrlResult       int
@@ -38,9 +60,19 @@ type Opencart struct {
 	handlerUrl            CheckoutHandler
 	handlerProforma       CheckoutHandler
 	handlerInvoice        CheckoutHandler
+	comment               *template.Template
+	expiringLinks         bool // document links expire (file_links), so comments omit them
+	forceInvoice          bool
+	totalTolerance        int64
+	locker                OrderLocker
+	documents             DocumentStore
+	features              *features.Flags
+	lockOwner             string
 	mutex                 sync.Mutex
 	done                  chan struct{}
 	stopped               chan struct{}
+	ctx                   context.Context // canceled by Stop to abort in-flight queries
+	cancel                context.CancelFunc
 }
 
 func New(conf *config.Config, log *slog.Logger) (*Opencart, error) {
@@ -52,36 +84,69 @@ func New(conf *config.Config, log *slog.Logger) (*Opencart, error) {
 		return nil, fmt.Errorf("sql client: %w", err)
 	}
 	oc := &Opencart{
-		db:  db,
-		log: log.With(sl.Module("opencart")),
+		db:             db,
+		log:            log.With(sl.Module("opencart")),
+		lockOwner:      lockOwner(),
+		forceInvoice:   conf.OpenCart.ForceInvoice,
+		totalTolerance: conf.TotalTolerance,
+		expiringLinks:  conf.FileLinks.Enabled(),
 	}
 
-	parseStatus := func(name, value string) int {
-		if value == "" {
-			return 0
-		}
-		v, err := strconv.Atoi(value)
-		if err != nil {
-			oc.log.Warn("invalid status config value",
-				slog.String("field", name),
-				slog.String("value", value),
-				sl.Err(err))
-			return 0
+	// A status that cannot be resolved would silently switch its job off; refuse to start
+	// instead, like an unreachable database.
+	ctx, cancel := context.WithTimeout(context.Background(), statusLookupTimeout)
+	defer cancel()
+	statuses := []struct {
+		field string
+		value string
+		id    *int
+	}{
+		{"status_url_request", conf.OpenCart.StatusUrlRequest, &oc.statusUrlRequest},
+		{"status_url_result", conf.OpenCart.StatusUrlResult, &oc.statusUrlResult},
+		{"status_proforma_request", conf.OpenCart.StatusProformaRequest, &oc.statusProformaRequest},
+		{"status_proforma_result", conf.OpenCart.StatusProformaResult, &oc.statusProformaResult},
+		{"status_invoice_request", conf.OpenCart.StatusInvoiceRequest, &oc.statusInvoiceRequest},
+		{"status_invoice_result", conf.OpenCart.StatusInvoiceResult, &oc.statusInvoiceResult},
+	}
+	for _, status := range statuses {
+		if *status.id, err = resolveStatus(ctx, status.value, db); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("%s %q: %w", status.field, status.value, err)
 		}
-		return v
 	}
 
-	oc.statusUrlRequest = parseStatus("status_url_request", conf.OpenCart.StatusUrlRequest)
-	oc.statusUrlResult = parseStatus("status_url_result", conf.OpenCart.StatusUrlResult)
-	oc.statusProformaRequest = parseStatus("status_proforma_request", conf.OpenCart.StatusProformaRequest)
-	oc.statusProformaResult = parseStatus("status_proforma_result", conf.OpenCart.StatusProformaResult)
-	oc.statusInvoiceRequest = parseStatus("status_invoice_request", conf.OpenCart.StatusInvoiceRequest)
-	oc.statusInvoiceResult = parseStatus("status_invoice_result", conf.OpenCart.StatusInvoiceResult)
+	oc.comment, err = parseCommentTemplate(conf.OpenCart.CommentTemplate)
+	if err != nil {
+		oc.log.Warn("invalid comment template, using default", sl.Err(err))
+		oc.comment, _ = parseCommentTemplate("")
+	}
 
 	return oc, nil
 }
 
+// statusLookupTimeout bounds the status name lookups New makes at startup.
+const statusLookupTimeout = 30 * time.Second
+
+// statusResolver looks order statuses up by name; implemented by *database.MySql.
+type statusResolver interface {
+	OrderStatusIdByName(ctx context.Context, name string) (int, error)
+}
+
+// resolveStatus turns a configured order status into its id: a number is the id itself,
+// anything else is the status name, looked up in the store. Empty means not configured.
+func resolveStatus(ctx context.Context, value string, statuses statusResolver) (int, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, nil
+	}
+	if id, err := strconv.Atoi(value); err == nil {
+		return id, nil
+	}
+	return statuses.OrderStatusIdByName(ctx, value)
+}
+
 func (oc *Opencart) Start() {
+	oc.ctx, oc.cancel = context.WithCancel(context.Background())
 	oc.done = make(chan struct{})
 	oc.stopped = make(chan struct{})
 	go func() {
@@ -103,14 +168,23 @@ func (oc *Opencart) Start() {
 func (oc *Opencart) Stop() {
 	if oc.done != nil {
 		oc.log.Debug("stopping order processor")
+		oc.cancel()
 		close(oc.done)
 		<-oc.stopped
 	}
+	// An order event's job holds the pass lock while it runs in the background.
+	oc.mutex.Lock()
+	defer oc.mutex.Unlock()
 	if oc.db != nil {
 		oc.db.Close()
 	}
 }
 
+// Ping checks that the OpenCart database answers, for the health endpoint.
+func (oc *Opencart) Ping(ctx context.Context) error {
+	return oc.db.Ping(ctx)
+}
+
 func (oc *Opencart) WithUrlHandler(handler CheckoutHandler) *Opencart {
 	oc.handlerUrl = handler
 	return oc
@@ -126,16 +200,27 @@ func (oc *Opencart) WithInvoiceHandler(handler CheckoutHandler) *Opencart {
 	return oc
 }
 
+// WithFeatures makes order passes and database calls check the OpenCart feature flag
+// first; while it is off, passes are skipped and calls fail with
+// entity.ErrSubsystemDisabled.
+func (oc *Opencart) WithFeatures(f *features.Flags) *Opencart {
+	oc.features = f
+	return oc
+}
+
 func (oc *Opencart) OrderLines(orderId string) ([]*entity.LineItem, error) {
 	if oc.db == nil || orderId == "" {
 		return nil, nil
 	}
+	if err := oc.features.Check(entity.FeatureOpenCart); err != nil {
+		return nil, err
+	}
 	id, err := strconv.ParseInt(orderId, 10, 64)
 	if err != nil {
 		return nil, fmt.Errorf("invalid order id: %s", orderId)
 	}
 
-	order, err := oc.db.OrderSearchId(id)
+	order, err := oc.db.OrderSearchId(context.Background(), id)
 	if err != nil {
 		return nil, fmt.Errorf("database query: %w", err)
 	}
@@ -143,20 +228,125 @@ func (oc *Opencart) OrderLines(orderId string) ([]*entity.LineItem, error) {
 	return order.LineItems, nil
 }
 
-func (oc *Opencart) ProcessOrders() {
-	oc.mutex.Lock()
+// ProcessOrders runs one pass over all status-request jobs and reports whether it ran.
+// A pass that finds another one still in progress is skipped rather than queued behind
+// it: the running pass already picks up every order in a request status, so waiting
+// would only stack up redundant passes behind a slow handler. The pass runs under the
+// processor context, so Stop aborts its queries instead of waiting for them. Each pass
+// ends by restoring document ids missing from finished orders (see reconcileDocuments).
+func (oc *Opencart) ProcessOrders() bool {
+	if !oc.features.Enabled(entity.FeatureOpenCart) {
+		oc.log.Debug("opencart disabled, skipping run")
+		return false
+	}
+	if !oc.mutex.TryLock() {
+		oc.log.Debug("order processing already in progress, skipping run")
+		return false
+	}
 	defer oc.mutex.Unlock()
 
-	oc.handleByStatus(oc.statusUrlRequest, oc.statusUrlResult, oc.handlerUrl, JobStripeLink)
+	ctx := oc.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	oc.handleByStatus(ctx, oc.statusUrlRequest, oc.statusUrlResult, oc.handlerUrl, JobStripeLink)
+
+	oc.handleByStatus(ctx, oc.statusProformaRequest, oc.statusProformaResult, oc.handlerProforma, JobProforma)
 
-	oc.handleByStatus(oc.statusProformaRequest, oc.statusProformaResult, oc.handlerProforma, JobProforma)
+	oc.handleByStatus(ctx, oc.statusInvoiceRequest, oc.statusInvoiceResult, oc.handlerInvoice, JobInvoice)
 
-	oc.handleByStatus(oc.statusInvoiceRequest, oc.statusInvoiceResult, oc.handlerInvoice, JobInvoice)
+	if oc.db != nil {
+		oc.reconcileDocuments(ctx, oc.db, JobProforma, oc.statusProformaRequest, oc.statusProformaResult)
+		oc.reconcileDocuments(ctx, oc.db, JobInvoice, oc.statusInvoiceRequest, oc.statusInvoiceResult)
+	}
+	return true
 }
 
-// handleByStatus processes orders based on the given status and applies the provided handler to update their state.
-func (oc *Opencart) handleByStatus(statusRequest, statusResult int, handler CheckoutHandler, jobName JobType) {
+// ProcessOrder starts one job for a single order right away, for stores that push order
+// events instead of waiting for the next pass. The order is checked before returning; the
+// job itself runs in the background under the pass lock, since invoicing can outlast the
+// request. It reports false without starting when a pass is in progress: that pass, or
+// the next one, handles the order. An order not in the job's request status is refused
+// with entity.ErrOrderNotInRequestStatus.
+func (oc *Opencart) ProcessOrder(ctx context.Context, orderId int64, jobName JobType) (bool, error) {
+	if oc.db == nil {
+		return false, fmt.Errorf("database not connected")
+	}
+	if err := oc.features.Check(entity.FeatureOpenCart); err != nil {
+		return false, err
+	}
+	statusRequest, statusResult, handler, err := oc.job(jobName)
+	if err != nil {
+		return false, err
+	}
+	if !oc.mutex.TryLock() {
+		oc.log.With(
+			slog.Int64("order_id", orderId),
+			slog.String("job", string(jobName)),
+		).Debug("order processing in progress, leaving order to the pass")
+		return false, nil
+	}
+	started := false
+	defer func() {
+		if !started {
+			oc.mutex.Unlock()
+		}
+	}()
+
+	log := oc.log.With(
+		slog.String("job", string(jobName)),
+		slog.Int("status", statusRequest),
+	)
+	current, err := oc.db.OrderStatusId(ctx, orderId)
+	if err != nil {
+		return false, fmt.Errorf("read order status: %w", err)
+	}
+	if current != statusRequest {
+		return false, fmt.Errorf("%w: status %d, job %s expects %d", entity.ErrOrderNotInRequestStatus, current, jobName, statusRequest)
+	}
+	order, err := oc.db.OrderSearchId(ctx, orderId)
+	if err != nil {
+		return false, fmt.Errorf("get order: %w", err)
+	}
+	if order == nil || order.OrderId == "" {
+		return false, fmt.Errorf("%w: %d", entity.ErrOrderNotFound, orderId)
+	}
+
+	jobCtx := oc.ctx
+	if jobCtx == nil {
+		jobCtx = context.WithoutCancel(ctx)
+	}
+	started = true
+	go func() {
+		defer oc.mutex.Unlock()
+		oc.handleOrder(jobCtx, log, order, orderId, statusRequest, statusResult, handler, jobName)
+	}()
+	return true, nil
+}
+
+// job returns the statuses and handler of a job, or an error when the job is unknown or
+// not configured.
+func (oc *Opencart) job(jobName JobType) (statusRequest, statusResult int, handler CheckoutHandler, err error) {
+	switch jobName {
+	case JobStripeLink:
+		statusRequest, statusResult, handler = oc.statusUrlRequest, oc.statusUrlResult, oc.handlerUrl
+	case JobProforma:
+		statusRequest, statusResult, handler = oc.statusProformaRequest, oc.statusProformaResult, oc.handlerProforma
+	case JobInvoice:
+		statusRequest, statusResult, handler = oc.statusInvoiceRequest, oc.statusInvoiceResult, oc.handlerInvoice
+	default:
+		return 0, 0, nil, fmt.Errorf("unknown job %q", jobName)
+	}
 	if statusRequest == 0 || handler == nil {
+		return 0, 0, nil, fmt.Errorf("%w: %s", entity.ErrJobNotConfigured, jobName)
+	}
+	return statusRequest, statusResult, handler, nil
+}
+
+// handleByStatus processes orders based on the given status and applies the provided handler to update their state.
+func (oc *Opencart) handleByStatus(ctx context.Context, statusRequest, statusResult int, handler CheckoutHandler, jobName JobType) {
+	if statusRequest == 0 || handler == nil || ctx.Err() != nil {
 		return
 	}
 	log := oc.log.With(
@@ -164,7 +354,7 @@ func (oc *Opencart) handleByStatus(statusRequest, statusResult int, handler Chec
 		slog.Int("status", statusRequest),
 	)
 
-	orders, err := oc.db.OrderSearchStatus(statusRequest)
+	orders, err := oc.db.OrderSearchStatus(ctx, statusRequest)
 	if err != nil {
 		log.With(
 			sl.Err(err),
@@ -176,13 +366,18 @@ func (oc *Opencart) handleByStatus(statusRequest, statusResult int, handler Chec
 	}
 
 	for _, order := range orders {
+		if ctx.Err() != nil {
+			log.Debug("order processing canceled")
+			return
+		}
 		if order == nil || order.OrderId == "" {
 			continue
 		}
 
-		linesTotal := order.ItemsTotal()
-		// warn if the order total does not match a sum of line items (for debugging)
-		if order.Total != linesTotal {
+		// warn if the order total does not match a sum of line items beyond the rounding
+		// tolerance (for debugging)
+		if err := order.ValidateTotal(oc.totalTolerance); err != nil {
+			linesTotal := order.ItemsTotal()
 			log.With(
 				slog.String("order_id", order.OrderId),
 				slog.Int64("total", order.Total),
@@ -200,77 +395,153 @@ func (oc *Opencart) handleByStatus(statusRequest, statusResult int, handler Chec
 			continue
 		}
 
-		// clear status history
-		err = oc.db.ClearStatusHistory(orderId, statusRequest)
+		oc.handleOrder(ctx, log, order, orderId, statusRequest, statusResult, handler, jobName)
+	}
+}
+
+// handleOrder runs the handler for a single order under the order's processing lock.
+// The status is re-read once the lock is held: another instance may have finished the
+// order between our status search and the lock.
+//
+// Once the handler has run, its outcome is recorded with cancellation detached from ctx:
+// a document created during shutdown must still be written back to the order, or the
+// next run would create it again.
+func (oc *Opencart) handleOrder(ctx context.Context, log *slog.Logger, order *entity.CheckoutParams, orderId int64, statusRequest, statusResult int, handler CheckoutHandler, jobName JobType) {
+	release, ok := oc.lockOrder(order.OrderId, log)
+	if !ok {
+		return
+	}
+	defer release()
+
+	if oc.locker != nil {
+		current, err := oc.db.OrderStatusId(ctx, orderId)
 		if err != nil {
 			log.With(
 				slog.String("order_id", order.OrderId),
-				slog.Int("status", statusRequest),
 				sl.Err(err),
-			).Warn("clear status history")
+			).Error("read order status")
+			return
 		}
-		err = oc.db.ClearStatusHistory(orderId, statusResult)
-		if err != nil {
+		if current != statusRequest {
 			log.With(
 				slog.String("order_id", order.OrderId),
-				slog.Int("status", statusResult),
-				sl.Err(err),
-			).Warn("clear status history")
+				slog.Int("current_status", current),
+			).Debug("order already handled")
+			return
 		}
+	}
 
-		// Use a context with timeout for background processing
-		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
-		payment, err := handler(ctx, order)
-		cancel()
+	if oc.alreadyInvoiced(jobName, order) {
+		log.With(
+			slog.String("order_id", order.OrderId),
+			slog.String("invoice_id", order.InvoiceId),
+		).Info("order already invoiced, skipping")
+		oc.finishInvoiced(ctx, log, order, orderId, statusRequest, statusResult)
+		return
+	}
+
+	// clear status history
+	err := oc.db.ClearStatusHistory(ctx, orderId, statusRequest)
+	if err != nil {
+		log.With(
+			slog.String("order_id", order.OrderId),
+			slog.Int("status", statusRequest),
+			sl.Err(err),
+		).Warn("clear status history")
+	}
+	err = oc.db.ClearStatusHistory(ctx, orderId, statusResult)
+	if err != nil {
+		log.With(
+			slog.String("order_id", order.OrderId),
+			slog.Int("status", statusResult),
+			sl.Err(err),
+		).Warn("clear status history")
+	}
+
+	if ctx.Err() != nil {
+		return
+	}
+
+	// Use a context with timeout for background processing
+	handlerCtx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	payment, err := handler(handlerCtx, order)
+	cancel()
+	writeCtx := context.WithoutCancel(ctx)
+	if err != nil {
+		log.With(
+			slog.String("order_id", order.OrderId),
+			sl.Err(err),
+		).Error("handle order")
+		metrics.Failures.Inc()
+		_ = oc.db.ChangeOrderStatus(writeCtx, orderId, statusResult, errorComment(err))
+		return
+	}
+	if payment == nil {
+		return
+	}
+
+	if statusResult == 0 {
+		statusResult = statusRequest + 1
+	}
+
+	comment := oc.statusComment(jobName, order, payment, time.Now())
+	err = oc.db.ChangeOrderStatus(writeCtx, orderId, statusResult, comment)
+	if err != nil {
+		log.With(
+			slog.String("order_id", order.OrderId),
+			slog.Int("status_result", statusResult),
+			sl.Err(err),
+		).Error("change order status")
+		metrics.Failures.Inc()
+		return
+	}
+
+	if jobName == JobProforma {
+		err = oc.db.UpdateProforma(writeCtx, orderId, payment.Id, payment.InvoiceFile)
 		if err != nil {
 			log.With(
 				slog.String("order_id", order.OrderId),
 				sl.Err(err),
-			).Error("handle order")
-			_ = oc.db.ChangeOrderStatus(orderId, statusResult, fmt.Sprintf("Error: %v", err))
-			continue
+			).Error("update proforma")
 		}
-		if payment == nil {
-			continue
-		}
-
-		if statusResult == 0 {
-			statusResult = statusRequest + 1
-		}
-
-		comment := fmt.Sprintf("<a href=\"%s\" target=\"_blank\">%s</a>", payment.Link, jobName)
-		err = oc.db.ChangeOrderStatus(orderId, statusResult, comment)
+	}
+	if jobName == JobInvoice {
+		err = oc.db.UpdateInvoice(writeCtx, orderId, payment.Id, payment.InvoiceFile)
 		if err != nil {
 			log.With(
 				slog.String("order_id", order.OrderId),
-				slog.Int("status_result", statusResult),
 				sl.Err(err),
-			).Error("change order status")
-			continue
+			).Error("update invoice")
 		}
+	}
 
-		if jobName == JobProforma {
-			err = oc.UpdateOrderWithProforma(orderId, payment.Id, payment.InvoiceFile)
-			if err != nil {
-				log.With(
-					slog.String("order_id", order.OrderId),
-					sl.Err(err),
-				).Error("update proforma")
-			}
-		}
-		if jobName == JobInvoice {
-			err = oc.UpdateOrderWithInvoice(orderId, payment.Id, payment.InvoiceFile)
-			if err != nil {
-				log.With(
-					slog.String("order_id", order.OrderId),
-					sl.Err(err),
-				).Error("update invoice")
-			}
-		}
+	metrics.OrdersProcessed.Inc()
+	log.With(
+		slog.String("order_id", order.OrderId),
+	).Debug("order processed")
+}
 
+// alreadyInvoiced reports whether an invoice job must skip the order because it already
+// carries a wFirma invoice. A reset status would otherwise run the invoice flow again;
+// force_invoice restores that behavior for operators who use the status to re-fetch files.
+func (oc *Opencart) alreadyInvoiced(jobName JobType, order *entity.CheckoutParams) bool {
+	return jobName == JobInvoice && order.InvoiceId != "" && !oc.forceInvoice
+}
+
+// finishInvoiced moves a skipped order to the result status, so it leaves the request
+// queue instead of being picked up by every run.
+func (oc *Opencart) finishInvoiced(ctx context.Context, log *slog.Logger, order *entity.CheckoutParams, orderId int64, statusRequest, statusResult int) {
+	if statusResult == 0 {
+		statusResult = statusRequest + 1
+	}
+	_ = oc.db.ClearStatusHistory(ctx, orderId, statusRequest)
+	comment := html.EscapeString(fmt.Sprintf("Already invoiced: %s", order.InvoiceId))
+	if err := oc.db.ChangeOrderStatus(ctx, orderId, statusResult, comment); err != nil {
 		log.With(
 			slog.String("order_id", order.OrderId),
-		).Debug("order processed")
+			slog.Int("status_result", statusResult),
+			sl.Err(err),
+		).Error("change order status")
 	}
 }
 
@@ -279,6 +550,9 @@ func (oc *Opencart) GetOrdersByDateRange(from, to string) ([]*entity.OrderSummar
 	if oc.db == nil {
 		return nil, fmt.Errorf("database not connected")
 	}
+	if err := oc.features.Check(entity.FeatureOpenCart); err != nil {
+		return nil, err
+	}
 	return oc.db.OrderSearchByDateRange(from, to)
 }
 
@@ -286,7 +560,10 @@ func (oc *Opencart) GetOrder(orderId int64) (*entity.CheckoutParams, error) {
 	if oc.db == nil {
 		return nil, fmt.Errorf("database not connected")
 	}
-	return oc.db.OrderSearchId(orderId)
+	if err := oc.features.Check(entity.FeatureOpenCart); err != nil {
+		return nil, err
+	}
+	return oc.db.OrderSearchId(context.Background(), orderId)
 }
 
 // OrderIdByPaymentRef recovers an OpenCart order id from the Stripe PaymentIntent or
@@ -295,6 +572,9 @@ func (oc *Opencart) OrderIdByPaymentRef(paymentId, sessionId string) (int64, err
 	if oc.db == nil {
 		return 0, fmt.Errorf("database not connected")
 	}
+	if err := oc.features.Check(entity.FeatureOpenCart); err != nil {
+		return 0, err
+	}
 	return oc.db.OrderIdByPaymentRef(paymentId, sessionId)
 }
 
@@ -302,18 +582,24 @@ func (oc *Opencart) SaveInvoiceId(orderId string, invoiceId, invoiceFile string)
 	if oc.db == nil || orderId == "" {
 		return nil
 	}
+	if err := oc.features.Check(entity.FeatureOpenCart); err != nil {
+		return err
+	}
 	orderId = strings.TrimPrefix(orderId, "test_")
 	id, err := strconv.ParseInt(orderId, 10, 64)
 	if err != nil {
 		return fmt.Errorf("invalid order id: %s", orderId)
 	}
-	return oc.db.UpdateInvoice(id, invoiceId, invoiceFile)
+	return oc.db.UpdateInvoice(context.Background(), id, invoiceId, invoiceFile)
 }
 
 func (oc *Opencart) ChangeOrderStatus(orderId string, statusId int, comment string) error {
 	if oc.db == nil || orderId == "" {
 		return nil
 	}
+	if err := oc.features.Check(entity.FeatureOpenCart); err != nil {
+		return err
+	}
 	id, err := oc.ResolveOrderId(orderId)
 	if err != nil {
 		return err
@@ -321,13 +607,16 @@ func (oc *Opencart) ChangeOrderStatus(orderId string, statusId int, comment stri
 	if id == 0 {
 		return fmt.Errorf("unresolved order id: %s", orderId)
 	}
-	return oc.db.ChangeOrderStatus(id, statusId, comment)
+	return oc.db.ChangeOrderStatus(context.Background(), id, statusId, comment)
 }
 
 func (oc *Opencart) SavePaymentData(orderId string, paymentId, sessionId, status string, amount int64) error {
 	if oc.db == nil || orderId == "" {
 		return nil
 	}
+	if err := oc.features.Check(entity.FeatureOpenCart); err != nil {
+		return err
+	}
 	id, err := oc.ResolveOrderId(orderId)
 	if err != nil {
 		return err
@@ -362,10 +651,27 @@ func (oc *Opencart) ResolveOrderId(raw string) (int64, error) {
 	return oc.db.OrderIdByZohoId(m[1])
 }
 
+// ReferencedFiles returns the document files stored on OpenCart orders.
+func (oc *Opencart) ReferencedFiles() (map[string]bool, error) {
+	if oc.db == nil {
+		return nil, fmt.Errorf("database not connected")
+	}
+	if err := oc.features.Check(entity.FeatureOpenCart); err != nil {
+		return nil, err
+	}
+	return oc.db.ReferencedFiles()
+}
+
 func (oc *Opencart) UpdateOrderWithProforma(orderId int64, proformaId, proformaFile string) error {
-	return oc.db.UpdateProforma(orderId, proformaId, proformaFile)
+	if err := oc.features.Check(entity.FeatureOpenCart); err != nil {
+		return err
+	}
+	return oc.db.UpdateProforma(context.Background(), orderId, proformaId, proformaFile)
 }
 
 func (oc *Opencart) UpdateOrderWithInvoice(orderId int64, proformaId, proformaFile string) error {
-	return oc.db.UpdateInvoice(orderId, proformaId, proformaFile)
+	if err := oc.features.Check(entity.FeatureOpenCart); err != nil {
+		return err
+	}
+	return oc.db.UpdateInvoice(context.Background(), orderId, proformaId, proformaFile)
 }
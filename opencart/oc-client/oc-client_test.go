@@ -0,0 +1,354 @@
+package oc_client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"wfsync/entity"
+	"wfsync/lib/features"
+	"wfsync/opencart/database"
+)
+
+// TestProcessOrdersSkipsOverlappingRun checks that a pass started while another one holds
+// the processing lock returns immediately instead of waiting for it to finish.
+func TestProcessOrdersSkipsOverlappingRun(t *testing.T) {
+	oc := &Opencart{log: slog.New(slog.NewTextHandler(io.Discard, nil))}
+
+	// Simulate a pass in progress.
+	oc.mutex.Lock()
+	result := make(chan bool, 1)
+	go func() { result <- oc.ProcessOrders() }()
+	select {
+	case ran := <-result:
+		if ran {
+			t.Error("ProcessOrders ran while another pass was in progress")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("ProcessOrders blocked behind the running pass")
+	}
+	oc.mutex.Unlock()
+
+	if !oc.ProcessOrders() {
+		t.Error("ProcessOrders skipped with no other pass in progress")
+	}
+}
+
+// memLocker mimics the Mongo lock document: one owner per order until released.
+type memLocker struct {
+	mu     sync.Mutex
+	owners map[string]string
+	err    error
+}
+
+func (l *memLocker) AcquireOrderLock(orderId, owner string, _ time.Duration) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.err != nil {
+		return false, l.err
+	}
+	if held, ok := l.owners[orderId]; ok && held != owner {
+		return false, nil
+	}
+	l.owners[orderId] = owner
+	return true, nil
+}
+
+func (l *memLocker) ReleaseOrderLock(orderId, owner string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.owners[orderId] == owner {
+		delete(l.owners, orderId)
+	}
+	return nil
+}
+
+// TestLockOrderContention covers two instances sharing a lock store: the second one is
+// refused while the first holds the order, gets it after release, and a failing store
+// makes both skip the order instead of processing it unguarded.
+func TestLockOrderContention(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	locker := &memLocker{owners: map[string]string{}}
+	a := (&Opencart{log: log, lockOwner: "host-a:1"}).WithOrderLocker(locker)
+	b := (&Opencart{log: log, lockOwner: "host-b:1"}).WithOrderLocker(locker)
+
+	release, ok := a.lockOrder("100", log)
+	if !ok {
+		t.Fatal("first instance did not get the lock")
+	}
+	if _, ok = b.lockOrder("100", log); ok {
+		t.Fatal("second instance got a lock that is held")
+	}
+	if _, ok = b.lockOrder("101", log); !ok {
+		t.Error("lock on one order blocked another order")
+	}
+	release()
+	if _, ok = b.lockOrder("100", log); !ok {
+		t.Error("second instance did not get the released lock")
+	}
+
+	locker.err = errors.New("mongo unavailable")
+	if _, ok = a.lockOrder("102", log); ok {
+		t.Error("order processed although the lock store failed")
+	}
+
+	unlocked := &Opencart{log: log}
+	if _, ok = unlocked.lockOrder("100", log); !ok {
+		t.Error("order skipped without a locker configured")
+	}
+}
+
+// TestHandleOrderSkipsLockedOrder checks that the handler never runs for an order another
+// instance is processing.
+func TestHandleOrderSkipsLockedOrder(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	locker := &memLocker{owners: map[string]string{"100": "host-b:1"}}
+	oc := (&Opencart{log: log, lockOwner: "host-a:1"}).WithOrderLocker(locker)
+
+	calls := 0
+	handler := func(ctx context.Context, params *entity.CheckoutParams) (*entity.Payment, error) {
+		calls++
+		return nil, nil
+	}
+	oc.handleOrder(context.Background(), log, &entity.CheckoutParams{OrderId: "100"}, 100, 24, 25, handler, JobProforma)
+	if calls != 0 {
+		t.Errorf("handler called %d times for a locked order", calls)
+	}
+}
+
+// TestAlreadyInvoiced checks that only invoice jobs skip orders carrying wf_invoice, and
+// that force_invoice lets them through.
+func TestAlreadyInvoiced(t *testing.T) {
+	invoiced := &entity.CheckoutParams{OrderId: "100", InvoiceId: "555"}
+	fresh := &entity.CheckoutParams{OrderId: "101"}
+
+	cases := []struct {
+		name  string
+		force bool
+		job   JobType
+		order *entity.CheckoutParams
+		want  bool
+	}{
+		{"invoiced order skipped", false, JobInvoice, invoiced, true},
+		{"new order processed", false, JobInvoice, fresh, false},
+		{"force processes invoiced order", true, JobInvoice, invoiced, false},
+		{"proforma job ignores invoice", false, JobProforma, invoiced, false},
+		{"payment link job ignores invoice", false, JobStripeLink, invoiced, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			oc := &Opencart{forceInvoice: tc.force}
+			if got := oc.alreadyInvoiced(tc.job, tc.order); got != tc.want {
+				t.Errorf("alreadyInvoiced() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+// statusDB records the status writes made on orders.
+type statusDB struct {
+	orderDatabase
+	cleared  []int
+	statuses []int
+	comments []string
+}
+
+func (d *statusDB) ClearStatusHistory(_ context.Context, _ int64, orderStatusId int) error {
+	d.cleared = append(d.cleared, orderStatusId)
+	return nil
+}
+
+func (d *statusDB) ChangeOrderStatus(_ context.Context, _ int64, orderStatusId int, comment string) error {
+	d.statuses = append(d.statuses, orderStatusId)
+	d.comments = append(d.comments, comment)
+	return nil
+}
+
+func (d *statusDB) UpdateInvoice(context.Context, int64, string, string) error {
+	return nil
+}
+
+// TestHandleOrderAlreadyInvoiced runs an invoice job on an order that already carries a
+// wFirma invoice: the handler is not called and the order moves to the result status
+// with a note of the invoice, unless force_invoice is set.
+func TestHandleOrderAlreadyInvoiced(t *testing.T) {
+	cases := []struct {
+		name        string
+		force       bool
+		wantCalls   int
+		wantComment string
+	}{
+		{"skipped", false, 0, "Already invoiced: 555"},
+		{"forced", true, 1, "wfirma-invoice"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			db := &statusDB{}
+			oc := &Opencart{db: db, forceInvoice: tc.force}
+			calls := 0
+			handler := func(context.Context, *entity.CheckoutParams) (*entity.Payment, error) {
+				calls++
+				return &entity.Payment{Id: "556", Number: "FV 7/2025"}, nil
+			}
+			order := &entity.CheckoutParams{OrderId: "100", InvoiceId: "555"}
+			log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+			oc.handleOrder(context.Background(), log, order, 100, 30, 0, handler, JobInvoice)
+
+			if calls != tc.wantCalls {
+				t.Errorf("handler calls = %d, want %d", calls, tc.wantCalls)
+			}
+			if len(db.statuses) != 1 || db.statuses[0] != 31 {
+				t.Fatalf("status changes = %v, want [31]", db.statuses)
+			}
+			if !strings.Contains(db.comments[0], tc.wantComment) {
+				t.Errorf("comment = %q, want it to contain %q", db.comments[0], tc.wantComment)
+			}
+			if len(db.cleared) == 0 || db.cleared[0] != 30 {
+				t.Errorf("cleared histories = %v, want the request status first", db.cleared)
+			}
+		})
+	}
+}
+
+// TestProcessOrderJob checks that a pushed order event resolves to its own job's statuses
+// and handler, that unconfigured or unknown jobs and a missing database are refused, and
+// that an event arriving during a pass is left to that pass.
+func TestProcessOrderJob(t *testing.T) {
+	called := ""
+	handlerFor := func(name string) CheckoutHandler {
+		return func(context.Context, *entity.CheckoutParams) (*entity.Payment, error) {
+			called = name
+			return nil, nil
+		}
+	}
+	oc := &Opencart{
+		log:                   slog.New(slog.NewTextHandler(io.Discard, nil)),
+		statusUrlRequest:      10,
+		statusUrlResult:       11,
+		statusProformaRequest: 20,
+		statusProformaResult:  21,
+		handlerUrl:            handlerFor("url"),
+		handlerProforma:       handlerFor("proforma"),
+	}
+	if _, err := oc.ProcessOrder(context.Background(), 101, JobProforma); err == nil {
+		t.Error("ProcessOrder without a database: expected an error")
+	}
+	oc.db = &statusDB{}
+
+	cases := []struct {
+		job         JobType
+		wantRequest int
+		wantResult  int
+		wantHandler string
+		wantErr     bool
+	}{
+		{JobStripeLink, 10, 11, "url", false},
+		{JobProforma, 20, 21, "proforma", false},
+		{JobInvoice, 0, 0, "", true},
+		{JobType("refund"), 0, 0, "", true},
+	}
+	for _, tc := range cases {
+		t.Run(string(tc.job), func(t *testing.T) {
+			request, result, handler, err := oc.job(tc.job)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("job(%s): expected an error", tc.job)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("job(%s): %v", tc.job, err)
+			}
+			called = ""
+			_, _ = handler(context.Background(), nil)
+			if request != tc.wantRequest || result != tc.wantResult || called != tc.wantHandler {
+				t.Errorf("job(%s) = %d -> %d via %q, want %d -> %d via %q",
+					tc.job, request, result, called, tc.wantRequest, tc.wantResult, tc.wantHandler)
+			}
+		})
+	}
+
+	oc.mutex.Lock()
+	defer oc.mutex.Unlock()
+	processed, err := oc.ProcessOrder(context.Background(), 101, JobProforma)
+	if err != nil || processed {
+		t.Errorf("ProcessOrder during a pass = %v, %v; want deferred without error", processed, err)
+	}
+}
+
+// flagStore serves fixed feature flags.
+type flagStore []*entity.FeatureFlag
+
+func (s flagStore) GetFeatureFlags() ([]*entity.FeatureFlag, error) { return s, nil }
+
+func (s flagStore) SaveFeatureFlag(*entity.FeatureFlag) error { return nil }
+
+// TestOpenCartDisabled checks that with the OpenCart feature flag off, order passes are
+// skipped and single-order jobs fail with ErrSubsystemDisabled before touching the store
+// database (a stub without queries here, so any query would panic).
+func TestOpenCartDisabled(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	oc := (&Opencart{
+		log:              log,
+		db:               &statusDB{},
+		statusUrlRequest: 10,
+		statusUrlResult:  11,
+		handlerUrl: func(context.Context, *entity.CheckoutParams) (*entity.Payment, error) {
+			t.Error("handler called while opencart is disabled")
+			return nil, nil
+		},
+	}).WithFeatures(features.New(flagStore{{Name: entity.FeatureOpenCart}}, log))
+
+	if oc.ProcessOrders() {
+		t.Error("ProcessOrders ran while opencart is disabled")
+	}
+	if _, err := oc.ProcessOrder(context.Background(), 1, JobStripeLink); !errors.Is(err, entity.ErrSubsystemDisabled) {
+		t.Errorf("ProcessOrder error = %v, want ErrSubsystemDisabled", err)
+	}
+	if err := oc.UpdateOrderWithInvoice(1, "inv-1", "inv-1.pdf"); !errors.Is(err, entity.ErrSubsystemDisabled) {
+		t.Errorf("UpdateOrderWithInvoice error = %v, want ErrSubsystemDisabled", err)
+	}
+}
+
+// statusNames resolves the statuses of a store by name.
+type statusNames map[string]int
+
+func (s statusNames) OrderStatusIdByName(_ context.Context, name string) (int, error) {
+	id, ok := s[name]
+	if !ok {
+		return 0, database.ErrUnknownOrderStatus
+	}
+	return id, nil
+}
+
+// TestResolveStatus checks that configured statuses may be ids or names: ids are taken
+// as they are, names are looked up in the store and an unknown name is an error.
+func TestResolveStatus(t *testing.T) {
+	statuses := statusNames{"Invoice requested": 17}
+	cases := []struct {
+		value       string
+		want        int
+		wantUnknown bool
+	}{
+		{"", 0, false},
+		{"17", 17, false},
+		{" 5 ", 5, false},
+		{"Invoice requested", 17, false},
+		{"Invoiced", 0, true},
+	}
+	for _, tc := range cases {
+		id, err := resolveStatus(context.Background(), tc.value, statuses)
+		if errors.Is(err, database.ErrUnknownOrderStatus) != tc.wantUnknown || (err != nil) != tc.wantUnknown {
+			t.Errorf("resolveStatus(%q) error = %v, want unknown %v", tc.value, err, tc.wantUnknown)
+		}
+		if id != tc.want {
+			t.Errorf("resolveStatus(%q) = %d, want %d", tc.value, id, tc.want)
+		}
+	}
+}
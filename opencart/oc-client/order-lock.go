@@ -0,0 +1,69 @@
+package oc_client
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"wfsync/lib/sl"
+)
+
+// orderLockTTL bounds how long a crashed instance can keep an order locked. It covers the
+// handler timeout plus the status and document updates that follow it.
+const orderLockTTL = 10 * time.Minute
+
+// OrderLocker guards an order against being handled by two wfsync instances at once when
+// several of them poll the same OpenCart database.
+type OrderLocker interface {
+	AcquireOrderLock(orderId, owner string, ttl time.Duration) (bool, error)
+	ReleaseOrderLock(orderId, owner string) error
+}
+
+// WithOrderLocker enables per-order locking. Without a locker, orders are only guarded
+// against overlapping runs within this instance.
+func (oc *Opencart) WithOrderLocker(locker OrderLocker) *Opencart {
+	oc.locker = locker
+	return oc
+}
+
+// lockOwner identifies this instance as a lock holder.
+func lockOwner() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s:%d", host, os.Getpid())
+}
+
+// lockOrder takes the order's lock and returns the function that releases it. The order
+// must be skipped when ok is false: another instance holds it, or the lock store failed.
+// Failing closed leaves the order in its request status for the next run, which is
+// cheaper than a second invoice.
+func (oc *Opencart) lockOrder(orderId string, log *slog.Logger) (release func(), ok bool) {
+	if oc.locker == nil {
+		return func() {}, true
+	}
+	acquired, err := oc.locker.AcquireOrderLock(orderId, oc.lockOwner, orderLockTTL)
+	if err != nil {
+		log.With(
+			slog.String("order_id", orderId),
+			sl.Err(err),
+		).Error("acquire order lock")
+		return nil, false
+	}
+	if !acquired {
+		log.With(
+			slog.String("order_id", orderId),
+		).Debug("order locked by another instance")
+		return nil, false
+	}
+	return func() {
+		if err := oc.locker.ReleaseOrderLock(orderId, oc.lockOwner); err != nil {
+			log.With(
+				slog.String("order_id", orderId),
+				sl.Err(err),
+			).Warn("release order lock")
+		}
+	}, true
+}
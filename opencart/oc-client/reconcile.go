@@ -0,0 +1,126 @@
+package oc_client
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"wfsync/entity"
+	"wfsync/lib/sl"
+)
+
+// reconcileWindow bounds the reconciliation pass to recently modified orders, so orders
+// that reached a result status before the document columns existed, or whose job failed,
+// are not re-read on every pass forever.
+const reconcileWindow = 72 * time.Hour
+
+// DocumentStore returns the checkout params stored for an order, which carry the wFirma
+// document ids recorded when the document was created.
+type DocumentStore interface {
+	GetCheckoutParamsByOrder(orderId string) (*entity.CheckoutParams, error)
+}
+
+// documentColumns is the part of the OpenCart database the reconciliation pass uses.
+type documentColumns interface {
+	OrdersWithoutDocument(ctx context.Context, statusId int, proforma bool, since time.Time, afterId int64) ([]int64, error)
+	UpdateProforma(ctx context.Context, orderId int64, proformaId, proformaFile string) error
+	UpdateInvoice(ctx context.Context, orderId int64, invoiceId, invoiceFile string) error
+}
+
+// WithDocumentStore enables the reconciliation pass: orders moved to a result status
+// whose document column update failed get the column written from the stored params.
+func (oc *Opencart) WithDocumentStore(store DocumentStore) *Opencart {
+	oc.documents = store
+	return oc
+}
+
+// reconcileDocuments repairs orders left inconsistent by handleOrder: the status change
+// succeeded but the following wf_proforma/wf_invoice update did not, so the order looks
+// done without its document. Only the column update is repeated, with the document id
+// stored when the document was created; no document is created here. Orders with no
+// stored id (their job failed) are left alone; the whole window is paged through, so
+// they cannot crowd out older broken orders.
+func (oc *Opencart) reconcileDocuments(ctx context.Context, columns documentColumns, jobName JobType, statusRequest, statusResult int) {
+	if oc.documents == nil || columns == nil || statusRequest == 0 || ctx.Err() != nil {
+		return
+	}
+	if jobName != JobProforma && jobName != JobInvoice {
+		return
+	}
+	if statusResult == 0 {
+		statusResult = statusRequest + 1
+	}
+	proforma := jobName == JobProforma
+	log := oc.log.With(
+		slog.String("job", string(jobName)),
+		slog.Int("status", statusResult),
+	)
+
+	since := time.Now().Add(-reconcileWindow)
+	var afterId int64
+	for {
+		ids, err := columns.OrdersWithoutDocument(ctx, statusResult, proforma, since, afterId)
+		if err != nil {
+			log.With(sl.Err(err)).Error("get orders without document")
+			return
+		}
+		if len(ids) == 0 {
+			return
+		}
+		for _, id := range ids {
+			if ctx.Err() != nil {
+				return
+			}
+			afterId = id
+			orderId := strconv.FormatInt(id, 10)
+			stored, err := oc.documents.GetCheckoutParamsByOrder(orderId)
+			if err != nil {
+				log.With(
+					slog.String("order_id", orderId),
+					sl.Err(err),
+				).Warn("get stored order")
+				continue
+			}
+			if stored == nil {
+				continue
+			}
+			docId, docFile := stored.InvoiceId, stored.InvoiceFile
+			if proforma {
+				docId, docFile = stored.ProformaId, stored.ProformaFile
+			}
+			if docId == "" {
+				continue
+			}
+			oc.resendDocument(ctx, log, columns, id, orderId, proforma, docId, docFile)
+		}
+	}
+}
+
+// resendDocument writes one order's document column under the order's processing lock,
+// so it never races the handleOrder run that is about to write the same column.
+func (oc *Opencart) resendDocument(ctx context.Context, log *slog.Logger, columns documentColumns, id int64, orderId string, proforma bool, docId, docFile string) {
+	release, ok := oc.lockOrder(orderId, log)
+	if !ok {
+		return
+	}
+	defer release()
+
+	var err error
+	if proforma {
+		err = columns.UpdateProforma(ctx, id, docId, docFile)
+	} else {
+		err = columns.UpdateInvoice(ctx, id, docId, docFile)
+	}
+	if err != nil {
+		log.With(
+			slog.String("order_id", orderId),
+			sl.Err(err),
+		).Error("resend document id")
+		return
+	}
+	log.With(
+		slog.String("order_id", orderId),
+		slog.String("document_id", docId),
+	).Info("document id restored on order")
+}
@@ -0,0 +1,174 @@
+package oc_client
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"wfsync/entity"
+)
+
+// memColumns is an OpenCart order table reduced to the status and document columns.
+type memColumns struct {
+	status   map[int64]int
+	invoice  map[int64]string
+	proforma map[int64]string
+	files    map[int64]string
+	writes   int
+	pages    int
+}
+
+const memPageSize = 20
+
+// OrdersWithoutDocument pages like the SQL query: ids in ascending order, after afterId,
+// at most memPageSize at a time.
+func (m *memColumns) OrdersWithoutDocument(_ context.Context, statusId int, proforma bool, _ time.Time, afterId int64) ([]int64, error) {
+	column := m.invoice
+	if proforma {
+		column = m.proforma
+	}
+	var ids []int64
+	for id, status := range m.status {
+		if id > afterId && status == statusId && column[id] == "" {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	if len(ids) > memPageSize {
+		ids = ids[:memPageSize]
+	}
+	m.pages++
+	return ids, nil
+}
+
+func (m *memColumns) UpdateProforma(_ context.Context, orderId int64, proformaId, proformaFile string) error {
+	m.writes++
+	m.proforma[orderId] = proformaId
+	m.files[orderId] = proformaFile
+	return nil
+}
+
+func (m *memColumns) UpdateInvoice(_ context.Context, orderId int64, invoiceId, invoiceFile string) error {
+	m.writes++
+	m.invoice[orderId] = invoiceId
+	m.files[orderId] = invoiceFile
+	return nil
+}
+
+type memDocuments map[string]*entity.CheckoutParams
+
+func (m memDocuments) GetCheckoutParamsByOrder(orderId string) (*entity.CheckoutParams, error) {
+	return m[orderId], nil
+}
+
+// TestReconcileDocuments recovers orders whose status change went through but whose
+// document column update failed: the column is written from the stored id, while orders
+// that are consistent, failed without a document, or sit in another status are untouched.
+func TestReconcileDocuments(t *testing.T) {
+	cases := []struct {
+		name     string
+		job      JobType
+		status   int
+		stored   *entity.CheckoutParams
+		column   string
+		wantId   string
+		wantFile string
+		wantSent bool
+	}{
+		{"invoice column lost", JobInvoice, 31, &entity.CheckoutParams{InvoiceId: "555", InvoiceFile: "inv.pdf"}, "", "555", "inv.pdf", true},
+		{"proforma column lost", JobProforma, 21, &entity.CheckoutParams{ProformaId: "444", ProformaFile: "pro.pdf"}, "", "444", "pro.pdf", true},
+		{"consistent order", JobInvoice, 31, &entity.CheckoutParams{InvoiceId: "555"}, "555", "555", "", false},
+		{"job failed, nothing stored", JobInvoice, 31, &entity.CheckoutParams{}, "", "", "", false},
+		{"no stored order", JobInvoice, 31, nil, "", "", "", false},
+		{"still in request status", JobInvoice, 30, &entity.CheckoutParams{InvoiceId: "555"}, "", "", "", false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			columns := &memColumns{
+				status:   map[int64]int{100: tc.status},
+				invoice:  map[int64]string{},
+				proforma: map[int64]string{},
+				files:    map[int64]string{},
+			}
+			docs := memDocuments{}
+			if tc.stored != nil {
+				tc.stored.OrderId = "100"
+				docs["100"] = tc.stored
+			}
+			if tc.job == JobProforma {
+				columns.proforma[100] = tc.column
+			} else {
+				columns.invoice[100] = tc.column
+			}
+			oc := (&Opencart{log: slog.New(slog.NewTextHandler(io.Discard, nil))}).WithDocumentStore(docs)
+
+			request, result := 30, 31
+			if tc.job == JobProforma {
+				request, result = 20, 21
+			}
+			oc.reconcileDocuments(context.Background(), columns, tc.job, request, result)
+
+			got := columns.invoice[100]
+			if tc.job == JobProforma {
+				got = columns.proforma[100]
+			}
+			if got != tc.wantId || columns.files[100] != tc.wantFile {
+				t.Errorf("document column = %q file %q, want %q file %q", got, columns.files[100], tc.wantId, tc.wantFile)
+			}
+			if sent := columns.writes > 0; sent != tc.wantSent {
+				t.Errorf("column update sent = %v, want %v", sent, tc.wantSent)
+			}
+		})
+	}
+}
+
+// TestReconcileDocumentsDisabled checks that the pass does nothing without a document
+// store or for the payment link job, which has no document column.
+func TestReconcileDocumentsDisabled(t *testing.T) {
+	columns := &memColumns{
+		status:   map[int64]int{100: 11},
+		invoice:  map[int64]string{},
+		proforma: map[int64]string{},
+		files:    map[int64]string{},
+	}
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	docs := memDocuments{"100": {OrderId: "100", InvoiceId: "555", ProformaId: "444"}}
+
+	(&Opencart{log: log}).reconcileDocuments(context.Background(), columns, JobInvoice, 10, 11)
+	(&Opencart{log: log}).WithDocumentStore(docs).reconcileDocuments(context.Background(), columns, JobStripeLink, 10, 11)
+	if columns.writes != 0 {
+		t.Errorf("column updates = %d, want none", columns.writes)
+	}
+}
+
+// TestReconcileDocumentsPages checks that orders whose job failed, which stay in the
+// result status without a document, do not hide a broken order behind a full page.
+func TestReconcileDocumentsPages(t *testing.T) {
+	columns := &memColumns{
+		status:   map[int64]int{},
+		invoice:  map[int64]string{},
+		proforma: map[int64]string{},
+		files:    map[int64]string{},
+	}
+	docs := memDocuments{}
+	for id := int64(100); id < 100+2*memPageSize; id++ {
+		columns.status[id] = 31
+		docs[strconv.FormatInt(id, 10)] = &entity.CheckoutParams{}
+	}
+	columns.status[500] = 31
+	docs["500"] = &entity.CheckoutParams{OrderId: "500", InvoiceId: "555", InvoiceFile: "inv.pdf"}
+	oc := (&Opencart{log: slog.New(slog.NewTextHandler(io.Discard, nil))}).WithDocumentStore(docs)
+
+	oc.reconcileDocuments(context.Background(), columns, JobInvoice, 30, 31)
+
+	if columns.invoice[500] != "555" || columns.writes != 1 {
+		t.Errorf("order 500 invoice = %q after %d updates, want 555 after 1", columns.invoice[500], columns.writes)
+	}
+	if columns.pages != 4 {
+		t.Errorf("pages read = %d, want 4", columns.pages)
+	}
+}